@@ -0,0 +1,384 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"var-sync/pkg/models"
+)
+
+// awsClient calls AWS JSON APIs, signing requests with Signature Version 4
+// using credentials from the standard AWS credential chain
+type awsClient struct {
+	config      models.AWSConfig
+	client      *http.Client
+	credentials awsCredentials
+	mutex       sync.Mutex
+	now         func() time.Time
+}
+
+// awsCredentials are the keys requests are signed with. Expires is zero for
+// long-lived keys.
+type awsCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	Expires         time.Time
+}
+
+// awsError is the error body returned by AWS JSON APIs
+type awsError struct {
+	Type    string `json:"__type"`
+	Message string `json:"message"`
+}
+
+func (e *awsError) Error() string {
+	// Types may be qualified, as in com.amazonaws.ssm#ParameterNotFound
+	code := e.Type[strings.LastIndex(e.Type, "#")+1:]
+	if e.Message == "" {
+		return "aws returned " + code
+	}
+	return fmt.Sprintf("aws returned %s: %s", code, e.Message)
+}
+
+// is reports whether the error has the given type
+func (e *awsError) is(code string) bool {
+	return e.Type == code || strings.HasSuffix(e.Type, "#"+code)
+}
+
+// newAWSClient creates a client, resolving the profile and region from the
+// environment and shared config file when not configured
+func newAWSClient(cfg models.AWSConfig) *awsClient {
+	if cfg.Profile == "" {
+		cfg.Profile = os.Getenv("AWS_PROFILE")
+	}
+	if cfg.Profile == "" {
+		cfg.Profile = "default"
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_REGION")
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if cfg.Region == "" {
+		section := "profile " + cfg.Profile
+		if cfg.Profile == "default" {
+			section = "default"
+		}
+		cfg.Region = readAWSProfile(awsFile("AWS_CONFIG_FILE", "config"), section)["region"]
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+
+	return &awsClient{
+		config: cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// call invokes operation target of a JSON protocol service and decodes the
+// response into response
+func (a *awsClient) call(ctx context.Context, service, target string, request, response any) error {
+	if a.config.Region == "" {
+		return fmt.Errorf("aws region not configured: set aws.region or AWS_REGION")
+	}
+	credentials, err := a.resolveCredentials(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("failed to encode aws request: %w", err)
+	}
+
+	endpoint := a.config.Endpoint
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.%s.amazonaws.com", service, a.config.Region)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create aws request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	signV4(req, body, credentials, a.config.Region, service, a.now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach aws %s: %w", service, err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read aws response: %w", err)
+	}
+	if resp.StatusCode >= 300 {
+		failure := &awsError{}
+		if err := json.Unmarshal(data, failure); err != nil || failure.Type == "" {
+			return fmt.Errorf("aws %s returned %d", service, resp.StatusCode)
+		}
+		return failure
+	}
+	if err := json.Unmarshal(data, response); err != nil {
+		return fmt.Errorf("failed to parse aws response: %w", err)
+	}
+	return nil
+}
+
+// resolveCredentials returns cached credentials, looking them up again once
+// they are about to expire
+func (a *awsClient) resolveCredentials(ctx context.Context) (awsCredentials, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	held := a.credentials
+	if held.AccessKeyID != "" && (held.Expires.IsZero() || a.now().Add(5*time.Minute).Before(held.Expires)) {
+		return held, nil
+	}
+
+	credentials, err := a.lookupCredentials(ctx)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	a.credentials = credentials
+	return credentials, nil
+}
+
+// lookupCredentials walks the credential chain: environment variables, the
+// shared credentials file, the ECS task role, then the EC2 instance role
+func (a *awsClient) lookupCredentials(ctx context.Context) (awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{
+			AccessKeyID:     id,
+			SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+			SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+		}, nil
+	}
+
+	profile := readAWSProfile(awsFile("AWS_SHARED_CREDENTIALS_FILE", "credentials"), a.config.Profile)
+	if profile["aws_access_key_id"] != "" {
+		return awsCredentials{
+			AccessKeyID:     profile["aws_access_key_id"],
+			SecretAccessKey: profile["aws_secret_access_key"],
+			SessionToken:    profile["aws_session_token"],
+		}, nil
+	}
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return a.fetchRoleCredentials(ctx, "http://169.254.170.2"+uri, nil)
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		return a.fetchRoleCredentials(ctx, uri, map[string]string{"Authorization": os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")})
+	}
+
+	if os.Getenv("AWS_EC2_METADATA_DISABLED") != "true" {
+		if credentials, err := a.instanceCredentials(ctx); err == nil {
+			return credentials, nil
+		}
+	}
+	return awsCredentials{}, fmt.Errorf("no aws credentials found: set AWS_ACCESS_KEY_ID or configure profile %q", a.config.Profile)
+}
+
+// instanceCredentials fetches the EC2 instance role's credentials via IMDSv2
+func (a *awsClient) instanceCredentials(ctx context.Context) (awsCredentials, error) {
+	endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+	if endpoint == "" {
+		endpoint = "http://169.254.169.254"
+	}
+	endpoint = strings.TrimSuffix(endpoint, "/")
+	client := &http.Client{Timeout: time.Second}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, endpoint+"/latest/api/token", nil)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	req.Header.Set("X-aws-ec2-metadata-token-ttl-seconds", "21600")
+	resp, err := client.Do(req)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	token, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return awsCredentials{}, fmt.Errorf("instance metadata returned %d", resp.StatusCode)
+	}
+	headers := map[string]string{"X-aws-ec2-metadata-token": string(token)}
+
+	rolesURL := endpoint + "/latest/meta-data/iam/security-credentials/"
+	roles, err := a.fetchMetadata(ctx, client, rolesURL, headers)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+	role, _, _ := strings.Cut(strings.TrimSpace(string(roles)), "\n")
+	return a.fetchRoleCredentials(ctx, rolesURL+role, headers)
+}
+
+// fetchRoleCredentials reads temporary role credentials from a metadata
+// endpoint
+func (a *awsClient) fetchRoleCredentials(ctx context.Context, url string, headers map[string]string) (awsCredentials, error) {
+	data, err := a.fetchMetadata(ctx, &http.Client{Timeout: 5 * time.Second}, url, headers)
+	if err != nil {
+		return awsCredentials{}, err
+	}
+
+	var result struct {
+		AccessKeyID     string `json:"AccessKeyId"`
+		SecretAccessKey string
+		Token           string
+		Expiration      time.Time
+	}
+	if err := json.Unmarshal(data, &result); err != nil || result.AccessKeyID == "" {
+		return awsCredentials{}, fmt.Errorf("failed to parse aws role credentials from %s", url)
+	}
+	return awsCredentials{
+		AccessKeyID:     result.AccessKeyID,
+		SecretAccessKey: result.SecretAccessKey,
+		SessionToken:    result.Token,
+		Expires:         result.Expiration,
+	}, nil
+}
+
+// fetchMetadata performs a GET against a credentials metadata endpoint
+func (a *awsClient) fetchMetadata(ctx context.Context, client *http.Client, url string, headers map[string]string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, value := range headers {
+		if value != "" {
+			req.Header.Set(name, value)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch aws credentials: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("aws credentials endpoint %s returned %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// awsFile returns the shared AWS file named by env, or its default location
+// under ~/.aws
+func awsFile(env, name string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", name)
+}
+
+// readAWSProfile returns the keys of one section of a shared AWS config or
+// credentials file. A missing file or section has no keys.
+func readAWSProfile(path, section string) map[string]string {
+	values := make(map[string]string)
+	file, err := os.Open(path)
+	if err != nil {
+		return values
+	}
+	defer file.Close()
+
+	current := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if key, value, found := strings.Cut(line, "="); found && current == section {
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
+
+// signV4 adds AWS Signature Version 4 headers to req, signing the host, the
+// content type and every X-Amz header
+func signV4(req *http.Request, body []byte, credentials awsCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "content-type" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.Join(values, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	payloadHash := sha256.Sum256(body)
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		req.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + credentials.SecretAccessKey)
+	for _, part := range []string{date, region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,232 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"var-sync/pkg/models"
+)
+
+func TestSignV4(t *testing.T) {
+	// The get-vanilla case of the AWS Signature Version 4 test suite
+	req, _ := http.NewRequest(http.MethodGet, "https://example.amazonaws.com/", nil)
+	credentials := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signV4(req, nil, credentials, "us-east-1", "service", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	expected := "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+		"SignedHeaders=host;x-amz-date, Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31"
+	if got := req.Header.Get("Authorization"); got != expected {
+		t.Errorf("signV4() Authorization =\n%s\nexpected\n%s", got, expected)
+	}
+}
+
+func TestAWSCredentialChain(t *testing.T) {
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "credentials")
+	configFile := filepath.Join(dir, "config")
+	os.WriteFile(credentialsFile, []byte("[default]\naws_access_key_id = DEFAULTKEY\naws_secret_access_key = default\n\n[ops]\naws_access_key_id = OPSKEY\naws_secret_access_key = ops\n"), 0644)
+	os.WriteFile(configFile, []byte("[profile ops]\nregion = eu-west-1\n"), 0644)
+
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	t.Setenv("AWS_CONFIG_FILE", configFile)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_PROFILE", "AWS_REGION", "AWS_DEFAULT_REGION", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI"} {
+		t.Setenv(name, "")
+	}
+
+	client := newAWSClient(models.AWSConfig{Profile: "ops"})
+	if client.config.Region != "eu-west-1" {
+		t.Errorf("Region = %q, expected the profile's region", client.config.Region)
+	}
+	credentials, err := client.resolveCredentials(t.Context())
+	if err != nil || credentials.AccessKeyID != "OPSKEY" {
+		t.Errorf("resolveCredentials() = %v, %v, expected the ops profile", credentials, err)
+	}
+
+	// Environment variables take precedence over the credentials file
+	t.Setenv("AWS_ACCESS_KEY_ID", "ENVKEY")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env")
+	credentials, err = newAWSClient(models.AWSConfig{}).resolveCredentials(t.Context())
+	if err != nil || credentials.AccessKeyID != "ENVKEY" {
+		t.Errorf("resolveCredentials() = %v, %v, expected the environment", credentials, err)
+	}
+
+	// Container credentials are used when no keys are configured
+	roleServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{
+			"AccessKeyId":     "ROLEKEY",
+			"SecretAccessKey": "role",
+			"Token":           "session",
+			"Expiration":      time.Now().Add(time.Hour),
+		})
+	}))
+	defer roleServer.Close()
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(dir, "missing"))
+	t.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", roleServer.URL)
+	credentials, err = newAWSClient(models.AWSConfig{}).resolveCredentials(t.Context())
+	if err != nil || credentials.AccessKeyID != "ROLEKEY" || credentials.SessionToken != "session" {
+		t.Errorf("resolveCredentials() = %v, %v, expected the container role", credentials, err)
+	}
+}
+
+// fakeAWS serves Parameter Store and Secrets Manager operations from memory
+type fakeAWS struct {
+	mutex      sync.Mutex
+	parameters map[string]ssmParameter
+	secrets    map[string]string
+}
+
+func (f *fakeAWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=TESTKEY/") {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{"__type": "UnrecognizedClientException", "message": "invalid signature"})
+		return
+	}
+
+	var request map[string]any
+	json.NewDecoder(r.Body).Decode(&request)
+	notFound := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]any{"__type": code})
+	}
+
+	switch r.Header.Get("X-Amz-Target") {
+	case "AmazonSSM.GetParameter":
+		parameter, ok := f.parameters[request["Name"].(string)]
+		if !ok {
+			notFound("ParameterNotFound")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Parameter": parameter})
+	case "AmazonSSM.GetParametersByPath":
+		var parameters []ssmParameter
+		for name, parameter := range f.parameters {
+			rest, ok := strings.CutPrefix(name, request["Path"].(string)+"/")
+			if ok && !strings.Contains(rest, "/") {
+				parameters = append(parameters, parameter)
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Parameters": parameters})
+	case "AmazonSSM.PutParameter":
+		name := request["Name"].(string)
+		f.parameters[name] = ssmParameter{Name: name, Type: request["Type"].(string), Value: request["Value"].(string)}
+		json.NewEncoder(w).Encode(map[string]any{"Version": 2})
+	case "secretsmanager.GetSecretValue":
+		secret, ok := f.secrets[request["SecretId"].(string)]
+		if !ok {
+			notFound("ResourceNotFoundException")
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"SecretString": secret})
+	case "secretsmanager.PutSecretValue":
+		f.secrets[request["SecretId"].(string)] = request["SecretString"].(string)
+		w.Write([]byte("{}"))
+	case "secretsmanager.CreateSecret":
+		f.secrets[request["Name"].(string)] = request["SecretString"].(string)
+		w.Write([]byte("{}"))
+	}
+}
+
+func newFakeAWS(t *testing.T) (*fakeAWS, models.AWSConfig) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "TESTKEY")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	fake := &fakeAWS{parameters: make(map[string]ssmParameter), secrets: make(map[string]string)}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, models.AWSConfig{Region: "us-east-1", Endpoint: server.URL}
+}
+
+func TestSSM(t *testing.T) {
+	fake, cfg := newFakeAWS(t)
+	fake.parameters["/app/db_host"] = ssmParameter{Name: "/app/db_host", Type: "String", Value: "localhost"}
+	fake.parameters["/app/db_password"] = ssmParameter{Name: "/app/db_password", Type: "SecureString", Value: "hunter2"}
+	fake.parameters["/app/nested/key"] = ssmParameter{Name: "/app/nested/key", Type: "String", Value: "ignored"}
+	fake.parameters["/app/config"] = ssmParameter{Name: "/app/config", Type: "String", Value: `{"pool": {"size": 5}}`}
+	ssm := NewSSM(cfg)
+
+	data, err := ssm.Load(t.Context(), "app/")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(data) != 3 || data["db_host"] != "localhost" || data["db_password"] != "hunter2" {
+		t.Errorf("Load() = %v", data)
+	}
+
+	if err := ssm.Update(t.Context(), "app/", map[string]any{"db_password": "rotated", "db_user": "app"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if parameter := fake.parameters["/app/db_password"]; parameter.Value != "rotated" || parameter.Type != "SecureString" {
+		t.Errorf("Update() should keep the SecureString type: %v", parameter)
+	}
+	if parameter := fake.parameters["/app/db_user"]; parameter.Type != "String" {
+		t.Errorf("Update() should create new parameters as String: %v", parameter)
+	}
+
+	if err := ssm.Update(t.Context(), "app/config", map[string]any{"pool.size": 10}); err != nil {
+		t.Fatalf("Update() of JSON parameter error = %v", err)
+	}
+	document, err := ssm.Load(t.Context(), "app/config")
+	if err != nil {
+		t.Fatalf("Load() of JSON parameter error = %v", err)
+	}
+	if document["pool"].(map[string]any)["size"] != json.Number("10") {
+		t.Errorf("Load() after Update() = %v", document)
+	}
+
+	if _, err := ssm.Load(t.Context(), "app/missing"); err == nil {
+		t.Error("Load() expected error for missing parameter")
+	}
+
+	folder, key := ssm.SplitKey("app/db_host")
+	if folder != "app/" || key != "db_host" {
+		t.Errorf("SplitKey() = %q, %q", folder, key)
+	}
+}
+
+func TestSecretsManager(t *testing.T) {
+	fake, cfg := newFakeAWS(t)
+	fake.secrets["prod/db"] = `{"username": "app", "password": "hunter2"}`
+	sm := NewSecretsManager(cfg)
+
+	data, err := sm.Load(t.Context(), "prod/db")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if data["password"] != "hunter2" {
+		t.Errorf("Load() = %v", data)
+	}
+
+	if err := sm.Update(t.Context(), "prod/db", map[string]any{"password": "rotated"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if !strings.Contains(fake.secrets["prod/db"], `"password":"rotated"`) || !strings.Contains(fake.secrets["prod/db"], `"username":"app"`) {
+		t.Errorf("Update() should change one key and keep the rest: %s", fake.secrets["prod/db"])
+	}
+
+	if err := sm.Update(t.Context(), "prod/new", map[string]any{"token": "abc"}); err != nil {
+		t.Fatalf("Update() of new secret error = %v", err)
+	}
+	if fake.secrets["prod/new"] != `{"token":"abc"}` {
+		t.Errorf("Update() should create the secret: %q", fake.secrets["prod/new"])
+	}
+
+	if _, err := sm.Load(t.Context(), "prod/missing"); err == nil {
+		t.Error("Load() expected error for missing secret")
+	}
+
+	fake.secrets["prod/plain"] = "not json"
+	if _, err := sm.Load(t.Context(), "prod/plain"); err == nil {
+		t.Error("Load() expected error for a secret that is not a JSON object")
+	}
+}
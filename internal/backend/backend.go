@@ -0,0 +1,366 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"var-sync/internal/parser"
+	"var-sync/pkg/models"
+)
+
+// Backend stores key/value documents somewhere other than a local file, such
+// as the process environment or a secret store. Paths are backend specific.
+type Backend interface {
+	// Load reads the document at path
+	Load(ctx context.Context, path string) (map[string]any, error)
+	// Update writes values to key paths within the document at path
+	Update(ctx context.Context, path string, updates map[string]any) error
+}
+
+// KeySplitter is implemented by flat key/value backends whose reference paths
+// can name a single key, such as env://APP_DB_HOST
+type KeySplitter interface {
+	SplitKey(path string) (document, key string)
+}
+
+// Deleter is implemented by backends that can remove keys from a document
+type Deleter interface {
+	Delete(ctx context.Context, path string, keys []string) error
+}
+
+// Watcher is implemented by backends that can wait for a document to change
+// instead of being polled
+type Watcher interface {
+	// Watch calls changed each time the document at path changes and returns
+	// nil once stop is closed
+	Watch(path string, stop <-chan struct{}, changed func()) error
+}
+
+// Ref is a parsed backend reference of the form scheme://path#key
+type Ref struct {
+	Scheme string
+	Path   string
+	Key    string
+}
+
+// ParseRef parses location as a backend reference. Plain file paths are not
+// references.
+func ParseRef(location string) (Ref, bool) {
+	scheme, rest, found := strings.Cut(location, "://")
+	if !found || scheme == "" || strings.ContainsAny(scheme, `/\.`) {
+		return Ref{}, false
+	}
+
+	path, key, _ := strings.Cut(rest, "#")
+	return Ref{Scheme: scheme, Path: path, Key: key}, true
+}
+
+// IsRef reports whether location is a backend reference rather than a file path
+func IsRef(location string) bool {
+	_, ok := ParseRef(location)
+	return ok
+}
+
+// Document returns the reference without its key, naming the whole document
+func (r Ref) Document() string {
+	return r.Scheme + "://" + r.Path
+}
+
+func (r Ref) String() string {
+	if r.Key == "" {
+		return r.Document()
+	}
+	return r.Document() + "#" + r.Key
+}
+
+// Registry reads and writes rule sources and targets, dispatching backend
+// references by scheme and treating everything else as a local file
+type Registry struct {
+	parser   *parser.Parser
+	backends map[string]Backend
+	mutex    sync.RWMutex
+}
+
+// NewRegistry creates a registry with the built-in backends
+func NewRegistry() *Registry {
+	r := &Registry{
+		parser:   parser.New(),
+		backends: make(map[string]Backend),
+	}
+	r.Register("env", NewEnv())
+	r.Register("http", NewHTTP("http", models.HTTPConfig{}))
+	r.Register("https", NewHTTP("https", models.HTTPConfig{}))
+	return r
+}
+
+// FromConfig creates a registry with the built-in backends and every backend
+// configured in cfg
+func FromConfig(cfg *models.Config) *Registry {
+	r := NewRegistry()
+	if cfg.Vault != nil {
+		r.Register("vault", NewVault(*cfg.Vault))
+	}
+	if cfg.Consul != nil {
+		r.Register("consul", NewConsul(*cfg.Consul))
+	}
+	if cfg.Etcd != nil {
+		r.Register("etcd", NewEtcd(*cfg.Etcd))
+	}
+	if cfg.HTTP != nil {
+		r.Register("http", NewHTTP("http", *cfg.HTTP))
+		r.Register("https", NewHTTP("https", *cfg.HTTP))
+	}
+	if cfg.AWS != nil {
+		r.Register("ssm", NewSSM(*cfg.AWS))
+		r.Register("aws-sm", NewSecretsManager(*cfg.AWS))
+	}
+	return r
+}
+
+// Register adds or replaces the backend for scheme
+func (r *Registry) Register(scheme string, backend Backend) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.backends[scheme] = backend
+}
+
+// lookup returns the backend for a reference
+func (r *Registry) lookup(ref Ref) (Backend, error) {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	backend, ok := r.backends[ref.Scheme]
+	if !ok {
+		return nil, fmt.Errorf("unsupported backend: %s://", ref.Scheme)
+	}
+	return backend, nil
+}
+
+// Load reads the document at location, a file path or backend reference
+func (r *Registry) Load(location string) (map[string]any, error) {
+	return r.LoadContext(context.Background(), location)
+}
+
+// LoadContext is Load, giving up on remote backends once ctx is done
+func (r *Registry) LoadContext(ctx context.Context, location string) (map[string]any, error) {
+	ref, ok := ParseRef(location)
+	if !ok {
+		return r.parser.LoadFileContext(ctx, location)
+	}
+
+	backend, err := r.lookup(ref)
+	if err != nil {
+		return nil, err
+	}
+	return backend.Load(ctx, ref.Path)
+}
+
+// LoadKeys is LoadContext for reading the values at keyPaths alone. A large
+// JSON or YAML file is scanned for just those values, in which case partial
+// is true; backends and other files are loaded whole.
+func (r *Registry) LoadKeys(ctx context.Context, location string, keyPaths []string) (data map[string]any, partial bool, err error) {
+	if IsRef(location) {
+		data, err = r.LoadContext(ctx, location)
+		return data, false, err
+	}
+	return r.parser.LoadFileKeys(ctx, location, keyPaths)
+}
+
+// Update writes values to key paths in the document at location, removing
+// those set to parser.Deleted. Files are updated surgically to preserve their
+// formatting, and the key paths in create are added to them if missing.
+// Backends add missing keys anyway.
+func (r *Registry) Update(location string, updates map[string]any, create ...string) error {
+	return r.UpdateContext(context.Background(), location, updates, create...)
+}
+
+// UpdateContext is Update, giving up on remote backends once ctx is done
+func (r *Registry) UpdateContext(ctx context.Context, location string, updates map[string]any, create ...string) error {
+	ref, ok := ParseRef(location)
+	if !ok {
+		return r.parser.UpdateFileValuesContext(ctx, location, updates, create...)
+	}
+
+	backend, err := r.lookup(ref)
+	if err != nil {
+		return err
+	}
+
+	values := make(map[string]any, len(updates))
+	var deleted []string
+	for key, value := range updates {
+		if value == parser.Deleted {
+			deleted = append(deleted, key)
+		} else {
+			values[key] = value
+		}
+	}
+	if len(values) > 0 || len(deleted) == 0 {
+		if err := backend.Update(ctx, ref.Path, values); err != nil {
+			return err
+		}
+	}
+	if len(deleted) == 0 {
+		return nil
+	}
+	deleter, ok := backend.(Deleter)
+	if !ok {
+		return fmt.Errorf("backend %s:// cannot delete keys", ref.Scheme)
+	}
+	sort.Strings(deleted)
+	return deleter.Delete(ctx, ref.Path, deleted)
+}
+
+// CanWatch reports whether the document at location can be watched with Watch
+// rather than polled. Files are watched with fsnotify instead.
+func (r *Registry) CanWatch(location string) bool {
+	ref, ok := ParseRef(location)
+	if !ok {
+		return false
+	}
+	backend, err := r.lookup(ref)
+	if err != nil {
+		return false
+	}
+	_, ok = backend.(Watcher)
+	return ok
+}
+
+// Watch waits for changes to the document at location, which must be a
+// reference to a backend that CanWatch
+func (r *Registry) Watch(location string, stop <-chan struct{}, changed func()) error {
+	ref, ok := ParseRef(location)
+	if !ok {
+		return fmt.Errorf("not a backend reference: %s", location)
+	}
+	backend, err := r.lookup(ref)
+	if err != nil {
+		return err
+	}
+	watcher, ok := backend.(Watcher)
+	if !ok {
+		return fmt.Errorf("backend %s:// cannot be watched", ref.Scheme)
+	}
+	return watcher.Watch(ref.Path, stop, changed)
+}
+
+// Read returns the current content of location as text, for display in diffs
+func (r *Registry) Read(location string) (string, error) {
+	return r.ReadContext(context.Background(), location)
+}
+
+// ReadContext is Read, giving up on remote backends once ctx is done
+func (r *Registry) ReadContext(ctx context.Context, location string) (string, error) {
+	if !IsRef(location) {
+		content, err := os.ReadFile(location)
+		if err != nil {
+			return "", fmt.Errorf("failed to read file: %w", err)
+		}
+		return string(content), nil
+	}
+
+	data, err := r.LoadContext(ctx, location)
+	if err != nil {
+		return "", err
+	}
+	return formatDocument(data), nil
+}
+
+// Preview returns the content of location as text with updates applied,
+// without writing anything
+func (r *Registry) Preview(location string, updates map[string]any, create ...string) (string, error) {
+	return r.PreviewContext(context.Background(), location, updates, create...)
+}
+
+// PreviewContext is Preview, giving up on remote backends once ctx is done
+func (r *Registry) PreviewContext(ctx context.Context, location string, updates map[string]any, create ...string) (string, error) {
+	if !IsRef(location) {
+		content, err := r.parser.PreviewFileValues(location, updates, create...)
+		if err != nil {
+			return "", err
+		}
+		return string(content), nil
+	}
+
+	data, err := r.LoadContext(ctx, location)
+	if err != nil {
+		return "", err
+	}
+	for _, keyPath := range sortedKeys(updates) {
+		if updates[keyPath] == parser.Deleted {
+			r.parser.DeleteValue(data, keyPath)
+			continue
+		}
+		if err := r.parser.SetValue(data, keyPath, updates[keyPath]); err != nil {
+			return "", fmt.Errorf("failed to set %s: %w", keyPath, err)
+		}
+	}
+	return formatDocument(data), nil
+}
+
+// Resolve splits a key carried by a reference out of location. A rule may
+// name its key in the reference itself, as in vault://secret/data/app#password
+// or env://APP_DB_HOST, and leave its key path empty.
+func (r *Registry) Resolve(location, key string) (string, string) {
+	ref, ok := ParseRef(location)
+	if !ok || key != "" {
+		return location, key
+	}
+
+	if ref.Key != "" {
+		return ref.Document(), ref.Key
+	}
+	if backend, err := r.lookup(ref); err == nil {
+		if splitter, ok := backend.(KeySplitter); ok {
+			document, key := splitter.SplitKey(ref.Path)
+			return Ref{Scheme: ref.Scheme, Path: document}.Document(), key
+		}
+	}
+	return location, key
+}
+
+// ResolveRule returns rule with keys carried by its source and target
+// references moved into its key paths
+func (r *Registry) ResolveRule(rule models.SyncRule) models.SyncRule {
+	rule.SourceFile, rule.SourceKey = r.Resolve(rule.SourceFile, rule.SourceKey)
+	rule.TargetFile, rule.TargetKey = r.Resolve(rule.TargetFile, rule.TargetKey)
+	return rule
+}
+
+// formatDocument renders a backend document as indented JSON with sorted keys
+func formatDocument(data map[string]any) string {
+	output, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return fmt.Sprintf("%v\n", data)
+	}
+	return string(output) + "\n"
+}
+
+// decodeDocument parses a JSON object stored as a single value. An empty value
+// is an empty document.
+func decodeDocument(value []byte) (map[string]any, error) {
+	document := make(map[string]any)
+	if len(bytes.TrimSpace(value)) == 0 {
+		return document, nil
+	}
+	if err := decodeJSON(value, &document); err != nil {
+		return nil, err
+	}
+	return document, nil
+}
+
+// sortedKeys returns the keys of updates in a stable order
+func sortedKeys(updates map[string]any) []string {
+	keys := make([]string, 0, len(updates))
+	for key := range updates {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,141 @@
+package backend
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"var-sync/pkg/models"
+)
+
+func TestParseRef(t *testing.T) {
+	tests := []struct {
+		location string
+		expected Ref
+		ok       bool
+	}{
+		{"env://APP_DB_HOST", Ref{Scheme: "env", Path: "APP_DB_HOST"}, true},
+		{"vault://secret/data/app#db_password", Ref{Scheme: "vault", Path: "secret/data/app", Key: "db_password"}, true},
+		{"config/app.yaml", Ref{}, false},
+		{"/tmp/weird://name.json", Ref{}, false},
+		{"./relative://name.json", Ref{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.location, func(t *testing.T) {
+			ref, ok := ParseRef(tt.location)
+			if ok != tt.ok || ref != tt.expected {
+				t.Errorf("ParseRef(%q) = %+v, %v; expected %+v, %v", tt.location, ref, ok, tt.expected, tt.ok)
+			}
+			if ok && ref.String() != tt.location {
+				t.Errorf("Ref.String() = %q, expected %q", ref.String(), tt.location)
+			}
+		})
+	}
+}
+
+func TestRegistryResolve(t *testing.T) {
+	r := NewRegistry()
+	tests := []struct {
+		location, key              string
+		expectedLocation, expected string
+	}{
+		{"env://APP_DB_HOST", "", "env://", "APP_DB_HOST"},
+		{"env://APP_", "DB_HOST", "env://APP_", "DB_HOST"},
+		{"vault://secret/data/app#db_password", "", "vault://secret/data/app", "db_password"},
+		{"config.yaml", "database.host", "config.yaml", "database.host"},
+	}
+
+	for _, tt := range tests {
+		location, key := r.Resolve(tt.location, tt.key)
+		if location != tt.expectedLocation || key != tt.expected {
+			t.Errorf("Resolve(%q, %q) = %q, %q; expected %q, %q", tt.location, tt.key, location, key, tt.expectedLocation, tt.expected)
+		}
+	}
+
+	rule := r.ResolveRule(models.SyncRule{SourceFile: "app.yaml", SourceKey: "db.host", TargetFile: "env://DB_HOST"})
+	if rule.TargetFile != "env://" || rule.TargetKey != "DB_HOST" || rule.SourceKey != "db.host" {
+		t.Errorf("ResolveRule() = %+v", rule)
+	}
+}
+
+func TestRegistryFilesAndEnv(t *testing.T) {
+	r := NewRegistry()
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte("port: 8080 # http\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	if err := r.Update(path, map[string]any{"port": 9090}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "port: 9090 # http\n" {
+		t.Errorf("Update() did not update file surgically: %q", content)
+	}
+
+	t.Setenv("VARSYNC_TEST_PORT", "1")
+	if err := r.Update("env://VARSYNC_TEST_", map[string]any{"PORT": 2}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	data, err := r.Load("env://VARSYNC_TEST_")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if data["PORT"] != int64(2) {
+		t.Errorf("Load() PORT = %#v, expected 2", data["PORT"])
+	}
+
+	preview, err := r.Preview("env://VARSYNC_TEST_", map[string]any{"PORT": 3})
+	if err != nil {
+		t.Fatalf("Preview() error = %v", err)
+	}
+	if !strings.Contains(preview, `"PORT": 3`) || os.Getenv("VARSYNC_TEST_PORT") != "2" {
+		t.Errorf("Preview() = %s, environment %s; expected preview only", preview, os.Getenv("VARSYNC_TEST_PORT"))
+	}
+
+	if _, err := r.Load("nope://thing"); err == nil {
+		t.Error("Load() expected error for unknown backend")
+	}
+}
+
+func TestRegistryCancelled(t *testing.T) {
+	// A server that does not answer until the test ends
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	r := NewRegistry()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := r.LoadContext(ctx, server.URL+"/config.json"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("LoadContext() error = %v, expected the deadline to be exceeded", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("LoadContext() took %v after its context was done", elapsed)
+	}
+
+	path := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(path, []byte("port: 8080\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if err := r.UpdateContext(ctx, path, map[string]any{"port": 9090}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("UpdateContext() error = %v, expected the deadline to be exceeded", err)
+	}
+	if content, _ := os.ReadFile(path); string(content) != "port: 8080\n" {
+		t.Errorf("UpdateContext() wrote %q after its context was done", content)
+	}
+}
@@ -0,0 +1,286 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"var-sync/internal/parser"
+	"var-sync/pkg/models"
+)
+
+// Consul reads and writes keys in Consul's KV store. A consul:// path ending
+// in "/" is a folder whose keys form a flat document, so consul://app/db_host
+// names the db_host key of folder app/. Any other path is a single key whose
+// value is a JSON object, addressed by key path: consul://app/config#db.host.
+type Consul struct {
+	config models.ConsulConfig
+	client *http.Client
+	parser *parser.Parser
+}
+
+// consulEntry is a key returned by the KV API
+type consulEntry struct {
+	Key         string
+	Value       string // Base64 encoded
+	ModifyIndex uint64
+}
+
+// consulWait is how long a blocking query waits for a change before Consul
+// answers with the unchanged data
+const consulWait = 5 * time.Minute
+
+// NewConsul creates a Consul backend. Address and token default to the
+// CONSUL_HTTP_ADDR and CONSUL_HTTP_TOKEN environment variables.
+func NewConsul(cfg models.ConsulConfig) *Consul {
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("CONSUL_HTTP_ADDR")
+	}
+	if cfg.Address == "" {
+		cfg.Address = "http://127.0.0.1:8500"
+	}
+	if !strings.Contains(cfg.Address, "://") {
+		cfg.Address = "http://" + cfg.Address
+	}
+	if cfg.Token == "" {
+		cfg.Token = os.Getenv("CONSUL_HTTP_TOKEN")
+	}
+	cfg.Address = strings.TrimSuffix(cfg.Address, "/")
+
+	return &Consul{
+		config: cfg,
+		client: &http.Client{},
+		parser: parser.New(),
+	}
+}
+
+// SplitKey splits a path naming a single key into its folder and key name
+func (c *Consul) SplitKey(path string) (string, string) {
+	index := strings.LastIndex(path, "/")
+	return path[:index+1], path[index+1:]
+}
+
+// Load returns the keys of a folder, or the JSON object stored at a key
+func (c *Consul) Load(ctx context.Context, path string) (map[string]any, error) {
+	entries, _, err := c.get(ctx, path, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if isFolder(path) {
+		result := make(map[string]any)
+		for _, entry := range entries {
+			name := strings.TrimPrefix(entry.Key, path)
+			if name == "" || strings.HasSuffix(name, "/") {
+				continue
+			}
+			value, err := base64.StdEncoding.DecodeString(entry.Value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to decode consul key %s: %w", entry.Key, err)
+			}
+			result[name] = parser.ParseEnvValue(string(value))
+		}
+		return result, nil
+	}
+
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("consul key not found: %s", path)
+	}
+	return decodeConsulDocument(entries[0])
+}
+
+// Update writes keys of a folder, or key paths within the JSON object stored
+// at a key. Objects are written with check-and-set so that a concurrent change
+// is never overwritten.
+func (c *Consul) Update(ctx context.Context, path string, updates map[string]any) error {
+	if isFolder(path) {
+		for _, name := range sortedKeys(updates) {
+			if err := c.put(ctx, path+name, []byte(formatEnvValue(updates[name])), -1); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	entries, _, err := c.get(ctx, path, 0)
+	if err != nil {
+		return err
+	}
+
+	document := make(map[string]any)
+	var index uint64
+	if len(entries) > 0 {
+		if document, err = decodeConsulDocument(entries[0]); err != nil {
+			return err
+		}
+		index = entries[0].ModifyIndex
+	}
+	for _, keyPath := range sortedKeys(updates) {
+		if err := c.parser.SetValue(document, keyPath, updates[keyPath]); err != nil {
+			return fmt.Errorf("failed to set %s: %w", keyPath, err)
+		}
+	}
+
+	encoded, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode consul value: %w", err)
+	}
+	return c.put(ctx, path, encoded, int64(index))
+}
+
+// Watch calls changed whenever the keys at path change, using blocking
+// queries, until stop is closed
+func (c *Consul) Watch(path string, stop <-chan struct{}, changed func()) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	_, index, err := c.get(ctx, path, 0)
+	for err == nil {
+		var next uint64
+		_, next, err = c.get(ctx, path, index)
+		if err == nil && next != index {
+			// Consul resets the index when it goes backwards, such as after a snapshot restore
+			if next > index {
+				changed()
+			}
+			index = next
+		}
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// get reads the entries at path, blocking until the KV index passes index
+// when it is non-zero. It returns the index of the response.
+func (c *Consul) get(ctx context.Context, path string, index uint64) ([]consulEntry, uint64, error) {
+	query := url.Values{}
+	if isFolder(path) {
+		query.Set("recurse", "true")
+	}
+	if index > 0 {
+		query.Set("index", strconv.FormatUint(index, 10))
+		query.Set("wait", consulWait.String())
+	}
+
+	resp, err := c.send(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer resp.Body.Close()
+
+	newIndex, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, newIndex, nil
+	}
+	if resp.StatusCode >= 300 {
+		return nil, 0, consulError(resp)
+	}
+
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, 0, fmt.Errorf("failed to parse consul response: %w", err)
+	}
+	return entries, newIndex, nil
+}
+
+// put writes a key. A non-negative cas only writes if the key's modify index
+// still matches, with 0 meaning the key must not exist yet.
+func (c *Consul) put(ctx context.Context, key string, value []byte, cas int64) error {
+	query := url.Values{}
+	if cas >= 0 {
+		query.Set("cas", strconv.FormatInt(cas, 10))
+	}
+
+	resp, err := c.send(ctx, http.MethodPut, key, query, value)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		return consulError(resp)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if strings.TrimSpace(string(body)) == "false" {
+		return fmt.Errorf("consul key %s was changed concurrently", key)
+	}
+	return nil
+}
+
+// send performs a request against the Consul KV API
+func (c *Consul) send(ctx context.Context, method, key string, query url.Values, body []byte) (*http.Response, error) {
+	if c.config.Datacenter != "" {
+		query.Set("dc", c.config.Datacenter)
+	}
+
+	endpoint := c.config.Address + "/v1/kv/" + strings.TrimPrefix(key, "/")
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create consul request: %w", err)
+	}
+	if c.config.Token != "" {
+		req.Header.Set("X-Consul-Token", c.config.Token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach consul: %w", err)
+	}
+	return resp, nil
+}
+
+// isFolder reports whether a consul:// or etcd:// path names a folder of keys
+// rather than a single key
+func isFolder(path string) bool {
+	return path == "" || strings.HasSuffix(path, "/")
+}
+
+// decodeConsulDocument parses a key holding a JSON object
+func decodeConsulDocument(entry consulEntry) (map[string]any, error) {
+	value, err := base64.StdEncoding.DecodeString(entry.Value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode consul key %s: %w", entry.Key, err)
+	}
+
+	document, err := decodeDocument(value)
+	if err != nil {
+		return nil, fmt.Errorf("consul key %s does not hold a JSON object: %w", entry.Key, err)
+	}
+	return document, nil
+}
+
+// consulError builds an error from a failed Consul response
+func consulError(resp *http.Response) error {
+	body, _ := io.ReadAll(resp.Body)
+	if message := strings.TrimSpace(string(body)); message != "" {
+		return fmt.Errorf("consul returned %d: %s", resp.StatusCode, message)
+	}
+	return fmt.Errorf("consul returned %d", resp.StatusCode)
+}
@@ -0,0 +1,185 @@
+package backend
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"var-sync/pkg/models"
+)
+
+// fakeConsul is an in-memory Consul KV store supporting recursive reads,
+// check-and-set writes and blocking queries
+type fakeConsul struct {
+	mutex   sync.Mutex
+	keys    map[string][]byte
+	indexes map[string]uint64
+	index   uint64
+	changed chan struct{}
+}
+
+func newFakeConsul() *fakeConsul {
+	return &fakeConsul{keys: make(map[string][]byte), indexes: make(map[string]uint64), index: 1, changed: make(chan struct{})}
+}
+
+func (f *fakeConsul) set(key string, value []byte) {
+	f.index++
+	f.keys[key] = value
+	f.indexes[key] = f.index
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *fakeConsul) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := strings.TrimPrefix(r.URL.Path, "/v1/kv/")
+	query := r.URL.Query()
+
+	switch r.Method {
+	case http.MethodGet:
+		f.mutex.Lock()
+		if wait, _ := strconv.ParseUint(query.Get("index"), 10, 64); wait > 0 && wait >= f.index {
+			changed := f.changed
+			f.mutex.Unlock()
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+			f.mutex.Lock()
+		}
+		defer f.mutex.Unlock()
+
+		var entries []map[string]any
+		for name, value := range f.keys {
+			if name == key || (query.Has("recurse") && strings.HasPrefix(name, key)) {
+				entries = append(entries, map[string]any{
+					"Key":         name,
+					"Value":       base64.StdEncoding.EncodeToString(value),
+					"ModifyIndex": f.indexes[name],
+				})
+			}
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i]["Key"].(string) < entries[j]["Key"].(string) })
+
+		w.Header().Set("X-Consul-Index", strconv.FormatUint(f.index, 10))
+		if len(entries) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(entries)
+	case http.MethodPut:
+		f.mutex.Lock()
+		defer f.mutex.Unlock()
+
+		if query.Has("cas") {
+			cas, _ := strconv.ParseUint(query.Get("cas"), 10, 64)
+			if f.indexes[key] != cas {
+				w.Write([]byte("false"))
+				return
+			}
+		}
+		value, _ := io.ReadAll(r.Body)
+		f.set(key, value)
+		w.Write([]byte("true"))
+	}
+}
+
+func TestConsulFolder(t *testing.T) {
+	fake := newFakeConsul()
+	fake.set("app/db_host", []byte("localhost"))
+	fake.set("app/db_port", []byte("5432"))
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	consul := NewConsul(models.ConsulConfig{Address: server.URL})
+
+	data, err := consul.Load(t.Context(), "app/")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if data["db_host"] != "localhost" || data["db_port"] != int64(5432) {
+		t.Errorf("Load() = %v", data)
+	}
+
+	if err := consul.Update(t.Context(), "app/", map[string]any{"db_host": "db.internal"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if string(fake.keys["app/db_host"]) != "db.internal" {
+		t.Errorf("Update() wrote %q", fake.keys["app/db_host"])
+	}
+
+	document, key := consul.SplitKey("app/db_host")
+	if document != "app/" || key != "db_host" {
+		t.Errorf("SplitKey() = %q, %q", document, key)
+	}
+}
+
+func TestConsulJSONDocument(t *testing.T) {
+	fake := newFakeConsul()
+	fake.set("app/config", []byte(`{"database": {"host": "localhost", "port": 5432}}`))
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	consul := NewConsul(models.ConsulConfig{Address: server.URL})
+
+	if err := consul.Update(t.Context(), "app/config", map[string]any{"database.host": "db.internal"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	data, err := consul.Load(t.Context(), "app/config")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	database := data["database"].(map[string]any)
+	if database["host"] != "db.internal" || database["port"] != json.Number("5432") {
+		t.Errorf("Load() after Update() = %v", data)
+	}
+
+	if _, err := consul.Load(t.Context(), "app/missing"); err == nil {
+		t.Error("Load() expected error for missing key")
+	}
+}
+
+func TestConsulWatch(t *testing.T) {
+	fake := newFakeConsul()
+	fake.set("app/db_host", []byte("localhost"))
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	consul := NewConsul(models.ConsulConfig{Address: server.URL})
+	stop := make(chan struct{})
+	changes := make(chan struct{}, 10)
+	done := make(chan error)
+	go func() {
+		done <- consul.Watch("app/", stop, func() { changes <- struct{}{} })
+	}()
+
+	// Give the watch time to issue its blocking query
+	time.Sleep(100 * time.Millisecond)
+	fake.mutex.Lock()
+	fake.set("app/db_host", []byte("db.internal"))
+	fake.mutex.Unlock()
+
+	select {
+	case <-changes:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Watch() did not report the change")
+	}
+
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Watch() returned %v after stop, expected nil", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Watch() did not return after stop")
+	}
+}
@@ -0,0 +1,76 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"var-sync/internal/parser"
+)
+
+// Env is the process environment. The path of an env:// reference is a
+// variable name prefix: env://APP_ with key DB_HOST names APP_DB_HOST, and
+// env://APP_DB_HOST on its own names that single variable.
+type Env struct{}
+
+// NewEnv creates the process environment backend
+func NewEnv() *Env {
+	return &Env{}
+}
+
+// SplitKey treats a reference path without a key as a single variable name
+func (e *Env) SplitKey(path string) (string, string) {
+	return "", path
+}
+
+// Load returns the variables starting with prefix, keyed by the rest of their
+// name. Values are typed like those in .env files.
+func (e *Env) Load(_ context.Context, prefix string) (map[string]any, error) {
+	result := make(map[string]any)
+	for _, entry := range os.Environ() {
+		name, value, _ := strings.Cut(entry, "=")
+		if prefix != "" && !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		result[strings.TrimPrefix(name, prefix)] = parser.ParseEnvValue(value)
+	}
+	return result, nil
+}
+
+// Update sets variables in the process environment, where they are inherited
+// by any commands var-sync runs
+func (e *Env) Update(_ context.Context, prefix string, updates map[string]any) error {
+	for key, value := range updates {
+		if key == "" || strings.ContainsAny(key, "=.") {
+			return fmt.Errorf("invalid environment variable name: %s", prefix+key)
+		}
+		if err := os.Setenv(prefix+key, formatEnvValue(value)); err != nil {
+			return fmt.Errorf("failed to set environment variable %s: %w", prefix+key, err)
+		}
+	}
+	return nil
+}
+
+// Delete removes variables from the process environment
+func (e *Env) Delete(_ context.Context, prefix string, keys []string) error {
+	for _, key := range keys {
+		if err := os.Unsetenv(prefix + key); err != nil {
+			return fmt.Errorf("failed to unset environment variable %s: %w", prefix+key, err)
+		}
+	}
+	return nil
+}
+
+// formatEnvValue renders a value as an environment variable, encoding objects
+// and arrays as JSON
+func formatEnvValue(value any) string {
+	switch value.(type) {
+	case map[string]any, []any:
+		if encoded, err := json.Marshal(value); err == nil {
+			return string(encoded)
+		}
+	}
+	return fmt.Sprintf("%v", value)
+}
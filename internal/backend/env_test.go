@@ -0,0 +1,22 @@
+package backend
+
+import (
+	"os"
+	"testing"
+)
+
+func TestEnvUpdate(t *testing.T) {
+	env := NewEnv()
+	t.Setenv("VARSYNC_TEST_HOSTS", "")
+
+	if err := env.Update(t.Context(), "VARSYNC_TEST_", map[string]any{"HOSTS": []any{"a", "b"}}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if got := os.Getenv("VARSYNC_TEST_HOSTS"); got != `["a","b"]` {
+		t.Errorf("Update() set %q, expected JSON array", got)
+	}
+
+	if err := env.Update(t.Context(), "", map[string]any{"BAD=NAME": "x"}); err == nil {
+		t.Error("Update() expected error for invalid variable name")
+	}
+}
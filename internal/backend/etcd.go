@@ -0,0 +1,471 @@
+package backend
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"var-sync/internal/parser"
+	"var-sync/pkg/models"
+)
+
+// Etcd reads and writes keys in etcd through its v3 HTTP gateway. Like
+// consul://, an etcd:// path ending in "/" is a prefix whose keys form a flat
+// document and any other path is a single key holding a JSON object. Keys are
+// used exactly as written, so etcd:///registry/app/ names keys under
+// /registry/app/.
+type Etcd struct {
+	config models.EtcdConfig
+	client *http.Client
+	stream *http.Client // Without a timeout, for watches
+	parser *parser.Parser
+	token  string
+	mutex  sync.Mutex
+}
+
+// etcdKV is a key returned by a range request
+type etcdKV struct {
+	Key         string  `json:"key"`   // Base64 encoded
+	Value       string  `json:"value"` // Base64 encoded
+	ModRevision etcdInt `json:"mod_revision"`
+}
+
+// etcdHeader carries the store revision of a response
+type etcdHeader struct {
+	Revision etcdInt `json:"revision"`
+}
+
+// etcdInt is an int64 that the gateway encodes as a JSON string
+type etcdInt int64
+
+func (i *etcdInt) UnmarshalJSON(data []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(data), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*i = etcdInt(n)
+	return nil
+}
+
+// errEtcdAuth is returned when the token was rejected and should be renewed
+var errEtcdAuth = errors.New("etcd rejected the auth token")
+
+// NewEtcd creates an etcd backend. Endpoints default to ETCDCTL_ENDPOINTS and
+// then the local member; login happens on first use when a user is set.
+func NewEtcd(cfg models.EtcdConfig) *Etcd {
+	if len(cfg.Endpoints) == 0 {
+		if endpoints := os.Getenv("ETCDCTL_ENDPOINTS"); endpoints != "" {
+			cfg.Endpoints = strings.Split(endpoints, ",")
+		} else {
+			cfg.Endpoints = []string{"http://127.0.0.1:2379"}
+		}
+	}
+	for i, endpoint := range cfg.Endpoints {
+		endpoint = strings.TrimSuffix(strings.TrimSpace(endpoint), "/")
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+		cfg.Endpoints[i] = endpoint
+	}
+
+	return &Etcd{
+		config: cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+		stream: &http.Client{},
+		parser: parser.New(),
+	}
+}
+
+// SplitKey splits a path naming a single key into its prefix and key name
+func (e *Etcd) SplitKey(path string) (string, string) {
+	index := strings.LastIndex(path, "/")
+	return path[:index+1], path[index+1:]
+}
+
+// Load returns the keys under a prefix, or the JSON object stored at a key
+func (e *Etcd) Load(ctx context.Context, path string) (map[string]any, error) {
+	kvs, _, err := e.rangeKeys(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	if isFolder(path) {
+		result := make(map[string]any)
+		for _, kv := range kvs {
+			key, value, err := decodeEtcdKV(kv)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.TrimPrefix(key, path)
+			if name == "" || strings.HasSuffix(name, "/") {
+				continue
+			}
+			result[name] = parser.ParseEnvValue(string(value))
+		}
+		return result, nil
+	}
+
+	if len(kvs) == 0 {
+		return nil, fmt.Errorf("etcd key not found: %s", path)
+	}
+	return decodeEtcdDocument(kvs[0])
+}
+
+// Update writes keys under a prefix in a single transaction, or key paths
+// within the JSON object stored at a key. Objects are only written if the key
+// was not changed since it was read.
+func (e *Etcd) Update(ctx context.Context, path string, updates map[string]any) error {
+	if isFolder(path) {
+		var puts []map[string]any
+		for _, name := range sortedKeys(updates) {
+			puts = append(puts, etcdPut(path+name, []byte(formatEnvValue(updates[name]))))
+		}
+		return e.txn(ctx, nil, puts)
+	}
+
+	kvs, _, err := e.rangeKeys(ctx, path)
+	if err != nil {
+		return err
+	}
+
+	document := make(map[string]any)
+	var revision etcdInt
+	if len(kvs) > 0 {
+		if document, err = decodeEtcdDocument(kvs[0]); err != nil {
+			return err
+		}
+		revision = kvs[0].ModRevision
+	}
+	for _, keyPath := range sortedKeys(updates) {
+		if err := e.parser.SetValue(document, keyPath, updates[keyPath]); err != nil {
+			return fmt.Errorf("failed to set %s: %w", keyPath, err)
+		}
+	}
+
+	encoded, err := json.MarshalIndent(document, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode etcd value: %w", err)
+	}
+	compare := map[string]any{
+		"key":          etcdEncode(path),
+		"target":       "MOD",
+		"result":       "EQUAL",
+		"mod_revision": strconv.FormatInt(int64(revision), 10),
+	}
+	return e.txn(ctx, []map[string]any{compare}, []map[string]any{etcdPut(path, encoded)})
+}
+
+// Watch calls changed whenever the keys at path change, using an etcd watch
+// stream, until stop is closed
+func (e *Etcd) Watch(path string, stop <-chan struct{}, changed func()) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	_, revision, err := e.rangeKeys(ctx, path)
+	for err == nil {
+		revision, err = e.watchFrom(ctx, path, revision+1, changed)
+	}
+
+	if ctx.Err() != nil {
+		return nil
+	}
+	return err
+}
+
+// watchFrom streams changes to path starting at revision and returns the last
+// revision seen. A stream closed by the server ends without error so that the
+// watch resumes where it left off.
+func (e *Etcd) watchFrom(ctx context.Context, path string, revision int64, changed func()) (int64, error) {
+	create := etcdRange(path)
+	create["start_revision"] = strconv.FormatInt(revision, 10)
+
+	resp, err := e.send(ctx, e.stream, "/v3/watch", map[string]any{"create_request": create})
+	if err != nil {
+		return revision - 1, err
+	}
+	defer resp.Body.Close()
+
+	last := revision - 1
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var message struct {
+			Result struct {
+				Header          etcdHeader `json:"header"`
+				Canceled        bool       `json:"canceled"`
+				CancelReason    string     `json:"cancel_reason"`
+				CompactRevision etcdInt    `json:"compact_revision"`
+				Events          []struct {
+					KV etcdKV `json:"kv"`
+				} `json:"events"`
+			} `json:"result"`
+			Error *struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := decoder.Decode(&message); err != nil {
+			if errors.Is(err, io.EOF) {
+				return last, nil
+			}
+			return last, fmt.Errorf("failed to read etcd watch: %w", err)
+		}
+
+		result := message.Result
+		switch {
+		case message.Error != nil:
+			return last, fmt.Errorf("etcd watch failed: %s", message.Error.Message)
+		case result.CompactRevision > 0:
+			return last, fmt.Errorf("etcd watch revision %d was compacted", revision)
+		case result.Canceled:
+			return last, fmt.Errorf("etcd watch canceled: %s", result.CancelReason)
+		}
+
+		if len(result.Events) > 0 {
+			for _, event := range result.Events {
+				last = max(last, int64(event.KV.ModRevision))
+			}
+			changed()
+		}
+	}
+}
+
+// rangeKeys reads the key at path, or every key under it when path is a
+// prefix, and returns the store revision
+func (e *Etcd) rangeKeys(ctx context.Context, path string) ([]etcdKV, int64, error) {
+	var response struct {
+		Header etcdHeader `json:"header"`
+		KVs    []etcdKV   `json:"kvs"`
+	}
+	if err := e.call(ctx, "/v3/kv/range", etcdRange(path), &response); err != nil {
+		return nil, 0, err
+	}
+	return response.KVs, int64(response.Header.Revision), nil
+}
+
+// txn runs puts atomically if every comparison holds
+func (e *Etcd) txn(ctx context.Context, compare []map[string]any, puts []map[string]any) error {
+	if len(puts) == 0 {
+		return nil
+	}
+
+	var response struct {
+		Succeeded bool `json:"succeeded"`
+	}
+	request := map[string]any{"compare": compare, "success": puts}
+	if err := e.call(ctx, "/v3/kv/txn", request, &response); err != nil {
+		return err
+	}
+	if !response.Succeeded {
+		return fmt.Errorf("etcd key was changed concurrently")
+	}
+	return nil
+}
+
+// call performs a unary gateway request and decodes its response, logging in
+// again once if the auth token has expired
+func (e *Etcd) call(ctx context.Context, endpoint string, request, response any) error {
+	for attempt := 0; ; attempt++ {
+		resp, err := e.send(ctx, e.client, endpoint, request)
+		if errors.Is(err, errEtcdAuth) && attempt == 0 {
+			e.mutex.Lock()
+			e.token = ""
+			e.mutex.Unlock()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+
+		if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+			return fmt.Errorf("failed to parse etcd response: %w", err)
+		}
+		return nil
+	}
+}
+
+// send posts a request to the first reachable endpoint
+func (e *Etcd) send(ctx context.Context, client *http.Client, endpoint string, request any) (*http.Response, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode etcd request: %w", err)
+	}
+
+	token, err := e.authToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, address := range e.config.Endpoints {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, address+endpoint, bytes.NewReader(body))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create etcd request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+
+		resp, err := client.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to reach etcd: %w", err)
+			if ctx.Err() != nil {
+				return nil, lastErr
+			}
+			continue
+		}
+		if resp.StatusCode >= 300 {
+			defer resp.Body.Close()
+			return nil, etcdError(resp)
+		}
+		return resp, nil
+	}
+	return nil, lastErr
+}
+
+// authToken returns the token to send, logging in when a user is configured
+// and no token is held
+func (e *Etcd) authToken(ctx context.Context) (string, error) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.config.Username == "" || e.token != "" {
+		return e.token, nil
+	}
+
+	body, _ := json.Marshal(map[string]string{"name": e.config.Username, "password": e.config.Password})
+	var lastErr error
+	for _, address := range e.config.Endpoints {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, address+"/v3/auth/authenticate", bytes.NewReader(body))
+		if err != nil {
+			return "", fmt.Errorf("failed to create etcd request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := e.client.Do(req)
+		if err != nil {
+			lastErr = fmt.Errorf("failed to reach etcd: %w", err)
+			continue
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			return "", fmt.Errorf("etcd login failed: %w", etcdError(resp))
+		}
+		var result struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || result.Token == "" {
+			return "", fmt.Errorf("etcd login returned no token")
+		}
+		e.token = result.Token
+		return e.token, nil
+	}
+	return "", lastErr
+}
+
+// etcdRange builds the key range for path, covering every key under it when
+// path is a prefix
+func etcdRange(path string) map[string]any {
+	request := map[string]any{"key": etcdEncode(path)}
+	if isFolder(path) {
+		request["range_end"] = base64.StdEncoding.EncodeToString(etcdPrefixEnd(path))
+	}
+	return request
+}
+
+// etcdPrefixEnd returns the first key after every key starting with prefix
+func etcdPrefixEnd(prefix string) []byte {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return end[:i+1]
+		}
+	}
+	// An empty prefix, or one of only 0xff bytes, ranges to the end of the keyspace
+	return []byte{0}
+}
+
+// etcdPut builds a transaction operation writing value to key
+func etcdPut(key string, value []byte) map[string]any {
+	return map[string]any{"request_put": map[string]any{
+		"key":   etcdEncode(key),
+		"value": base64.StdEncoding.EncodeToString(value),
+	}}
+}
+
+// etcdEncode encodes a key for the gateway, which takes bytes as base64
+func etcdEncode(key string) string {
+	return base64.StdEncoding.EncodeToString([]byte(key))
+}
+
+// decodeEtcdKV decodes the key and value of a range result
+func decodeEtcdKV(kv etcdKV) (string, []byte, error) {
+	key, err := base64.StdEncoding.DecodeString(kv.Key)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode etcd key: %w", err)
+	}
+	value, err := base64.StdEncoding.DecodeString(kv.Value)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to decode etcd key %s: %w", key, err)
+	}
+	return string(key), value, nil
+}
+
+// decodeEtcdDocument parses a key holding a JSON object
+func decodeEtcdDocument(kv etcdKV) (map[string]any, error) {
+	key, value, err := decodeEtcdKV(kv)
+	if err != nil {
+		return nil, err
+	}
+
+	document, err := decodeDocument(value)
+	if err != nil {
+		return nil, fmt.Errorf("etcd key %s does not hold a JSON object: %w", key, err)
+	}
+	return document, nil
+}
+
+// etcdError builds an error from a failed gateway response
+func etcdError(resp *http.Response) error {
+	var body struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	data, _ := io.ReadAll(resp.Body)
+	json.Unmarshal(data, &body)
+
+	message := body.Message
+	if message == "" {
+		message = body.Error
+	}
+	if resp.StatusCode == http.StatusUnauthorized || strings.Contains(message, "invalid auth token") {
+		return errEtcdAuth
+	}
+	if message == "" {
+		message = strings.TrimSpace(string(data))
+	}
+	if message != "" {
+		return fmt.Errorf("etcd returned %d: %s", resp.StatusCode, message)
+	}
+	return fmt.Errorf("etcd returned %d", resp.StatusCode)
+}
@@ -0,0 +1,247 @@
+package backend
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"var-sync/pkg/models"
+)
+
+// fakeEtcd is an in-memory etcd v3 gateway supporting ranges, transactions,
+// watches and password auth
+type fakeEtcd struct {
+	mutex    sync.Mutex
+	keys     map[string]string
+	revs     map[string]int64
+	revision int64
+	changed  chan struct{}
+	password string
+	token    string
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{keys: make(map[string]string), revs: make(map[string]int64), revision: 1, changed: make(chan struct{})}
+}
+
+func (f *fakeEtcd) set(key, value string) {
+	f.revision++
+	f.keys[key] = value
+	f.revs[key] = f.revision
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+// inRange reports whether key lies in the request's [key, range_end) range
+func inRange(key string, request map[string]any) bool {
+	start := decode(request["key"])
+	end, ok := request["range_end"]
+	if !ok {
+		return key == start
+	}
+	return key >= start && key < decode(end)
+}
+
+func decode(value any) string {
+	data, _ := base64.StdEncoding.DecodeString(value.(string))
+	return string(data)
+}
+
+func (f *fakeEtcd) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var request map[string]any
+	json.NewDecoder(r.Body).Decode(&request)
+
+	if r.URL.Path == "/v3/auth/authenticate" {
+		if request["password"] != f.password {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"message": "authentication failed"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"token": f.token})
+		return
+	}
+	if f.password != "" && r.Header.Get("Authorization") != f.token {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]any{"message": "etcdserver: invalid auth token"})
+		return
+	}
+
+	f.mutex.Lock()
+	switch r.URL.Path {
+	case "/v3/kv/range":
+		var kvs []map[string]any
+		for key, value := range f.keys {
+			if inRange(key, request) {
+				kvs = append(kvs, map[string]any{
+					"key":          base64.StdEncoding.EncodeToString([]byte(key)),
+					"value":        base64.StdEncoding.EncodeToString([]byte(value)),
+					"mod_revision": strconv.FormatInt(f.revs[key], 10),
+				})
+			}
+		}
+		sort.Slice(kvs, func(i, j int) bool { return kvs[i]["key"].(string) < kvs[j]["key"].(string) })
+		json.NewEncoder(w).Encode(map[string]any{
+			"header": map[string]any{"revision": strconv.FormatInt(f.revision, 10)},
+			"kvs":    kvs,
+		})
+	case "/v3/kv/txn":
+		succeeded := true
+		compares, _ := request["compare"].([]any)
+		for _, compare := range compares {
+			compare := compare.(map[string]any)
+			revision, _ := strconv.ParseInt(compare["mod_revision"].(string), 10, 64)
+			succeeded = succeeded && f.revs[decode(compare["key"])] == revision
+		}
+		if succeeded {
+			for _, op := range request["success"].([]any) {
+				put := op.(map[string]any)["request_put"].(map[string]any)
+				f.set(decode(put["key"]), decode(put["value"]))
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]any{"succeeded": succeeded})
+	case "/v3/watch":
+		create := request["create_request"].(map[string]any)
+		start, _ := strconv.ParseInt(create["start_revision"].(string), 10, 64)
+		json.NewEncoder(w).Encode(map[string]any{"result": map[string]any{"created": true}})
+		w.(http.Flusher).Flush()
+		for {
+			var events []map[string]any
+			for key, revision := range f.revs {
+				if revision >= start && inRange(key, create) {
+					events = append(events, map[string]any{"kv": map[string]any{"mod_revision": strconv.FormatInt(revision, 10)}})
+				}
+			}
+			if len(events) > 0 {
+				start = f.revision + 1
+				json.NewEncoder(w).Encode(map[string]any{"result": map[string]any{"events": events}})
+				w.(http.Flusher).Flush()
+			}
+
+			changed := f.changed
+			f.mutex.Unlock()
+			select {
+			case <-changed:
+			case <-r.Context().Done():
+				return
+			}
+			f.mutex.Lock()
+		}
+	}
+	f.mutex.Unlock()
+}
+
+func TestEtcdPrefix(t *testing.T) {
+	fake := newFakeEtcd()
+	fake.set("/app/db_host", "localhost")
+	fake.set("/app/db_port", "5432")
+	fake.set("/apples", "outside the prefix")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	etcd := NewEtcd(models.EtcdConfig{Endpoints: []string{server.URL}})
+
+	data, err := etcd.Load(t.Context(), "/app/")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(data) != 2 || data["db_host"] != "localhost" || data["db_port"] != int64(5432) {
+		t.Errorf("Load() = %v", data)
+	}
+
+	if err := etcd.Update(t.Context(), "/app/", map[string]any{"db_host": "db.internal", "db_user": "app"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if fake.keys["/app/db_host"] != "db.internal" || fake.keys["/app/db_user"] != "app" {
+		t.Errorf("Update() wrote %v", fake.keys)
+	}
+
+	document, key := etcd.SplitKey("/app/db_host")
+	if document != "/app/" || key != "db_host" {
+		t.Errorf("SplitKey() = %q, %q", document, key)
+	}
+}
+
+func TestEtcdJSONDocument(t *testing.T) {
+	fake := newFakeEtcd()
+	fake.password = "secret"
+	fake.token = "token-1"
+	fake.set("config/app", `{"database": {"host": "localhost", "port": 5432}}`)
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	// The first endpoint is unreachable, so requests fail over to the second
+	etcd := NewEtcd(models.EtcdConfig{Endpoints: []string{"http://127.0.0.1:1", server.URL}, Username: "root", Password: "secret"})
+
+	if err := etcd.Update(t.Context(), "config/app", map[string]any{"database.host": "db.internal"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	data, err := etcd.Load(t.Context(), "config/app")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	database := data["database"].(map[string]any)
+	if database["host"] != "db.internal" || database["port"] != json.Number("5432") {
+		t.Errorf("Load() after Update() = %v", data)
+	}
+
+	// An expired token is renewed by logging in again
+	fake.mutex.Lock()
+	fake.token = "token-2"
+	fake.mutex.Unlock()
+	if _, err := etcd.Load(t.Context(), "config/app"); err != nil {
+		t.Fatalf("Load() after token expiry error = %v", err)
+	}
+
+	if _, err := etcd.Load(t.Context(), "config/missing"); err == nil {
+		t.Error("Load() expected error for missing key")
+	}
+}
+
+func TestEtcdWatch(t *testing.T) {
+	fake := newFakeEtcd()
+	fake.set("/app/db_host", "localhost")
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	etcd := NewEtcd(models.EtcdConfig{Endpoints: []string{server.URL}})
+	stop := make(chan struct{})
+	changes := make(chan struct{}, 10)
+	done := make(chan error)
+	go func() {
+		done <- etcd.Watch("/app/", stop, func() { changes <- struct{}{} })
+	}()
+
+	// Give the watch time to open its stream
+	time.Sleep(100 * time.Millisecond)
+	select {
+	case <-changes:
+		t.Fatal("Watch() reported a change before any write")
+	default:
+	}
+
+	fake.mutex.Lock()
+	fake.set("/app/db_host", "db.internal")
+	fake.mutex.Unlock()
+
+	select {
+	case <-changes:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Watch() did not report the change")
+	}
+
+	close(stop)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Watch() returned %v after stop, expected nil", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Watch() did not return after stop")
+	}
+}
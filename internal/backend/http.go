@@ -0,0 +1,212 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"var-sync/internal/parser"
+	"var-sync/pkg/models"
+)
+
+// HTTP reads JSON, YAML or TOML documents served over HTTP and posts changes
+// to webhooks. The path of an http:// or https:// reference is the rest of
+// the URL, so https://config.example.com/app.json#db.host reads db.host from
+// that document. Responses are cached and revalidated with ETag and
+// If-Modified-Since, so polling an unchanged document is cheap.
+type HTTP struct {
+	scheme string
+	config models.HTTPConfig
+	client *http.Client
+	parser *parser.Parser
+	cache  map[string]httpDocument
+	mutex  sync.Mutex
+}
+
+// httpDocument is a cached response and its validators
+type httpDocument struct {
+	body         []byte
+	format       models.FileFormat
+	etag         string
+	lastModified string
+}
+
+// NewHTTP creates a backend for URLs with the given scheme, http or https
+func NewHTTP(scheme string, cfg models.HTTPConfig) *HTTP {
+	return &HTTP{
+		scheme: scheme,
+		config: cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+		parser: parser.New(),
+		cache:  make(map[string]httpDocument),
+	}
+}
+
+// Load fetches and parses the document at path
+func (h *HTTP) Load(ctx context.Context, path string) (map[string]any, error) {
+	address := h.scheme + "://" + path
+	document, err := h.fetch(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := h.parser.Parse(address, document.format, document.body)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		data = make(map[string]any)
+	}
+	return data, nil
+}
+
+// Update posts the changed values to the URL at path as a webhook. The JSON
+// payload holds the values by key path and, when the endpoint is configured
+// with send_document, the whole document with the values applied.
+func (h *HTTP) Update(ctx context.Context, path string, updates map[string]any) error {
+	address := h.scheme + "://" + path
+	payload := map[string]any{
+		"target":    address,
+		"values":    updates,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+	}
+
+	if h.sendsDocument(address) {
+		document, err := h.Load(ctx, path)
+		if err != nil {
+			return err
+		}
+		for _, keyPath := range sortedKeys(updates) {
+			if err := h.parser.SetValue(document, keyPath, updates[keyPath]); err != nil {
+				return fmt.Errorf("failed to set %s: %w", keyPath, err)
+			}
+		}
+		payload["document"] = document
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, address, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("invalid url %s: %w", address, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range h.config.Headers(address) {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to %s: %w", address, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to post to %s: server returned %s", address, resp.Status)
+	}
+
+	// The document changed, so the next read must not reuse the cached copy
+	h.mutex.Lock()
+	delete(h.cache, address)
+	h.mutex.Unlock()
+	return nil
+}
+
+// fetch returns the current document at address, reusing the cached copy
+// when the server reports it unchanged
+func (h *HTTP) fetch(ctx context.Context, address string) (httpDocument, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, address, nil)
+	if err != nil {
+		return httpDocument{}, fmt.Errorf("invalid url %s: %w", address, err)
+	}
+	req.Header.Set("Accept", "application/json, application/yaml, application/toml;q=0.9, */*;q=0.5")
+	for name, value := range h.config.Headers(address) {
+		req.Header.Set(name, value)
+	}
+
+	h.mutex.Lock()
+	cached, isCached := h.cache[address]
+	h.mutex.Unlock()
+	if isCached {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return httpDocument{}, fmt.Errorf("failed to fetch %s: %w", address, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && isCached {
+		return cached, nil
+	}
+	if resp.StatusCode >= 300 {
+		return httpDocument{}, fmt.Errorf("failed to fetch %s: server returned %s", address, resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return httpDocument{}, fmt.Errorf("failed to read %s: %w", address, err)
+	}
+	document := httpDocument{
+		body:         body,
+		format:       responseFormat(address, resp.Header.Get("Content-Type")),
+		etag:         resp.Header.Get("ETag"),
+		lastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	h.mutex.Lock()
+	if document.etag != "" || document.lastModified != "" {
+		h.cache[address] = document
+	} else {
+		delete(h.cache, address)
+	}
+	h.mutex.Unlock()
+	return document, nil
+}
+
+// sendsDocument reports whether a matching endpoint asks for whole documents
+// in webhook payloads
+func (h *HTTP) sendsDocument(address string) bool {
+	for _, endpoint := range h.config.Endpoints {
+		if endpoint.URL != "" && endpoint.SendDocument && strings.HasPrefix(address, endpoint.URL) {
+			return true
+		}
+	}
+	return false
+}
+
+// responseFormat picks the format of a response from its content type, then
+// from the extension of the URL path
+func responseFormat(address, contentType string) models.FileFormat {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case strings.HasSuffix(mediaType, "json"):
+		return models.FormatJSON
+	case strings.HasSuffix(mediaType, "yaml"), strings.HasSuffix(mediaType, "yml"):
+		return models.FormatYAML
+	case strings.HasSuffix(mediaType, "toml"):
+		return models.FormatTOML
+	}
+
+	if parsed, err := url.Parse(address); err == nil {
+		return models.DetectFormat(parsed.Path)
+	}
+	return models.FormatJSON
+}
@@ -0,0 +1,171 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"var-sync/pkg/models"
+)
+
+// fakeConfigService serves one document with an ETag, counting full responses
+type fakeConfigService struct {
+	mutex       sync.Mutex
+	body        string
+	contentType string
+	etag        string
+	served      int
+	revalidated int
+	auth        string
+}
+
+func (f *fakeConfigService) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if r.URL.Path != "/config/app" {
+		http.NotFound(w, r)
+		return
+	}
+	f.auth = r.Header.Get("Authorization")
+	if f.etag != "" && r.Header.Get("If-None-Match") == f.etag {
+		f.revalidated++
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	f.served++
+	w.Header().Set("Content-Type", f.contentType)
+	w.Header().Set("ETag", f.etag)
+	w.Write([]byte(f.body))
+}
+
+func TestHTTPSource(t *testing.T) {
+	fake := &fakeConfigService{body: "database:\n  host: localhost\n", contentType: "application/yaml; charset=utf-8", etag: `"v1"`}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	cfg := models.HTTPConfig{Endpoints: []models.HTTPEndpoint{
+		{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer general"}},
+		{URL: server.URL + "/config/", Headers: map[string]string{"Authorization": "Bearer config"}},
+		{URL: "https://elsewhere.example.com/", Headers: map[string]string{"X-Other": "leak"}},
+	}}
+	r := NewRegistry()
+	r.Register("http", NewHTTP("http", cfg))
+	source := server.URL + "/config/app"
+
+	data, err := r.Load(source)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if data["database"].(map[string]any)["host"] != "localhost" {
+		t.Errorf("Load() = %v", data)
+	}
+	if fake.auth != "Bearer config" {
+		t.Errorf("Authorization = %q, expected the most specific endpoint's header", fake.auth)
+	}
+
+	// An unchanged document is revalidated rather than downloaded again
+	data, err = r.Load(source)
+	if err != nil || data["database"].(map[string]any)["host"] != "localhost" {
+		t.Fatalf("Load() of cached document = %v, %v", data, err)
+	}
+	if fake.served != 1 || fake.revalidated != 1 {
+		t.Errorf("Expected 1 download and 1 revalidation, got %d and %d", fake.served, fake.revalidated)
+	}
+
+	fake.mutex.Lock()
+	fake.body = `{"database": {"host": "db.internal"}}`
+	fake.contentType = "application/json"
+	fake.etag = `"v2"`
+	fake.mutex.Unlock()
+	data, err = r.Load(source)
+	if err != nil || data["database"].(map[string]any)["host"] != "db.internal" {
+		t.Errorf("Load() after change = %v, %v", data, err)
+	}
+
+	if _, err := r.Load(server.URL + "/missing"); err == nil {
+		t.Error("Load() expected error for a failed request")
+	}
+}
+
+func TestHTTPWebhook(t *testing.T) {
+	var mutex sync.Mutex
+	var payloads []map[string]any
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if r.Method == http.MethodGet {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(`{"database": {"host": "localhost", "port": 5432}}`))
+			return
+		}
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		var payload map[string]any
+		json.NewDecoder(r.Body).Decode(&payload)
+		payloads = append(payloads, payload)
+		auth = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	cfg := models.HTTPConfig{Endpoints: []models.HTTPEndpoint{
+		{URL: server.URL + "/hooks/", Headers: map[string]string{"Authorization": "Bearer hook"}},
+		{URL: server.URL + "/hooks/full", SendDocument: true},
+	}}
+	webhook := NewHTTP("http", cfg)
+	path := strings.TrimPrefix(server.URL, "http://")
+
+	if err := webhook.Update(t.Context(), path+"/hooks/values", map[string]any{"database.host": "db.internal"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if err := webhook.Update(t.Context(), path+"/hooks/full", map[string]any{"database.host": "db.internal"}); err != nil {
+		t.Fatalf("Update() with document error = %v", err)
+	}
+	if err := webhook.Update(t.Context(), path+"/broken", map[string]any{"key": "value"}); err == nil {
+		t.Error("Update() expected error when the webhook fails")
+	}
+
+	if len(payloads) != 2 {
+		t.Fatalf("Expected 2 payloads, got %d", len(payloads))
+	}
+	if auth != "Bearer hook" {
+		t.Errorf("Authorization = %q, expected the endpoint's header", auth)
+	}
+	if values := payloads[0]["values"].(map[string]any); values["database.host"] != "db.internal" {
+		t.Errorf("Payload values = %v", values)
+	}
+	if _, ok := payloads[0]["document"]; ok {
+		t.Error("Payload should only carry the document when send_document is set")
+	}
+	database := payloads[1]["document"].(map[string]any)["database"].(map[string]any)
+	if database["host"] != "db.internal" || database["port"] != float64(5432) {
+		t.Errorf("Payload document = %v", database)
+	}
+}
+
+func TestResponseFormat(t *testing.T) {
+	tests := []struct {
+		address     string
+		contentType string
+		expected    models.FileFormat
+	}{
+		{"https://example.com/app", "application/json", models.FormatJSON},
+		{"https://example.com/app", "text/yaml", models.FormatYAML},
+		{"https://example.com/app", "application/toml", models.FormatTOML},
+		{"https://example.com/app.yaml?ref=main", "text/plain", models.FormatYAML},
+		{"https://example.com/app", "", models.FormatJSON},
+	}
+
+	for _, test := range tests {
+		if got := responseFormat(test.address, test.contentType); got != test.expected {
+			t.Errorf("responseFormat(%q, %q) = %s, expected %s", test.address, test.contentType, got, test.expected)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"var-sync/internal/parser"
+	"var-sync/pkg/models"
+)
+
+// SecretsManager reads and writes AWS Secrets Manager secrets holding JSON
+// objects. The path of an aws-sm:// reference is the secret name or ARN, and
+// its key is a key path within the secret: aws-sm://prod/db#password.
+type SecretsManager struct {
+	aws    *awsClient
+	parser *parser.Parser
+}
+
+// NewSecretsManager creates a Secrets Manager backend
+func NewSecretsManager(cfg models.AWSConfig) *SecretsManager {
+	return &SecretsManager{aws: newAWSClient(cfg), parser: parser.New()}
+}
+
+// Load returns the current version of the secret at path
+func (m *SecretsManager) Load(ctx context.Context, path string) (map[string]any, error) {
+	secret, found, err := m.read(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("secret not found: %s", path)
+	}
+	return secret, nil
+}
+
+// Update stores a new version of the secret at path with updates applied,
+// creating the secret if it does not exist
+func (m *SecretsManager) Update(ctx context.Context, path string, updates map[string]any) error {
+	secret, found, err := m.read(ctx, path)
+	if err != nil {
+		return err
+	}
+	if !found {
+		secret = make(map[string]any)
+	}
+	for _, keyPath := range sortedKeys(updates) {
+		if err := m.parser.SetValue(secret, keyPath, updates[keyPath]); err != nil {
+			return fmt.Errorf("failed to set %s: %w", keyPath, err)
+		}
+	}
+
+	encoded, err := json.Marshal(secret)
+	if err != nil {
+		return fmt.Errorf("failed to encode secret: %w", err)
+	}
+
+	var response struct{}
+	if found {
+		request := map[string]any{"SecretId": path, "SecretString": string(encoded)}
+		err = m.aws.call(ctx, "secretsmanager", "secretsmanager.PutSecretValue", request, &response)
+	} else {
+		request := map[string]any{"Name": path, "SecretString": string(encoded)}
+		err = m.aws.call(ctx, "secretsmanager", "secretsmanager.CreateSecret", request, &response)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write secret %s: %w", path, err)
+	}
+	return nil
+}
+
+// read fetches and parses the current version of a secret
+func (m *SecretsManager) read(ctx context.Context, path string) (map[string]any, bool, error) {
+	var response struct {
+		SecretString *string
+	}
+	request := map[string]any{"SecretId": path}
+	if err := m.aws.call(ctx, "secretsmanager", "secretsmanager.GetSecretValue", request, &response); err != nil {
+		var failure *awsError
+		if errors.As(err, &failure) && failure.is("ResourceNotFoundException") {
+			return nil, false, nil
+		}
+		return nil, false, fmt.Errorf("failed to read secret %s: %w", path, err)
+	}
+	if response.SecretString == nil {
+		return nil, false, fmt.Errorf("secret %s is binary, only JSON secrets are supported", path)
+	}
+
+	secret, err := decodeDocument([]byte(*response.SecretString))
+	if err != nil {
+		return nil, false, fmt.Errorf("secret %s does not hold a JSON object: %w", path, err)
+	}
+	return secret, true, nil
+}
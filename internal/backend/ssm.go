@@ -0,0 +1,186 @@
+package backend
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"var-sync/internal/parser"
+	"var-sync/pkg/models"
+)
+
+// SSM reads and writes AWS Systems Manager Parameter Store parameters. An
+// ssm:// path ending in "/" is a parameter hierarchy whose direct children
+// form a flat document, so ssm://app/db_host names parameter /app/db_host.
+// Any other path is a parameter holding a JSON object. SecureString
+// parameters are decrypted on read and stay SecureString when written.
+type SSM struct {
+	aws    *awsClient
+	parser *parser.Parser
+}
+
+// ssmParameter is a parameter returned by the Parameter Store API
+type ssmParameter struct {
+	Name  string
+	Type  string
+	Value string
+}
+
+// NewSSM creates a Parameter Store backend
+func NewSSM(cfg models.AWSConfig) *SSM {
+	return &SSM{aws: newAWSClient(cfg), parser: parser.New()}
+}
+
+// SplitKey splits a path naming a single parameter into its hierarchy and name
+func (s *SSM) SplitKey(path string) (string, string) {
+	index := strings.LastIndex(path, "/")
+	return path[:index+1], path[index+1:]
+}
+
+// Load returns the parameters directly under a hierarchy, or the JSON object
+// stored in a parameter
+func (s *SSM) Load(ctx context.Context, path string) (map[string]any, error) {
+	if isFolder(path) {
+		parameters, err := s.children(ctx, path)
+		if err != nil {
+			return nil, err
+		}
+		result := make(map[string]any)
+		for name, parameter := range parameters {
+			result[name] = parser.ParseEnvValue(parameter.Value)
+		}
+		return result, nil
+	}
+
+	parameter, err := s.get(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if parameter == nil {
+		return nil, fmt.Errorf("ssm parameter not found: %s", ssmName(path))
+	}
+	return decodeSSMDocument(parameter)
+}
+
+// Update writes parameters under a hierarchy, or key paths within the JSON
+// object stored in a parameter. Existing parameters keep their type; new ones
+// are created as String.
+func (s *SSM) Update(ctx context.Context, path string, updates map[string]any) error {
+	if isFolder(path) {
+		existing, err := s.children(ctx, path)
+		if err != nil {
+			return err
+		}
+		for _, name := range sortedKeys(updates) {
+			parameterType := "String"
+			if parameter, ok := existing[name]; ok {
+				parameterType = parameter.Type
+			}
+			if err := s.put(ctx, ssmName(path)+name, formatEnvValue(updates[name]), parameterType); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	parameter, err := s.get(ctx, path)
+	if err != nil {
+		return err
+	}
+	document := make(map[string]any)
+	parameterType := "String"
+	if parameter != nil {
+		if document, err = decodeSSMDocument(parameter); err != nil {
+			return err
+		}
+		parameterType = parameter.Type
+	}
+	for _, keyPath := range sortedKeys(updates) {
+		if err := s.parser.SetValue(document, keyPath, updates[keyPath]); err != nil {
+			return fmt.Errorf("failed to set %s: %w", keyPath, err)
+		}
+	}
+
+	encoded, err := json.Marshal(document)
+	if err != nil {
+		return fmt.Errorf("failed to encode ssm value: %w", err)
+	}
+	return s.put(ctx, ssmName(path), string(encoded), parameterType)
+}
+
+// get reads a single decrypted parameter, or nil if it does not exist
+func (s *SSM) get(ctx context.Context, path string) (*ssmParameter, error) {
+	var response struct {
+		Parameter ssmParameter
+	}
+	request := map[string]any{"Name": ssmName(path), "WithDecryption": true}
+	if err := s.aws.call(ctx, "ssm", "AmazonSSM.GetParameter", request, &response); err != nil {
+		var failure *awsError
+		if errors.As(err, &failure) && failure.is("ParameterNotFound") {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read ssm parameter %s: %w", ssmName(path), err)
+	}
+	return &response.Parameter, nil
+}
+
+// children reads the decrypted parameters directly under a hierarchy, keyed
+// by their name within it
+func (s *SSM) children(ctx context.Context, path string) (map[string]ssmParameter, error) {
+	folder := ssmName(path)
+	hierarchy := strings.TrimSuffix(folder, "/")
+	if hierarchy == "" {
+		hierarchy = "/"
+	}
+
+	result := make(map[string]ssmParameter)
+	request := map[string]any{"Path": hierarchy, "WithDecryption": true, "Recursive": false}
+	for {
+		var response struct {
+			Parameters []ssmParameter
+			NextToken  string
+		}
+		if err := s.aws.call(ctx, "ssm", "AmazonSSM.GetParametersByPath", request, &response); err != nil {
+			return nil, fmt.Errorf("failed to read ssm parameters under %s: %w", hierarchy, err)
+		}
+		for _, parameter := range response.Parameters {
+			if name := strings.TrimPrefix(parameter.Name, folder); name != "" {
+				result[name] = parameter
+			}
+		}
+		if response.NextToken == "" {
+			return result, nil
+		}
+		request["NextToken"] = response.NextToken
+	}
+}
+
+// put creates or overwrites a parameter
+func (s *SSM) put(ctx context.Context, name, value, parameterType string) error {
+	request := map[string]any{"Name": name, "Value": value, "Type": parameterType, "Overwrite": true}
+	var response struct{}
+	if err := s.aws.call(ctx, "ssm", "AmazonSSM.PutParameter", request, &response); err != nil {
+		return fmt.Errorf("failed to write ssm parameter %s: %w", name, err)
+	}
+	return nil
+}
+
+// ssmName returns the parameter name for a reference path. Names within a
+// hierarchy must start with "/", which the reference may leave out.
+func ssmName(path string) string {
+	if strings.Contains(path, "/") && !strings.HasPrefix(path, "/") {
+		return "/" + path
+	}
+	return path
+}
+
+// decodeSSMDocument parses a parameter holding a JSON object
+func decodeSSMDocument(parameter *ssmParameter) (map[string]any, error) {
+	document, err := decodeDocument([]byte(parameter.Value))
+	if err != nil {
+		return nil, fmt.Errorf("ssm parameter %s does not hold a JSON object: %w", parameter.Name, err)
+	}
+	return document, nil
+}
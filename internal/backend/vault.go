@@ -0,0 +1,246 @@
+package backend
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"var-sync/internal/parser"
+	"var-sync/pkg/models"
+)
+
+// Vault reads and writes secrets in HashiCorp Vault's KV secrets engine. The
+// path of a vault:// reference is the API path of the secret, such as
+// secret/data/app for KV version 2 or secret/app for version 1.
+type Vault struct {
+	config models.VaultConfig
+	client *http.Client
+	parser *parser.Parser
+	token  string
+	mutex  sync.Mutex
+}
+
+// vaultSecret is a secret read from Vault
+type vaultSecret struct {
+	data    map[string]any
+	version int  // KV version 2 metadata version, used for check-and-set
+	kv2     bool // Whether the secret lives in a KV version 2 engine
+}
+
+// NewVault creates a Vault backend. Authentication happens on first use.
+func NewVault(cfg models.VaultConfig) *Vault {
+	if cfg.Address == "" {
+		cfg.Address = os.Getenv("VAULT_ADDR")
+	}
+	if cfg.Token == "" && cfg.RoleID == "" {
+		cfg.Token = os.Getenv("VAULT_TOKEN")
+	}
+	cfg.Address = strings.TrimSuffix(cfg.Address, "/")
+
+	return &Vault{
+		config: cfg,
+		client: &http.Client{Timeout: 30 * time.Second},
+		parser: parser.New(),
+		token:  cfg.Token,
+	}
+}
+
+// Load returns the data of the secret at path
+func (v *Vault) Load(ctx context.Context, path string) (map[string]any, error) {
+	secret, err := v.read(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	if secret.data == nil {
+		return nil, fmt.Errorf("vault secret not found: %s", path)
+	}
+	return secret.data, nil
+}
+
+// Update sets keys in the secret at path, keeping its other keys. For KV
+// version 2 the write only succeeds if the secret was not changed since it
+// was read.
+func (v *Vault) Update(ctx context.Context, path string, updates map[string]any) error {
+	secret, err := v.read(ctx, path)
+	if err != nil {
+		return err
+	}
+	if secret.data == nil {
+		secret.data = make(map[string]any)
+	}
+	for _, keyPath := range sortedKeys(updates) {
+		if err := v.parser.SetValue(secret.data, keyPath, updates[keyPath]); err != nil {
+			return fmt.Errorf("failed to set %s: %w", keyPath, err)
+		}
+	}
+
+	var body any = secret.data
+	if secret.kv2 {
+		body = map[string]any{
+			"data":    secret.data,
+			"options": map[string]any{"cas": secret.version},
+		}
+	}
+	_, err = v.request(ctx, http.MethodPost, path, body)
+	return err
+}
+
+// read fetches the secret at path. A missing secret has nil data.
+func (v *Vault) read(ctx context.Context, path string) (vaultSecret, error) {
+	secret := vaultSecret{kv2: strings.Contains("/"+path+"/", "/data/")}
+
+	response, err := v.request(ctx, http.MethodGet, path, nil)
+	if err != nil || response == nil {
+		return secret, err
+	}
+
+	var envelope struct {
+		Data map[string]any `json:"data"`
+	}
+	if err := decodeJSON(response, &envelope); err != nil {
+		return secret, fmt.Errorf("failed to parse vault response: %w", err)
+	}
+
+	metadata, isKV2 := envelope.Data["metadata"].(map[string]any)
+	inner, hasData := envelope.Data["data"].(map[string]any)
+	if isKV2 && hasData {
+		secret.kv2 = true
+		secret.data = inner
+		if version, ok := metadata["version"].(json.Number); ok {
+			if n, err := version.Int64(); err == nil {
+				secret.version = int(n)
+			}
+		}
+		return secret, nil
+	}
+
+	secret.data = envelope.Data
+	return secret, nil
+}
+
+// request calls the Vault HTTP API and returns the response body, or nil for
+// a 404. An AppRole token that has expired is renewed once.
+func (v *Vault) request(ctx context.Context, method, path string, body any) ([]byte, error) {
+	if v.config.Address == "" {
+		return nil, fmt.Errorf("vault address not configured: set vault.address or VAULT_ADDR")
+	}
+
+	for attempt := 0; ; attempt++ {
+		token, err := v.authToken(ctx, attempt > 0)
+		if err != nil {
+			return nil, err
+		}
+
+		status, response, err := v.send(ctx, method, path, token, body)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case status == http.StatusNotFound && method == http.MethodGet:
+			return nil, nil
+		case status == http.StatusForbidden && v.config.RoleID != "" && attempt == 0:
+			continue
+		case status >= 300:
+			return nil, vaultError(status, response)
+		default:
+			return response, nil
+		}
+	}
+}
+
+// send performs a single HTTP request against the Vault API
+func (v *Vault) send(ctx context.Context, method, path, token string, body any) (int, []byte, error) {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to encode vault request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, v.config.Address+"/v1/"+strings.TrimPrefix(path, "/"), reader)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to create vault request: %w", err)
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to reach vault: %w", err)
+	}
+	defer resp.Body.Close()
+
+	response, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to read vault response: %w", err)
+	}
+	return resp.StatusCode, response, nil
+}
+
+// authToken returns the token to use, logging in with AppRole when no token
+// is held yet or renew is set
+func (v *Vault) authToken(ctx context.Context, renew bool) (string, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	if v.config.RoleID == "" || (v.token != "" && !renew) {
+		return v.token, nil
+	}
+
+	login := map[string]string{"role_id": v.config.RoleID, "secret_id": v.config.SecretID}
+	status, response, err := v.send(ctx, http.MethodPost, "auth/approle/login", "", login)
+	if err != nil {
+		return "", err
+	}
+	if status >= 300 {
+		return "", fmt.Errorf("vault approle login failed: %w", vaultError(status, response))
+	}
+
+	var result struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := json.Unmarshal(response, &result); err != nil || result.Auth.ClientToken == "" {
+		return "", fmt.Errorf("vault approle login returned no token")
+	}
+
+	v.token = result.Auth.ClientToken
+	return v.token, nil
+}
+
+// vaultError builds an error from a failed Vault response
+func vaultError(status int, response []byte) error {
+	var body struct {
+		Errors []string `json:"errors"`
+	}
+	if err := json.Unmarshal(response, &body); err == nil && len(body.Errors) > 0 {
+		return fmt.Errorf("vault returned %d: %s", status, strings.Join(body.Errors, "; "))
+	}
+	return fmt.Errorf("vault returned %d", status)
+}
+
+// decodeJSON decodes data keeping numbers as json.Number so that integers
+// are reproduced exactly
+func decodeJSON(data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
@@ -0,0 +1,140 @@
+package backend
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"var-sync/pkg/models"
+)
+
+// fakeVault serves a single KV version 2 secret engine mounted at secret/
+type fakeVault struct {
+	mutex   sync.Mutex
+	secrets map[string]map[string]any
+	version map[string]int
+	token   string
+	logins  int
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		var login map[string]string
+		json.NewDecoder(r.Body).Decode(&login)
+		if login["role_id"] != "role" || login["secret_id"] != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		f.logins++
+		json.NewEncoder(w).Encode(map[string]any{"auth": map[string]any{"client_token": f.token}})
+		return
+	}
+
+	if r.Header.Get("X-Vault-Token") != f.token {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]any{"errors": []string{"permission denied"}})
+		return
+	}
+
+	path := r.URL.Path
+	switch r.Method {
+	case http.MethodGet:
+		data, ok := f.secrets[path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{
+			"data":     data,
+			"metadata": map[string]any{"version": f.version[path]},
+		}})
+	case http.MethodPost:
+		var body struct {
+			Data    map[string]any `json:"data"`
+			Options struct {
+				CAS int `json:"cas"`
+			} `json:"options"`
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body.Options.CAS != f.version[path] {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]any{"errors": []string{"check-and-set parameter did not match"}})
+			return
+		}
+		f.secrets[path] = body.Data
+		f.version[path]++
+		json.NewEncoder(w).Encode(map[string]any{"data": map[string]any{"version": f.version[path]}})
+	}
+}
+
+func TestVaultTokenReadWrite(t *testing.T) {
+	fake := &fakeVault{
+		secrets: map[string]map[string]any{"/v1/secret/data/app": {"db_password": "hunter2", "port": 5432}},
+		version: map[string]int{"/v1/secret/data/app": 3},
+		token:   "root",
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	vault := NewVault(models.VaultConfig{Address: server.URL + "/", Token: "root"})
+
+	data, err := vault.Load(t.Context(), "secret/data/app")
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if data["db_password"] != "hunter2" || data["port"] != json.Number("5432") {
+		t.Errorf("Load() = %v", data)
+	}
+
+	if err := vault.Update(t.Context(), "secret/data/app", map[string]any{"db_password": "rotated"}); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if fake.secrets["/v1/secret/data/app"]["db_password"] != "rotated" || fake.secrets["/v1/secret/data/app"]["port"] == nil {
+		t.Errorf("Update() should change one key and keep the rest: %v", fake.secrets["/v1/secret/data/app"])
+	}
+
+	if _, err := vault.Load(t.Context(), "secret/data/missing"); err == nil {
+		t.Error("Load() expected error for missing secret")
+	}
+
+	// Creating a secret uses check-and-set version 0
+	if err := vault.Update(t.Context(), "secret/data/new", map[string]any{"key": "value"}); err != nil {
+		t.Fatalf("Update() of new secret error = %v", err)
+	}
+
+	denied := NewVault(models.VaultConfig{Address: server.URL, Token: "wrong"})
+	if _, err := denied.Load(t.Context(), "secret/data/app"); err == nil {
+		t.Error("Load() expected error with invalid token")
+	}
+}
+
+func TestVaultAppRole(t *testing.T) {
+	fake := &fakeVault{
+		secrets: map[string]map[string]any{"/v1/secret/data/app": {"api_key": "abc"}},
+		version: map[string]int{"/v1/secret/data/app": 1},
+		token:   "approle-token",
+	}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	vault := NewVault(models.VaultConfig{Address: server.URL, RoleID: "role", SecretID: "secret"})
+	if _, err := vault.Load(t.Context(), "secret/data/app"); err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	// An expired token is renewed by logging in again
+	fake.mutex.Lock()
+	fake.token = "renewed-token"
+	fake.mutex.Unlock()
+	if _, err := vault.Load(t.Context(), "secret/data/app"); err != nil {
+		t.Fatalf("Load() after token expiry error = %v", err)
+	}
+	if fake.logins != 2 {
+		t.Errorf("Expected 2 approle logins, got %d", fake.logins)
+	}
+}
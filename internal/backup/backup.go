@@ -0,0 +1,201 @@
+package backup
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"var-sync/internal/textfile"
+	"var-sync/pkg/models"
+)
+
+// timestampFormat sorts lexically in chronological order
+const timestampFormat = "20060102-150405.000000"
+
+// Manager copies target files aside before they are modified and restores them
+type Manager struct {
+	dir         string
+	maxVersions int
+	now         func() time.Time
+}
+
+// New creates a Manager from the backup configuration. A nil config uses
+// <name>.bak files next to each target.
+func New(cfg *models.BackupConfig) *Manager {
+	m := &Manager{now: time.Now}
+	if cfg != nil {
+		m.dir = cfg.Dir
+		m.maxVersions = cfg.MaxVersions
+	}
+	return m
+}
+
+// Backup copies path to its backup location and returns the backup path.
+// Nothing is written if path does not exist yet or if the most recent backup
+// already holds identical content.
+func (m *Manager) Backup(path string) (string, error) {
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	if latest, err := m.Latest(path); err == nil && latest != "" {
+		if existing, err := os.ReadFile(latest); err == nil && bytes.Equal(existing, content) {
+			return latest, nil
+		}
+	}
+
+	backupPath, err := m.newBackupPath(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(backupPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	}
+	if err := os.WriteFile(backupPath, content, mode); err != nil {
+		return "", fmt.Errorf("failed to write backup: %w", err)
+	}
+
+	if err := m.prune(path); err != nil {
+		return backupPath, err
+	}
+
+	return backupPath, nil
+}
+
+// Restore copies the most recent backup of path back over it and removes
+// that backup, so repeated restores step back through older versions. It
+// returns the backup that was restored.
+func (m *Manager) Restore(path string) (string, error) {
+	latest, err := m.Latest(path)
+	if err != nil {
+		return "", err
+	}
+	if latest == "" {
+		return "", fmt.Errorf("no backup found for %s", path)
+	}
+
+	content, err := os.ReadFile(latest)
+	if err != nil {
+		return "", fmt.Errorf("failed to read backup: %w", err)
+	}
+	if err := textfile.Replace(path, content); err != nil {
+		return "", fmt.Errorf("failed to restore %s: %w", path, err)
+	}
+	if err := os.Remove(latest); err != nil {
+		return latest, fmt.Errorf("failed to remove restored backup: %w", err)
+	}
+
+	return latest, nil
+}
+
+// Latest returns the most recent backup of path, or an empty string if none exists
+func (m *Manager) Latest(path string) (string, error) {
+	versions, err := m.Versions(path)
+	if err != nil || len(versions) == 0 {
+		return "", err
+	}
+	return versions[len(versions)-1], nil
+}
+
+// Versions returns all backups of path, oldest first
+func (m *Manager) Versions(path string) ([]string, error) {
+	if m.dir == "" {
+		backupPath := path + ".bak"
+		if _, err := os.Stat(backupPath); err != nil {
+			if os.IsNotExist(err) {
+				return nil, nil
+			}
+			return nil, err
+		}
+		return []string{backupPath}, nil
+	}
+
+	dir, base, err := m.versionDir(path)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup directory: %w", err)
+	}
+
+	var versions []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, base+".") || !strings.HasSuffix(name, ".bak") {
+			continue
+		}
+		timestamp := strings.TrimSuffix(strings.TrimPrefix(name, base+"."), ".bak")
+		if _, err := time.Parse(timestampFormat, timestamp); err != nil {
+			continue
+		}
+		versions = append(versions, filepath.Join(dir, name))
+	}
+	sort.Strings(versions)
+
+	return versions, nil
+}
+
+// newBackupPath returns the path for a new backup of path
+func (m *Manager) newBackupPath(path string) (string, error) {
+	if m.dir == "" {
+		return path + ".bak", nil
+	}
+
+	dir, base, err := m.versionDir(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, fmt.Sprintf("%s.%s.bak", base, m.now().Format(timestampFormat))), nil
+}
+
+// versionDir returns the directory holding timestamped backups of path and
+// the file's base name. The target's absolute directory is mirrored below
+// the backup directory so files with the same name never collide.
+func (m *Manager) versionDir(path string) (string, string, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+
+	parent := filepath.Dir(absPath)
+	if volume := filepath.VolumeName(parent); volume != "" {
+		parent = strings.TrimSuffix(volume, ":") + parent[len(volume):]
+	}
+	return filepath.Join(m.dir, parent), filepath.Base(absPath), nil
+}
+
+// prune removes the oldest versions of path beyond the configured limit
+func (m *Manager) prune(path string) error {
+	if m.dir == "" || m.maxVersions <= 0 {
+		return nil
+	}
+
+	versions, err := m.Versions(path)
+	if err != nil {
+		return err
+	}
+	for len(versions) > m.maxVersions {
+		if err := os.Remove(versions[0]); err != nil {
+			return fmt.Errorf("failed to remove old backup: %w", err)
+		}
+		versions = versions[1:]
+	}
+	return nil
+}
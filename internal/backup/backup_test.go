@@ -0,0 +1,110 @@
+package backup
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"var-sync/pkg/models"
+)
+
+func TestBackupSiblingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("port: 8080\n"), 0600); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	m := New(nil)
+	backupPath, err := m.Backup(path)
+	if err != nil {
+		t.Fatalf("Backup() error = %v", err)
+	}
+	if backupPath != path+".bak" {
+		t.Errorf("Backup() path = %s, expected %s.bak", backupPath, path)
+	}
+
+	info, err := os.Stat(backupPath)
+	if err != nil {
+		t.Fatalf("Backup file not created: %v", err)
+	}
+	// Windows has no permission bits beyond read-only
+	if runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Backup file mode = %v, expected 0600", info.Mode().Perm())
+	}
+
+	if err := os.WriteFile(path, []byte("port: 9090\n"), 0600); err != nil {
+		t.Fatalf("Failed to modify test file: %v", err)
+	}
+	if _, err := m.Restore(path); err != nil {
+		t.Fatalf("Restore() error = %v", err)
+	}
+
+	content, _ := os.ReadFile(path)
+	if string(content) != "port: 8080\n" {
+		t.Errorf("Restore() content = %q, expected original", content)
+	}
+	if _, err := os.Stat(backupPath); !os.IsNotExist(err) {
+		t.Error("Restore() should remove the restored backup")
+	}
+	if _, err := m.Restore(path); err == nil {
+		t.Error("Restore() expected error with no backups left")
+	}
+}
+
+func TestBackupDirectoryVersions(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "app", "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	m := New(&models.BackupConfig{Enabled: true, Dir: filepath.Join(tempDir, "backups"), MaxVersions: 2})
+	clock := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	m.now = func() time.Time {
+		clock = clock.Add(time.Second)
+		return clock
+	}
+
+	for _, content := range []string{"v1", "v2", "v2", "v3"} {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+		if _, err := m.Backup(path); err != nil {
+			t.Fatalf("Backup() error = %v", err)
+		}
+	}
+
+	versions, err := m.Versions(path)
+	if err != nil {
+		t.Fatalf("Versions() error = %v", err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("Versions() = %v, expected 2 versions after pruning and skipping duplicates", versions)
+	}
+	if filepath.Base(versions[0]) != "config.yaml.20240101-120002.000000.bak" {
+		t.Errorf("Unexpected oldest version name %s", filepath.Base(versions[0]))
+	}
+
+	if err := os.WriteFile(path, []byte("v4"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	for _, expected := range []string{"v3", "v2"} {
+		if _, err := m.Restore(path); err != nil {
+			t.Fatalf("Restore() error = %v", err)
+		}
+		content, _ := os.ReadFile(path)
+		if string(content) != expected {
+			t.Errorf("Restore() content = %q, expected %q", content, expected)
+		}
+	}
+}
+
+func TestBackupMissingFile(t *testing.T) {
+	m := New(nil)
+	backupPath, err := m.Backup(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || backupPath != "" {
+		t.Errorf("Backup() of missing file = %q, %v; expected no backup and no error", backupPath, err)
+	}
+}
@@ -0,0 +1,160 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"slices"
+	"strconv"
+
+	"var-sync/internal/logger"
+	"var-sync/pkg/models"
+)
+
+// Context carries the loaded configuration and output streams shared by all commands
+type Context struct {
+	Config     *models.Config
+	ConfigPath string
+	Logger     *logger.Logger
+	Stdout     io.Writer
+	Output     string // Output format of every command, OutputText unless set
+}
+
+// Output formats commands print their results in: text for people, or JSON
+// for scripts and CI jobs. The JSON of a command keeps its fields from one
+// release to the next, adding new ones only.
+const (
+	OutputText = "text"
+	OutputJSON = "json"
+)
+
+// ValidOutput reports whether format is an output format commands print
+func ValidOutput(format string) bool {
+	return format == OutputText || format == OutputJSON
+}
+
+// command is a var-sync subcommand such as `var-sync restore`
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(ctx *Context, args []string) error
+}
+
+// commands returns every available subcommand
+func commands() []command {
+	return []command{
+		{"sync", "sync -check|-dry-run", "Preview a sync, or fail if any target is out of sync", runSync},
+		{"restore", "restore [file]", "Restore a target file from its most recent backup", runRestore},
+		{"history", "history [-rule id] [-since]", "Show the sync history journal", runHistory},
+		{"undo", "undo <event-id|-last>", "Revert a recorded sync to the previous value", runUndo},
+		{"rule", "rule <subcommand> [args]", "Add, list, show, remove, enable, disable or generate rules", runRule},
+		{"config", "config <export|import> [args]", "Convert the config file to and from JSON, YAML and TOML", runConfig},
+		{"get", "get <file> <keypath>", "Print the value at a key path", runGet},
+		{"set", "set <file> <keypath> <value>", "Write a value to a key path, keeping formatting", runSet},
+		{"keys", "keys <file> [-prefix keypath]", "List the key paths in a file with their values", runKeys},
+		{"diff", "diff <file-a> <file-b> [-format f]", "Compare the keys of two files of any format", runDiff},
+		{"render-env", "render-env <source> [keypath...]", "Write an env file from keys of a source", runRenderEnv},
+		{"validate", "validate [-json]", "Check the config, rule files and key paths", runValidate},
+		{"status", "status [-json] [-check]", "Show whether each rule's target is in sync with its source", runStatus},
+		{"daemon", "daemon <subcommand> [args]", "List, sync, pause or resume the rules of the running watcher", runDaemon},
+	}
+}
+
+// commandAliases are other names subcommands answer to, by the name of the
+// subcommand, such as `var-sync rules generate` for `var-sync rule generate`
+var commandAliases = map[string]string{
+	"rules": "rule",
+}
+
+// Run dispatches args to the named subcommand
+func Run(ctx *Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no command given")
+	}
+	if ctx.Output != "" && !ValidOutput(ctx.Output) {
+		return fmt.Errorf("invalid -output %q: use text or json", ctx.Output)
+	}
+
+	name := args[0]
+	if alias, ok := commandAliases[name]; ok {
+		name = alias
+	}
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			return cmd.run(ctx, args[1:])
+		}
+	}
+
+	return fmt.Errorf("unknown command: %s", args[0])
+}
+
+// Usage writes a summary of every subcommand
+func Usage(w io.Writer) {
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-28s %s\n", cmd.usage, cmd.summary)
+	}
+}
+
+// newFlagSet creates a flag set for a subcommand that reports errors instead of exiting
+func newFlagSet(ctx *Context, name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(ctx.Stdout)
+	return fs
+}
+
+// outputFlag registers -output on a subcommand's flag set, defaulting to the
+// format given before the command, and -json as shorthand for -output json.
+// It returns whether the command should print JSON once the flags are parsed.
+func outputFlag(ctx *Context, fs *flag.FlagSet) *bool {
+	asJSON := ctx.Output == OutputJSON
+	fs.Func("output", "Output format: text or json", func(value string) error {
+		if !ValidOutput(value) {
+			return fmt.Errorf("use text or json")
+		}
+		asJSON = value == OutputJSON
+		return nil
+	})
+	fs.BoolFunc("json", "Print JSON, the same as -output json", func(value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		asJSON = enabled
+		return nil
+	})
+	return &asJSON
+}
+
+// flagSet reports whether the named flag was given on the command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		set = set || f.Name == name
+	})
+	return set
+}
+
+// parseInterspersed parses flags given before, between or after positional
+// arguments, where the flag package alone stops at the first positional one,
+// and returns the positional arguments. Arguments after -- are never taken as
+// flags, such as a negative value.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	if i := slices.Index(args, "--"); i >= 0 {
+		args, rest = args[:i], args[i+1:]
+	}
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return append(positional, rest...), nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
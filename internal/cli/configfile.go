@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"fmt"
+
+	"var-sync/internal/config"
+	"var-sync/internal/textfile"
+	"var-sync/pkg/models"
+)
+
+// runConfig converts the config file to and from JSON, YAML and TOML
+func runConfig(ctx *Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: var-sync config <export|import>")
+	}
+
+	switch args[0] {
+	case "export":
+		return runConfigExport(ctx, args[1:])
+	case "import":
+		return runConfigImport(ctx, args[1:])
+	}
+	return fmt.Errorf("unknown config command: %s", args[0])
+}
+
+// configResult is the result of the config commands that write a file
+type configResult struct {
+	File       string `json:"file"`                  // The file exported to or imported from
+	Format     string `json:"format"`                // The format of File
+	ConfigFile string `json:"config_file,omitempty"` // The config file imported into
+	Rules      int    `json:"rules"`
+}
+
+// runConfigExport prints the config, or writes it to a file, in another
+// format. Printed with -output json, the config is exported as JSON unless
+// -format says otherwise.
+func runConfigExport(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "config export")
+	formatName := fs.String("format", "yaml", "Format to export: json, yaml or toml")
+	output := fs.String("o", "", "Write to this file instead of printing")
+	asJSON := outputFlag(ctx, fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *asJSON && *output == "" && !flagSet(fs, "format") {
+		*formatName = "json"
+	}
+
+	format, err := config.ParseFormat(*formatName)
+	if err != nil {
+		return err
+	}
+	data, err := config.Encode(ctx.Config, format)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err := ctx.Stdout.Write(data)
+		return err
+	}
+	if err := textfile.Write(*output, data); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+	if *asJSON {
+		return writeJSON(ctx, configResult{File: *output, Format: string(format), Rules: len(ctx.Config.Rules)})
+	}
+	fmt.Fprintf(ctx.Stdout, "Exported config to %s\n", *output)
+	return nil
+}
+
+// runConfigImport replaces the config, or only its rules, with those of a
+// JSON, YAML or TOML file, detected by its extension. The config is saved in
+// the format of the config file.
+func runConfigImport(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "config import")
+	rulesOnly := fs.Bool("rules", false, "Only import the rules, keeping the other settings")
+	asJSON := outputFlag(ctx, fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: var-sync config import [-rules] <file>")
+	}
+	file := positional[0]
+
+	data, err := textfile.Read(file)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", file, err)
+	}
+	imported, err := config.Decode(data, models.DetectFormat(file))
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+	if imported.Rules == nil {
+		imported.Rules = []models.SyncRule{}
+	}
+
+	if *rulesOnly {
+		if err := saveRules(ctx, imported.Rules); err != nil {
+			return err
+		}
+	} else {
+		if err := config.Validate(imported); err != nil {
+			return err
+		}
+		if err := config.Save(imported, ctx.ConfigPath); err != nil {
+			return err
+		}
+		*ctx.Config = *imported
+	}
+
+	if *asJSON {
+		return writeJSON(ctx, configResult{
+			File:       file,
+			Format:     string(models.DetectFormat(file)),
+			ConfigFile: ctx.ConfigPath,
+			Rules:      len(imported.Rules),
+		})
+	}
+	fmt.Fprintf(ctx.Stdout, "Imported %d rules from %s into %s\n", len(imported.Rules), file, ctx.ConfigPath)
+	return nil
+}
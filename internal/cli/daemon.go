@@ -0,0 +1,173 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"var-sync/internal/control"
+	"var-sync/pkg/models"
+)
+
+// runDaemon controls the var-sync watching the config through its control
+// socket
+func runDaemon(ctx *Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: var-sync daemon <rules|sync|pause|resume|events>")
+	}
+
+	client := control.Dial(ctx.Config.ControlPath(ctx.ConfigPath))
+	switch args[0] {
+	case "rules":
+		return runDaemonRules(ctx, client, args[1:])
+	case "sync":
+		return runDaemonSync(ctx, client, args[1:])
+	case "pause":
+		return runDaemonPause(ctx, client, args[1:], true)
+	case "resume":
+		return runDaemonPause(ctx, client, args[1:], false)
+	case "events":
+		return runDaemonEvents(ctx, client, args[1:])
+	}
+	return fmt.Errorf("unknown daemon command: %s", args[0])
+}
+
+// runDaemonRules lists the rules of the running var-sync and whether each is
+// paused
+func runDaemonRules(ctx *Context, client *control.Client, args []string) error {
+	fs := newFlagSet(ctx, "daemon rules")
+	asJSON := outputFlag(ctx, fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rules, err := client.Rules(context.Background())
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSON(ctx, rules)
+	}
+	if len(rules) == 0 {
+		fmt.Fprintln(ctx.Stdout, "No rules configured.")
+		return nil
+	}
+	for _, rule := range rules {
+		status := "enabled"
+		switch {
+		case !rule.Enabled:
+			status = "disabled"
+		case rule.Paused:
+			status = "paused"
+		}
+		fmt.Fprintf(ctx.Stdout, "%-36s  %-8s  %s\n", rule.ID, status, rule.Name)
+	}
+	return nil
+}
+
+// daemonSyncResult is the result of the daemon sync command
+type daemonSyncResult struct {
+	Syncing int `json:"syncing"` // The number of rules the watcher started syncing
+}
+
+// pausedRule is a rule paused or resumed by the daemon pause and resume
+// commands
+type pausedRule struct {
+	RuleID string `json:"rule_id"`
+	Paused bool   `json:"paused"`
+}
+
+// runDaemonSync syncs the given rules, or every rule, straight away
+func runDaemonSync(ctx *Context, client *control.Client, args []string) error {
+	fs := newFlagSet(ctx, "daemon sync")
+	asJSON := outputFlag(ctx, fs)
+	ids, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	count, err := client.Sync(context.Background(), ids...)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return writeJSON(ctx, daemonSyncResult{Syncing: count})
+	}
+	fmt.Fprintf(ctx.Stdout, "Syncing %d rules.\n", count)
+	return nil
+}
+
+// runDaemonPause pauses or resumes the given rules
+func runDaemonPause(ctx *Context, client *control.Client, args []string, pause bool) error {
+	name := "daemon resume"
+	if pause {
+		name = "daemon pause"
+	}
+	fs := newFlagSet(ctx, name)
+	asJSON := outputFlag(ctx, fs)
+	ids, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(ids) == 0 {
+		return fmt.Errorf("usage: var-sync daemon pause|resume <rule-id>...")
+	}
+
+	results := make([]pausedRule, 0, len(ids))
+	for _, id := range ids {
+		if pause {
+			if err := client.Pause(context.Background(), id); err != nil {
+				return err
+			}
+		} else if err := client.Resume(context.Background(), id); err != nil {
+			return err
+		}
+		results = append(results, pausedRule{RuleID: id, Paused: pause})
+		if *asJSON {
+			continue
+		}
+		if pause {
+			fmt.Fprintf(ctx.Stdout, "Paused rule %s.\n", id)
+		} else {
+			fmt.Fprintf(ctx.Stdout, "Resumed rule %s.\n", id)
+		}
+	}
+
+	if *asJSON {
+		return writeJSON(ctx, results)
+	}
+	return nil
+}
+
+// runDaemonEvents prints the sync events of the running var-sync as they
+// happen, until interrupted. With -output json each event is printed as a
+// JSON object on a line of its own.
+func runDaemonEvents(ctx *Context, client *control.Client, args []string) error {
+	fs := newFlagSet(ctx, "daemon events")
+	ruleID := fs.String("rule", "", "Only show events for this rule ID")
+	asJSON := outputFlag(ctx, fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(ctx.Stdout)
+
+	ruleNames := make(map[string]string, len(ctx.Config.Rules))
+	for _, rule := range ctx.Config.Rules {
+		ruleNames[rule.ID] = rule.Name
+	}
+
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	return client.Events(interrupted, func(event models.SyncEvent) {
+		switch {
+		case *ruleID != "" && event.RuleID != *ruleID:
+		case *asJSON:
+			encoder.Encode(event)
+		default:
+			writeEvent(ctx.Stdout, event, ruleNames)
+		}
+	})
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+
+	"var-sync/internal/backend"
+	"var-sync/internal/parser"
+	"var-sync/pkg/models"
+
+	"gopkg.in/yaml.v3"
+)
+
+// keyDiff is a key that differs between the two files of the diff command
+type keyDiff struct {
+	Key    string `json:"key" yaml:"key"`
+	Change string `json:"change" yaml:"change"` // added, removed or changed
+	Old    any    `json:"old,omitempty" yaml:"old,omitempty"`
+	New    any    `json:"new,omitempty" yaml:"new,omitempty"`
+}
+
+// runDiff compares the keys of two files or backend references, whatever
+// their formats, and prints the keys only in the second file, only in the
+// first, and with different values. Values are compared as syncs compare
+// them, so the string "8080" in an env file equals the number 8080.
+// -output json is the same as -format json.
+func runDiff(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "diff")
+	format := fs.String("format", "table", "Output format: table, json or yaml")
+	asJSON := outputFlag(ctx, fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if *asJSON && !flagSet(fs, "format") {
+		*format = "json"
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: var-sync diff <file-a> <file-b> [-format table|json|yaml]")
+	}
+	if *format != "table" && *format != "json" && *format != "yaml" {
+		return fmt.Errorf("invalid -format %q: use table, json or yaml", *format)
+	}
+
+	backends := backend.FromConfig(ctx.Config)
+	dataA, err := backends.Load(positional[0])
+	if err != nil {
+		return err
+	}
+	dataB, err := backends.Load(positional[1])
+	if err != nil {
+		return err
+	}
+
+	diffs := diffKeys(parser.New(), dataA, dataB)
+
+	switch *format {
+	case "json":
+		return writeJSON(ctx, diffs)
+	case "yaml":
+		data, err := yaml.Marshal(diffs)
+		if err != nil {
+			return fmt.Errorf("failed to marshal YAML: %w", err)
+		}
+		_, err = ctx.Stdout.Write(data)
+		return err
+	}
+
+	if len(diffs) == 0 {
+		fmt.Fprintln(ctx.Stdout, "No differences.")
+		return nil
+	}
+	counts := make(map[string]int)
+	for _, diff := range diffs {
+		counts[diff.Change]++
+		switch diff.Change {
+		case "added":
+			fmt.Fprintf(ctx.Stdout, "+ %-40s  %s\n", diff.Key, formatValue(diff.New))
+		case "removed":
+			fmt.Fprintf(ctx.Stdout, "- %-40s  %s\n", diff.Key, formatValue(diff.Old))
+		default:
+			fmt.Fprintf(ctx.Stdout, "~ %-40s  %s -> %s\n", diff.Key, formatValue(diff.Old), formatValue(diff.New))
+		}
+	}
+	fmt.Fprintf(ctx.Stdout, "\n%d added, %d removed, %d changed\n", counts["added"], counts["removed"], counts["changed"])
+	return nil
+}
+
+// diffKeys compares every leaf key of two documents, sorted by key path.
+// Values of keys that look sensitive are masked.
+func diffKeys(p *parser.Parser, dataA, dataB map[string]any) []keyDiff {
+	leaves := func(data map[string]any) map[string]any {
+		values := make(map[string]any)
+		for _, key := range p.GetAllKeys(data, "") {
+			values[key], _ = p.GetValue(data, key)
+		}
+		return values
+	}
+	leavesA, leavesB := leaves(dataA), leaves(dataB)
+
+	keys := make([]string, 0, len(leavesA)+len(leavesB))
+	for key := range leavesA {
+		keys = append(keys, key)
+	}
+	for key := range leavesB {
+		if _, ok := leavesA[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	diffs := []keyDiff{}
+	for _, key := range keys {
+		oldValue, inA := leavesA[key]
+		newValue, inB := leavesB[key]
+
+		diff := keyDiff{Key: key, Old: oldValue, New: newValue}
+		switch {
+		case !inA:
+			diff.Change = "added"
+		case !inB:
+			diff.Change = "removed"
+		case !p.ValuesEqual(oldValue, newValue):
+			diff.Change = "changed"
+		default:
+			continue
+		}
+
+		if models.SensitiveKey(key) {
+			if inA {
+				diff.Old = models.RedactedValue
+			}
+			if inB {
+				diff.New = models.RedactedValue
+			}
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
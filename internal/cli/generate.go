@@ -0,0 +1,199 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"var-sync/internal/backend"
+	"var-sync/internal/parser"
+	"var-sync/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// keyMatch is a source key paired with a target key by rule generate, and
+// how sure the pairing is
+type keyMatch struct {
+	sourceKey string
+	targetKey string
+	score     int
+	reason    string
+}
+
+// runRuleGenerate suggests rules for an existing pair of files by matching
+// their keys by name and value. The rules are printed as JSON, or added to
+// the config with -add, which prints them as JSON only with -output json.
+func runRuleGenerate(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "rule generate")
+	sourceFile := fs.String("source", "", "Source file or backend reference")
+	targetFile := fs.String("target", "", "Target file or backend reference")
+	add := fs.Bool("add", false, "Add the suggested rules to the config instead of printing them")
+	asJSON := outputFlag(ctx, fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *sourceFile == "" || *targetFile == "" {
+		return fmt.Errorf("usage: var-sync rule generate -source <file> -target <file> [-add]")
+	}
+
+	backends := backend.FromConfig(ctx.Config)
+	sourceData, err := backends.Load(*sourceFile)
+	if err != nil {
+		return err
+	}
+	targetData, err := backends.Load(*targetFile)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	matches := matchKeys(parser.New(), sourceData, targetData)
+	rules := make([]models.SyncRule, 0, len(matches))
+	for _, match := range matches {
+		rules = append(rules, models.SyncRule{
+			ID:          uuid.New().String(),
+			Name:        fmt.Sprintf("%s to %s", match.sourceKey, match.targetKey),
+			Description: "Generated: " + match.reason,
+			SourceFile:  *sourceFile,
+			SourceKey:   match.sourceKey,
+			TargetFile:  *targetFile,
+			TargetKey:   match.targetKey,
+			Enabled:     true,
+			Created:     now,
+		})
+	}
+
+	if !*add {
+		return writeJSON(ctx, rules)
+	}
+	if len(rules) > 0 {
+		if err := saveRules(ctx, append(append([]models.SyncRule(nil), ctx.Config.Rules...), rules...)); err != nil {
+			return err
+		}
+	}
+	if *asJSON {
+		return writeJSON(ctx, rules)
+	}
+	if len(rules) == 0 {
+		fmt.Fprintln(ctx.Stdout, "No matching keys found.")
+		return nil
+	}
+	for _, rule := range rules {
+		fmt.Fprintf(ctx.Stdout, "Added rule %s (%s)\n", rule.Name, rule.ID)
+	}
+	return nil
+}
+
+// matchKeys pairs the leaf keys of a source and target document, each key at
+// most once, best matches first:
+//
+//   - the same key path
+//   - the same key path once case and separators are ignored, such as
+//     database.host and DB_HOST
+//   - the same last segment and the same value
+//   - the same value, if it is distinctive enough and found only once in
+//     each file
+//
+// The matches are returned sorted by source key.
+func matchKeys(p *parser.Parser, sourceData, targetData map[string]any) []keyMatch {
+	leaves := func(data map[string]any) map[string]any {
+		values := make(map[string]any)
+		for _, key := range p.GetAllKeys(data, "") {
+			values[key], _ = p.GetValue(data, key)
+		}
+		return values
+	}
+	sources, targets := leaves(sourceData), leaves(targetData)
+
+	// Values found more than once cannot pair keys on their own
+	valueCounts := func(values map[string]any) map[string]int {
+		counts := make(map[string]int)
+		for _, value := range values {
+			counts[fmt.Sprintf("%v", value)]++
+		}
+		return counts
+	}
+	sourceCounts, targetCounts := valueCounts(sources), valueCounts(targets)
+
+	var candidates []keyMatch
+	for sourceKey, sourceValue := range sources {
+		for targetKey, targetValue := range targets {
+			sameValue := p.ValuesEqual(sourceValue, targetValue)
+			match := keyMatch{sourceKey: sourceKey, targetKey: targetKey}
+			switch {
+			case sourceKey == targetKey:
+				match.score, match.reason = 4, "same key"
+			case normalizeKey(sourceKey) == normalizeKey(targetKey):
+				match.score, match.reason = 3, "same key name"
+			case sameValue && normalizeKey(lastKeySegment(sourceKey)) == normalizeKey(lastKeySegment(targetKey)):
+				match.score, match.reason = 2, "same name and value"
+			case sameValue && distinctiveValue(sourceValue) && sourceCounts[fmt.Sprintf("%v", sourceValue)] == 1 && targetCounts[fmt.Sprintf("%v", targetValue)] == 1:
+				match.score, match.reason = 1, "same value"
+			default:
+				continue
+			}
+			candidates = append(candidates, match)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].score != candidates[j].score {
+			return candidates[i].score > candidates[j].score
+		}
+		if candidates[i].sourceKey != candidates[j].sourceKey {
+			return candidates[i].sourceKey < candidates[j].sourceKey
+		}
+		return candidates[i].targetKey < candidates[j].targetKey
+	})
+
+	usedSources := make(map[string]bool)
+	usedTargets := make(map[string]bool)
+	var matches []keyMatch
+	for _, match := range candidates {
+		if usedSources[match.sourceKey] || usedTargets[match.targetKey] {
+			continue
+		}
+		usedSources[match.sourceKey] = true
+		usedTargets[match.targetKey] = true
+		matches = append(matches, match)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].sourceKey < matches[j].sourceKey
+	})
+	return matches
+}
+
+// normalizeKey lowercases a key path and drops its separators, so that
+// database.host, DATABASE_HOST and database-host compare equal
+func normalizeKey(keyPath string) string {
+	return strings.Map(func(r rune) rune {
+		switch r {
+		case '.', '_', '-', '[', ']':
+			return -1
+		}
+		return r
+	}, strings.ToLower(keyPath))
+}
+
+// lastKeySegment returns the last segment of a key path, such as host for
+// database.host
+func lastKeySegment(keyPath string) string {
+	if i := strings.LastIndexAny(keyPath, ".["); i >= 0 {
+		return strings.TrimSuffix(keyPath[i+1:], "]")
+	}
+	return keyPath
+}
+
+// distinctiveValue reports whether a value is unusual enough that two keys
+// holding it are likely the same setting: not a boolean, empty, or a short
+// string or number such as 1 or "on"
+func distinctiveValue(value any) bool {
+	switch value.(type) {
+	case nil, bool:
+		return false
+	}
+	return len(fmt.Sprintf("%v", value)) >= 4
+}
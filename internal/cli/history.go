@@ -0,0 +1,100 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"var-sync/internal/history"
+	"var-sync/pkg/models"
+)
+
+// runHistory prints recorded sync events, oldest first
+func runHistory(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "history")
+	ruleID := fs.String("rule", "", "Only show events for this rule ID")
+	since := fs.String("since", "", "Only show events newer than a duration (24h) or time (2006-01-02, RFC3339)")
+	limit := fs.Int("limit", 50, "Maximum number of events to show (0 for all)")
+	asJSON := outputFlag(ctx, fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	filter := history.Filter{RuleID: *ruleID, Limit: *limit}
+	if *since != "" {
+		sinceTime, err := parseSince(*since, time.Now())
+		if err != nil {
+			return err
+		}
+		filter.Since = sinceTime
+	}
+
+	events, err := history.Read(ctx.Config.HistoryPath(), filter)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 && !*asJSON {
+		fmt.Fprintln(ctx.Stdout, "No sync events recorded.")
+		return nil
+	}
+
+	ruleNames := make(map[string]string, len(ctx.Config.Rules))
+	sensitive := make(map[string]bool, len(ctx.Config.Rules))
+	for _, rule := range ctx.Config.Rules {
+		ruleNames[rule.ID] = rule.Name
+		sensitive[rule.ID] = rule.IsSensitive()
+	}
+	redacted := make([]models.SyncEvent, 0, len(events))
+	for _, event := range events {
+		// Events recorded before a rule was marked sensitive are masked too
+		event.Sensitive = event.Sensitive || sensitive[event.RuleID]
+		redacted = append(redacted, event.Redacted())
+	}
+
+	if *asJSON {
+		return writeJSON(ctx, redacted)
+	}
+	for _, event := range redacted {
+		writeEvent(ctx.Stdout, event, ruleNames)
+	}
+	return nil
+}
+
+// parseSince parses a --since value as a duration before now or an absolute time
+func parseSince(value string, now time.Time) (time.Time, error) {
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(-duration), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid --since value %q: use a duration such as 24h or a date such as 2006-01-02", value)
+}
+
+// writeEvent writes a single history line for an event
+func writeEvent(w io.Writer, event models.SyncEvent, ruleNames map[string]string) {
+	id := event.ID
+	if len(id) > 8 {
+		id = id[:8]
+	}
+	rule := event.RuleID
+	if name := ruleNames[event.RuleID]; name != "" {
+		rule = name
+	}
+
+	status := fmt.Sprintf("%v -> %v", event.OldValue, event.NewValue)
+	if !event.Success {
+		status = "FAILED: " + event.Error
+	}
+
+	fmt.Fprintf(w, "%s  %-8s  %-20s  %s:%s  %s\n",
+		event.Timestamp.Local().Format("2006-01-02 15:04:05"),
+		id,
+		rule,
+		event.TargetFile,
+		event.TargetKey,
+		status)
+}
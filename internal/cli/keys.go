@@ -0,0 +1,148 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"var-sync/internal/backend"
+	"var-sync/internal/parser"
+	"var-sync/pkg/models"
+)
+
+// runGet prints the value at a key path in a file or backend reference.
+// Strings are printed as they are and everything else as JSON.
+func runGet(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "get")
+	asJSON := outputFlag(ctx, fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 2 {
+		return fmt.Errorf("usage: var-sync get <file> <keypath>")
+	}
+	file, keyPath := positional[0], positional[1]
+
+	data, err := backend.FromConfig(ctx.Config).Load(file)
+	if err != nil {
+		return err
+	}
+	value, err := parser.New().GetValue(data, keyPath)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(ctx, keyInfo{File: file, Key: keyPath, Type: parser.TypeName(value), Value: value})
+	}
+	fmt.Fprintln(ctx.Stdout, formatValue(value))
+	return nil
+}
+
+// formatValue returns a string as it is and any other value as JSON
+func formatValue(value any) string {
+	if s, ok := value.(string); ok {
+		return s
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+	return string(encoded)
+}
+
+// runSet writes a value to a key path in a file or backend reference, updating
+// files surgically so the rest of their formatting is kept
+func runSet(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "set")
+	valueType := fs.String("type", "auto", "Type of the value: auto, string, int, float, bool or json")
+	asJSON := outputFlag(ctx, fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 3 {
+		return fmt.Errorf("usage: var-sync set <file> <keypath> <value> [-type auto|string|int|float|bool|json]")
+	}
+	file, keyPath := positional[0], positional[1]
+
+	value, err := parseTypedValue(positional[2], *valueType)
+	if err != nil {
+		return err
+	}
+	if err := backend.FromConfig(ctx.Config).Update(file, map[string]any{keyPath: value}); err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(ctx, keyInfo{File: file, Key: keyPath, Type: parser.TypeName(value), Value: value})
+	}
+	return nil
+}
+
+// parseTypedValue converts a command line value to the named type. Auto
+// detects booleans and numbers, as in .env files.
+func parseTypedValue(value, valueType string) (any, error) {
+	if valueType == "auto" {
+		return parser.ParseEnvValue(value), nil
+	}
+	if valueType == "" || !models.ValueType(valueType).Valid() {
+		return nil, fmt.Errorf("invalid -type %q: use auto, string, int, float, bool or json", valueType)
+	}
+	return parser.ConvertValue(value, models.ValueType(valueType))
+}
+
+// keyInfo describes an addressable key for the keys, get and set commands
+type keyInfo struct {
+	File  string `json:"file,omitempty"` // The file read or written by get and set
+	Key   string `json:"key"`
+	Type  string `json:"type"`
+	Value any    `json:"value"`
+}
+
+// runKeys lists every leaf key path in a file or backend reference, sorted,
+// with its type and value. Values of keys that look sensitive are masked.
+func runKeys(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "keys")
+	prefix := fs.String("prefix", "", "Only list keys under this key path, such as database")
+	asJSON := outputFlag(ctx, fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: var-sync keys <file> [-prefix keypath] [-output text|json]")
+	}
+
+	data, err := backend.FromConfig(ctx.Config).Load(positional[0])
+	if err != nil {
+		return err
+	}
+
+	p := parser.New()
+	keys := p.GetAllKeys(data, "")
+	sort.Strings(keys)
+
+	infos := make([]keyInfo, 0, len(keys))
+	for _, key := range keys {
+		if *prefix != "" && key != *prefix && !strings.HasPrefix(key, *prefix+".") && !strings.HasPrefix(key, *prefix+"[") && !strings.HasPrefix(key, *prefix+"@") {
+			continue
+		}
+		value, _ := p.GetValue(data, key)
+		info := keyInfo{Key: key, Type: parser.TypeName(value), Value: value}
+		if models.SensitiveKey(key) {
+			info.Value = models.RedactedValue
+		}
+		infos = append(infos, info)
+	}
+
+	if *asJSON {
+		return writeJSON(ctx, infos)
+	}
+	for _, info := range infos {
+		fmt.Fprintf(ctx.Stdout, "%-40s  %-7s  %v\n", info.Key, info.Type, info.Value)
+	}
+	return nil
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"var-sync/internal/backend"
+	"var-sync/internal/parser"
+	"var-sync/internal/textfile"
+)
+
+// envVariable is a variable written by the render-env command
+type envVariable struct {
+	Name  string `json:"name"`
+	Key   string `json:"key"` // The source key path the value was read from
+	Value any    `json:"value"`
+}
+
+// renderEnvResult is the result of the render-env command
+type renderEnvResult struct {
+	File      string        `json:"file,omitempty"` // The env file written, unless printed
+	Content   string        `json:"content"`
+	Variables []envVariable `json:"variables"`
+}
+
+// runRenderEnv writes an env file holding keys of a source, each named after
+// its key path unless given a name as NAME=keypath. Without keys, every key of
+// the source is written. The env file is printed, or written to -output.
+// Since -output names the file, JSON is asked for with -json or with -output
+// json before the command.
+func runRenderEnv(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "render-env")
+	prefix := fs.String("prefix", "", "Prefix for the generated variable names, such as APP_")
+	output := fs.String("output", "", "Write the env file here instead of printing it")
+	asJSON := ctx.Output == OutputJSON
+	fs.BoolVar(&asJSON, "json", asJSON, "Print the variables as JSON")
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) == 0 {
+		return fmt.Errorf("usage: var-sync render-env <source> [NAME=]keypath... [-prefix P] [-output file]")
+	}
+	source, keys := positional[0], positional[1:]
+
+	data, err := backend.FromConfig(ctx.Config).Load(source)
+	if err != nil {
+		return err
+	}
+	p := parser.New()
+	if len(keys) == 0 {
+		keys = p.GetAllKeys(data, "")
+		sort.Strings(keys)
+	}
+
+	var b strings.Builder
+	export := strings.HasSuffix(*output, ".sh")
+	names := make(map[string]string)
+	variables := make([]envVariable, 0, len(keys))
+	for _, key := range keys {
+		name, keyPath, named := strings.Cut(key, "=")
+		if !named {
+			name, keyPath = *prefix+envName(key), key
+		}
+		if other, exists := names[name]; exists {
+			return fmt.Errorf("keys %s and %s would both be written as %s", other, keyPath, name)
+		}
+		names[name] = keyPath
+
+		value, err := p.GetValue(data, keyPath)
+		if err != nil {
+			return err
+		}
+		formatted := parser.FormatEnvValue(value)
+		switch value.(type) {
+		case map[string]any, []any:
+			formatted = parser.FormatEnvValue(formatValue(value))
+		}
+		if export {
+			b.WriteString("export ")
+		}
+		fmt.Fprintf(&b, "%s=%s\n", name, formatted)
+		variables = append(variables, envVariable{Name: name, Key: keyPath, Value: value})
+	}
+
+	if *output == "" {
+		if asJSON {
+			return writeJSON(ctx, renderEnvResult{Content: b.String(), Variables: variables})
+		}
+		_, err := fmt.Fprint(ctx.Stdout, b.String())
+		return err
+	}
+	if err := textfile.Write(*output, []byte(b.String())); err != nil {
+		return fmt.Errorf("failed to write %s: %w", *output, err)
+	}
+	if asJSON {
+		return writeJSON(ctx, renderEnvResult{File: *output, Content: b.String(), Variables: variables})
+	}
+	fmt.Fprintf(ctx.Stdout, "Wrote %d variables to %s\n", len(keys), *output)
+	return nil
+}
+
+// envName turns a key path into a variable name, such as database.host into
+// DATABASE_HOST and servers[0].port into SERVERS_0_PORT
+func envName(keyPath string) string {
+	var b strings.Builder
+	underscore := false
+	for _, r := range strings.ToUpper(keyPath) {
+		if r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			if underscore && b.Len() > 0 {
+				b.WriteByte('_')
+			}
+			b.WriteRune(r)
+			underscore = false
+		} else {
+			underscore = true
+		}
+	}
+	return b.String()
+}
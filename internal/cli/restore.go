@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+
+	"var-sync/internal/backup"
+	"var-sync/pkg/models"
+)
+
+// restoreResult is the result of the restore command
+type restoreResult struct {
+	TargetFile string `json:"target_file"`
+	Backup     string `json:"backup"` // The backup the target was restored from
+}
+
+// runRestore restores a target file from its most recent backup. Without a
+// file argument it restores whichever rule target was backed up last.
+func runRestore(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "restore")
+	asJSON := outputFlag(ctx, fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	backups := backup.New(ctx.Config.Backup)
+
+	var target string
+	if len(positional) > 0 {
+		target = positional[0]
+	} else {
+		latest, err := latestBackedUpTarget(ctx, backups)
+		if err != nil {
+			return err
+		}
+		target = latest
+	}
+
+	restored, err := backups.Restore(target)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(ctx, restoreResult{TargetFile: target, Backup: restored})
+	}
+	fmt.Fprintf(ctx.Stdout, "Restored %s from %s\n", target, restored)
+	return nil
+}
+
+// latestBackedUpTarget finds the rule target file with the newest backup
+func latestBackedUpTarget(ctx *Context, backups *backup.Manager) (string, error) {
+	var target string
+	var newest os.FileInfo
+	seen := make(map[string]bool)
+
+	for _, rule := range models.ExpandRules(ctx.Config.Rules) {
+		if seen[rule.TargetFile] {
+			continue
+		}
+		seen[rule.TargetFile] = true
+
+		latest, err := backups.Latest(rule.TargetFile)
+		if err != nil || latest == "" {
+			continue
+		}
+		info, err := os.Stat(latest)
+		if err != nil {
+			continue
+		}
+		if newest == nil || info.ModTime().After(newest.ModTime()) {
+			target = rule.TargetFile
+			newest = info
+		}
+	}
+
+	if target == "" {
+		return "", fmt.Errorf("no backups found for any rule target")
+	}
+	return target, nil
+}
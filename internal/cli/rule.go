@@ -0,0 +1,379 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"var-sync/internal/backend"
+	"var-sync/internal/config"
+	"var-sync/pkg/models"
+
+	"github.com/google/uuid"
+)
+
+// runRule manages the rules in the config file without the TUI
+func runRule(ctx *Context, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: var-sync rule <add|list|show|rm|enable|disable|generate>")
+	}
+
+	switch args[0] {
+	case "add":
+		return runRuleAdd(ctx, args[1:])
+	case "list":
+		return runRuleList(ctx, args[1:])
+	case "show":
+		return runRuleShow(ctx, args[1:])
+	case "rm":
+		return runRuleRemove(ctx, args[1:])
+	case "enable":
+		return runRuleEnable(ctx, args[1:], true)
+	case "disable":
+		return runRuleEnable(ctx, args[1:], false)
+	case "generate":
+		return runRuleGenerate(ctx, args[1:])
+	}
+	return fmt.Errorf("unknown rule command: %s", args[0])
+}
+
+// runRuleAdd adds a rule built from flags and saves the config
+func runRuleAdd(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "rule add")
+	id := fs.String("id", "", "Rule ID (default: a generated UUID)")
+	name := fs.String("name", "", "Rule name")
+	description := fs.String("description", "", "Rule description")
+	sourceFile := fs.String("source-file", "", "Source file, glob pattern or backend reference")
+	sourceKey := fs.String("source-key", "", "Source key path")
+	sourceExpr := fs.String("source-expr", "", "Expression computing the value from source keys, instead of -source-key")
+	when := fs.String("when", "", "Condition on the source for the rule to sync, such as 'source.env == \"production\"'")
+	targetFile := fs.String("target-file", "", "Target file or backend reference")
+	targetKey := fs.String("target-key", "", "Target key path")
+	var mappings []models.KeyMapping
+	fs.Func("map", "Sync `source=target` key paths, instead of -source-key and -target-key (repeatable)", func(value string) error {
+		sourceKey, targetKey, ok := strings.Cut(value, "=")
+		if !ok || sourceKey == "" || targetKey == "" {
+			return fmt.Errorf("use source=target")
+		}
+		mappings = append(mappings, models.KeyMapping{SourceKey: sourceKey, TargetKey: targetKey})
+		return nil
+	})
+	tags := fs.String("tags", "", "Comma separated tags, such as env:prod,service:auth")
+	disabled := fs.Bool("disabled", false, "Add the rule disabled")
+	backup := fs.String("backup", "", "Back up targets before writing: true or false (default: the global setting)")
+	onConflict := fs.String("on-conflict", "", "Conflict strategy: source-wins, target-wins, newest-wins or manual")
+	priority := fs.String("priority", "", "Priority: normal or high")
+	sensitive := fs.Bool("sensitive", false, "Keep the rule's values out of logs and history")
+	createMissing := fs.Bool("create-missing", false, "Add the target key if the target does not have it")
+	deleteMissing := fs.Bool("delete-missing", false, "Remove the target key when the source key is removed")
+	watchMode := fs.String("watch-mode", "", "Watch mode for the source: fsnotify or poll")
+	debounce := fs.Duration("debounce", 0, "Debounce for the source (default: the global setting)")
+	batchDelay := fs.Duration("batch-delay", 0, "Batch delay for the source (default: the global setting)")
+	batchMaxDelay := fs.Duration("batch-max-delay", 0, "Longest a change may wait while the source keeps changing (default: the global setting)")
+	minInterval := fs.Duration("min-interval", 0, "Sync the rule at most once per this interval")
+	asJSON := outputFlag(ctx, fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rule := models.SyncRule{
+		ID:            *id,
+		Name:          *name,
+		Description:   *description,
+		SourceFile:    *sourceFile,
+		SourceKey:     *sourceKey,
+		SourceExpr:    *sourceExpr,
+		When:          *when,
+		TargetFile:    *targetFile,
+		TargetKey:     *targetKey,
+		Mappings:      mappings,
+		CreateMissing: *createMissing,
+		DeleteMissing: *deleteMissing,
+		Enabled:       !*disabled,
+		OnConflict:    models.OnConflict(*onConflict),
+		Priority:      models.Priority(*priority),
+		Sensitive:     *sensitive,
+		WatchMode:     models.WatchMode(*watchMode),
+		Debounce:      models.Duration(*debounce),
+		BatchDelay:    models.Duration(*batchDelay),
+		BatchMaxDelay: models.Duration(*batchMaxDelay),
+		MinInterval:   models.Duration(*minInterval),
+		Created:       time.Now(),
+	}
+	if rule.ID == "" {
+		rule.ID = uuid.New().String()
+	}
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			rule.Tags = append(rule.Tags, tag)
+		}
+	}
+	if *backup != "" {
+		enabled, err := strconv.ParseBool(*backup)
+		if err != nil {
+			return fmt.Errorf("invalid -backup %q: use true or false", *backup)
+		}
+		rule.Backup = &enabled
+	}
+
+	if err := checkNewRule(ctx.Config, rule); err != nil {
+		return err
+	}
+
+	rules := append(append([]models.SyncRule(nil), ctx.Config.Rules...), rule)
+	if err := saveRules(ctx, rules); err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(ctx, rule)
+	}
+	fmt.Fprintf(ctx.Stdout, "Added rule %s (%s)\n", rule.Name, rule.ID)
+	return nil
+}
+
+// checkNewRule checks that a rule has everything it needs to sync and that
+// its ID is not taken
+func checkNewRule(cfg *models.Config, rule models.SyncRule) error {
+	if _, ok := findRule(cfg, rule.ID); ok {
+		return fmt.Errorf("rule %s already exists", rule.ID)
+	}
+
+	backends := backend.FromConfig(cfg)
+	resolved := backends.ResolveRule(rule)
+	switch {
+	case rule.Name == "":
+		return fmt.Errorf("-name is required")
+	case rule.SourceFile == "":
+		return fmt.Errorf("-source-file is required")
+	case len(rule.Mappings) > 0:
+		if rule.SourceKey != "" || rule.TargetKey != "" || rule.SourceExpr != "" {
+			return fmt.Errorf("-map cannot be combined with -source-key, -source-expr or -target-key")
+		}
+		if rule.TargetFile == "" {
+			return fmt.Errorf("-target-file is required")
+		}
+	case resolved.SourceKey == "" && rule.SourceExpr == "":
+		return fmt.Errorf("-source-key or -source-expr is required")
+	case rule.TargetFile == "":
+		return fmt.Errorf("-target-file is required")
+	case resolved.TargetKey == "":
+		return fmt.Errorf("-target-key is required")
+	}
+	return nil
+}
+
+// runRuleList prints every rule, one per line
+func runRuleList(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "rule list")
+	tag := fs.String("tag", "", "Only list rules with this tag")
+	asJSON := outputFlag(ctx, fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	rules := make([]models.SyncRule, 0, len(ctx.Config.Rules))
+	for _, rule := range ctx.Config.Rules {
+		if *tag == "" || hasTag(rule, *tag) {
+			rules = append(rules, rule)
+		}
+	}
+
+	if *asJSON {
+		return writeJSON(ctx, rules)
+	}
+	if len(rules) == 0 {
+		fmt.Fprintln(ctx.Stdout, "No rules configured.")
+		return nil
+	}
+	for _, rule := range rules {
+		status := "enabled"
+		if !rule.Enabled {
+			status = "disabled"
+		}
+		sourceKeys, targetKeys := rule.SourceKey, rule.TargetKey
+		if len(rule.Mappings) > 0 {
+			sourceKeys = fmt.Sprintf("{%d keys}", len(rule.Mappings))
+			targetKeys = sourceKeys
+		}
+		fmt.Fprintf(ctx.Stdout, "%-36s  %-8s  %-20s  %s:%s -> %s:%s\n",
+			rule.ID,
+			status,
+			rule.Name,
+			rule.SourceFile,
+			sourceKeys,
+			rule.TargetFile,
+			targetKeys)
+	}
+	return nil
+}
+
+// runRuleShow prints a single rule in full
+func runRuleShow(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "rule show")
+	asJSON := outputFlag(ctx, fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: var-sync rule show [-output text|json] <id>")
+	}
+
+	i, ok := findRule(ctx.Config, positional[0])
+	if !ok {
+		return fmt.Errorf("no rule with ID %s", positional[0])
+	}
+	rule := ctx.Config.Rules[i]
+
+	if *asJSON {
+		return writeJSON(ctx, rule)
+	}
+	fmt.Fprintf(ctx.Stdout, "ID:          %s\n", rule.ID)
+	fmt.Fprintf(ctx.Stdout, "Name:        %s\n", rule.Name)
+	if rule.Description != "" {
+		fmt.Fprintf(ctx.Stdout, "Description: %s\n", rule.Description)
+	}
+	fmt.Fprintf(ctx.Stdout, "Enabled:     %t\n", rule.Enabled)
+	if len(rule.Mappings) > 0 {
+		fmt.Fprintf(ctx.Stdout, "Source:      %s\n", rule.SourceFile)
+	} else {
+		fmt.Fprintf(ctx.Stdout, "Source:      %s:%s\n", rule.SourceFile, rule.SourceKey)
+	}
+	if rule.SourceExpr != "" {
+		fmt.Fprintf(ctx.Stdout, "Expression:  %s\n", rule.SourceExpr)
+	}
+	if rule.When != "" {
+		fmt.Fprintf(ctx.Stdout, "When:        %s\n", rule.When)
+	}
+	if len(rule.Mappings) > 0 {
+		fmt.Fprintf(ctx.Stdout, "Target:      %s\n", rule.TargetFile)
+		fmt.Fprintln(ctx.Stdout, "Mappings:")
+		for _, mapping := range rule.Mappings {
+			fmt.Fprintf(ctx.Stdout, "  %s -> %s\n", mapping.SourceKey, mapping.TargetKey)
+		}
+	} else {
+		fmt.Fprintf(ctx.Stdout, "Target:      %s:%s\n", rule.TargetFile, rule.TargetKey)
+	}
+	if len(rule.Tags) > 0 {
+		fmt.Fprintf(ctx.Stdout, "Tags:        %s\n", strings.Join(rule.Tags, ", "))
+	}
+	if rule.OnConflict != "" {
+		fmt.Fprintf(ctx.Stdout, "On conflict: %s\n", rule.OnConflict)
+	}
+	if rule.IsSensitive() {
+		fmt.Fprintln(ctx.Stdout, "Sensitive:   true")
+	}
+	fmt.Fprintf(ctx.Stdout, "Created:     %s\n", rule.Created.Local().Format("2006-01-02 15:04:05"))
+	return nil
+}
+
+// runRuleRemove deletes a rule and saves the config
+func runRuleRemove(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "rule rm")
+	asJSON := outputFlag(ctx, fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: var-sync rule rm <id>")
+	}
+
+	i, ok := findRule(ctx.Config, positional[0])
+	if !ok {
+		return fmt.Errorf("no rule with ID %s", positional[0])
+	}
+	rule := ctx.Config.Rules[i]
+	rules := append(append([]models.SyncRule(nil), ctx.Config.Rules[:i]...), ctx.Config.Rules[i+1:]...)
+	if err := saveRules(ctx, rules); err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(ctx, rule)
+	}
+	fmt.Fprintf(ctx.Stdout, "Removed rule %s (%s)\n", rule.Name, rule.ID)
+	return nil
+}
+
+// runRuleEnable enables or disables a rule and saves the config
+func runRuleEnable(ctx *Context, args []string, enabled bool) error {
+	verb := "enable"
+	if !enabled {
+		verb = "disable"
+	}
+
+	fs := newFlagSet(ctx, "rule "+verb)
+	asJSON := outputFlag(ctx, fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(positional) != 1 {
+		return fmt.Errorf("usage: var-sync rule %s <id>", verb)
+	}
+
+	i, ok := findRule(ctx.Config, positional[0])
+	if !ok {
+		return fmt.Errorf("no rule with ID %s", positional[0])
+	}
+	rules := append([]models.SyncRule(nil), ctx.Config.Rules...)
+	rules[i].Enabled = enabled
+	if err := saveRules(ctx, rules); err != nil {
+		return err
+	}
+
+	if *asJSON {
+		return writeJSON(ctx, rules[i])
+	}
+	fmt.Fprintf(ctx.Stdout, "%sd rule %s (%s)\n", strings.ToUpper(verb[:1])+verb[1:], rules[i].Name, rules[i].ID)
+	return nil
+}
+
+// findRule returns the index of the rule with the given ID
+func findRule(cfg *models.Config, id string) (int, bool) {
+	for i, rule := range cfg.Rules {
+		if rule.ID == id {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// hasTag reports whether a rule carries a tag
+func hasTag(rule models.SyncRule, tag string) bool {
+	for _, t := range rule.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// saveRules replaces the rules in the config and writes it back to the
+// config file, leaving the config as it was if the new rules are invalid
+func saveRules(ctx *Context, rules []models.SyncRule) error {
+	updated := *ctx.Config
+	updated.Rules = rules
+	if err := config.Validate(&updated); err != nil {
+		return err
+	}
+	if err := config.Save(&updated, ctx.ConfigPath); err != nil {
+		return err
+	}
+	ctx.Config.Rules = rules
+	return nil
+}
+
+// writeJSON prints a value as indented JSON
+func writeJSON(ctx *Context, value any) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	fmt.Fprintln(ctx.Stdout, string(data))
+	return nil
+}
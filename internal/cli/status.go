@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"var-sync/internal/backend"
+	"var-sync/internal/parser"
+	"var-sync/internal/state"
+	"var-sync/pkg/models"
+)
+
+// Rule states reported by the status command
+const (
+	statusInSync    = "in sync"
+	statusOutOfSync = "out of sync"
+	statusNever     = "never synced"
+	statusDisabled  = "disabled"
+	statusInactive  = "inactive"
+	statusError     = "error"
+)
+
+// ruleState is the state of one rule reported by the status command
+type ruleState struct {
+	RuleID     string     `json:"rule_id"`
+	Name       string     `json:"name"`
+	SourceFile string     `json:"source_file"`
+	TargetFile string     `json:"target_file"`
+	Status     string     `json:"status"`
+	Reason     string     `json:"reason,omitempty"`
+	LastSync   *time.Time `json:"last_sync,omitempty"`
+
+	// The target keys holding a different value than the source, when out of
+	// sync
+	Differences []valueDifference `json:"differences,omitempty"`
+}
+
+// valueDifference is a target key whose value differs from the source's
+type valueDifference struct {
+	Key     string `json:"key"`
+	Source  any    `json:"source"`
+	Target  any    `json:"target,omitempty"`
+	Missing bool   `json:"missing,omitempty"` // The target does not have the key
+	Removed bool   `json:"removed,omitempty"` // The source key was removed, so the target key will be
+}
+
+// runStatus reports whether the target of each rule holds its source's
+// value. Rules out of sync show the differing values and whether the source
+// or the target changed since the rule last synced. With -check it fails if
+// any rule is out of sync or failing.
+func runStatus(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "status")
+	asJSON := outputFlag(ctx, fs)
+	check := fs.Bool("check", false, "Fail if any rule is out of sync or failing")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	store, err := state.Open(ctx.Config.StatePath())
+	if err != nil {
+		return err
+	}
+	states := ruleStates(ctx.Config, store)
+
+	counts := make(map[string]int)
+	for _, rs := range states {
+		counts[rs.Status]++
+	}
+	failing := counts[statusOutOfSync] + counts[statusNever] + counts[statusError]
+
+	if *asJSON {
+		if err := writeJSON(ctx, states); err != nil {
+			return err
+		}
+	} else if len(states) == 0 {
+		fmt.Fprintln(ctx.Stdout, "No rules configured.")
+	} else {
+		for _, rs := range states {
+			writeRuleState(ctx, rs)
+		}
+		fmt.Fprintf(ctx.Stdout, "\n%d in sync, %d out of sync, %d failing\n",
+			counts[statusInSync], counts[statusOutOfSync]+counts[statusNever], counts[statusError])
+	}
+
+	if *check && failing > 0 {
+		return fmt.Errorf("%d rules are out of sync or failing", failing)
+	}
+	return nil
+}
+
+// writeRuleState prints a rule's state on one line, followed by any values
+// that differ
+func writeRuleState(ctx *Context, rs ruleState) {
+	lastSync := "never"
+	if rs.LastSync != nil {
+		lastSync = rs.LastSync.Local().Format("2006-01-02 15:04:05")
+	}
+	line := fmt.Sprintf("%-12s  %-20s  %-19s  %s -> %s", rs.Status, rs.Name, lastSync, rs.SourceFile, rs.TargetFile)
+	if rs.Reason != "" {
+		line += " (" + rs.Reason + ")"
+	}
+	fmt.Fprintln(ctx.Stdout, line)
+
+	for _, difference := range rs.Differences {
+		source, target := formatValue(difference.Source), "missing"
+		if difference.Removed {
+			source = "removed"
+		}
+		if !difference.Missing {
+			target = formatValue(difference.Target)
+		}
+		fmt.Fprintf(ctx.Stdout, "    %s: source %s, target %s\n", difference.Key, source, target)
+	}
+}
+
+// ruleStates works out the state of every rule, with glob rules expanded
+func ruleStates(cfg *models.Config, store *state.Store) []ruleState {
+	backends := backend.FromConfig(cfg)
+	p := parser.New()
+	statuses := store.RuleStatuses()
+
+	states := make([]ruleState, 0, len(cfg.Rules))
+	for _, original := range cfg.Rules {
+		rules, err := original.Expand()
+		if err != nil {
+			states = append(states, ruleState{
+				RuleID:     original.ID,
+				Name:       original.Name,
+				SourceFile: original.SourceFile,
+				TargetFile: original.TargetFile,
+				Status:     statusError,
+				Reason:     err.Error(),
+			})
+			continue
+		}
+
+		for _, rule := range rules {
+			rs := ruleState{
+				RuleID:     rule.ID,
+				Name:       rule.Name,
+				SourceFile: rule.SourceFile,
+				TargetFile: rule.TargetFile,
+			}
+			if status, ok := statuses[rule.ID]; ok {
+				rs.LastSync = status.LastSync
+			}
+			rs.Status, rs.Reason, rs.Differences = ruleStatus(backends, p, store, backends.ResolveRule(rule))
+			if rule.IsSensitive() {
+				for i := range rs.Differences {
+					if !rs.Differences[i].Removed {
+						rs.Differences[i].Source = models.RedactedValue
+					}
+					if !rs.Differences[i].Missing {
+						rs.Differences[i].Target = models.RedactedValue
+					}
+				}
+			}
+			states = append(states, rs)
+		}
+	}
+	return states
+}
+
+// ruleStatus compares a rule's target with its source, returning the rule's
+// status, the reason for it and the target keys that differ. A rule out of
+// sync is explained by the checksums recorded when it last synced.
+func ruleStatus(backends *backend.Registry, p *parser.Parser, store *state.Store, rule models.SyncRule) (string, string, []valueDifference) {
+	if !rule.Enabled {
+		return statusDisabled, "", nil
+	}
+
+	sourceData, err := backends.Load(rule.SourceFile)
+	if err != nil {
+		return statusError, fmt.Sprintf("failed to load source: %v", err), nil
+	}
+	if applies, err := p.RuleApplies(sourceData, rule); err != nil {
+		return statusError, err.Error(), nil
+	} else if !applies {
+		return statusInactive, "its when condition does not hold", nil
+	}
+	updates, err := p.ResolveRule(sourceData, rule)
+	if err != nil {
+		return statusError, fmt.Sprintf("source key does not resolve: %v", err), nil
+	}
+	targetData, err := backends.Load(rule.TargetFile)
+	if err != nil {
+		return statusError, fmt.Sprintf("failed to load target: %v", err), nil
+	}
+
+	var differences []valueDifference
+	for targetKey, value := range updates {
+		if p.Holds(targetData, targetKey, value) {
+			continue
+		}
+		current, err := p.GetValue(targetData, targetKey)
+		if arrayPath, ok := parser.AppendPath(targetKey); ok {
+			current, err = p.GetValue(targetData, arrayPath)
+		}
+		if value == parser.Deleted {
+			differences = append(differences, valueDifference{Key: targetKey, Target: current, Removed: true})
+		} else if err != nil {
+			differences = append(differences, valueDifference{Key: targetKey, Source: value, Missing: true})
+		} else {
+			differences = append(differences, valueDifference{Key: targetKey, Source: value, Target: current})
+		}
+	}
+	if len(differences) == 0 {
+		return statusInSync, "", nil
+	}
+	sort.Slice(differences, func(i, j int) bool {
+		return differences[i].Key < differences[j].Key
+	})
+
+	applied, ok := store.LastApplied(rule.ID, rule.TargetFile)
+	if !ok {
+		return statusNever, "", differences
+	}
+	// Syncs from a source read in part record no source checksum
+	sourceChanged := applied.SourceHash != "" && applied.SourceHash != state.Checksum(sourceData)
+	targetChanged := applied.TargetHash != state.Checksum(targetData)
+	switch {
+	case sourceChanged && targetChanged:
+		return statusOutOfSync, "source and target changed since the last sync", differences
+	case sourceChanged:
+		return statusOutOfSync, "source changed since the last sync", differences
+	case targetChanged:
+		return statusOutOfSync, "target changed since the last sync", differences
+	}
+	return statusOutOfSync, "", differences
+}
@@ -0,0 +1,183 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"syscall"
+
+	"var-sync/internal/backend"
+	"var-sync/internal/parser"
+	"var-sync/internal/sync"
+	"var-sync/pkg/models"
+)
+
+// staleTarget is a target file a sync would modify, found by sync -check
+type staleTarget struct {
+	TargetFile string    `json:"target_file"`
+	Keys       []keyDiff `json:"keys"` // Empty when the file's content cannot be compared key by key
+}
+
+// failedRule is a rule sync -check could not resolve
+type failedRule struct {
+	RuleID   string `json:"rule_id"`
+	RuleName string `json:"rule_name"`
+	Error    string `json:"error"`
+}
+
+// syncCheck is the result of sync -check
+type syncCheck struct {
+	InSync  bool          `json:"in_sync"`
+	Targets []staleTarget `json:"targets"`
+	Failed  []failedRule  `json:"failed"`
+}
+
+// runSync previews a sync of every rule. With -dry-run it prints the diff of
+// each target a sync would modify, as the -dry-run option does. With -check
+// it prints the keys that differ instead and fails if any target is out of
+// sync or any rule cannot be resolved, so CI can block changes whose targets
+// were not synced. Targets are only written by watch mode.
+func runSync(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "sync")
+	check := fs.Bool("check", false, "Fail if any target is out of sync with its sources, listing the keys that differ")
+	dryRun := fs.Bool("dry-run", false, "Print a diff of what a sync would change")
+	asJSON := outputFlag(ctx, fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *check == *dryRun {
+		return fmt.Errorf("usage: var-sync sync -check|-dry-run (targets are written by var-sync -watch)")
+	}
+
+	// Interrupting the check cancels remote backend reads in progress
+	interrupted, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	syncer := sync.New(ctx.Config, ctx.Logger)
+
+	if *dryRun {
+		if *asJSON {
+			return syncer.DryRunJSONContext(interrupted, ctx.Stdout)
+		}
+		return syncer.DryRunContext(interrupted, ctx.Stdout)
+	}
+
+	changes, err := syncer.PlanContext(interrupted)
+	if err != nil {
+		return err
+	}
+	result := checkPlan(changes)
+
+	if *asJSON {
+		if err := writeJSON(ctx, result); err != nil {
+			return err
+		}
+	} else {
+		writeSyncCheck(ctx, result)
+	}
+
+	if !result.InSync {
+		return fmt.Errorf("%d targets out of sync, %d rules failing", len(result.Targets), len(result.Failed))
+	}
+	return nil
+}
+
+// checkPlan finds the targets a sync plan would modify, with the keys that
+// would change in each, and the rules that could not be resolved. Values are
+// masked for the keys written by a sensitive rule.
+func checkPlan(changes []sync.FileChange) syncCheck {
+	p := parser.New()
+	result := syncCheck{Targets: []staleTarget{}, Failed: []failedRule{}}
+	for _, change := range changes {
+		var secret []string // Target keys of sensitive rules
+		for _, key := range change.Keys {
+			if key.Sensitive {
+				secret = append(secret, key.TargetKey)
+			}
+			if key.Error != "" {
+				result.Failed = append(result.Failed, failedRule{RuleID: key.RuleID, RuleName: key.RuleName, Error: key.Error})
+			}
+		}
+		if !change.Changed() {
+			continue
+		}
+
+		target := staleTarget{TargetFile: change.TargetFile, Keys: []keyDiff{}}
+		before, beforeErr := parseTarget(p, change.TargetFile, change.Before)
+		after, afterErr := parseTarget(p, change.TargetFile, change.After)
+		if beforeErr == nil && afterErr == nil {
+			target.Keys = diffKeys(p, before, after)
+		}
+		for i := range target.Keys {
+			if slices.ContainsFunc(secret, func(targetKey string) bool { return writesKey(targetKey, target.Keys[i].Key) }) {
+				if target.Keys[i].Old != nil {
+					target.Keys[i].Old = models.RedactedValue
+				}
+				if target.Keys[i].New != nil {
+					target.Keys[i].New = models.RedactedValue
+				}
+			}
+		}
+		result.Targets = append(result.Targets, target)
+	}
+
+	result.InSync = len(result.Targets) == 0 && len(result.Failed) == 0
+	return result
+}
+
+// writesKey reports whether a rule writing targetKey may write key: the same
+// key or one below it, any key below a wildcard or array operation, and any
+// key at all for a JSONPath or a template, which has no target key
+func writesKey(targetKey, key string) bool {
+	if targetKey == "" || strings.HasPrefix(targetKey, "$") {
+		return true
+	}
+	if i := strings.IndexAny(targetKey, "*["); i >= 0 {
+		targetKey = strings.TrimSuffix(targetKey[:i], ".")
+	}
+	return key == targetKey || strings.HasPrefix(key, targetKey+".") || strings.HasPrefix(key, targetKey+"[")
+}
+
+// parseTarget parses the planned content of a target. Backend targets are
+// planned as JSON documents.
+func parseTarget(p *parser.Parser, target, content string) (map[string]any, error) {
+	if strings.TrimSpace(content) == "" {
+		return map[string]any{}, nil
+	}
+	format := models.DetectFormat(target)
+	if backend.IsRef(target) {
+		format = models.FormatJSON
+	}
+	return p.Parse(target, format, []byte(content))
+}
+
+// writeSyncCheck prints each target out of sync with the keys a sync would
+// change, then each rule that failed
+func writeSyncCheck(ctx *Context, result syncCheck) {
+	if result.InSync {
+		fmt.Fprintln(ctx.Stdout, "Every target is in sync.")
+		return
+	}
+
+	for _, target := range result.Targets {
+		fmt.Fprintf(ctx.Stdout, "%s is out of sync\n", target.TargetFile)
+		if len(target.Keys) == 0 {
+			fmt.Fprintln(ctx.Stdout, "    its content differs from what its rules would write")
+		}
+		for _, diff := range target.Keys {
+			switch diff.Change {
+			case "added":
+				fmt.Fprintf(ctx.Stdout, "    + %s: %s\n", diff.Key, formatValue(diff.New))
+			case "removed":
+				fmt.Fprintf(ctx.Stdout, "    - %s: %s\n", diff.Key, formatValue(diff.Old))
+			default:
+				fmt.Fprintf(ctx.Stdout, "    ~ %s: %s -> %s\n", diff.Key, formatValue(diff.Old), formatValue(diff.New))
+			}
+		}
+	}
+	for _, failed := range result.Failed {
+		fmt.Fprintf(ctx.Stdout, "rule %s (%s): %s\n", failed.RuleName, failed.RuleID, failed.Error)
+	}
+}
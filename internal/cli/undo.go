@@ -0,0 +1,79 @@
+package cli
+
+import (
+	"fmt"
+
+	"var-sync/internal/history"
+	"var-sync/internal/sync"
+	"var-sync/pkg/models"
+)
+
+// runUndo reverts a recorded sync event, either the one named by its ID (or
+// a unique prefix of it) or, with -last, the most recent revertible event
+func runUndo(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "undo")
+	last := fs.Bool("last", false, "Undo the most recent sync that has not been undone")
+	asJSON := outputFlag(ctx, fs)
+	positional, err := parseInterspersed(fs, args)
+	if err != nil {
+		return err
+	}
+
+	path := ctx.Config.HistoryPath()
+
+	var event models.SyncEvent
+	switch {
+	case *last && len(positional) > 0:
+		return fmt.Errorf("give either an event ID or -last, not both")
+	case *last:
+		events, err := history.Read(path, history.Filter{})
+		if err != nil {
+			return err
+		}
+		latest, ok := lastUndoable(events)
+		if !ok {
+			return fmt.Errorf("no sync events to undo")
+		}
+		event = latest
+	case len(positional) == 1:
+		found, err := history.Find(path, positional[0])
+		if err != nil {
+			return err
+		}
+		event = found
+	default:
+		return fmt.Errorf("usage: var-sync undo <event-id|-last>")
+	}
+
+	undo, err := sync.New(ctx.Config, ctx.Logger).Undo(event)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		// The event recorded for the undo, naming the event undone
+		return writeJSON(ctx, undo.Redacted())
+	}
+	fmt.Fprintf(ctx.Stdout, "Restored %s:%s to %v (undid %s)\n", undo.TargetFile, undo.TargetKey, undo.NewValue, event.ID)
+	return nil
+}
+
+// lastUndoable returns the newest successful event with a previous value that
+// is neither an undo itself nor already undone
+func lastUndoable(events []models.SyncEvent) (models.SyncEvent, bool) {
+	undone := make(map[string]bool)
+	for _, event := range events {
+		if event.UndoOf != "" {
+			undone[event.UndoOf] = true
+		}
+	}
+
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		if !event.Success || event.OldValue == nil || event.Sensitive || event.UndoOf != "" || undone[event.ID] {
+			continue
+		}
+		return event, true
+	}
+	return models.SyncEvent{}, false
+}
@@ -0,0 +1,190 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"var-sync/internal/backend"
+	"var-sync/internal/config"
+	"var-sync/internal/parser"
+	"var-sync/internal/watcher"
+	"var-sync/pkg/models"
+)
+
+// validationProblem is a single problem found by the validate command
+type validationProblem struct {
+	RuleID  string `json:"rule_id,omitempty"`
+	File    string `json:"file,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Message string `json:"message"`
+}
+
+// validationReport is the result of the validate command
+type validationReport struct {
+	Valid    bool                `json:"valid"`
+	Rules    int                 `json:"rules"`
+	Problems []validationProblem `json:"problems"`
+}
+
+// runValidate checks the config file and every rule in it: that each source
+// and target file exists and parses, that source key paths resolve, that rule
+// IDs are unique, that no two rules write the same target key and that no
+// rules sync into each other in a cycle. It prints a report and fails if
+// there are any problems.
+func runValidate(ctx *Context, args []string) error {
+	fs := newFlagSet(ctx, "validate")
+	asJSON := outputFlag(ctx, fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	report := validateConfig(ctx)
+
+	if *asJSON {
+		if err := writeJSON(ctx, report); err != nil {
+			return err
+		}
+	} else {
+		for _, problem := range report.Problems {
+			writeProblem(ctx, problem)
+		}
+		if report.Valid {
+			fmt.Fprintf(ctx.Stdout, "Config is valid: %d rules checked\n", report.Rules)
+		}
+	}
+
+	if !report.Valid {
+		return fmt.Errorf("config is invalid: %d problems found", len(report.Problems))
+	}
+	return nil
+}
+
+// validateConfig builds the validation report for the config
+func validateConfig(ctx *Context) validationReport {
+	report := validationReport{Problems: []validationProblem{}}
+	add := func(problem validationProblem) {
+		report.Problems = append(report.Problems, problem)
+	}
+
+	// The config passed in falls back to an empty one when the file does not
+	// load, so load it again to report why
+	cfg := ctx.Config
+	if ctx.ConfigPath != "" {
+		if _, err := os.Stat(ctx.ConfigPath); err != nil {
+			add(validationProblem{File: ctx.ConfigPath, Message: fmt.Sprintf("Config file not found: %v", err)})
+			return report
+		}
+		loaded, err := config.Load(ctx.ConfigPath)
+		if err != nil {
+			add(validationProblem{File: ctx.ConfigPath, Message: err.Error()})
+			return report
+		}
+		if profile := ctx.Config.Profile(); profile != "" {
+			if err := loaded.SelectProfile(profile); err != nil {
+				add(validationProblem{File: ctx.ConfigPath, Message: err.Error()})
+				return report
+			}
+		}
+		cfg = loaded
+	} else if err := config.Validate(cfg); err != nil {
+		add(validationProblem{Message: err.Error()})
+		return report
+	}
+	report.Rules = len(cfg.Rules)
+
+	seen := make(map[string]bool, len(cfg.Rules))
+	for _, rule := range cfg.Rules {
+		switch {
+		case rule.ID == "":
+			add(validationProblem{Message: fmt.Sprintf("Rule %q has no ID", rule.Name)})
+		case seen[rule.ID]:
+			add(validationProblem{RuleID: rule.ID, Message: "Duplicate rule ID"})
+		}
+		seen[rule.ID] = true
+	}
+
+	backends := backend.FromConfig(cfg)
+	p := parser.New()
+	files := make(map[string]map[string]any)
+	fileErrors := make(map[string]error)
+	load := func(location string) (map[string]any, error) {
+		if _, ok := files[location]; !ok && fileErrors[location] == nil {
+			files[location], fileErrors[location] = backends.Load(location)
+		}
+		return files[location], fileErrors[location]
+	}
+
+	// writers maps each target file and key to the first enabled rule
+	// writing it
+	type targetKey struct{ file, key string }
+	writers := make(map[targetKey]string)
+	var resolved []models.SyncRule
+
+	for _, original := range cfg.Rules {
+		rules, err := original.Expand()
+		if err != nil {
+			add(validationProblem{RuleID: original.ID, File: original.SourceFile, Message: err.Error()})
+			continue
+		}
+
+		for _, rule := range rules {
+			rule = backends.ResolveRule(rule)
+			resolved = append(resolved, rule)
+
+			targetKeys := []string{rule.TargetKey}
+			sourceData, err := load(rule.SourceFile)
+			if err != nil {
+				add(validationProblem{RuleID: rule.ID, File: rule.SourceFile, Message: fmt.Sprintf("Failed to load source file: %v", err)})
+			} else if updates, err := p.ResolveRule(sourceData, rule); err != nil {
+				add(validationProblem{RuleID: rule.ID, File: rule.SourceFile, Key: rule.SourceKey, Message: fmt.Sprintf("Source key does not resolve: %v", err)})
+			} else {
+				targetKeys = targetKeys[:0]
+				for key := range updates {
+					targetKeys = append(targetKeys, key)
+				}
+				sort.Strings(targetKeys)
+			}
+
+			if _, err := load(rule.TargetFile); err != nil {
+				add(validationProblem{RuleID: rule.ID, File: rule.TargetFile, Message: fmt.Sprintf("Failed to load target file: %v", err)})
+			}
+
+			if !rule.Enabled {
+				continue
+			}
+			for _, key := range targetKeys {
+				target := targetKey{rule.TargetFile, key}
+				if other, ok := writers[target]; ok && other != rule.ID {
+					add(validationProblem{RuleID: rule.ID, File: rule.TargetFile, Key: key, Message: fmt.Sprintf("Target key is also written by rule %s", other)})
+					continue
+				}
+				writers[target] = rule.ID
+			}
+		}
+	}
+
+	for _, cycle := range watcher.RuleCycles(resolved) {
+		add(validationProblem{Message: fmt.Sprintf("Rules sync into each other in a cycle: %s", cycle)})
+	}
+
+	report.Valid = len(report.Problems) == 0
+	return report
+}
+
+// writeProblem prints a validation problem on one line
+func writeProblem(ctx *Context, problem validationProblem) {
+	location := problem.File
+	if problem.Key != "" {
+		location += ":" + problem.Key
+	}
+
+	line := problem.Message
+	if location != "" {
+		line = location + ": " + line
+	}
+	if problem.RuleID != "" {
+		line = "rule " + problem.RuleID + ": " + line
+	}
+	fmt.Fprintln(ctx.Stdout, line)
+}
@@ -1,11 +1,18 @@
 package config
 
 import (
-	"encoding/json"
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"var-sync/internal/backend"
+	"var-sync/internal/logger"
+	"var-sync/internal/parser"
+	"var-sync/internal/render"
+	"var-sync/internal/schedule"
+	"var-sync/internal/schema"
+	"var-sync/internal/textfile"
 	"var-sync/pkg/models"
 )
 
@@ -16,9 +23,11 @@ type Manager struct {
 
 func New() *models.Config {
 	return &models.Config{
-		Rules:   make([]models.SyncRule, 0),
-		LogFile: "var-sync.log",
-		Debug:   false,
+		Rules:       make([]models.SyncRule, 0),
+		LogFile:     "var-sync.log",
+		HistoryFile: models.DefaultHistoryFile,
+		StateFile:   models.DefaultStateFile,
+		Debug:       false,
 	}
 }
 
@@ -31,17 +40,230 @@ func Load(configPath string) (*models.Config, error) {
 		return cfg, nil
 	}
 
-	data, err := os.ReadFile(configPath)
+	data, err := textfile.Read(configPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
-	var cfg models.Config
-	if err := json.Unmarshal(data, &cfg); err != nil {
+	cfg, err := Decode(data, models.DetectFormat(configPath))
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse config file: %w", err)
 	}
+	if err := loadIncludes(cfg, configPath); err != nil {
+		return nil, err
+	}
+	cfg.ExpandPaths()
+	if err := Validate(cfg); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks settings that parse but make no sense, such as an unknown
+// watch mode or a notifier without a URL
+func Validate(cfg *models.Config) error {
+	if !cfg.WatchMode.Valid() {
+		return fmt.Errorf("invalid watch_mode %q: use fsnotify or poll", cfg.WatchMode)
+	}
+	if cfg.Retry != nil && (cfg.Retry.MaxAttempts < 0 || cfg.Retry.Jitter < 0 || cfg.Retry.Jitter > 1) {
+		return fmt.Errorf("invalid retry policy: max_attempts cannot be negative and jitter must be between 0 and 1")
+	}
+	if cfg.Backup != nil && cfg.Backup.MaxVersions < 0 {
+		return fmt.Errorf("invalid backup max_versions %d: cannot be negative", cfg.Backup.MaxVersions)
+	}
+	if cfg.Debounce < 0 || cfg.BatchDelay < 0 || cfg.BatchMaxDelay < 0 {
+		return fmt.Errorf("invalid debounce, batch_delay or batch_max_delay: cannot be negative")
+	}
+	if cfg.ShutdownTimeout < 0 {
+		return fmt.Errorf("invalid shutdown_timeout: cannot be negative")
+	}
+	if cfg.TargetMinInterval < 0 {
+		return fmt.Errorf("invalid target_min_interval: cannot be negative")
+	}
+	if cfg.SelfWriteWindow < 0 {
+		return fmt.Errorf("invalid self_write_window: cannot be negative")
+	}
+	if cfg.TargetWorkers < 0 {
+		return fmt.Errorf("invalid target_workers %d: cannot be negative", cfg.TargetWorkers)
+	}
+	if cfg.EventQueue != nil {
+		if !cfg.EventQueue.Overflow.Valid() {
+			return fmt.Errorf("invalid event_queue overflow %q: use drop, block or spill", cfg.EventQueue.Overflow)
+		}
+		if cfg.EventQueue.Size < 0 || cfg.EventQueue.BlockTimeout < 0 {
+			return fmt.Errorf("invalid event_queue: size and block_timeout cannot be negative")
+		}
+	}
+	if !cfg.ConflictPolicy.Valid() {
+		return fmt.Errorf("invalid conflict_policy %q: use overwrite, skip or prompt-in-tui", cfg.ConflictPolicy)
+	}
+	for name, level := range cfg.LogLevels {
+		if _, err := logger.ParseLevel(level); err != nil {
+			return fmt.Errorf("invalid log level for %s: %w", name, err)
+		}
+	}
+	if err := validateHooks("global", cfg.OnSuccess, cfg.OnFailure); err != nil {
+		return err
+	}
+	for _, notifier := range cfg.Notifications {
+		if !notifier.Type.Valid() {
+			return fmt.Errorf("invalid notifier type %q: use slack, discord or webhook", notifier.Type)
+		}
+		if notifier.URL == "" {
+			return fmt.Errorf("invalid %s notifier: set a url", notifier.Type)
+		}
+		if notifier.MinSeverity.Rank() < 0 {
+			return fmt.Errorf("invalid min_severity %q: use info, warning or error", notifier.MinSeverity)
+		}
+	}
+	for target, schemaPath := range cfg.TargetSchemas() {
+		if backend.IsRef(target) {
+			return fmt.Errorf("invalid schema for %s: schemas apply to target files, not backends", target)
+		}
+		if _, err := schema.Load(schemaPath); err != nil {
+			return fmt.Errorf("invalid schema for %s: %w", target, err)
+		}
+	}
+	for _, rule := range cfg.Rules {
+		if !rule.OnConflict.Valid() {
+			return fmt.Errorf("invalid on_conflict %q for rule %s: use source-wins, target-wins, newest-wins or manual", rule.OnConflict, rule.ID)
+		}
+		if !rule.WatchMode.Valid() {
+			return fmt.Errorf("invalid watch_mode %q for rule %s: use fsnotify or poll", rule.WatchMode, rule.ID)
+		}
+		if !rule.Priority.Valid() {
+			return fmt.Errorf("invalid priority %q for rule %s: use normal or high", rule.Priority, rule.ID)
+		}
+		if !rule.TargetType.Valid() {
+			return fmt.Errorf("invalid target_type %q for rule %s: use string, int, float, bool or json", rule.TargetType, rule.ID)
+		}
+		if rule.MinInterval < 0 {
+			return fmt.Errorf("invalid min_interval for rule %s: cannot be negative", rule.ID)
+		}
+		if rule.BatchMaxDelay < 0 {
+			return fmt.Errorf("invalid batch_max_delay for rule %s: cannot be negative", rule.ID)
+		}
+		if err := validateHooks("rule "+rule.ID, rule.OnSuccess, rule.OnFailure); err != nil {
+			return err
+		}
+		if rule.IsGlob() {
+			if _, err := filepath.Match(rule.SourceFile, ""); err != nil {
+				return fmt.Errorf("invalid source_file pattern %q for rule %s: %w", rule.SourceFile, rule.ID, err)
+			}
+			targetKeys := rule.TargetKey
+			for _, mapping := range rule.Mappings {
+				targetKeys += mapping.TargetKey
+			}
+			if !strings.Contains(rule.TargetFile+targetKeys, "{{") {
+				return fmt.Errorf("invalid rule %s: a glob source_file needs a target_file or target_key template such as {{dir}}", rule.ID)
+			}
+		}
+		for _, name := range rule.ProfileVariables() {
+			if len(cfg.Profiles) == 0 {
+				return fmt.Errorf("invalid rule %s: it uses {{profile.%s}} but no profiles are configured", rule.ID, name)
+			}
+			for _, profile := range cfg.ProfileNames() {
+				if _, ok := cfg.Profiles[profile][name]; !ok {
+					return fmt.Errorf("invalid rule %s: profile %s does not set %s", rule.ID, profile, name)
+				}
+			}
+		}
+		if rule.SourceExpr != "" {
+			if rule.SourceKey != "" {
+				return fmt.Errorf("invalid rule %s: set source_key or source_expr, not both", rule.ID)
+			}
+			if err := parser.ValidateExpression(rule.SourceExpr); err != nil {
+				return fmt.Errorf("rule %s: %w", rule.ID, err)
+			}
+		}
+		if rule.When != "" {
+			if err := parser.ValidateExpression(rule.When); err != nil {
+				return fmt.Errorf("invalid when for rule %s: %w", rule.ID, err)
+			}
+		}
+		if err := validateKeys(rule.ID, rule.SourceKey, rule.TargetKey); err != nil {
+			return err
+		}
+		if len(rule.Mappings) > 0 {
+			if err := validateMappings(rule); err != nil {
+				return err
+			}
+		}
+		if rule.IsTemplate() {
+			if rule.TargetKey != "" || backend.IsRef(rule.TargetFile) {
+				return fmt.Errorf("invalid rule %s: a template renders a whole target file, so set a target_file without a target_key", rule.ID)
+			}
+			if _, err := render.Load(rule.Template); err != nil {
+				return fmt.Errorf("rule %s: %w", rule.ID, err)
+			}
+		}
+		if rule.Schedule != nil {
+			if _, err := schedule.Parse(rule.Schedule); err != nil {
+				return fmt.Errorf("rule %s: %w", rule.ID, err)
+			}
+		}
+	}
 
-	return &cfg, nil
+	return nil
+}
+
+// validateKeys checks the source and target key paths of a rule or mapping,
+// either of which may be empty
+func validateKeys(ruleID, sourceKey, targetKey string) error {
+	if parser.IsJSONPath(sourceKey) {
+		if err := parser.ValidateJSONPath(sourceKey); err != nil {
+			return fmt.Errorf("rule %s: %w", ruleID, err)
+		}
+	} else if sourceKey != "" {
+		if _, err := parser.ParseKeyPath(sourceKey); err != nil {
+			return fmt.Errorf("invalid source_key for rule %s: %w", ruleID, err)
+		}
+	}
+	if parser.IsJSONPath(targetKey) {
+		return fmt.Errorf("invalid target_key %q for rule %s: JSONPath is only supported for source keys", targetKey, ruleID)
+	}
+	if targetKey != "" {
+		if _, err := parser.ParseKeyPath(targetKey); err != nil {
+			return fmt.Errorf("invalid target_key for rule %s: %w", ruleID, err)
+		}
+	}
+	return nil
+}
+
+// validateMappings checks the mappings of a multi-key rule: each names a
+// source and a target key, no two write the same target key, and the rule
+// syncs no other value
+func validateMappings(rule models.SyncRule) error {
+	if rule.SourceKey != "" || rule.TargetKey != "" || rule.SourceExpr != "" || rule.IsTemplate() {
+		return fmt.Errorf("invalid rule %s: set mappings or source_key and target_key, not both", rule.ID)
+	}
+	targets := make(map[string]bool, len(rule.Mappings))
+	for _, mapping := range rule.Mappings {
+		if mapping.SourceKey == "" || mapping.TargetKey == "" {
+			return fmt.Errorf("invalid mapping for rule %s: set a source_key and a target_key", rule.ID)
+		}
+		if err := validateKeys(rule.ID, mapping.SourceKey, mapping.TargetKey); err != nil {
+			return err
+		}
+		if targets[mapping.TargetKey] {
+			return fmt.Errorf("invalid rule %s: more than one mapping writes target_key %s", rule.ID, mapping.TargetKey)
+		}
+		targets[mapping.TargetKey] = true
+	}
+	return nil
+}
+
+// validateHooks checks that every hook has something to run
+func validateHooks(owner string, lists ...[]models.Hook) error {
+	for _, hooks := range lists {
+		for _, hook := range hooks {
+			if hook.Command == "" && hook.URL == "" {
+				return fmt.Errorf("invalid %s hook: set a command or url", owner)
+			}
+		}
+	}
+	return nil
 }
 
 func Save(cfg *models.Config, configPath string) error {
@@ -49,16 +271,17 @@ func Save(cfg *models.Config, configPath string) error {
 		return fmt.Errorf("failed to create config directory: %w", err)
 	}
 
-	data, err := json.MarshalIndent(cfg, "", "  ")
+	main, included := split(cfg)
+	data, err := encode(main, models.DetectFormat(configPath))
 	if err != nil {
-		return fmt.Errorf("failed to marshal config: %w", err)
+		return err
 	}
 
-	if err := os.WriteFile(configPath, data, 0644); err != nil {
+	if err := textfile.Write(configPath, data); err != nil {
 		return fmt.Errorf("failed to write config file: %w", err)
 	}
 
-	return nil
+	return saveIncludes(cfg, included)
 }
 
 func NewManager(configPath string) (*Manager, error) {
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -220,6 +221,101 @@ func TestLoadInvalidJSON(t *testing.T) {
 	}
 }
 
+func TestLoadInvalidConflictPolicy(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"rules": [], "conflict_policy": "sometimes"}`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if _, err := Load(configPath); err == nil {
+		t.Error("Load() should return error for an unknown conflict policy")
+	}
+}
+
+func TestLoadInvalidRuleConflictStrategy(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"rules": [{"id": "r1", "on_conflict": "loudest-wins"}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if _, err := Load(configPath); err == nil {
+		t.Error("Load() should return error for an unknown on_conflict strategy")
+	}
+}
+
+func TestLoadEmptyHook(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(configPath, []byte(`{"rules": [{"id": "r1", "on_success": [{"timeout": "5s"}]}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	if _, err := Load(configPath); err == nil {
+		t.Error("Load() should return error for a hook with neither command nor url")
+	}
+}
+
+func TestLoadInvalidSettings(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"unknown type", `{"notifications": [{"type": "pager", "url": "https://example.com"}]}`},
+		{"missing url", `{"notifications": [{"type": "slack"}]}`},
+		{"unknown severity", `{"notifications": [{"type": "slack", "url": "https://example.com", "min_severity": "loud"}]}`},
+		{"unknown priority", `{"rules": [{"id": "r1", "priority": "urgent"}]}`},
+		{"unknown watch mode", `{"watch_mode": "inotify"}`},
+		{"unknown rule watch mode", `{"rules": [{"id": "r1", "watch_mode": "sometimes"}]}`},
+		{"glob without target template", `{"rules": [{"id": "r1", "source_file": "services/*/config.yaml", "target_file": "all.env"}]}`},
+		{"bad glob pattern", `{"rules": [{"id": "r1", "source_file": "services/[/config.yaml", "target_file": "{{dir}}/generated.env"}]}`},
+		{"retry jitter above 1", `{"retry": {"jitter": 1.5}}`},
+		{"unknown log level", `{"log_levels": {"watcher": "chatty"}}`},
+		{"bad schedule window", `{"rules": [{"id": "r1", "schedule": {"include": ["Someday 02:00-04:00"]}}]}`},
+		{"cron without duration", `{"rules": [{"id": "r1", "schedule": {"cron": "0 2 * * *"}}]}`},
+		{"unknown schedule policy", `{"rules": [{"id": "r1", "schedule": {"outside": "drop"}}]}`},
+		{"negative backup versions", `{"backup": {"enabled": true, "max_versions": -1}}`},
+		{"negative debounce", `{"debounce": "-1s"}`},
+		{"negative batch max delay", `{"batch_max_delay": "-2s"}`},
+		{"negative rule batch max delay", `{"rules": [{"id": "r1", "batch_max_delay": "-2s"}]}`},
+		{"negative shutdown timeout", `{"shutdown_timeout": "-1s"}`},
+		{"negative target min interval", `{"target_min_interval": "-1s"}`},
+		{"negative target workers", `{"target_workers": -1}`},
+		{"negative rule min interval", `{"rules": [{"id": "r1", "min_interval": "-30s"}]}`},
+		{"unknown target type", `{"rules": [{"id": "r1", "target_type": "decimal"}]}`},
+		{"recursive JSONPath source key", `{"rules": [{"id": "r1", "source_key": "$..port"}]}`},
+		{"JSONPath target key", `{"rules": [{"id": "r1", "target_key": "$.port"}]}`},
+		{"bad source key index", `{"rules": [{"id": "r1", "source_key": "servers[x].host"}]}`},
+		{"unclosed target key quote", `{"rules": [{"id": "r1", "target_key": "hosts.\"example.com"}]}`},
+		{"unknown event queue overflow", `{"event_queue": {"overflow": "grow"}}`},
+		{"negative event queue size", `{"event_queue": {"size": -1}}`},
+		{"profile variable without profiles", `{"rules": [{"id": "r1", "source_key": "{{profile.db_key}}"}]}`},
+		{"profile variable not set", `{"profiles": {"dev": {"db_key": "a"}, "prod": {}}, "rules": [{"id": "r1", "source_key": "{{profile.db_key}}"}]}`},
+		{"missing schema", `{"schemas": {"app.json": "does-not-exist.schema.json"}}`},
+		{"CUE schema", `{"schemas": {"app.json": "app.cue"}}`},
+		{"schema for backend", `{"schemas": {"env://APP": "app.schema.json"}}`},
+		{"source key and expression", `{"rules": [{"id": "r1", "source_key": "port", "source_expr": "port + 1"}]}`},
+		{"invalid source expression", `{"rules": [{"id": "r1", "source_expr": "(api.timeout * 1000"}]}`},
+		{"invalid when", `{"rules": [{"id": "r1", "when": "source.env = 'production'"}]}`},
+		{"missing template", `{"rules": [{"id": "r1", "target_file": "app.conf", "template": "does-not-exist.tmpl"}]}`},
+		{"template with target key", `{"rules": [{"id": "r1", "target_file": "app.conf", "target_key": "host", "template": "app.tmpl"}]}`},
+		{"mappings and source key", `{"rules": [{"id": "r1", "source_key": "host", "mappings": [{"source_key": "port", "target_key": "PORT"}]}]}`},
+		{"mapping without target key", `{"rules": [{"id": "r1", "mappings": [{"source_key": "port"}]}]}`},
+		{"mappings writing one target key", `{"rules": [{"id": "r1", "mappings": [{"source_key": "a", "target_key": "X"}, {"source_key": "b", "target_key": "X"}]}]}`},
+		{"bad mapping source key", `{"rules": [{"id": "r1", "mappings": [{"source_key": "servers[x].host", "target_key": "HOST"}]}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.json")
+			if err := os.WriteFile(configPath, []byte(tt.config), 0644); err != nil {
+				t.Fatalf("Failed to write config: %v", err)
+			}
+			if _, err := Load(configPath); err == nil {
+				t.Error("Load() should return error")
+			}
+		})
+	}
+}
+
 func TestSaveWithMissingDirectory(t *testing.T) {
 	tempDir := t.TempDir()
 	configPath := filepath.Join(tempDir, "missing", "dir", "config.json")
@@ -233,4 +329,135 @@ func TestSaveWithMissingDirectory(t *testing.T) {
 	if _, err := os.Stat(configPath); os.IsNotExist(err) {
 		t.Error("Config file was not created in missing directory")
 	}
-}
\ No newline at end of file
+}
+
+func TestSaveLoadFormats(t *testing.T) {
+	backup := false
+	cfg := New()
+	cfg.Debounce = models.Duration(250 * time.Millisecond)
+	cfg.Backup = &models.BackupConfig{Enabled: true, MaxVersions: 5}
+	cfg.Rules = []models.SyncRule{{
+		ID:         "db-host",
+		Name:       "Database Host",
+		SourceFile: "config.yaml",
+		SourceKey:  "database.host",
+		TargetFile: "app.env",
+		TargetKey:  "DB_HOST",
+		Enabled:    true,
+		Tags:       []string{"env:prod", "true"},
+		Backup:     &backup,
+		Created:    time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}}
+
+	for _, name := range []string{"var-sync.yaml", "var-sync.toml"} {
+		t.Run(name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), name)
+			if err := Save(cfg, configPath); err != nil {
+				t.Fatalf("Save() returned error: %v", err)
+			}
+
+			loaded, err := Load(configPath)
+			if err != nil {
+				data, _ := os.ReadFile(configPath)
+				t.Fatalf("Load() returned error: %v\n%s", err, data)
+			}
+			if loaded.Debounce != cfg.Debounce || loaded.Backup == nil || loaded.Backup.MaxVersions != 5 {
+				t.Errorf("Settings not kept: debounce %v, backup %+v", loaded.Debounce, loaded.Backup)
+			}
+			if len(loaded.Rules) != 1 {
+				t.Fatalf("Expected 1 rule, got %d", len(loaded.Rules))
+			}
+			rule := loaded.Rules[0]
+			if rule.TargetKey != "DB_HOST" || len(rule.Tags) != 2 || rule.Tags[1] != "true" || rule.Backup == nil || *rule.Backup || !rule.Created.Equal(cfg.Rules[0].Created) {
+				t.Errorf("Rule not kept: %+v", rule)
+			}
+		})
+	}
+}
+
+func TestLoadExpandsPaths(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("VAR_SYNC_DIR", tempDir)
+	configPath := filepath.Join(tempDir, "config.json")
+	content := `{"log_file": "${VAR_SYNC_DIR}/var-sync.log", "rules": [{"id": "r1", "source_file": "$VAR_SYNC_DIR/source.yaml", "target_file": "target.env"}]}`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if cfg.LogFile != filepath.Join(tempDir, "var-sync.log") || cfg.Rules[0].SourceFile != filepath.Join(tempDir, "source.yaml") {
+		t.Errorf("Paths not expanded: %s, %s", cfg.LogFile, cfg.Rules[0].SourceFile)
+	}
+
+	// Saving keeps the variables rather than this machine's paths
+	cfg.Debug = true
+	if err := Save(cfg, configPath); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+	saved, err := os.ReadFile(configPath)
+	if err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	if !strings.Contains(string(saved), `"${VAR_SYNC_DIR}/var-sync.log"`) || !strings.Contains(string(saved), `"$VAR_SYNC_DIR/source.yaml"`) {
+		t.Errorf("Saved config should keep the variables:\n%s", saved)
+	}
+}
+
+func TestLoadIncludes(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "var-sync.json")
+	rulesDir := filepath.Join(tempDir, "rules")
+	if err := os.MkdirAll(rulesDir, 0755); err != nil {
+		t.Fatalf("Failed to create rules directory: %v", err)
+	}
+	files := map[string]string{
+		configPath: `{"include": ["rules/*"], "rules": [{"id": "main", "name": "Main"}]}`,
+		filepath.Join(rulesDir, "auth.yaml"):    "rules:\n  - id: auth\n    name: Auth\n",
+		filepath.Join(rulesDir, "billing.toml"): "[[rules]]\nid = \"billing\"\nname = \"Billing\"\n",
+	}
+	for file, content := range files {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", file, err)
+		}
+	}
+
+	cfg, err := Load(configPath)
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if len(cfg.Rules) != 3 || cfg.Rules[1].ID != "auth" || cfg.Rules[2].ID != "billing" {
+		t.Fatalf("Expected the main rule and both included rules, got %+v", cfg.Rules)
+	}
+	if cfg.IncludedFrom("auth") != filepath.Join(rulesDir, "auth.yaml") || cfg.IncludedFrom("main") != "" {
+		t.Errorf("IncludedFrom() = %q, %q", cfg.IncludedFrom("auth"), cfg.IncludedFrom("main"))
+	}
+
+	// Included rules are saved to their own file, and only if changed
+	cfg.Rules[1].Name = "Auth Service"
+	if err := Save(cfg, configPath); err != nil {
+		t.Fatalf("Save() returned error: %v", err)
+	}
+	mainContent, _ := os.ReadFile(configPath)
+	if strings.Contains(string(mainContent), "auth") {
+		t.Errorf("Main config should not contain included rules:\n%s", mainContent)
+	}
+	authContent, _ := os.ReadFile(filepath.Join(rulesDir, "auth.yaml"))
+	if !strings.Contains(string(authContent), "Auth Service") {
+		t.Errorf("Included file should have the changed rule:\n%s", authContent)
+	}
+	billingContent, _ := os.ReadFile(filepath.Join(rulesDir, "billing.toml"))
+	if string(billingContent) != files[filepath.Join(rulesDir, "billing.toml")] {
+		t.Errorf("Unchanged included file was rewritten:\n%s", billingContent)
+	}
+
+	// Rule IDs must be unique across all files
+	if err := os.WriteFile(filepath.Join(rulesDir, "copy.json"), []byte(`{"rules": [{"id": "billing"}]}`), 0644); err != nil {
+		t.Fatalf("Failed to write duplicate: %v", err)
+	}
+	if _, err := Load(configPath); err == nil || !strings.Contains(err.Error(), "duplicate rule ID billing") {
+		t.Errorf("Load() error = %v, want a duplicate rule ID error", err)
+	}
+}
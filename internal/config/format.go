@@ -0,0 +1,171 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"var-sync/pkg/models"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config files are JSON, YAML or TOML. The config is always converted through
+// JSON, so the json field names and value formats, such as "30s" durations,
+// are the same in every format.
+
+// Encode writes a config as JSON, YAML or TOML, keeping the field order of
+// the JSON form where the format allows. Paths expanded when the config was
+// loaded are written as they were, and rules read from included files are
+// left out.
+func Encode(cfg *models.Config, format models.FileFormat) ([]byte, error) {
+	main, _ := split(cfg)
+	return encode(main, format)
+}
+
+// split separates the config to save from the rules of each included file
+func split(cfg *models.Config) (*models.Config, map[string][]models.SyncRule) {
+	written := cfg.WrittenPaths()
+	main := *written
+	main.Rules = make([]models.SyncRule, 0, len(written.Rules))
+	included := make(map[string][]models.SyncRule)
+	for _, rule := range written.Rules {
+		if file := cfg.IncludedFrom(rule.ID); file != "" {
+			included[file] = append(included[file], rule)
+		} else {
+			main.Rules = append(main.Rules, rule)
+		}
+	}
+	return &main, included
+}
+
+// encode writes any value as JSON, YAML or TOML through its JSON form
+func encode(value any, format models.FileFormat) ([]byte, error) {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+
+	switch format {
+	case models.FormatJSON:
+		return data, nil
+	case models.FormatYAML:
+		// JSON is YAML, so decode it into nodes to keep the field order and
+		// write them back in block style
+		var node yaml.Node
+		if err := yaml.Unmarshal(data, &node); err != nil {
+			return nil, fmt.Errorf("failed to marshal config as YAML: %w", err)
+		}
+		blockStyle(&node)
+		var buf bytes.Buffer
+		encoder := yaml.NewEncoder(&buf)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(&node); err != nil {
+			return nil, fmt.Errorf("failed to marshal config as YAML: %w", err)
+		}
+		return buf.Bytes(), nil
+	case models.FormatTOML:
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		var doc map[string]any
+		if err := decoder.Decode(&doc); err != nil {
+			return nil, fmt.Errorf("failed to marshal config as TOML: %w", err)
+		}
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(tomlValue(doc)); err != nil {
+			return nil, fmt.Errorf("failed to marshal config as TOML: %w", err)
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unsupported config format %s: use json, yaml or toml", format)
+}
+
+// Decode reads a config written as JSON, YAML or TOML. It does not validate
+// the config.
+func Decode(data []byte, format models.FileFormat) (*models.Config, error) {
+	switch format {
+	case models.FormatJSON:
+	case models.FormatYAML:
+		var doc any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		converted, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	case models.FormatTOML:
+		var doc map[string]any
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, err
+		}
+		converted, err := json.Marshal(doc)
+		if err != nil {
+			return nil, err
+		}
+		data = converted
+	default:
+		return nil, fmt.Errorf("unsupported config format %s: use json, yaml or toml", format)
+	}
+
+	var cfg models.Config
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// ParseFormat returns the config format with the given name
+func ParseFormat(name string) (models.FileFormat, error) {
+	switch strings.ToLower(name) {
+	case "json":
+		return models.FormatJSON, nil
+	case "yaml", "yml":
+		return models.FormatYAML, nil
+	case "toml":
+		return models.FormatTOML, nil
+	}
+	return "", fmt.Errorf("invalid format %q: use json, yaml or toml", name)
+}
+
+// blockStyle clears the flow and quoting styles of decoded JSON, leaving the
+// encoder to quote only the strings that need it
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
+
+// tomlValue prepares a decoded JSON value for the TOML encoder, which has no
+// null and needs integers kept apart from floats
+func tomlValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			if item != nil {
+				result[key] = tomlValue(item)
+			}
+		}
+		return result
+	case []any:
+		result := make([]any, 0, len(v))
+		for _, item := range v {
+			if item != nil {
+				result = append(result, tomlValue(item))
+			}
+		}
+		return result
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	}
+	return value
+}
@@ -0,0 +1,93 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"var-sync/internal/textfile"
+	"var-sync/pkg/models"
+)
+
+// fragment is an included file: a list of rules in any config format
+type fragment struct {
+	Rules []models.SyncRule `json:"rules"`
+}
+
+// loadIncludes adds the rules of every file matching the config's include
+// patterns, which are relative to the directory of the config file. A
+// pattern without wildcards must name an existing file.
+func loadIncludes(cfg *models.Config, configPath string) error {
+	for _, pattern := range cfg.Include {
+		pattern = models.ExpandPath(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(configPath), pattern)
+		}
+
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			return fmt.Errorf("invalid include pattern %q: %w", pattern, err)
+		}
+		if len(files) == 0 && !strings.ContainsAny(pattern, "*?[") {
+			return fmt.Errorf("included file %s does not exist", pattern)
+		}
+
+		for _, file := range files {
+			rules, err := readFragment(file)
+			if err != nil {
+				return err
+			}
+			if err := cfg.AddIncluded(file, rules); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// readFragment reads the rules of an included file
+func readFragment(file string) ([]models.SyncRule, error) {
+	data, err := textfile.Read(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read included file: %w", err)
+	}
+	included, err := Decode(data, models.DetectFormat(file))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse included file %s: %w", file, err)
+	}
+	return included.Rules, nil
+}
+
+// saveIncludes writes back the included files whose rules were changed,
+// added to or removed since they were read
+func saveIncludes(cfg *models.Config, included map[string][]models.SyncRule) error {
+	for _, file := range cfg.IncludedFiles() {
+		rules := included[file]
+		if rules == nil {
+			rules = []models.SyncRule{}
+		}
+
+		current, err := readFragment(file)
+		if err == nil {
+			if current == nil {
+				current = []models.SyncRule{}
+			}
+			before, _ := json.Marshal(current)
+			after, _ := json.Marshal(rules)
+			if bytes.Equal(before, after) {
+				continue
+			}
+		}
+
+		data, err := encode(fragment{Rules: rules}, models.DetectFormat(file))
+		if err != nil {
+			return err
+		}
+		if err := textfile.Write(file, data); err != nil {
+			return fmt.Errorf("failed to write included file: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,154 @@
+package control
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"var-sync/internal/logger"
+	"var-sync/pkg/models"
+)
+
+// Client calls the control API of a var-sync watching a config
+type Client struct {
+	path   string
+	client *http.Client
+}
+
+// Dial returns a client for the control socket at path. Nothing is
+// connected until a method is called.
+func Dial(path string) *Client {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}
+	return &Client{path: path, client: &http.Client{Transport: transport}}
+}
+
+// Rules returns every rule of the running var-sync and whether it is paused
+func (c *Client) Rules(ctx context.Context) ([]Rule, error) {
+	var rules []Rule
+	err := c.call(ctx, http.MethodGet, "/rules", nil, &rules)
+	return rules, err
+}
+
+// SetRules replaces the rules of the running var-sync, which saves them to
+// its config file, and returns them as it now has them
+func (c *Client) SetRules(ctx context.Context, rules []models.SyncRule) ([]Rule, error) {
+	var updated []Rule
+	err := c.call(ctx, http.MethodPut, "/rules", rules, &updated)
+	return updated, err
+}
+
+// Sync syncs the rules with the given IDs now, or every rule if none are
+// given, and returns how many rules were batched
+func (c *Client) Sync(ctx context.Context, ruleIDs ...string) (int, error) {
+	query := url.Values{"rule": ruleIDs}
+	var result SyncResult
+	err := c.call(ctx, http.MethodPost, "/sync?"+query.Encode(), nil, &result)
+	return result.Rules, err
+}
+
+// Pause stops syncing a rule until it is resumed
+func (c *Client) Pause(ctx context.Context, ruleID string) error {
+	return c.call(ctx, http.MethodPost, "/rules/"+url.PathEscape(ruleID)+"/pause", nil, &Rule{})
+}
+
+// Resume syncs a paused rule again
+func (c *Client) Resume(ctx context.Context, ruleID string) error {
+	return c.call(ctx, http.MethodPost, "/rules/"+url.PathEscape(ruleID)+"/resume", nil, &Rule{})
+}
+
+// Events calls fn with every sync event of the running var-sync until ctx is
+// done, which ends it without error, or the connection is lost
+func (c *Client) Events(ctx context.Context, fn func(models.SyncEvent)) error {
+	return follow(ctx, c, "/events", fn)
+}
+
+// Logs calls fn with every line the running var-sync logs, like Events
+func (c *Client) Logs(ctx context.Context, fn func(logger.Entry)) error {
+	return follow(ctx, c, "/logs", fn)
+}
+
+// follow calls fn with every value streamed from path until ctx is done or
+// the connection is lost
+func follow[T any](ctx context.Context, c *Client, path string, fn func(T)) error {
+	resp, err := c.send(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(resp.Body))
+	for {
+		var value T
+		if err := decoder.Decode(&value); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("var-sync stopped")
+			}
+			return fmt.Errorf("failed to read %s stream: %w", strings.TrimPrefix(path, "/"), err)
+		}
+		fn(value)
+	}
+}
+
+// call sends a request with body as JSON, unless it is nil, and decodes its
+// JSON response into response
+func (c *Client) call(ctx context.Context, method, path string, body, response any) error {
+	resp, err := c.send(ctx, method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(response); err != nil {
+		return fmt.Errorf("failed to parse control response: %w", err)
+	}
+	return nil
+}
+
+// send sends a request with body as JSON, unless it is nil, turning error
+// responses into errors
+func (c *Client) send(ctx context.Context, method, path string, body any) (*http.Response, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode control request: %w", err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "http://var-sync"+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create control request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach var-sync at %s: %w", c.path, err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		var failure errorBody
+		if err := json.NewDecoder(resp.Body).Decode(&failure); err != nil || failure.Error == "" {
+			return nil, fmt.Errorf("var-sync returned %s", resp.Status)
+		}
+		return nil, errors.New(failure.Error)
+	}
+	return resp, nil
+}
@@ -0,0 +1,277 @@
+package control
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"sync"
+
+	"var-sync/internal/logger"
+	"var-sync/internal/watcher"
+	"var-sync/pkg/models"
+)
+
+// Server controls a running watcher over a local unix socket, so that the TUI
+// and scripts can work with a long-running var-sync instead of starting their
+// own. It answers JSON over HTTP:
+//
+//	GET  /rules              every rule and whether it is paused
+//	PUT  /rules              replace the rules, saving them to the config file
+//	POST /sync               sync every rule now, or the rules named by ?rule=
+//	POST /rules/{id}/pause   stop syncing a rule until it is resumed
+//	POST /rules/{id}/resume  sync a paused rule again
+//	GET  /events             stream sync events as they happen, one per line
+//	GET  /logs               stream logged lines as they happen, one per line
+type Server struct {
+	watcher *watcher.FileWatcher
+	logger  *logger.Logger
+	server  *http.Server
+	path    string
+	edit    func(rules []models.SyncRule) error // Applies and saves edited rules, if they can be edited
+	events  feed[models.SyncEvent]
+	logs    feed[logger.Entry]
+}
+
+// Rule is a configured rule and whether it is paused
+type Rule struct {
+	models.SyncRule
+	Paused bool `json:"paused"`
+}
+
+// SyncResult is the body of a /sync response
+type SyncResult struct {
+	Rules int `json:"rules"` // How many rules were batched, counting each file a glob rule matches
+}
+
+// errorBody is the body of a failed response
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+// feed passes values on to every streaming client subscribed to it
+type feed[T any] struct {
+	subscribers map[chan T]bool
+	mutex       sync.Mutex
+}
+
+// subscriberBuffer is how many events or lines a slow streaming client may
+// fall behind before they are dropped for it
+const subscriberBuffer = 100
+
+// New creates a server controlling fw
+func New(fw *watcher.FileWatcher, logger *logger.Logger) *Server {
+	return &Server{
+		watcher: fw,
+		logger:  logger.Module("control"),
+	}
+}
+
+// SetRuleEditor lets clients replace the rules, which edit checks, applies
+// and saves to the config file. Without it, rules cannot be edited.
+func (s *Server) SetRuleEditor(edit func(rules []models.SyncRule) error) {
+	s.edit = edit
+}
+
+// Handler returns the HTTP handler serving the API
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /rules", s.rules)
+	mux.HandleFunc("PUT /rules", s.setRules)
+	mux.HandleFunc("POST /sync", s.sync)
+	mux.HandleFunc("POST /rules/{id}/pause", s.pause)
+	mux.HandleFunc("POST /rules/{id}/resume", s.resume)
+	mux.HandleFunc("GET /events", s.events.stream)
+	mux.HandleFunc("GET /logs", s.logs.stream)
+	return mux
+}
+
+// Listen serves the API on a unix socket at path until Close is called. Only
+// the user running var-sync may connect; on Windows, only those the socket's
+// directory lets in. A socket left behind by a process that has exited is
+// replaced.
+func (s *Server) Listen(path string) error {
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return fmt.Errorf("control socket %s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return fmt.Errorf("failed to replace control socket %s: %w", path, err)
+		}
+	}
+
+	listener, err := listenSocket(path)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+
+	s.path = path
+	s.server = &http.Server{Handler: s.Handler()}
+	go func() {
+		if err := s.server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("Control socket %s stopped: %v", path, err)
+		}
+	}()
+	return nil
+}
+
+// Close stops serving, ending any event streams, and removes the socket
+func (s *Server) Close() error {
+	if s.server == nil {
+		return nil
+	}
+	err := s.server.Close()
+	os.Remove(s.path)
+	return err
+}
+
+// Record passes a sync event on to every /events client, dropping it for a
+// client that has fallen behind rather than holding up the watcher
+func (s *Server) Record(event models.SyncEvent) {
+	s.events.send(event.Redacted())
+}
+
+// RecordLog passes a logged line on to every /logs client, like Record
+func (s *Server) RecordLog(entry logger.Entry) {
+	s.logs.send(entry)
+}
+
+// rules lists every configured rule
+func (s *Server) rules(w http.ResponseWriter, r *http.Request) {
+	configured := s.watcher.Rules()
+	rules := make([]Rule, 0, len(configured))
+	for _, rule := range configured {
+		rules = append(rules, Rule{SyncRule: rule, Paused: s.watcher.IsPaused(rule.ID)})
+	}
+	writeJSON(w, http.StatusOK, rules)
+}
+
+// setRules replaces the rules with those in the request body
+func (s *Server) setRules(w http.ResponseWriter, r *http.Request) {
+	if s.edit == nil {
+		writeJSON(w, http.StatusNotImplemented, errorBody{Error: "rules cannot be edited through this var-sync"})
+		return
+	}
+
+	var rules []models.SyncRule
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorBody{Error: fmt.Sprintf("invalid rules: %v", err)})
+		return
+	}
+	if err := s.edit(rules); err != nil {
+		writeError(w, err)
+		return
+	}
+	s.rules(w, r)
+}
+
+// sync batches the rules named by the rule query parameter, or every rule
+func (s *Server) sync(w http.ResponseWriter, r *http.Request) {
+	count, err := s.watcher.Sync(r.URL.Query()["rule"]...)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, SyncResult{Rules: count})
+}
+
+// pause pauses the rule named in the path
+func (s *Server) pause(w http.ResponseWriter, r *http.Request) {
+	if err := s.watcher.Pause(r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.rule(r.PathValue("id")))
+}
+
+// resume resumes the rule named in the path
+func (s *Server) resume(w http.ResponseWriter, r *http.Request) {
+	if err := s.watcher.Resume(r.PathValue("id")); err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, s.rule(r.PathValue("id")))
+}
+
+// rule returns the configured rule with the given ID
+func (s *Server) rule(id string) Rule {
+	for _, rule := range s.watcher.Rules() {
+		if rule.ID == id {
+			return Rule{SyncRule: rule, Paused: s.watcher.IsPaused(id)}
+		}
+	}
+	return Rule{SyncRule: models.SyncRule{ID: id}, Paused: s.watcher.IsPaused(id)}
+}
+
+// send passes value on to every subscriber, dropping it for one that has
+// fallen behind rather than holding up the watcher or logger
+func (f *feed[T]) send(value T) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	for values := range f.subscribers {
+		select {
+		case values <- value:
+		default:
+		}
+	}
+}
+
+// stream sends values as JSON lines until the client goes away
+func (f *feed[T]) stream(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeJSON(w, http.StatusInternalServerError, errorBody{Error: "streaming is not supported"})
+		return
+	}
+
+	values := make(chan T, subscriberBuffer)
+	f.mutex.Lock()
+	if f.subscribers == nil {
+		f.subscribers = make(map[chan T]bool)
+	}
+	f.subscribers[values] = true
+	f.mutex.Unlock()
+	defer func() {
+		f.mutex.Lock()
+		delete(f.subscribers, values)
+		f.mutex.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	encoder := json.NewEncoder(w)
+	for {
+		select {
+		case value := <-values:
+			if err := encoder.Encode(value); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// writeError answers with err, as not found for unknown rules
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusConflict
+	if errors.Is(err, watcher.ErrRuleNotFound) {
+		code = http.StatusNotFound
+	}
+	writeJSON(w, code, errorBody{Error: err.Error()})
+}
+
+// writeJSON writes body as an indented JSON response
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(body)
+}
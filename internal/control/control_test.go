@@ -0,0 +1,174 @@
+package control
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"var-sync/internal/logger"
+	"var-sync/internal/watcher"
+	"var-sync/pkg/models"
+)
+
+func TestServer(t *testing.T) {
+	dir := t.TempDir()
+	sourceFile := filepath.Join(dir, "source.yaml")
+	targetFile := filepath.Join(dir, "target.env")
+	if err := os.WriteFile(sourceFile, []byte("host: db\n"), 0644); err != nil {
+		t.Fatalf("Failed to write source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("HOST=old\n"), 0644); err != nil {
+		t.Fatalf("Failed to write target file: %v", err)
+	}
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("watcher.New() error = %v", err)
+	}
+	fw.SetBatchDelay(10 * time.Millisecond)
+	fw.SetRules([]models.SyncRule{
+		{ID: "host", Name: "Host", SourceFile: sourceFile, SourceKey: "host", TargetFile: targetFile, TargetKey: "HOST", Enabled: true},
+		{ID: "off", SourceFile: sourceFile, SourceKey: "host", TargetFile: targetFile, TargetKey: "OFF", Enabled: false},
+	})
+	fw.Start()
+	defer fw.Stop()
+
+	server := New(fw, logger.New())
+	fw.OnEvent(server.Record)
+	socket := filepath.Join(dir, "var-sync.sock")
+	if err := server.Listen(socket); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer server.Close()
+	if info, err := os.Stat(socket); err != nil {
+		t.Errorf("Failed to stat control socket: %v", err)
+	} else if runtime.GOOS != "windows" && info.Mode().Perm()&0o077 != 0 {
+		t.Errorf("Control socket mode = %v, want it closed to other users", info.Mode())
+	}
+	if err := New(fw, logger.New()).Listen(socket); err == nil {
+		t.Error("Listen() on a socket in use expected an error")
+	}
+
+	client := Dial(socket)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	events := make(chan models.SyncEvent, 10)
+	streamed := make(chan error, 1)
+	go func() {
+		streamed <- client.Events(ctx, func(event models.SyncEvent) { events <- event })
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := client.Pause(ctx, "host"); err != nil {
+		t.Fatalf("Pause() error = %v", err)
+	}
+	rules, err := client.Rules(ctx)
+	if err != nil {
+		t.Fatalf("Rules() error = %v", err)
+	}
+	if len(rules) != 2 || rules[0].ID != "host" || !rules[0].Paused || rules[0].Name != "Host" || rules[1].Paused {
+		t.Errorf("Rules() = %+v, want host paused", rules)
+	}
+	if _, err := client.Sync(ctx, "host"); err == nil {
+		t.Error("Sync() of a paused rule expected an error")
+	}
+	if err := client.Pause(ctx, "missing"); err == nil {
+		t.Error("Pause() of an unknown rule expected an error")
+	}
+
+	// Resuming catches up with the source
+	if err := client.Resume(ctx, "host"); err != nil {
+		t.Fatalf("Resume() error = %v", err)
+	}
+	select {
+	case event := <-events:
+		if event.RuleID != "host" || !event.Success || event.NewValue != "db" {
+			t.Errorf("Streamed event = %+v, want host synced", event)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("No event streamed after resuming the rule")
+	}
+	if content, _ := os.ReadFile(targetFile); string(content) != "HOST=db\n" {
+		t.Errorf("Target file = %q after resuming", content)
+	}
+
+	if count, err := client.Sync(ctx); err != nil || count != 1 {
+		t.Errorf("Sync() = %d, %v; want the enabled rule", count, err)
+	}
+	if _, err := client.Sync(ctx, "off"); err == nil {
+		t.Error("Sync() of a disabled rule expected an error")
+	}
+
+	cancel()
+	select {
+	case err := <-streamed:
+		if err != nil {
+			t.Errorf("Events() error = %v after cancelling", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Error("Events() did not return after cancelling")
+	}
+}
+
+func TestServerRuleEditsAndLogs(t *testing.T) {
+	dir := t.TempDir()
+	log := logger.New()
+	fw, err := watcher.New(log)
+	if err != nil {
+		t.Fatalf("watcher.New() error = %v", err)
+	}
+	fw.SetRules([]models.SyncRule{{ID: "host", SourceFile: filepath.Join(dir, "source.yaml"), SourceKey: "host", TargetFile: filepath.Join(dir, "target.env"), TargetKey: "HOST"}})
+
+	server := New(fw, log)
+	log.OnEntry(server.RecordLog)
+	socket := filepath.Join(dir, "var-sync.sock")
+	if err := server.Listen(socket); err != nil {
+		t.Fatalf("Listen() error = %v", err)
+	}
+	defer server.Close()
+
+	client := Dial(socket)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rules := []models.SyncRule{{ID: "port", SourceFile: filepath.Join(dir, "source.yaml"), SourceKey: "port", TargetFile: filepath.Join(dir, "target.env"), TargetKey: "PORT"}}
+	if _, err := client.SetRules(ctx, rules); err == nil {
+		t.Error("SetRules() without a rule editor expected an error")
+	}
+
+	server.SetRuleEditor(func(rules []models.SyncRule) error {
+		for _, rule := range rules {
+			if rule.ID == "" {
+				return fmt.Errorf("rule without an ID")
+			}
+		}
+		return fw.SetRules(rules)
+	})
+	updated, err := client.SetRules(ctx, rules)
+	if err != nil {
+		t.Fatalf("SetRules() error = %v", err)
+	}
+	if len(updated) != 1 || updated[0].ID != "port" {
+		t.Errorf("SetRules() = %+v, want the port rule", updated)
+	}
+	if _, err := client.SetRules(ctx, []models.SyncRule{{Name: "No ID"}}); err == nil || !strings.Contains(err.Error(), "without an ID") {
+		t.Errorf("SetRules() error = %v, want the editor's error", err)
+	}
+
+	lines := make(chan logger.Entry, 10)
+	go client.Logs(ctx, func(entry logger.Entry) { lines <- entry })
+	time.Sleep(100 * time.Millisecond)
+	log.Module("sync").Rule("port").Warn("Something to see")
+	select {
+	case entry := <-lines:
+		if entry.Message != "Something to see" || entry.Module != "sync" || entry.RuleID != "port" || entry.Level != logger.WARN {
+			t.Errorf("Streamed line = %+v", entry)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("No log line streamed")
+	}
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package control
+
+import (
+	"net"
+	"syscall"
+)
+
+// listenSocket listens on a unix socket at path that only the user running
+// var-sync can connect to. The socket is created without permissions for
+// anyone else, rather than restricted once it exists, so that no other user
+// can connect in between.
+func listenSocket(path string) (net.Listener, error) {
+	umask := syscall.Umask(0o077)
+	defer syscall.Umask(umask)
+	return net.Listen("unix", path)
+}
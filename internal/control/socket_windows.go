@@ -0,0 +1,14 @@
+//go:build windows
+
+package control
+
+import "net"
+
+// listenSocket listens on a unix socket at path. Windows has no file modes
+// to limit who may connect: the socket takes the access list of its
+// directory, as the config file next to it does, and the API does not
+// authenticate callers, so anyone who can write to that directory can
+// control the watcher.
+func listenSocket(path string) (net.Listener, error) {
+	return net.Listen("unix", path)
+}
@@ -0,0 +1,211 @@
+package diff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// contextLines is the number of unchanged lines shown around each change
+const contextLines = 3
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+// edit is a single line operation in an edit script, carrying the position of
+// the line in both the old and the new content
+type edit struct {
+	kind opKind
+	line string
+	aIdx int
+	bIdx int
+}
+
+// Unified returns a unified diff between from and to, labelled with the given
+// file names. An empty string is returned when the contents are identical.
+func Unified(fromName, toName, from, to string) string {
+	return UnifiedRedacted(fromName, toName, from, to, from, to)
+}
+
+// UnifiedRedacted is Unified, showing the lines of redactedFrom and
+// redactedTo in place of the lines of from and to, such as the same contents
+// with secret values masked. The changes are still those between from and
+// to. If the redacted contents do not have as many lines as the contents, no
+// lines are shown at all.
+func UnifiedRedacted(fromName, toName, from, to, redactedFrom, redactedTo string) string {
+	if from == to {
+		return ""
+	}
+
+	a := splitLines(from)
+	b := splitLines(to)
+	edits := lineEdits(a, b)
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n", fromName)
+	fmt.Fprintf(&out, "+++ %s\n", toName)
+
+	redactedA, redactedB := splitLines(redactedFrom), splitLines(redactedTo)
+	if len(redactedA) != len(a) || len(redactedB) != len(b) {
+		out.WriteString("# Changed lines hidden, they hold redacted values\n")
+		return out.String()
+	}
+	for i, e := range edits {
+		if e.kind == opInsert {
+			edits[i].line = redactedB[e.bIdx]
+		} else {
+			edits[i].line = redactedA[e.aIdx]
+		}
+	}
+
+	i := 0
+	for i < len(edits) {
+		if edits[i].kind == opEqual {
+			i++
+			continue
+		}
+
+		// Extend the hunk while changes are close enough to share context
+		last := i
+		for j := i; j < len(edits); j++ {
+			if edits[j].kind != opEqual {
+				last = j
+			} else if j-last > 2*contextLines {
+				break
+			}
+		}
+
+		start := max(0, i-contextLines)
+		end := min(len(edits), last+contextLines+1)
+		writeHunk(&out, edits[start:end])
+		i = end
+	}
+
+	return out.String()
+}
+
+// writeHunk renders a single hunk including its @@ header
+func writeHunk(out *strings.Builder, hunk []edit) {
+	aStart, bStart := hunk[0].aIdx, hunk[0].bIdx
+	aCount, bCount := 0, 0
+	for _, e := range hunk {
+		switch e.kind {
+		case opEqual:
+			aCount++
+			bCount++
+		case opDelete:
+			aCount++
+		case opInsert:
+			bCount++
+		}
+	}
+
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+	for _, e := range hunk {
+		switch e.kind {
+		case opEqual:
+			out.WriteString(" " + e.line + "\n")
+		case opDelete:
+			out.WriteString("-" + e.line + "\n")
+		case opInsert:
+			out.WriteString("+" + e.line + "\n")
+		}
+	}
+}
+
+// hunkRange formats a hunk range; empty ranges refer to the preceding line
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// splitLines splits content into lines, ignoring a single trailing newline
+func splitLines(content string) []string {
+	if content == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+}
+
+// lineEdits computes the shortest edit script between a and b using the
+// Myers difference algorithm
+func lineEdits(a, b []string) []edit {
+	n, m := len(a), len(b)
+	maxD := n + m
+	offset := maxD + 1
+	v := make([]int, 2*maxD+3)
+	var trace [][]int
+
+search:
+	for d := 0; d <= maxD; d++ {
+		snapshot := make([]int, len(v))
+		copy(snapshot, v)
+		trace = append(trace, snapshot)
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	// Walk the trace backwards to recover the edit script
+	edits := make([]edit, 0, n+m)
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+
+		var prevK int
+		if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[offset+prevK]
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			edits = append(edits, edit{kind: opEqual, line: a[x], aIdx: x, bIdx: y})
+		}
+
+		if d > 0 {
+			if x == prevX {
+				y--
+				edits = append(edits, edit{kind: opInsert, line: b[y], aIdx: x, bIdx: y})
+			} else {
+				x--
+				edits = append(edits, edit{kind: opDelete, line: a[x], aIdx: x, bIdx: y})
+			}
+		}
+	}
+
+	for i, j := 0, len(edits)-1; i < j; i, j = i+1, j-1 {
+		edits[i], edits[j] = edits[j], edits[i]
+	}
+
+	return edits
+}
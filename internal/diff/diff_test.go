@@ -0,0 +1,111 @@
+package diff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedIdentical(t *testing.T) {
+	if out := Unified("a", "b", "same\n", "same\n"); out != "" {
+		t.Errorf("Expected empty diff for identical content, got:\n%s", out)
+	}
+}
+
+func TestUnifiedSingleChange(t *testing.T) {
+	from := "one\ntwo\nthree\nfour\nfive\nsix\nseven\n"
+	to := "one\ntwo\nthree\nFOUR\nfive\nsix\nseven\n"
+
+	expected := `--- a/file
++++ b/file
+@@ -1,7 +1,7 @@
+ one
+ two
+ three
+-four
++FOUR
+ five
+ six
+ seven
+`
+
+	if out := Unified("a/file", "b/file", from, to); out != expected {
+		t.Errorf("Unified() result:\n%s\nExpected:\n%s", out, expected)
+	}
+}
+
+func TestUnifiedSeparateHunks(t *testing.T) {
+	var fromLines, toLines []string
+	for i := 0; i < 20; i++ {
+		line := strings.Repeat("x", i+1)
+		fromLines = append(fromLines, line)
+		if i == 1 || i == 18 {
+			line = "changed"
+		}
+		toLines = append(toLines, line)
+	}
+
+	out := Unified("a", "b", strings.Join(fromLines, "\n"), strings.Join(toLines, "\n"))
+	if count := strings.Count(out, "@@ -"); count != 2 {
+		t.Fatalf("Expected 2 hunks, got %d:\n%s", count, out)
+	}
+	if !strings.Contains(out, "@@ -1,5 +1,5 @@") {
+		t.Errorf("Missing first hunk header:\n%s", out)
+	}
+	if !strings.Contains(out, "@@ -16,5 +16,5 @@") {
+		t.Errorf("Missing second hunk header:\n%s", out)
+	}
+}
+
+func TestUnifiedInsertAndDelete(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     string
+		to       string
+		expected string
+	}{
+		{
+			name:     "insert into empty",
+			from:     "",
+			to:       "a\nb\n",
+			expected: "--- x\n+++ y\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:     "delete everything",
+			from:     "a\nb\n",
+			to:       "",
+			expected: "--- x\n+++ y\n@@ -1,2 +0,0 @@\n-a\n-b\n",
+		},
+		{
+			name:     "append line",
+			from:     "a\n",
+			to:       "a\nb\n",
+			expected: "--- x\n+++ y\n@@ -1 +1,2 @@\n a\n+b\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if out := Unified("x", "y", tt.from, tt.to); out != tt.expected {
+				t.Errorf("Unified() result:\n%q\nExpected:\n%q", out, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUnifiedRedacted(t *testing.T) {
+	from := "HOST=a\nPASSWORD=old\nPORT=1\n"
+	to := "HOST=b\nPASSWORD=new\nPORT=1\n"
+	redacted := "HOST=a\nPASSWORD=***\nPORT=1\n"
+	redactedTo := "HOST=b\nPASSWORD=***\nPORT=1\n"
+
+	expected := "--- x\n+++ y\n@@ -1,3 +1,3 @@\n-HOST=a\n-PASSWORD=***\n+HOST=b\n+PASSWORD=***\n PORT=1\n"
+	if out := UnifiedRedacted("x", "y", from, to, redacted, redactedTo); out != expected {
+		t.Errorf("UnifiedRedacted() result:\n%q\nExpected:\n%q", out, expected)
+	}
+
+	// Lines that do not line up are not shown
+	expected = "--- x\n+++ y\n# Changed lines hidden, they hold redacted values\n"
+	if out := UnifiedRedacted("x", "y", from, to, redacted, "HOST=b\n"); out != expected {
+		t.Errorf("UnifiedRedacted() with other lines:\n%q\nExpected:\n%q", out, expected)
+	}
+}
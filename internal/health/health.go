@@ -0,0 +1,166 @@
+package health
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"var-sync/internal/watcher"
+	"var-sync/pkg/models"
+)
+
+// FailureThreshold is how many syncs of a rule must fail in a row before it
+// is reported as a persistent error
+const FailureThreshold = 3
+
+// Possible values of the overall status
+const (
+	StatusOK       = "ok"
+	StatusDegraded = "degraded" // Running, but some sources or rules keep failing
+	StatusDown     = "down"     // The watcher stopped or its event queue is full
+)
+
+// Monitor tracks the last sync event of every rule and reports them together
+// with the watcher's state, for liveness probes and operators
+type Monitor struct {
+	rules   map[string]*RuleStatus
+	watcher *watcher.FileWatcher
+	started time.Time
+	mutex   sync.Mutex
+}
+
+// Report is the body of a /status response
+type Report struct {
+	Status  string                 `json:"status"`
+	Started time.Time              `json:"started"`
+	Watcher WatcherStatus          `json:"watcher"`
+	Rules   map[string]*RuleStatus `json:"rules"`
+	Errors  []Error                `json:"errors,omitempty"`
+}
+
+// WatcherStatus describes the file watcher
+type WatcherStatus struct {
+	Running       bool `json:"running"`
+	WatchedFiles  int  `json:"watched_files"`
+	QueueLength   int  `json:"queue_length"`
+	QueueCapacity int  `json:"queue_capacity"`
+}
+
+// RuleStatus is a rule's most recent sync event and how many of its syncs
+// have failed since the last success
+type RuleStatus struct {
+	LastEvent           models.SyncEvent `json:"last_event"`
+	ConsecutiveFailures int              `json:"consecutive_failures"`
+}
+
+// Error is a persistent problem and what it affects: a directory, a backend
+// source, or a rule
+type Error struct {
+	Subject string    `json:"subject"`
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
+}
+
+// New creates a monitor for fw
+func New(fw *watcher.FileWatcher) *Monitor {
+	return &Monitor{
+		rules:   make(map[string]*RuleStatus),
+		watcher: fw,
+		started: time.Now(),
+	}
+}
+
+// Record notes a sync event as its rule's latest
+func (m *Monitor) Record(event models.SyncEvent) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	rule, ok := m.rules[event.RuleID]
+	if !ok {
+		rule = &RuleStatus{}
+		m.rules[event.RuleID] = rule
+	}
+	rule.LastEvent = event.Redacted()
+	if event.Success {
+		rule.ConsecutiveFailures = 0
+	} else {
+		rule.ConsecutiveFailures++
+	}
+}
+
+// Report returns the current state of the watcher and every rule
+func (m *Monitor) Report() Report {
+	status := m.watcher.Status()
+	stats := m.watcher.Stats()
+
+	report := Report{
+		Started: m.started,
+		Watcher: WatcherStatus{
+			Running:       status.Running,
+			WatchedFiles:  status.WatchedFiles,
+			QueueLength:   stats.QueueLength,
+			QueueCapacity: stats.QueueCapacity,
+		},
+		Rules: make(map[string]*RuleStatus),
+	}
+
+	for subject, watchErr := range status.Errors {
+		report.Errors = append(report.Errors, Error{Subject: subject, Message: watchErr.Message, Since: watchErr.Since})
+	}
+
+	m.mutex.Lock()
+	for id, rule := range m.rules {
+		ruleStatus := *rule
+		report.Rules[id] = &ruleStatus
+		if rule.ConsecutiveFailures >= FailureThreshold {
+			report.Errors = append(report.Errors, Error{
+				Subject: "rule " + id,
+				Message: fmt.Sprintf("%d syncs failed in a row, last: %s", rule.ConsecutiveFailures, rule.LastEvent.Error),
+				Since:   rule.LastEvent.Timestamp,
+			})
+		}
+	}
+	m.mutex.Unlock()
+
+	sort.Slice(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Subject < report.Errors[j].Subject
+	})
+
+	switch {
+	case !status.Running || (stats.QueueCapacity > 0 && stats.QueueLength >= stats.QueueCapacity):
+		report.Status = StatusDown
+	case len(report.Errors) > 0:
+		report.Status = StatusDegraded
+	default:
+		report.Status = StatusOK
+	}
+	return report
+}
+
+// Healthz answers a liveness probe: 200 while the watcher is running and
+// keeping up, even if some sources are failing, and 503 once it is not
+func (m *Monitor) Healthz(w http.ResponseWriter, r *http.Request) {
+	report := m.Report()
+	code := http.StatusOK
+	if report.Status == StatusDown {
+		code = http.StatusServiceUnavailable
+	}
+	writeJSON(w, code, map[string]string{"status": report.Status})
+}
+
+// Status answers with the full report
+func (m *Monitor) Status(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, m.Report())
+}
+
+// writeJSON writes body as an indented JSON response
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(body)
+}
@@ -0,0 +1,80 @@
+package health
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"var-sync/internal/logger"
+	"var-sync/internal/watcher"
+	"var-sync/pkg/models"
+)
+
+func TestMonitorReport(t *testing.T) {
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("watcher.New() error = %v", err)
+	}
+	dir := t.TempDir()
+	fw.SetRules([]models.SyncRule{
+		{ID: "db", SourceFile: dir + "/a.yaml", Enabled: true},
+		{ID: "api", SourceFile: dir + "/a.yaml", Enabled: true},
+		{ID: "off", SourceFile: dir + "/b.yaml", Enabled: false},
+	})
+
+	m := New(fw)
+
+	// A watcher that has not started is down
+	recorder := httptest.NewRecorder()
+	m.Healthz(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("Healthz before start = %d, want %d", recorder.Code, http.StatusServiceUnavailable)
+	}
+
+	fw.Start()
+	defer fw.Stop()
+
+	base := time.Now()
+	m.Record(models.SyncEvent{RuleID: "db", Timestamp: base, Success: true})
+	for i := 0; i < FailureThreshold; i++ {
+		m.Record(models.SyncEvent{RuleID: "api", Timestamp: base, Success: false, Error: "boom"})
+	}
+
+	report := m.Report()
+	if report.Status != StatusDegraded {
+		t.Errorf("Status = %q, want %q", report.Status, StatusDegraded)
+	}
+	if !report.Watcher.Running || report.Watcher.WatchedFiles != 1 {
+		t.Errorf("Watcher = %+v, want running with 1 watched file", report.Watcher)
+	}
+	if report.Rules["db"].ConsecutiveFailures != 0 || report.Rules["api"].ConsecutiveFailures != FailureThreshold {
+		t.Errorf("Unexpected rule statuses: db=%+v api=%+v", report.Rules["db"], report.Rules["api"])
+	}
+	if len(report.Errors) != 1 || report.Errors[0].Subject != "rule api" {
+		t.Errorf("Errors = %+v, want the failing rule", report.Errors)
+	}
+
+	// Failing sources degrade the status but keep the liveness probe passing
+	recorder = httptest.NewRecorder()
+	m.Healthz(recorder, httptest.NewRequest("GET", "/healthz", nil))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Healthz = %d, want %d", recorder.Code, http.StatusOK)
+	}
+
+	// A success clears the rule's persistent error
+	m.Record(models.SyncEvent{RuleID: "api", Timestamp: base, Success: true})
+	recorder = httptest.NewRecorder()
+	m.Status(recorder, httptest.NewRequest("GET", "/status", nil))
+	var body Report
+	if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Failed to decode /status: %v", err)
+	}
+	if body.Status != StatusOK || len(body.Errors) != 0 {
+		t.Errorf("Status after recovery = %q with errors %+v", body.Status, body.Errors)
+	}
+	if !body.Rules["api"].LastEvent.Success {
+		t.Errorf("Last event of api not updated: %+v", body.Rules["api"])
+	}
+}
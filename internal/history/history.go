@@ -0,0 +1,129 @@
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"var-sync/pkg/models"
+)
+
+// maxLineSize bounds a single journal entry, which may hold whole objects
+const maxLineSize = 16 * 1024 * 1024
+
+// Journal is an append-only JSONL log of sync events
+type Journal struct {
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// Filter selects events when reading the journal
+type Filter struct {
+	RuleID string
+	Since  time.Time
+	Limit  int // Keep only the most recent Limit events (0 keeps all)
+}
+
+// Open opens the journal at path for appending, creating it if necessary
+func Open(path string) (*Journal, error) {
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	return &Journal{file: file}, nil
+}
+
+// Append writes an event to the end of the journal
+func (j *Journal) Append(event models.SyncEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write history: %w", err)
+	}
+	return nil
+}
+
+// Close closes the journal file
+func (j *Journal) Close() error {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	return j.file.Close()
+}
+
+// Read returns the events in the journal at path matching filter, oldest
+// first. A missing journal has no events. Lines that cannot be parsed, such
+// as a partially written final entry, are skipped. Numeric values are decoded
+// as json.Number so that integers are reproduced exactly.
+func Read(path string, filter Filter) ([]models.SyncEvent, error) {
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file: %w", err)
+	}
+	defer file.Close()
+
+	var events []models.SyncEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		var event models.SyncEvent
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.UseNumber()
+		if err := decoder.Decode(&event); err != nil {
+			continue
+		}
+		if filter.RuleID != "" && event.RuleID != filter.RuleID {
+			continue
+		}
+		if !filter.Since.IsZero() && event.Timestamp.Before(filter.Since) {
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file: %w", err)
+	}
+
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[len(events)-filter.Limit:]
+	}
+
+	return events, nil
+}
+
+// Find returns the event with the given ID, which may be a unique prefix
+func Find(path string, id string) (models.SyncEvent, error) {
+	events, err := Read(path, Filter{})
+	if err != nil {
+		return models.SyncEvent{}, err
+	}
+
+	var matches []models.SyncEvent
+	for _, event := range events {
+		if id != "" && strings.HasPrefix(event.ID, id) {
+			matches = append(matches, event)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return models.SyncEvent{}, fmt.Errorf("event not found: %s", id)
+	case 1:
+		return matches[0], nil
+	default:
+		return models.SyncEvent{}, fmt.Errorf("event id %s is ambiguous (%d matches)", id, len(matches))
+	}
+}
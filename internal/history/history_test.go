@@ -0,0 +1,128 @@
+package history
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"var-sync/pkg/models"
+)
+
+func TestJournalAppendAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	journal, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	events := []models.SyncEvent{
+		{ID: "e1", RuleID: "db", TargetFile: "app.env", TargetKey: "DB_HOST", Timestamp: base, OldValue: "a", NewValue: "b", Success: true},
+		{ID: "e2", RuleID: "api", TargetFile: "app.env", TargetKey: "API_URL", Timestamp: base.Add(time.Hour), Success: false, Error: "boom"},
+		{ID: "e3", RuleID: "db", TargetFile: "app.env", TargetKey: "DB_HOST", Timestamp: base.Add(2 * time.Hour), OldValue: "b", NewValue: "c", Success: true},
+	}
+	for _, event := range events {
+		if err := journal.Append(event); err != nil {
+			t.Fatalf("Append() error = %v", err)
+		}
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Reopening appends rather than truncating
+	journal, err = Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if err := journal.Append(models.SyncEvent{ID: "e4", RuleID: "api", Timestamp: base.Add(3 * time.Hour)}); err != nil {
+		t.Fatalf("Append() error = %v", err)
+	}
+	journal.Close()
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected []string
+	}{
+		{"all", Filter{}, []string{"e1", "e2", "e3", "e4"}},
+		{"by rule", Filter{RuleID: "db"}, []string{"e1", "e3"}},
+		{"since", Filter{Since: base.Add(90 * time.Minute)}, []string{"e3", "e4"}},
+		{"limit keeps newest", Filter{Limit: 2}, []string{"e3", "e4"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(path, tt.filter)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Read() returned %d events, expected %d", len(got), len(tt.expected))
+			}
+			for i, id := range tt.expected {
+				if got[i].ID != id {
+					t.Errorf("Read()[%d].ID = %s, expected %s", i, got[i].ID, id)
+				}
+			}
+		})
+	}
+
+	all, _ := Read(path, Filter{RuleID: "db"})
+	if all[0].OldValue != "a" || all[0].TargetKey != "DB_HOST" || !all[0].Timestamp.Equal(base) {
+		t.Errorf("Event fields not preserved: %+v", all[0])
+	}
+}
+
+func TestReadSkipsCorruptLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	content := `{"id":"e1","rule_id":"db","timestamp":"2024-03-01T12:00:00Z","success":true}
+not json
+{"id":"e2","rule_id":"db","timest`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	events, err := Read(path, Filter{})
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if len(events) != 1 || events[0].ID != "e1" {
+		t.Errorf("Read() = %+v, expected only e1", events)
+	}
+}
+
+func TestReadMissingJournal(t *testing.T) {
+	events, err := Read(filepath.Join(t.TempDir(), "missing.jsonl"), Filter{})
+	if err != nil || len(events) != 0 {
+		t.Errorf("Read() of missing journal = %v, %v; expected no events", events, err)
+	}
+}
+
+func TestFind(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history.jsonl")
+	journal, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	for _, id := range []string{"abc123", "abd456", "xyz789"} {
+		journal.Append(models.SyncEvent{ID: id, RuleID: "db", OldValue: 8080})
+	}
+	journal.Close()
+
+	event, err := Find(path, "xyz")
+	if err != nil || event.ID != "xyz789" {
+		t.Errorf("Find(xyz) = %+v, %v; expected xyz789", event, err)
+	}
+	if event.OldValue.(json.Number).String() != "8080" {
+		t.Errorf("Find() OldValue = %#v, expected json.Number 8080", event.OldValue)
+	}
+	if _, err := Find(path, "ab"); err == nil {
+		t.Error("Find() expected error for ambiguous prefix")
+	}
+	if _, err := Find(path, "missing"); err == nil {
+		t.Error("Find() expected error for unknown ID")
+	}
+}
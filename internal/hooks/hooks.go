@@ -0,0 +1,203 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+
+	"var-sync/internal/logger"
+	"var-sync/pkg/models"
+)
+
+// Runner runs the global hooks and those of an event's rule after each sync.
+// Hooks run in the background so a slow command does not hold up syncing.
+type Runner struct {
+	onSuccess []models.Hook
+	onFailure []models.Hook
+	rules     map[string]models.SyncRule
+	rulesLock sync.RWMutex
+	http      models.HTTPConfig
+	client    *http.Client
+	logger    *logger.Logger
+	waitGroup sync.WaitGroup
+}
+
+// New creates a runner for the hooks in cfg
+func New(cfg *models.Config, logger *logger.Logger) *Runner {
+	r := &Runner{
+		onSuccess: cfg.OnSuccess,
+		onFailure: cfg.OnFailure,
+		client:    &http.Client{},
+		logger:    logger.Module("hooks"),
+	}
+	if cfg.HTTP != nil {
+		r.http = *cfg.HTTP
+	}
+	r.SetRules(cfg.Rules)
+	return r
+}
+
+// SetRules replaces the rules whose hooks run, such as after the config is
+// reloaded
+func (r *Runner) SetRules(rules []models.SyncRule) {
+	byID := make(map[string]models.SyncRule, len(rules))
+	for _, rule := range rules {
+		byID[rule.ID] = rule
+	}
+	r.rulesLock.Lock()
+	r.rules = byID
+	r.rulesLock.Unlock()
+}
+
+// Enabled reports whether any hooks are configured
+func (r *Runner) Enabled() bool {
+	if len(r.onSuccess) > 0 || len(r.onFailure) > 0 {
+		return true
+	}
+	r.rulesLock.RLock()
+	defer r.rulesLock.RUnlock()
+	for _, rule := range r.rules {
+		if len(rule.OnSuccess) > 0 || len(rule.OnFailure) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// Fire starts the hooks for event: on_success hooks for a successful sync and
+// on_failure hooks otherwise, the global ones first. Hooks of sensitive rules
+// are given masked values.
+func (r *Runner) Fire(event models.SyncEvent) {
+	event = event.Redacted()
+	r.rulesLock.RLock()
+	rule := r.rules[event.RuleID]
+	r.rulesLock.RUnlock()
+	hooks := append(append([]models.Hook{}, r.onFailure...), rule.OnFailure...)
+	if event.Success {
+		hooks = append(append([]models.Hook{}, r.onSuccess...), rule.OnSuccess...)
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		r.logger.Error("Failed to encode sync event %s for hooks: %v", event.ID, err)
+		return
+	}
+
+	r.waitGroup.Add(1)
+	go func() {
+		defer r.waitGroup.Done()
+		for _, hook := range hooks {
+			if err := r.run(hook, event, payload); err != nil {
+				r.logger.Rule(event.RuleID).Error("Hook for rule %s failed: %v", event.RuleID, err)
+			}
+		}
+	}()
+}
+
+// Wait blocks until every started hook has finished
+func (r *Runner) Wait() {
+	r.waitGroup.Wait()
+}
+
+// run runs a single hook within its timeout
+func (r *Runner) run(hook models.Hook, event models.SyncEvent, payload []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hook.Timeout.Or(models.DefaultHookTimeout))
+	defer cancel()
+
+	if hook.Command != "" {
+		if err := r.runCommand(ctx, hook.Command, event, payload); err != nil {
+			return err
+		}
+	}
+	if hook.URL != "" {
+		if err := r.post(ctx, hook.URL, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runCommand runs command with the shell. The event is given as JSON on
+// standard input and its fields as VAR_SYNC_* environment variables.
+func (r *Runner) runCommand(ctx context.Context, command string, event models.SyncEvent, payload []byte) error {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", command)
+	}
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"VAR_SYNC_EVENT_ID="+event.ID,
+		fmt.Sprintf("VAR_SYNC_SEQUENCE=%d", event.Sequence),
+		"VAR_SYNC_CHANGE_ID="+event.ChangeID,
+		"VAR_SYNC_RULE_ID="+event.RuleID,
+		"VAR_SYNC_TARGET_FILE="+event.TargetFile,
+		"VAR_SYNC_TARGET_KEY="+event.TargetKey,
+		"VAR_SYNC_OLD_VALUE="+envValue(event.OldValue),
+		"VAR_SYNC_NEW_VALUE="+envValue(event.NewValue),
+		fmt.Sprintf("VAR_SYNC_SUCCESS=%t", event.Success),
+		"VAR_SYNC_ERROR="+event.Error,
+	)
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if len(output) > 0 {
+			return fmt.Errorf("command %q: %w: %s", command, err, strings.TrimSpace(string(output)))
+		}
+		return fmt.Errorf("command %q: %w", command, err)
+	}
+	r.logger.Rule(event.RuleID).Debug("Hook command %q for rule %s ran: %s", command, event.RuleID, strings.TrimSpace(string(output)))
+	return nil
+}
+
+// post sends the event to a webhook, with any headers configured for its URL
+func (r *Runner) post(ctx context.Context, url string, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("invalid url %s: %w", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range r.http.Headers(url) {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post to %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to post to %s: server returned %s", url, resp.Status)
+	}
+	return nil
+}
+
+// envValue formats a synced value for an environment variable: strings as
+// they are, anything else as JSON
+func envValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
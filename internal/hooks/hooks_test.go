@@ -0,0 +1,109 @@
+package hooks
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"var-sync/internal/logger"
+	"var-sync/pkg/models"
+)
+
+func TestRunnerCommandHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("command hooks are tested with sh")
+	}
+
+	dir := t.TempDir()
+	output := filepath.Join(dir, "hooks.log")
+	cfg := &models.Config{
+		OnSuccess: []models.Hook{{Command: `echo "global $VAR_SYNC_RULE_ID $VAR_SYNC_NEW_VALUE" >> ` + output}},
+		OnFailure: []models.Hook{{Command: `echo "failed $VAR_SYNC_RULE_ID: $VAR_SYNC_ERROR" >> ` + output}},
+		Rules: []models.SyncRule{
+			{ID: "db", OnSuccess: []models.Hook{{Command: `cat >> ` + output + `; echo >> ` + output}}},
+			{ID: "api"},
+		},
+	}
+
+	runner := New(cfg, logger.New())
+	if !runner.Enabled() {
+		t.Fatal("Enabled() = false with hooks configured")
+	}
+
+	runner.Fire(models.SyncEvent{ID: "e1", RuleID: "db", Timestamp: time.Now(), OldValue: "a", NewValue: map[string]any{"port": 5432}, Success: true})
+	runner.Wait()
+	runner.Fire(models.SyncEvent{ID: "e2", RuleID: "api", Timestamp: time.Now(), Success: false, Error: "boom"})
+	runner.Wait()
+
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatalf("Hooks did not run: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected 3 lines of hook output, got:\n%s", content)
+	}
+	if lines[0] != `global db {"port":5432}` {
+		t.Errorf("Global hook output = %q", lines[0])
+	}
+
+	// The rule's own hook runs after the global one and reads the event on stdin
+	var event models.SyncEvent
+	if err := json.Unmarshal([]byte(lines[1]), &event); err != nil || event.ID != "e1" {
+		t.Errorf("Rule hook did not receive the event as JSON: %q (%v)", lines[1], err)
+	}
+	if lines[2] != "failed api: boom" {
+		t.Errorf("Failure hook output = %q", lines[2])
+	}
+}
+
+func TestRunnerWebhook(t *testing.T) {
+	var mutex sync.Mutex
+	var received []models.SyncEvent
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event models.SyncEvent
+		json.NewDecoder(r.Body).Decode(&event)
+		mutex.Lock()
+		received = append(received, event)
+		auth = r.Header.Get("Authorization")
+		mutex.Unlock()
+	}))
+	defer server.Close()
+
+	cfg := &models.Config{
+		HTTP: &models.HTTPConfig{Endpoints: []models.HTTPEndpoint{
+			{URL: server.URL, Headers: map[string]string{"Authorization": "Bearer hook"}},
+		}},
+		Rules: []models.SyncRule{
+			{ID: "db", OnSuccess: []models.Hook{{URL: server.URL + "/synced"}}},
+		},
+	}
+
+	runner := New(cfg, logger.New())
+	runner.Fire(models.SyncEvent{ID: "e1", RuleID: "db", OldValue: "a", NewValue: "b", Success: true})
+	runner.Fire(models.SyncEvent{ID: "e2", RuleID: "db", Success: false})
+	runner.Fire(models.SyncEvent{ID: "e3", RuleID: "other", Success: true})
+	runner.Wait()
+
+	if len(received) != 1 || received[0].ID != "e1" || received[0].NewValue != "b" {
+		t.Fatalf("Webhook received %+v, want only event e1", received)
+	}
+	if auth != "Bearer hook" {
+		t.Errorf("Authorization = %q, want the endpoint's header", auth)
+	}
+}
+
+func TestRunnerWithoutHooks(t *testing.T) {
+	runner := New(&models.Config{Rules: []models.SyncRule{{ID: "db"}}}, logger.New())
+	if runner.Enabled() {
+		t.Error("Enabled() = true without hooks")
+	}
+}
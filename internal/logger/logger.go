@@ -1,10 +1,18 @@
 package logger
 
 import (
+	"compress/gzip"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
 	"time"
+
+	"var-sync/internal/textfile"
 )
 
 type LogLevel int
@@ -21,8 +29,47 @@ type Logger struct {
 	file    *os.File
 	logger  *log.Logger
 	console *log.Logger
+
+	// Rotation of the log file
+	filename string
+	size     int64
+	rotation Rotation
+	mutex    sync.Mutex
+
+	// Levels overriding the default for modules and rules
+	levels map[string]LogLevel
+
+	// Called with every line logged
+	listeners []func(Entry)
+
+	// Loggers for a module or rule share everything with the root they came from
+	root   *Logger
+	module string
+	ruleID string
 }
 
+// Rotation limits the log file. Once it reaches MaxSize bytes it is renamed
+// with a timestamp suffix and a new file started. Only the newest MaxBackups
+// rotated files are kept, none older than MaxAge; zero means no limit.
+type Rotation struct {
+	MaxSize    int64
+	MaxBackups int
+	MaxAge     time.Duration
+	Compress   bool // Gzip rotated files
+}
+
+// Entry is a logged line as passed to listeners
+type Entry struct {
+	Time    time.Time
+	Level   LogLevel
+	Module  string
+	RuleID  string
+	Message string
+}
+
+// backupTimeFormat suffixes rotated log files, sorting oldest first
+const backupTimeFormat = "20060102-150405.000"
+
 func New() *Logger {
 	return &Logger{
 		level:   INFO,
@@ -30,50 +77,282 @@ func New() *Logger {
 	}
 }
 
+func (l LogLevel) String() string {
+	switch l {
+	case DEBUG:
+		return "DEBUG"
+	case INFO:
+		return "INFO"
+	case WARN:
+		return "WARN"
+	case ERROR:
+		return "ERROR"
+	}
+	return fmt.Sprintf("LogLevel(%d)", int(l))
+}
+
 func (l *Logger) SetLevel(level LogLevel) {
-	l.level = level
+	l.base().level = level
+}
+
+// ParseLevel parses a level name such as "debug" or "WARN"
+func ParseLevel(name string) (LogLevel, error) {
+	switch strings.ToUpper(name) {
+	case "DEBUG":
+		return DEBUG, nil
+	case "INFO":
+		return INFO, nil
+	case "WARN", "WARNING":
+		return WARN, nil
+	case "ERROR":
+		return ERROR, nil
+	}
+	return INFO, fmt.Errorf("unknown log level %q: use debug, info, warn or error", name)
+}
+
+// SetLevels overrides the level of modules, such as "watcher", and of rules,
+// as "rule:<id>". A rule's level wins over its module's.
+func (l *Logger) SetLevels(levels map[string]LogLevel) {
+	root := l.base()
+	root.mutex.Lock()
+	defer root.mutex.Unlock()
+	root.levels = levels
+}
+
+// Module returns a logger for the named part of var-sync, whose messages are
+// prefixed with the name and filtered by its level
+func (l *Logger) Module(name string) *Logger {
+	return &Logger{root: l.base(), module: name}
+}
+
+// Rule returns a logger for messages about a single rule, filtered by the
+// rule's level before its module's
+func (l *Logger) Rule(id string) *Logger {
+	return &Logger{root: l.base(), module: l.module, ruleID: id}
+}
+
+// base returns the logger that owns the output
+func (l *Logger) base() *Logger {
+	if l.root != nil {
+		return l.root
+	}
+	return l
+}
+
+// threshold returns the lowest level logged, from the most specific setting
+func (l *Logger) threshold() LogLevel {
+	root := l.base()
+	root.mutex.Lock()
+	defer root.mutex.Unlock()
+
+	if level, ok := root.levels["rule:"+l.ruleID]; ok && l.ruleID != "" {
+		return level
+	}
+	if level, ok := root.levels[l.module]; ok && l.module != "" {
+		return level
+	}
+	return root.level
 }
 
 func (l *Logger) SetLogFile(filename string) error {
+	l = l.base()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
 	if l.file != nil {
 		l.file.Close()
 	}
+	l.filename = filename
+	return l.open()
+}
+
+// OnEntry registers a listener called with every line logged, such as to
+// show them live in the TUI. Listeners are called synchronously by whichever
+// goroutine logs, so they must not block.
+func (l *Logger) OnEntry(listener func(Entry)) {
+	l = l.base()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.listeners = append(l.listeners, listener)
+}
+
+// SetConsole sets where warnings and errors are echoed, such as io.Discard
+// while a full-screen interface owns the terminal
+func (l *Logger) SetConsole(w io.Writer) {
+	l = l.base()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.console = log.New(w, "", 0)
+}
+
+// SetRotation sets the limits the log file is rotated at
+func (l *Logger) SetRotation(rotation Rotation) {
+	l = l.base()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.rotation = rotation
+}
 
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+// open opens the log file for appending
+func (l *Logger) open() error {
+	file, err := os.OpenFile(l.filename, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
 	if err != nil {
 		return fmt.Errorf("failed to open log file: %w", err)
 	}
 
+	l.size = 0
+	if info, err := file.Stat(); err == nil {
+		l.size = info.Size()
+	}
 	l.file = file
 	l.logger = log.New(file, "", 0)
 	return nil
 }
 
 func (l *Logger) Close() error {
+	l = l.base()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
 	if l.file != nil {
 		return l.file.Close()
 	}
 	return nil
 }
 
+// Rotate moves the current log file aside and starts a new one, then removes
+// rotated files beyond the configured limits
+func (l *Logger) Rotate() error {
+	l = l.base()
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.rotate()
+}
+
+func (l *Logger) rotate() error {
+	if l.file == nil {
+		return nil
+	}
+
+	l.file.Close()
+	backup := l.filename + "." + time.Now().Format(backupTimeFormat)
+	if err := textfile.Rename(l.filename, backup); err != nil && !os.IsNotExist(err) {
+		l.open()
+		return fmt.Errorf("failed to rotate log file: %w", err)
+	}
+	if err := l.open(); err != nil {
+		return err
+	}
+
+	if l.rotation.Compress {
+		if err := compress(backup); err != nil {
+			return fmt.Errorf("failed to compress rotated log file: %w", err)
+		}
+	}
+	return l.prune()
+}
+
+// prune removes rotated log files beyond MaxBackups or older than MaxAge
+func (l *Logger) prune() error {
+	matches, err := filepath.Glob(l.filename + ".*")
+	if err != nil {
+		return err
+	}
+
+	type backup struct {
+		path    string
+		rotated time.Time
+	}
+	backups := make([]backup, 0, len(matches))
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, l.filename+"."), ".gz")
+		if rotated, err := time.ParseInLocation(backupTimeFormat, stamp, time.Local); err == nil {
+			backups = append(backups, backup{match, rotated})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].rotated.After(backups[j].rotated)
+	})
+
+	for i, b := range backups {
+		tooMany := l.rotation.MaxBackups > 0 && i >= l.rotation.MaxBackups
+		tooOld := l.rotation.MaxAge > 0 && time.Since(b.rotated) > l.rotation.MaxAge
+		if tooMany || tooOld {
+			if err := os.Remove(b.path); err != nil {
+				return fmt.Errorf("failed to remove old log file: %w", err)
+			}
+		}
+	}
+	return nil
+}
+
+// compress replaces path with a gzipped copy at path.gz
+func compress(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	writer := gzip.NewWriter(out)
+	if _, err := io.Copy(writer, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
+
 func (l *Logger) log(level LogLevel, format string, args ...any) {
-	if level < l.level {
+	if level < l.threshold() {
 		return
 	}
 
-	timestamp := time.Now().Format("2006-01-02 15:04:05")
-	levelStr := []string{"DEBUG", "INFO", "WARN", "ERROR"}[level]
-	message := fmt.Sprintf(format, args...)
+	entry := Entry{
+		Time:    time.Now(),
+		Level:   level,
+		Module:  l.module,
+		RuleID:  l.ruleID,
+		Message: fmt.Sprintf(format, args...),
+	}
+	timestamp := entry.Time.Format("2006-01-02 15:04:05")
+	message := entry.Message
+	if l.module != "" {
+		message = "[" + l.module + "] " + message
+	}
 	
-	logLine := fmt.Sprintf("[%s] %s: %s", timestamp, levelStr, message)
+	logLine := fmt.Sprintf("[%s] %s: %s", timestamp, level, message)
 
+	l = l.base()
+	l.mutex.Lock()
 	if l.logger != nil {
 		l.logger.Println(logLine)
+		l.size += int64(len(logLine)) + 1
+		if l.rotation.MaxSize > 0 && l.size >= l.rotation.MaxSize {
+			if err := l.rotate(); err != nil {
+				l.console.Printf("[%s] ERROR: %v", timestamp, err)
+			}
+		}
 	}
-
 	if level >= WARN {
 		l.console.Println(logLine)
 	}
+	listeners := l.listeners
+	l.mutex.Unlock()
+
+	for _, listener := range listeners {
+		listener(entry)
+	}
 }
 
 func (l *Logger) Debug(format string, args ...any) {
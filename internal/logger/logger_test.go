@@ -2,11 +2,13 @@ package logger
 
 import (
 	"bytes"
+	"compress/gzip"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -69,8 +71,12 @@ func TestSetLogFile(t *testing.T) {
 func TestSetLogFileInvalidPath(t *testing.T) {
 	logger := New()
 	
-	// Try to create a log file in a non-existent directory without permission
-	invalidPath := "/invalid/path/test.log"
+	// A file cannot be created below a regular file on any system
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	invalidPath := filepath.Join(file, "test.log")
 	
 	err := logger.SetLogFile(invalidPath)
 	if err == nil {
@@ -429,4 +435,176 @@ func TestLoggerConcurrentAccess(t *testing.T) {
 	if !strings.Contains(logContent, "Goroutine 2") {
 		t.Error("Log should contain messages from goroutine 2")
 	}
-}
\ No newline at end of file
+}
+
+func TestRotateBySize(t *testing.T) {
+	tempDir := t.TempDir()
+	logFile := filepath.Join(tempDir, "rotate.log")
+
+	logger := New()
+	if err := logger.SetLogFile(logFile); err != nil {
+		t.Fatalf("SetLogFile() returned error: %v", err)
+	}
+	defer logger.Close()
+	logger.SetRotation(Rotation{MaxSize: 200, MaxBackups: 2})
+
+	for i := 0; i < 20; i++ {
+		logger.Info("Message number %d with some padding", i)
+		time.Sleep(2 * time.Millisecond) // Keep rotated file names distinct
+	}
+
+	backups, _ := filepath.Glob(logFile + ".*")
+	if len(backups) != 2 {
+		t.Errorf("Expected 2 rotated files to be kept, got %v", backups)
+	}
+
+	info, err := os.Stat(logFile)
+	if err != nil {
+		t.Fatalf("Current log file missing: %v", err)
+	}
+	if info.Size() >= 200 {
+		t.Errorf("Current log file is %d bytes, should have been rotated", info.Size())
+	}
+
+	content, _ := os.ReadFile(logFile)
+	if strings.Contains(string(content), "Message number 0 ") {
+		t.Error("Current log file should not contain messages from before rotation")
+	}
+}
+
+func TestRotateCompressAndMaxAge(t *testing.T) {
+	tempDir := t.TempDir()
+	logFile := filepath.Join(tempDir, "rotate.log")
+
+	// A rotated file from long ago is removed by the next rotation
+	old := logFile + "." + time.Now().Add(-48*time.Hour).Format(backupTimeFormat) + ".gz"
+	if err := os.WriteFile(old, []byte("old"), 0644); err != nil {
+		t.Fatalf("Failed to create old log file: %v", err)
+	}
+	unrelated := logFile + ".notes"
+	if err := os.WriteFile(unrelated, []byte("keep"), 0644); err != nil {
+		t.Fatalf("Failed to create unrelated file: %v", err)
+	}
+
+	logger := New()
+	if err := logger.SetLogFile(logFile); err != nil {
+		t.Fatalf("SetLogFile() returned error: %v", err)
+	}
+	defer logger.Close()
+	logger.SetRotation(Rotation{MaxAge: 24 * time.Hour, Compress: true})
+
+	logger.Info("Before rotation")
+	if err := logger.Rotate(); err != nil {
+		t.Fatalf("Rotate() returned error: %v", err)
+	}
+	logger.Info("After rotation")
+
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Error("Rotated file older than MaxAge should have been removed")
+	}
+	if _, err := os.Stat(unrelated); err != nil {
+		t.Error("Files that are not rotated logs should be left alone")
+	}
+
+	backups, _ := filepath.Glob(logFile + ".*.gz")
+	if len(backups) != 1 {
+		t.Fatalf("Expected 1 compressed rotated file, got %v", backups)
+	}
+	file, err := os.Open(backups[0])
+	if err != nil {
+		t.Fatalf("Failed to open rotated file: %v", err)
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatalf("Rotated file is not gzipped: %v", err)
+	}
+	rotated, _ := io.ReadAll(reader)
+	if !strings.Contains(string(rotated), "Before rotation") || strings.Contains(string(rotated), "After rotation") {
+		t.Errorf("Unexpected rotated content:\n%s", rotated)
+	}
+}
+
+func TestModuleAndRuleLevels(t *testing.T) {
+	tempDir := t.TempDir()
+	logFile := filepath.Join(tempDir, "levels.log")
+
+	logger := New()
+	if err := logger.SetLogFile(logFile); err != nil {
+		t.Fatalf("SetLogFile() returned error: %v", err)
+	}
+	defer logger.Close()
+	logger.SetLevels(map[string]LogLevel{
+		"watcher":    WARN,
+		"rule:noisy": DEBUG,
+		"hooks":      DEBUG,
+	})
+
+	watcher := logger.Module("watcher")
+	watcher.Info("watcher info")
+	watcher.Warn("watcher warn")
+	watcher.Rule("noisy").Debug("noisy debug")
+	watcher.Rule("quiet").Info("quiet info")
+	logger.Module("hooks").Debug("hooks debug")
+	logger.Module("tui").Debug("tui debug")
+	logger.Info("root info")
+
+	content, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	logContent := string(content)
+
+	expected := []string{"WARN: [watcher] watcher warn", "DEBUG: [watcher] noisy debug", "DEBUG: [hooks] hooks debug", "INFO: root info"}
+	for _, line := range expected {
+		if !strings.Contains(logContent, line) {
+			t.Errorf("Log should contain %q, got:\n%s", line, logContent)
+		}
+	}
+	unexpected := []string{"watcher info", "quiet info", "tui debug"}
+	for _, line := range unexpected {
+		if strings.Contains(logContent, line) {
+			t.Errorf("Log should not contain %q, got:\n%s", line, logContent)
+		}
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	tests := map[string]LogLevel{"debug": DEBUG, "INFO": INFO, "warning": WARN, "Error": ERROR}
+	for name, expected := range tests {
+		level, err := ParseLevel(name)
+		if err != nil || level != expected {
+			t.Errorf("ParseLevel(%q) = %v, %v; want %v", name, level, err, expected)
+		}
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("ParseLevel() should return error for an unknown level")
+	}
+}
+
+func TestOnEntry(t *testing.T) {
+	logger := New()
+	logger.SetConsole(io.Discard)
+	logger.SetLevels(map[string]LogLevel{"watcher": WARN})
+
+	var entries []Entry
+	logger.OnEntry(func(entry Entry) {
+		entries = append(entries, entry)
+	})
+
+	watcher := logger.Module("watcher")
+	watcher.Info("filtered out")
+	watcher.Rule("rule-1").Error("sync failed: %s", "no such key")
+	logger.Info("root info")
+
+	if len(entries) != 2 {
+		t.Fatalf("Listener got %d entries, want 2: %+v", len(entries), entries)
+	}
+	first := entries[0]
+	if first.Level != ERROR || first.Module != "watcher" || first.RuleID != "rule-1" || first.Message != "sync failed: no such key" {
+		t.Errorf("Unexpected entry %+v", first)
+	}
+	if entries[1].Level.String() != "INFO" || entries[1].Module != "" {
+		t.Errorf("Unexpected entry %+v", entries[1])
+	}
+}
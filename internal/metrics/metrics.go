@@ -0,0 +1,150 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"var-sync/internal/watcher"
+	"var-sync/pkg/models"
+)
+
+// Metrics collects sync counters for a Prometheus scrape. Sync results come
+// from the watcher's events and are kept per rule; drop counters are read
+// from the watcher when scraped.
+type Metrics struct {
+	rules map[string]*ruleMetrics
+	stats func() watcher.Stats
+	mutex sync.Mutex
+}
+
+// ruleMetrics holds the counters of a single rule
+type ruleMetrics struct {
+	successes   uint64
+	failures    uint64
+	conflicts   uint64
+	drifts      uint64
+	lastSync    float64 // Unix time of the last sync attempt
+	lastSuccess float64 // Unix time of the last successful sync
+}
+
+// New creates an empty set of metrics
+func New() *Metrics {
+	return &Metrics{rules: make(map[string]*ruleMetrics)}
+}
+
+// SetStats sets the function scrapes read the watcher's counters from
+func (m *Metrics) SetStats(stats func() watcher.Stats) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.stats = stats
+}
+
+// Record counts a sync event against its rule
+func (m *Metrics) Record(event models.SyncEvent) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	rule, ok := m.rules[event.RuleID]
+	if !ok {
+		rule = &ruleMetrics{}
+		m.rules[event.RuleID] = rule
+	}
+
+	timestamp := float64(event.Timestamp.UnixMilli()) / 1000
+	rule.lastSync = timestamp
+	if event.Success {
+		rule.successes++
+		rule.lastSuccess = timestamp
+	} else {
+		rule.failures++
+	}
+	if event.Conflict {
+		rule.conflicts++
+	}
+	if event.Drift {
+		rule.drifts++
+	}
+}
+
+// WriteTo writes every metric in the Prometheus text exposition format
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	m.mutex.Lock()
+	ids := make([]string, 0, len(m.rules))
+	rules := make(map[string]ruleMetrics, len(m.rules))
+	for id, rule := range m.rules {
+		ids = append(ids, id)
+		rules[id] = *rule
+	}
+	stats := m.stats
+	m.mutex.Unlock()
+	sort.Strings(ids)
+
+	var b strings.Builder
+	header(&b, "var_sync_syncs_total", "counter", "Sync attempts per rule and result.")
+	for _, id := range ids {
+		fmt.Fprintf(&b, "var_sync_syncs_total{rule=%s,result=\"success\"} %d\n", label(id), rules[id].successes)
+		fmt.Fprintf(&b, "var_sync_syncs_total{rule=%s,result=\"failure\"} %d\n", label(id), rules[id].failures)
+	}
+
+	header(&b, "var_sync_conflicts_total", "counter", "Syncs of target keys that were edited since the last sync.")
+	for _, id := range ids {
+		fmt.Fprintf(&b, "var_sync_conflicts_total{rule=%s} %d\n", label(id), rules[id].conflicts)
+	}
+
+	header(&b, "var_sync_drift_total", "counter", "Target keys found edited outside var-sync.")
+	for _, id := range ids {
+		fmt.Fprintf(&b, "var_sync_drift_total{rule=%s} %d\n", label(id), rules[id].drifts)
+	}
+
+	header(&b, "var_sync_last_sync_timestamp_seconds", "gauge", "Unix time of the last sync attempt per rule.")
+	for _, id := range ids {
+		fmt.Fprintf(&b, "var_sync_last_sync_timestamp_seconds{rule=%s} %.3f\n", label(id), rules[id].lastSync)
+	}
+
+	header(&b, "var_sync_last_success_timestamp_seconds", "gauge", "Unix time of the last successful sync per rule.")
+	for _, id := range ids {
+		if rules[id].lastSuccess > 0 {
+			fmt.Fprintf(&b, "var_sync_last_success_timestamp_seconds{rule=%s} %.3f\n", label(id), rules[id].lastSuccess)
+		}
+	}
+
+	if stats != nil {
+		s := stats()
+		header(&b, "var_sync_debounce_drops_total", "counter", "File changes ignored because they followed another too closely.")
+		fmt.Fprintf(&b, "var_sync_debounce_drops_total %d\n", s.DebounceDrops)
+		header(&b, "var_sync_events_dropped_total", "counter", "Sync events discarded because the event queue was full.")
+		fmt.Fprintf(&b, "var_sync_events_dropped_total %d\n", s.DroppedEvents)
+		header(&b, "var_sync_events_spilled_total", "counter", "Sync events written to the spill file because the event queue was full.")
+		fmt.Fprintf(&b, "var_sync_events_spilled_total %d\n", s.SpilledEvents)
+		header(&b, "var_sync_event_queue_length", "gauge", "Sync events waiting in the event queue.")
+		fmt.Fprintf(&b, "var_sync_event_queue_length %d\n", s.QueueLength)
+		header(&b, "var_sync_event_queue_capacity", "gauge", "Size of the event queue.")
+		fmt.Fprintf(&b, "var_sync_event_queue_capacity %d\n", s.QueueCapacity)
+	}
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+// ServeHTTP answers a Prometheus scrape
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+// header writes the HELP and TYPE lines of a metric
+func header(b *strings.Builder, name, kind, help string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// label quotes a label value, escaping backslashes, quotes and newlines
+func label(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return `"` + value + `"`
+}
@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"var-sync/internal/watcher"
+	"var-sync/pkg/models"
+)
+
+func TestMetricsExposition(t *testing.T) {
+	base := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	m := New()
+	m.Record(models.SyncEvent{RuleID: "db", Timestamp: base, Success: true})
+	m.Record(models.SyncEvent{RuleID: "db", Timestamp: base.Add(time.Minute), Success: false, Error: "boom"})
+	m.Record(models.SyncEvent{RuleID: "api", Timestamp: base, Success: false, Conflict: true})
+	m.Record(models.SyncEvent{RuleID: `we"ird`, Timestamp: base, Success: true, Drift: true})
+	m.SetStats(func() watcher.Stats {
+		return watcher.Stats{DebounceDrops: 4, DroppedEvents: 2, SpilledEvents: 3, QueueLength: 7, QueueCapacity: 100}
+	})
+
+	recorder := httptest.NewRecorder()
+	m.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+
+	output := recorder.Body.String()
+	expected := []string{
+		"# TYPE var_sync_syncs_total counter",
+		`var_sync_syncs_total{rule="db",result="success"} 1`,
+		`var_sync_syncs_total{rule="db",result="failure"} 1`,
+		`var_sync_syncs_total{rule="api",result="failure"} 1`,
+		`var_sync_syncs_total{rule="we\"ird",result="success"} 1`,
+		`var_sync_conflicts_total{rule="api"} 1`,
+		`var_sync_drift_total{rule="we\"ird"} 1`,
+		`var_sync_last_sync_timestamp_seconds{rule="db"} 1709294460.000`,
+		`var_sync_last_success_timestamp_seconds{rule="db"} 1709294400.000`,
+		"var_sync_debounce_drops_total 4",
+		"var_sync_events_dropped_total 2",
+		"var_sync_events_spilled_total 3",
+		"var_sync_event_queue_length 7",
+		"var_sync_event_queue_capacity 100",
+	}
+	for _, line := range expected {
+		if !strings.Contains(output, line+"\n") {
+			t.Errorf("Missing line %q in:\n%s", line, output)
+		}
+	}
+
+	// A rule that never succeeded has no last success time to alert on
+	if strings.Contains(output, `var_sync_last_success_timestamp_seconds{rule="api"}`) {
+		t.Errorf("Unexpected last success for a rule that never succeeded:\n%s", output)
+	}
+}
+
+func TestMetricsWithoutStats(t *testing.T) {
+	var b strings.Builder
+	if _, err := New().WriteTo(&b); err != nil {
+		t.Fatalf("WriteTo() error = %v", err)
+	}
+	if strings.Contains(b.String(), "var_sync_debounce_drops_total") {
+		t.Errorf("Watcher counters written without a watcher:\n%s", b.String())
+	}
+}
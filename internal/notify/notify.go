@@ -0,0 +1,166 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"var-sync/internal/logger"
+	"var-sync/pkg/models"
+)
+
+// notification is a message about one sync event
+type notification struct {
+	severity models.Severity
+	text     string
+	event    models.SyncEvent
+}
+
+// Dispatcher decides which sync events are worth telling operators about
+// and posts them to every notifier that wants them: every sync of a
+// high-priority rule, a rule failing repeatedly, and its recovery afterwards
+type Dispatcher struct {
+	notifiers []models.Notifier
+	rules     map[string]models.SyncRule
+	failures  map[string]int // Failures in a row per rule
+	client    *http.Client
+	logger    *logger.Logger
+	mutex     sync.Mutex
+	waitGroup sync.WaitGroup
+}
+
+// New creates a dispatcher for the notifiers in cfg
+func New(cfg *models.Config, logger *logger.Logger) *Dispatcher {
+	d := &Dispatcher{
+		notifiers: cfg.Notifications,
+		failures:  make(map[string]int),
+		client:    &http.Client{Timeout: 30 * time.Second},
+		logger:    logger.Module("notify"),
+	}
+	d.SetRules(cfg.Rules)
+	return d
+}
+
+// SetRules replaces the rules whose names and priorities notifications use,
+// such as after the config is reloaded
+func (d *Dispatcher) SetRules(rules []models.SyncRule) {
+	byID := make(map[string]models.SyncRule, len(rules))
+	for _, rule := range rules {
+		byID[rule.ID] = rule
+	}
+	d.mutex.Lock()
+	d.rules = byID
+	d.mutex.Unlock()
+}
+
+// Enabled reports whether any notifiers are configured
+func (d *Dispatcher) Enabled() bool {
+	return len(d.notifiers) > 0
+}
+
+// Record notes a sync event and sends whatever notifications it calls for
+func (d *Dispatcher) Record(event models.SyncEvent) {
+	d.mutex.Lock()
+	previous := d.failures[event.RuleID]
+	if event.Success {
+		delete(d.failures, event.RuleID)
+	} else {
+		d.failures[event.RuleID] = previous + 1
+	}
+	rule := d.rules[event.RuleID]
+	d.mutex.Unlock()
+
+	name := rule.Name
+	if name == "" {
+		name = event.RuleID
+	}
+
+	for _, notifier := range d.notifiers {
+		var note *notification
+		switch {
+		case !event.Success && previous+1 == notifier.Threshold():
+			note = &notification{models.SeverityError, fmt.Sprintf("Rule %s failed %d times in a row: %s", name, previous+1, event.Error), event}
+		case event.Success && previous >= notifier.Threshold():
+			note = &notification{models.SeverityInfo, fmt.Sprintf("Rule %s recovered after %d failed syncs", name, previous), event}
+		case rule.Priority == models.PriorityHigh && event.Success:
+			note = &notification{models.SeverityInfo, fmt.Sprintf("Rule %s synced %s to %s", name, event.TargetKey, event.TargetFile), event}
+		case rule.Priority == models.PriorityHigh:
+			note = &notification{models.SeverityWarning, fmt.Sprintf("Rule %s failed: %s", name, event.Error), event}
+		}
+
+		if note != nil && note.severity.Rank() >= notifier.MinSeverity.Rank() {
+			d.send(notifier, *note)
+		}
+	}
+}
+
+// Wait blocks until every notification being sent has finished
+func (d *Dispatcher) Wait() {
+	d.waitGroup.Wait()
+}
+
+// send posts note in the background so a slow chat service does not hold
+// up syncing
+func (d *Dispatcher) send(notifier models.Notifier, note notification) {
+	d.waitGroup.Add(1)
+	go func() {
+		defer d.waitGroup.Done()
+		if err := d.post(notifier, note); err != nil {
+			d.logger.Error("Failed to send %s notification: %v", notifier.Type, err)
+		}
+	}()
+}
+
+// post sends note to notifier in the format of its type
+func (d *Dispatcher) post(notifier models.Notifier, note notification) error {
+	body, err := json.Marshal(payload(notifier, note))
+	if err != nil {
+		return fmt.Errorf("failed to encode notification: %w", err)
+	}
+
+	resp, err := d.client.Post(notifier.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post to %s: %w", notifier.URL, err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("failed to post to %s: server returned %s", notifier.URL, resp.Status)
+	}
+	return nil
+}
+
+// payload returns the JSON body notifier expects for note
+func payload(notifier models.Notifier, note notification) map[string]any {
+	text := fmt.Sprintf("[var-sync] %s", note.text)
+	switch notifier.Type {
+	case models.NotifySlack:
+		body := map[string]any{"text": text}
+		if notifier.Channel != "" {
+			body["channel"] = notifier.Channel
+		}
+		return body
+	case models.NotifyDiscord:
+		return map[string]any{"content": text}
+	default:
+		body := map[string]any{
+			"severity":    note.severity,
+			"text":        note.text,
+			"rule_id":     note.event.RuleID,
+			"sequence":    note.event.Sequence,
+			"change_id":   note.event.ChangeID,
+			"target_file": note.event.TargetFile,
+			"target_key":  note.event.TargetKey,
+			"timestamp":   note.event.Timestamp.UTC().Format(time.RFC3339),
+		}
+		if notifier.Channel != "" {
+			body["channel"] = notifier.Channel
+		}
+		return body
+	}
+}
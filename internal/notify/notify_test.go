@@ -0,0 +1,98 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"var-sync/internal/logger"
+	"var-sync/pkg/models"
+)
+
+// chat records the bodies posted to it
+type chat struct {
+	server *httptest.Server
+	bodies []map[string]any
+	mutex  sync.Mutex
+}
+
+func newChat(t *testing.T) *chat {
+	c := &chat{}
+	c.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		json.NewDecoder(r.Body).Decode(&body)
+		c.mutex.Lock()
+		c.bodies = append(c.bodies, body)
+		c.mutex.Unlock()
+	}))
+	t.Cleanup(c.server.Close)
+	return c
+}
+
+func TestDispatcherRepeatedFailures(t *testing.T) {
+	slack := newChat(t)
+	cfg := &models.Config{
+		Rules: []models.SyncRule{{ID: "db", Name: "Database host"}},
+		Notifications: []models.Notifier{
+			{Type: models.NotifySlack, URL: slack.server.URL, Channel: "#ops", FailureThreshold: 2},
+		},
+	}
+
+	d := New(cfg, logger.New())
+	failure := models.SyncEvent{RuleID: "db", Timestamp: time.Now(), Success: false, Error: "boom"}
+	for i := 0; i < 3; i++ {
+		d.Record(failure)
+	}
+	d.Record(models.SyncEvent{RuleID: "db", Timestamp: time.Now(), Success: true})
+	d.Wait()
+
+	// One message when the threshold is reached, one on recovery
+	if len(slack.bodies) != 2 {
+		t.Fatalf("Expected 2 messages, got %+v", slack.bodies)
+	}
+	texts := map[any]bool{slack.bodies[0]["text"]: true, slack.bodies[1]["text"]: true}
+	if !texts["[var-sync] Rule Database host failed 2 times in a row: boom"] || !texts["[var-sync] Rule Database host recovered after 3 failed syncs"] {
+		t.Errorf("Unexpected messages: %+v", slack.bodies)
+	}
+	if slack.bodies[0]["channel"] != "#ops" {
+		t.Errorf("Channel = %v, want #ops", slack.bodies[0]["channel"])
+	}
+}
+
+func TestDispatcherHighPriorityAndSeverity(t *testing.T) {
+	discord := newChat(t)
+	webhook := newChat(t)
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "prod", Priority: models.PriorityHigh},
+			{ID: "dev"},
+		},
+		Notifications: []models.Notifier{
+			{Type: models.NotifyDiscord, URL: discord.server.URL},
+			{Type: models.NotifyWebhook, URL: webhook.server.URL, MinSeverity: models.SeverityWarning},
+		},
+	}
+
+	d := New(cfg, logger.New())
+	d.Record(models.SyncEvent{RuleID: "prod", TargetFile: "prod.env", TargetKey: "DB_HOST", Success: true})
+	d.Record(models.SyncEvent{RuleID: "dev", TargetFile: "dev.env", TargetKey: "DB_HOST", Success: true})
+	d.Record(models.SyncEvent{RuleID: "prod", Success: false, Error: "boom"})
+	d.Wait()
+
+	if len(discord.bodies) != 2 {
+		t.Fatalf("Expected both high-priority syncs on Discord, got %+v", discord.bodies)
+	}
+	for _, body := range discord.bodies {
+		if _, ok := body["content"]; !ok {
+			t.Errorf("Discord message without content: %+v", body)
+		}
+	}
+
+	// The webhook only wants warnings and above
+	if len(webhook.bodies) != 1 || webhook.bodies[0]["severity"] != "warning" || webhook.bodies[0]["rule_id"] != "prod" {
+		t.Errorf("Expected only the failure on the webhook, got %+v", webhook.bodies)
+	}
+}
@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"gopkg.in/yaml.v3"
+)
+
+// YAML anchors (&defaults), aliases (*defaults) and merge keys
+// (<<: *defaults) are resolved when a file is read, so production.host reads
+// the host production merges from defaults. Writing such a key updates the
+// value where the anchor defines it, leaving the aliases in place, so every
+// key sharing the anchor keeps sharing it.
+
+// resolveYAMLAlias returns the node an alias refers to
+func resolveYAMLAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// yamlMappingValue returns the key and value nodes of key in a mapping node,
+// looking in the mappings merged into it with << if the mapping does not set
+// key itself
+func yamlMappingValue(node *yaml.Node, key string) (*yaml.Node, *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		return nil, nil
+	}
+	var merges []*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		name, value := node.Content[i], node.Content[i+1]
+		if name.Value == key && name.Tag != "!!merge" {
+			return name, value
+		}
+		if name.Tag == "!!merge" || name.Value == "<<" {
+			merges = append(merges, value)
+		}
+	}
+
+	// Mappings merged earlier take precedence over later ones
+	for _, merge := range merges {
+		merge = resolveYAMLAlias(merge)
+		sources := []*yaml.Node{merge}
+		if merge.Kind == yaml.SequenceNode {
+			sources = merge.Content
+		}
+		for _, source := range sources {
+			source = resolveYAMLAlias(source)
+			if name, value := yamlMappingValue(source, key); value != nil {
+				return name, value
+			}
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,129 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const anchorsYAML = `defaults: &defaults
+  host: localhost # shared
+  port: 5432
+production:
+  <<: *defaults
+  port: 6432
+staging: *defaults
+timeout: &timeout 30
+retry_timeout: *timeout
+`
+
+func TestLoadYAMLAnchors(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(filePath, []byte(anchorsYAML), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	p := New()
+	data, err := p.LoadFile(filePath)
+	if err != nil {
+		t.Fatalf("LoadFile() returned error: %v", err)
+	}
+
+	tests := map[string]any{
+		"production.host": "localhost",
+		"production.port": int64(6432),
+		"staging.port":    int64(5432),
+		"retry_timeout":   int64(30),
+	}
+	for keyPath, expected := range tests {
+		if value, err := p.GetValue(data, keyPath); err != nil || !reflect.DeepEqual(value, expected) {
+			t.Errorf("GetValue(%s) = %v, %v, want %v", keyPath, value, err, expected)
+		}
+	}
+}
+
+func TestUpdateFileValuesYAMLAnchors(t *testing.T) {
+	tests := []struct {
+		name     string
+		updates  map[string]any
+		expected string
+	}{
+		{
+			name:    "merged key updates the anchor",
+			updates: map[string]any{"production.host": "db.internal"},
+			expected: `defaults: &defaults
+  host: db.internal # shared
+  port: 5432
+production:
+  <<: *defaults
+  port: 6432
+staging: *defaults
+timeout: &timeout 30
+retry_timeout: *timeout
+`,
+		},
+		{
+			name:    "key overriding a merge is updated in place",
+			updates: map[string]any{"production.port": 7432},
+			expected: `defaults: &defaults
+  host: localhost # shared
+  port: 5432
+production:
+  <<: *defaults
+  port: 7432
+staging: *defaults
+timeout: &timeout 30
+retry_timeout: *timeout
+`,
+		},
+		{
+			name:    "aliased mapping updates the anchor",
+			updates: map[string]any{"staging.port": 5433},
+			expected: `defaults: &defaults
+  host: localhost # shared
+  port: 5433
+production:
+  <<: *defaults
+  port: 6432
+staging: *defaults
+timeout: &timeout 30
+retry_timeout: *timeout
+`,
+		},
+		{
+			name:    "anchored and aliased scalars keep the anchor",
+			updates: map[string]any{"retry_timeout": 60},
+			expected: `defaults: &defaults
+  host: localhost # shared
+  port: 5432
+production:
+  <<: *defaults
+  port: 6432
+staging: *defaults
+timeout: &timeout 60
+retry_timeout: *timeout
+`,
+		},
+	}
+
+	p := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(anchorsYAML), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if err := p.UpdateFileValues(filePath, tt.updates); err != nil {
+				t.Fatalf("UpdateFileValues() returned error: %v", err)
+			}
+
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("UpdateFileValues() wrote:\n%s\nwant:\n%s", content, tt.expected)
+			}
+		})
+	}
+}
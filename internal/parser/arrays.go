@@ -0,0 +1,364 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"var-sync/pkg/models"
+)
+
+// Array operations in key paths let rules maintain lists rather than single
+// indexes: items[+] appends a value to items unless it already holds it,
+// items[-1] or items[last] is the last element (and items[-2] the one
+// before), and items[=value] is the element equal to value. Selected elements can be
+// replaced, or removed by setting them to Deleted.
+
+// arrayOpPattern matches a key segment with an array operation
+var arrayOpPattern = regexp.MustCompile(`^("(?:[^"\\]|\\.)*"|[^["]+)\[(\+|-\d+|last|=.*)\]$`)
+
+// HasArrayOp reports whether keyPath appends to or selects from an array with
+// [+], [-n], [last] or [=value]
+func HasArrayOp(keyPath string) bool {
+	for _, segment := range splitKeyPath(keyPath) {
+		if arrayOpPattern.MatchString(segment) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasArrayOps reports whether any of updates has an array operation
+func hasArrayOps(updates map[string]any) bool {
+	for keyPath := range updates {
+		if HasArrayOp(keyPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// AppendPath returns the path of the array that keyPath appends to with
+// [+], and whether it does
+func AppendPath(keyPath string) (string, bool) {
+	if !strings.HasSuffix(keyPath, "[+]") || !HasArrayOp(keyPath) {
+		return keyPath, false
+	}
+	return strings.TrimSuffix(keyPath, "[+]"), true
+}
+
+// ElementPath returns the key path that selects the element of the array at
+// arrayPath equal to value, and whether value can be selected that way
+func ElementPath(arrayPath string, value any) (string, bool) {
+	if isStructuredValue(value) || value == nil || value == Deleted {
+		return "", false
+	}
+	return fmt.Sprintf("%s[=%s]", arrayPath, formatScalar(value)), true
+}
+
+// resolveArrayPath replaces the [-n], [last] and [=value] selectors in keyPath with
+// the index of the element they select in data. A trailing [+] is left as it
+// is.
+func (p *Parser) resolveArrayPath(data map[string]any, keyPath string) (string, error) {
+	segments := splitKeyPath(keyPath)
+	for i, segment := range segments {
+		matches := arrayOpPattern.FindStringSubmatch(segment)
+		if matches == nil {
+			continue
+		}
+		key, op := matches[1], matches[2]
+		if op == "+" {
+			if i != len(segments)-1 {
+				return "", fmt.Errorf("invalid key path %s: [+] can only end a key path", keyPath)
+			}
+			continue
+		}
+
+		arrayPath := joinKeyPath(append(append([]string(nil), segments[:i]...), key))
+		value, err := p.GetValue(data, arrayPath)
+		if err != nil {
+			return "", err
+		}
+		var array []any
+		switch v := value.(type) {
+		case []any:
+			array = v
+		case []map[string]any:
+			// TOML arrays of tables
+			for _, table := range v {
+				array = append(array, table)
+			}
+		default:
+			return "", fmt.Errorf("key %s is not an array, cannot use [%s]", arrayPath, op)
+		}
+
+		index := -1
+		if op == "last" {
+			index = len(array) - 1
+		} else if wanted, found := strings.CutPrefix(op, "="); found {
+			for j, element := range array {
+				if !isStructuredValue(element) && formatScalar(element) == wanted {
+					index = j
+					break
+				}
+			}
+		} else if n, err := strconv.Atoi(op); err == nil && len(array)+n >= 0 {
+			index = len(array) + n
+		}
+		if index < 0 {
+			return "", fmt.Errorf("%w: %s", ErrKeyNotFound, joinKeyPath(segments[:i+1]))
+		}
+		segments[i] = fmt.Sprintf("%s[%d]", key, index)
+	}
+	return joinKeyPath(segments), nil
+}
+
+// appendValue appends value to the array at arrayPath, creating the array if
+// data does not have it. A value the array already holds is not added again.
+func (p *Parser) appendValue(data map[string]any, arrayPath string, value any) error {
+	var array []any
+	if current, err := p.GetValue(data, arrayPath); err == nil {
+		var ok bool
+		if array, ok = current.([]any); !ok {
+			return fmt.Errorf("key %s is not an array, cannot append to it", arrayPath)
+		}
+	}
+	if arrayHolds(p, array, value) {
+		return nil
+	}
+	return p.SetValue(data, arrayPath, append(array, value))
+}
+
+// arrayHolds reports whether array has an element equal to value
+func arrayHolds(p *Parser, array []any, value any) bool {
+	for _, element := range array {
+		if p.ValuesEqual(element, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// Holds reports whether data already has value at keyPath, so that writing it
+// would change nothing. For [+] paths this means the array holds the value,
+// and for Deleted that the key is gone.
+func (p *Parser) Holds(data map[string]any, keyPath string, value any) bool {
+	if arrayPath, ok := AppendPath(keyPath); ok {
+		if value == Deleted {
+			return true
+		}
+		current, err := p.GetValue(data, arrayPath)
+		array, _ := current.([]any)
+		return err == nil && arrayHolds(p, array, value)
+	}
+
+	current, err := p.GetValue(data, keyPath)
+	if value == Deleted {
+		return err != nil
+	}
+	return err == nil && p.ValuesEqual(current, value)
+}
+
+// applyArrayOps applies the updates whose key paths have array operations
+// to content, editing YAML sequences and single line TOML arrays in place and
+// rewriting other formats. It returns the new content and the updates still
+// to be applied to it. JSON files are left to SetValue and DeleteValue, which
+// handle array operations themselves.
+func (p *Parser) applyArrayOps(filepath string, content []byte, updates map[string]any) ([]byte, map[string]any, error) {
+	var ops []string
+	for keyPath := range updates {
+		if HasArrayOp(keyPath) {
+			ops = append(ops, keyPath)
+		}
+	}
+	format := models.DetectFormat(filepath)
+	if len(ops) == 0 || format == models.FormatJSON {
+		return content, updates, nil
+	}
+	sort.Strings(ops)
+
+	data, err := p.Parse(filepath, format, content)
+	if err != nil {
+		return nil, nil, err
+	}
+	remaining := make(map[string]any, len(updates))
+	for keyPath, value := range updates {
+		if !HasArrayOp(keyPath) {
+			remaining[keyPath] = value
+		}
+	}
+
+	text := string(content)
+	rewrite := false
+	for _, keyPath := range ops {
+		value := updates[keyPath]
+		resolved, err := p.resolveArrayPath(data, keyPath)
+		if err != nil {
+			if value == Deleted && errors.Is(err, ErrKeyNotFound) {
+				continue // Already removed
+			}
+			return nil, nil, err
+		}
+
+		// Operations before the last segment only pick the element to update
+		segments := splitKeyPath(keyPath)
+		if !arrayOpPattern.MatchString(segments[len(segments)-1]) {
+			remaining[resolved] = value
+			continue
+		}
+		if p.Holds(data, resolved, value) {
+			continue
+		}
+
+		// Work out the array the operation leaves behind
+		arrayPath, _ := AppendPath(resolved)
+		index := -1
+		if matches := arrayIndexPattern.FindStringSubmatch(resolved); matches != nil {
+			arrayPath = matches[1]
+			index, _ = strconv.Atoi(matches[2])
+		}
+		switch {
+		case index < 0:
+			err = p.appendValue(data, arrayPath, value)
+		case value == Deleted:
+			err = p.DeleteValue(data, resolved)
+		default:
+			err = p.SetValue(data, resolved, value)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if rewrite {
+			continue
+		}
+
+		edited, ok := "", false
+		switch format {
+		case models.FormatYAML:
+			edited, ok = editYAMLArray(text, arrayPath, index, value)
+		case models.FormatTOML:
+			array, _ := p.GetValue(data, arrayPath)
+			edited, ok = p.editTOMLArray(text, arrayPath, array)
+		}
+		if ok {
+			text = edited
+		} else {
+			rewrite = true
+		}
+	}
+
+	if rewrite {
+		// The arrays cannot be edited in place, so the file is encoded again
+		for keyPath, value := range remaining {
+			if value == Deleted {
+				p.DeleteValue(data, keyPath)
+			} else if err := p.SetValue(data, keyPath, value); err != nil {
+				return nil, nil, err
+			}
+		}
+		output, err := p.marshalFile(filepath, data)
+		return output, nil, err
+	}
+	return []byte(text), remaining, nil
+}
+
+// arrayIndexPattern splits a key path ending in an array index into the path
+// of the array and the index
+var arrayIndexPattern = regexp.MustCompile(`^(.*)\[(\d+)\]$`)
+
+// editYAMLArray edits the block sequence at arrayPath in YAML content:
+// appending value if index is negative, removing the element at index if
+// value is Deleted and replacing it otherwise. It reports false if the array
+// cannot be edited in place, such as a flow sequence or an element that is an
+// object.
+func editYAMLArray(content, arrayPath string, index int, value any) (string, bool) {
+	if isStructuredValue(value) {
+		return "", false
+	}
+	lines := strings.Split(content, "\n")
+	block, ok := yamlBlocks(lines)[canonicalKeyPath(arrayPath)]
+	if !ok {
+		return "", false
+	}
+	if _, inline, _ := strings.Cut(strings.TrimSpace(lines[block.line]), ":"); strings.TrimSpace(strings.SplitN(inline, " #", 2)[0]) != "" {
+		return "", false
+	}
+
+	// Find the line of each element
+	var items []int
+	itemIndent := -1
+	for i := block.line + 1; i <= block.end; i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(lines[i]) - len(strings.TrimLeft(lines[i], " "))
+		if itemIndent < 0 {
+			itemIndent = indent
+		}
+		if indent == itemIndent {
+			if trimmed != "-" && !strings.HasPrefix(trimmed, "- ") {
+				return "", false
+			}
+			items = append(items, i)
+		} else if index >= 0 && len(items) == index+1 {
+			return "", false // The element spans several lines
+		}
+	}
+
+	if index < 0 {
+		if itemIndent < 0 {
+			itemIndent = block.indent + yamlIndentUnit(lines)
+		}
+		line := strings.Repeat(" ", itemIndent) + "- " + formatYAMLValue(value)
+		return insertLines(lines, block.end, []string{line}), true
+	}
+	if index >= len(items) {
+		return "", false
+	}
+
+	at := items[index]
+	if value == Deleted {
+		return strings.Join(append(lines[:at], lines[at+1:]...), "\n"), true
+	}
+	prefix := lines[at][:strings.Index(lines[at], "-")+1]
+	comment := ""
+	if hash := strings.Index(lines[at], " #"); hash >= 0 {
+		comment = lines[at][hash:]
+	}
+	lines[at] = prefix + " " + formatYAMLValue(value) + comment
+	return strings.Join(lines, "\n"), true
+}
+
+// editTOMLArray writes array as the value of the single line array at
+// arrayPath in TOML content. It reports false if the array spans several
+// lines or holds tables.
+func (p *Parser) editTOMLArray(content, arrayPath string, array any) (string, bool) {
+	elements, ok := array.([]any)
+	if !ok {
+		return "", false
+	}
+	formatted := make([]string, len(elements))
+	for i, element := range elements {
+		if isStructuredValue(element) {
+			return "", false
+		}
+		formatted[i] = formatTOMLValue(element)
+	}
+
+	lines := strings.Split(content, "\n")
+	context, ok := p.findTOMLValue(p.parseTOMLStructure(lines), arrayPath)
+	if !ok {
+		return "", false
+	}
+	line := lines[context.lineNumber]
+	value := line[context.valueStart:context.valueEnd]
+	if !strings.HasPrefix(value, "[") || !strings.HasSuffix(value, "]") {
+		return "", false
+	}
+	lines[context.lineNumber] = line[:context.valueStart] + "[" + strings.Join(formatted, ", ") + "]" + line[context.valueEnd:]
+	return strings.Join(lines, "\n"), true
+}
@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestArrayOpsGetValue(t *testing.T) {
+	p := New()
+	data := map[string]any{
+		"hosts":   []any{"a.example.com", "b.example.com", "c.example.com"},
+		"servers": []any{map[string]any{"name": "web", "port": int64(80)}},
+	}
+
+	tests := []struct {
+		keyPath  string
+		expected any
+	}{
+		{"hosts[-1]", "c.example.com"},
+		{"hosts[-3]", "a.example.com"},
+		{"hosts[=b.example.com]", "b.example.com"},
+		{"servers[-1].port", int64(80)},
+		{"hosts[last]", "c.example.com"},
+		{"servers[last].name", "web"},
+	}
+	for _, tt := range tests {
+		value, err := p.GetValue(data, tt.keyPath)
+		if err != nil {
+			t.Errorf("GetValue(%s) returned error: %v", tt.keyPath, err)
+		} else if value != tt.expected {
+			t.Errorf("GetValue(%s) = %v, want %v", tt.keyPath, value, tt.expected)
+		}
+	}
+
+	for _, keyPath := range []string{"hosts[-4]", "hosts[=d.example.com]", "hosts[+]"} {
+		if _, err := p.GetValue(data, keyPath); !errors.Is(err, ErrKeyNotFound) {
+			t.Errorf("GetValue(%s) returned %v, want ErrKeyNotFound", keyPath, err)
+		}
+	}
+}
+
+func TestArrayOpsSetValue(t *testing.T) {
+	p := New()
+	data := map[string]any{"hosts": []any{"a", "b"}}
+
+	for _, update := range []struct {
+		keyPath string
+		value   any
+	}{
+		{"hosts[+]", "c"},
+		{"hosts[+]", "c"}, // Already held, not added again
+		{"hosts[=a]", "z"},
+		{"hosts[-2]", "y"},
+		{"ports[+]", int64(80)},
+	} {
+		if err := p.SetValue(data, update.keyPath, update.value); err != nil {
+			t.Fatalf("SetValue(%s) returned error: %v", update.keyPath, err)
+		}
+	}
+	if err := p.DeleteValue(data, "hosts[=y]"); err != nil {
+		t.Fatalf("DeleteValue() returned error: %v", err)
+	}
+
+	expected := map[string]any{"hosts": []any{"z", "c"}, "ports": []any{int64(80)}}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("array operations left %v, want %v", data, expected)
+	}
+	if err := p.SetValue(data, "hosts[+].name", "x"); err == nil {
+		t.Error("SetValue() should fail for [+] before the end of a key path")
+	}
+}
+
+func TestUpdateFileValuesArrayOps(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		updates  map[string]any
+		expected string
+	}{
+		{
+			name:     "config.yaml",
+			content:  "allowed_hosts:\n  - a.example.com # primary\n  - b.example.com\nport: 80\n",
+			updates:  map[string]any{"allowed_hosts[+]": "c.example.com", "allowed_hosts[=b.example.com]": Deleted, "port": 8080},
+			expected: "allowed_hosts:\n  - a.example.com # primary\n  - c.example.com\nport: 8080\n",
+		},
+		{
+			name:     "replace.yaml",
+			content:  "allowed_hosts:\n  - a.example.com # primary\n  - b.example.com\n",
+			updates:  map[string]any{"allowed_hosts[-2]": "z.example.com", "allowed_hosts[+]": "b.example.com"},
+			expected: "allowed_hosts:\n  - z.example.com # primary\n  - b.example.com\n",
+		},
+		{
+			name:     "servers.yaml",
+			content:  "servers:\n  - name: web\n    host: web-1 # first\n  - name: db\n    host: db-1\n",
+			updates:  map[string]any{"servers[-1].host": "db-2", "servers[last].name": "database"},
+			expected: "servers:\n  - name: web\n    host: web-1 # first\n  - name: database\n    host: db-2\n",
+		},
+		{
+			name:     "servers.toml",
+			content:  "[[servers]]\nname = \"web\"\nhost = \"web-1\"\n\n[[servers]]\nname = \"db\"\nhost = \"db-1\" # last\n",
+			updates:  map[string]any{"servers[last].host": "db-2"},
+			expected: "[[servers]]\nname = \"web\"\nhost = \"web-1\"\n\n[[servers]]\nname = \"db\"\nhost = \"db-2\" # last\n",
+		},
+		{
+			name:     "config.toml",
+			content:  "# Hosts\nallowed_hosts = [\"a\", \"b\"] # trusted\n\n[server]\nport = 80\n",
+			updates:  map[string]any{"allowed_hosts[+]": "c", "allowed_hosts[-2]": Deleted, "server.port": 8080},
+			expected: "# Hosts\nallowed_hosts = [\"a\", \"c\"] # trusted\n\n[server]\nport = 8080\n",
+		},
+		{
+			name:     "config.json",
+			content:  "{\n  \"allowed_hosts\": [\"a\", \"b\"]\n}",
+			updates:  map[string]any{"allowed_hosts[+]": "c", "allowed_hosts[=a]": Deleted},
+			expected: "{\n  \"allowed_hosts\": [\n    \"b\",\n    \"c\"\n  ]\n}",
+		},
+		{
+			name:     "servers.json",
+			content:  "{\n  \"servers\": [\n    {\"host\": \"web-1\"},\n    {\"host\": \"db-1\"}\n  ]\n}",
+			updates:  map[string]any{"servers[last].host": "db-2"},
+			expected: "{\n  \"servers\": [\n    {\n      \"host\": \"web-1\"\n    },\n    {\n      \"host\": \"db-2\"\n    }\n  ]\n}",
+		},
+	}
+
+	p := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.name)
+			if err := os.WriteFile(filePath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if err := p.UpdateFileValues(filePath, tt.updates); err != nil {
+				t.Fatalf("UpdateFileValues() returned error: %v", err)
+			}
+
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("UpdateFileValues() wrote:\n%s\nwant:\n%s", content, tt.expected)
+			}
+		})
+	}
+}
+
+func TestHolds(t *testing.T) {
+	p := New()
+	data := map[string]any{"hosts": []any{"a"}, "port": int64(80)}
+
+	tests := []struct {
+		keyPath  string
+		value    any
+		expected bool
+	}{
+		{"hosts[+]", "a", true},
+		{"hosts[+]", "b", false},
+		{"hosts[=b]", Deleted, true},
+		{"hosts[=a]", Deleted, false},
+		{"port", 80, true},
+		{"port", 81, false},
+	}
+	for _, tt := range tests {
+		if got := p.Holds(data, tt.keyPath, tt.value); got != tt.expected {
+			t.Errorf("Holds(%s, %v) = %v, want %v", tt.keyPath, tt.value, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package parser
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// blockHeaderPattern matches the header of a YAML block scalar: | or > with
+// an optional chomping indicator (- or +) and indentation indicator, in
+// either order
+var blockHeaderPattern = regexp.MustCompile(`^([|>])(?:([-+]?)([1-9]?)|([1-9])([-+]))$`)
+
+// blockScalar is a | or > block scalar in a YAML file
+type blockScalar struct {
+	style       string // | or >
+	indentation string // The indentation indicator, if any
+	indent      int    // The indentation of the content lines
+	end         int    // The last line of the block
+}
+
+// parseBlockScalar finds the lines of the block scalar whose header is on
+// line at in lines. The content is indented past indent, the indentation of
+// the key holding it.
+func parseBlockScalar(lines []string, at, indent int, header string) blockScalar {
+	matches := blockHeaderPattern.FindStringSubmatch(header)
+	block := blockScalar{style: matches[1], indentation: matches[3] + matches[4], indent: -1, end: at}
+	keep := matches[2] == "+" || matches[5] == "+"
+
+	for i := at + 1; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		lineIndent := len(lines[i]) - len(strings.TrimLeft(lines[i], " "))
+		if trimmed == "" {
+			if keep {
+				block.end = i // Kept trailing blank lines belong to the block
+			}
+			continue
+		}
+		if lineIndent <= indent {
+			break
+		}
+		if block.indent < 0 {
+			block.indent = lineIndent
+		}
+		block.end = i
+	}
+	if block.indent < 0 {
+		block.indent = indent + yamlIndentUnit(lines)
+	}
+	return block
+}
+
+// formatBlockScalar writes value as the block scalar replacing block,
+// keeping its style and indentation. It returns the new header and content
+// lines, choosing the chomping indicator that reads back the value's trailing
+// newlines. Values that are not strings, or that a block cannot hold as they
+// are, are written inline with no content lines.
+func formatBlockScalar(block blockScalar, value any) (string, []string) {
+	text, ok := value.(string)
+	if !ok || strings.HasPrefix(text, " ") || strings.IndexFunc(text, unprintable) >= 0 {
+		return formatYAMLValue(value), nil
+	}
+
+	body := strings.TrimRight(text, "\n")
+	trailing := len(text) - len(body)
+	chomp := ""
+	switch {
+	case trailing == 0:
+		chomp = "-"
+	case trailing > 1:
+		chomp = "+"
+	}
+
+	// Folding would join the lines of a multi-line value, so it is written
+	// as a literal block
+	style := block.style
+	if style == ">" && strings.Contains(body, "\n") {
+		style = "|"
+	}
+
+	prefix := strings.Repeat(" ", block.indent)
+	var content []string
+	if body != "" {
+		for _, line := range strings.Split(body, "\n") {
+			if line == "" {
+				content = append(content, "")
+			} else {
+				content = append(content, prefix+line)
+			}
+		}
+	}
+	for i := 1; i < trailing; i++ {
+		content = append(content, "")
+	}
+	return style + block.indentation + chomp, content
+}
+
+// unprintable reports whether r must be escaped to be held in YAML, as only a
+// double-quoted scalar can
+func unprintable(r rune) bool {
+	return r != '\n' && !unicode.IsPrint(r)
+}
@@ -0,0 +1,90 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateFileValuesBlockScalars(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		updates  map[string]any
+		expected string
+	}{
+		{
+			name:     "literal",
+			content:  "server:\n  motd: |\n    Welcome\n    to the server\n  # Port to listen on\n  port: 80\n",
+			updates:  map[string]any{"server.motd": "Hello\nand goodbye\n"},
+			expected: "server:\n  motd: |\n    Hello\n    and goodbye\n  # Port to listen on\n  port: 80\n",
+		},
+		{
+			name:     "strip",
+			content:  "script: |-\n  echo one\n  echo two\nname: build\n",
+			updates:  map[string]any{"script": "echo three"},
+			expected: "script: |-\n  echo three\nname: build\n",
+		},
+		{
+			name:     "folded",
+			content:  "description: >\n    A long\n    description\nversion: 1\n",
+			updates:  map[string]any{"description": "A short one\n"},
+			expected: "description: >\n    A short one\nversion: 1\n",
+		},
+		{
+			name:     "folded multi-line",
+			content:  "description: >\n  A long\n  description\n",
+			updates:  map[string]any{"description": "one\ntwo\n"},
+			expected: "description: |\n  one\n  two\n",
+		},
+		{
+			name:     "keep",
+			content:  "banner: |+\n  hi\n\n\nport: 80\n",
+			updates:  map[string]any{"banner": "bye\n\n"},
+			expected: "banner: |+\n  bye\n\nport: 80\n",
+		},
+		{
+			name:     "inline",
+			content:  "timeout: |\n  30\nname: app\n",
+			updates:  map[string]any{"timeout": 60},
+			expected: "timeout: 60\nname: app\n",
+		},
+		{
+			name:     "content like keys",
+			content:  "config: |\n  port: 80\n  host: localhost\nport: 9000\n",
+			updates:  map[string]any{"port": 9001},
+			expected: "config: |\n  port: 80\n  host: localhost\nport: 9001\n",
+		},
+	}
+
+	p := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if err := p.UpdateFileValues(filePath, tt.updates); err != nil {
+				t.Fatalf("UpdateFileValues() returned error: %v", err)
+			}
+
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("UpdateFileValues() wrote:\n%s\nwant:\n%s", content, tt.expected)
+			}
+
+			data, err := p.LoadFile(filePath)
+			if err != nil {
+				t.Fatalf("LoadFile() returned error: %v", err)
+			}
+			for keyPath, value := range tt.updates {
+				if got, _ := p.GetValue(data, keyPath); !p.ValuesEqual(got, value) {
+					t.Errorf("GetValue(%s) = %q after update, want %q", keyPath, got, value)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,240 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"var-sync/pkg/models"
+)
+
+// deletedValue is the type of Deleted
+type deletedValue struct{}
+
+// Deleted is an update value that removes its key path from the file rather
+// than setting it, as when the key it was synced from was removed
+var Deleted any = deletedValue{}
+
+// hasDeletes reports whether any of updates removes its key path
+func hasDeletes(updates map[string]any) bool {
+	for _, value := range updates {
+		if value == Deleted {
+			return true
+		}
+	}
+	return false
+}
+
+// DeleteValue removes keyPath from data. An array element is removed from its
+// array, moving the elements after it up.
+func (p *Parser) DeleteValue(data map[string]any, keyPath string) error {
+	if HasArrayOp(keyPath) {
+		if _, ok := AppendPath(keyPath); ok {
+			return fmt.Errorf("cannot remove %s: [+] selects no element", keyPath)
+		}
+		resolved, err := p.resolveArrayPath(data, keyPath)
+		if err != nil {
+			return err
+		}
+		keyPath = resolved
+	}
+	path, err := ParseKeyPath(keyPath)
+	if err != nil {
+		return err
+	}
+	if HasWildcard(keyPath) {
+		return fmt.Errorf("cannot remove %s: wildcards are not supported", keyPath)
+	}
+	segments := path.Segments()
+	last := segments[len(segments)-1]
+	var parent any = data
+	if len(segments) > 1 {
+		if parent, err = p.GetValue(data, strings.TrimSuffix(keyPath[:last.Offset], ".")); err != nil {
+			return err
+		}
+	}
+
+	key, index := last.Key, last.Index
+	object, ok := parent.(map[string]any)
+	if !ok {
+		return fmt.Errorf("key path %s does not point to an object", keyPath)
+	}
+	value, exists := object[key]
+	if !exists {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, keyPath)
+	}
+	if index < 0 {
+		delete(object, key)
+		return nil
+	}
+
+	array, ok := value.([]any)
+	if !ok {
+		return fmt.Errorf("key %s is not an array, cannot use index [%d]", key, index)
+	}
+	if index >= len(array) {
+		return fmt.Errorf("%w: %s", ErrKeyNotFound, keyPath)
+	}
+	object[key] = append(array[:index:index], array[index+1:]...)
+	return nil
+}
+
+// removeDeletedKeys removes the key paths that updates set to Deleted from
+// content, leaving the lines around them as they are. It returns the new
+// content and the updates still to be applied to it. Keys the file does not
+// have are already removed.
+func (p *Parser) removeDeletedKeys(filepath string, content []byte, updates map[string]any) ([]byte, map[string]any, error) {
+	if !hasDeletes(updates) {
+		return content, updates, nil
+	}
+
+	format := models.DetectFormat(filepath)
+	data, err := p.Parse(filepath, format, content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	remaining := make(map[string]any, len(updates))
+	var deleted []string
+	for keyPath, value := range updates {
+		if value != Deleted {
+			remaining[keyPath] = value
+		} else if _, err := p.GetValue(data, keyPath); err == nil {
+			deleted = append(deleted, keyPath)
+		}
+	}
+	// Later array elements go first, so that removing one does not move the
+	// others
+	sort.Sort(sort.Reverse(sort.StringSlice(deleted)))
+
+	if format == models.FormatJSON {
+		output, err := p.removeJSONKeys(content, deleted)
+		return output, remaining, err
+	}
+
+	text := string(content)
+	for _, keyPath := range deleted {
+		switch format {
+		case models.FormatYAML:
+			text, err = removeYAMLKey(text, keyPath)
+		case models.FormatTOML:
+			text, err = removeTOMLKey(text, keyPath)
+		case models.FormatENV:
+			text = removeEnvKey(text, keyPath)
+		default:
+			err = fmt.Errorf("cannot remove %s: not supported for %s files", keyPath, format)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return []byte(text), remaining, nil
+}
+
+// removeJSONKeys removes key paths from a JSON document and encodes it again
+func (p *Parser) removeJSONKeys(content []byte, keyPaths []string) ([]byte, error) {
+	if len(keyPaths) == 0 {
+		return content, nil
+	}
+
+	var data map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return nil, fmt.Errorf("failed to parse json file: %w", err)
+	}
+	for _, keyPath := range keyPaths {
+		if err := p.DeleteValue(data, keyPath); err != nil {
+			return nil, err
+		}
+	}
+
+	output, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal json data: %w", err)
+	}
+	return output, nil
+}
+
+// removeYAMLKey removes a key from YAML content along with everything nested
+// below it
+func removeYAMLKey(content, keyPath string) (string, error) {
+	lines := strings.Split(content, "\n")
+	block, ok := yamlBlocks(lines)[canonicalKeyPath(keyPath)]
+	if !ok {
+		return "", fmt.Errorf("cannot remove %s: keys within arrays cannot be removed", keyPath)
+	}
+	return strings.Join(append(lines[:block.line], lines[block.end+1:]...), "\n"), nil
+}
+
+// removeTOMLKey removes a key from TOML content, or a whole table with the
+// tables nested in it
+func removeTOMLKey(content, keyPath string) (string, error) {
+	lines := strings.Split(content, "\n")
+	tables, _ := tomlTables(lines)
+	keyPath = canonicalKeyPath(keyPath)
+
+	if _, ok := tables[keyPath]; ok {
+		// Remove the table up to the next table that is not nested in it
+		var kept []string
+		removing := false
+		for _, line := range lines {
+			trimmed := strings.TrimSpace(line)
+			if strings.HasPrefix(trimmed, "[") {
+				name := strings.TrimLeft(trimmed, "[")
+				if end := strings.Index(name, "]"); end >= 0 {
+					name = canonicalKeyPath(strings.TrimSpace(name[:end]))
+				}
+				removing = name == keyPath || strings.HasPrefix(name, keyPath+".")
+			}
+			if !removing {
+				kept = append(kept, line)
+			}
+		}
+		return strings.Join(kept, "\n"), nil
+	}
+
+	table := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[[") {
+			table = "[]"
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") {
+			if end := strings.Index(trimmed, "]"); end > 0 {
+				table = canonicalKeyPath(strings.TrimSpace(trimmed[1:end]))
+			}
+			continue
+		}
+		key, _, found := strings.Cut(trimmed, "=")
+		if !found || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		path := canonicalKeyPath(strings.TrimSpace(key))
+		if table != "" {
+			path = table + "." + path
+		}
+		if path == keyPath {
+			return strings.Join(append(lines[:i], lines[i+1:]...), "\n"), nil
+		}
+	}
+	return "", fmt.Errorf("cannot remove %s: it is not a key or table of its own", keyPath)
+}
+
+// removeEnvKey removes the assignment of key from .env content
+func removeEnvKey(content, key string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if assignment, _, found := strings.Cut(trimmed, "="); found && envKey(assignment) == key {
+			return strings.Join(append(lines[:i], lines[i+1:]...), "\n")
+		}
+	}
+	return content
+}
@@ -0,0 +1,89 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateFileValuesDeletesKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		updates  map[string]any
+		expected string
+	}{
+		{
+			name:     "config.yaml",
+			content:  "database:\n  host: localhost # primary\n  pool:\n    max: 10\n  port: 5432\napp: demo\n",
+			updates:  map[string]any{"database.pool": Deleted, "database.port": Deleted, "app": "demo2", "missing": Deleted},
+			expected: "database:\n  host: localhost # primary\napp: demo2\n",
+		},
+		{
+			name:     "config.toml",
+			content:  "title = \"demo\"\n\n[database]\nhost = \"localhost\"\nport = 5432\n\n[cache]\nhost = \"redis\"\n\n[cache.pool]\nmax = 10\n\n[server]\nport = 80\n",
+			updates:  map[string]any{"database.port": Deleted, "cache": Deleted},
+			expected: "title = \"demo\"\n\n[database]\nhost = \"localhost\"\n\n[server]\nport = 80\n",
+		},
+		{
+			name:     "config.env",
+			content:  "# Database\nDB_HOST=localhost\nexport DB_PORT=5432\n",
+			updates:  map[string]any{"DB_PORT": Deleted},
+			expected: "# Database\nDB_HOST=localhost\n",
+		},
+		{
+			name:     "config.json",
+			content:  "{\n  \"database\": {\n    \"host\": \"localhost\",\n    \"port\": 5432\n  },\n  \"servers\": [\"a\", \"b\", \"c\"]\n}",
+			updates:  map[string]any{"database.port": Deleted, "servers[1]": Deleted},
+			expected: "{\n  \"database\": {\n    \"host\": \"localhost\"\n  },\n  \"servers\": [\n    \"a\",\n    \"c\"\n  ]\n}",
+		},
+	}
+
+	p := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.name)
+			if err := os.WriteFile(filePath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if err := p.UpdateFileValues(filePath, tt.updates); err != nil {
+				t.Fatalf("UpdateFileValues() returned error: %v", err)
+			}
+
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("UpdateFileValues() wrote:\n%s\nwant:\n%s", content, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDeleteValue(t *testing.T) {
+	p := New()
+	data := map[string]any{
+		"database": map[string]any{"host": "localhost", "port": 5432},
+		"servers":  []any{"a", "b"},
+	}
+
+	if err := p.DeleteValue(data, "database.port"); err != nil {
+		t.Fatalf("DeleteValue() returned error: %v", err)
+	}
+	if err := p.DeleteValue(data, "servers[0]"); err != nil {
+		t.Fatalf("DeleteValue() returned error: %v", err)
+	}
+	expected := map[string]any{
+		"database": map[string]any{"host": "localhost"},
+		"servers":  []any{"b"},
+	}
+	if !reflect.DeepEqual(data, expected) {
+		t.Errorf("DeleteValue() left %v, want %v", data, expected)
+	}
+
+	if err := p.DeleteValue(data, "database.port"); err == nil {
+		t.Error("DeleteValue() should fail for a missing key")
+	}
+}
@@ -0,0 +1,366 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"var-sync/internal/textfile"
+)
+
+// A Dockerfile is read as the variables its ENV and ARG instructions set, by
+// name, such as the base image version in ARG NODE_VERSION=20. A name set by
+// several instructions, as an ARG declared again in each build stage is,
+// reads as its last value and is updated everywhere it is set.
+
+// dockerVariable is a variable set by an ENV or ARG instruction
+type dockerVariable struct {
+	name  string
+	value string // The value with its quotes and escapes removed
+	start int    // The byte offsets of the value as written
+	end   int
+}
+
+// plainDockerValue matches values written without quotes
+var plainDockerValue = regexp.MustCompile(`^[A-Za-z0-9_.,:/@%+=-]+$`)
+
+// parseDockerfile reads the variables of a Dockerfile
+func (p *Parser) parseDockerfile(content string) (map[string]any, error) {
+	result := make(map[string]any)
+	for _, variable := range dockerfileVariables(content) {
+		result[variable.name] = ParseEnvValue(variable.value)
+	}
+	return result, nil
+}
+
+// dockerfileVariables finds every variable set by the ENV and ARG
+// instructions of content, in order. ARG instructions without a default set
+// no value and are left out.
+func dockerfileVariables(content string) []dockerVariable {
+	var variables []dockerVariable
+	for pos := 0; pos < len(content); {
+		start := pos
+		for start < len(content) && (content[start] == ' ' || content[start] == '\t') {
+			start++
+		}
+		end := dockerInstructionEnd(content, start)
+		pos = end + 1
+
+		if start < end && content[start] != '#' {
+			word := start
+			for word < end && content[word] != ' ' && content[word] != '\t' {
+				word++
+			}
+			switch strings.ToUpper(content[start:word]) {
+			case "ENV":
+				variables = append(variables, dockerAssignments(content, word, end, true)...)
+			case "ARG":
+				variables = append(variables, dockerAssignments(content, word, end, false)...)
+			}
+		}
+	}
+	return variables
+}
+
+// dockerInstructionEnd returns the offset of the newline ending the
+// instruction starting at start, following lines continued with a backslash
+func dockerInstructionEnd(content string, start int) int {
+	for {
+		newline := strings.IndexByte(content[start:], '\n')
+		if newline < 0 {
+			return len(content)
+		}
+		end := start + newline
+		if !strings.HasSuffix(strings.TrimRight(content[start:end], " \t"), `\`) {
+			return end
+		}
+		start = end + 1
+	}
+}
+
+// dockerAssignments reads the name=value pairs of an instruction between
+// start and end. An ENV instruction may instead be written as ENV name value,
+// where the value is the rest of the instruction.
+func dockerAssignments(content string, start, end int, env bool) []dockerVariable {
+	var variables []dockerVariable
+	for pos := skipDockerSpace(content, start, end); pos < end; pos = skipDockerSpace(content, pos, end) {
+		wordEnd := dockerWordEnd(content, pos, end)
+		word := content[pos:wordEnd]
+		equals := strings.IndexByte(word, '=')
+
+		if equals < 0 {
+			if env && len(variables) == 0 {
+				// ENV name value
+				valueStart := skipDockerSpace(content, wordEnd, end)
+				valueEnd := end
+				for valueEnd > valueStart && strings.ContainsRune(" \t\\", rune(content[valueEnd-1])) {
+					valueEnd--
+				}
+				return []dockerVariable{{name: word, value: dockerUnquote(content[valueStart:valueEnd]), start: valueStart, end: valueEnd}}
+			}
+			pos = wordEnd // An ARG without a default
+			continue
+		}
+
+		variables = append(variables, dockerVariable{
+			name:  word[:equals],
+			value: dockerUnquote(word[equals+1:]),
+			start: pos + equals + 1,
+			end:   wordEnd,
+		})
+		pos = wordEnd
+	}
+	return variables
+}
+
+// skipDockerSpace skips whitespace and line continuations from pos
+func skipDockerSpace(content string, pos, end int) int {
+	for pos < end {
+		switch content[pos] {
+		case ' ', '\t', '\n':
+			pos++
+		case '\\':
+			next, ok := dockerContinuation(content, pos, end)
+			if !ok {
+				return pos
+			}
+			pos = next
+		default:
+			return pos
+		}
+	}
+	return pos
+}
+
+// dockerContinuation reports whether the backslash at pos continues the
+// instruction on the next line, returning the offset that line starts at
+func dockerContinuation(content string, pos, end int) (int, bool) {
+	next := pos + 1
+	for next < end && (content[next] == ' ' || content[next] == '\t') {
+		next++
+	}
+	if next < end && content[next] != '\n' {
+		return pos, false
+	}
+	return min(next+1, end), true
+}
+
+// dockerWordEnd returns the offset just past the word starting at pos, which
+// runs to the next whitespace outside quotes
+func dockerWordEnd(content string, pos, end int) int {
+	var quote byte
+	for ; pos < end; pos++ {
+		c := content[pos]
+		switch {
+		case c == '\\' && quote != '\'':
+			next, continued := dockerContinuation(content, pos, end)
+			if continued && quote == 0 {
+				return pos
+			}
+			if continued {
+				pos = next - 1
+			} else {
+				pos++ // An escaped character, such as a space
+			}
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ' ' || c == '\t' || c == '\n':
+			return pos
+		}
+	}
+	return end
+}
+
+// dockerUnquote removes the quotes and escapes of a value as written
+func dockerUnquote(raw string) string {
+	var b strings.Builder
+	var quote byte
+	for i := 0; i < len(raw); i++ {
+		c := raw[i]
+		switch {
+		case c == '\\' && quote != '\'' && i+1 < len(raw):
+			next := raw[i+1]
+			if quote == '"' && !strings.ContainsRune(`"\$`, rune(next)) {
+				b.WriteByte(c)
+				continue
+			}
+			i++
+			if next != '\n' {
+				b.WriteByte(next)
+			}
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// formatDockerValue writes a value for an ENV or ARG instruction, quoting it
+// unless it is plain
+func formatDockerValue(value any) (string, error) {
+	text := formatKubernetesValue(value)
+	if strings.ContainsAny(text, "\r\n") {
+		return "", fmt.Errorf("a Dockerfile value cannot hold a line break")
+	}
+	if plainDockerValue.MatchString(text) {
+		return text, nil
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`).Replace(text) + `"`, nil
+}
+
+// renderDockerfileValues applies updates to the variables of a Dockerfile
+func (p *Parser) renderDockerfileValues(content string, updates map[string]any) (string, error) {
+	variables := dockerfileVariables(content)
+
+	type edit struct {
+		start, end int
+		text       string
+	}
+	var edits []edit
+	for name, value := range updates {
+		text, err := formatDockerValue(value)
+		if err != nil {
+			return "", fmt.Errorf("failed to update %s: %w", name, err)
+		}
+		found := false
+		for _, variable := range variables {
+			if variable.name == name {
+				edits = append(edits, edit{variable.start, variable.end, text})
+				found = true
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("%w: %s", ErrKeyNotFound, name)
+		}
+	}
+
+	// From the end, so that earlier offsets stay valid
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	for _, e := range edits {
+		content = content[:e.start] + e.text + content[e.end:]
+	}
+	return content, nil
+}
+
+// updateDockerfileValues updates variables of a Dockerfile in place
+func (p *Parser) updateDockerfileValues(filepath string, updates map[string]any) error {
+	content, err := textfile.Read(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	newContent, err := p.renderDockerfileValues(string(content), updates)
+	if err != nil {
+		return err
+	}
+
+	return textfile.Write(filepath, []byte(newContent))
+}
+
+// formatDockerfile writes variables as ENV instructions
+func (p *Parser) formatDockerfile(data map[string]any) (string, error) {
+	names := make([]string, 0, len(data))
+	for name := range data {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	for _, name := range names {
+		text, err := formatDockerValue(data[name])
+		if err != nil {
+			return "", fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		fmt.Fprintf(&b, "ENV %s=%s\n", name, text)
+	}
+	return b.String(), nil
+}
+
+// A docker-compose file may give a service's environment as a list of
+// NAME=value strings rather than a mapping. Either way its variables read as
+// services.<service>.environment.<NAME>, and updates to them are written back
+// in the form the file uses.
+
+// composeServices returns the services of a docker-compose document, or nil
+// for any other document
+func composeServices(data map[string]any) map[string]any {
+	services, _ := data["services"].(map[string]any)
+	return services
+}
+
+// decodeComposeEnvironment replaces each list of NAME=value strings under a
+// service's environment with a mapping from names to values
+func decodeComposeEnvironment(data map[string]any) {
+services:
+	for _, service := range composeServices(data) {
+		definition, ok := service.(map[string]any)
+		if !ok {
+			continue
+		}
+		entries, ok := definition["environment"].([]any)
+		if !ok {
+			continue
+		}
+		environment := make(map[string]any, len(entries))
+		for _, entry := range entries {
+			text, ok := entry.(string)
+			if !ok {
+				continue services // Not a list of NAME=value strings
+			}
+			name, value, _ := strings.Cut(text, "=")
+			environment[name] = ParseEnvValue(value)
+		}
+		definition["environment"] = environment
+	}
+}
+
+// composeUpdates converts updates to variables of a service environment given
+// as a list into updates of the NAME=value element setting them. Other updates
+// are returned unchanged.
+func composeUpdates(content string, updates map[string]any) (map[string]any, error) {
+	var document map[string]any
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil || composeServices(document) == nil {
+		return updates, nil
+	}
+
+	result := make(map[string]any, len(updates))
+	for keyPath, value := range updates {
+		segments := splitKeyPath(keyPath)
+		if len(segments) != 4 || segments[0] != "services" || segments[2] != "environment" {
+			result[keyPath] = value
+			continue
+		}
+		service, _ := composeServices(document)[segments[1]].(map[string]any)
+		entries, ok := service["environment"].([]any)
+		if !ok {
+			result[keyPath] = value
+			continue
+		}
+
+		index := -1
+		for i, entry := range entries {
+			if text, ok := entry.(string); ok && (text == segments[3] || strings.HasPrefix(text, segments[3]+"=")) {
+				index = i
+			}
+		}
+		if index < 0 {
+			return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, keyPath)
+		}
+		if value == Deleted {
+			return nil, fmt.Errorf("cannot remove %s: not supported for environment lists", keyPath)
+		}
+		result[fmt.Sprintf("services.%s.environment[%d]", quoteKey(segments[1]), index)] = segments[3] + "=" + formatKubernetesValue(value)
+	}
+	return result, nil
+}
@@ -0,0 +1,187 @@
+package parser
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const dockerfile = `# syntax=docker/dockerfile:1
+ARG NODE_VERSION=20.11
+FROM node:${NODE_VERSION}-alpine AS build
+ARG NODE_VERSION=20.11
+ARG BUILD_ONLY
+ENV APP_HOME=/srv/app \
+    GREETING="hello world" LOG_LEVEL=info
+env LEGACY some value # not a comment
+ENV ESCAPED=a\ b
+RUN echo "ENV NOT_A_VARIABLE=1"
+`
+
+func TestLoadFileDockerfile(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "Dockerfile")
+	if err := os.WriteFile(filePath, []byte(dockerfile), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	data, err := New().LoadFile(filePath)
+	if err != nil {
+		t.Fatalf("LoadFile() returned error: %v", err)
+	}
+	expected := map[string]any{
+		"NODE_VERSION": 20.11,
+		"APP_HOME":     "/srv/app",
+		"GREETING":     "hello world",
+		"LOG_LEVEL":    "info",
+		"LEGACY":       "some value # not a comment",
+		"ESCAPED":      "a b",
+	}
+	if len(data) != len(expected) {
+		t.Errorf("LoadFile() = %v, want %d variables", data, len(expected))
+	}
+	for name, value := range expected {
+		if data[name] != value {
+			t.Errorf("%s = %#v, want %#v", name, data[name], value)
+		}
+	}
+}
+
+func TestUpdateFileValuesDockerfile(t *testing.T) {
+	tests := []struct {
+		name     string
+		updates  map[string]any
+		expected string
+	}{
+		{
+			name:    "every stage",
+			updates: map[string]any{"NODE_VERSION": "22.2"},
+			expected: `# syntax=docker/dockerfile:1
+ARG NODE_VERSION=22.2
+FROM node:${NODE_VERSION}-alpine AS build
+ARG NODE_VERSION=22.2
+ARG BUILD_ONLY
+ENV APP_HOME=/srv/app \
+    GREETING="hello world" LOG_LEVEL=info
+env LEGACY some value # not a comment
+ENV ESCAPED=a\ b
+RUN echo "ENV NOT_A_VARIABLE=1"
+`,
+		},
+		{
+			name:    "continued and quoted",
+			updates: map[string]any{"GREETING": `say "hi" to $USER`, "LOG_LEVEL": "debug", "LEGACY": "other", "ESCAPED": 5},
+			expected: `# syntax=docker/dockerfile:1
+ARG NODE_VERSION=20.11
+FROM node:${NODE_VERSION}-alpine AS build
+ARG NODE_VERSION=20.11
+ARG BUILD_ONLY
+ENV APP_HOME=/srv/app \
+    GREETING="say \"hi\" to \$USER" LOG_LEVEL=debug
+env LEGACY other
+ENV ESCAPED=5
+RUN echo "ENV NOT_A_VARIABLE=1"
+`,
+		},
+	}
+
+	p := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "Dockerfile")
+			if err := os.WriteFile(filePath, []byte(dockerfile), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if err := p.UpdateFileValues(filePath, tt.updates); err != nil {
+				t.Fatalf("UpdateFileValues() returned error: %v", err)
+			}
+
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("UpdateFileValues() wrote:\n%s\nwant:\n%s", content, tt.expected)
+			}
+			data, err := p.LoadFile(filePath)
+			if err != nil {
+				t.Fatalf("LoadFile() returned error: %v", err)
+			}
+			for name, value := range tt.updates {
+				if !p.Holds(data, name, value) {
+					t.Errorf("%s reads back as %#v, want %#v", name, data[name], value)
+				}
+			}
+		})
+	}
+
+	filePath := filepath.Join(t.TempDir(), "api.Dockerfile")
+	if err := os.WriteFile(filePath, []byte(dockerfile), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	if err := p.UpdateFileValues(filePath, map[string]any{"BUILD_ONLY": "x"}); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("UpdateFileValues() = %v, want ErrKeyNotFound for an ARG without a default", err)
+	}
+	if err := p.UpdateFileValues(filePath, map[string]any{"GREETING": "two\nlines"}); err == nil {
+		t.Error("UpdateFileValues() should refuse a value with a line break")
+	}
+}
+
+func TestUpdateFileValuesCompose(t *testing.T) {
+	content := `services:
+  api:
+    image: api:1.0
+    environment:
+      - NODE_ENV=production
+      - PORT=8080
+      - PASSTHROUGH
+  worker:
+    environment:
+      QUEUE: jobs
+`
+	filePath := filepath.Join(t.TempDir(), "docker-compose.yaml")
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	p := New()
+	data, err := p.LoadFile(filePath)
+	if err != nil {
+		t.Fatalf("LoadFile() returned error: %v", err)
+	}
+	if value, _ := p.GetValue(data, "services.api.environment.PORT"); value != int64(8080) {
+		t.Errorf("services.api.environment.PORT = %#v, want 8080", value)
+	}
+
+	updates := map[string]any{
+		"services.api.environment.PORT":     9090,
+		"services.api.environment.NODE_ENV": "staging env",
+		"services.worker.environment.QUEUE": "urgent",
+		"services.api.image":                "api:1.1",
+	}
+	if err := p.UpdateFileValues(filePath, updates); err != nil {
+		t.Fatalf("UpdateFileValues() returned error: %v", err)
+	}
+	written, err := os.ReadFile(filePath)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	expected := `services:
+  api:
+    image: "api:1.1"
+    environment:
+      - "NODE_ENV=staging env"
+      - PORT=9090
+      - PASSTHROUGH
+  worker:
+    environment:
+      QUEUE: urgent
+`
+	if string(written) != expected {
+		t.Errorf("UpdateFileValues() wrote:\n%s\nwant:\n%s", written, expected)
+	}
+
+	if err := p.UpdateFileValues(filePath, map[string]any{"services.api.environment.MISSING": 1}); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("UpdateFileValues() = %v, want ErrKeyNotFound", err)
+	}
+}
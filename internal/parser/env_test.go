@@ -34,6 +34,17 @@ EMPTY_VALUE=""`,
 				"EMPTY_VALUE": "",
 			},
 		},
+		{
+			name: "escapes in double-quoted values",
+			content: `MOTD="line one\nline two"
+QUOTE="say \"hi\" to C:\\dir"
+RAW='no\nescapes'`,
+			expected: map[string]any{
+				"MOTD":  "line one\nline two",
+				"QUOTE": `say "hi" to C:\dir`,
+				"RAW":   `no\nescapes`,
+			},
+		},
 		{
 			name: "boolean and numeric values",
 			content: `DEBUG=true
@@ -382,4 +393,38 @@ API_URL=http://localhost:3000`
 	if resultContent != expectedContent {
 		t.Errorf("UpdateFileValues() result:\n%s\n\nExpected:\n%s", resultContent, expectedContent)
 	}
-}
\ No newline at end of file
+}
+
+func TestExportScript(t *testing.T) {
+	parser := New()
+	path := t.TempDir() + "/exports.sh"
+
+	content := "#!/bin/sh\nexport DB_HOST=localhost\nexport DB_PORT=5432\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write content: %v", err)
+	}
+
+	result, err := parser.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if result["DB_HOST"] != "localhost" || result["DB_PORT"] != int64(5432) {
+		t.Errorf("LoadFile() = %v, expected export prefixes to be dropped", result)
+	}
+
+	if err := parser.UpdateFileValues(path, map[string]any{"DB_HOST": "db.internal"}); err != nil {
+		t.Fatalf("UpdateFileValues() error = %v", err)
+	}
+	updated, _ := os.ReadFile(path)
+	if string(updated) != "#!/bin/sh\nexport DB_HOST=db.internal\nexport DB_PORT=5432\n" {
+		t.Errorf("UpdateFileValues() = %q, expected export lines preserved", updated)
+	}
+
+	if err := parser.SaveFile(path, map[string]any{"DB_HOST": "x"}); err != nil {
+		t.Fatalf("SaveFile() error = %v", err)
+	}
+	saved, _ := os.ReadFile(path)
+	if !strings.HasPrefix(string(saved), "export DB_HOST=x") {
+		t.Errorf("SaveFile() = %q, expected export line", saved)
+	}
+}
@@ -0,0 +1,575 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// Expressions compute a value from a source document: a rule's source_expr
+// computes the value it syncs instead of reading one key, and its when
+// condition decides whether it syncs at all. An expression holding {{ is a
+// Go text/template rendered with the document, such as
+// "{{ .database.host }}:{{ .database.port }}", and always gives a string.
+//
+// Any other expression combines key paths, numbers, 'quoted' or "quoted"
+// strings, true, false and null with + - * / %, the comparisons == != < <=
+// > >=, && || ! and parentheses, such as api.timeout * 1000 or
+// source.env == "production". A key path may start with source., which
+// names the document itself, so a top-level key named source is read as
+// source.source. A key path runs until whitespace or an operator other than
+// -, so a hyphenated key such as max-retries needs no quotes, and
+// subtracting from a key path needs spaces around the -. exists(keypath)
+// reports whether the document has a key.
+
+// exprNode evaluates part of an expression against a document
+type exprNode func(data map[string]any) (any, error)
+
+// IsTemplateExpression reports whether a source expression is a template
+// rather than arithmetic
+func IsTemplateExpression(expr string) bool {
+	return strings.Contains(expr, "{{")
+}
+
+// ValidateExpression reports an expression that cannot be evaluated against
+// any document, such as one with unbalanced parentheses
+func ValidateExpression(expr string) error {
+	if IsTemplateExpression(expr) {
+		_, err := parseExprTemplate(expr)
+		return err
+	}
+	_, err := parseExpression(expr, false)
+	return err
+}
+
+// EvaluateExpression computes the value of a source expression for data. A
+// key path the document does not have is an error wrapping ErrKeyNotFound.
+func (p *Parser) EvaluateExpression(data map[string]any, expr string) (any, error) {
+	if IsTemplateExpression(expr) {
+		tmpl, err := parseExprTemplate(expr)
+		if err != nil {
+			return nil, err
+		}
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, data); err != nil {
+			return nil, fmt.Errorf("failed to evaluate %q: %w", expr, err)
+		}
+		return out.String(), nil
+	}
+
+	node, err := parseExpression(expr, false)
+	if err != nil {
+		return nil, err
+	}
+	return node(data)
+}
+
+// EvaluateCondition reports whether a condition holds for data. Key paths the
+// document does not have read as null rather than failing, so that
+// source.env == "production" is simply false without an env key. A template
+// holds when it renders as true.
+func (p *Parser) EvaluateCondition(data map[string]any, expr string) (bool, error) {
+	if IsTemplateExpression(expr) {
+		value, err := p.EvaluateExpression(data, expr)
+		if err != nil {
+			return false, err
+		}
+		return strings.TrimSpace(value.(string)) == "true", nil
+	}
+
+	node, err := parseExpression(expr, true)
+	if err != nil {
+		return false, err
+	}
+	value, err := node(data)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate %q: %w", expr, err)
+	}
+	return truthy(value), nil
+}
+
+// parseExprTemplate parses a template expression. A key the document does
+// not have is an error rather than <no value>.
+func parseExprTemplate(expr string) (*template.Template, error) {
+	tmpl, err := template.New("expression").Option("missingkey=error").Parse(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", expr, err)
+	}
+	return tmpl, nil
+}
+
+// ExpressionKeys returns the key paths an expression reads, "" for the whole
+// document, and false if they cannot be told: for a template, which may read
+// any key, or an expression that does not parse
+func ExpressionKeys(expr string) ([]string, bool) {
+	if IsTemplateExpression(expr) {
+		return nil, false
+	}
+	ep := &exprParser{p: New(), expr: expr}
+	if _, err := ep.parse(); err != nil {
+		return nil, false
+	}
+	return ep.keys, true
+}
+
+// exprParser is a recursive descent parser for expressions. With lenient
+// set, key paths the document does not have read as null. The key paths
+// read are collected in keys.
+type exprParser struct {
+	p       *Parser
+	expr    string
+	pos     int
+	lenient bool
+	keys    []string
+}
+
+// parseExpression parses an expression into a node evaluating it
+func parseExpression(expr string, lenient bool) (exprNode, error) {
+	ep := &exprParser{p: New(), expr: expr, lenient: lenient}
+	return ep.parse()
+}
+
+// parse parses the whole expression
+func (ep *exprParser) parse() (exprNode, error) {
+	node, err := ep.or()
+	if err == nil && ep.peek() != 0 {
+		err = fmt.Errorf("unexpected %q at offset %d", ep.expr[ep.pos], ep.pos)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid expression %q: %w", ep.expr, err)
+	}
+	return node, nil
+}
+
+// peek skips whitespace and returns the next character, or 0 at the end
+func (ep *exprParser) peek() byte {
+	for ep.pos < len(ep.expr) && strings.IndexByte(" \t\r\n", ep.expr[ep.pos]) >= 0 {
+		ep.pos++
+	}
+	if ep.pos == len(ep.expr) {
+		return 0
+	}
+	return ep.expr[ep.pos]
+}
+
+// operator consumes the first of ops found next, returning "" if none is
+func (ep *exprParser) operator(ops ...string) string {
+	ep.peek()
+	for _, op := range ops {
+		if strings.HasPrefix(ep.expr[ep.pos:], op) {
+			ep.pos += len(op)
+			return op
+		}
+	}
+	return ""
+}
+
+// binary parses operands joined by any of ops, left to right
+func (ep *exprParser) binary(operand func() (exprNode, error), ops ...string) (exprNode, error) {
+	left, err := operand()
+	for err == nil {
+		op := ep.operator(ops...)
+		if op == "" {
+			break
+		}
+		var right exprNode
+		if right, err = operand(); err == nil {
+			left = binaryNode(op, left, right)
+		}
+	}
+	return left, err
+}
+
+// or parses conditions joined by ||
+func (ep *exprParser) or() (exprNode, error) {
+	return ep.binary(ep.and, "||")
+}
+
+// and parses comparisons joined by &&
+func (ep *exprParser) and() (exprNode, error) {
+	return ep.binary(ep.comparison, "&&")
+}
+
+// comparison parses sums compared with == != <= >= < >
+func (ep *exprParser) comparison() (exprNode, error) {
+	return ep.binary(ep.sum, "==", "!=", "<=", ">=", "<", ">")
+}
+
+// sum parses terms joined by + and -
+func (ep *exprParser) sum() (exprNode, error) {
+	return ep.binary(ep.term, "+", "-")
+}
+
+// term parses factors joined by *, / and %
+func (ep *exprParser) term() (exprNode, error) {
+	return ep.binary(ep.factor, "*", "/", "%")
+}
+
+// factor parses a negation, a parenthesized expression, a number, a string,
+// a function call or a key path
+func (ep *exprParser) factor() (exprNode, error) {
+	c := ep.peek()
+	start := ep.pos
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '-':
+		ep.pos++
+		operand, err := ep.factor()
+		if err != nil {
+			return nil, err
+		}
+		return binaryNode("-", constant(int64(0)), operand), nil
+	case c == '!':
+		ep.pos++
+		operand, err := ep.factor()
+		if err != nil {
+			return nil, err
+		}
+		return func(data map[string]any) (any, error) {
+			value, err := operand(data)
+			return err == nil && !truthy(value), err
+		}, nil
+	case c == '(':
+		ep.pos++
+		node, err := ep.or()
+		if err != nil {
+			return nil, err
+		}
+		if ep.peek() != ')' {
+			return nil, fmt.Errorf("missing ) for ( at offset %d", start)
+		}
+		ep.pos++
+		return node, nil
+	case c == '\'':
+		end := strings.IndexByte(ep.expr[start+1:], '\'')
+		if end < 0 {
+			return nil, fmt.Errorf("unterminated string at offset %d", start)
+		}
+		ep.pos = start + end + 2
+		return constant(ep.expr[start+1 : start+1+end]), nil
+	case c == '"':
+		if text, ok := ep.doubleQuoted(); ok {
+			return constant(text), nil
+		}
+	case c >= '0' && c <= '9':
+		for ep.pos < len(ep.expr) && (ep.expr[ep.pos] >= '0' && ep.expr[ep.pos] <= '9' || ep.expr[ep.pos] == '.') {
+			ep.pos++
+		}
+		literal := ep.expr[start:ep.pos]
+		if i, err := strconv.ParseInt(literal, 10, 64); err == nil {
+			return constant(i), nil
+		}
+		if f, err := strconv.ParseFloat(literal, 64); err == nil {
+			return constant(f), nil
+		}
+		return nil, fmt.Errorf("invalid number %s", literal)
+	case strings.IndexByte(")+*/%=<>&|", c) >= 0:
+		return nil, fmt.Errorf("unexpected %q at offset %d", c, start)
+	}
+
+	keyPath := ep.keyPath()
+	switch keyPath {
+	case "true":
+		return constant(true), nil
+	case "false":
+		return constant(false), nil
+	case "null":
+		return constant(nil), nil
+	}
+	if ep.pos < len(ep.expr) && ep.expr[ep.pos] == '(' {
+		return ep.call(keyPath)
+	}
+	return ep.readKey(keyPath, ep.lenient), nil
+}
+
+// doubleQuoted reads a "quoted" string, unless the quotes are those of a key
+// path segment, such as "example.com".port, which it leaves to be read
+func (ep *exprParser) doubleQuoted() (string, bool) {
+	var b strings.Builder
+	for i := ep.pos + 1; i < len(ep.expr); i++ {
+		switch c := ep.expr[i]; {
+		case c == '\\' && i+1 < len(ep.expr):
+			i++
+			b.WriteByte(ep.expr[i])
+		case c == '"':
+			if i+1 < len(ep.expr) && (ep.expr[i+1] == '.' || ep.expr[i+1] == '[') {
+				return "", false
+			}
+			ep.pos = i + 1
+			return b.String(), true
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", false
+}
+
+// call parses the argument of a function call and returns the node calling
+// it. The only function is exists, which takes a key path.
+func (ep *exprParser) call(name string) (exprNode, error) {
+	start := ep.pos
+	ep.pos++
+	if name != "exists" {
+		return nil, fmt.Errorf("unknown function %s at offset %d: only exists is supported", name, start)
+	}
+	ep.peek()
+	keyPath := ep.keyPath()
+	if keyPath == "" || ep.peek() != ')' {
+		return nil, fmt.Errorf("exists takes a key path, at offset %d", start)
+	}
+	ep.pos++
+
+	read := ep.readKey(keyPath, false)
+	return func(data map[string]any) (any, error) {
+		_, err := read(data)
+		if errors.Is(err, ErrKeyNotFound) {
+			return false, nil
+		}
+		return err == nil, err
+	}, nil
+}
+
+// readKey returns the node reading keyPath from the document. With lenient
+// set, a key the document does not have reads as null.
+func (ep *exprParser) readKey(keyPath string, lenient bool) exprNode {
+	switch {
+	case keyPath == "source":
+		keyPath = ""
+	case strings.HasPrefix(keyPath, "source."):
+		keyPath = strings.TrimPrefix(keyPath, "source.")
+	}
+	ep.keys = append(ep.keys, keyPath)
+	return func(data map[string]any) (any, error) {
+		if keyPath == "" {
+			return data, nil
+		}
+		value, err := ep.p.GetValue(data, keyPath)
+		if lenient && errors.Is(err, ErrKeyNotFound) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return NormalizeValue(value), nil
+	}
+}
+
+// keyPath reads a key path, which runs until whitespace or an operator
+// outside quotes and brackets
+func (ep *exprParser) keyPath() string {
+	start := ep.pos
+	depth, quoted := 0, false
+	for ; ep.pos < len(ep.expr); ep.pos++ {
+		c := ep.expr[ep.pos]
+		switch {
+		case c == '\\' && ep.pos+1 < len(ep.expr):
+			ep.pos++
+		case c == '"':
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			depth++
+		case c == ']' && depth > 0:
+			depth--
+		case depth > 0:
+		case strings.IndexByte(" \t\r\n+*/%()=!<>&|", c) >= 0:
+			return ep.expr[start:ep.pos]
+		}
+	}
+	return ep.expr[start:]
+}
+
+// constant returns a node whose value is value
+func constant(value any) exprNode {
+	return func(map[string]any) (any, error) { return value, nil }
+}
+
+// binaryNode applies an operator to the values of two nodes. && and || only
+// evaluate their right operand when it decides the result.
+func binaryNode(op string, left, right exprNode) exprNode {
+	return func(data map[string]any) (any, error) {
+		a, err := left(data)
+		if err != nil {
+			return nil, err
+		}
+		if (op == "&&" && !truthy(a)) || (op == "||" && truthy(a)) {
+			return truthy(a), nil
+		}
+		b, err := right(data)
+		if err != nil {
+			return nil, err
+		}
+		return applyOperator(op, a, b)
+	}
+}
+
+// applyOperator computes a op b. Numbers stay integers unless a float is
+// involved or a division leaves a remainder. + joins its operands as text
+// unless both are numbers; the other arithmetic operators also take text
+// holding a number, such as "30".
+func applyOperator(op string, a, b any) (any, error) {
+	switch op {
+	case "&&", "||":
+		return truthy(b), nil
+	case "==", "!=", "<", "<=", ">", ">=":
+		return compareValues(a, b, op)
+	}
+
+	if op == "+" && (!isNumber(a) || !isNumber(b)) {
+		return formatScalar(a) + formatScalar(b), nil
+	}
+	x, xNumber := exprNumber(a)
+	y, yNumber := exprNumber(b)
+	if !xNumber || !yNumber {
+		return nil, fmt.Errorf("cannot apply %s to %q and %q: not numbers", op, formatScalar(a), formatScalar(b))
+	}
+
+	xInt, xIsInt := x.(int64)
+	yInt, yIsInt := y.(int64)
+	if xIsInt && yIsInt {
+		switch op {
+		case "+":
+			return xInt + yInt, nil
+		case "-":
+			return xInt - yInt, nil
+		case "*":
+			return xInt * yInt, nil
+		case "/", "%":
+			if yInt == 0 {
+				return nil, errors.New("division by zero")
+			}
+			if op == "%" {
+				return xInt % yInt, nil
+			}
+			if xInt%yInt == 0 {
+				return xInt / yInt, nil
+			}
+		}
+	}
+
+	xFloat, yFloat := toFloat(x), toFloat(y)
+	switch op {
+	case "+":
+		return xFloat + yFloat, nil
+	case "-":
+		return xFloat - yFloat, nil
+	case "*":
+		return xFloat * yFloat, nil
+	}
+	if yFloat == 0 {
+		return nil, errors.New("division by zero")
+	}
+	if op == "%" {
+		return math.Mod(xFloat, yFloat), nil
+	}
+	return xFloat / yFloat, nil
+}
+
+// compareValues compares a and b as numbers when both are numbers, or text
+// holding one, and otherwise as text. null only equals null.
+func compareValues(a, b any, op string) (bool, error) {
+	var order int
+	x, xNumber := exprNumber(a)
+	y, yNumber := exprNumber(b)
+	switch {
+	case a == nil || b == nil:
+		if op != "==" && op != "!=" {
+			return false, nil
+		}
+		return (a == nil && b == nil) == (op == "=="), nil
+	case xNumber && yNumber:
+		order = compareFloats(toFloat(x), toFloat(y))
+	case isStructuredValue(a) || isStructuredValue(b):
+		if op != "==" && op != "!=" {
+			return false, fmt.Errorf("cannot compare objects or arrays with %s", op)
+		}
+		if !New().ValuesEqual(a, b) {
+			order = 1
+		}
+	default:
+		order = strings.Compare(formatScalar(a), formatScalar(b))
+	}
+
+	switch op {
+	case "==":
+		return order == 0, nil
+	case "!=":
+		return order != 0, nil
+	case "<":
+		return order < 0, nil
+	case "<=":
+		return order <= 0, nil
+	case ">":
+		return order > 0, nil
+	}
+	return order >= 0, nil
+}
+
+// compareFloats returns -1, 0 or 1 as x is less than, equal to or greater
+// than y
+func compareFloats(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+// truthy reports whether a value counts as true in a condition: anything but
+// null, false, zero and empty text
+func truthy(value any) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case int64:
+		return v != 0
+	case float64:
+		return v != 0
+	case string:
+		return v != ""
+	}
+	return true
+}
+
+// exprNumber returns a value as an int64 or float64, reading strings that
+// hold a number, and reports whether it is one
+func exprNumber(value any) (any, bool) {
+	switch v := value.(type) {
+	case int64, float64:
+		return v, true
+	case string:
+		if i, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+			return i, true
+		}
+		if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// isNumber reports whether value is an int64 or float64
+func isNumber(value any) bool {
+	switch value.(type) {
+	case int64, float64:
+		return true
+	}
+	return false
+}
+
+// toFloat returns an int64 or float64 as a float64
+func toFloat(value any) float64 {
+	if i, ok := value.(int64); ok {
+		return float64(i)
+	}
+	return value.(float64)
+}
@@ -0,0 +1,155 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"var-sync/pkg/models"
+)
+
+func TestEvaluateExpression(t *testing.T) {
+	p := New()
+	data := map[string]any{
+		"database":    map[string]any{"host": "db.internal", "port": int64(5432)},
+		"api":         map[string]any{"timeout": int64(30), "ratio": 0.5, "max-retries": int64(3), "limit": "100"},
+		"servers":     []any{map[string]any{"port": int64(80)}},
+		"example.com": map[string]any{"port": int64(443)},
+	}
+
+	tests := []struct {
+		expr     string
+		expected any
+	}{
+		{"{{ .database.host }}:{{ .database.port }}", "db.internal:5432"},
+		{"api.timeout * 1000", int64(30000)},
+		{"api.timeout / 4", 7.5},
+		{"api.timeout / 3", int64(10)},
+		{"api.timeout % 7", int64(2)},
+		{"api.timeout * api.ratio", 15.0},
+		{"(api.timeout + 10) * 2", int64(80)},
+		{"api.timeout + 10 * 2", int64(50)},
+		{"-api.timeout", int64(-30)},
+		{"api.max-retries - 1", int64(2)},
+		{"api.limit * 2", int64(200)},
+		{"database.host + ':' + database.port", "db.internal:5432"},
+		{"servers[0].port + 8000", int64(8080)},
+		{`"example.com".port`, int64(443)},
+		{"database", map[string]any{"host": "db.internal", "port": int64(5432)}},
+	}
+	for _, tt := range tests {
+		value, err := p.EvaluateExpression(data, tt.expr)
+		if err != nil {
+			t.Errorf("EvaluateExpression(%s) returned error: %v", tt.expr, err)
+		} else if !p.ValuesEqual(value, tt.expected) {
+			t.Errorf("EvaluateExpression(%s) = %#v, want %#v", tt.expr, value, tt.expected)
+		}
+	}
+
+	if _, err := p.EvaluateExpression(data, "api.missing * 2"); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("A missing key should return ErrKeyNotFound, got %v", err)
+	}
+	for _, expr := range []string{"database.host * 2", "api.timeout / 0", "{{ .database.name }}"} {
+		if _, err := p.EvaluateExpression(data, expr); err == nil {
+			t.Errorf("EvaluateExpression(%s) should fail", expr)
+		}
+	}
+}
+
+func TestValidateExpression(t *testing.T) {
+	for _, expr := range []string{"a.b * 1000", "(a + b) / 2", "{{ .a }}-{{ .b }}", "'v' + version"} {
+		if err := ValidateExpression(expr); err != nil {
+			t.Errorf("ValidateExpression(%s) returned error: %v", expr, err)
+		}
+	}
+	for _, expr := range []string{"(a + b", "a +", "a * * b", "'unterminated", "{{ .a ", "a b", ""} {
+		if err := ValidateExpression(expr); err == nil {
+			t.Errorf("ValidateExpression(%q) should fail", expr)
+		}
+	}
+}
+
+func TestExpressionKeys(t *testing.T) {
+	tests := []struct {
+		expr     string
+		expected []string
+		ok       bool
+	}{
+		{"api.timeout * 1000", []string{"api.timeout"}, true},
+		{"'v' + source.version + \"-\" + build", []string{"version", "build"}, true},
+		{"exists(db.host) && !debug", []string{"db.host", "debug"}, true},
+		{"source", []string{""}, true},
+		{"1 + 2", nil, true},
+		{"{{ .a }}", nil, false},
+		{"(a + b", nil, false},
+	}
+	for _, tt := range tests {
+		keys, ok := ExpressionKeys(tt.expr)
+		if ok != tt.ok || !reflect.DeepEqual(keys, tt.expected) {
+			t.Errorf("ExpressionKeys(%s) = %v, %v, want %v, %v", tt.expr, keys, ok, tt.expected, tt.ok)
+		}
+	}
+}
+
+func TestResolveRuleExpression(t *testing.T) {
+	p := New()
+	data := map[string]any{"api": map[string]any{"timeout": int64(30)}}
+
+	rule := models.SyncRule{SourceExpr: "api.timeout * 1000", TargetKey: "TIMEOUT_MS", TargetType: models.TypeString}
+	updates, err := p.ResolveRule(data, rule)
+	if err != nil || updates["TIMEOUT_MS"] != "30000" {
+		t.Errorf("ResolveRule() = %v, %v, want TIMEOUT_MS=30000", updates, err)
+	}
+
+	rule = models.SyncRule{SourceExpr: "api.retries + 1", TargetKey: "RETRIES", DeleteMissing: true}
+	if updates, err := p.ResolveRule(data, rule); err != nil || updates["RETRIES"] != Deleted {
+		t.Errorf("ResolveRule() = %v, %v, want RETRIES removed", updates, err)
+	}
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	p := New()
+	data := map[string]any{
+		"env":      "production",
+		"replicas": int64(3),
+		"debug":    false,
+		"tls":      map[string]any{"cert": "/etc/tls/cert.pem"},
+		"region":   "eu-west-1",
+	}
+
+	tests := []struct {
+		expr     string
+		expected bool
+	}{
+		{`source.env == "production"`, true},
+		{`source.env != 'production'`, false},
+		{`env == "staging"`, false},
+		{"exists(source.tls.cert)", true},
+		{"exists(source.tls.key)", false},
+		{"!exists(tls.key)", true},
+		{`source.replicas > 2 && source.env == "production"`, true},
+		{`source.replicas >= 5 || source.debug`, false},
+		{"source.replicas == 3.0", true},
+		{`source.missing == "production"`, false},
+		{"source.missing == null", true},
+		{"source.missing", false},
+		{"source.debug == false", true},
+		{"(source.replicas - 1) * 2 == 4", true},
+		{`source.region == "eu-west-1" && !source.debug`, true},
+		{`{{ eq .env "production" }}`, true},
+	}
+	for _, tt := range tests {
+		holds, err := p.EvaluateCondition(data, tt.expr)
+		if err != nil {
+			t.Errorf("EvaluateCondition(%s) returned error: %v", tt.expr, err)
+		} else if holds != tt.expected {
+			t.Errorf("EvaluateCondition(%s) = %t, want %t", tt.expr, holds, tt.expected)
+		}
+	}
+
+	for _, expr := range []string{"source.env = 'production'", "size(source.env)", "source.tls < 1"} {
+		if _, err := p.EvaluateCondition(data, expr); err == nil {
+			t.Errorf("EvaluateCondition(%s) should fail", expr)
+		}
+	}
+}
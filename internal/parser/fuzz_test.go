@@ -0,0 +1,219 @@
+package parser
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"slices"
+	"sort"
+	"testing"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+
+	"var-sync/internal/textfile"
+	"var-sync/pkg/models"
+)
+
+// The fuzz targets feed random documents and key paths to the parsers and
+// surgical updaters. Without -fuzz they run the seeds below as tests; to
+// fuzz, run one target at a time, for example:
+//
+//	go test ./internal/parser -run '^$' -fuzz FuzzUpdateYAML -fuzztime 1m
+//
+// Inputs that fail are saved under testdata/fuzz and run as tests from then
+// on.
+
+// fuzzDocuments seeds every fuzz target with documents of its format
+var fuzzDocuments = map[models.FileFormat][]string{
+	models.FormatENV: {
+		"HOST=localhost\nPORT=5432\n",
+		"# comment\nexport NAME=\"my app\"\nEMPTY=\nQUOTED='single'\n",
+		"A=1 # trailing comment\r\nB=\"x=y\"\n",
+	},
+	models.FormatYAML: {
+		"database:\n  host: localhost\n  port: 5432\n",
+		"# comment\nservers:\n  - host: a\n    port: 80\n  - host: b\nflags: [x, y]\n",
+		"base: &base\n  timeout: 30\nprod:\n  <<: *base\n  name: \"prod\" # trailing\nbody: |\n  line one\n  line two\n",
+	},
+	models.FormatTOML: {
+		"title = \"app\"\n\n[database]\nhost = \"localhost\"\nport = 5432\n",
+		"[[servers]]\nhost = \"a\"\n\n[[servers]]\nhost = \"b\"\n\n[server.\"example.com\"]\nport = 443 # comment\n",
+		"inline = { host = \"a\", port = 1 }\nlist = [1, 2, 3]\nwhen = 2024-01-02T03:04:05Z\n",
+	},
+	models.FormatJSON: {
+		"{\"database\": {\"host\": \"localhost\", \"port\": 5432}}\n",
+		"{\n  \"servers\": [{\"host\": \"a\"}, {\"host\": \"b\"}],\n  \"enabled\": true,\n  \"ratio\": 0.5\n}\n",
+	},
+}
+
+func FuzzParseENV(f *testing.F)  { fuzzParse(f, models.FormatENV) }
+func FuzzParseYAML(f *testing.F) { fuzzParse(f, models.FormatYAML) }
+func FuzzParseTOML(f *testing.F) { fuzzParse(f, models.FormatTOML) }
+
+// fuzzParse checks that parsing never panics and that every key listed for
+// parsed data can be read back
+func fuzzParse(f *testing.F, format models.FileFormat) {
+	for _, document := range fuzzDocuments[format] {
+		f.Add([]byte(document))
+	}
+	f.Fuzz(func(t *testing.T, document []byte) {
+		p := New()
+		data, err := p.Parse("fuzz", format, document)
+		if err != nil {
+			return
+		}
+		for _, keyPath := range p.GetAllKeys(data, "") {
+			if _, err := p.GetValue(data, keyPath); err != nil {
+				t.Errorf("GetValue(%s) of a listed key: %v", keyPath, err)
+			}
+		}
+	})
+}
+
+func FuzzUpdateENV(f *testing.F)  { fuzzUpdate(f, models.FormatENV) }
+func FuzzUpdateYAML(f *testing.F) { fuzzUpdate(f, models.FormatYAML) }
+func FuzzUpdateTOML(f *testing.F) { fuzzUpdate(f, models.FormatTOML) }
+func FuzzUpdateJSON(f *testing.F) { fuzzUpdate(f, models.FormatJSON) }
+
+// fuzzUpdate checks that replacing a value surgically leaves a document that
+// still parses, holds the new value and holds every other value it held
+// before, unless that value is shared with the one replaced. The key path is
+// either one of the document's keys, picked by index, or a random one. An
+// update may be refused, but must not break the document.
+func fuzzUpdate(f *testing.F, format models.FileFormat) {
+	for _, document := range fuzzDocuments[format] {
+		for i, value := range []string{"new value", "8080", "true", "", "a: b # c", "\"quoted\"", "it's", "x=y"} {
+			f.Add([]byte(document), uint8(i), "", value)
+		}
+		f.Add([]byte(document), uint8(0), "database.host", "db")
+		f.Add([]byte(document), uint8(0), "servers[1].host", "c")
+	}
+	f.Fuzz(func(t *testing.T, document []byte, pick uint8, keyPath, raw string) {
+		p := New()
+		content := string(textfile.Normalize(document))
+		data, err := p.Parse("fuzz", format, []byte(content))
+		if err != nil {
+			return
+		}
+		keys := p.GetAllKeys(data, "")
+		sort.Strings(keys)
+		if keyPath == "" {
+			if len(keys) == 0 {
+				return
+			}
+			keyPath = keys[int(pick)%len(keys)]
+		}
+		if _, err := p.GetValue(data, keyPath); err != nil {
+			return
+		}
+		if !utf8.ValidString(raw) {
+			// YAML, TOML and JSON documents are UTF-8 and cannot hold it
+			return
+		}
+		value := ParseEnvValue(raw)
+
+		output, err := renderValues(p, format, content, map[string]any{keyPath: value})
+		if err != nil {
+			return
+		}
+		updated, err := p.Parse("fuzz", format, []byte(output))
+		if err != nil {
+			t.Fatalf("Setting %s to %q broke the document: %v\nbefore:\n%s\nafter:\n%s", keyPath, raw, err, content, output)
+		}
+		if !p.Holds(updated, keyPath, value) {
+			current, _ := p.GetValue(updated, keyPath)
+			t.Fatalf("Setting %s to %q left %v\nbefore:\n%s\nafter:\n%s", keyPath, raw, current, content, output)
+		}
+		for _, key := range keys {
+			if key == keyPath {
+				continue
+			}
+			// A key reading the same value through a YAML alias or merge
+			// key changes with it
+			before, _ := p.GetValue(data, key)
+			if !p.Holds(updated, key, before) && !p.Holds(updated, key, value) {
+				after, _ := p.GetValue(updated, key)
+				t.Fatalf("Setting %s to %q changed %s from %v to %v\nbefore:\n%s\nafter:\n%s", keyPath, raw, key, before, after, content, output)
+			}
+		}
+	})
+}
+
+// renderValues applies updates to content with the surgical updater for
+// format
+func renderValues(p *Parser, format models.FileFormat, content string, updates map[string]any) (string, error) {
+	switch format {
+	case models.FormatENV:
+		return p.renderEnvValues(content, updates)
+	case models.FormatYAML:
+		return p.renderYAMLValues(content, updates)
+	case models.FormatTOML:
+		return p.renderTOMLValues(content, updates)
+	case models.FormatJSON:
+		return p.renderJSONValues([]byte(content), updates)
+	}
+	panic("no surgical updater for " + string(format))
+}
+
+// FuzzExtractYAML checks that a value ExtractYAML reads is the value the
+// whole document holds, picking the key path by index. Merge keys after the
+// key read are not looked at, and the first of two keys reading the same is
+// read, so documents with merge keys or such keys are left out.
+func FuzzExtractYAML(f *testing.F) {
+	for _, document := range fuzzDocuments[models.FormatYAML] {
+		for i := range 8 {
+			f.Add([]byte(document), uint8(i))
+		}
+	}
+	f.Fuzz(func(t *testing.T, document []byte, pick uint8) {
+		p := New()
+		var data map[string]any
+		if bytes.Contains(document, []byte("<<")) || yaml.Unmarshal(document, &data) != nil {
+			return
+		}
+		var root yaml.Node
+		if yaml.Unmarshal(document, &root) != nil || duplicateYAMLKeys(&root) {
+			return
+		}
+		NormalizeValue(data)
+		keys := p.GetAllKeys(data, "")
+		if len(keys) == 0 {
+			return
+		}
+		sort.Strings(keys)
+		keyPath := keys[int(pick)%len(keys)]
+		if !CanExtract(keyPath) {
+			return
+		}
+
+		extracted, err := p.ExtractYAML(bytes.NewReader(document), []string{keyPath})
+		if err != nil {
+			return
+		}
+		want, _ := p.GetValue(data, keyPath)
+		if got, err := p.GetValue(extracted, keyPath); err != nil || !reflect.DeepEqual(got, want) {
+			t.Fatalf("ExtractYAML(%s) read %#v, %v; want %#v\ndocument:\n%s", keyPath, got, err, want, document)
+		}
+	})
+}
+
+// duplicateYAMLKeys reports whether a mapping below node has two keys that
+// read the same once decoded, such as 0 and 00
+func duplicateYAMLKeys(node *yaml.Node) bool {
+	if node.Kind == yaml.MappingNode {
+		seen := make(map[string]bool)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			var key any
+			if node.Content[i].Decode(&key) != nil {
+				return true
+			}
+			text := fmt.Sprint(key)
+			if seen[text] {
+				return true
+			}
+			seen[text] = true
+		}
+	}
+	return slices.ContainsFunc(node.Content, duplicateYAMLKeys)
+}
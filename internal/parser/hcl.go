@@ -0,0 +1,332 @@
+package parser
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
+
+	"var-sync/internal/textfile"
+)
+
+// parseHCLFile parses HCL2 content such as Terraform .tf and .tfvars files.
+// Top-level attributes become keys, and blocks are nested by type followed
+// by each of their labels, so `variable "region" { default = "x" }` is
+// addressable as variable.region.default. Repeated unlabeled blocks of the
+// same type become an array.
+func (p *Parser) parseHCLFile(filename string, content []byte) (map[string]any, error) {
+	file, diags := hclsyntax.ParseConfig(content, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("%s", diags.Error())
+	}
+
+	body, ok := file.Body.(*hclsyntax.Body)
+	if !ok {
+		return nil, fmt.Errorf("unexpected HCL body type %T", file.Body)
+	}
+
+	return hclBodyToMap(body, content), nil
+}
+
+// hclBodyToMap converts an HCL body into a map of attributes and blocks
+func hclBodyToMap(body *hclsyntax.Body, content []byte) map[string]any {
+	result := make(map[string]any)
+
+	for name, attr := range body.Attributes {
+		result[name] = hclExpressionValue(attr.Expr, content)
+	}
+
+	for _, block := range body.Blocks {
+		blockData := hclBodyToMap(block.Body, content)
+
+		if len(block.Labels) == 0 {
+			switch existing := result[block.Type].(type) {
+			case nil:
+				result[block.Type] = blockData
+			case []any:
+				result[block.Type] = append(existing, blockData)
+			default:
+				result[block.Type] = []any{existing, blockData}
+			}
+			continue
+		}
+
+		parent, ok := result[block.Type].(map[string]any)
+		if !ok {
+			parent = make(map[string]any)
+			result[block.Type] = parent
+		}
+		for _, label := range block.Labels[:len(block.Labels)-1] {
+			next, ok := parent[label].(map[string]any)
+			if !ok {
+				next = make(map[string]any)
+				parent[label] = next
+			}
+			parent = next
+		}
+		parent[block.Labels[len(block.Labels)-1]] = blockData
+	}
+
+	return result
+}
+
+// hclExpressionValue evaluates a literal HCL expression. Expressions that
+// reference variables or functions cannot be evaluated statically and are
+// returned as their source text.
+func hclExpressionValue(expr hclsyntax.Expression, content []byte) any {
+	value, diags := expr.Value(nil)
+	if diags.HasErrors() || !value.IsWhollyKnown() {
+		return strings.TrimSpace(string(expr.Range().SliceBytes(content)))
+	}
+	return ctyToGo(value)
+}
+
+// ctyToGo converts a cty value into the plain Go types used by the parser
+func ctyToGo(value cty.Value) any {
+	if value.IsNull() {
+		return nil
+	}
+
+	valueType := value.Type()
+	switch {
+	case valueType == cty.String:
+		return value.AsString()
+	case valueType == cty.Bool:
+		return value.True()
+	case valueType == cty.Number:
+		bf := value.AsBigFloat()
+		if bf.IsInt() {
+			if i, accuracy := bf.Int64(); accuracy == big.Exact {
+				return i
+			}
+		}
+		f, _ := bf.Float64()
+		return f
+	case valueType.IsListType() || valueType.IsTupleType() || valueType.IsSetType():
+		result := make([]any, 0, value.LengthInt())
+		for it := value.ElementIterator(); it.Next(); {
+			_, item := it.Element()
+			result = append(result, ctyToGo(item))
+		}
+		return result
+	case valueType.IsMapType() || valueType.IsObjectType():
+		result := make(map[string]any)
+		for it := value.ElementIterator(); it.Next(); {
+			key, item := it.Element()
+			result[key.AsString()] = ctyToGo(item)
+		}
+		return result
+	default:
+		return value.GoString()
+	}
+}
+
+// goToCty converts a Go value into a cty value for writing HCL
+func goToCty(value any) (cty.Value, error) {
+	switch v := value.(type) {
+	case nil:
+		return cty.NullVal(cty.DynamicPseudoType), nil
+	case string:
+		return cty.StringVal(v), nil
+	case bool:
+		return cty.BoolVal(v), nil
+	case int:
+		return cty.NumberIntVal(int64(v)), nil
+	case int64:
+		return cty.NumberIntVal(v), nil
+	case int32:
+		return cty.NumberIntVal(int64(v)), nil
+	case uint64:
+		return cty.NumberUIntVal(v), nil
+	case float64:
+		return cty.NumberFloatVal(v), nil
+	case float32:
+		return cty.NumberFloatVal(float64(v)), nil
+	case json.Number:
+		return cty.ParseNumberVal(v.String())
+	case []any:
+		if len(v) == 0 {
+			return cty.EmptyTupleVal, nil
+		}
+		items := make([]cty.Value, len(v))
+		for i, item := range v {
+			converted, err := goToCty(item)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			items[i] = converted
+		}
+		return cty.TupleVal(items), nil
+	case map[string]any:
+		if len(v) == 0 {
+			return cty.EmptyObjectVal, nil
+		}
+		attrs := make(map[string]cty.Value, len(v))
+		for key, item := range v {
+			converted, err := goToCty(item)
+			if err != nil {
+				return cty.NilVal, err
+			}
+			attrs[key] = converted
+		}
+		return cty.ObjectVal(attrs), nil
+	case map[any]any:
+		return goToCty(convertMapInterface(v))
+	default:
+		return cty.StringVal(fmt.Sprintf("%v", v)), nil
+	}
+}
+
+// formatHCLFile formats a map[string]any as HCL attributes, tfvars style
+func (p *Parser) formatHCLFile(data map[string]any) ([]byte, error) {
+	file := hclwrite.NewEmptyFile()
+	body := file.Body()
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		value, err := goToCty(data[key])
+		if err != nil {
+			return nil, err
+		}
+		body.SetAttributeValue(key, value)
+	}
+
+	return hclwrite.Format(file.Bytes()), nil
+}
+
+// updateHCLValues updates multiple values in an HCL file while preserving formatting and comments
+func (p *Parser) updateHCLValues(filepath string, updates map[string]any) error {
+	content, err := textfile.Read(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	newContent, err := p.renderHCLValues(filepath, content, updates)
+	if err != nil {
+		return err
+	}
+
+	return textfile.Write(filepath, []byte(newContent))
+}
+
+// renderHCLValues applies updates to HCL content and returns the modified
+// content. Only the attributes being updated are rewritten.
+func (p *Parser) renderHCLValues(filename string, content []byte, updates map[string]any) (string, error) {
+	file, diags := hclwrite.ParseConfig(content, filename, hcl.InitialPos)
+	if diags.HasErrors() {
+		return "", fmt.Errorf("failed to parse hcl file: %s", diags.Error())
+	}
+
+	updatedCount := 0
+	for keyPath, newValue := range updates {
+		updated, err := p.setHCLValue(file.Body(), splitKeyPath(keyPath), newValue)
+		if err != nil {
+			return "", fmt.Errorf("failed to update %s: %w", keyPath, err)
+		}
+		if updated {
+			updatedCount++
+		}
+	}
+
+	if updatedCount == 0 {
+		return "", fmt.Errorf("no key paths found in file")
+	}
+
+	return string(file.Bytes()), nil
+}
+
+// setHCLValue locates the attribute addressed by segments and replaces its
+// value. Block types and labels are matched segment by segment; once an
+// attribute is reached, any remaining segments address keys inside its
+// object value. It returns false if the path does not exist.
+func (p *Parser) setHCLValue(body *hclwrite.Body, segments []string, newValue any) (bool, error) {
+	if len(segments) == 0 {
+		return false, nil
+	}
+
+	key, index, err := parseKeySegment(segments[0])
+	if err != nil {
+		return false, err
+	}
+
+	if attr := body.GetAttribute(key); attr != nil {
+		value := newValue
+		if len(segments) > 1 || index >= 0 {
+			// Rewrite the attribute's value with the nested key or element replaced
+			current, err := hclAttributeValue(attr)
+			if err != nil {
+				return false, err
+			}
+			wrapper := map[string]any{key: current}
+			keyPath := strings.Join(segments, ".")
+			if _, err := p.GetValue(wrapper, keyPath); err != nil {
+				return false, nil
+			}
+			if err := p.SetValue(wrapper, keyPath, newValue); err != nil {
+				return false, err
+			}
+			value = wrapper[key]
+		}
+
+		converted, err := goToCty(value)
+		if err != nil {
+			return false, err
+		}
+		body.SetAttributeValue(key, converted)
+		return true, nil
+	}
+
+	// Collect blocks of this type and match labels against the following segments
+	blockIndex := 0
+	for _, block := range body.Blocks() {
+		if block.Type() != key {
+			continue
+		}
+
+		labels := block.Labels()
+		if len(labels) == 0 {
+			if index >= 0 && blockIndex != index {
+				blockIndex++
+				continue
+			}
+			return p.setHCLValue(block.Body(), segments[1:], newValue)
+		}
+
+		if index >= 0 || len(segments) <= len(labels) {
+			continue
+		}
+		matched := true
+		for i, label := range labels {
+			if segments[i+1] != label {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return p.setHCLValue(block.Body(), segments[len(labels)+1:], newValue)
+		}
+	}
+
+	return false, nil
+}
+
+// hclAttributeValue evaluates the current value of an hclwrite attribute
+func hclAttributeValue(attr *hclwrite.Attribute) (any, error) {
+	src := attr.Expr().BuildTokens(nil).Bytes()
+	expr, diags := hclsyntax.ParseExpression(src, "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("%s", diags.Error())
+	}
+	return hclExpressionValue(expr, src), nil
+}
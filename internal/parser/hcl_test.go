@@ -0,0 +1,195 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testTerraformVariables = `# Input variables
+variable "region" {
+  description = "AWS region"
+  default     = "us-east-1" # primary region
+}
+
+variable "instance_count" {
+  default = 2
+}
+
+terraform {
+  required_version = ">= 1.5"
+}
+
+resource "aws_instance" "web" {
+  ami  = var.ami_id
+  tags = {
+    env  = "dev"
+    team = "platform"
+  }
+}
+`
+
+func TestLoadFileHCL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "variables.tf")
+	if err := os.WriteFile(path, []byte(testTerraformVariables), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	parser := New()
+	data, err := parser.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	tests := []struct {
+		keyPath  string
+		expected any
+	}{
+		{"variable.region.default", "us-east-1"},
+		{"variable.region.description", "AWS region"},
+		{"variable.instance_count.default", int64(2)},
+		{"terraform.required_version", ">= 1.5"},
+		{"resource.aws_instance.web.ami", "var.ami_id"},
+		{"resource.aws_instance.web.tags.team", "platform"},
+	}
+
+	for _, tt := range tests {
+		value, err := parser.GetValue(data, tt.keyPath)
+		if err != nil {
+			t.Errorf("GetValue(%s) error = %v", tt.keyPath, err)
+			continue
+		}
+		if value != tt.expected {
+			t.Errorf("GetValue(%s) = %v (%T), expected %v (%T)", tt.keyPath, value, value, tt.expected, tt.expected)
+		}
+	}
+}
+
+func TestLoadFileTfvars(t *testing.T) {
+	content := `region        = "eu-west-1"
+instance_type = "t3.micro"
+enable_nat    = true
+azs           = ["eu-west-1a", "eu-west-1b"]
+ratio         = 0.5
+`
+	path := filepath.Join(t.TempDir(), "prod.tfvars")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	parser := New()
+	data, err := parser.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	if data["region"] != "eu-west-1" || data["enable_nat"] != true || data["ratio"] != 0.5 {
+		t.Errorf("Unexpected tfvars values: %v", data)
+	}
+	if value, _ := parser.GetValue(data, "azs[1]"); value != "eu-west-1b" {
+		t.Errorf("GetValue(azs[1]) = %v, expected eu-west-1b", value)
+	}
+}
+
+func TestUpdateHCLValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "variables.tf")
+	if err := os.WriteFile(path, []byte(testTerraformVariables), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	parser := New()
+	updates := map[string]any{
+		"variable.region.default":             "eu-central-1",
+		"variable.instance_count.default":     int64(4),
+		"resource.aws_instance.web.tags.team": "infra",
+	}
+	if err := parser.UpdateFileValues(path, updates); err != nil {
+		t.Fatalf("UpdateFileValues() error = %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read updated file: %v", err)
+	}
+	updated := string(content)
+
+	for _, expected := range []string{
+		"# Input variables",
+		`default     = "eu-central-1" # primary region`,
+		"default = 4",
+		`description = "AWS region"`,
+		"= var.ami_id",
+		`required_version = ">= 1.5"`,
+	} {
+		if !strings.Contains(updated, expected) {
+			t.Errorf("Updated file missing %q:\n%s", expected, updated)
+		}
+	}
+
+	data, err := parser.LoadFile(path)
+	if err != nil {
+		t.Fatalf("Updated file no longer parses: %v", err)
+	}
+	if value, _ := parser.GetValue(data, "resource.aws_instance.web.tags.team"); value != "infra" {
+		t.Errorf("Nested object value not updated, got %v", value)
+	}
+	if value, _ := parser.GetValue(data, "resource.aws_instance.web.tags.env"); value != "dev" {
+		t.Errorf("Sibling object value changed, got %v", value)
+	}
+}
+
+func TestUpdateTfvarsValues(t *testing.T) {
+	content := `# Production inputs
+region = "eu-west-1"
+azs    = ["eu-west-1a", "eu-west-1b"]
+`
+	path := filepath.Join(t.TempDir(), "prod.tfvars")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	parser := New()
+	if err := parser.UpdateFileValues(path, map[string]any{"region": "us-west-2", "azs[0]": "us-west-2a"}); err != nil {
+		t.Fatalf("UpdateFileValues() error = %v", err)
+	}
+
+	updated, _ := os.ReadFile(path)
+	expected := `# Production inputs
+region = "us-west-2"
+azs    = ["us-west-2a", "eu-west-1b"]
+`
+	if string(updated) != expected {
+		t.Errorf("UpdateFileValues() result:\n%s\nExpected:\n%s", updated, expected)
+	}
+
+	err := parser.UpdateFileValues(path, map[string]any{"missing": "x"})
+	if err == nil || !strings.Contains(err.Error(), "no key paths found") {
+		t.Errorf("UpdateFileValues() error = %v, expected 'no key paths found'", err)
+	}
+}
+
+func TestSaveFileHCL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "generated.tfvars")
+	data := map[string]any{
+		"region": "us-east-1",
+		"count":  3,
+		"tags":   map[string]any{"env": "prod"},
+	}
+
+	parser := New()
+	if err := parser.SaveFile(path, data); err != nil {
+		t.Fatalf("SaveFile() error = %v", err)
+	}
+
+	loaded, err := parser.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if loaded["region"] != "us-east-1" || loaded["count"] != int64(3) {
+		t.Errorf("Round trip mismatch: %v", loaded)
+	}
+	if value, _ := parser.GetValue(loaded, "tags.env"); value != "prod" {
+		t.Errorf("Round trip lost nested value, got %v", value)
+	}
+}
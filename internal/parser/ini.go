@@ -0,0 +1,286 @@
+package parser
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"var-sync/internal/textfile"
+)
+
+// parseINIFile parses INI content into a map[string]any. Keys outside of any
+// section are stored at the top level, section keys are nested under the
+// section name and dotted section names such as [server.http] are nested
+// further so they can be addressed as server.http.key.
+func (p *Parser) parseINIFile(content string) (map[string]any, error) {
+	result := make(map[string]any)
+	current := result
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	lineNum := 0
+
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip empty lines and comments
+		if line == "" || strings.HasPrefix(line, ";") || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("invalid section header on line %d: %s", lineNum, line)
+			}
+			section := strings.TrimSpace(line[1 : len(line)-1])
+			if section == "" {
+				return nil, fmt.Errorf("empty section name on line %d", lineNum)
+			}
+
+			current = result
+			for _, name := range strings.Split(section, ".") {
+				next, ok := current[name].(map[string]any)
+				if !ok {
+					if _, exists := current[name]; exists {
+						return nil, fmt.Errorf("section %s conflicts with existing key on line %d", section, lineNum)
+					}
+					next = make(map[string]any)
+					current[name] = next
+				}
+				current = next
+			}
+			continue
+		}
+
+		sepIndex := iniSeparatorIndex(line)
+		if sepIndex == -1 {
+			continue // Skip lines without a separator
+		}
+
+		key := strings.TrimSpace(line[:sepIndex])
+		value := stripINIComment(strings.TrimSpace(line[sepIndex+1:]))
+		current[key] = parseINIValue(value)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading ini file: %w", err)
+	}
+
+	return result, nil
+}
+
+// iniSeparatorIndex returns the index of the first '=' or ':' in a line
+func iniSeparatorIndex(line string) int {
+	return strings.IndexAny(line, "=:")
+}
+
+// stripINIComment removes an inline comment from an unquoted value. Comment
+// markers only start a comment when preceded by whitespace so values such as
+// URLs with fragments are kept intact.
+func stripINIComment(value string) string {
+	if strings.HasPrefix(value, "'") {
+		if end := strings.IndexByte(value[1:], '\''); end >= 0 {
+			return value[:end+2]
+		}
+		return value
+	}
+	if strings.HasPrefix(value, "\"") {
+		// Double quoted values escape quotes and backslashes with a backslash
+		for i := 1; i < len(value); i++ {
+			switch value[i] {
+			case '\\':
+				i++
+			case '"':
+				return value[:i+1]
+			}
+		}
+		return value
+	}
+
+	for i := 1; i < len(value); i++ {
+		if (value[i] == ';' || value[i] == '#') && (value[i-1] == ' ' || value[i-1] == '\t') {
+			return strings.TrimSpace(value[:i])
+		}
+	}
+	return value
+}
+
+// iniEscaper and iniUnescaper escape the quotes and backslashes of a double
+// quoted INI value
+var (
+	iniEscaper   = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+	iniUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`)
+)
+
+// parseINIValue converts a raw INI value into a typed value
+func parseINIValue(value string) any {
+	// Remove quotes if present, unescaping double quoted values
+	if len(value) >= 2 {
+		if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+			return iniUnescaper.Replace(value[1 : len(value)-1])
+		}
+		if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
+			return value[1 : len(value)-1]
+		}
+	}
+
+	if value == "true" || value == "false" {
+		return value == "true"
+	} else if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return intVal
+	} else if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+		return floatVal
+	}
+	return value
+}
+
+// formatINIFile formats a map[string]any as INI content. Top-level primitives
+// are written first, followed by one section per nested map.
+func (p *Parser) formatINIFile(data map[string]any) string {
+	var b strings.Builder
+	writeINISection(&b, "", data)
+	return b.String()
+}
+
+// writeINISection writes the primitive keys of data under the given section
+// header and then recurses into nested maps as dotted sections
+func writeINISection(b *strings.Builder, section string, data map[string]any) {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var sections []string
+	wroteHeader := section == ""
+	for _, key := range keys {
+		if _, isMap := toStringMap(data[key]); isMap {
+			sections = append(sections, key)
+			continue
+		}
+		if !wroteHeader {
+			if b.Len() > 0 {
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(b, "[%s]\n", section)
+			wroteHeader = true
+		}
+		fmt.Fprintf(b, "%s = %s\n", key, formatINIValue(data[key]))
+	}
+
+	for _, key := range sections {
+		name := key
+		if section != "" {
+			name = section + "." + key
+		}
+		nested, _ := toStringMap(data[key])
+		writeINISection(b, name, nested)
+	}
+}
+
+// toStringMap returns value as a map[string]any if it is any kind of map
+func toStringMap(value any) (map[string]any, bool) {
+	switch v := value.(type) {
+	case map[string]any:
+		return v, true
+	case map[any]any:
+		return convertMapInterface(v), true
+	default:
+		return nil, false
+	}
+}
+
+// formatINIValue formats a value for use in INI files
+func formatINIValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		// Quote strings that would otherwise lose whitespace or be read as comments
+		if v == "" || strings.TrimSpace(v) != v || strings.ContainsAny(v, ";#\"") {
+			return "\"" + iniEscaper.Replace(v) + "\""
+		}
+		return v
+	default:
+		return formatScalar(v)
+	}
+}
+
+// updateINIValues updates multiple values in an INI file while preserving formatting and comments
+func (p *Parser) updateINIValues(filepath string, updates map[string]any) error {
+	content, err := textfile.Read(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	newContent, err := p.renderINIValues(string(content), updates)
+	if err != nil {
+		return err
+	}
+
+	return textfile.Write(filepath, []byte(newContent))
+}
+
+// renderINIValues applies updates to INI content and returns the modified content
+func (p *Parser) renderINIValues(content string, updates map[string]any) (string, error) {
+	lines := strings.Split(content, "\n")
+	paths := p.parseINIStructure(lines)
+	updatedCount := 0
+
+	for lineNum, fullPath := range paths {
+		newValue, exists := updates[fullPath]
+		if !exists {
+			continue
+		}
+
+		line := lines[lineNum]
+		sepIndex := iniSeparatorIndex(line)
+
+		// Preserve whitespace after the separator and any inline comment
+		valueStart := sepIndex + 1
+		for valueStart < len(line) && (line[valueStart] == ' ' || line[valueStart] == '\t') {
+			valueStart++
+		}
+		value := stripINIComment(strings.TrimSpace(line[valueStart:]))
+		valueEnd := valueStart + len(value)
+
+		lines[lineNum] = line[:valueStart] + formatINIValue(newValue) + line[valueEnd:]
+		updatedCount++
+	}
+
+	if updatedCount == 0 {
+		return "", fmt.Errorf("no key paths found in file")
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// parseINIStructure returns the full section.key path for every key line
+func (p *Parser) parseINIStructure(lines []string) map[int]string {
+	paths := make(map[int]string)
+	section := ""
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, ";") || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			section = strings.TrimSpace(trimmed[1 : len(trimmed)-1])
+			continue
+		}
+
+		sepIndex := iniSeparatorIndex(trimmed)
+		if sepIndex == -1 {
+			continue
+		}
+
+		key := strings.TrimSpace(trimmed[:sepIndex])
+		if section != "" {
+			key = section + "." + key
+		}
+		paths[i] = key
+	}
+
+	return paths
+}
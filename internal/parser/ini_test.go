@@ -0,0 +1,291 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseINIFile(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		expected map[string]any
+	}{
+		{
+			name: "sections and top-level keys",
+			content: `name = legacy-app
+
+[database]
+host = localhost
+port = 5432
+
+[server]
+debug = true`,
+			expected: map[string]any{
+				"name": "legacy-app",
+				"database": map[string]any{
+					"host": "localhost",
+					"port": int64(5432),
+				},
+				"server": map[string]any{
+					"debug": true,
+				},
+			},
+		},
+		{
+			name: "comments and colon separators",
+			content: `; semicolon comment
+# hash comment
+[paths]
+home: /var/lib/app ; trailing comment
+url = http://example.com/#anchor
+quoted = "value ; not a comment"`,
+			expected: map[string]any{
+				"paths": map[string]any{
+					"home":   "/var/lib/app",
+					"url":    "http://example.com/#anchor",
+					"quoted": "value ; not a comment",
+				},
+			},
+		},
+		{
+			name: "dotted section names",
+			content: `[server.http]
+port = 8080`,
+			expected: map[string]any{
+				"server": map[string]any{
+					"http": map[string]any{
+						"port": int64(8080),
+					},
+				},
+			},
+		},
+	}
+
+	parser := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := parser.parseINIFile(tt.content)
+			if err != nil {
+				t.Fatalf("parseINIFile() error = %v", err)
+			}
+
+			for path, expected := range flattenForTest(tt.expected, "") {
+				actual, err := parser.GetValue(result, path)
+				if err != nil {
+					t.Errorf("parseINIFile() missing key %s: %v", path, err)
+					continue
+				}
+				if actual != expected {
+					t.Errorf("parseINIFile() key %s = %v (%T), expected %v (%T)", path, actual, actual, expected, expected)
+				}
+			}
+		})
+	}
+}
+
+func TestParseINIFileErrors(t *testing.T) {
+	parser := New()
+	for _, content := range []string{"[unterminated", "[]", "key = 1\n[key]"} {
+		if _, err := parser.parseINIFile(content); err == nil {
+			t.Errorf("parseINIFile(%q) should return an error", content)
+		}
+	}
+}
+
+func TestFormatINIFileRoundTrip(t *testing.T) {
+	data := map[string]any{
+		"name": "app",
+		"database": map[string]any{
+			"host":     "localhost",
+			"port":     int64(5432),
+			"password": "has;semicolon",
+		},
+		"server": map[string]any{
+			"http": map[string]any{
+				"enabled": true,
+			},
+		},
+	}
+
+	parser := New()
+	content := parser.formatINIFile(data)
+
+	expected := `name = app
+
+[database]
+host = localhost
+password = "has;semicolon"
+port = 5432
+
+[server.http]
+enabled = true
+`
+	if content != expected {
+		t.Errorf("formatINIFile() result:\n%s\nExpected:\n%s", content, expected)
+	}
+
+	parsed, err := parser.parseINIFile(content)
+	if err != nil {
+		t.Fatalf("parseINIFile() error = %v", err)
+	}
+	if value, _ := parser.GetValue(parsed, "database.password"); value != "has;semicolon" {
+		t.Errorf("Round trip lost value, got %v", value)
+	}
+}
+
+func TestUpdateINIValues(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		updates         map[string]any
+		expectedContent string
+	}{
+		{
+			name: "preserve comments and spacing",
+			content: `; Legacy configuration
+[database]
+host = localhost ; primary host
+port=5432
+
+[cache]
+host = localhost`,
+			updates: map[string]any{
+				"database.host": "db.internal",
+				"database.port": 6543,
+			},
+			expectedContent: `; Legacy configuration
+[database]
+host = db.internal ; primary host
+port=6543
+
+[cache]
+host = localhost`,
+		},
+		{
+			name: "top-level key and colon separator",
+			content: `name: old
+[app]
+name: nested`,
+			updates: map[string]any{
+				"name": "new value",
+			},
+			expectedContent: `name: new value
+[app]
+name: nested`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.ini")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			parser := New()
+			if err := parser.UpdateFileValues(path, tt.updates); err != nil {
+				t.Fatalf("UpdateFileValues() error = %v", err)
+			}
+
+			actual, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read updated file: %v", err)
+			}
+			if string(actual) != tt.expectedContent {
+				t.Errorf("UpdateFileValues() result:\n%s\n\nExpected:\n%s", actual, tt.expectedContent)
+			}
+		})
+	}
+}
+
+func TestUpdateINIValuesError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.cfg")
+	if err := os.WriteFile(path, []byte("[database]\nhost = localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	parser := New()
+	err := parser.UpdateFileValues(path, map[string]any{"database.missing": "x"})
+	if err == nil || !strings.Contains(err.Error(), "no key paths found") {
+		t.Errorf("UpdateFileValues() error = %v, expected 'no key paths found'", err)
+	}
+}
+
+func TestLoadFileINI(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.ini")
+	if err := os.WriteFile(path, []byte("[database]\nhost = localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	parser := New()
+	data, err := parser.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if value, err := parser.GetValue(data, "database.host"); err != nil || value != "localhost" {
+		t.Errorf("GetValue() = %v, %v; expected localhost", value, err)
+	}
+
+	if err := parser.SaveFile(path, map[string]any{"app": map[string]any{"port": 80}}); err != nil {
+		t.Fatalf("SaveFile() error = %v", err)
+	}
+	content, _ := os.ReadFile(path)
+	if string(content) != "[app]\nport = 80\n" {
+		t.Errorf("SaveFile() wrote %q", content)
+	}
+}
+
+func TestUpdateINIValuesQuotedRoundTrip(t *testing.T) {
+	values := []string{`say "hi" now`, `C:\path\`, `a\"b ; c`, `"quoted"`}
+	for _, want := range values {
+		t.Run(want, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.ini")
+			if err := os.WriteFile(path, []byte("[app]\nmessage = old ; note\n"), 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			parser := New()
+			if err := parser.UpdateFileValues(path, map[string]any{"app.message": want}); err != nil {
+				t.Fatalf("UpdateFileValues() error = %v", err)
+			}
+			data, err := parser.LoadFile(path)
+			if err != nil {
+				t.Fatalf("LoadFile() error = %v", err)
+			}
+			if value, err := parser.GetValue(data, "app.message"); err != nil || value != want {
+				content, _ := os.ReadFile(path)
+				t.Errorf("GetValue() = %q, %v; expected %q from %q", value, err, want, content)
+			}
+
+			// Updating the quoted value again replaces all of it
+			if err := parser.UpdateFileValues(path, map[string]any{"app.message": "new"}); err != nil {
+				t.Fatalf("UpdateFileValues() error = %v", err)
+			}
+			if content, _ := os.ReadFile(path); string(content) != "[app]\nmessage = new ; note\n" {
+				t.Errorf("Second update wrote %q", content)
+			}
+		})
+	}
+}
+
+// flattenForTest flattens nested expectation maps into key paths
+func flattenForTest(data map[string]any, prefix string) map[string]any {
+	result := make(map[string]any)
+	for key, value := range data {
+		path := key
+		if prefix != "" {
+			path = prefix + "." + key
+		}
+		if nested, ok := value.(map[string]any); ok {
+			for k, v := range flattenForTest(nested, path) {
+				result[k] = v
+			}
+			continue
+		}
+		result[path] = value
+	}
+	return result
+}
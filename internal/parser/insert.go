@@ -0,0 +1,374 @@
+package parser
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"var-sync/pkg/models"
+)
+
+// insertMissingKeys adds the key paths in create that content does not have
+// yet, with their values from updates. It returns the new content and the
+// updates still to be applied to it. JSON files need no insertion, as their
+// updates create missing keys anyway.
+func (p *Parser) insertMissingKeys(filepath string, content []byte, updates map[string]any, create []string) ([]byte, map[string]any, error) {
+	if len(create) == 0 {
+		return content, updates, nil
+	}
+
+	format := models.DetectFormat(filepath)
+	data, err := p.Parse(filepath, format, content)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var missing []string
+	for _, keyPath := range create {
+		if _, ok := updates[keyPath]; !ok {
+			continue
+		}
+		if _, err := p.GetValue(data, keyPath); err != nil {
+			missing = append(missing, keyPath)
+		}
+	}
+	if len(missing) == 0 || format == models.FormatJSON {
+		return content, updates, nil
+	}
+	sort.Strings(missing)
+
+	text := string(content)
+	for _, keyPath := range missing {
+		if strings.ContainsAny(keyPath, "[]") {
+			return nil, nil, fmt.Errorf("cannot add missing key %s: array elements cannot be added", keyPath)
+		}
+		switch format {
+		case models.FormatYAML:
+			text = insertYAMLKey(text, keyPath, updates[keyPath])
+		case models.FormatTOML:
+			text = insertTOMLKey(text, keyPath, updates[keyPath])
+		case models.FormatENV:
+			text = insertEnvKey(text, keyPath, updates[keyPath])
+		default:
+			return nil, nil, fmt.Errorf("cannot add missing key %s: not supported for %s files", keyPath, format)
+		}
+	}
+
+	remaining := make(map[string]any, len(updates))
+	for keyPath, value := range updates {
+		remaining[keyPath] = value
+	}
+	for _, keyPath := range missing {
+		delete(remaining, keyPath)
+	}
+	return []byte(text), remaining, nil
+}
+
+// AddsMissingKeys reports whether updates to the file at filepath add the
+// keys it does not have even without create_missing, as JSON updates always
+// have
+func AddsMissingKeys(filepath string) bool {
+	return models.DetectFormat(filepath) == models.FormatJSON
+}
+
+// yamlBlock is a mapping key in a YAML file and the lines nested below it
+type yamlBlock struct {
+	line   int // The line of the key
+	indent int
+	end    int // The last line nested below the key, or line if none is
+}
+
+// createsAll reports whether every key in updates may be added, so a file
+// missing all of them can be written from nothing
+func createsAll(updates map[string]any, create []string) bool {
+	if len(updates) == 0 {
+		return false
+	}
+	allowed := make(map[string]bool, len(create))
+	for _, keyPath := range create {
+		allowed[keyPath] = true
+	}
+	for keyPath := range updates {
+		if !allowed[keyPath] {
+			return false
+		}
+	}
+	return true
+}
+
+// yamlBlocks finds the line of every mapping key in a YAML file, by its key
+// path. Keys within arrays and block scalars are left out.
+func yamlBlocks(lines []string) map[string]yamlBlock {
+	type level struct {
+		indent int
+		path   string
+	}
+	blocks := make(map[string]yamlBlock)
+	var stack []level
+	scalarIndent := -1 // Lines indented past this belong to a block scalar
+
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if scalarIndent < 0 || indent <= scalarIndent {
+			scalarIndent = -1
+			for len(stack) > 0 && stack[len(stack)-1].indent >= indent {
+				stack = stack[:len(stack)-1]
+			}
+		}
+		for _, open := range stack {
+			if block, ok := blocks[open.path]; ok {
+				block.end = i
+				blocks[open.path] = block
+			}
+		}
+		if scalarIndent >= 0 {
+			continue
+		}
+
+		parent := ""
+		if len(stack) > 0 {
+			parent = stack[len(stack)-1].path
+		}
+		if trimmed == "-" || strings.HasPrefix(trimmed, "- ") || trimmed == "---" {
+			// Keys within array items are not addressed by plain key paths
+			stack = append(stack, level{indent: indent, path: parent + "[]"})
+			continue
+		}
+
+		key, value, found := strings.Cut(trimmed, ":")
+		if !found {
+			continue
+		}
+		key = quoteKey(strings.Trim(strings.TrimSpace(key), `"'`))
+		path := key
+		if parent != "" {
+			path = parent + "." + key
+		}
+		blocks[path] = yamlBlock{line: i, indent: indent, end: i}
+		stack = append(stack, level{indent: indent, path: path})
+
+		value = strings.TrimSpace(value)
+		if strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">") {
+			scalarIndent = indent
+		}
+	}
+	return blocks
+}
+
+// yamlIndentUnit returns the number of spaces the file indents each level by
+func yamlIndentUnit(lines []string) int {
+	unit := 0
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if indent > 0 && (unit == 0 || indent < unit) {
+			unit = indent
+		}
+	}
+	if unit == 0 {
+		return 2
+	}
+	return unit
+}
+
+// insertYAMLKey adds keyPath to YAML content below the deepest of its parents
+// that exists, creating the parents that do not
+func insertYAMLKey(content, keyPath string, value any) string {
+	lines := strings.Split(content, "\n")
+	blocks := yamlBlocks(lines)
+	unit := yamlIndentUnit(lines)
+	segments := keyNames(keyPath)
+
+	// Find the deepest parent that exists
+	at, indent := lastContentLine(lines), 0
+	depth := 0
+	for k := len(segments) - 1; k > 0; k-- {
+		block, ok := blocks[quotedPath(segments[:k])]
+		if !ok {
+			continue
+		}
+		depth = k
+		at = block.end
+		indent = block.indent + unit
+		for j := block.line + 1; j <= block.end; j++ {
+			trimmed := strings.TrimSpace(lines[j])
+			if trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+				indent = len(lines[j]) - len(strings.TrimLeft(lines[j], " "))
+				break
+			}
+		}
+		break
+	}
+
+	var added []string
+	for k := depth; k < len(segments); k++ {
+		line := strings.Repeat(" ", indent+(k-depth)*unit) + segments[k] + ":"
+		if k == len(segments)-1 {
+			line += " " + formatYAMLValue(value)
+		}
+		added = append(added, line)
+	}
+	return insertLines(lines, at, added)
+}
+
+// keyNames returns the keys named by the segments of keyPath, without quotes
+// or escapes
+func keyNames(keyPath string) []string {
+	segments := splitKeyPath(keyPath)
+	for i, segment := range segments {
+		segments[i], _ = cutKeyName(segment)
+	}
+	return segments
+}
+
+// quotedPath joins keys into a key path, quoting those that need it
+func quotedPath(keys []string) string {
+	quoted := make([]string, len(keys))
+	for i, key := range keys {
+		quoted[i] = quoteKey(key)
+	}
+	return strings.Join(quoted, ".")
+}
+
+// tomlKeyPattern matches keys that TOML allows without quotes
+var tomlKeyPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// tomlKey quotes a key segment if TOML needs it to be
+func tomlKey(segment string) string {
+	if tomlKeyPattern.MatchString(segment) {
+		return segment
+	}
+	return fmt.Sprintf("%q", segment)
+}
+
+// tomlTable is a table in a TOML file: the line of its header and the last
+// line holding one of its keys
+type tomlTable struct {
+	start, end int
+}
+
+// tomlTables finds every table in a TOML file by name, and the line of the
+// first table or array of tables, or -1 if there is none
+func tomlTables(lines []string) (map[string]tomlTable, int) {
+	tables := make(map[string]tomlTable)
+	first := -1
+	current := ""
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if first < 0 {
+				first = i
+			}
+			current = ""
+			if !strings.HasPrefix(trimmed, "[[") {
+				if end := strings.Index(trimmed, "]"); end > 0 {
+					current = canonicalKeyPath(strings.TrimSpace(trimmed[1:end]))
+					tables[current] = tomlTable{start: i, end: i}
+				}
+			}
+			continue
+		}
+		if current != "" && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			tables[current] = tomlTable{start: tables[current].start, end: i}
+		}
+	}
+	return tables, first
+}
+
+// insertTOMLKey adds keyPath to TOML content at the end of the deepest table
+// holding it, or in a new table if there is none
+func insertTOMLKey(content, keyPath string, value any) string {
+	lines := strings.Split(content, "\n")
+	segments := keyNames(keyPath)
+	tables, firstTable := tomlTables(lines)
+
+	quoted := make([]string, len(segments))
+	for i, segment := range segments {
+		quoted[i] = tomlKey(segment)
+	}
+	for k := len(segments) - 1; k > 0; k-- {
+		if t, ok := tables[quotedPath(segments[:k])]; ok {
+			line := strings.Join(quoted[k:], ".") + " = " + formatTOMLValue(value)
+			return insertLines(lines, t.end, []string{line})
+		}
+	}
+
+	if len(segments) == 1 || firstTable < 0 {
+		// Top-level keys go before the first table
+		at := lastContentLine(lines)
+		if firstTable >= 0 {
+			at = lastContentLine(lines[:firstTable])
+		}
+		line := strings.Join(quoted, ".") + " = " + formatTOMLValue(value)
+		if len(segments) > 1 {
+			line = fmt.Sprintf("[%s]\n%s = %s", strings.Join(quoted[:len(quoted)-1], "."), quoted[len(quoted)-1], formatTOMLValue(value))
+			if at >= 0 {
+				line = "\n" + line
+			}
+		}
+		return insertLines(lines, at, strings.Split(line, "\n"))
+	}
+
+	added := []string{
+		fmt.Sprintf("[%s]", strings.Join(quoted[:len(quoted)-1], ".")),
+		quoted[len(quoted)-1] + " = " + formatTOMLValue(value),
+	}
+	at := lastContentLine(lines)
+	if at >= 0 {
+		added = append([]string{""}, added...)
+	}
+	return insertLines(lines, at, added)
+}
+
+// insertEnvKey adds an assignment of key to the end of .env content,
+// exported if the file's other assignments are
+func insertEnvKey(content, key string, value any) string {
+	lines := strings.Split(content, "\n")
+	at := lastContentLine(lines)
+
+	line := key + "=" + FormatEnvValue(value)
+	for i := at; i >= 0; i-- {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		if strings.HasPrefix(trimmed, "export ") {
+			line = "export " + line
+		}
+		break
+	}
+	return insertLines(lines, at, []string{line})
+}
+
+// lastContentLine returns the index of the last line that is not blank, or
+// -1 if every line is
+func lastContentLine(lines []string) int {
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.TrimSpace(lines[i]) != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// insertLines inserts added after the line at index at, and joins the lines
+// back into content. A file without a trailing newline gets one.
+func insertLines(lines []string, at int, added []string) string {
+	result := make([]string, 0, len(lines)+len(added)+1)
+	result = append(result, lines[:at+1]...)
+	result = append(result, added...)
+	rest := lines[at+1:]
+	if len(rest) == 0 {
+		rest = []string{""}
+	}
+	result = append(result, rest...)
+	return strings.Join(result, "\n")
+}
@@ -0,0 +1,99 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUpdateFileValuesCreatesMissingKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		updates  map[string]any
+		expected string
+	}{
+		{
+			name:     "config.yaml",
+			content:  "database:\n    host: localhost # primary\n    pool:\n        max: 10\napp: demo\n",
+			updates:  map[string]any{"database.port": int64(5432), "database.host": "db.internal", "cache.redis.host": "redis"},
+			expected: "database:\n    host: db.internal # primary\n    pool:\n        max: 10\n    port: 5432\napp: demo\ncache:\n    redis:\n        host: redis\n",
+		},
+		{
+			name:     "config.toml",
+			content:  "title = \"demo\"\n\n[database]\nhost = \"localhost\"\n\n[server]\nport = 80\n",
+			updates:  map[string]any{"database.port": int64(5432), "debug": true, "cache.host": "redis"},
+			expected: "title = \"demo\"\ndebug = true\n\n[database]\nhost = \"localhost\"\nport = 5432\n\n[server]\nport = 80\n\n[cache]\nhost = \"redis\"\n",
+		},
+		{
+			name:     "config.env",
+			content:  "# Database\nDB_HOST=localhost\n",
+			updates:  map[string]any{"DB_PORT": int64(5432), "DB_HOST": "db.internal"},
+			expected: "# Database\nDB_HOST=db.internal\nDB_PORT=5432\n",
+		},
+		{
+			name:     "exports.sh",
+			content:  "export DB_HOST=localhost",
+			updates:  map[string]any{"DB_PORT": int64(5432)},
+			expected: "export DB_HOST=localhost\nexport DB_PORT=5432\n",
+		},
+	}
+
+	p := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.name)
+			if err := os.WriteFile(filePath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+
+			create := make([]string, 0, len(tt.updates))
+			for keyPath := range tt.updates {
+				create = append(create, keyPath)
+			}
+			if err := p.UpdateFileValues(filePath, tt.updates, create...); err != nil {
+				t.Fatalf("UpdateFileValues() returned error: %v", err)
+			}
+
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("UpdateFileValues() wrote:\n%s\nwant:\n%s", content, tt.expected)
+			}
+
+			data, err := p.LoadFile(filePath)
+			if err != nil {
+				t.Fatalf("Updated file does not parse: %v", err)
+			}
+			for keyPath, want := range tt.updates {
+				if got, err := p.GetValue(data, keyPath); err != nil || got != want {
+					t.Errorf("%s = %v, %v, want %v", keyPath, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateFileValuesMissingKeyNotCreated(t *testing.T) {
+	p := New()
+	filePath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(filePath, []byte("database:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+
+	if err := p.UpdateFileValues(filePath, map[string]any{"database.port": 5432}); err == nil {
+		t.Error("UpdateFileValues() should fail for a missing key that is not created")
+	}
+
+	propertiesPath := filepath.Join(t.TempDir(), "app.properties")
+	if err := os.WriteFile(propertiesPath, []byte("db.host=localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	err := p.UpdateFileValues(propertiesPath, map[string]any{"db.port": 5432}, "db.port")
+	if err == nil || !strings.Contains(err.Error(), "not supported") {
+		t.Errorf("UpdateFileValues() error = %v, want creating keys to be unsupported for properties files", err)
+	}
+}
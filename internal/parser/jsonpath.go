@@ -0,0 +1,330 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"var-sync/pkg/models"
+)
+
+// Key paths starting with $ are JSONPath expressions, such as
+// $.services[?(@.name=="auth")].port. Their filters pick array elements by
+// their content rather than by index, for arrays that other tools reorder.
+// A JSONPath is resolved against the data it reads into an ordinary key
+// path; its * and [*] wildcards become key path wildcards.
+
+// jsonPathStep is one step of a JSONPath: a key, an array index, a wildcard
+// or a filter
+type jsonPathStep struct {
+	key      string
+	index    string // An array index, which may be negative, or "*"
+	wildcard bool   // .* over the keys of an object
+	filter   []jsonPathCondition
+}
+
+// jsonPathCondition is a comparison in a filter, such as @.name == "auth". A
+// condition without an operator tests that the key exists.
+type jsonPathCondition struct {
+	path     string // Key path below the element, or "" for the element
+	operator string
+	value    any
+}
+
+// IsJSONPath reports whether keyPath is a JSONPath expression
+func IsJSONPath(keyPath string) bool {
+	return keyPath == "$" || strings.HasPrefix(keyPath, "$.") || strings.HasPrefix(keyPath, "$[")
+}
+
+// ValidateJSONPath reports a JSONPath that var-sync cannot read
+func ValidateJSONPath(keyPath string) error {
+	_, err := parseJSONPath(keyPath)
+	return err
+}
+
+// parseJSONPath splits a JSONPath expression into its steps
+func parseJSONPath(path string) ([]jsonPathStep, error) {
+	invalid := func(format string, args ...any) error {
+		return fmt.Errorf("invalid JSONPath %s: %s", path, fmt.Sprintf(format, args...))
+	}
+
+	var steps []jsonPathStep
+	rest := strings.TrimPrefix(path, "$")
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, ".."):
+			return nil, invalid("recursive descent (..) is not supported")
+		case strings.HasPrefix(rest, "."):
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			key := rest[:end]
+			rest = rest[end:]
+			if key == "" {
+				return nil, invalid("empty key")
+			}
+			if key == "*" {
+				steps = append(steps, jsonPathStep{wildcard: true})
+			} else {
+				steps = append(steps, jsonPathStep{key: key})
+			}
+		case strings.HasPrefix(rest, "["):
+			end := closingBracket(rest)
+			if end < 0 {
+				return nil, invalid("unclosed [")
+			}
+			selector := strings.TrimSpace(rest[1:end])
+			rest = rest[end+1:]
+
+			switch {
+			case selector == "*":
+				steps = append(steps, jsonPathStep{index: "*"})
+			case strings.HasPrefix(selector, "?"):
+				conditions, err := parseJSONPathFilter(selector[1:])
+				if err != nil {
+					return nil, invalid("%v", err)
+				}
+				steps = append(steps, jsonPathStep{filter: conditions})
+			case len(selector) >= 2 && (selector[0] == '\'' || selector[0] == '"') && selector[len(selector)-1] == selector[0]:
+				steps = append(steps, jsonPathStep{key: selector[1 : len(selector)-1]})
+			default:
+				if _, err := strconv.Atoi(selector); err != nil {
+					return nil, invalid("unsupported selector [%s]", selector)
+				}
+				steps = append(steps, jsonPathStep{index: selector})
+			}
+		default:
+			return nil, invalid("expected . or [ at %s", rest)
+		}
+	}
+	return steps, nil
+}
+
+// closingBracket returns the index of the ] closing the [ that s starts
+// with, skipping brackets within quotes, or -1 if there is none
+func closingBracket(s string) int {
+	depth := 0
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '\'' || c == '"':
+			quote = c
+		case c == '[':
+			depth++
+		case c == ']':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// jsonPathOperators are the comparisons a filter supports, longest first so
+// that <= is not read as <
+var jsonPathOperators = []string{"==", "!=", "<=", ">=", "<", ">"}
+
+// parseJSONPathFilter parses a filter such as (@.name=="auth" && @.port)
+// into its conditions, all of which must hold
+func parseJSONPathFilter(filter string) ([]jsonPathCondition, error) {
+	filter = strings.TrimSpace(filter)
+	if strings.HasPrefix(filter, "(") && strings.HasSuffix(filter, ")") {
+		filter = filter[1 : len(filter)-1]
+	}
+	if strings.Contains(filter, "||") {
+		return nil, fmt.Errorf("|| in filters is not supported")
+	}
+
+	var conditions []jsonPathCondition
+	for _, expression := range strings.Split(filter, "&&") {
+		expression = strings.TrimSpace(expression)
+		if !strings.HasPrefix(expression, "@") {
+			return nil, fmt.Errorf("filter %s must start with @", expression)
+		}
+
+		var condition jsonPathCondition
+		left := expression
+		for _, operator := range jsonPathOperators {
+			if at := strings.Index(expression, operator); at >= 0 {
+				literal, err := parseJSONPathLiteral(strings.TrimSpace(expression[at+len(operator):]))
+				if err != nil {
+					return nil, err
+				}
+				left = strings.TrimSpace(expression[:at])
+				condition.operator, condition.value = operator, literal
+				break
+			}
+		}
+
+		switch {
+		case left == "@":
+		case strings.HasPrefix(left, "@."):
+			condition.path = left[2:]
+		case strings.HasPrefix(left, "@["):
+			steps, err := parseJSONPath("$" + left[1:])
+			if err != nil {
+				return nil, err
+			}
+			if len(steps) != 1 || steps[0].key == "" {
+				return nil, fmt.Errorf("unsupported filter %s", expression)
+			}
+			condition.path = quoteKey(steps[0].key)
+		default:
+			return nil, fmt.Errorf("unsupported filter %s", expression)
+		}
+		conditions = append(conditions, condition)
+	}
+	return conditions, nil
+}
+
+// parseJSONPathLiteral parses the value a filter compares with: a quoted
+// string, a number, true, false or null
+func parseJSONPathLiteral(literal string) (any, error) {
+	if len(literal) >= 2 && (literal[0] == '\'' || literal[0] == '"') && literal[len(literal)-1] == literal[0] {
+		return literal[1 : len(literal)-1], nil
+	}
+	switch literal {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if i, err := strconv.ParseInt(literal, 10, 64); err == nil {
+		return i, nil
+	}
+	if f, err := strconv.ParseFloat(literal, 64); err == nil {
+		return f, nil
+	}
+	return nil, fmt.Errorf("invalid value %s in filter", literal)
+}
+
+// resolveJSONPath turns a JSONPath into the key path it selects in data. A
+// filter must select exactly one element, and cannot follow a wildcard.
+func (p *Parser) resolveJSONPath(data map[string]any, path string) (string, error) {
+	steps, err := parseJSONPath(path)
+	if err != nil {
+		return "", err
+	}
+
+	var segments []string
+	wildcard := false
+	for _, step := range steps {
+		switch {
+		case step.wildcard:
+			segments = append(segments, "*")
+			wildcard = true
+		case step.key != "":
+			segments = append(segments, quoteKey(step.key))
+		case len(segments) == 0:
+			return "", fmt.Errorf("invalid JSONPath %s: the document is not an array", path)
+		case step.filter == nil:
+			segments[len(segments)-1] += "[" + step.index + "]"
+			wildcard = wildcard || step.index == "*"
+		default:
+			if wildcard {
+				return "", fmt.Errorf("invalid JSONPath %s: filters cannot follow a wildcard", path)
+			}
+			arrayPath := joinKeyPath(segments)
+			value, err := p.GetValue(data, arrayPath)
+			if err != nil {
+				return "", err
+			}
+			array, ok := value.([]any)
+			if !ok {
+				return "", fmt.Errorf("key %s is not an array, cannot filter it", arrayPath)
+			}
+
+			var matched []int
+			for i, element := range array {
+				if p.matchesFilter(element, step.filter) {
+					matched = append(matched, i)
+				}
+			}
+			switch len(matched) {
+			case 0:
+				return "", fmt.Errorf("%w: no element of %s matches the filter in %s", ErrKeyNotFound, arrayPath, path)
+			case 1:
+				segments[len(segments)-1] += fmt.Sprintf("[%d]", matched[0])
+			default:
+				return "", fmt.Errorf("%d elements of %s match the filter in %s, it must match one", len(matched), arrayPath, path)
+			}
+		}
+	}
+	if len(segments) == 0 {
+		return "", fmt.Errorf("invalid JSONPath %s: it selects the whole document", path)
+	}
+	return joinKeyPath(segments), nil
+}
+
+// matchesFilter reports whether an array element meets all conditions
+func (p *Parser) matchesFilter(element any, conditions []jsonPathCondition) bool {
+	for _, condition := range conditions {
+		value := element
+		if condition.path != "" {
+			object, ok := element.(map[string]any)
+			if !ok {
+				return false
+			}
+			var err error
+			if value, err = p.GetValue(object, condition.path); err != nil {
+				return false
+			}
+		}
+		if condition.operator != "" && !p.compare(value, condition.operator, condition.value) {
+			return false
+		}
+	}
+	return true
+}
+
+// compare compares a value with a filter's literal. Order comparisons need
+// two numbers or two strings.
+func (p *Parser) compare(value any, operator string, literal any) bool {
+	switch operator {
+	case "==":
+		return p.ValuesEqual(value, literal)
+	case "!=":
+		return !p.ValuesEqual(value, literal)
+	}
+
+	var order int
+	a, aErr := ConvertValue(value, models.TypeFloat)
+	b, bErr := ConvertValue(literal, models.TypeFloat)
+	_, aString := value.(string)
+	_, bString := literal.(string)
+	switch {
+	case aString && bString:
+		order = strings.Compare(value.(string), literal.(string))
+	case aErr == nil && bErr == nil && !isStructuredValue(value):
+		switch x, y := a.(float64), b.(float64); {
+		case x < y:
+			order = -1
+		case x > y:
+			order = 1
+		}
+	default:
+		return false
+	}
+
+	switch operator {
+	case "<":
+		return order < 0
+	case "<=":
+		return order <= 0
+	case ">":
+		return order > 0
+	default:
+		return order >= 0
+	}
+}
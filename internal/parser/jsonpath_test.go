@@ -0,0 +1,100 @@
+package parser
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestResolveJSONPath(t *testing.T) {
+	p := New()
+	data := map[string]any{
+		"services": []any{
+			map[string]any{"name": "web", "port": int64(80), "tags": []any{"public"}},
+			map[string]any{"name": "auth", "port": int64(8443)},
+			map[string]any{"name": "db", "port": int64(5432), "replica": true},
+		},
+		"hosts":       []any{"a.example.com", "b.example.com"},
+		"example.com": map[string]any{"port": int64(443)},
+	}
+
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{`$.services[?(@.name=="auth")].port`, "services[1].port"},
+		{`$.services[?(@.name == 'db' && @.replica)].port`, "services[2].port"},
+		{`$.services[?(@.port > 1000 && @.port < 6000)].name`, "services[2].name"},
+		{`$.services[?(@.tags)].name`, "services[0].name"},
+		{`$.hosts[?(@ != "a.example.com")]`, "hosts[1]"},
+		{`$['services'][0]['name']`, "services[0].name"},
+		{`$.services[-1].port`, "services[-1].port"},
+		{`$.services[*].port`, "services[*].port"},
+		{`$['example.com'].port`, `"example.com".port`},
+	}
+	for _, tt := range tests {
+		resolved, err := p.resolveJSONPath(data, tt.path)
+		if err != nil {
+			t.Errorf("resolveJSONPath(%s) returned error: %v", tt.path, err)
+		} else if resolved != tt.expected {
+			t.Errorf("resolveJSONPath(%s) = %s, want %s", tt.path, resolved, tt.expected)
+		}
+	}
+
+	value, err := p.GetValue(data, `$.services[?(@.name=="auth")].port`)
+	if err != nil || value != int64(8443) {
+		t.Errorf("GetValue() = %v, %v, want 8443", value, err)
+	}
+
+	if _, err := p.resolveJSONPath(data, `$.services[?(@.name=="mail")].port`); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("A filter matching nothing should return ErrKeyNotFound, got %v", err)
+	}
+	for _, path := range []string{`$.services[?(@.port > 0)].name`, `$.services[*].tags[?(@ == "public")]`} {
+		if _, err := p.resolveJSONPath(data, path); err == nil {
+			t.Errorf("resolveJSONPath(%s) should fail", path)
+		}
+	}
+}
+
+func TestValidateJSONPath(t *testing.T) {
+	for _, path := range []string{`$.a.b[0]`, `$.a[?(@.b=="c")].d`, `$['a.b'][*]`} {
+		if err := ValidateJSONPath(path); err != nil {
+			t.Errorf("ValidateJSONPath(%s) returned error: %v", path, err)
+		}
+	}
+	for _, path := range []string{`$..a`, `$.a[1:2]`, `$.a[?(@.b=="c" || @.d)]`, `$.a[`, `$.a[?(b==1)]`} {
+		if err := ValidateJSONPath(path); err == nil {
+			t.Errorf("ValidateJSONPath(%s) should fail", path)
+		}
+	}
+}
+
+func TestResolveKeyPathsJSONPath(t *testing.T) {
+	p := New()
+	data := map[string]any{
+		"services": []any{
+			map[string]any{"name": "auth", "port": int64(8443)},
+			map[string]any{"name": "web", "port": int64(80)},
+		},
+	}
+
+	// The filter follows the element wherever it moves in the array
+	for _, order := range [][]any{data["services"].([]any), {data["services"].([]any)[1], data["services"].([]any)[0]}} {
+		data["services"] = order
+		updates, err := p.ResolveKeyPaths(data, `$.services[?(@.name=="auth")].port`, "AUTH_PORT")
+		if err != nil {
+			t.Fatalf("ResolveKeyPaths() returned error: %v", err)
+		}
+		if expected := map[string]any{"AUTH_PORT": int64(8443)}; !reflect.DeepEqual(updates, expected) {
+			t.Errorf("ResolveKeyPaths() = %v, want %v", updates, expected)
+		}
+	}
+
+	updates, err := p.ResolveKeyPaths(data, `$.services[*].port`, "ports[*]")
+	if err != nil {
+		t.Fatalf("ResolveKeyPaths() returned error: %v", err)
+	}
+	if expected := map[string]any{"ports[0]": int64(80), "ports[1]": int64(8443)}; !reflect.DeepEqual(updates, expected) {
+		t.Errorf("ResolveKeyPaths() = %v, want %v", updates, expected)
+	}
+}
@@ -0,0 +1,322 @@
+package parser
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// Key path segments are separated by dots. A key that itself holds dots,
+// such as example.com, is written in double quotes or with its dots escaped:
+// servers."example.com".port or servers.example\.com.port. Key paths built
+// from files, such as those listed by GetAllKeys, quote such keys.
+
+// KeyPath is a key path parsed into its segments. GetValue, SetValue and the
+// file updaters are called with the same few key paths over and over, so
+// each is parsed once by ParseKeyPath and kept.
+type KeyPath struct {
+	text     string
+	segments []KeySegment
+	plain    bool  // Walks keys and array indexes alone, without wildcards, JSONPath or array operations
+	err      error // Why the key path is invalid, if it is
+}
+
+// KeySegment is one segment of a key path, such as ports[0] or
+// "example.com". An attribute such as the @timeout of server@timeout is a
+// segment of its own.
+type KeySegment struct {
+	Text   string // As written in the key path
+	Key    string // Without quotes or escapes
+	Index  int    // Array index, or -1 for none
+	Quoted bool   // Whether the key is written in double quotes
+	Offset int    // Where the segment starts in the key path, in bytes
+	err    error  // Why the segment is invalid, reported once it is reached
+}
+
+// KeyPathError reports an invalid key path and where in it the problem is
+type KeyPathError struct {
+	KeyPath string
+	Segment string // The invalid segment
+	Offset  int    // Where the problem is in the key path, in bytes
+	Reason  string
+}
+
+func (e *KeyPathError) Error() string {
+	column := utf8.RuneCountInString(e.KeyPath[:e.Offset]) + 1
+	return fmt.Sprintf("invalid key path %s at column %d (segment %s): %s", e.KeyPath, column, e.Segment, e.Reason)
+}
+
+// segmentError reports an invalid key path segment and where in it the
+// problem is
+type segmentError struct {
+	offset int
+	reason string
+}
+
+func (e *segmentError) Error() string {
+	return e.reason
+}
+
+// keyPathCacheSize is how many parsed key paths are kept. Once there are as
+// many, the cache is emptied and fills up again with those still in use.
+const keyPathCacheSize = 4096
+
+// keyPaths caches the key paths parsed by ParseKeyPath
+var keyPaths = struct {
+	parsed map[string]KeyPath
+	mutex  sync.RWMutex
+}{parsed: make(map[string]KeyPath)}
+
+// ParseKeyPath parses keyPath into its segments, reporting the first invalid
+// segment with a *KeyPathError. Wildcards and array operations are valid;
+// JSONPath expressions are checked as JSONPath. The parsed key path is kept,
+// so parsing the same key path again is cheap.
+func ParseKeyPath(keyPath string) (KeyPath, error) {
+	keyPaths.mutex.RLock()
+	path, ok := keyPaths.parsed[keyPath]
+	keyPaths.mutex.RUnlock()
+	if ok {
+		return path, path.err
+	}
+
+	path = KeyPath{
+		text:  keyPath,
+		plain: !IsJSONPath(keyPath) && !HasWildcard(keyPath) && !HasArrayOp(keyPath),
+	}
+	offset := 0
+	for _, text := range splitSegments(keyPath) {
+		if element, attribute, ok := splitAttribute(text); ok {
+			path.segments = append(path.segments, parseSegment(element, offset), parseSegment(attribute, offset+len(element)))
+		} else {
+			path.segments = append(path.segments, parseSegment(text, offset))
+		}
+		offset += len(text) + 1
+	}
+	if IsJSONPath(keyPath) {
+		path.err = ValidateJSONPath(keyPath)
+	} else {
+		for _, segment := range path.segments {
+			if invalid, ok := segment.err.(*segmentError); ok {
+				path.err = &KeyPathError{KeyPath: keyPath, Segment: segment.Text, Offset: segment.Offset + invalid.offset, Reason: invalid.reason}
+				break
+			}
+		}
+	}
+
+	keyPaths.mutex.Lock()
+	if len(keyPaths.parsed) >= keyPathCacheSize {
+		clear(keyPaths.parsed)
+	}
+	keyPaths.parsed[keyPath] = path
+	keyPaths.mutex.Unlock()
+	return path, path.err
+}
+
+// parseSegment parses a key path segment starting at offset in its key path
+func parseSegment(text string, offset int) KeySegment {
+	segment := KeySegment{Text: text, Index: -1, Quoted: strings.HasPrefix(text, `"`), Offset: offset}
+	if isWildcardSegment(text) || arrayOpPattern.MatchString(text) {
+		// Read by ExpandKeyPath and resolveArrayPath rather than walked
+		segment.Key, _ = cutKeyName(text)
+		return segment
+	}
+	var err *segmentError
+	segment.Key, segment.Index, err = scanKeySegment(text)
+	if err != nil {
+		segment.err = err
+	}
+	return segment
+}
+
+// String returns the key path as written
+func (k KeyPath) String() string {
+	return k.text
+}
+
+// Segments returns the segments of the key path. They are shared by every
+// caller parsing the same key path, so must not be modified.
+func (k KeyPath) Segments() []KeySegment {
+	return k.segments
+}
+
+// Plain reports whether the key path walks keys and array indexes alone,
+// without wildcards, JSONPath or array operations
+func (k KeyPath) Plain() bool {
+	return k.plain
+}
+
+// upTo returns the key path up to and including segment i, for error
+// messages
+func (k KeyPath) upTo(i int) string {
+	texts := make([]string, i+1)
+	for j := range texts {
+		texts[j] = k.segments[j].Text
+	}
+	return strings.Join(texts, ".")
+}
+
+// scanKeySegment parses a key segment that might end in an array index,
+// returning the key without quotes or escapes and the index, or -1 for none.
+// An invalid segment is reported with where in it the problem is.
+func scanKeySegment(segment string) (string, int, *segmentError) {
+	if strings.HasPrefix(segment, `"`) && !closesQuote(segment) {
+		return "", -1, &segmentError{0, "quoted key has no closing quote"}
+	}
+	key, rest := cutKeyName(segment)
+	if rest == "" {
+		return key, -1, nil
+	}
+
+	start := len(segment) - len(rest)
+	if rest[0] != '[' {
+		return "", -1, &segmentError{start, fmt.Sprintf("unexpected %q after quoted key", rest)}
+	}
+	if key == "" {
+		return "", -1, &segmentError{start, "array index without a key before it"}
+	}
+	end := strings.IndexByte(rest, ']')
+	if end < 0 {
+		return "", -1, &segmentError{start, "array index has no closing ]"}
+	}
+	digits := rest[1:end]
+	if digits == "" {
+		return "", -1, &segmentError{start, "array index is empty"}
+	}
+	if strings.Trim(digits, "0123456789") != "" {
+		return "", -1, &segmentError{start + 1, fmt.Sprintf("array index %q is not a number", digits)}
+	}
+	index, err := strconv.Atoi(digits)
+	if err != nil {
+		return "", -1, &segmentError{start + 1, fmt.Sprintf("array index %s is too large", digits)}
+	}
+	if end != len(rest)-1 {
+		return "", -1, &segmentError{start + end + 1, fmt.Sprintf("unexpected %q after array index", rest[end+1:])}
+	}
+	return key, index, nil
+}
+
+// closesQuote reports whether a segment starting with a double quote has
+// the closing quote too
+func closesQuote(segment string) bool {
+	for i := 1; i < len(segment); i++ {
+		switch segment[i] {
+		case '\\':
+			i++
+		case '"':
+			return true
+		}
+	}
+	return false
+}
+
+// splitAttribute splits an attribute segment such as server@timeout into the
+// element and an "@timeout" key
+func splitAttribute(segment string) (element, attribute string, ok bool) {
+	at := strings.Index(segment, "@")
+	if at > 0 && at < len(segment)-1 && !strings.ContainsAny(segment[:at], `["\`) {
+		return segment[:at], segment[at:], true
+	}
+	return "", "", false
+}
+
+// splitSegments splits a key path on the dots that are not quoted, escaped
+// or within brackets, so that hosts[=a.example.com] stays one segment
+func splitSegments(keyPath string) []string {
+	var segments []string
+	depth, start := 0, 0
+	quoted, escaped := false, false
+	for i, char := range keyPath {
+		switch {
+		case escaped:
+			escaped = false
+		case char == '\\':
+			escaped = true
+		case char == '"' && depth == 0:
+			quoted = !quoted
+		case quoted:
+		case char == '[':
+			depth++
+		case char == ']':
+			if depth > 0 {
+				depth--
+			}
+		case char == '.' && depth == 0:
+			segments = append(segments, keyPath[start:i])
+			start = i + 1
+		}
+	}
+	return append(segments, keyPath[start:])
+}
+
+// cutKeyName splits a key path segment into the key it names, without quotes
+// or escapes, and what follows the key, such as an array index
+func cutKeyName(segment string) (name, rest string) {
+	var b strings.Builder
+	if strings.HasPrefix(segment, `"`) {
+		for i := 1; i < len(segment); i++ {
+			switch segment[i] {
+			case '\\':
+				if i+1 < len(segment) {
+					i++
+					b.WriteByte(segment[i])
+				}
+			case '"':
+				return b.String(), segment[i+1:]
+			default:
+				b.WriteByte(segment[i])
+			}
+		}
+		return b.String(), ""
+	}
+
+	for i := 0; i < len(segment); i++ {
+		switch segment[i] {
+		case '\\':
+			if i+1 < len(segment) {
+				i++
+				b.WriteByte(segment[i])
+			}
+		case '[':
+			return b.String(), segment[i:]
+		default:
+			b.WriteByte(segment[i])
+		}
+	}
+	return b.String(), ""
+}
+
+// quoteKey writes a key as a key path segment, quoting it if it holds
+// characters that key paths use, is empty or would be read as a wildcard,
+// JSONPath or attribute
+func quoteKey(key string) string {
+	if key != "" && !strings.ContainsAny(key, `.[]"\`) && key != "*" && key != "$" && strings.Index(key, "@") <= 0 {
+		return key
+	}
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(key)
+	return `"` + escaped + `"`
+}
+
+// canonicalSegment writes a key path segment the way key paths built from
+// files do, quoting its key only if it has to be
+func canonicalSegment(segment string) string {
+	if strings.HasPrefix(segment, "@") || !strings.ContainsAny(segment, `"\`) {
+		return segment
+	}
+	name, rest := cutKeyName(segment)
+	return quoteKey(name) + rest
+}
+
+// canonicalKeyPath writes keyPath the way key paths built from files do, so
+// that servers.example\.com.port and servers."example.com".port compare equal
+func canonicalKeyPath(keyPath string) string {
+	if !strings.ContainsAny(keyPath, `"\`) {
+		return keyPath
+	}
+	segments := splitKeyPath(keyPath)
+	for i, segment := range segments {
+		segments[i] = canonicalSegment(strings.TrimSpace(segment))
+	}
+	return joinKeyPath(segments)
+}
@@ -0,0 +1,223 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplitKeyPathQuoted(t *testing.T) {
+	tests := []struct {
+		keyPath  string
+		expected []string
+	}{
+		{`servers."example.com".port`, []string{"servers", `"example.com"`, "port"}},
+		{`servers.example\.com.port`, []string{"servers", `example\.com`, "port"}},
+		{`"a.b"[0].c`, []string{`"a.b"[0]`, "c"}},
+		{`hosts[=a.example.com]`, []string{"hosts[=a.example.com]"}},
+		{`"server@eu".timeout`, []string{`"server@eu"`, "timeout"}},
+	}
+	for _, tt := range tests {
+		if got := splitKeyPath(tt.keyPath); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("splitKeyPath(%s) = %q, want %q", tt.keyPath, got, tt.expected)
+		}
+	}
+}
+
+func TestQuotedKeyValues(t *testing.T) {
+	p := New()
+	data := map[string]any{
+		"servers": map[string]any{
+			"example.com": map[string]any{"port": int64(443)},
+		},
+		"my.dotted.key": []any{"a", "b"},
+	}
+
+	for _, keyPath := range []string{`servers."example.com".port`, `servers.example\.com.port`} {
+		value, err := p.GetValue(data, keyPath)
+		if err != nil || value != int64(443) {
+			t.Errorf("GetValue(%s) = %v, %v, want 443", keyPath, value, err)
+		}
+	}
+	if value, err := p.GetValue(data, `"my.dotted.key"[1]`); err != nil || value != "b" {
+		t.Errorf("GetValue() = %v, %v, want b", value, err)
+	}
+
+	if err := p.SetValue(data, `servers."example.com".port`, int64(8443)); err != nil {
+		t.Fatalf("SetValue() returned error: %v", err)
+	}
+	if err := p.SetValue(data, `servers."api.example.com".port`, int64(80)); err != nil {
+		t.Fatalf("SetValue() returned error: %v", err)
+	}
+	expected := map[string]any{
+		"example.com":     map[string]any{"port": int64(8443)},
+		"api.example.com": map[string]any{"port": int64(80)},
+	}
+	if !reflect.DeepEqual(data["servers"], expected) {
+		t.Errorf("SetValue() left servers as %v, want %v", data["servers"], expected)
+	}
+
+	keys := p.ExpandKeyPath(data, "servers.*.port")
+	want := []string{`servers."api.example.com".port`, `servers."example.com".port`}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("ExpandKeyPath() = %q, want %q", keys, want)
+	}
+}
+
+func TestUpdateFileValuesQuotedKeys(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		updates  map[string]any
+		expected string
+	}{
+		{
+			name:     "config.yaml",
+			content:  "servers:\n  example.com:\n    port: 443 # https\n  \"api.example.com\":\n    port: 80\n",
+			updates:  map[string]any{`servers."example.com".port`: 8443, `servers.api\.example\.com.port`: 8080},
+			expected: "servers:\n  example.com:\n    port: 8443 # https\n  \"api.example.com\":\n    port: 8080\n",
+		},
+		{
+			name:     "config.toml",
+			content:  "[servers.\"example.com\"]\nport = 443\n\n[hosts]\n\"my.dotted.key\" = \"a\" # note\n",
+			updates:  map[string]any{`servers."example.com".port`: 8443, `hosts.my\.dotted\.key`: "b"},
+			expected: "[servers.\"example.com\"]\nport = 8443\n\n[hosts]\n\"my.dotted.key\" = \"b\" # note\n",
+		},
+		{
+			name:     "missing.toml",
+			content:  "[servers.\"example.com\"]\nport = 443\n",
+			updates:  map[string]any{`servers."example.com".host`: "example.com"},
+			expected: "[servers.\"example.com\"]\nport = 443\nhost = \"example.com\"\n",
+		},
+	}
+
+	p := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.name)
+			if err := os.WriteFile(filePath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			var create []string
+			for keyPath := range tt.updates {
+				create = append(create, keyPath)
+			}
+			if err := p.UpdateFileValues(filePath, tt.updates, create...); err != nil {
+				t.Fatalf("UpdateFileValues() returned error: %v", err)
+			}
+
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("UpdateFileValues() wrote:\n%s\nwant:\n%s", content, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseKeyPath(t *testing.T) {
+	path, err := ParseKeyPath(`servers."example.com".ports[1]`)
+	if err != nil {
+		t.Fatalf("ParseKeyPath() error = %v", err)
+	}
+	if !path.Plain() || path.String() != `servers."example.com".ports[1]` {
+		t.Errorf("ParseKeyPath() = %+v", path)
+	}
+	want := []KeySegment{
+		{Text: "servers", Key: "servers", Index: -1, Offset: 0},
+		{Text: `"example.com"`, Key: "example.com", Index: -1, Quoted: true, Offset: 8},
+		{Text: "ports[1]", Key: "ports", Index: 1, Offset: 22},
+	}
+	if !reflect.DeepEqual(path.Segments(), want) {
+		t.Errorf("ParseKeyPath() segments = %+v, want %+v", path.Segments(), want)
+	}
+	if again, _ := ParseKeyPath(`servers."example.com".ports[1]`); &again.Segments()[0] != &path.Segments()[0] {
+		t.Error("ParseKeyPath() parsed the same key path twice")
+	}
+
+	attribute, _ := ParseKeyPath("config.server@timeout")
+	if segments := attribute.Segments(); len(segments) != 3 || segments[2].Key != "@timeout" || segments[2].Offset != 13 {
+		t.Errorf("ParseKeyPath() of an attribute = %+v", segments)
+	}
+
+	for _, keyPath := range []string{"servers[*].host", "$.servers[0]", "hosts[+]", "hosts[=a.example.com].port"} {
+		path, err := ParseKeyPath(keyPath)
+		if err != nil || path.Plain() {
+			t.Errorf("ParseKeyPath(%s) = plain %v, %v; want a valid key path that is not plain", keyPath, path.Plain(), err)
+		}
+	}
+}
+
+func TestParseKeyPathErrors(t *testing.T) {
+	tests := []struct {
+		keyPath string
+		segment string
+		column  int
+		reason  string
+	}{
+		{"servers[x].host", "servers[x]", 9, `array index "x" is not a number`},
+		{"servers.ports[1", "ports[1", 14, "array index has no closing ]"},
+		{"ports[]", "ports[]", 6, "array index is empty"},
+		{"a.[0]", "[0]", 3, "array index without a key before it"},
+		{"ports[1]x.y", "ports[1]x", 9, `unexpected "x" after array index`},
+		{"ports[1][2]", "ports[1][2]", 9, `unexpected "[2]" after array index`},
+		{`hosts."example.com"x`, `"example.com"x`, 20, `unexpected "x" after quoted key`},
+		{`hosts."example.com`, `"example.com`, 7, "quoted key has no closing quote"},
+		{"ports[99999999999999999999]", "ports[99999999999999999999]", 7, "array index 99999999999999999999 is too large"},
+		{"café.ports[x]", "ports[x]", 12, `array index "x" is not a number`},
+	}
+	for _, tt := range tests {
+		_, err := ParseKeyPath(tt.keyPath)
+		var keyPathErr *KeyPathError
+		if !errors.As(err, &keyPathErr) {
+			t.Errorf("ParseKeyPath(%s) error = %v, want a KeyPathError", tt.keyPath, err)
+			continue
+		}
+		if keyPathErr.Segment != tt.segment || keyPathErr.Reason != tt.reason {
+			t.Errorf("ParseKeyPath(%s) error = %+v, want %s in segment %s", tt.keyPath, keyPathErr, tt.reason, tt.segment)
+		}
+		if wantColumn := fmt.Sprintf("at column %d ", tt.column); !strings.Contains(err.Error(), wantColumn) {
+			t.Errorf("ParseKeyPath(%s) error = %q, want it %s", tt.keyPath, err, wantColumn)
+		}
+	}
+
+	// Reading or writing the key path reports the same error
+	p := New()
+	data := map[string]any{"servers": []any{map[string]any{"host": "a"}}}
+	if _, err := p.GetValue(data, "servers[x].host"); err == nil || !strings.Contains(err.Error(), "at column 9") {
+		t.Errorf("GetValue() error = %v, want the position of the bad index", err)
+	}
+	if err := p.SetValue(data, "servers[x].host", "b"); err == nil || !strings.Contains(err.Error(), "at column 9") {
+		t.Errorf("SetValue() error = %v, want the position of the bad index", err)
+	}
+}
+
+func TestValuesInMapsWithAnyKeys(t *testing.T) {
+	p := New()
+	data := map[string]any{
+		"servers": map[any]any{
+			"web": map[any]any{"port": 80},
+			8080:  "alt",
+		},
+	}
+
+	if value, err := p.GetValue(data, "servers.8080"); err != nil || value != "alt" {
+		t.Errorf("GetValue(servers.8080) = %v, %v", value, err)
+	}
+	if value, err := p.GetValue(data, "servers.web"); err != nil || !reflect.DeepEqual(value, map[string]any{"port": 80}) {
+		t.Errorf("GetValue(servers.web) = %#v, %v; want a converted object", value, err)
+	}
+
+	if err := p.SetValue(data, "servers.db.host", "db"); err != nil {
+		t.Fatalf("SetValue() error = %v", err)
+	}
+	if value, err := p.GetValue(data, "servers.db.host"); err != nil || value != "db" {
+		t.Errorf("GetValue(servers.db.host) after SetValue = %v, %v", value, err)
+	}
+}
@@ -0,0 +1,138 @@
+package parser
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Kubernetes manifest kinds whose data section is handled specially
+const (
+	kindConfigMap = "ConfigMap"
+	kindSecret    = "Secret"
+)
+
+// kubernetesString is a ConfigMap or Secret data value. Kubernetes requires
+// these to be strings, so they are quoted whenever YAML would otherwise read
+// them as a number, boolean or null.
+type kubernetesString string
+
+// kubernetesKind returns the kind of a core/v1 ConfigMap or Secret manifest,
+// or an empty string for any other document
+func kubernetesKind(data map[string]any) string {
+	if data["apiVersion"] != "v1" {
+		return ""
+	}
+	switch kind := data["kind"]; kind {
+	case kindConfigMap, kindSecret:
+		return kind.(string)
+	default:
+		return ""
+	}
+}
+
+// decodeKubernetesSecret replaces the base64 values under a Secret's data
+// section with their decoded text, so that data.PASSWORD reads as plain text.
+// Values that are not valid base64 are left unchanged.
+func decodeKubernetesSecret(data map[string]any) {
+	if kubernetesKind(data) != kindSecret {
+		return
+	}
+
+	secretData, ok := data["data"].(map[string]any)
+	if !ok {
+		return
+	}
+	for key, value := range secretData {
+		encoded, ok := value.(string)
+		if !ok {
+			continue
+		}
+		if decoded, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+			secretData[key] = string(decoded)
+		}
+	}
+}
+
+// encodeKubernetesSecret returns a copy of a Secret manifest with the values
+// under its data section base64 encoded. Other documents are returned as is.
+func encodeKubernetesSecret(data map[string]any) map[string]any {
+	if kubernetesKind(data) != kindSecret {
+		return data
+	}
+
+	secretData, ok := data["data"].(map[string]any)
+	if !ok {
+		return data
+	}
+
+	encoded := make(map[string]any, len(secretData))
+	for key, value := range secretData {
+		encoded[key] = base64.StdEncoding.EncodeToString([]byte(formatKubernetesValue(value)))
+	}
+
+	result := make(map[string]any, len(data))
+	for key, value := range data {
+		result[key] = value
+	}
+	result["data"] = encoded
+	return result
+}
+
+// kubernetesUpdates converts updates targeting the data section of a
+// ConfigMap or Secret into string values, base64 encoding them for Secrets.
+// Updates for any other YAML document are returned unchanged.
+func kubernetesUpdates(content string, updates map[string]any) map[string]any {
+	var manifest map[string]any
+	if err := yaml.Unmarshal([]byte(content), &manifest); err != nil {
+		return updates
+	}
+
+	kind := kubernetesKind(manifest)
+	if kind == "" {
+		return updates
+	}
+
+	result := make(map[string]any, len(updates))
+	for keyPath, value := range updates {
+		if !strings.HasPrefix(keyPath, "data.") {
+			result[keyPath] = value
+			continue
+		}
+
+		text := formatKubernetesValue(value)
+		if kind == kindSecret {
+			text = base64.StdEncoding.EncodeToString([]byte(text))
+		}
+		result[keyPath] = kubernetesString(text)
+	}
+	return result
+}
+
+// formatKubernetesValue formats a value as a ConfigMap or Secret string
+func formatKubernetesValue(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return formatScalar(v)
+	}
+}
+
+// formatKubernetesString formats a data value for YAML, quoting it if a plain
+// scalar would not be read back as the same string
+func formatKubernetesString(value kubernetesString) string {
+	plain := formatYAMLValue(string(value))
+
+	var decoded any
+	if err := yaml.Unmarshal([]byte("v: "+plain), &decoded); err == nil {
+		if m, ok := decoded.(map[string]any); ok && m["v"] == string(value) {
+			return plain
+		}
+	}
+	return strconv.Quote(string(value))
+}
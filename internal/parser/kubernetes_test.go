@@ -0,0 +1,154 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testKubernetesSecret = `apiVersion: v1
+kind: Secret
+metadata:
+  name: app-credentials # managed by var-sync
+type: Opaque
+data:
+  DB_PASSWORD: czNjcjN0
+  API_TOKEN: dG9rZW4=
+`
+
+func TestLoadFileKubernetesSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.yaml")
+	if err := os.WriteFile(path, []byte(testKubernetesSecret), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	parser := New()
+	data, err := parser.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	if value, _ := parser.GetValue(data, "data.DB_PASSWORD"); value != "s3cr3t" {
+		t.Errorf("GetValue(data.DB_PASSWORD) = %v, expected decoded s3cr3t", value)
+	}
+	if value, _ := parser.GetValue(data, "metadata.name"); value != "app-credentials" {
+		t.Errorf("GetValue(metadata.name) = %v, expected app-credentials", value)
+	}
+}
+
+func TestUpdateKubernetesManifests(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		updates         map[string]any
+		expectedContent string
+	}{
+		{
+			name:    "secret values are base64 encoded",
+			content: testKubernetesSecret,
+			updates: map[string]any{
+				"data.DB_PASSWORD": "n3w-pass",
+				"metadata.name":    "app-secrets",
+			},
+			expectedContent: `apiVersion: v1
+kind: Secret
+metadata:
+  name: app-secrets # managed by var-sync
+type: Opaque
+data:
+  DB_PASSWORD: bjN3LXBhc3M=
+  API_TOKEN: dG9rZW4=
+`,
+		},
+		{
+			name: "configmap values are kept as strings",
+			content: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+data:
+  APP_HOST: localhost
+  APP_PORT: "8080"
+  DEBUG: "false"
+`,
+			updates: map[string]any{
+				"data.APP_HOST": "db.internal",
+				"data.APP_PORT": 9090,
+				"data.DEBUG":    true,
+			},
+			expectedContent: `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: app-config
+data:
+  APP_HOST: db.internal
+  APP_PORT: "9090"
+  DEBUG: "true"
+`,
+		},
+		{
+			name: "other documents are not affected",
+			content: `kind: Secret
+data:
+  port: 8080
+`,
+			updates: map[string]any{"data.port": 9090},
+			expectedContent: `kind: Secret
+data:
+  port: 9090
+`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "manifest.yaml")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			parser := New()
+			if err := parser.UpdateFileValues(path, tt.updates); err != nil {
+				t.Fatalf("UpdateFileValues() error = %v", err)
+			}
+
+			actual, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read updated file: %v", err)
+			}
+			if string(actual) != tt.expectedContent {
+				t.Errorf("UpdateFileValues() result:\n%s\nExpected:\n%s", actual, tt.expectedContent)
+			}
+		})
+	}
+}
+
+func TestSaveFileKubernetesSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secret.yaml")
+	data := map[string]any{
+		"apiVersion": "v1",
+		"kind":       "Secret",
+		"metadata":   map[string]any{"name": "generated"},
+		"data":       map[string]any{"TOKEN": "abc", "PORT": 5432},
+	}
+
+	parser := New()
+	if err := parser.SaveFile(path, data); err != nil {
+		t.Fatalf("SaveFile() error = %v", err)
+	}
+
+	if data["data"].(map[string]any)["TOKEN"] != "abc" {
+		t.Errorf("SaveFile() modified the caller's data")
+	}
+
+	loaded, err := parser.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if value, _ := parser.GetValue(loaded, "data.TOKEN"); value != "abc" {
+		t.Errorf("Round trip GetValue(data.TOKEN) = %v, expected abc", value)
+	}
+	if value, _ := parser.GetValue(loaded, "data.PORT"); value != "5432" {
+		t.Errorf("Round trip GetValue(data.PORT) = %v, expected 5432", value)
+	}
+}
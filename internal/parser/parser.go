@@ -2,16 +2,22 @@ package parser
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"math"
 	"os"
-	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/BurntSushi/toml"
 	"gopkg.in/yaml.v3"
 
+	"var-sync/internal/textfile"
 	"var-sync/pkg/models"
 )
 
@@ -22,23 +28,46 @@ func New() *Parser {
 }
 
 func (p *Parser) LoadFile(filepath string) (map[string]any, error) {
-	data, err := os.ReadFile(filepath)
+	data, err := textfile.Read(filepath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %w", err)
 	}
 
-	format := models.DetectFormat(filepath)
+	return p.Parse(filepath, models.DetectFormat(filepath), data)
+}
+
+// Parse decodes content in the given format. The name is only used in error
+// messages.
+func (p *Parser) Parse(name string, format models.FileFormat, data []byte) (map[string]any, error) {
 	var result map[string]any
+	var err error
 
 	switch format {
 	case models.FormatJSON:
-		err = json.Unmarshal(data, &result)
+		// Numbers are decoded as json.Number so that integers stay integers
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.UseNumber()
+		err = decoder.Decode(&result)
 	case models.FormatYAML:
 		err = yaml.Unmarshal(data, &result)
+		if err == nil {
+			decodeKubernetesSecret(result)
+			decodeComposeEnvironment(result)
+		}
 	case models.FormatTOML:
 		err = toml.Unmarshal(data, &result)
 	case models.FormatENV:
 		result, err = p.parseEnvFile(string(data))
+	case models.FormatINI:
+		result, err = p.parseINIFile(string(data))
+	case models.FormatProperties:
+		result, err = p.parsePropertiesFile(string(data))
+	case models.FormatHCL:
+		result, err = p.parseHCLFile(name, data)
+	case models.FormatXML:
+		result, err = p.parseXMLFile(data)
+	case models.FormatDockerfile:
+		result, err = p.parseDockerfile(string(data))
 	default:
 		return nil, fmt.Errorf("unsupported file format: %s", format)
 	}
@@ -47,6 +76,7 @@ func (p *Parser) LoadFile(filepath string) (map[string]any, error) {
 		return nil, fmt.Errorf("failed to parse %s file: %w", format, err)
 	}
 
+	NormalizeValue(result)
 	return result, nil
 }
 
@@ -55,15 +85,29 @@ func (p *Parser) SaveFile(filepath string, data map[string]any) error {
 	// This method should only be used when creating new files.
 	// For updates to existing files, use UpdateFileValue() or UpdateFileValues() instead.
 	
+	output, err := p.marshalFile(filepath, data)
+	if err != nil {
+		return err
+	}
+
+	if err := textfile.Write(filepath, output); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// marshalFile encodes data in the format matching filepath's extension
+func (p *Parser) marshalFile(filepath string, data map[string]any) ([]byte, error) {
 	format := models.DetectFormat(filepath)
 	var output []byte
 	var err error
 
 	switch format {
 	case models.FormatJSON:
-		output, err = json.MarshalIndent(data, "", "  ")
+		output, err = json.MarshalIndent(jsonNumbers(data), "", "  ")
 	case models.FormatYAML:
-		output, err = yaml.Marshal(data)
+		output, err = yaml.Marshal(yamlNumbers(encodeKubernetesSecret(data)))
 	case models.FormatTOML:
 		var buf strings.Builder
 		err = toml.NewEncoder(&buf).Encode(data)
@@ -72,19 +116,48 @@ func (p *Parser) SaveFile(filepath string, data map[string]any) error {
 		}
 	case models.FormatENV:
 		output = []byte(p.formatEnvFile(data))
+		if strings.HasSuffix(filepath, ".sh") {
+			output = []byte(exportEnvLines(string(output)))
+		}
+	case models.FormatINI:
+		output = []byte(p.formatINIFile(data))
+	case models.FormatProperties:
+		output = []byte(p.formatPropertiesFile(data))
+	case models.FormatHCL:
+		output, err = p.formatHCLFile(data)
+	case models.FormatXML:
+		output = []byte(p.formatXMLFile(data))
+	case models.FormatDockerfile:
+		var text string
+		text, err = p.formatDockerfile(data)
+		output = []byte(text)
 	default:
-		return fmt.Errorf("unsupported file format: %s", format)
+		return nil, fmt.Errorf("unsupported file format: %s", format)
 	}
 
 	if err != nil {
-		return fmt.Errorf("failed to marshal %s data: %w", format, err)
+		return nil, fmt.Errorf("failed to marshal %s data: %w", format, err)
 	}
 
-	if err := os.WriteFile(filepath, output, 0644); err != nil {
-		return fmt.Errorf("failed to write file: %w", err)
+	return output, nil
+}
+
+// LoadFileContext is LoadFile, failing without reading the file once ctx is
+// done
+func (p *Parser) LoadFileContext(ctx context.Context, filepath string) (map[string]any, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
+	return p.LoadFile(filepath)
+}
 
-	return nil
+// UpdateFileValuesContext is UpdateFileValues, failing without touching the
+// file once ctx is done
+func (p *Parser) UpdateFileValuesContext(ctx context.Context, filepath string, updates map[string]any, create ...string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return p.UpdateFileValues(filepath, updates, create...)
 }
 
 // UpdateFileValue updates a specific value in a file while preserving formatting and comments
@@ -94,8 +167,26 @@ func (p *Parser) UpdateFileValue(filepath string, keyPath string, newValue any)
 }
 
 // UpdateFileValues updates multiple values in a file while preserving formatting and comments
-// Takes a map of keyPath -> newValue for batched updates
-func (p *Parser) UpdateFileValues(filepath string, updates map[string]any) error {
+// Takes a map of keyPath -> newValue for batched updates, where a value of
+// Deleted removes the key. Key paths in create are added to the file if it
+// does not have them yet.
+func (p *Parser) UpdateFileValues(filepath string, updates map[string]any, create ...string) error {
+	if len(create) > 0 || hasDeletes(updates) || hasArrayOps(updates) {
+		content, err := p.PreviewFileValues(filepath, updates, create...)
+		if err != nil {
+			return err
+		}
+		return textfile.Write(filepath, content)
+	}
+
+	updates, rewritten, err := p.expandStructuredValues(filepath, updates)
+	if err != nil {
+		return err
+	}
+	if rewritten != nil {
+		return textfile.Write(filepath, rewritten)
+	}
+
 	format := models.DetectFormat(filepath)
 	
 	switch format {
@@ -107,262 +198,235 @@ func (p *Parser) UpdateFileValues(filepath string, updates map[string]any) error
 		return p.updateJSONValues(filepath, updates)
 	case models.FormatENV:
 		return p.updateEnvValues(filepath, updates)
+	case models.FormatINI:
+		return p.updateINIValues(filepath, updates)
+	case models.FormatProperties:
+		return p.updatePropertiesValues(filepath, updates)
+	case models.FormatHCL:
+		return p.updateHCLValues(filepath, updates)
+	case models.FormatXML:
+		return p.updateXMLValues(filepath, updates)
+	case models.FormatDockerfile:
+		return p.updateDockerfileValues(filepath, updates)
 	default:
 		return fmt.Errorf("unsupported file format for targeted updates: %s", format)
 	}
 }
 
-// yamlLineContext represents the structural context of a line in YAML
-type yamlLineContext struct {
-	lineNumber    int
-	indentLevel   int
-	key           string
-	isArrayItem   bool
-	arrayIndex    int
-	parentPath    string
-	fullPath      string
+// PreviewFileValues returns the content UpdateFileValues would write for the
+// given updates without modifying the file on disk. The content keeps the
+// byte order mark and line endings of the file.
+func (p *Parser) PreviewFileValues(filepath string, updates map[string]any, create ...string) ([]byte, error) {
+	content, err := os.ReadFile(filepath)
+	if errors.Is(err, os.ErrNotExist) && models.DetectFormat(filepath) == models.FormatENV && createsAll(updates, create) {
+		// An env file is just its lines, so one that does not exist yet
+		// starts out empty and gets every key added
+		content, err = nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	style := textfile.Detect(content)
+	content = textfile.Normalize(content)
+
+	updates, rewritten, err := p.expandStructuredValues(filepath, updates)
+	if err != nil {
+		return nil, err
+	}
+	if rewritten != nil {
+		return style.Apply(rewritten), nil
+	}
+	content, updates, err = p.applyArrayOps(filepath, content, updates)
+	if err != nil {
+		return nil, err
+	}
+	content, updates, err = p.insertMissingKeys(filepath, content, updates, create)
+	if err != nil {
+		return nil, err
+	}
+	content, updates, err = p.removeDeletedKeys(filepath, content, updates)
+	if err != nil {
+		return nil, err
+	}
+	if len(updates) == 0 {
+		return style.Apply(content), nil
+	}
+
+	var output string
+	format := models.DetectFormat(filepath)
+	switch format {
+	case models.FormatYAML:
+		output, err = p.renderYAMLValues(string(content), updates)
+	case models.FormatTOML:
+		output, err = p.renderTOMLValues(string(content), updates)
+	case models.FormatJSON:
+		output, err = p.renderJSONValues(content, updates)
+	case models.FormatENV:
+		output, err = p.renderEnvValues(string(content), updates)
+	case models.FormatINI:
+		output, err = p.renderINIValues(string(content), updates)
+	case models.FormatProperties:
+		output, err = p.renderPropertiesValues(string(content), updates)
+	case models.FormatHCL:
+		output, err = p.renderHCLValues(filepath, content, updates)
+	case models.FormatXML:
+		output, err = p.renderXMLValues(content, updates)
+	case models.FormatDockerfile:
+		output, err = p.renderDockerfileValues(string(content), updates)
+	default:
+		return nil, fmt.Errorf("unsupported file format for targeted updates: %s", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return style.Apply([]byte(output)), nil
 }
 
 // updateYAMLValues updates multiple values in a YAML file while preserving formatting
 func (p *Parser) updateYAMLValues(filepath string, updates map[string]any) error {
-	content, err := os.ReadFile(filepath)
+	content, err := textfile.Read(filepath)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
-	lines := strings.Split(string(content), "\n")
-	
-	// Parse the file structure to understand context of each line
-	contexts := p.parseYAMLStructure(lines)
-	
-	// Create a map to track which lines have been updated
-	updatedLines := make(map[int]bool)
-	updatedCount := 0
-	
-	// Process each update by finding the exact structural match
-	for keyPath, newValue := range updates {
-		lineNum := p.findYAMLLineForKeyPath(contexts, keyPath)
-		if lineNum >= 0 && !updatedLines[lineNum] {
-			// Update the line surgically - preserve everything except the value
-			context := contexts[lineNum]
-			originalLine := lines[lineNum]
-			valueStr := formatYAMLValue(newValue)
-			
-			// Find the key in the line and replace only the value part
-			keyPattern := context.key + ":"
-			keyIndex := strings.Index(originalLine, keyPattern)
-			if keyIndex >= 0 {
-				// Find where the value starts (after "key:")
-				valueStart := keyIndex + len(keyPattern)
-				
-				// Skip any whitespace after the colon
-				for valueStart < len(originalLine) && (originalLine[valueStart] == ' ' || originalLine[valueStart] == '\t') {
-					valueStart++
-				}
-				
-				// Find where the value ends (before any comment or end of line)
-				valueEnd := valueStart
-				inQuotes := false
-				for valueEnd < len(originalLine) {
-					char := originalLine[valueEnd]
-					if char == '"' && (valueEnd == valueStart || originalLine[valueEnd-1] != '\\') {
-						inQuotes = !inQuotes
-					} else if !inQuotes && (char == '#' || char == '\n') {
-						break
-					}
-					valueEnd++
-				}
-				
-				// Skip trailing whitespace from the value
-				for valueEnd > valueStart && (originalLine[valueEnd-1] == ' ' || originalLine[valueEnd-1] == '\t') {
-					valueEnd--
-				}
-				
-				// Surgically replace only the value part
-				before := originalLine[:valueStart]
-				after := originalLine[valueEnd:]
-				lines[lineNum] = before + valueStr + after
-			}
-			updatedLines[lineNum] = true
-			updatedCount++
-		}
-	}
-	
-	if updatedCount == 0 {
-		return fmt.Errorf("no key paths found in file")
+	newContent, err := p.renderYAMLValues(string(content), updates)
+	if err != nil {
+		return err
 	}
-	
-	// Write back the modified content once
-	newContent := strings.Join(lines, "\n")
-	return os.WriteFile(filepath, []byte(newContent), 0644)
+
+	return textfile.Write(filepath, []byte(newContent))
 }
 
-// parseYAMLStructure analyzes YAML file structure and returns context for each line
-func (p *Parser) parseYAMLStructure(lines []string) map[int]yamlLineContext {
-	contexts := make(map[int]yamlLineContext)
+// renderYAMLValues applies updates to YAML content and returns the modified content
+func (p *Parser) renderYAMLValues(content string, updates map[string]any) (string, error) {
+	updates = kubernetesUpdates(content, updates)
+	updates, err := composeUpdates(content, updates)
+	if err != nil {
+		return "", err
+	}
+	lines := strings.Split(content, "\n")
 	
-	// Build a map of indentation levels and their current context
-	currentPaths := make(map[int]string) // indentLevel -> current path
-	arrayIndices := make(map[string]int) // path -> current array index
+	// Find each value in the document's node tree, which knows where it is written
+	root, err := yamlDocument(content)
+	if err != nil {
+		return "", err
+	}
 	
-	for i, line := range lines {
-		trimmed := strings.TrimSpace(line)
-		
-		// Skip empty lines and comments
-		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+	// Values are replaced from the end of each line so that values sharing a
+	// line, as in a flow mapping, keep their columns
+	type edit struct {
+		line, start, end int
+		value            string
+	}
+	var edits []edit
+	updated := make(map[*yaml.Node]bool)
+	// Content lines of block scalars, replaced once every line is updated
+	blocks := make(map[int]blockRewrite)
+	
+	for keyPath, newValue := range updates {
+		target, ok := findYAMLValue(root, keyPath)
+		if !ok || updated[target.node] {
 			continue
 		}
+		node := target.node
+		if node.Kind != yaml.ScalarNode {
+			return "", fmt.Errorf("key %s holds a %s, which cannot be replaced by a value in place", keyPath, yamlKindName(node.Kind))
+		}
+		updated[node] = true
 		
-		// Calculate indentation
-		indent := len(line) - len(strings.TrimLeft(line, " "))
-		
-		// Clear deeper indentation levels when indentation decreases
-		for level := range currentPaths {
-			if level > indent {
-				delete(currentPaths, level)
-			}
+		lineNum := node.Line - 1
+		if lineNum >= len(lines) {
+			// An implicit null, as for an explicit key with no value, is
+			// placed past the end of the document
+			return "", fmt.Errorf("key %s has no value written in the file to replace", keyPath)
+		}
+		line := lines[lineNum]
+		start := yamlScalarStart(line, yamlOffset(line, node.Column))
+		end, closed := yamlScalarEnd(line, start, target.flow)
+		valueStr := formatYAMLValue(newValue)
+		if target.flow {
+			valueStr = formatYAMLFlowValue(newValue)
 		}
 		
-		// Handle array items
-		if strings.HasPrefix(trimmed, "- ") {
-			arrayContent := strings.TrimPrefix(trimmed, "- ")
-			
-			// Find parent path by looking at the previous indentation level
-			parentPath := ""
-			// Look for parent at exact previous indentation level first
-			if path, exists := currentPaths[indent-2]; exists {
-				parentPath = path
-			} else {
-				// Fall back to closest parent at lower level
-				for level := indent - 2; level >= 0; level -= 2 {
-					if path, exists := currentPaths[level]; exists {
-						parentPath = path
-						break
-					}
+		switch {
+		case node.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0:
+			// A block scalar is rewritten along with its content lines
+			block := parseBlockScalar(lines, lineNum, target.indent, line[start:end])
+			var content []string
+			valueStr, content = formatBlockScalar(block, newValue)
+			blocks[lineNum] = blockRewrite{end: block.end, content: content}
+		case !target.flow && (!closed || node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle) == 0 && line[start:end] != node.Value):
+			// A scalar folded over several lines is replaced along with the
+			// lines it continues on
+			last := lineNum
+			for i := lineNum + 1; i < len(lines); i++ {
+				trimmed := strings.TrimSpace(lines[i])
+				if trimmed != "" && len(lines[i])-len(strings.TrimLeft(lines[i], " \t")) <= target.indent {
+					break
+				}
+				if trimmed != "" {
+					last = i
 				}
 			}
-			
-			// Increment array index for this parent path
-			if _, exists := arrayIndices[parentPath]; !exists {
-				arrayIndices[parentPath] = -1
+			end = len(line)
+			blocks[lineNum] = blockRewrite{end: last}
+		case start == end:
+			// An empty value, such as key:, gets a space before it and
+			// before any comment after it
+			for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+				start++
 			}
-			arrayIndices[parentPath]++
-			currentArrayIndex := arrayIndices[parentPath]
-			
-			// Check if this array item has a key-value pair
-			if strings.Contains(arrayContent, ":") {
-				parts := strings.SplitN(arrayContent, ":", 2)
-				if len(parts) == 2 {
-					key := strings.TrimSpace(parts[0])
-					
-					// Build full path including array index
-					var fullPath string
-					if parentPath != "" {
-						fullPath = fmt.Sprintf("%s[%d].%s", parentPath, currentArrayIndex, key)
-					} else {
-						fullPath = fmt.Sprintf("[%d].%s", currentArrayIndex, key)
-					}
-					
-					contexts[i] = yamlLineContext{
-						lineNumber:  i,
-						indentLevel: indent,
-						key:         key,
-						isArrayItem: true,
-						arrayIndex:  currentArrayIndex,
-						parentPath:  parentPath,
-						fullPath:    fullPath,
-					}
-					
-					// Set current path for array item properties at the next indentation level
-					arrayItemPath := fmt.Sprintf("%s[%d]", parentPath, currentArrayIndex)
-					if parentPath == "" {
-						arrayItemPath = fmt.Sprintf("[%d]", currentArrayIndex)
-					}
-					currentPaths[indent+2] = arrayItemPath
-				}
+			end = start
+			if start > 0 && line[start-1] != ' ' && line[start-1] != '\t' {
+				valueStr = " " + valueStr
 			}
-			continue
-		}
-		
-		// Handle regular key-value pairs
-		if strings.Contains(trimmed, ":") {
-			parts := strings.SplitN(trimmed, ":", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				value := strings.TrimSpace(parts[1])
-				
-				// Find parent path from indentation hierarchy
-				parentPath := ""
-				// If this is at the root level (indent 0), don't use any parent path
-				if indent == 0 {
-					parentPath = ""
-				} else {
-					// Check exact current indentation level first (for array item properties)
-					if path, exists := currentPaths[indent]; exists {
-						parentPath = path
-					} else {
-						// Look for closest parent at lower indentation level
-						for level := indent - 2; level >= 0; level -= 2 {
-							if path, exists := currentPaths[level]; exists {
-								parentPath = path
-								break
-							}
-						}
-					}
-				}
-				
-				// Build current path
-				var fullPath string
-				if parentPath != "" {
-					fullPath = parentPath + "." + key
-				} else {
-					fullPath = key
-				}
-				
-				// If this has a value, it's a leaf node
-				if value != "" {
-					contexts[i] = yamlLineContext{
-						lineNumber:  i,
-						indentLevel: indent,
-						key:         key,
-						isArrayItem: false,
-						arrayIndex:  -1,
-						parentPath:  parentPath,
-						fullPath:    fullPath,
-					}
-				} else {
-					// This is a parent node, set current path for this indentation level
-					currentPaths[indent] = fullPath
-					// Initialize array index tracking for this path
-					arrayIndices[fullPath] = -1
-				}
+			if start < len(line) && line[start] == '#' {
+				valueStr += " "
 			}
 		}
+		edits = append(edits, edit{lineNum, start, end, valueStr})
 	}
 	
-	return contexts
-}
-
-// findYAMLLineForKeyPath finds the line number that matches the given key path
-func (p *Parser) findYAMLLineForKeyPath(contexts map[int]yamlLineContext, keyPath string) int {
-	// Handle array indexing in key path
-	normalizedKeyPath := p.normalizeYAMLKeyPath(keyPath)
+	if len(edits) == 0 {
+		return "", fmt.Errorf("no key paths found in file")
+	}
 	
-	for lineNum, context := range contexts {
-		if context.fullPath == normalizedKeyPath {
-			return lineNum
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].line != edits[j].line {
+			return edits[i].line < edits[j].line
 		}
+		return edits[i].start > edits[j].start
+	})
+	for _, edit := range edits {
+		line := lines[edit.line]
+		lines[edit.line] = line[:edit.start] + edit.value + line[edit.end:]
+	}
+	
+	// Replace block contents last to first, so that the line numbers of the
+	// blocks before are unchanged
+	starts := make([]int, 0, len(blocks))
+	for start := range blocks {
+		starts = append(starts, start)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(starts)))
+	for _, start := range starts {
+		block := blocks[start]
+		rest := append(block.content, lines[block.end+1:]...)
+		lines = append(lines[:start+1], rest...)
 	}
 	
-	return -1
+	return strings.Join(lines, "\n"), nil
 }
 
-// normalizeYAMLKeyPath converts key paths to match the structure we build
-func (p *Parser) normalizeYAMLKeyPath(keyPath string) string {
-	// For YAML, we don't need to do any normalization - the input format should match our output format
-	return keyPath
+// blockRewrite replaces the content lines of a block scalar, which run from
+// the line after its key to end
+type blockRewrite struct {
+	end     int
+	content []string
 }
 
+
 // tomlLineContext represents the structural context of a line in TOML
 type tomlLineContext struct {
 	lineNumber   int
@@ -371,89 +435,83 @@ type tomlLineContext struct {
 	isTableArray bool
 	arrayIndex   int
 	fullPath     string
+	valueStart   int // The columns of the value within the line
+	valueEnd     int
 }
 
 // updateTOMLValues updates multiple values in a TOML file while preserving formatting
 func (p *Parser) updateTOMLValues(filepath string, updates map[string]any) error {
-	content, err := os.ReadFile(filepath)
+	content, err := textfile.Read(filepath)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
 
-	lines := strings.Split(string(content), "\n")
+	newContent, err := p.renderTOMLValues(string(content), updates)
+	if err != nil {
+		return err
+	}
+
+	return textfile.Write(filepath, []byte(newContent))
+}
+
+// renderTOMLValues applies updates to TOML content and returns the modified content
+func (p *Parser) renderTOMLValues(content string, updates map[string]any) (string, error) {
+	lines := strings.Split(content, "\n")
 	
 	// Parse the file structure to understand context of each line
 	contexts := p.parseTOMLStructure(lines)
 	
-	// Create a map to track which lines have been updated
-	updatedLines := make(map[int]bool)
-	updatedCount := 0
-	
-	// Process each update by finding the exact structural match
+	// Find every value to update first, then replace them from the end of
+	// each line so that values sharing a line keep their columns
+	type edit struct {
+		context tomlLineContext
+		value   any
+	}
+	var edits []edit
+	updated := make(map[[2]int]bool)
 	for keyPath, newValue := range updates {
-		lineNum := p.findTOMLLineForKeyPath(contexts, keyPath)
-		if lineNum >= 0 && !updatedLines[lineNum] {
-			// Update the line surgically - preserve everything except the value
-			context := contexts[lineNum]
-			originalLine := lines[lineNum]
-			valueStr := formatTOMLValue(newValue)
-			
-			// Find the key in the line and replace only the value part
-			keyPattern := context.key + " ="
-			keyIndex := strings.Index(originalLine, keyPattern)
-			if keyIndex >= 0 {
-				// Find where the value starts (after "key =")
-				valueStart := keyIndex + len(keyPattern)
-				
-				// Skip any whitespace after the equals
-				for valueStart < len(originalLine) && (originalLine[valueStart] == ' ' || originalLine[valueStart] == '\t') {
-					valueStart++
-				}
-				
-				// Find where the value ends (before any comment or end of line)
-				valueEnd := valueStart
-				inQuotes := false
-				for valueEnd < len(originalLine) {
-					char := originalLine[valueEnd]
-					if char == '"' && (valueEnd == valueStart || originalLine[valueEnd-1] != '\\') {
-						inQuotes = !inQuotes
-					} else if !inQuotes && (char == '#' || char == '\n') {
-						break
-					}
-					valueEnd++
-				}
-				
-				// Skip trailing whitespace from the value
-				for valueEnd > valueStart && (originalLine[valueEnd-1] == ' ' || originalLine[valueEnd-1] == '\t') {
-					valueEnd--
-				}
-				
-				// Surgically replace only the value part
-				before := originalLine[:valueStart]
-				after := originalLine[valueEnd:]
-				lines[lineNum] = before + valueStr + after
-			}
-			updatedLines[lineNum] = true
-			updatedCount++
+		context, ok := p.findTOMLValue(contexts, keyPath)
+		span := [2]int{context.lineNumber, context.valueStart}
+		if ok && !updated[span] {
+			updated[span] = true
+			edits = append(edits, edit{context, newValue})
 		}
 	}
+	sort.Slice(edits, func(i, j int) bool {
+		a, b := edits[i].context, edits[j].context
+		if a.lineNumber != b.lineNumber {
+			return a.lineNumber < b.lineNumber
+		}
+		return a.valueStart > b.valueStart
+	})
+	
+	updatedCount := 0
+	for _, edit := range edits {
+		// Surgically replace only the value part
+		context := edit.context
+		line := lines[context.lineNumber]
+		lines[context.lineNumber] = line[:context.valueStart] + formatTOMLValue(edit.value) + line[context.valueEnd:]
+		updatedCount++
+	}
 	
 	if updatedCount == 0 {
-		return fmt.Errorf("no key paths found in file")
+		return "", fmt.Errorf("no key paths found in file")
 	}
 	
-	// Write back the modified content once
-	newContent := strings.Join(lines, "\n")
-	return os.WriteFile(filepath, []byte(newContent), 0644)
+	return strings.Join(lines, "\n"), nil
 }
 
-// parseTOMLStructure analyzes TOML file structure and returns context for each line
-func (p *Parser) parseTOMLStructure(lines []string) map[int]tomlLineContext {
-	contexts := make(map[int]tomlLineContext)
+// parseTOMLStructure analyzes TOML file structure and returns context for each
+// value, including the keys of inline tables
+func (p *Parser) parseTOMLStructure(lines []string) []tomlLineContext {
+	var contexts []tomlLineContext
 	currentSection := ""
 	currentTableArray := ""
 	arrayIndex := -1
 	lastSectionLine := -1 // Track the last line where we saw a section header
+	// Elements of each table array so far, by its key path, which holds the
+	// indexes of the table arrays it is nested in
+	tableArrays := make(map[string]int)
 	
 	for i, line := range lines {
 		trimmed := strings.TrimSpace(line)
@@ -465,21 +523,17 @@ func (p *Parser) parseTOMLStructure(lines []string) map[int]tomlLineContext {
 		
 		// Handle table array [[name]]
 		if strings.HasPrefix(trimmed, "[[") && strings.HasSuffix(trimmed, "]]") {
-			tableName := strings.Trim(trimmed, "[]")
-			if tableName == currentTableArray {
-				arrayIndex++
-			} else {
-				currentTableArray = tableName
-				arrayIndex = 0
-			}
-			currentSection = fmt.Sprintf("%s[%d]", tableName, arrayIndex)
+			currentTableArray = tomlTablePath(strings.Trim(trimmed, "[]"), tableArrays)
+			arrayIndex = tableArrays[currentTableArray]
+			tableArrays[currentTableArray]++
+			currentSection = fmt.Sprintf("%s[%d]", currentTableArray, arrayIndex)
 			lastSectionLine = i
 			continue
 		}
 		
 		// Handle regular table [name]
 		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
-			currentSection = strings.Trim(trimmed, "[]")
+			currentSection = tomlTablePath(strings.Trim(trimmed, "[]"), tableArrays)
 			currentTableArray = "" // Reset table array tracking
 			arrayIndex = -1
 			lastSectionLine = i
@@ -487,107 +541,115 @@ func (p *Parser) parseTOMLStructure(lines []string) map[int]tomlLineContext {
 		}
 		
 		// Handle key-value pairs
-		if strings.Contains(trimmed, "=") && !strings.HasPrefix(trimmed, "#") {
-			parts := strings.SplitN(trimmed, "=", 2)
-			if len(parts) == 2 {
-				key := strings.TrimSpace(parts[0])
-				
-				// Determine if this key is in the current section context
-				// If this key is at column 0 and comes after a gap from the last section,
-				// it might be a top-level key
-				isTopLevel := false
-				if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
-					// This key starts at column 0, check if there's been a gap since last section
-					if lastSectionLine >= 0 {
-						// Look for empty lines between last section and this key
-						hasGap := false
-						for j := lastSectionLine + 1; j < i; j++ {
-							if strings.TrimSpace(lines[j]) == "" {
-								hasGap = true
-								break
-							}
-						}
-						if hasGap {
-							isTopLevel = true
+		if key, eq := scanTOMLKey(line, 0); eq >= 0 && key != "" {
+			// Dotted keys set keys of nested tables
+			keySegments := tomlKeyPath(key)
+			
+			// Determine if this key is in the current section context
+			// If this key is at column 0 and comes after a gap from the last section,
+			// it might be a top-level key
+			isTopLevel := false
+			if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+				// This key starts at column 0, check if there's been a gap since last section
+				if lastSectionLine >= 0 {
+					// Look for empty lines between last section and this key
+					hasGap := false
+					for j := lastSectionLine + 1; j < i; j++ {
+						if strings.TrimSpace(lines[j]) == "" {
+							hasGap = true
+							break
 						}
-					} else {
-						// No sections seen yet, this is definitely top-level
-						isTopLevel = true
 					}
-				}
-				
-				// Build full path
-				var fullPath string
-				var effectiveSection string
-				if isTopLevel {
-					// This is a top-level key
-					fullPath = key
-					effectiveSection = ""
-				} else if currentSection != "" {
-					if currentTableArray != "" && arrayIndex >= 0 {
-						// We're in a table array
-						fullPath = fmt.Sprintf("%s.%s", currentSection, key)
-						effectiveSection = currentSection
-					} else {
-						// We're in a regular section
-						fullPath = fmt.Sprintf("%s.%s", currentSection, key)
-						effectiveSection = currentSection
+					if hasGap {
+						isTopLevel = true
 					}
 				} else {
-					// Top-level key
-					fullPath = key
-					effectiveSection = ""
+					// No sections seen yet, this is definitely top-level
+					isTopLevel = true
 				}
-				
-				contexts[i] = tomlLineContext{
-					lineNumber:   i,
-					key:          key,
-					section:      effectiveSection,
-					isTableArray: currentTableArray != "" && arrayIndex >= 0 && !isTopLevel,
-					arrayIndex:   arrayIndex,
-					fullPath:     fullPath,
+			}
+			
+			// Build full path
+			var fullPath string
+			var effectiveSection string
+			if isTopLevel {
+				// This is a top-level key
+				fullPath = keySegments
+				effectiveSection = ""
+			} else if currentSection != "" {
+				if currentTableArray != "" && arrayIndex >= 0 {
+					// We're in a table array
+					fullPath = fmt.Sprintf("%s.%s", currentSection, keySegments)
+					effectiveSection = currentSection
+				} else {
+					// We're in a regular section
+					fullPath = fmt.Sprintf("%s.%s", currentSection, keySegments)
+					effectiveSection = currentSection
 				}
+			} else {
+				// Top-level key
+				fullPath = keySegments
+				effectiveSection = ""
+			}
+			
+			valueStart := eq + 1
+			for valueStart < len(line) && (line[valueStart] == ' ' || line[valueStart] == '\t') {
+				valueStart++
 			}
+			context := tomlLineContext{
+				lineNumber:   i,
+				key:          key,
+				section:      effectiveSection,
+				isTableArray: currentTableArray != "" && arrayIndex >= 0 && !isTopLevel,
+				arrayIndex:   arrayIndex,
+				fullPath:     fullPath,
+				valueStart:   valueStart,
+				valueEnd:     tomlValueEnd(line, valueStart),
+			}
+			contexts = append(contexts, context)
+			contexts = append(contexts, tomlInlineValues(line, context)...)
 		}
 	}
 	
 	return contexts
 }
 
-// findTOMLLineForKeyPath finds the line number that matches the given key path
-func (p *Parser) findTOMLLineForKeyPath(contexts map[int]tomlLineContext, keyPath string) int {
+// tomlTablePath returns the key path of the table named in a table header.
+// Where the name goes through a table array, as [[servers.ports]] goes
+// through [[servers]], it refers to the array's last element so far.
+func tomlTablePath(name string, tableArrays map[string]int) string {
+	segments := splitKeyPath(tomlKeyPath(name))
+	path := ""
+	for i, segment := range segments {
+		if i > 0 {
+			path += "."
+		}
+		path += segment
+		if count := tableArrays[path]; count > 0 && i < len(segments)-1 {
+			path = fmt.Sprintf("%s[%d]", path, count-1)
+		}
+	}
+	return path
+}
+
+// findTOMLValue finds the value that matches the given key path
+func (p *Parser) findTOMLValue(contexts []tomlLineContext, keyPath string) (tomlLineContext, bool) {
 	// Handle array indexing in key path
 	normalizedKeyPath := p.normalizeTOMLKeyPath(keyPath)
 	
-	for lineNum, context := range contexts {
+	for _, context := range contexts {
 		if context.fullPath == normalizedKeyPath {
-			return lineNum
+			return context, true
 		}
 	}
 	
-	return -1
+	return tomlLineContext{}, false
 }
 
 // normalizeTOMLKeyPath converts key paths to match the structure we build
 func (p *Parser) normalizeTOMLKeyPath(keyPath string) string {
-	// Handle cases like "database[0].host"
-	parts := strings.Split(keyPath, ".")
-	result := []string{}
-	
-	for _, part := range parts {
-		if strings.Contains(part, "[") {
-			// Parse array access like "database[0]"
-			if key, index, err := parseKeySegment(part); err == nil && index >= 0 {
-				result = append(result, fmt.Sprintf("%s[%d]", key, index))
-			} else {
-				result = append(result, part)
-			}
-		} else {
-			result = append(result, part)
-		}
-	}
-	
-	return strings.Join(result, ".")
+	// Keys holding dots may be quoted or escaped, which the structure quotes
+	return canonicalKeyPath(keyPath)
 }
 
 // updateJSONValues updates multiple values in a JSON file while preserving formatting
@@ -595,131 +657,299 @@ func (p *Parser) updateJSONValues(filepath string, updates map[string]any) error
 	// WARNING: This method will reformat the entire JSON file and lose original formatting!
 	// JSON is more complex due to nested structure and strict syntax
 	// TODO: Implement surgical JSON updates to preserve formatting
-	data, err := p.LoadFile(filepath)
+	content, err := textfile.Read(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	newContent, err := p.renderJSONValues(content, updates)
 	if err != nil {
 		return err
 	}
+
+	return textfile.Write(filepath, []byte(newContent))
+}
+
+// renderJSONValues applies updates to JSON content and returns the re-encoded document
+func (p *Parser) renderJSONValues(content []byte, updates map[string]any) (string, error) {
+	// Numbers left alone are written back exactly as they were
+	var data map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return "", fmt.Errorf("failed to parse json file: %w", err)
+	}
 	
 	// Apply all updates to the data structure
 	for keyPath, newValue := range updates {
-		err = p.SetValue(data, keyPath, newValue)
-		if err != nil {
-			return err
+		if err := p.SetValue(data, keyPath, jsonNumbers(newValue)); err != nil {
+			return "", err
 		}
 	}
 	
-	return p.SaveFile(filepath, data)
+	output, err := json.MarshalIndent(data, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal json data: %w", err)
+	}
+
+	return string(output), nil
 }
 
 // Helper functions for formatting values
 func formatYAMLValue(value any) string {
 	switch v := value.(type) {
 	case string:
-		// Escape quotes and special characters for YAML
-		escaped := strings.ReplaceAll(v, "\"", "\\\"")
-		// Quote strings if they contain special characters
-		if strings.ContainsAny(v, " :{}[]\"") || v == "" {
-			return fmt.Sprintf("\"%s\"", escaped)
+		// Quote strings if they contain special characters, or would not be
+		// read back as the same string
+		if strings.ContainsAny(v, " :{}[]\"") || v == "" || !yamlPlain(v) {
+			return strconv.Quote(v)
 		}
 		return v
+	case kubernetesString:
+		return formatKubernetesString(v)
 	case bool:
 		return fmt.Sprintf("%t", v)
-	case int, int64, float64:
-		return fmt.Sprintf("%v", v)
+	case nil:
+		return "null"
 	default:
-		return fmt.Sprintf("%v", v)
+		return formatScalar(v)
 	}
 }
 
+// yamlPlain reports whether s reads back as the string s when written as a
+// plain YAML scalar, rather than as a number, boolean or null, or not at all
+func yamlPlain(s string) bool {
+	var value any
+	if err := yaml.Unmarshal([]byte(s), &value); err != nil {
+		return false
+	}
+	return value == s
+}
+
 func formatTOMLValue(value any) string {
 	switch v := value.(type) {
 	case string:
-		// Escape quotes for TOML
-		escaped := strings.ReplaceAll(v, "\"", "\\\"")
-		return fmt.Sprintf("\"%s\"", escaped)
+		return tomlString(v)
 	case bool:
 		return fmt.Sprintf("%t", v)
-	case int, int64, float64:
-		return fmt.Sprintf("%v", v)
+	case nil:
+		// TOML has no null
+		return `""`
+	case time.Time:
+		return formatTOMLTime(v)
+	case []any:
+		elements := make([]string, len(v))
+		for i, element := range v {
+			elements[i] = formatTOMLValue(element)
+		}
+		return "[" + strings.Join(elements, ", ") + "]"
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		entries := make([]string, len(keys))
+		for i, key := range keys {
+			entries[i] = tomlKey(key) + " = " + formatTOMLValue(v[key])
+		}
+		if len(entries) == 0 {
+			return "{}"
+		}
+		return "{ " + strings.Join(entries, ", ") + " }"
 	default:
-		escaped := strings.ReplaceAll(fmt.Sprintf("%v", v), "\"", "\\\"")
-		return fmt.Sprintf("\"%s\"", escaped)
+		if f, ok := NormalizeValue(v).(float64); ok && (math.IsInf(f, 0) || math.IsNaN(f)) {
+			// TOML spells these in lower case, with a sign on infinities
+			return strings.ToLower(strings.TrimPrefix(strconv.FormatFloat(f, 'g', -1, 64), "+"))
+		}
+		if formatted, ok := formatNumber(v); ok {
+			return formatted
+		}
+		return tomlString(fmt.Sprintf("%v", v))
 	}
 }
 
-func (p *Parser) GetValue(data map[string]any, keyPath string) (any, error) {
-	keys := strings.Split(keyPath, ".")
-	var current any = data
+// tomlString writes s as a TOML basic string, escaping what TOML requires
+func tomlString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case '\b':
+			b.WriteString(`\b`)
+		case '\f':
+			b.WriteString(`\f`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04X`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// formatTOMLTime writes t as a TOML datetime. The TOML decoder reads local
+// dates, times and datetimes into time.Time with a location named after
+// them, which is how they are told apart from offset datetimes.
+func formatTOMLTime(t time.Time) string {
+	switch t.Location().String() {
+	case "datetime-local":
+		return t.Format("2006-01-02T15:04:05.999999999")
+	case "date-local":
+		return t.Format("2006-01-02")
+	case "time-local":
+		return t.Format("15:04:05.999999999")
+	}
+	return t.Format(time.RFC3339Nano)
+}
 
-	for i, keySegment := range keys {
-		key, arrayIndex, err := parseKeySegment(keySegment)
+// ErrKeyNotFound is returned by GetValue for key paths that data does not have
+var ErrKeyNotFound = errors.New("key not found")
+
+// GetValue returns the value at keyPath. Wildcard paths such as
+// servers[*].host or database.* are expanded here, against the leaf keys
+// GetAllKeys lists, and return a map of every matching key path to its value.
+func (p *Parser) GetValue(data map[string]any, keyPath string) (any, error) {
+	path, _ := ParseKeyPath(keyPath)
+	if path.plain {
+		return p.getPath(data, path)
+	}
+	if IsJSONPath(keyPath) {
+		resolved, err := p.resolveJSONPath(data, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		return p.GetValue(data, resolved)
+	}
+	if HasWildcard(keyPath) {
+		matches := p.ExpandKeyPath(data, keyPath)
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no keys match %s", keyPath)
+		}
+		values := make(map[string]any, len(matches))
+		for _, match := range matches {
+			values[match], _ = p.GetValue(data, match)
+		}
+		return values, nil
+	}
+	if HasArrayOp(keyPath) {
+		if _, ok := AppendPath(keyPath); ok {
+			return nil, fmt.Errorf("%w: %s selects no element", ErrKeyNotFound, keyPath)
+		}
+		resolved, err := p.resolveArrayPath(data, keyPath)
 		if err != nil {
-			return nil, fmt.Errorf("invalid key segment %s: %w", keySegment, err)
+			return nil, err
+		}
+		return p.GetValue(data, resolved)
+	}
+
+	return p.getPath(data, path)
+}
+
+// getPath returns the value at a plain key path
+func (p *Parser) getPath(data map[string]any, path KeyPath) (any, error) {
+	var current any = data
+	for i, segment := range path.segments {
+		if segment.err != nil {
+			// The first invalid segment is the first reached
+			return nil, path.err
 		}
 
 		// Handle the current level based on its type
 		switch v := current.(type) {
 		case map[string]any:
-			next, exists := v[key]
+			next, exists := v[segment.Key]
 			if !exists {
-				return nil, fmt.Errorf("key not found: %s", strings.Join(keys[:i+1], "."))
+				return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, path.upTo(i))
 			}
 			current = next
 		case map[any]any:
-			converted := convertMapInterface(v)
-			next, exists := converted[key]
+			next, exists := lookupKey(v, segment.Key)
 			if !exists {
-				return nil, fmt.Errorf("key not found: %s", strings.Join(keys[:i+1], "."))
+				return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, path.upTo(i))
+			}
+			// An object read from such a map is returned converted
+			if m, ok := next.(map[any]any); ok && i == len(path.segments)-1 {
+				next = convertMapInterface(m)
 			}
 			current = next
 		default:
-			return nil, fmt.Errorf("key path %s does not point to an object", strings.Join(keys[:i+1], "."))
+			return nil, fmt.Errorf("key path %s does not point to an object", path.upTo(i))
 		}
 
 		// Handle array indexing if present
-		if arrayIndex >= 0 {
+		if segment.Index >= 0 {
 			switch arr := current.(type) {
 			case []any:
-				if arrayIndex >= len(arr) {
-					return nil, fmt.Errorf("array index %d out of bounds for %s (length: %d)", arrayIndex, strings.Join(keys[:i+1], "."), len(arr))
-				}
-				current = arr[arrayIndex]
-			case []map[string]interface{}:
-				if arrayIndex >= len(arr) {
-					return nil, fmt.Errorf("array index %d out of bounds for %s (length: %d)", arrayIndex, strings.Join(keys[:i+1], "."), len(arr))
+				if segment.Index >= len(arr) {
+					return nil, fmt.Errorf("array index %d out of bounds for %s (length: %d)", segment.Index, path.upTo(i), len(arr))
 				}
-				// Convert to map[string]any for consistency
-				converted := make(map[string]any)
-				for k, v := range arr[arrayIndex] {
-					converted[k] = v
+				current = arr[segment.Index]
+			case []map[string]any:
+				if segment.Index >= len(arr) {
+					return nil, fmt.Errorf("array index %d out of bounds for %s (length: %d)", segment.Index, path.upTo(i), len(arr))
 				}
-				current = converted
+				current = arr[segment.Index]
 			default:
-				return nil, fmt.Errorf("key %s is not an array, cannot use index [%d] (type: %T)", strings.Join(keys[:i+1], "."), arrayIndex, current)
+				return nil, fmt.Errorf("key %s is not an array, cannot use index [%d] (type: %T)", path.upTo(i), segment.Index, current)
 			}
 		}
-
-		// If this is the last key, return the current value
-		if i == len(keys)-1 {
-			return current, nil
-		}
 	}
 
-	return nil, fmt.Errorf("unexpected end of key path")
+	return current, nil
 }
 
+// SetValue sets the value at keyPath, creating intermediate objects as
+// needed. Wildcard paths are expanded as GetValue expands them, setting the
+// value at every existing matching key, and fail if none matches.
 func (p *Parser) SetValue(data map[string]any, keyPath string, value any) error {
-	keys := strings.Split(keyPath, ".")
+	path, _ := ParseKeyPath(keyPath)
+	if !path.plain && HasWildcard(keyPath) {
+		matches := p.ExpandKeyPath(data, keyPath)
+		if len(matches) == 0 {
+			return fmt.Errorf("no keys match %s", keyPath)
+		}
+		for _, match := range matches {
+			if err := p.SetValue(data, match, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !path.plain && HasArrayOp(keyPath) {
+		resolved, err := p.resolveArrayPath(data, keyPath)
+		if err != nil {
+			return err
+		}
+		if arrayPath, ok := AppendPath(resolved); ok {
+			return p.appendValue(data, arrayPath, value)
+		}
+		return p.SetValue(data, resolved, value)
+	}
+
 	var current any = data
 
-	for i, keySegment := range keys {
-		key, arrayIndex, err := parseKeySegment(keySegment)
-		if err != nil {
-			return fmt.Errorf("invalid key segment %s: %w", keySegment, err)
+	for i, segment := range path.segments {
+		if segment.err != nil {
+			return path.err
 		}
+		key, arrayIndex := segment.Key, segment.Index
 
 		// If this is the last key segment, set the value
-		if i == len(keys)-1 {
+		if i == len(path.segments)-1 {
 			switch v := current.(type) {
 			case map[string]any:
 				if arrayIndex >= 0 {
@@ -791,14 +1021,13 @@ func (p *Parser) SetValue(data map[string]any, keyPath string, value any) error
 
 
 		case map[any]any:
-			converted := convertMapInterface(v)
-			next, exists := converted[key]
+			next, exists := lookupKey(v, key)
 			if !exists {
 				if arrayIndex >= 0 {
 					return fmt.Errorf("array key not found: %s", key)
 				}
-				converted[key] = make(map[string]any)
-				next = converted[key]
+				next = make(map[string]any)
+				v[key] = next
 			}
 			current = next
 
@@ -822,72 +1051,122 @@ func (p *Parser) SetValue(data map[string]any, keyPath string, value any) error
 			}
 
 		default:
-			return fmt.Errorf("key path %s conflicts with existing non-object value", strings.Join(keys[:i+1], "."))
+			return fmt.Errorf("key path %s conflicts with existing non-object value", path.upTo(i))
 		}
 	}
 
 	return nil
 }
 
+// GetAllKeys returns the key path of every leaf value in data, below prefix
+// if it is not empty. Objects are walked into, and so are objects within
+// arrays; any other array element is a leaf.
 func (p *Parser) GetAllKeys(data map[string]any, prefix string) []string {
 	var keys []string
-	
+	path := make([]byte, 0, 64)
+	path = append(path, prefix...)
 	for key, value := range data {
-		fullKey := key
-		if prefix != "" {
-			fullKey = prefix + "." + key
+		keys = appendKeys(keys, appendKeySegment(path, key), value)
+	}
+	return keys
+}
+
+// appendKeys appends the key paths of the leaves at and below value, whose
+// key path is path, to keys. path is used as a buffer for building them, so
+// a whole tree is walked without building its key paths as strings until
+// they are appended.
+func appendKeys(keys []string, path []byte, value any) []string {
+	switch v := value.(type) {
+	case map[string]any:
+		// This is a branch node - recurse but don't add the branch itself
+		for key, item := range v {
+			keys = appendKeys(keys, appendKeySegment(path, key), item)
 		}
-		
-		switch v := value.(type) {
-		case map[string]any:
-			// This is a branch node - recurse but don't add the branch itself
-			subKeys := p.GetAllKeys(v, fullKey)
-			keys = append(keys, subKeys...)
-		case map[any]any:
-			// This is a branch node - recurse but don't add the branch itself
-			converted := convertMapInterface(v)
-			subKeys := p.GetAllKeys(converted, fullKey)
-			keys = append(keys, subKeys...)
-		case []any:
-			// Handle arrays by including indexed keys
-			for i, item := range v {
-				indexedKey := fmt.Sprintf("%s[%d]", fullKey, i)
-				switch itemVal := item.(type) {
-				case map[string]any:
-					// Recurse into object within array
-					subKeys := p.GetAllKeys(itemVal, indexedKey)
-					keys = append(keys, subKeys...)
-				case map[any]any:
-					// Recurse into object within array
-					converted := convertMapInterface(itemVal)
-					subKeys := p.GetAllKeys(converted, indexedKey)
-					keys = append(keys, subKeys...)
-				default:
-					// Primitive value in array
-					keys = append(keys, indexedKey)
-				}
-			}
-		case []map[string]interface{}:
-			// Handle TOML table arrays
-			for i, item := range v {
-				indexedKey := fmt.Sprintf("%s[%d]", fullKey, i)
-				// Convert to map[string]any for consistency
-				converted := make(map[string]any)
-				for k, val := range item {
-					converted[k] = val
-				}
-				subKeys := p.GetAllKeys(converted, indexedKey)
-				keys = append(keys, subKeys...)
+	case map[any]any:
+		for key, item := range v {
+			keys = appendKeys(keys, appendKeySegment(path, fmt.Sprintf("%v", key)), item)
+		}
+	case []any:
+		// Handle arrays by including indexed keys
+		for i, item := range v {
+			indexed := appendIndex(path, i)
+			switch item.(type) {
+			case map[string]any, map[any]any:
+				keys = appendKeys(keys, indexed, item)
+			default:
+				// Primitive value in array
+				keys = append(keys, string(indexed))
 			}
-		default:
-			// This is a leaf node (primitive value) - add it
-			keys = append(keys, fullKey)
 		}
+	case []map[string]any:
+		// Handle TOML table arrays
+		for i, item := range v {
+			keys = appendKeys(keys, appendIndex(path, i), item)
+		}
+	default:
+		// This is a leaf node (primitive value) - add it
+		keys = append(keys, string(path))
 	}
-	
 	return keys
 }
 
+// appendKeySegment appends the segment for key to the key path in path.
+// Attribute keys are written as element@attr.
+func appendKeySegment(path []byte, key string) []byte {
+	switch {
+	case len(path) == 0:
+		return append(path, quoteKey(key)...)
+	case strings.HasPrefix(key, "@"):
+		return append(path, key...)
+	}
+	path = append(path, '.')
+	return append(path, quoteKey(key)...)
+}
+
+// appendIndex appends an array index to the key path in path
+func appendIndex(path []byte, index int) []byte {
+	path = append(path, '[')
+	path = strconv.AppendInt(path, int64(index), 10)
+	return append(path, ']')
+}
+
+// TypeName names the type of a value parsed from a file, such as string,
+// int or array
+func TypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "int"
+	case float32, float64:
+		return "float"
+	case []any:
+		return "array"
+	case map[string]any, map[any]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// lookupKey returns the value of key in a map decoded with keys of any type,
+// matching its keys by their text as convertMapInterface does, without
+// converting the map
+func lookupKey(m map[any]any, key string) (any, bool) {
+	if value, ok := m[key]; ok {
+		return value, true
+	}
+	for k, value := range m {
+		if fmt.Sprintf("%v", k) == key {
+			return value, true
+		}
+	}
+	return nil, false
+}
+
 func convertMapInterface(m map[any]any) map[string]any {
 	result := make(map[string]any)
 	for k, v := range m {
@@ -902,32 +1181,28 @@ func convertMapInterface(m map[any]any) map[string]any {
 	return result
 }
 
-// parseKeySegment parses a key segment that might contain array indexing
-// Returns the key name and index (-1 if no index)
-func parseKeySegment(segment string) (string, int, error) {
-	// Check if this segment has array indexing like "key[0]"
-	arrayRegex := regexp.MustCompile(`^([^[]+)\[(\d+)\]$`)
-	matches := arrayRegex.FindStringSubmatch(segment)
-	
-	if len(matches) == 3 {
-		key := matches[1]
-		index, err := strconv.Atoi(matches[2])
-		if err != nil {
-			return "", -1, fmt.Errorf("invalid array index: %s", matches[2])
-		}
-		if index < 0 {
-			return "", -1, fmt.Errorf("array index must be non-negative: %d", index)
+// splitKeyPath splits a key path into segments. Attribute segments such as
+// server@timeout are split into the element and an "@timeout" key.
+func splitKeyPath(keyPath string) []string {
+	var keys []string
+	for _, segment := range splitSegments(keyPath) {
+		if element, attribute, ok := splitAttribute(segment); ok {
+			keys = append(keys, element, attribute)
+			continue
 		}
-		return key, index, nil
+		keys = append(keys, segment)
 	}
-	
-	// Check for invalid bracket patterns
-	if strings.Contains(segment, "[") {
-		return "", -1, fmt.Errorf("invalid array syntax: %s", segment)
+	return keys
+}
+
+// parseKeySegment parses a key segment that might contain array indexing
+// Returns the key name, without quotes or escapes, and index (-1 if no index)
+func parseKeySegment(segment string) (string, int, error) {
+	key, index, err := scanKeySegment(segment)
+	if err != nil {
+		return "", -1, err
 	}
-	
-	// No array indexing, just return the key
-	return segment, -1, nil
+	return key, index, nil
 }
 
 func (p *Parser) ValidateKeyPath(data map[string]any, keyPath string) error {
@@ -954,27 +1229,19 @@ func (p *Parser) parseEnvFile(content string) (map[string]any, error) {
 			continue // Skip lines without =
 		}
 		
-		key := strings.TrimSpace(line[:eqIndex])
+		key := envKey(line[:eqIndex])
 		value := strings.TrimSpace(line[eqIndex+1:])
 		
-		// Remove quotes if present
+		// Remove quotes if present, and the escapes of double quoted values
 		if len(value) >= 2 {
-			if (strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"")) ||
-				(strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'")) {
+			if strings.HasPrefix(value, "\"") && strings.HasSuffix(value, "\"") {
+				value = envUnescaper.Replace(value[1 : len(value)-1])
+			} else if strings.HasPrefix(value, "'") && strings.HasSuffix(value, "'") {
 				value = value[1 : len(value)-1]
 			}
 		}
 		
-		// Try to parse as different types
-		if value == "true" || value == "false" {
-			result[key] = value == "true"
-		} else if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
-			result[key] = intVal
-		} else if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
-			result[key] = floatVal
-		} else {
-			result[key] = value
-		}
+		result[key] = ParseEnvValue(value)
 	}
 	
 	if err := scanner.Err(); err != nil {
@@ -984,102 +1251,127 @@ func (p *Parser) parseEnvFile(content string) (map[string]any, error) {
 	return result, nil
 }
 
+// ParseEnvValue converts an unquoted environment variable value to a bool,
+// integer or float where it looks like one, leaving other values as strings
+func ParseEnvValue(value string) any {
+	if value == "true" || value == "false" {
+		return value == "true"
+	} else if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return intVal
+	} else if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+		return floatVal
+	}
+	return value
+}
+
+// envKey returns the variable name on the left of an assignment, dropping the
+// export keyword used in shell export scripts
+func envKey(assignment string) string {
+	key := strings.TrimSpace(assignment)
+	if rest, found := strings.CutPrefix(key, "export "); found {
+		key = strings.TrimSpace(rest)
+	}
+	return key
+}
+
 // formatEnvFile formats a map[string]any as .env file content
 func (p *Parser) formatEnvFile(data map[string]any) string {
 	var lines []string
 	
 	for key, value := range data {
-		var valueStr string
-		switch v := value.(type) {
-		case string:
-			// Quote strings if they contain spaces or special characters
-			if strings.ContainsAny(v, " \t#\"'\\") || v == "" {
-				valueStr = fmt.Sprintf("\"%s\"", strings.ReplaceAll(v, "\"", "\\\""))
-			} else {
-				valueStr = v
-			}
-		default:
-			valueStr = fmt.Sprintf("%v", v)
-		}
-		
-		lines = append(lines, fmt.Sprintf("%s=%s", key, valueStr))
+		lines = append(lines, fmt.Sprintf("%s=%s", key, FormatEnvValue(value)))
 	}
 	
 	return strings.Join(lines, "\n") + "\n"
 }
 
+// exportEnvLines prefixes each assignment with export for shell export scripts
+func exportEnvLines(content string) string {
+	if strings.TrimSpace(content) == "" {
+		return content
+	}
+	lines := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = "export " + line
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
 // updateEnvValues updates multiple values in a .env file while preserving formatting and comments
 func (p *Parser) updateEnvValues(filepath string, updates map[string]any) error {
-	content, err := os.ReadFile(filepath)
+	content, err := textfile.Read(filepath)
 	if err != nil {
 		return fmt.Errorf("failed to read file: %w", err)
 	}
-	
-	lines := strings.Split(string(content), "\n")
-	updatedLines := make(map[int]bool)
+
+	newContent, err := p.renderEnvValues(string(content), updates)
+	if err != nil {
+		return err
+	}
+
+	return textfile.Write(filepath, []byte(newContent))
+}
+
+// renderEnvValues applies updates to .env content and returns the modified content
+func (p *Parser) renderEnvValues(content string, updates map[string]any) (string, error) {
+	lines := strings.Split(content, "\n")
 	updatedCount := 0
 	
-	// Process each update by finding the matching key
-	for keyPath, newValue := range updates {
-		for i, line := range lines {
-			if updatedLines[i] {
-				continue // Skip already updated lines
-			}
-			
-			trimmed := strings.TrimSpace(line)
-			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
-				continue // Skip empty lines and comments
-			}
-			
-			eqIndex := strings.Index(trimmed, "=")
-			if eqIndex == -1 {
-				continue // Skip lines without =
-			}
-			
-			key := strings.TrimSpace(trimmed[:eqIndex])
-			if key == keyPath {
-				// Found the line to update
-				valueStr := formatEnvValue(newValue)
-				
-				// Find the = in the original line to preserve formatting
-				originalEqIndex := strings.Index(line, "=")
-				if originalEqIndex >= 0 {
-					before := line[:originalEqIndex+1]
-					// Check if there was a space after =
-					if originalEqIndex+1 < len(line) && line[originalEqIndex+1] == ' ' {
-						before += " "
-					}
-					lines[i] = before + valueStr
-				} else {
-					lines[i] = fmt.Sprintf("%s=%s", key, valueStr)
-				}
-				
-				updatedLines[i] = true
-				updatedCount++
-				break
-			}
+	// Update every line assigning a key, as the last one is what is read
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue // Skip empty lines and comments
 		}
+		
+		eqIndex := strings.Index(trimmed, "=")
+		if eqIndex == -1 {
+			continue // Skip lines without =
+		}
+		
+		key := envKey(trimmed[:eqIndex])
+		newValue, ok := updates[key]
+		if !ok {
+			continue
+		}
+		valueStr := FormatEnvValue(newValue)
+		
+		// Find the = in the original line to preserve formatting
+		originalEqIndex := strings.Index(line, "=")
+		before := line[:originalEqIndex+1]
+		// Check if there was a space after =
+		if originalEqIndex+1 < len(line) && line[originalEqIndex+1] == ' ' {
+			before += " "
+		}
+		lines[i] = before + valueStr
+		updatedCount++
 	}
 	
 	if updatedCount == 0 {
-		return fmt.Errorf("no key paths found in file")
+		return "", fmt.Errorf("no key paths found in file")
 	}
 	
-	// Write back the modified content
-	newContent := strings.Join(lines, "\n")
-	return os.WriteFile(filepath, []byte(newContent), 0644)
+	return strings.Join(lines, "\n"), nil
 }
 
-// formatEnvValue formats a value for use in .env files
-func formatEnvValue(value any) string {
+// envEscaper escapes the backslashes, double quotes and line breaks of a
+// value written in double quotes, which envUnescaper undoes
+var (
+	envEscaper   = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", `\r`)
+	envUnescaper = strings.NewReplacer(`\\`, `\`, `\"`, `"`, `\n`, "\n", `\r`, "\r")
+)
+
+// FormatEnvValue formats a value for use in .env files, quoting strings
+// that need it
+func FormatEnvValue(value any) string {
 	switch v := value.(type) {
 	case string:
 		// Quote strings if they contain spaces or special characters
-		if strings.ContainsAny(v, " \t#\"'\\") || v == "" {
-			return fmt.Sprintf("\"%s\"", strings.ReplaceAll(v, "\"", "\\\""))
+		if strings.ContainsAny(v, " \t\r\n#\"'\\") || v == "" {
+			return `"` + envEscaper.Replace(v) + `"`
 		}
 		return v
 	default:
-		return fmt.Sprintf("%v", v)
+		return formatScalar(v)
 	}
 }
\ No newline at end of file
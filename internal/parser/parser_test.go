@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"runtime"
 	"reflect"
 	"strings"
 	"testing"
@@ -46,7 +47,7 @@ func TestLoadFileJSON(t *testing.T) {
 	expected := map[string]any{
 		"database": map[string]any{
 			"host": "localhost",
-			"port": float64(5432),
+			"port": int64(5432),
 		},
 		"api": map[string]any{
 			"key": "secret123",
@@ -81,7 +82,7 @@ api:
 	expected := map[string]any{
 		"database": map[string]any{
 			"host": "localhost",
-			"port": 5432,
+			"port": int64(5432),
 		},
 		"api": map[string]any{
 			"key": "secret123",
@@ -179,11 +180,11 @@ func TestSaveFileJSON(t *testing.T) {
 		t.Fatalf("Failed to load saved file: %v", err)
 	}
 	
-	// JSON numbers are loaded as float64, so we need to handle this
+	// Whole numbers are loaded as int64
 	expectedData := map[string]any{
 		"database": map[string]any{
 			"host": "localhost",
-			"port": float64(5432), // JSON loads numbers as float64
+			"port": int64(5432),
 		},
 	}
 	
@@ -2397,4 +2398,68 @@ name = "myapp"`
 			t.Error("Updated host value not found in saved TOML")
 		}
 	})
-}
\ No newline at end of file
+}
+
+func TestTypeName(t *testing.T) {
+	tests := map[string]any{
+		"string": "localhost",
+		"int":    5432,
+		"bool":   true,
+		"float":  0.5,
+		"array":  []any{"a"},
+		"object": map[string]any{},
+		"null":   nil,
+	}
+	for expected, value := range tests {
+		if got := TypeName(value); got != expected {
+			t.Errorf("TypeName(%#v) = %s, want %s", value, got, expected)
+		}
+	}
+	// Whole numbers written as floats stay floats
+	if got := TypeName(float64(8080)); got != "float" {
+		t.Errorf("TypeName(8080.0) = %s, want float", got)
+	}
+}
+
+func TestUpdateFileValuesKeepsFileStyle(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		content  string
+		updates  map[string]any
+		create   []string
+		expected string
+	}{
+		{"crlf", "config.yaml", "server:\r\n  port: 80 # http\r\n  host: a\r\n", map[string]any{"server.port": 8080}, nil, "server:\r\n  port: 8080 # http\r\n  host: a\r\n"},
+		{"bom", ".env", "\xEF\xBB\xBFPORT=80\nHOST=a\n", map[string]any{"PORT": 8080}, nil, "\xEF\xBB\xBFPORT=8080\nHOST=a\n"},
+		{"bom and crlf", "config.json", "\xEF\xBB\xBF{\r\n  \"port\": 80\r\n}", map[string]any{"port": 8080}, nil, "\xEF\xBB\xBF{\r\n  \"port\": 8080\r\n}"},
+		{"inserted key", "config.toml", "[server]\r\nport = 80\r\n", map[string]any{"server.host": "a"}, []string{"server.host"}, "[server]\r\nport = 80\r\nhost = \"a\"\r\n"},
+	}
+
+	p := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(filePath, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if _, err := p.LoadFile(filePath); err != nil {
+				t.Fatalf("LoadFile() returned error: %v", err)
+			}
+			if err := p.UpdateFileValues(filePath, tt.updates, tt.create...); err != nil {
+				t.Fatalf("UpdateFileValues() returned error: %v", err)
+			}
+
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("UpdateFileValues() wrote %q, want %q", content, tt.expected)
+			}
+			if info, _ := os.Stat(filePath); runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+				t.Errorf("UpdateFileValues() left permissions %v, want 0600", info.Mode().Perm())
+			}
+		})
+	}
+}
@@ -0,0 +1,398 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"var-sync/internal/textfile"
+)
+
+// propertyEntry is a logical key/value pair in a .properties file, which may
+// span several physical lines through trailing backslash continuations
+type propertyEntry struct {
+	key        string
+	value      string
+	startLine  int
+	endLine    int
+	valueStart int // Offset of the raw value within the first physical line
+}
+
+// parsePropertiesFile parses Java-style .properties content. Dotted keys are
+// nested so that spring.datasource.url is addressable as a regular key path
+// and indexed segments such as hosts[0] become arrays.
+func (p *Parser) parsePropertiesFile(content string) (map[string]any, error) {
+	result := make(map[string]any)
+
+	for _, entry := range parsePropertyEntries(strings.Split(content, "\n")) {
+		value := parsePropertyValue(entry.value)
+		if !setPropertyPath(result, strings.Split(entry.key, "."), value) {
+			// Dotted keys that collide with another key's nested path (such as
+			// logging.level next to logging.level.root) are kept verbatim
+			if _, exists := result[entry.key]; !exists {
+				result[entry.key] = value
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// parsePropertyEntries scans physical lines into logical property entries
+func parsePropertyEntries(lines []string) []propertyEntry {
+	var entries []propertyEntry
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], "\r")
+		trimmed := strings.TrimLeft(line, " \t\f")
+
+		// Skip empty lines and comments
+		if trimmed == "" || trimmed[0] == '#' || trimmed[0] == '!' {
+			continue
+		}
+
+		entry := propertyEntry{startLine: i}
+		indent := len(line) - len(trimmed)
+		keyEnd, valueStart := splitPropertyLine(trimmed)
+		entry.key = unescapeProperty(trimmed[:keyEnd])
+		entry.valueStart = indent + valueStart
+
+		// Join continuation lines, dropping the leading whitespace of each
+		raw := trimmed[valueStart:]
+		for continuesLine(raw) && i+1 < len(lines) {
+			i++
+			raw = raw[:len(raw)-1] + strings.TrimLeft(strings.TrimRight(lines[i], "\r"), " \t\f")
+		}
+		if continuesLine(raw) {
+			raw = raw[:len(raw)-1]
+		}
+
+		entry.value = unescapeProperty(raw)
+		entry.endLine = i
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+// splitPropertyLine finds the end of the key and the start of the value in a
+// line with leading whitespace removed. The key ends at the first unescaped
+// '=', ':' or whitespace; the separator and surrounding whitespace are skipped.
+func splitPropertyLine(line string) (keyEnd, valueStart int) {
+	keyEnd = len(line)
+	for i := 0; i < len(line); i++ {
+		if line[i] == '\\' {
+			i++
+			continue
+		}
+		if line[i] == '=' || line[i] == ':' || line[i] == ' ' || line[i] == '\t' || line[i] == '\f' {
+			keyEnd = i
+			break
+		}
+	}
+
+	valueStart = keyEnd
+	for valueStart < len(line) && (line[valueStart] == ' ' || line[valueStart] == '\t' || line[valueStart] == '\f') {
+		valueStart++
+	}
+	if valueStart < len(line) && (line[valueStart] == '=' || line[valueStart] == ':') {
+		valueStart++
+		for valueStart < len(line) && (line[valueStart] == ' ' || line[valueStart] == '\t' || line[valueStart] == '\f') {
+			valueStart++
+		}
+	}
+
+	return keyEnd, valueStart
+}
+
+// continuesLine reports whether a line ends with an odd number of backslashes
+func continuesLine(line string) bool {
+	count := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		count++
+	}
+	return count%2 == 1
+}
+
+// unescapeProperty decodes backslash escapes including \uXXXX sequences
+func unescapeProperty(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+
+	var units []uint16
+	var b strings.Builder
+	flush := func() {
+		if len(units) > 0 {
+			b.WriteString(string(utf16.Decode(units)))
+			units = units[:0]
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' || i+1 >= len(s) {
+			flush()
+			b.WriteByte(s[i])
+			continue
+		}
+
+		i++
+		if s[i] == 'u' && i+4 < len(s) {
+			if code, err := strconv.ParseUint(s[i+1:i+5], 16, 16); err == nil {
+				units = append(units, uint16(code))
+				i += 4
+				continue
+			}
+		}
+
+		flush()
+		switch s[i] {
+		case 't':
+			b.WriteByte('\t')
+		case 'n':
+			b.WriteByte('\n')
+		case 'r':
+			b.WriteByte('\r')
+		case 'f':
+			b.WriteByte('\f')
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	flush()
+
+	return b.String()
+}
+
+// escapeProperty encodes a key or value for a .properties file. Non-ASCII
+// characters are written as \uXXXX so the output is valid in both the
+// ISO-8859-1 and UTF-8 readings of the format.
+func escapeProperty(s string, isKey bool) string {
+	var b strings.Builder
+	for i, r := range s {
+		switch {
+		case r == '\\':
+			b.WriteString("\\\\")
+		case r == '\t':
+			b.WriteString("\\t")
+		case r == '\n':
+			b.WriteString("\\n")
+		case r == '\r':
+			b.WriteString("\\r")
+		case r == '\f':
+			b.WriteString("\\f")
+		case r == ' ' && (isKey || i == 0):
+			b.WriteString("\\ ")
+		case isKey && (r == '=' || r == ':'):
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case (r == '#' || r == '!') && i == 0:
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 0x20 || r > 0x7e:
+			for _, unit := range utf16.Encode([]rune{r}) {
+				fmt.Fprintf(&b, "\\u%04X", unit)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// parsePropertyValue converts a property string into a typed value
+func parsePropertyValue(value string) any {
+	if value == "true" || value == "false" {
+		return value == "true"
+	} else if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return intVal
+	} else if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+		return floatVal
+	}
+	return value
+}
+
+// setPropertyPath stores value at the nested location described by segments,
+// creating maps and arrays as needed. It returns false if the path collides
+// with an existing value of a different shape.
+func setPropertyPath(current map[string]any, segments []string, value any) bool {
+	for i, segment := range segments {
+		last := i == len(segments)-1
+		key, index, err := parseKeySegment(segment)
+		if err != nil || key == "" {
+			return false
+		}
+
+		if index < 0 {
+			if last {
+				if isPropertyContainer(current[key]) {
+					return false
+				}
+				current[key] = value
+				return true
+			}
+			next, exists := current[key]
+			if !exists {
+				next = make(map[string]any)
+				current[key] = next
+			}
+			nextMap, ok := next.(map[string]any)
+			if !ok {
+				return false
+			}
+			current = nextMap
+			continue
+		}
+
+		existing, exists := current[key]
+		arr, ok := existing.([]any)
+		if exists && !ok {
+			return false
+		}
+		for len(arr) <= index {
+			arr = append(arr, nil)
+		}
+		current[key] = arr
+
+		if last {
+			if isPropertyContainer(arr[index]) {
+				return false
+			}
+			arr[index] = value
+			return true
+		}
+		if arr[index] == nil {
+			arr[index] = make(map[string]any)
+		}
+		nextMap, ok := arr[index].(map[string]any)
+		if !ok {
+			return false
+		}
+		current = nextMap
+	}
+
+	return false
+}
+
+// isPropertyContainer reports whether a value holds nested properties
+func isPropertyContainer(value any) bool {
+	switch value.(type) {
+	case map[string]any, []any:
+		return true
+	default:
+		return false
+	}
+}
+
+// formatPropertiesFile formats a map[string]any as .properties content with
+// nested maps flattened back into dotted keys
+func (p *Parser) formatPropertiesFile(data map[string]any) string {
+	flat := make(map[string]any)
+	flattenProperties(data, "", flat)
+
+	keys := make([]string, 0, len(flat))
+	for key := range flat {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", escapeProperty(key, true), formatPropertiesValue(flat[key]))
+	}
+	return b.String()
+}
+
+// flattenProperties flattens nested maps and arrays into dotted property keys
+func flattenProperties(value any, prefix string, out map[string]any) {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			path := key
+			if prefix != "" {
+				path = prefix + "." + key
+			}
+			flattenProperties(item, path, out)
+		}
+	case map[any]any:
+		flattenProperties(convertMapInterface(v), prefix, out)
+	case []any:
+		for i, item := range v {
+			flattenProperties(item, fmt.Sprintf("%s[%d]", prefix, i), out)
+		}
+	default:
+		out[prefix] = v
+	}
+}
+
+// formatPropertiesValue formats a value for use in .properties files
+func formatPropertiesValue(value any) string {
+	switch v := value.(type) {
+	case string:
+		return escapeProperty(v, false)
+	default:
+		return formatScalar(v)
+	}
+}
+
+// updatePropertiesValues updates multiple values in a .properties file while preserving formatting and comments
+func (p *Parser) updatePropertiesValues(filepath string, updates map[string]any) error {
+	content, err := textfile.Read(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	newContent, err := p.renderPropertiesValues(string(content), updates)
+	if err != nil {
+		return err
+	}
+
+	return textfile.Write(filepath, []byte(newContent))
+}
+
+// renderPropertiesValues applies updates to .properties content and returns
+// the modified content. Values that spanned continuation lines are collapsed
+// onto the key's line.
+func (p *Parser) renderPropertiesValues(content string, updates map[string]any) (string, error) {
+	lines := strings.Split(content, "\n")
+	replaced := make(map[int]string)
+	removed := make(map[int]bool)
+	updatedCount := 0
+
+	for _, entry := range parsePropertyEntries(lines) {
+		newValue, exists := updates[entry.key]
+		if !exists {
+			continue
+		}
+
+		line := lines[entry.startLine]
+		lineEnding := ""
+		if strings.HasSuffix(lines[entry.endLine], "\r") {
+			lineEnding = "\r"
+		}
+		replaced[entry.startLine] = line[:entry.valueStart] + formatPropertiesValue(newValue) + lineEnding
+		for i := entry.startLine + 1; i <= entry.endLine; i++ {
+			removed[i] = true
+		}
+		updatedCount++
+	}
+
+	if updatedCount == 0 {
+		return "", fmt.Errorf("no key paths found in file")
+	}
+
+	result := make([]string, 0, len(lines))
+	for i, line := range lines {
+		if removed[i] {
+			continue
+		}
+		if newLine, ok := replaced[i]; ok {
+			line = newLine
+		}
+		result = append(result, line)
+	}
+
+	return strings.Join(result, "\n"), nil
+}
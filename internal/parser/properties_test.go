@@ -0,0 +1,202 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParsePropertiesFile(t *testing.T) {
+	content := `# Spring Boot settings
+! bang comment
+server.port=8080
+spring.datasource.url = jdbc:postgresql://localhost/app
+spring.datasource.username: admin
+app.name Demo Application
+app.description = A long \
+    description that \
+    continues
+app.greeting = caf\u00e9 \u2603
+app.path = C:\\data\\app
+key\=with\:separators = escaped
+app.hosts[0] = alpha
+app.hosts[1] = beta
+logging.level = INFO
+logging.level.root = WARN`
+
+	parser := New()
+	data, err := parser.parsePropertiesFile(content)
+	if err != nil {
+		t.Fatalf("parsePropertiesFile() error = %v", err)
+	}
+
+	expected := map[string]any{
+		"server.port":                int64(8080),
+		"spring.datasource.url":      "jdbc:postgresql://localhost/app",
+		"spring.datasource.username": "admin",
+		"app.name":                   "Demo Application",
+		"app.description":            "A long description that continues",
+		"app.greeting":               "café ☃",
+		"app.path":                   `C:\data\app`,
+		"app.hosts[1]":               "beta",
+		"logging.level":              "INFO",
+	}
+
+	for keyPath, want := range expected {
+		got, err := parser.GetValue(data, keyPath)
+		if err != nil {
+			t.Errorf("GetValue(%s) error = %v", keyPath, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("GetValue(%s) = %v (%T), expected %v (%T)", keyPath, got, got, want, want)
+		}
+	}
+
+	if data["key=with:separators"] != "escaped" {
+		t.Errorf("Escaped key not parsed correctly, got %v", data["key=with:separators"])
+	}
+	if data["logging.level.root"] != "WARN" {
+		t.Errorf("Colliding key should be kept verbatim, got %v", data["logging.level.root"])
+	}
+}
+
+func TestEscapeProperty(t *testing.T) {
+	tests := []struct {
+		input    string
+		isKey    bool
+		expected string
+	}{
+		{"plain", false, "plain"},
+		{" leading space", false, `\ leading space`},
+		{"trailing space ", false, "trailing space "},
+		{`back\slash`, false, `back\\slash`},
+		{"line\nbreak", false, `line\nbreak`},
+		{"café", false, `caf\u00E9`},
+		{"😀", false, `\uD83D\uDE00`},
+		{"#hash", false, `\#hash`},
+		{"key=with:sep", true, `key\=with\:sep`},
+		{"key with space", true, `key\ with\ space`},
+	}
+
+	for _, tt := range tests {
+		if got := escapeProperty(tt.input, tt.isKey); got != tt.expected {
+			t.Errorf("escapeProperty(%q, %t) = %q, expected %q", tt.input, tt.isKey, got, tt.expected)
+		}
+		if got := unescapeProperty(escapeProperty(tt.input, tt.isKey)); got != tt.input {
+			t.Errorf("unescapeProperty(escapeProperty(%q)) = %q", tt.input, got)
+		}
+	}
+}
+
+func TestUpdatePropertiesValues(t *testing.T) {
+	tests := []struct {
+		name            string
+		content         string
+		updates         map[string]any
+		expectedContent string
+	}{
+		{
+			name: "preserve comments, ordering and separators",
+			content: `# Database
+spring.datasource.url = jdbc:postgresql://localhost/app
+spring.datasource.username: admin
+
+# Server
+server.port=8080`,
+			updates: map[string]any{
+				"spring.datasource.url": "jdbc:postgresql://db.internal/app",
+				"server.port":           9090,
+			},
+			expectedContent: `# Database
+spring.datasource.url = jdbc:postgresql://db.internal/app
+spring.datasource.username: admin
+
+# Server
+server.port=9090`,
+		},
+		{
+			name: "collapse continuation lines",
+			content: `app.description = first \
+    second \
+    third
+app.name = demo`,
+			updates: map[string]any{
+				"app.description": "replaced",
+			},
+			expectedContent: `app.description = replaced
+app.name = demo`,
+		},
+		{
+			name:    "escape new values",
+			content: "app.greeting=hello\r\napp.name=demo\r\n",
+			updates: map[string]any{
+				"app.greeting": "grüß dich",
+			},
+			expectedContent: "app.greeting=gr\\u00FC\\u00DF dich\r\napp.name=demo\r\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "application.properties")
+			if err := os.WriteFile(path, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to write test file: %v", err)
+			}
+
+			parser := New()
+			if err := parser.UpdateFileValues(path, tt.updates); err != nil {
+				t.Fatalf("UpdateFileValues() error = %v", err)
+			}
+
+			actual, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatalf("Failed to read updated file: %v", err)
+			}
+			if string(actual) != tt.expectedContent {
+				t.Errorf("UpdateFileValues() result:\n%q\n\nExpected:\n%q", actual, tt.expectedContent)
+			}
+		})
+	}
+}
+
+func TestUpdatePropertiesValuesError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "application.properties")
+	if err := os.WriteFile(path, []byte("server.port=8080\n"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	parser := New()
+	err := parser.UpdateFileValues(path, map[string]any{"server.host": "x"})
+	if err == nil || !strings.Contains(err.Error(), "no key paths found") {
+		t.Errorf("UpdateFileValues() error = %v, expected 'no key paths found'", err)
+	}
+}
+
+func TestSaveFileProperties(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "generated.properties")
+	data := map[string]any{
+		"server": map[string]any{"port": 8080},
+		"app":    map[string]any{"hosts": []any{"a", "b"}},
+	}
+
+	parser := New()
+	if err := parser.SaveFile(path, data); err != nil {
+		t.Fatalf("SaveFile() error = %v", err)
+	}
+
+	content, _ := os.ReadFile(path)
+	expected := "app.hosts[0]=a\napp.hosts[1]=b\nserver.port=8080\n"
+	if string(content) != expected {
+		t.Errorf("SaveFile() wrote:\n%s\nExpected:\n%s", content, expected)
+	}
+
+	loaded, err := parser.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	if value, _ := parser.GetValue(loaded, "app.hosts[1]"); value != "b" {
+		t.Errorf("Round trip lost array value, got %v", value)
+	}
+}
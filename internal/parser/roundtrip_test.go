@@ -0,0 +1,290 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"var-sync/pkg/models"
+)
+
+// The round-trip properties build random nested documents, write them in
+// each format and sync random values between them, checking that every value
+// reads back with the same type and value it was written with. Unlike
+// ValuesEqual, which compares the text of values, they tell the integer 2
+// from the float 2.0 and the string "2" from either. Each document is built
+// from a seed that failures report, so a failure can be replayed by running
+// the property for that seed alone.
+
+// roundTripFormats are the formats documents are written in, with the file
+// name each is written to
+var roundTripFormats = []struct {
+	format models.FileFormat
+	file   string
+}{
+	{models.FormatJSON, "config.json"},
+	{models.FormatYAML, "config.yaml"},
+	{models.FormatTOML, "config.toml"},
+	{models.FormatENV, "config.env"},
+}
+
+// roundTripSeeds returns the seeds of the documents to check, fewer in short
+// mode
+func roundTripSeeds() []uint64 {
+	count := 100
+	if testing.Short() {
+		count = 20
+	}
+	seeds := make([]uint64, count)
+	for i := range seeds {
+		seeds[i] = uint64(i + 1)
+	}
+	return seeds
+}
+
+// generator builds random documents that a format can hold: .env files only
+// hold top-level scalars, named like variables, and TOML has no null
+type generator struct {
+	rand   *rand.Rand
+	format models.FileFormat
+}
+
+func newGenerator(seed uint64, format models.FileFormat) *generator {
+	return &generator{rand: rand.New(rand.NewPCG(seed, uint64(len(format)))), format: format}
+}
+
+// document returns a random document of at least one key
+func (g *generator) document() map[string]any {
+	if g.format == models.FormatENV {
+		data := make(map[string]any)
+		for i := range 1 + g.rand.IntN(8) {
+			data[fmt.Sprintf("VAR_%d", i)] = g.scalar()
+		}
+		return data
+	}
+	return g.object(3)
+}
+
+// object returns a random object nested at most depth levels deep
+func (g *generator) object(depth int) map[string]any {
+	data := make(map[string]any)
+	for range 1 + g.rand.IntN(5) {
+		data[g.key()] = g.value(depth - 1)
+	}
+	return data
+}
+
+// value returns a random scalar, array or object
+func (g *generator) value(depth int) any {
+	if depth <= 0 {
+		return g.scalar()
+	}
+	switch g.rand.IntN(6) {
+	case 0:
+		return g.object(depth)
+	case 1:
+		array := make([]any, g.rand.IntN(4))
+		for i := range array {
+			array[i] = g.scalar()
+		}
+		return array
+	case 2:
+		array := make([]any, 1+g.rand.IntN(3))
+		for i := range array {
+			array[i] = g.object(depth)
+		}
+		return array
+	}
+	return g.scalar()
+}
+
+// roundTripKeys are the keys objects are built from, including keys that key
+// paths have to quote
+var roundTripKeys = []string{
+	"host", "port", "name", "enabled", "ratio", "items", "db_url", "max-conns",
+	"Mixed_Case", "ünïcode", "日本", "example.com", "with space", "1st",
+}
+
+func (g *generator) key() string {
+	return roundTripKeys[g.rand.IntN(len(roundTripKeys))]
+}
+
+// roundTripStrings are the strings values are built from: strings that look
+// like other types, and strings that need quoting or escaping in some format
+var roundTripStrings = []string{
+	"localhost", "", " ", "true", "false", "null", "~", "yes", "no", "0", "42",
+	"-7", "3.14", "1e5", "0x1F", "0o17", "1_000", ".5", "inf", "nan",
+	"2024-01-02", "2024-01-02T03:04:05Z", "12:30", "a: b", "- item", "[x]",
+	"{y}", "key=value", "# not a comment", "a # b", "it's", `say "hi"`,
+	`C:\dir\file`, `\n`, "line one\nline two", "trailing\n", "tab\there",
+	"  padded  ", "café", "日本語", "emoji 🚀", "ñ\u00a0nbsp", "$HOME", "${VAR}",
+	"&anchor", "*alias", "!tag", "%percent", "@at", "`tick`", "|", ">", "'",
+	`"`, "\\", "=", ",",
+}
+
+// scalar returns a random string, integer, float, bool or, where the format
+// has it, null
+func (g *generator) scalar() any {
+	switch g.rand.IntN(8) {
+	case 0:
+		return roundTripStrings[g.rand.IntN(len(roundTripStrings))]
+	case 1:
+		// Strings joined from pieces that are harmless alone
+		return roundTripStrings[g.rand.IntN(len(roundTripStrings))] + roundTripStrings[g.rand.IntN(len(roundTripStrings))]
+	case 2:
+		return []int64{0, 1, -1, 42, 8080, 1 << 53, 1<<53 + 1, math.MaxInt64, math.MinInt64}[g.rand.IntN(9)]
+	case 3:
+		return g.rand.Int64N(2_000_000) - 1_000_000
+	case 4:
+		return []float64{0.5, -2.25, 2.0, 100.0, 1e21, 1.5e300, 2.5e-10, 0.1, 1e-4, -0.0001}[g.rand.IntN(10)]
+	case 5:
+		return g.rand.NormFloat64() * 1000
+	case 6:
+		if g.format == models.FormatTOML || g.format == models.FormatENV {
+			return g.rand.IntN(2) == 0
+		}
+		return nil
+	}
+	return g.rand.IntN(2) == 0
+}
+
+// envValue returns what a .env file reads back for value written to it: env
+// values have no types, so strings read back as ParseEnvValue reads them and
+// null as an empty string
+func envValue(value any) any {
+	switch v := value.(type) {
+	case string:
+		return ParseEnvValue(v)
+	case nil:
+		return ""
+	}
+	return value
+}
+
+// sameValue compares values strictly, by type as well as value. NaN, which
+// an env file reads from "nan", equals itself.
+func sameValue(a, b any) bool {
+	if x, ok := a.(float64); ok && math.IsNaN(x) {
+		y, ok := b.(float64)
+		return ok && math.IsNaN(y)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func TestRoundTripWholeDocuments(t *testing.T) {
+	p := New()
+	for _, f := range roundTripFormats {
+		for _, seed := range roundTripSeeds() {
+			data := newGenerator(seed, f.format).document()
+			filePath := filepath.Join(t.TempDir(), f.file)
+			if err := p.SaveFile(filePath, data); err != nil {
+				t.Fatalf("%s seed %d: SaveFile() error = %v", f.format, seed, err)
+			}
+			loaded, err := p.LoadFile(filePath)
+			if err != nil {
+				content, _ := os.ReadFile(filePath)
+				t.Fatalf("%s seed %d: LoadFile() error = %v\n%s", f.format, seed, err, content)
+			}
+
+			keys := p.GetAllKeys(data, "")
+			sort.Strings(keys)
+			for _, keyPath := range keys {
+				want, _ := p.GetValue(data, keyPath)
+				if f.format == models.FormatENV {
+					want = envValue(want)
+				}
+				if got, err := p.GetValue(loaded, keyPath); err != nil || !sameValue(got, want) {
+					content, _ := os.ReadFile(filePath)
+					t.Errorf("%s seed %d: %s = %#v, %v; want %#v\n%s", f.format, seed, keyPath, got, err, want, content)
+				}
+			}
+		}
+	}
+}
+
+func TestRoundTripSyncedValues(t *testing.T) {
+	p := New()
+	for _, source := range roundTripFormats {
+		for _, target := range roundTripFormats {
+			for _, seed := range roundTripSeeds() {
+				checkSyncedValues(t, p, source.file, target.file, seed)
+			}
+		}
+	}
+}
+
+// checkSyncedValues writes random source and target documents, then syncs
+// random values read from the source file to random keys of the target file
+// at once, as a rule batch does. The target must read back every value
+// synced, and every value it held that was not synced to.
+func checkSyncedValues(t *testing.T, p *Parser, sourceName, targetName string, seed uint64) {
+	t.Helper()
+	sourceFormat, targetFormat := models.DetectFormat(sourceName), models.DetectFormat(targetName)
+	r := rand.New(rand.NewPCG(seed, 0))
+	dir := t.TempDir()
+
+	sourceFile := filepath.Join(dir, "source-"+sourceName)
+	if err := p.SaveFile(sourceFile, newGenerator(seed, sourceFormat).document()); err != nil {
+		t.Fatalf("%s to %s seed %d: SaveFile() error = %v", sourceFormat, targetFormat, seed, err)
+	}
+	sourceData, err := p.LoadFile(sourceFile)
+	if err != nil {
+		t.Fatalf("%s to %s seed %d: LoadFile() error = %v", sourceFormat, targetFormat, seed, err)
+	}
+
+	targetFile := filepath.Join(dir, targetName)
+	if err := p.SaveFile(targetFile, newGenerator(seed+1<<32, targetFormat).document()); err != nil {
+		t.Fatalf("%s to %s seed %d: SaveFile() error = %v", sourceFormat, targetFormat, seed, err)
+	}
+	before, err := p.LoadFile(targetFile)
+	if err != nil {
+		t.Fatalf("%s to %s seed %d: LoadFile() error = %v", sourceFormat, targetFormat, seed, err)
+	}
+
+	sourceKeys := p.GetAllKeys(sourceData, "")
+	targetKeys := p.GetAllKeys(before, "")
+	sort.Strings(sourceKeys)
+	sort.Strings(targetKeys)
+	if len(sourceKeys) == 0 || len(targetKeys) == 0 {
+		return // Only empty arrays
+	}
+	updates := make(map[string]any)
+	for range 1 + r.IntN(3) {
+		targetKey := targetKeys[r.IntN(len(targetKeys))]
+		value, _ := p.GetValue(sourceData, sourceKeys[r.IntN(len(sourceKeys))])
+		if value == nil && targetFormat == models.FormatTOML {
+			continue
+		}
+		updates[targetKey] = value
+	}
+	if len(updates) == 0 {
+		return
+	}
+
+	original, _ := os.ReadFile(targetFile)
+	if err := p.UpdateFileValues(targetFile, updates); err != nil {
+		t.Fatalf("%s to %s seed %d: UpdateFileValues(%v) error = %v\n%s", sourceFormat, targetFormat, seed, updates, err, original)
+	}
+	after, err := p.LoadFile(targetFile)
+	content, _ := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("%s to %s seed %d: LoadFile() after the update error = %v\nbefore:\n%s\nafter:\n%s", sourceFormat, targetFormat, seed, err, original, content)
+	}
+
+	for _, keyPath := range targetKeys {
+		want, synced := updates[keyPath]
+		if !synced {
+			want, _ = p.GetValue(before, keyPath)
+		} else if targetFormat == models.FormatENV {
+			want = envValue(want)
+		}
+		if got, err := p.GetValue(after, keyPath); err != nil || !sameValue(got, want) {
+			t.Errorf("%s to %s seed %d: %s = %#v, %v; want %#v (synced %v)\nbefore:\n%s\nafter:\n%s", sourceFormat, targetFormat, seed, keyPath, got, err, want, synced, original, content)
+		}
+	}
+}
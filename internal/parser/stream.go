@@ -0,0 +1,311 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"var-sync/pkg/models"
+)
+
+// Large JSON and YAML sources are often generated documents that rules read
+// only a few keys from. Rather than decoding the whole document, ExtractJSON
+// scans its tokens and ExtractYAML its lines, keeping just the values at the
+// key paths wanted and stopping as soon as they have them all. The other
+// formats are always loaded whole.
+
+// StreamMinSize is the size from which LoadFileKeys scans a JSON or YAML file
+// for the keys wanted instead of decoding all of it
+const StreamMinSize = 4 << 20
+
+// keyTree holds the key paths wanted below one value
+type keyTree struct {
+	keys    map[string]*keyTree // Wanted below object keys
+	indexes map[int]*keyTree    // Wanted below array elements
+	paths   int                 // How many key paths end at or below this value
+	whole   bool                // The value itself is wanted
+}
+
+// jsonScanner reads the values a keyTree wants from a JSON token stream
+type jsonScanner struct {
+	decoder   *json.Decoder
+	remaining int // Key paths not found or ruled out yet
+}
+
+// CanExtract reports whether ExtractJSON can read keyPath: a plain key path,
+// optionally with array indexes, without wildcards, JSONPath or array
+// operations
+func CanExtract(keyPath string) bool {
+	path, err := ParseKeyPath(keyPath)
+	return err == nil && path.Plain()
+}
+
+// LoadFileKeys loads filepath for reading the values at keyPaths. A JSON or
+// YAML file of StreamMinSize or more is scanned for only those values if every
+// key path can be extracted, in which case partial is true and the data holds
+// little else. Any other file is loaded whole, as is YAML laid out in a way
+// ExtractYAML does not scan.
+func (p *Parser) LoadFileKeys(ctx context.Context, filepath string, keyPaths []string) (data map[string]any, partial bool, err error) {
+	if !streamable(filepath, keyPaths) {
+		data, err = p.LoadFileContext(ctx, filepath)
+		return data, false, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, false, err
+	}
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	// Skip a byte order mark, like textfile.Read
+	if bom, _ := reader.Peek(3); bytes.Equal(bom, []byte{0xEF, 0xBB, 0xBF}) {
+		reader.Discard(3)
+	}
+
+	if models.DetectFormat(filepath) == models.FormatYAML {
+		data, err = p.ExtractYAML(reader, yamlKeyPaths(keyPaths))
+		if err != nil {
+			// LoadFile reports what is wrong with the document, if anything
+			data, err = p.LoadFileContext(ctx, filepath)
+			return data, false, err
+		}
+		decodeKubernetesSecret(data)
+		decodeComposeEnvironment(data)
+		return data, true, nil
+	}
+
+	data, err = p.ExtractJSON(reader, keyPaths)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to parse %s file: %w", models.FormatJSON, err)
+	}
+	return data, true, nil
+}
+
+// streamable reports whether LoadFileKeys scans filepath for keyPaths
+func streamable(filepath string, keyPaths []string) bool {
+	if format := models.DetectFormat(filepath); len(keyPaths) == 0 || format != models.FormatJSON && format != models.FormatYAML {
+		return false
+	}
+	for _, keyPath := range keyPaths {
+		if !CanExtract(keyPath) {
+			return false
+		}
+	}
+	info, err := os.Stat(filepath)
+	return err == nil && info.Size() >= StreamMinSize
+}
+
+// yamlKeyPaths returns keyPaths along with the kind and API version of the
+// document if they read the data of a Kubernetes Secret, which is only
+// decoded for that kind
+func yamlKeyPaths(keyPaths []string) []string {
+	for _, keyPath := range keyPaths {
+		if path, _ := ParseKeyPath(keyPath); path.Segments()[0].Key == "data" {
+			return append(slices.Clip(keyPaths), "kind", "apiVersion")
+		}
+	}
+	return keyPaths
+}
+
+// newKeyTree returns the tree of keyPaths, which must all be extractable
+func newKeyTree(keyPaths []string) (*keyTree, error) {
+	tree := &keyTree{}
+	for _, keyPath := range keyPaths {
+		if !CanExtract(keyPath) {
+			return nil, fmt.Errorf("key path %s cannot be extracted from a stream", keyPath)
+		}
+		path, _ := ParseKeyPath(keyPath)
+		tree.add(path.Segments())
+	}
+	return tree, nil
+}
+
+// ExtractJSON reads the JSON object from r only as far as it has to to find
+// the values at keyPaths, and returns an object holding just those values at
+// the same key paths, so that GetValue reads them as it would from the whole
+// document. Key paths the document does not have are missing from it too,
+// and arrays hold nil in place of the elements not wanted. Where a key
+// appears twice, the first is read. Once every key path is found, the rest of
+// r is neither read nor checked to be valid JSON.
+func (p *Parser) ExtractJSON(r io.Reader, keyPaths []string) (map[string]any, error) {
+	tree, err := newKeyTree(keyPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	scanner := &jsonScanner{decoder: json.NewDecoder(r), remaining: tree.paths}
+	// Numbers are decoded as json.Number so that integers stay integers
+	scanner.decoder.UseNumber()
+	token, err := scanner.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if token != json.Delim('{') {
+		return nil, fmt.Errorf("document is not an object")
+	}
+	if tree.paths == 0 {
+		return map[string]any{}, nil
+	}
+	return scanner.object(tree)
+}
+
+// add adds the key path made of segments below t
+func (t *keyTree) add(segments []KeySegment) {
+	t.paths++
+	if len(segments) == 0 {
+		t.whole = true
+		return
+	}
+
+	key, index := segments[0].Key, segments[0].Index
+	if t.keys == nil {
+		t.keys = make(map[string]*keyTree)
+	}
+	next := t.keys[key]
+	if next == nil {
+		next = &keyTree{}
+		t.keys[key] = next
+	}
+	if index >= 0 {
+		next.paths++
+		if next.indexes == nil {
+			next.indexes = make(map[int]*keyTree)
+		}
+		if next.indexes[index] == nil {
+			next.indexes[index] = &keyTree{}
+		}
+		next = next.indexes[index]
+	}
+	next.add(segments[1:])
+}
+
+// value reads the next value, keeping what tree wants of it
+func (s *jsonScanner) value(tree *keyTree) (any, error) {
+	if tree.whole {
+		var value any
+		if err := s.decoder.Decode(&value); err != nil {
+			return nil, err
+		}
+		s.remaining -= tree.paths
+		return NormalizeValue(value), nil
+	}
+
+	token, err := s.decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	switch token {
+	case json.Delim('{'):
+		return s.object(tree)
+	case json.Delim('['):
+		return s.array(tree)
+	}
+	// A scalar where keys were wanted below it, which GetValue reports
+	s.remaining -= tree.paths
+	return NormalizeValue(token), nil
+}
+
+// object reads the rest of an object whose opening brace was read, returning
+// as soon as no key paths remain
+func (s *jsonScanner) object(tree *keyTree) (map[string]any, error) {
+	before := s.remaining
+	result := make(map[string]any)
+	for s.decoder.More() {
+		token, err := s.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := token.(string)
+		next, wanted := tree.keys[key]
+		if _, found := result[key]; !wanted || found {
+			if err := s.skip(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		value, err := s.value(next)
+		if err != nil {
+			return nil, err
+		}
+		result[key] = value
+		if s.remaining == 0 {
+			return result, nil
+		}
+	}
+	if _, err := s.decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	// Key paths below keys the object does not have are ruled out
+	s.remaining = before - tree.paths
+	return result, nil
+}
+
+// array reads the rest of an array whose opening bracket was read, like
+// object. Elements after the last one wanted are left out.
+func (s *jsonScanner) array(tree *keyTree) ([]any, error) {
+	before := s.remaining
+	last := -1
+	for index := range tree.indexes {
+		last = max(last, index)
+	}
+
+	result := []any{}
+	for index := 0; s.decoder.More(); index++ {
+		next, wanted := tree.indexes[index]
+		if !wanted {
+			if err := s.skip(); err != nil {
+				return nil, err
+			}
+			if index < last {
+				result = append(result, nil)
+			}
+			continue
+		}
+
+		value, err := s.value(next)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, value)
+		if s.remaining == 0 {
+			return result, nil
+		}
+	}
+	if _, err := s.decoder.Token(); err != nil {
+		return nil, err
+	}
+
+	s.remaining = before - tree.paths
+	return result, nil
+}
+
+// skip reads past the next value without keeping any of it
+func (s *jsonScanner) skip() error {
+	depth := 0
+	for {
+		token, err := s.decoder.Token()
+		if err != nil {
+			return err
+		}
+		switch token {
+		case json.Delim('{'), json.Delim('['):
+			depth++
+		case json.Delim('}'), json.Delim(']'):
+			depth--
+		}
+		if depth == 0 {
+			return nil
+		}
+	}
+}
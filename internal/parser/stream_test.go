@@ -0,0 +1,147 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractJSON(t *testing.T) {
+	p := New()
+	document := `{
+		"name": "api",
+		"skipped": {"deep": [1, {"x": [2, 3]}], "text": "a } ] string"},
+		"database": {"host": "db", "port": 5432, "ratio": 0.5, "tls": true},
+		"servers": [{"host": "a"}, {"host": "b"}, {"host": "c"}],
+		"example.com": {"port": 443},
+		"name": "duplicate"
+	}`
+
+	tests := []struct {
+		keyPath string
+		want    any
+	}{
+		{"name", "api"},
+		{"database.port", int64(5432)},
+		{"database.ratio", 0.5},
+		{"database.tls", true},
+		{"database", map[string]any{"host": "db", "port": int64(5432), "ratio": 0.5, "tls": true}},
+		{"servers[1].host", "b"},
+		{"servers[2]", map[string]any{"host": "c"}},
+		{`"example.com".port`, int64(443)},
+	}
+	for _, tt := range tests {
+		data, err := p.ExtractJSON(strings.NewReader(document), []string{tt.keyPath})
+		if err != nil {
+			t.Fatalf("ExtractJSON(%s) error = %v", tt.keyPath, err)
+		}
+		value, err := p.GetValue(data, tt.keyPath)
+		if err != nil || !reflect.DeepEqual(value, tt.want) {
+			t.Errorf("GetValue(%s) on extracted data = %#v, %v; want %#v", tt.keyPath, value, err, tt.want)
+		}
+		if _, ok := data["skipped"]; ok {
+			t.Errorf("ExtractJSON(%s) kept a key not wanted", tt.keyPath)
+		}
+	}
+
+	// Missing keys are reported as they are from the whole document
+	data, err := p.ExtractJSON(strings.NewReader(document), []string{"database.user", "servers[5].host", "name.first"})
+	if err != nil {
+		t.Fatalf("ExtractJSON() error = %v", err)
+	}
+	for _, keyPath := range []string{"database.user", "servers[5].host", "name.first"} {
+		if _, err := p.GetValue(data, keyPath); err == nil {
+			t.Errorf("GetValue(%s) on extracted data expected an error", keyPath)
+		}
+	}
+
+	if _, err := p.ExtractJSON(strings.NewReader(document), []string{"servers[*].host"}); err == nil {
+		t.Error("ExtractJSON() with a wildcard expected an error")
+	}
+	if _, err := p.ExtractJSON(strings.NewReader(`[1, 2]`), []string{"name"}); err == nil {
+		t.Error("ExtractJSON() of an array expected an error")
+	}
+}
+
+func TestExtractJSONStopsAtLastKey(t *testing.T) {
+	p := New()
+	// Everything after the keys wanted is invalid, so reading it would fail
+	document := `{"a": {"b": 1}, "c": [0, "x"], "rest": {{{`
+
+	data, err := p.ExtractJSON(strings.NewReader(document), []string{"c[1]", "a.b"})
+	if err != nil {
+		t.Fatalf("ExtractJSON() error = %v", err)
+	}
+	want := map[string]any{"a": map[string]any{"b": int64(1)}, "c": []any{nil, "x"}}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("ExtractJSON() = %#v, want %#v", data, want)
+	}
+
+	if _, err := p.ExtractJSON(strings.NewReader(document), []string{"a.b", "missing"}); err == nil {
+		t.Error("ExtractJSON() of a key past the invalid content expected an error")
+	}
+}
+
+func TestCanExtract(t *testing.T) {
+	tests := map[string]bool{
+		"database.host":      true,
+		"servers[0].host":    true,
+		`"example.com".port`: true,
+		"servers[*].host":    false,
+		"database.*":         false,
+		"$.servers[0].host":  false,
+		"servers[last].host": false,
+		"servers[=a].host":   false,
+		"servers[x]":         false,
+	}
+	for keyPath, want := range tests {
+		if got := CanExtract(keyPath); got != want {
+			t.Errorf("CanExtract(%s) = %v, want %v", keyPath, got, want)
+		}
+	}
+}
+
+func TestLoadFileKeys(t *testing.T) {
+	p := New()
+	dir := t.TempDir()
+
+	small := filepath.Join(dir, "small.json")
+	if err := os.WriteFile(small, []byte(`{"host": "db", "port": 5432}`), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	data, partial, err := p.LoadFileKeys(context.Background(), small, []string{"host"})
+	if err != nil || partial || data["port"] != int64(5432) {
+		t.Errorf("LoadFileKeys() of a small file = %v, %v, %v; want the whole file", data, partial, err)
+	}
+
+	var b strings.Builder
+	b.WriteString("\xEF\xBB\xBF{\"host\": \"db\", \"items\": [")
+	for i := 0; b.Len() < StreamMinSize; i++ {
+		fmt.Fprintf(&b, `{"id": %d, "name": "item %d"},`, i, i)
+	}
+	b.WriteString(`{"id": -1}], "port": 5432}`)
+	large := filepath.Join(dir, "large.json")
+	if err := os.WriteFile(large, []byte(b.String()), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	data, partial, err = p.LoadFileKeys(context.Background(), large, []string{"host", "items[1].name"})
+	if err != nil || !partial {
+		t.Fatalf("LoadFileKeys() of a large file = %v, %v; want it read in part", partial, err)
+	}
+	if value, err := p.GetValue(data, "items[1].name"); err != nil || value != "item 1" {
+		t.Errorf("GetValue(items[1].name) = %v, %v; want item 1", value, err)
+	}
+	if _, ok := data["port"]; ok {
+		t.Error("LoadFileKeys() read past the keys wanted")
+	}
+
+	data, partial, err = p.LoadFileKeys(context.Background(), large, []string{"items[*].id"})
+	if err != nil || partial || data["port"] != int64(5432) {
+		t.Errorf("LoadFileKeys() with a wildcard = %v, %v; want the whole file", partial, err)
+	}
+}
@@ -0,0 +1,170 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// isStructuredValue reports whether a value is an object or array rather than a primitive
+func isStructuredValue(value any) bool {
+	switch value.(type) {
+	case map[string]any, map[any]any, []any, []map[string]any:
+		return true
+	default:
+		return false
+	}
+}
+
+// deepCopyValue returns a copy of value that shares no maps or slices with
+// the original. Format-specific container types such as YAML's map[any]any
+// and TOML's table arrays are converted to map[string]any and []any.
+func deepCopyValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[key] = deepCopyValue(item)
+		}
+		return result
+	case map[any]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[fmt.Sprintf("%v", key)] = deepCopyValue(item)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = deepCopyValue(item)
+		}
+		return result
+	case []map[string]any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = deepCopyValue(item)
+		}
+		return result
+	default:
+		return v
+	}
+}
+
+// ValuesEqual reports whether two values would be written to a file the same
+// way. Values are compared by their text form, so the string "8080" read back
+// from an env file equals the number 8080, and objects and arrays compare
+// leaf by leaf.
+func (p *Parser) ValuesEqual(a, b any) bool {
+	if !isStructuredValue(a) && !isStructuredValue(b) {
+		return fmt.Sprintf("%v", a) == fmt.Sprintf("%v", b)
+	}
+	if !isStructuredValue(a) || !isStructuredValue(b) {
+		return false
+	}
+
+	leavesA, leavesB := p.structuredLeaves(a), p.structuredLeaves(b)
+	if len(leavesA) != len(leavesB) {
+		return false
+	}
+	for keyPath, leaf := range leavesA {
+		other, ok := leavesB[keyPath]
+		if !ok || fmt.Sprintf("%v", leaf) != fmt.Sprintf("%v", other) {
+			return false
+		}
+	}
+	return true
+}
+
+// structuredLeaves flattens an object or array value into its leaf values,
+// keyed by the key path relative to the value (".host", "[0].name")
+func (p *Parser) structuredLeaves(value any) map[string]any {
+	wrapper := map[string]any{"_": value}
+	leaves := make(map[string]any)
+	for _, keyPath := range p.GetAllKeys(wrapper, "") {
+		leaf, err := p.GetValue(wrapper, keyPath)
+		if err != nil {
+			continue
+		}
+		leaves[strings.TrimPrefix(keyPath, "_")] = leaf
+	}
+	return leaves
+}
+
+// expandStructuredValues prepares updates whose values are whole objects or
+// arrays. When the target already holds a structure with exactly the same
+// keys, each leaf is updated surgically like any other value. Otherwise the
+// structure cannot be expressed as in-place edits, so the target is loaded,
+// the values are deep copied into it and the whole file is re-encoded; the
+// re-encoded content is returned as rewritten.
+func (p *Parser) expandStructuredValues(filepath string, updates map[string]any) (map[string]any, []byte, error) {
+	structured := false
+	for _, value := range updates {
+		if isStructuredValue(value) {
+			structured = true
+			break
+		}
+	}
+	if !structured {
+		return updates, nil, nil
+	}
+
+	targetData, err := p.LoadFile(filepath)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expanded := make(map[string]any, len(updates))
+	rewrite := false
+	for keyPath, value := range updates {
+		if !isStructuredValue(value) {
+			expanded[keyPath] = value
+			continue
+		}
+
+		leaves := p.structuredLeaves(value)
+		existing, err := p.GetValue(targetData, keyPath)
+		if err != nil || !isStructuredValue(existing) || !sameLeafKeys(leaves, p.structuredLeaves(existing)) || len(leaves) == 0 {
+			rewrite = true
+			break
+		}
+		for relative, leaf := range leaves {
+			expanded[keyPath+relative] = leaf
+		}
+	}
+
+	if !rewrite {
+		return expanded, nil, nil
+	}
+
+	// Apply in key order so that parent paths are set before their children
+	keyPaths := make([]string, 0, len(updates))
+	for keyPath := range updates {
+		keyPaths = append(keyPaths, keyPath)
+	}
+	sort.Strings(keyPaths)
+
+	for _, keyPath := range keyPaths {
+		if err := p.SetValue(targetData, keyPath, deepCopyValue(updates[keyPath])); err != nil {
+			return nil, nil, fmt.Errorf("failed to set %s: %w", keyPath, err)
+		}
+	}
+
+	output, err := p.marshalFile(filepath, targetData)
+	if err != nil {
+		return nil, nil, err
+	}
+	return nil, output, nil
+}
+
+// sameLeafKeys reports whether two flattened structures have identical key sets
+func sameLeafKeys(a, b map[string]any) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key := range a {
+		if _, exists := b[key]; !exists {
+			return false
+		}
+	}
+	return true
+}
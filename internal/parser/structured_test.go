@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDeepCopyValue(t *testing.T) {
+	original := map[string]any{
+		"hosts": []any{"a", "b"},
+		"pool":  map[any]any{"max": 10},
+		"nodes": []map[string]any{{"name": "n1"}},
+	}
+
+	copied := deepCopyValue(original).(map[string]any)
+	expected := map[string]any{
+		"hosts": []any{"a", "b"},
+		"pool":  map[string]any{"max": 10},
+		"nodes": []any{map[string]any{"name": "n1"}},
+	}
+	if !reflect.DeepEqual(copied, expected) {
+		t.Errorf("deepCopyValue() = %v, expected %v", copied, expected)
+	}
+
+	copied["hosts"].([]any)[0] = "changed"
+	if original["hosts"].([]any)[0] != "a" {
+		t.Error("deepCopyValue() shares slices with the original")
+	}
+}
+
+func TestValuesEqual(t *testing.T) {
+	p := New()
+	tests := []struct {
+		name     string
+		a, b     any
+		expected bool
+	}{
+		{"same string", "localhost", "localhost", true},
+		{"number read back as string", 8080, "8080", true},
+		{"different values", 8080, 9090, false},
+		{"same object with different container types", map[string]any{"max": 10}, map[any]any{"max": 10}, true},
+		{"object with extra key", map[string]any{"max": 10}, map[string]any{"max": 10, "min": 1}, false},
+		{"array and string", []any{"a"}, "a", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := p.ValuesEqual(tt.a, tt.b); got != tt.expected {
+				t.Errorf("ValuesEqual(%v, %v) = %v, expected %v", tt.a, tt.b, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUpdateFileValuesStructured(t *testing.T) {
+	source := map[string]any{
+		"host": "db.internal",
+		"port": int64(5432),
+		"pool": map[string]any{"max": int64(20)},
+	}
+
+	t.Run("matching shape is updated surgically", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "target.yaml")
+		content := `# database settings
+database:
+  host: localhost # primary
+  port: 3306
+  pool:
+    max: 5
+name: app
+`
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+
+		parser := New()
+		if err := parser.UpdateFileValues(path, map[string]any{"database": source}); err != nil {
+			t.Fatalf("UpdateFileValues() error = %v", err)
+		}
+
+		actual, _ := os.ReadFile(path)
+		expected := `# database settings
+database:
+  host: db.internal # primary
+  port: 5432
+  pool:
+    max: 20
+name: app
+`
+		if string(actual) != expected {
+			t.Errorf("UpdateFileValues() result:\n%s\nExpected:\n%s", actual, expected)
+		}
+	})
+
+	t.Run("different shape rewrites the file", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "target.toml")
+		content := `name = "app"
+
+[database]
+host = "localhost"
+`
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+
+		parser := New()
+		if err := parser.UpdateFileValues(path, map[string]any{"database": source, "name": "renamed"}); err != nil {
+			t.Fatalf("UpdateFileValues() error = %v", err)
+		}
+
+		data, err := parser.LoadFile(path)
+		if err != nil {
+			t.Fatalf("Rewritten file no longer parses: %v", err)
+		}
+		for keyPath, want := range map[string]any{
+			"database.host":     "db.internal",
+			"database.port":     int64(5432),
+			"database.pool.max": int64(20),
+			"name":              "renamed",
+		} {
+			if value, _ := parser.GetValue(data, keyPath); value != want {
+				t.Errorf("GetValue(%s) = %v, expected %v", keyPath, value, want)
+			}
+		}
+	})
+
+	t.Run("arrays are copied into new keys", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "target.json")
+		if err := os.WriteFile(path, []byte(`{"name": "app"}`), 0644); err != nil {
+			t.Fatalf("Failed to write test file: %v", err)
+		}
+
+		hosts := []any{"a", "b"}
+		parser := New()
+		if err := parser.UpdateFileValues(path, map[string]any{"cluster.hosts": hosts}); err != nil {
+			t.Fatalf("UpdateFileValues() error = %v", err)
+		}
+
+		actual, _ := os.ReadFile(path)
+		if !strings.Contains(string(actual), `"hosts": [`) {
+			t.Errorf("Array not written to target:\n%s", actual)
+		}
+		data, _ := parser.LoadFile(path)
+		if value, _ := parser.GetValue(data, "cluster.hosts[1]"); value != "b" {
+			t.Errorf("GetValue(cluster.hosts[1]) = %v, expected b", value)
+		}
+	})
+}
+
+func TestPreviewFileValuesStructured(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "target.yaml")
+	content := "name: app\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	parser := New()
+	preview, err := parser.PreviewFileValues(path, map[string]any{"database": map[string]any{"host": "x"}})
+	if err != nil {
+		t.Fatalf("PreviewFileValues() error = %v", err)
+	}
+	if !strings.Contains(string(preview), "host: x") {
+		t.Errorf("PreviewFileValues() missing structured value:\n%s", preview)
+	}
+
+	actual, _ := os.ReadFile(path)
+	if string(actual) != content {
+		t.Errorf("PreviewFileValues() modified the file:\n%s", actual)
+	}
+}
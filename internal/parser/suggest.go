@@ -0,0 +1,81 @@
+package parser
+
+import (
+	"sort"
+	"strings"
+)
+
+// SuggestKeyPaths returns up to limit key paths in data close to keyPath,
+// closest first, for when keyPath itself does not exist. Close means a few
+// typos away, or the same final key under a different parent.
+func (p *Parser) SuggestKeyPaths(data map[string]any, keyPath string, limit int) []string {
+	type candidate struct {
+		keyPath  string
+		distance int
+	}
+
+	wanted := strings.ToLower(keyPath)
+	last := lastSegment(wanted)
+	maxDistance := max(2, len(wanted)/3)
+
+	var candidates []candidate
+	for _, existing := range p.GetAllKeys(data, "") {
+		lower := strings.ToLower(existing)
+		distance := editDistance(lower, wanted)
+		if distance > maxDistance && lastSegment(lower) != last {
+			continue
+		}
+		candidates = append(candidates, candidate{existing, distance})
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].distance != candidates[j].distance {
+			return candidates[i].distance < candidates[j].distance
+		}
+		return candidates[i].keyPath < candidates[j].keyPath
+	})
+
+	var suggestions []string
+	for _, c := range candidates {
+		if len(suggestions) == limit {
+			break
+		}
+		suggestions = append(suggestions, c.keyPath)
+	}
+	return suggestions
+}
+
+// lastSegment returns the final key of a key path, without any array index
+func lastSegment(keyPath string) string {
+	segments := splitKeyPath(keyPath)
+	if len(segments) == 0 {
+		return ""
+	}
+	segment := segments[len(segments)-1]
+	if i := strings.Index(segment, "["); i >= 0 {
+		segment = segment[:i]
+	}
+	return segment
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	previous := make([]int, len(br)+1)
+	current := make([]int, len(br)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		current[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(br)]
+}
@@ -0,0 +1,31 @@
+package parser
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSuggestKeyPaths(t *testing.T) {
+	p := New()
+	data := testWildcardData()
+
+	tests := []struct {
+		keyPath  string
+		limit    int
+		expected []string
+	}{
+		{"database.hots", 3, []string{"database.host", "database.port"}},
+		{"Database.Port", 3, []string{"database.port", "database.host", "servers[0].port"}},
+		{"db.host", 3, []string{"database.host", "servers[0].host", "servers[1].host"}},
+		{"db.host", 1, []string{"database.host"}},
+		{"cache.ttl", 3, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.keyPath, func(t *testing.T) {
+			got := p.SuggestKeyPaths(data, tt.keyPath, tt.limit)
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("SuggestKeyPaths(%q) = %v, want %v", tt.keyPath, got, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,173 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TOML lets one line set several keys: dotted keys (server.tls.port = 443)
+// set a key in nested tables, and inline tables
+// (database = { host = "localhost", port = 5432 }) hold keys of their own,
+// as arrays (ports = [80, 443]) hold elements. The line based TOML updater
+// finds each such value by its column span, so that database.port or
+// ports[1] is replaced without touching the rest of the line.
+
+// tomlKeyPath turns a TOML key, which may be dotted and quoted with either
+// kind of quotes, into a key path the way key paths built from files are
+// written
+func tomlKeyPath(key string) string {
+	var segments []string
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch c := key[i]; c {
+		case '"':
+			for i++; i < len(key) && key[i] != '"'; i++ {
+				if key[i] == '\\' && i+1 < len(key) {
+					i++
+				}
+				b.WriteByte(key[i])
+			}
+		case '\'':
+			for i++; i < len(key) && key[i] != '\''; i++ {
+				b.WriteByte(key[i])
+			}
+		case '.':
+			segments = append(segments, quoteKey(b.String()))
+			b.Reset()
+		case ' ', '\t':
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return joinKeyPath(append(segments, quoteKey(b.String())))
+}
+
+// scanTOMLKey reads the key starting at column at of line, up to the = that
+// ends it. It returns the key as written and the column of the =, or -1 if
+// the line holds no key there.
+func scanTOMLKey(line string, at int) (string, int) {
+	var quote byte
+	for i := at; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return strings.TrimSpace(line[at:i]), i
+		case c == '#' || c == '[' || c == '{' || c == ',' || c == '}':
+			return "", -1
+		}
+	}
+	return "", -1
+}
+
+// tomlValueEnd returns the column just past the value starting at column
+// start of line, not counting the comment, separator or whitespace after it.
+// Strings, arrays and inline tables are skipped whole; a value continuing on
+// the next line ends with this one.
+func tomlValueEnd(line string, start int) int {
+	depth := 0
+	end := len(line)
+	var quote byte
+	for i := start; i < len(line) && end == len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == '#', depth == 0 && (c == ']' || c == '}' || c == ','):
+			end = i
+		case c == ']' || c == '}':
+			depth--
+		}
+	}
+	for end > start && (line[end-1] == ' ' || line[end-1] == '\t') {
+		end--
+	}
+	return end
+}
+
+// tomlInlineValues finds the keys of the inline table or the elements of the
+// array in context's value, and those of any inline tables and arrays nested
+// within it
+func tomlInlineValues(line string, context tomlLineContext) []tomlLineContext {
+	if context.valueStart >= context.valueEnd {
+		return nil
+	}
+	if line[context.valueStart] == '[' {
+		return tomlArrayValues(line, context)
+	}
+	if line[context.valueStart] != '{' {
+		return nil
+	}
+
+	var values []tomlLineContext
+	at := context.valueStart + 1
+	for at < context.valueEnd {
+		key, eq := scanTOMLKey(line, at)
+		if eq < 0 || key == "" {
+			break
+		}
+		start := eq + 1
+		for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+			start++
+		}
+		end := tomlValueEnd(line, start)
+
+		value := context
+		value.key = key
+		value.fullPath = context.fullPath + "." + tomlKeyPath(key)
+		value.valueStart, value.valueEnd = start, end
+		values = append(values, value)
+		values = append(values, tomlInlineValues(line, value)...)
+
+		// Move past the separator to the next key
+		at = end
+		for at < context.valueEnd && line[at] != ',' {
+			at++
+		}
+		at++
+	}
+	return values
+}
+
+// tomlArrayValues finds the elements of the single line array in context's
+// value, like tomlInlineValues
+func tomlArrayValues(line string, context tomlLineContext) []tomlLineContext {
+	var values []tomlLineContext
+	at := context.valueStart + 1
+	for index := 0; at < context.valueEnd; index++ {
+		for at < context.valueEnd && (line[at] == ' ' || line[at] == '\t') {
+			at++
+		}
+		if at >= context.valueEnd || line[at] == ']' || line[at] == '#' {
+			break
+		}
+		end := tomlValueEnd(line, at)
+
+		value := context
+		value.fullPath = fmt.Sprintf("%s[%d]", context.fullPath, index)
+		value.valueStart, value.valueEnd = at, end
+		values = append(values, value)
+		values = append(values, tomlInlineValues(line, value)...)
+
+		// Move past the separator to the next element
+		at = end
+		for at < context.valueEnd && line[at] != ',' {
+			at++
+		}
+		at++
+	}
+	return values
+}
@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTOMLKeyPath(t *testing.T) {
+	tests := []struct {
+		key      string
+		expected string
+	}{
+		{"port", "port"},
+		{"server.tls.port", "server.tls.port"},
+		{"server . port", "server.port"},
+		{`hosts."example.com".port`, `hosts."example.com".port`},
+		{`'C:\path'.name`, `"C:\\path".name`},
+		{`"quoted \"key\""`, `"quoted \"key\""`},
+	}
+	for _, tt := range tests {
+		if got := tomlKeyPath(tt.key); got != tt.expected {
+			t.Errorf("tomlKeyPath(%s) = %s, want %s", tt.key, got, tt.expected)
+		}
+	}
+}
+
+func TestUpdateFileValuesTOMLInline(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		updates  map[string]any
+		expected string
+	}{
+		{
+			name:     "inline table",
+			content:  "database = { host = \"localhost\", port = 5432 } # primary\nname = \"app\"\n",
+			updates:  map[string]any{"database.host": "db.internal", "database.port": 6432},
+			expected: "database = { host = \"db.internal\", port = 6432 } # primary\nname = \"app\"\n",
+		},
+		{
+			name:     "nested inline table",
+			content:  "[server]\ntls = { cert = { path = \"a.pem\", mode = \"0600\" }, enabled = false }\n",
+			updates:  map[string]any{"server.tls.cert.path": "b.pem", "server.tls.enabled": true},
+			expected: "[server]\ntls = { cert = { path = \"b.pem\", mode = \"0600\" }, enabled = true }\n",
+		},
+		{
+			name:     "inline table strings",
+			content:  "labels = { team = \"a, b }\", tier = \"web\" }\n",
+			updates:  map[string]any{"labels.tier": "api"},
+			expected: "labels = { team = \"a, b }\", tier = \"api\" }\n",
+		},
+		{
+			name:     "dotted keys",
+			content:  "[server]\ntls.port = 443 # https\ntls.\"cert.path\" = \"a.pem\"\n",
+			updates:  map[string]any{"server.tls.port": 8443, `server.tls."cert.path"`: "b.pem"},
+			expected: "[server]\ntls.port = 8443 # https\ntls.\"cert.path\" = \"b.pem\"\n",
+		},
+		{
+			name:     "no spaces",
+			content:  "timeout=30\nretries=3\n",
+			updates:  map[string]any{"retries": 5},
+			expected: "timeout=30\nretries=5\n",
+		},
+		{
+			name:     "array in inline table",
+			content:  "cluster = { hosts = [\"a\", \"b\"], size = 2 }\n",
+			updates:  map[string]any{"cluster.hosts[+]": "c", "cluster.size": 3},
+			expected: "cluster = { hosts = [\"a\", \"b\", \"c\"], size = 3 }\n",
+		},
+		{
+			name:     "array elements",
+			content:  "ports = [80, 443] # public\nendpoints = [{ host = \"a\" }, { host = \"b\" }]\n",
+			updates:  map[string]any{"ports[1]": 8443, "endpoints[1].host": "c"},
+			expected: "ports = [80, 8443] # public\nendpoints = [{ host = \"a\" }, { host = \"c\" }]\n",
+		},
+		{
+			name:     "nested table arrays",
+			content:  "[[servers]]\nname = \"a\"\n[[servers.ports]]\nport = 80\n[[servers.ports]]\nport = 443\n[[servers]]\nname = \"b\"\n[[servers.ports]]\nport = 8080\n",
+			updates:  map[string]any{"servers[0].ports[1].port": 8443, "servers[1].ports[0].port": 9090},
+			expected: "[[servers]]\nname = \"a\"\n[[servers.ports]]\nport = 80\n[[servers.ports]]\nport = 8443\n[[servers]]\nname = \"b\"\n[[servers.ports]]\nport = 9090\n",
+		},
+	}
+
+	p := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "config.toml")
+			if err := os.WriteFile(filePath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if err := p.UpdateFileValues(filePath, tt.updates); err != nil {
+				t.Fatalf("UpdateFileValues() returned error: %v", err)
+			}
+
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("UpdateFileValues() wrote:\n%s\nwant:\n%s", content, tt.expected)
+			}
+		})
+	}
+}
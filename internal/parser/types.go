@@ -0,0 +1,283 @@
+package parser
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"var-sync/pkg/models"
+)
+
+// Values parsed from every format are normalized to the same Go types, so
+// that a value keeps its type when synced from one format to another: int64
+// for integers, float64 for other numbers, bool, string, nil, []any and
+// map[string]any. Numbers are written back so that each format reads them as
+// the same type again.
+
+// NormalizeValue converts a parsed value, and the values nested in it, to
+// the normalized types. JSON numbers decoded as json.Number are integers
+// unless written with a fraction or exponent.
+func NormalizeValue(value any) any {
+	switch v := value.(type) {
+	case json.Number:
+		if !strings.ContainsAny(v.String(), ".eE") {
+			if i, err := v.Int64(); err == nil {
+				return i
+			}
+		}
+		f, _ := v.Float64()
+		return f
+	case int:
+		return int64(v)
+	case int8:
+		return int64(v)
+	case int16:
+		return int64(v)
+	case int32:
+		return int64(v)
+	case uint:
+		return normalizeUint(uint64(v))
+	case uint8:
+		return int64(v)
+	case uint16:
+		return int64(v)
+	case uint32:
+		return int64(v)
+	case uint64:
+		return normalizeUint(v)
+	case float32:
+		return float64(v)
+	case map[string]any:
+		for key, item := range v {
+			v[key] = NormalizeValue(item)
+		}
+		return v
+	case map[any]any:
+		return NormalizeValue(convertMapInterface(v))
+	case []any:
+		for i, item := range v {
+			v[i] = NormalizeValue(item)
+		}
+		return v
+	}
+	return value
+}
+
+// normalizeUint keeps unsigned integers too large for int64 as floats
+func normalizeUint(v uint64) any {
+	if v > math.MaxInt64 {
+		return float64(v)
+	}
+	return int64(v)
+}
+
+// formatNumber writes a number so that every format reads it back as the
+// same type: floats always have a fraction or an exponent. It reports false
+// for values that are not numbers.
+func formatNumber(value any) (string, bool) {
+	switch v := NormalizeValue(value).(type) {
+	case int64:
+		return strconv.FormatInt(v, 10), true
+	case float64:
+		if math.IsInf(v, 0) || math.IsNaN(v) {
+			return strconv.FormatFloat(v, 'g', -1, 64), true
+		}
+		formatted := strconv.FormatFloat(v, 'g', -1, 64)
+		if abs := math.Abs(v); abs >= 1e-4 && abs < 1e21 {
+			formatted = strconv.FormatFloat(v, 'f', -1, 64)
+		}
+		if !strings.ContainsAny(formatted, ".e") {
+			formatted += ".0"
+		}
+		return formatted, true
+	}
+	return "", false
+}
+
+// formatScalar writes a value that is not a string for a text format: numbers
+// as formatNumber does, null as empty, and anything else as Go prints it
+func formatScalar(value any) string {
+	if formatted, ok := formatNumber(value); ok {
+		return formatted
+	}
+	if value == nil {
+		return ""
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+// jsonNumbers prepares a value for encoding as JSON, keeping whole floats
+// written as floats, such as 5.0, which the encoder would write as 5
+func jsonNumbers(value any) any {
+	switch v := value.(type) {
+	case float64:
+		if formatted, ok := formatNumber(v); ok && v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return json.Number(formatted)
+		}
+	case float32:
+		return jsonNumbers(float64(v))
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[key] = jsonNumbers(item)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = jsonNumbers(item)
+		}
+		return result
+	}
+	return value
+}
+
+// yamlNumbers prepares a value for encoding as YAML, like jsonNumbers, as the
+// encoder writes whole floats such as 5.0 as 5 too
+func yamlNumbers(value any) any {
+	switch v := value.(type) {
+	case float64:
+		if formatted, ok := formatNumber(v); ok && v == math.Trunc(v) && !math.IsInf(v, 0) {
+			return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!float", Value: formatted}
+		}
+	case float32:
+		return yamlNumbers(float64(v))
+	case map[string]any:
+		result := make(map[string]any, len(v))
+		for key, item := range v {
+			result[key] = yamlNumbers(item)
+		}
+		return result
+	case []any:
+		result := make([]any, len(v))
+		for i, item := range v {
+			result[i] = yamlNumbers(item)
+		}
+		return result
+	}
+	return value
+}
+
+// ConvertValue converts a value to the given type, such as a string read
+// from a .env file to the int a JSON target expects. An empty type leaves the
+// value as it is.
+func ConvertValue(value any, valueType models.ValueType) (any, error) {
+	value = NormalizeValue(value)
+
+	switch valueType {
+	case "":
+		return value, nil
+	case models.TypeString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case map[string]any, []any:
+			encoded, err := json.Marshal(jsonNumbers(v))
+			if err != nil {
+				return nil, fmt.Errorf("cannot convert %v to string: %w", v, err)
+			}
+			return string(encoded), nil
+		}
+		return formatScalar(value), nil
+	case models.TypeInt:
+		switch v := value.(type) {
+		case int64:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) <= math.MaxInt64 {
+				return int64(v), nil
+			}
+		case string:
+			if parsed, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid int %q", formatScalar(value))
+	case models.TypeFloat:
+		switch v := value.(type) {
+		case int64:
+			return float64(v), nil
+		case float64:
+			return v, nil
+		case string:
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid float %q", formatScalar(value))
+	case models.TypeBool:
+		switch v := value.(type) {
+		case bool:
+			return v, nil
+		case int64:
+			if v == 0 || v == 1 {
+				return v == 1, nil
+			}
+		case string:
+			if parsed, err := strconv.ParseBool(strings.TrimSpace(v)); err == nil {
+				return parsed, nil
+			}
+		}
+		return nil, fmt.Errorf("invalid bool %q", formatScalar(value))
+	case models.TypeJSON:
+		s, ok := value.(string)
+		if !ok {
+			return value, nil
+		}
+		decoder := json.NewDecoder(strings.NewReader(s))
+		decoder.UseNumber()
+		var parsed any
+		if err := decoder.Decode(&parsed); err != nil {
+			return nil, fmt.Errorf("invalid JSON value: %w", err)
+		}
+		return NormalizeValue(parsed), nil
+	}
+	return nil, fmt.Errorf("unknown type %q: use string, int, float, bool or json", valueType)
+}
+
+// RuleApplies reports whether a rule's when condition holds for its source
+// document. A rule without one always applies.
+func (p *Parser) RuleApplies(sourceData map[string]any, rule models.SyncRule) (bool, error) {
+	if rule.When == "" {
+		return true, nil
+	}
+	return p.EvaluateCondition(sourceData, rule.When)
+}
+
+// ResolveRule returns the values a rule writes to its target keys, converted
+// to the rule's target type, as ResolveKeyPaths does for its key paths, or
+// the value of its source expression for its target key. A rule with
+// delete_missing whose source key was removed removes its target key, with
+// the value Deleted; wildcard rules have no single key to remove.
+func (p *Parser) ResolveRule(sourceData map[string]any, rule models.SyncRule) (map[string]any, error) {
+	var updates map[string]any
+	var err error
+	if rule.SourceExpr != "" {
+		var value any
+		if value, err = p.EvaluateExpression(sourceData, rule.SourceExpr); err == nil {
+			updates = map[string]any{rule.TargetKey: value}
+		}
+	} else {
+		updates, err = p.ResolveKeyPaths(sourceData, rule.SourceKey, rule.TargetKey)
+	}
+	if err != nil && rule.DeleteMissing && errors.Is(err, ErrKeyNotFound) && !HasWildcard(rule.SourceKey) {
+		return map[string]any{rule.TargetKey: Deleted}, nil
+	}
+	if err != nil || rule.TargetType == "" {
+		return updates, err
+	}
+
+	for targetKey, value := range updates {
+		converted, err := ConvertValue(value, rule.TargetType)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert %s to %s: %w", targetKey, rule.TargetType, err)
+		}
+		updates[targetKey] = converted
+	}
+	return updates, nil
+}
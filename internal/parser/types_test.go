@@ -0,0 +1,206 @@
+package parser
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"var-sync/pkg/models"
+)
+
+func TestNormalizeValue(t *testing.T) {
+	p := New()
+	files := map[string]string{
+		"config.json": `{"port": 5432, "ratio": 0.5, "whole": 2.0, "on": true, "none": null}`,
+		"config.yaml": "port: 5432\nratio: 0.5\nwhole: 2.0\non: true\nnone: null\n",
+		"config.toml": "port = 5432\nratio = 0.5\nwhole = 2.0\non = true\n",
+	}
+	for name, content := range files {
+		filePath := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		data, err := p.LoadFile(filePath)
+		if err != nil {
+			t.Fatalf("LoadFile(%s) returned error: %v", name, err)
+		}
+		for key, want := range map[string]any{"port": int64(5432), "ratio": 0.5, "whole": 2.0, "on": true} {
+			if got := data[key]; got != want {
+				t.Errorf("%s: %s = %#v, want %#v", name, key, got, want)
+			}
+		}
+	}
+}
+
+func TestFormatNumber(t *testing.T) {
+	tests := map[any]string{
+		5432:         "5432",
+		int64(-1):    "-1",
+		uint8(7):     "7",
+		0.5:          "0.5",
+		2.0:          "2.0",
+		float32(1.5): "1.5",
+		1e21:         "1e+21",
+		123456789.0:  "123456789.0",
+	}
+	for value, want := range tests {
+		if got, ok := formatNumber(value); !ok || got != want {
+			t.Errorf("formatNumber(%#v) = %q, %t, want %q", value, got, ok, want)
+		}
+	}
+	if _, ok := formatNumber("5"); ok {
+		t.Error("formatNumber should not format a string")
+	}
+}
+
+func TestConvertValue(t *testing.T) {
+	tests := []struct {
+		value     any
+		valueType models.ValueType
+		expected  any
+	}{
+		{5432, "", int64(5432)},
+		{5432, models.TypeString, "5432"},
+		{2.0, models.TypeString, "2.0"},
+		{map[string]any{"a": 1}, models.TypeString, `{"a":1}`},
+		{"5432", models.TypeInt, int64(5432)},
+		{3.0, models.TypeInt, int64(3)},
+		{"0.5", models.TypeFloat, 0.5},
+		{int64(2), models.TypeFloat, 2.0},
+		{"true", models.TypeBool, true},
+		{int64(0), models.TypeBool, false},
+		{`{"port": 80}`, models.TypeJSON, map[string]any{"port": int64(80)}},
+	}
+	for _, tt := range tests {
+		got, err := ConvertValue(tt.value, tt.valueType)
+		if err != nil {
+			t.Errorf("ConvertValue(%#v, %s) returned error: %v", tt.value, tt.valueType, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ConvertValue(%#v, %s) = %#v, want %#v", tt.value, tt.valueType, got, tt.expected)
+		}
+	}
+
+	for _, tt := range []struct {
+		value     any
+		valueType models.ValueType
+	}{
+		{"abc", models.TypeInt},
+		{2.5, models.TypeInt},
+		{"abc", models.TypeFloat},
+		{"maybe", models.TypeBool},
+		{"{", models.TypeJSON},
+		{"x", "date"},
+	} {
+		if _, err := ConvertValue(tt.value, tt.valueType); err == nil {
+			t.Errorf("ConvertValue(%#v, %s) should fail", tt.value, tt.valueType)
+		}
+	}
+}
+
+func TestWriteKeepsTypes(t *testing.T) {
+	p := New()
+	updates := map[string]any{"port": int64(5432), "ratio": 2.0, "name": "true", "none": nil}
+	tests := map[string][]string{
+		"config.json":       {`"port": 5432`, `"ratio": 2.0`, `"name": "true"`, `"none": null`},
+		"config.yaml":       {"port: 5432", "ratio: 2.0", `name: "true"`, "none: null"},
+		"config.toml":       {"port = 5432", "ratio = 2.0", `name = "true"`},
+		"config.properties": {"port=5432", "ratio=2.0", "name=true", "none="},
+	}
+	initial := map[string]string{
+		"config.json":       `{"port": 1, "ratio": 1.5, "name": "x", "none": 1}`,
+		"config.yaml":       "port: 1\nratio: 1.5\nname: x\nnone: 1\n",
+		"config.toml":       "port = 1\nratio = 1.5\nname = \"x\"\n",
+		"config.properties": "port=1\nratio=1.5\nname=x\nnone=1\n",
+	}
+	for name, wants := range tests {
+		filePath := filepath.Join(t.TempDir(), name)
+		if err := os.WriteFile(filePath, []byte(initial[name]), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		fileUpdates := make(map[string]any)
+		for key, value := range updates {
+			if value == nil && name == "config.toml" {
+				continue
+			}
+			fileUpdates[key] = value
+		}
+		if err := p.UpdateFileValues(filePath, fileUpdates); err != nil {
+			t.Fatalf("UpdateFileValues(%s) returned error: %v", name, err)
+		}
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			t.Fatalf("Failed to read %s: %v", name, err)
+		}
+		for _, want := range wants {
+			if !strings.Contains(string(content), want) {
+				t.Errorf("%s is missing %s:\n%s", name, want, content)
+			}
+		}
+	}
+}
+
+func TestFormatTOMLValueRoundTrip(t *testing.T) {
+	var decoded map[string]any
+	if _, err := toml.Decode(`
+offset = 1979-05-27T07:32:00.5-07:00
+local = 1979-05-27T07:32:00
+date = 1979-05-27
+clock = 07:32:00.999
+`, &decoded); err != nil {
+		t.Fatalf("Failed to decode datetimes: %v", err)
+	}
+
+	values := map[string]any{
+		"offset":    decoded["offset"],
+		"local":     decoded["local"],
+		"date":      decoded["date"],
+		"clock":     decoded["clock"],
+		"utc":       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		"exponent":  1.5e300,
+		"small":     2.5e-10,
+		"whole":     3.0,
+		"infinity":  math.Inf(-1),
+		"integer":   int64(-42),
+		"escapes":   "tab\there \"quoted\" C:\\path\nnext\x01",
+		"unicode":   "héllo ✓",
+		"hosts":     []any{"a", "b"},
+		"ports":     []any{int64(80), int64(443)},
+		"nested":    []any{[]any{int64(1), int64(2)}, []any{"x"}},
+		"mixed":     []any{true, 1.5, "s"},
+		"empty":     []any{},
+		"endpoints": []any{map[string]any{"host": "a", "port": int64(80)}},
+	}
+	for key, value := range values {
+		content := "value = " + formatTOMLValue(value) + "\n"
+		var read map[string]any
+		if _, err := toml.Decode(content, &read); err != nil {
+			t.Errorf("%s: %q does not decode: %v", key, content, err)
+			continue
+		}
+		got := read["value"]
+		if want, ok := value.(time.Time); ok {
+			if gotTime, ok := got.(time.Time); !ok || !gotTime.Equal(want) || gotTime.Location().String() != want.Location().String() {
+				t.Errorf("%s: %q decodes to %v, want %v", key, content, got, want)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(NormalizeValue(got), value) {
+			t.Errorf("%s: %q decodes to %#v, want %#v", key, content, got, value)
+		}
+	}
+
+	var read map[string]any
+	if _, err := toml.Decode("value = "+formatTOMLValue(math.NaN()), &read); err != nil {
+		t.Errorf("NaN does not decode: %v", err)
+	} else if f, ok := read["value"].(float64); !ok || !math.IsNaN(f) {
+		t.Errorf("NaN decodes to %v", read["value"])
+	}
+}
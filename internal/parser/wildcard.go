@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// HasWildcard reports whether a key path contains a `*` segment or a `[*]`
+// array index
+func HasWildcard(keyPath string) bool {
+	for _, segment := range splitKeyPath(keyPath) {
+		if isWildcardSegment(segment) {
+			return true
+		}
+	}
+	return false
+}
+
+// isWildcardSegment reports whether a single key path segment is a wildcard
+func isWildcardSegment(segment string) bool {
+	return segment == "*" || strings.HasSuffix(segment, "[*]")
+}
+
+// ExpandKeyPath returns the concrete leaf key paths in data matching a
+// wildcard pattern, sorted. A `*` segment matches any single key and `[*]`
+// matches any array index; a wildcard in the final segment also matches
+// everything below it, so `database.*` covers the entire database subtree.
+func (p *Parser) ExpandKeyPath(data map[string]any, pattern string) []string {
+	var matches []string
+	for _, keyPath := range p.GetAllKeys(data, "") {
+		if _, _, ok := matchKeyPath(pattern, keyPath); ok {
+			matches = append(matches, keyPath)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// matchKeyPath matches a concrete key path against a wildcard pattern. It
+// returns the key or index matched by each wildcard and, when the final
+// pattern segment is a wildcard, the remaining segments below it.
+func matchKeyPath(pattern, keyPath string) (captures []string, suffix []string, ok bool) {
+	patternSegments := splitKeyPath(pattern)
+	keySegments := splitKeyPath(keyPath)
+
+	for i, patternSegment := range patternSegments {
+		if i >= len(keySegments) {
+			return nil, nil, false
+		}
+		keySegment := keySegments[i]
+		last := i == len(patternSegments)-1
+
+		switch {
+		case patternSegment == "*":
+			captures = append(captures, keySegment)
+		case strings.HasSuffix(patternSegment, "[*]"):
+			name, index, err := parseKeySegment(keySegment)
+			if patternName, _ := cutKeyName(patternSegment); err != nil || index < 0 || name != patternName {
+				return nil, nil, false
+			}
+			captures = append(captures, fmt.Sprintf("%d", index))
+		default:
+			if canonicalSegment(patternSegment) != keySegment {
+				return nil, nil, false
+			}
+			if last && len(keySegments) > len(patternSegments) {
+				return nil, nil, false
+			}
+			continue
+		}
+
+		if last {
+			suffix = keySegments[i+1:]
+		}
+	}
+
+	return captures, suffix, true
+}
+
+// substituteWildcards fills the wildcards in a target pattern with captures
+// from a matched source key path, appending any suffix below a trailing
+// wildcard
+func substituteWildcards(pattern string, captures []string, suffix []string) (string, error) {
+	segments := splitKeyPath(pattern)
+	next := 0
+
+	for i, segment := range segments {
+		if !isWildcardSegment(segment) {
+			continue
+		}
+		if next >= len(captures) {
+			return "", fmt.Errorf("target key %s has more wildcards than the source key", pattern)
+		}
+		if segment == "*" {
+			segments[i] = captures[next]
+		} else {
+			segments[i] = strings.TrimSuffix(segment, "*]") + captures[next] + "]"
+		}
+		next++
+	}
+
+	if next != len(captures) {
+		return "", fmt.Errorf("target key %s has %d wildcards, source key has %d", pattern, next, len(captures))
+	}
+
+	return joinKeyPath(append(segments, suffix...)), nil
+}
+
+// joinKeyPath joins key path segments, writing attribute segments as element@attr
+func joinKeyPath(segments []string) string {
+	var b strings.Builder
+	for i, segment := range segments {
+		if i > 0 && !strings.HasPrefix(segment, "@") {
+			b.WriteByte('.')
+		}
+		b.WriteString(segment)
+	}
+	return b.String()
+}
+
+// ResolveKeyPaths reads sourceKey from sourceData and returns the updates to
+// apply to the target, keyed by target key path. For wildcard rules every
+// matched source key is mapped onto targetKey by substituting the matched
+// keys and indices in order, so servers[*].host -> hosts[*] yields
+// hosts[0], hosts[1] and so on. A JSONPath source key is first resolved to
+// the key path it selects.
+func (p *Parser) ResolveKeyPaths(sourceData map[string]any, sourceKey, targetKey string) (map[string]any, error) {
+	if IsJSONPath(sourceKey) {
+		resolved, err := p.resolveJSONPath(sourceData, sourceKey)
+		if err != nil {
+			return nil, err
+		}
+		sourceKey = resolved
+	}
+	if !HasWildcard(sourceKey) {
+		if HasWildcard(targetKey) {
+			return nil, fmt.Errorf("target key %s has wildcards but source key %s does not", targetKey, sourceKey)
+		}
+		value, err := p.GetValue(sourceData, sourceKey)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{targetKey: value}, nil
+	}
+
+	matches := p.ExpandKeyPath(sourceData, sourceKey)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no keys match %s", sourceKey)
+	}
+
+	updates := make(map[string]any, len(matches))
+	for _, keyPath := range matches {
+		captures, suffix, _ := matchKeyPath(sourceKey, keyPath)
+		target, err := substituteWildcards(targetKey, captures, suffix)
+		if err != nil {
+			return nil, err
+		}
+		value, err := p.GetValue(sourceData, keyPath)
+		if err != nil {
+			return nil, err
+		}
+		updates[target] = value
+	}
+
+	return updates, nil
+}
@@ -0,0 +1,217 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func testWildcardData() map[string]any {
+	return map[string]any{
+		"database": map[string]any{
+			"host": "localhost",
+			"port": 5432,
+			"pool": map[string]any{"max": 10},
+		},
+		"servers": []any{
+			map[string]any{"host": "alpha", "port": 80},
+			map[string]any{"host": "beta", "port": 81},
+		},
+		"name": "app",
+	}
+}
+
+func TestHasWildcard(t *testing.T) {
+	tests := []struct {
+		keyPath  string
+		expected bool
+	}{
+		{"database.host", false},
+		{"servers[0].host", false},
+		{"database.*", true},
+		{"servers[*].host", true},
+		{"*.host", true},
+		{"config.server@*", false},
+	}
+
+	for _, tt := range tests {
+		if got := HasWildcard(tt.keyPath); got != tt.expected {
+			t.Errorf("HasWildcard(%s) = %t, expected %t", tt.keyPath, got, tt.expected)
+		}
+	}
+}
+
+func TestExpandKeyPath(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		expected []string
+	}{
+		{"database.*", []string{"database.host", "database.pool.max", "database.port"}},
+		{"servers[*].host", []string{"servers[0].host", "servers[1].host"}},
+		{"servers[*]", []string{"servers[0].host", "servers[0].port", "servers[1].host", "servers[1].port"}},
+		{"*.host", []string{"database.host", "servers[0].host", "servers[1].host"}},
+		{"missing.*", nil},
+	}
+
+	parser := New()
+	data := testWildcardData()
+	for _, tt := range tests {
+		if got := parser.ExpandKeyPath(data, tt.pattern); !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("ExpandKeyPath(%s) = %v, expected %v", tt.pattern, got, tt.expected)
+		}
+	}
+}
+
+func TestGetValueWildcard(t *testing.T) {
+	parser := New()
+	value, err := parser.GetValue(testWildcardData(), "servers[*].host")
+	if err != nil {
+		t.Fatalf("GetValue() error = %v", err)
+	}
+
+	expected := map[string]any{"servers[0].host": "alpha", "servers[1].host": "beta"}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("GetValue(servers[*].host) = %v, expected %v", value, expected)
+	}
+
+	// A trailing wildcard reads the whole subtree, without ResolveKeyPaths
+	value, err = parser.GetValue(testWildcardData(), "database.*")
+	if err != nil {
+		t.Fatalf("GetValue() error = %v", err)
+	}
+	expected = map[string]any{"database.host": "localhost", "database.port": 5432, "database.pool.max": 10}
+	if !reflect.DeepEqual(value, expected) {
+		t.Errorf("GetValue(database.*) = %v, expected %v", value, expected)
+	}
+
+	if _, err := parser.GetValue(testWildcardData(), "missing[*]"); err == nil {
+		t.Error("GetValue() expected error for wildcard without matches")
+	}
+}
+
+func TestSetValueWildcard(t *testing.T) {
+	parser := New()
+	data := testWildcardData()
+	if err := parser.SetValue(data, "servers[*].port", 443); err != nil {
+		t.Fatalf("SetValue() error = %v", err)
+	}
+
+	for _, keyPath := range []string{"servers[0].port", "servers[1].port"} {
+		if value, _ := parser.GetValue(data, keyPath); value != 443 {
+			t.Errorf("GetValue(%s) = %v, expected 443", keyPath, value)
+		}
+	}
+	if value, _ := parser.GetValue(data, "servers[0].host"); value != "alpha" {
+		t.Errorf("SetValue() changed unrelated key, got %v", value)
+	}
+
+	if err := parser.SetValue(data, "database.*", "redacted"); err != nil {
+		t.Fatalf("SetValue() error = %v", err)
+	}
+	for _, keyPath := range []string{"database.host", "database.port", "database.pool.max"} {
+		if value, _ := parser.GetValue(data, keyPath); value != "redacted" {
+			t.Errorf("GetValue(%s) = %v, expected redacted", keyPath, value)
+		}
+	}
+	if err := parser.SetValue(data, "missing.*", 1); err == nil {
+		t.Error("SetValue() expected error for wildcard without matches")
+	}
+}
+
+func TestResolveKeyPaths(t *testing.T) {
+	tests := []struct {
+		name      string
+		sourceKey string
+		targetKey string
+		expected  map[string]any
+		wantErr   bool
+	}{
+		{
+			name:      "plain key",
+			sourceKey: "name",
+			targetKey: "app.name",
+			expected:  map[string]any{"app.name": "app"},
+		},
+		{
+			name:      "subtree",
+			sourceKey: "database.*",
+			targetKey: "db.*",
+			expected:  map[string]any{"db.host": "localhost", "db.port": 5432, "db.pool.max": 10},
+		},
+		{
+			name:      "array elements",
+			sourceKey: "servers[*].host",
+			targetKey: "hosts[*]",
+			expected:  map[string]any{"hosts[0]": "alpha", "hosts[1]": "beta"},
+		},
+		{
+			name:      "array index into keys",
+			sourceKey: "servers[*].host",
+			targetKey: "backends.*.address",
+			expected:  map[string]any{"backends.0.address": "alpha", "backends.1.address": "beta"},
+		},
+		{
+			name:      "wildcard count mismatch",
+			sourceKey: "servers[*].host",
+			targetKey: "hosts",
+			wantErr:   true,
+		},
+		{
+			name:      "wildcard only in target",
+			sourceKey: "name",
+			targetKey: "names[*]",
+			wantErr:   true,
+		},
+	}
+
+	parser := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parser.ResolveKeyPaths(testWildcardData(), tt.sourceKey, tt.targetKey)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ResolveKeyPaths() expected error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolveKeyPaths() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("ResolveKeyPaths() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUpdateFileValuesFromWildcardRule(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "target.yaml")
+	content := `# upstream hosts
+upstreams:
+  - address: old-a
+  - address: old-b
+`
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	parser := New()
+	updates, err := parser.ResolveKeyPaths(testWildcardData(), "servers[*].host", "upstreams[*].address")
+	if err != nil {
+		t.Fatalf("ResolveKeyPaths() error = %v", err)
+	}
+	if err := parser.UpdateFileValues(path, updates); err != nil {
+		t.Fatalf("UpdateFileValues() error = %v", err)
+	}
+
+	actual, _ := os.ReadFile(path)
+	expected := `# upstream hosts
+upstreams:
+  - address: alpha
+  - address: beta
+`
+	if string(actual) != expected {
+		t.Errorf("UpdateFileValues() result:\n%s\nExpected:\n%s", actual, expected)
+	}
+}
@@ -0,0 +1,427 @@
+package parser
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"var-sync/internal/textfile"
+)
+
+// xmlNode is an element in an XML document together with the byte offsets
+// needed to surgically rewrite its text and attribute values
+type xmlNode struct {
+	name     string
+	attrs    []xmlAttr
+	children []*xmlNode
+	text     string
+
+	startTagStart int // Offset of '<' of the start tag
+	startTagEnd   int // Offset just past '>' of the start tag
+	endTagStart   int // Offset of '<' of the end tag
+	selfClosing   bool
+}
+
+// xmlAttr is an attribute with the offsets of its value (excluding quotes)
+type xmlAttr struct {
+	name       string
+	value      string
+	valueStart int
+	valueEnd   int
+}
+
+// parseXMLTree reads XML content into a tree of nodes and returns the root
+func parseXMLTree(content []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(content))
+	var root *xmlNode
+	var stack []*xmlNode
+
+	for {
+		tokenStart := int(decoder.InputOffset())
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokenEnd := int(decoder.InputOffset())
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			raw := content[tokenStart:tokenEnd]
+			node := &xmlNode{
+				name:          xmlName(t.Name),
+				startTagStart: tokenStart,
+				startTagEnd:   tokenEnd,
+				endTagStart:   -1,
+				selfClosing:   bytes.HasSuffix(raw, []byte("/>")),
+			}
+			node.attrs = locateXMLAttrs(raw, tokenStart, t.Attr)
+
+			if len(stack) > 0 {
+				parent := stack[len(stack)-1]
+				parent.children = append(parent.children, node)
+			} else if root != nil {
+				return nil, fmt.Errorf("multiple root elements")
+			} else {
+				root = node
+			}
+			stack = append(stack, node)
+
+		case xml.EndElement:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unexpected end element </%s>", xmlName(t.Name))
+			}
+			node := stack[len(stack)-1]
+			if node.name != xmlName(t.Name) {
+				return nil, fmt.Errorf("element <%s> closed by </%s>", node.name, xmlName(t.Name))
+			}
+			if node.selfClosing {
+				node.endTagStart = node.startTagEnd
+			} else {
+				node.endTagStart = tokenStart
+			}
+			stack = stack[:len(stack)-1]
+
+		case xml.CharData:
+			if len(stack) > 0 {
+				stack[len(stack)-1].text += string(t)
+			}
+		}
+	}
+
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("unclosed element <%s>", stack[len(stack)-1].name)
+	}
+	if root == nil {
+		return nil, fmt.Errorf("no root element found")
+	}
+
+	return root, nil
+}
+
+// xmlName formats an element or attribute name including its prefix
+func xmlName(name xml.Name) string {
+	if name.Space != "" {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+// locateXMLAttrs finds the value offsets of each attribute in a raw start tag
+func locateXMLAttrs(raw []byte, offset int, attrs []xml.Attr) []xmlAttr {
+	result := make([]xmlAttr, 0, len(attrs))
+	searchFrom := 0
+
+	for _, attr := range attrs {
+		name := xmlName(attr.Name)
+		pattern := regexp.MustCompile(`\s` + regexp.QuoteMeta(name) + `\s*=\s*(["'])`)
+		loc := pattern.FindIndex(raw[searchFrom:])
+		if loc == nil {
+			continue
+		}
+
+		quote := raw[searchFrom+loc[1]-1]
+		valueStart := searchFrom + loc[1]
+		valueEnd := valueStart + bytes.IndexByte(raw[valueStart:], quote)
+		result = append(result, xmlAttr{
+			name:       name,
+			value:      attr.Value,
+			valueStart: offset + valueStart,
+			valueEnd:   offset + valueEnd,
+		})
+		searchFrom = valueEnd + 1
+	}
+
+	return result
+}
+
+// parseXMLFile parses XML content into a map[string]any keyed by the root
+// element name. Leaf elements become typed values, attributes are stored as
+// "@name" keys, repeated elements become arrays and text alongside child
+// elements or attributes is stored under "#text".
+func (p *Parser) parseXMLFile(content []byte) (map[string]any, error) {
+	root, err := parseXMLTree(content)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{root.name: xmlNodeValue(root)}, nil
+}
+
+// xmlNodeValue converts a node into its map or primitive representation
+func xmlNodeValue(node *xmlNode) any {
+	text := strings.TrimSpace(node.text)
+	if len(node.attrs) == 0 && len(node.children) == 0 {
+		return parseXMLValue(text)
+	}
+
+	result := make(map[string]any)
+	for _, attr := range node.attrs {
+		result["@"+attr.name] = parseXMLValue(attr.value)
+	}
+	for _, child := range node.children {
+		value := xmlNodeValue(child)
+		switch existing := result[child.name].(type) {
+		case nil:
+			result[child.name] = value
+		case xmlRepeated:
+			result[child.name] = append(existing, value)
+		default:
+			result[child.name] = xmlRepeated{existing, value}
+		}
+	}
+	if text != "" {
+		result["#text"] = parseXMLValue(text)
+	}
+
+	// Repeated elements are collected separately so that a single element
+	// whose value happens to be an array is not confused with a repetition
+	for key, value := range result {
+		if repeated, ok := value.(xmlRepeated); ok {
+			result[key] = []any(repeated)
+		}
+	}
+
+	return result
+}
+
+// xmlRepeated collects the values of sibling elements sharing a name
+type xmlRepeated []any
+
+// parseXMLValue converts element text or an attribute value into a typed value
+func parseXMLValue(value string) any {
+	if value == "true" || value == "false" {
+		return value == "true"
+	} else if intVal, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return intVal
+	} else if floatVal, err := strconv.ParseFloat(value, 64); err == nil {
+		return floatVal
+	}
+	return value
+}
+
+// formatXMLFile formats a map[string]any as an indented XML document. A
+// map with a single key is used as the root element, otherwise the data
+// is wrapped in a <root> element.
+func (p *Parser) formatXMLFile(data map[string]any) string {
+	var b strings.Builder
+	b.WriteString("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n")
+
+	if len(data) == 1 {
+		for name, value := range data {
+			writeXMLElement(&b, name, value, 0)
+		}
+	} else {
+		writeXMLElement(&b, "root", data, 0)
+	}
+
+	return b.String()
+}
+
+// writeXMLElement writes a single element and its children
+func writeXMLElement(b *strings.Builder, name string, value any, depth int) {
+	indent := strings.Repeat("  ", depth)
+
+	if items, ok := value.([]any); ok {
+		for _, item := range items {
+			writeXMLElement(b, name, item, depth)
+		}
+		return
+	}
+
+	data, isMap := toStringMap(value)
+	if !isMap {
+		fmt.Fprintf(b, "%s<%s>%s</%s>\n", indent, name, escapeXMLText(formatXMLValue(value)), name)
+		return
+	}
+
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(b, "%s<%s", indent, name)
+	var children []string
+	for _, key := range keys {
+		if strings.HasPrefix(key, "@") {
+			fmt.Fprintf(b, " %s=\"%s\"", key[1:], escapeXMLAttr(formatXMLValue(data[key])))
+		} else if key != "#text" {
+			children = append(children, key)
+		}
+	}
+
+	text, hasText := data["#text"]
+	switch {
+	case len(children) == 0 && !hasText:
+		b.WriteString("/>\n")
+	case len(children) == 0:
+		fmt.Fprintf(b, ">%s</%s>\n", escapeXMLText(formatXMLValue(text)), name)
+	default:
+		b.WriteString(">\n")
+		if hasText {
+			fmt.Fprintf(b, "%s  %s\n", indent, escapeXMLText(formatXMLValue(text)))
+		}
+		for _, key := range children {
+			writeXMLElement(b, key, data[key], depth+1)
+		}
+		fmt.Fprintf(b, "%s</%s>\n", indent, name)
+	}
+}
+
+// formatXMLValue formats a primitive value as XML text
+func formatXMLValue(value any) string {
+	return formatScalar(value)
+}
+
+// escapeXMLText escapes a value for use as element text
+func escapeXMLText(s string) string {
+	return xmlTextEscaper.Replace(s)
+}
+
+// escapeXMLAttr escapes a value for use inside a quoted attribute
+func escapeXMLAttr(s string) string {
+	return xmlAttrEscaper.Replace(s)
+}
+
+var (
+	xmlTextEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+	xmlAttrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;", "'", "&apos;", "\n", "&#xA;")
+)
+
+// updateXMLValues updates multiple values in an XML file while preserving formatting and comments
+func (p *Parser) updateXMLValues(filepath string, updates map[string]any) error {
+	content, err := textfile.Read(filepath)
+	if err != nil {
+		return fmt.Errorf("failed to read file: %w", err)
+	}
+
+	newContent, err := p.renderXMLValues(content, updates)
+	if err != nil {
+		return err
+	}
+
+	return textfile.Write(filepath, []byte(newContent))
+}
+
+// xmlEdit replaces the byte range [start, end) with text
+type xmlEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// renderXMLValues applies updates to XML content and returns the modified
+// content. Only element text and attribute values are rewritten, so the
+// declaration, comments and whitespace are preserved.
+func (p *Parser) renderXMLValues(content []byte, updates map[string]any) (string, error) {
+	root, err := parseXMLTree(content)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse xml file: %w", err)
+	}
+
+	locations := make(map[string]xmlLocation)
+	collectXMLLocations(root, root.name, locations)
+
+	var edits []xmlEdit
+	for keyPath, newValue := range updates {
+		location, exists := locations[normalizeXMLKeyPath(keyPath)]
+		if !exists {
+			continue
+		}
+
+		if location.attr != nil {
+			edits = append(edits, xmlEdit{
+				start: location.attr.valueStart,
+				end:   location.attr.valueEnd,
+				text:  escapeXMLAttr(formatXMLValue(newValue)),
+			})
+			continue
+		}
+
+		node := location.node
+		text := escapeXMLText(formatXMLValue(newValue))
+		if node.selfClosing {
+			// Expand <name/> into <name>value</name>
+			tagEnd := node.startTagEnd - 2
+			for tagEnd > node.startTagStart && (content[tagEnd-1] == ' ' || content[tagEnd-1] == '\t') {
+				tagEnd--
+			}
+			edits = append(edits, xmlEdit{
+				start: tagEnd,
+				end:   node.startTagEnd,
+				text:  ">" + text + "</" + node.name + ">",
+			})
+			continue
+		}
+		edits = append(edits, xmlEdit{start: node.startTagEnd, end: node.endTagStart, text: text})
+	}
+
+	if len(edits) == 0 {
+		return "", fmt.Errorf("no key paths found in file")
+	}
+
+	// Apply edits from the end of the document so earlier offsets stay valid
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start > edits[j].start })
+	result := content
+	for _, edit := range edits {
+		updated := make([]byte, 0, len(result)+len(edit.text))
+		updated = append(updated, result[:edit.start]...)
+		updated = append(updated, edit.text...)
+		updated = append(updated, result[edit.end:]...)
+		result = updated
+	}
+
+	return string(result), nil
+}
+
+// xmlLocation is an updatable value: either a leaf element's text or an attribute
+type xmlLocation struct {
+	node *xmlNode
+	attr *xmlAttr
+}
+
+// collectXMLLocations records the key path of every leaf element and attribute
+func collectXMLLocations(node *xmlNode, path string, locations map[string]xmlLocation) {
+	for i := range node.attrs {
+		locations[path+"@"+node.attrs[i].name] = xmlLocation{node: node, attr: &node.attrs[i]}
+	}
+
+	if len(node.children) == 0 {
+		if len(node.attrs) == 0 {
+			locations[path] = xmlLocation{node: node}
+		} else {
+			locations[path+"@#text"] = xmlLocation{node: node}
+		}
+		return
+	}
+
+	counts := make(map[string]int)
+	for _, child := range node.children {
+		counts[child.name]++
+	}
+
+	indices := make(map[string]int)
+	for _, child := range node.children {
+		childPath := path + "." + child.name
+		if counts[child.name] > 1 {
+			childPath = fmt.Sprintf("%s[%d]", childPath, indices[child.name])
+			indices[child.name]++
+		}
+		collectXMLLocations(child, childPath, locations)
+	}
+}
+
+// normalizeXMLKeyPath converts the dotted attribute form (server.@timeout)
+// and "#text" keys into the form produced by collectXMLLocations
+func normalizeXMLKeyPath(keyPath string) string {
+	keyPath = strings.ReplaceAll(keyPath, ".@", "@")
+	keyPath = strings.ReplaceAll(keyPath, ".#text", "@#text")
+	return keyPath
+}
@@ -0,0 +1,183 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testXMLConfig = `<?xml version="1.0" encoding="UTF-8"?>
+<!-- Application settings -->
+<config>
+  <server timeout="30" host='localhost'>
+    <port>8080</port>
+    <tls enabled="false"/>
+  </server>
+  <database>
+    <url><![CDATA[jdbc:postgresql://localhost/app?a=1&b=2]]></url>
+    <pool/>
+  </database>
+  <hosts>
+    <host>alpha</host>
+    <host>beta</host>
+  </hosts>
+  <name lang="en">Demo</name>
+</config>
+`
+
+func TestLoadFileXML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.xml")
+	if err := os.WriteFile(path, []byte(testXMLConfig), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	parser := New()
+	data, err := parser.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+
+	tests := []struct {
+		keyPath  string
+		expected any
+	}{
+		{"config.server.port", int64(8080)},
+		{"config.server@timeout", int64(30)},
+		{"config.server.@host", "localhost"},
+		{"config.server.tls@enabled", false},
+		{"config.database.url", "jdbc:postgresql://localhost/app?a=1&b=2"},
+		{"config.hosts.host[1]", "beta"},
+		{"config.name.#text", "Demo"},
+		{"config.name@lang", "en"},
+	}
+
+	for _, tt := range tests {
+		value, err := parser.GetValue(data, tt.keyPath)
+		if err != nil {
+			t.Errorf("GetValue(%s) error = %v", tt.keyPath, err)
+			continue
+		}
+		if value != tt.expected {
+			t.Errorf("GetValue(%s) = %v (%T), expected %v (%T)", tt.keyPath, value, value, tt.expected, tt.expected)
+		}
+	}
+
+	keys := parser.GetAllKeys(data, "")
+	for _, expected := range []string{"config.server@timeout", "config.server.port", "config.hosts.host[0]"} {
+		found := false
+		for _, key := range keys {
+			if key == expected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("GetAllKeys() missing %s, got %v", expected, keys)
+		}
+	}
+}
+
+func TestUpdateXMLValues(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.xml")
+	if err := os.WriteFile(path, []byte(testXMLConfig), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+
+	parser := New()
+	updates := map[string]any{
+		"config.server.port":     9090,
+		"config.server@timeout":  60,
+		"config.server.@host":    "db & cache",
+		"config.database.url":    "jdbc:postgresql://db/app?a=1&b=2",
+		"config.database.pool":   10,
+		"config.hosts.host[1]":   "gamma",
+		"config.name.#text":      "Production <eu>",
+		"config.server.tls@none": "ignored",
+	}
+	if err := parser.UpdateFileValues(path, updates); err != nil {
+		t.Fatalf("UpdateFileValues() error = %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read updated file: %v", err)
+	}
+
+	expected := `<?xml version="1.0" encoding="UTF-8"?>
+<!-- Application settings -->
+<config>
+  <server timeout="60" host='db &amp; cache'>
+    <port>9090</port>
+    <tls enabled="false"/>
+  </server>
+  <database>
+    <url>jdbc:postgresql://db/app?a=1&amp;b=2</url>
+    <pool>10</pool>
+  </database>
+  <hosts>
+    <host>alpha</host>
+    <host>gamma</host>
+  </hosts>
+  <name lang="en">Production &lt;eu&gt;</name>
+</config>
+`
+	if string(content) != expected {
+		t.Errorf("UpdateFileValues() result:\n%s\nExpected:\n%s", content, expected)
+	}
+
+	err = parser.UpdateFileValues(path, map[string]any{"config.missing": "x"})
+	if err == nil || !strings.Contains(err.Error(), "no key paths found") {
+		t.Errorf("UpdateFileValues() error = %v, expected 'no key paths found'", err)
+	}
+}
+
+func TestParseXMLFileErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"mismatched tags", "<config><port>1</server></config>"},
+		{"unclosed element", "<config><port>1</port>"},
+		{"multiple roots", "<a/><b/>"},
+		{"no root", "<!-- empty -->"},
+	}
+
+	parser := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := parser.parseXMLFile([]byte(tt.content)); err == nil {
+				t.Errorf("parseXMLFile(%q) expected error", tt.content)
+			}
+		})
+	}
+}
+
+func TestSaveFileXML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "generated.xml")
+	data := map[string]any{
+		"config": map[string]any{
+			"server": map[string]any{"@timeout": 30, "port": 8080},
+			"hosts":  map[string]any{"host": []any{"a", "b"}},
+		},
+	}
+
+	parser := New()
+	if err := parser.SaveFile(path, data); err != nil {
+		t.Fatalf("SaveFile() error = %v", err)
+	}
+
+	loaded, err := parser.LoadFile(path)
+	if err != nil {
+		t.Fatalf("LoadFile() error = %v", err)
+	}
+	for keyPath, want := range map[string]any{
+		"config.server@timeout": int64(30),
+		"config.server.port":    int64(8080),
+		"config.hosts.host[1]":  "b",
+	} {
+		if value, _ := parser.GetValue(loaded, keyPath); value != want {
+			t.Errorf("Round trip GetValue(%s) = %v, expected %v", keyPath, value, want)
+		}
+	}
+}
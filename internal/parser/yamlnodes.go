@@ -0,0 +1,160 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// The surgical YAML updater finds each value through the yaml.v3 node tree of
+// the file, whose positions say where the value is written, and replaces only
+// those characters. Unlike matching lines by their indentation, this holds for
+// any valid YAML: flow collections, tabs between tokens, any indentation width
+// and sequences nested in sequences.
+
+// yamlTarget is the node holding the value at a key path
+type yamlTarget struct {
+	node   *yaml.Node
+	indent int  // The indentation of the key or sequence entry holding the value
+	flow   bool // Whether the value is within a flow collection
+}
+
+// yamlDocument parses YAML content into a node tree, returning the root node
+// of its first document, or nil if the document is empty
+func yamlDocument(content string) (*yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return nil, fmt.Errorf("failed to parse yaml: %w", err)
+	}
+	if len(document.Content) == 0 {
+		return nil, nil
+	}
+	return document.Content[0], nil
+}
+
+// findYAMLValue finds the node holding the value at keyPath, following
+// aliases and merge keys to where the value is defined
+func findYAMLValue(root *yaml.Node, keyPath string) (yamlTarget, bool) {
+	if root == nil {
+		return yamlTarget{}, false
+	}
+	path, err := ParseKeyPath(keyPath)
+	if err != nil {
+		return yamlTarget{}, false
+	}
+	target := yamlTarget{node: root, indent: -1}
+	for _, segment := range path.Segments() {
+		key, index := segment.Key, segment.Index
+		node := resolveYAMLAlias(target.node)
+
+		if key != "" {
+			name, value := yamlMappingValue(node, key)
+			if value == nil {
+				return yamlTarget{}, false
+			}
+			target = yamlTarget{node: value, indent: name.Column - 1, flow: node.Style&yaml.FlowStyle != 0}
+		}
+
+		if index >= 0 {
+			sequence := resolveYAMLAlias(target.node)
+			if sequence.Kind != yaml.SequenceNode || index >= len(sequence.Content) {
+				return yamlTarget{}, false
+			}
+			target = yamlTarget{node: sequence.Content[index], indent: sequence.Column - 1, flow: sequence.Style&yaml.FlowStyle != 0}
+		}
+	}
+	target.node = resolveYAMLAlias(target.node)
+	return target, target.node != root
+}
+
+// yamlOffset converts a column of a line, counted in characters from 1 as
+// yaml.v3 counts them, into a byte offset
+func yamlOffset(line string, column int) int {
+	offset := 0
+	for i := 1; i < column && offset < len(line); i++ {
+		_, size := utf8.DecodeRuneInString(line[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// yamlScalarStart skips the anchor and tag before the scalar at offset
+// start of line, which yaml.v3 counts as part of the scalar. Neither can hold
+// a flow indicator, so in a flow collection they may end at one.
+func yamlScalarStart(line string, start int) int {
+	for start < len(line) && (line[start] == '&' || line[start] == '!') {
+		end := strings.IndexAny(line[start:], " \t,[]{}")
+		if end < 0 {
+			return len(line)
+		}
+		start += end
+		for start < len(line) && (line[start] == ' ' || line[start] == '\t') {
+			start++
+		}
+	}
+	return start
+}
+
+// yamlScalarEnd returns the offset just past the scalar starting at offset
+// start of line, not counting any comment or whitespace after it. Within a
+// flow collection, a plain scalar also ends at the next , ] or }. It reports
+// false if the scalar is quoted and its closing quote is on a later line.
+func yamlScalarEnd(line string, start int, flow bool) (int, bool) {
+	end := start
+	if end < len(line) && (line[end] == '"' || line[end] == '\'') {
+		quote := line[end]
+		for end++; ; end++ {
+			if end >= len(line) {
+				return len(line), false
+			}
+			if quote == '"' && line[end] == '\\' {
+				end++
+			} else if line[end] == quote {
+				if quote == '\'' && end+1 < len(line) && line[end+1] == '\'' {
+					end++ // '' is an escaped quote
+					continue
+				}
+				return end + 1, true
+			}
+		}
+	}
+
+	for end < len(line) {
+		c := line[end]
+		if c == '#' && end > start && (line[end-1] == ' ' || line[end-1] == '\t') {
+			break
+		}
+		if flow && (c == ',' || c == ']' || c == '}') {
+			break
+		}
+		end++
+	}
+	for end > start && (line[end-1] == ' ' || line[end-1] == '\t') {
+		end--
+	}
+	return end, true
+}
+
+// formatYAMLFlowValue formats a value for a flow collection, where a plain
+// scalar cannot hold a comma
+func formatYAMLFlowValue(value any) string {
+	formatted := formatYAMLValue(value)
+	if strings.Contains(formatted, ",") && !strings.HasPrefix(formatted, `"`) && !strings.HasPrefix(formatted, `'`) {
+		return `"` + strings.ReplaceAll(formatted, `"`, `\"`) + `"`
+	}
+	return formatted
+}
+
+// yamlKindName names the kind of a node for error messages
+func yamlKindName(kind yaml.Kind) string {
+	switch kind {
+	case yaml.MappingNode:
+		return "mapping"
+	case yaml.SequenceNode:
+		return "sequence"
+	default:
+		return "scalar"
+	}
+}
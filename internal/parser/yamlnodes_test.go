@@ -0,0 +1,134 @@
+package parser
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestYAMLScalarSpan(t *testing.T) {
+	tests := []struct {
+		line     string
+		column   int
+		flow     bool
+		expected string
+	}{
+		{"port: 5432", 7, false, "5432"},
+		{"port: &p 5432 # note", 7, false, "5432"},
+		{`name: "a # b" # note`, 7, false, `"a # b"`},
+		{"- !!int 5", 3, false, "5"},
+		{"{a: 1, b: 2}", 5, true, "1"},
+		{"[x, 'it''s', z]", 5, true, "'it''s'"},
+		{"[&a, b]", 2, true, ""},
+		{"é: ü # note", 4, false, "ü"},
+		{"url: http://a#b", 6, false, "http://a#b"},
+	}
+	for _, tt := range tests {
+		start := yamlScalarStart(tt.line, yamlOffset(tt.line, tt.column))
+		end, closed := yamlScalarEnd(tt.line, start, tt.flow)
+		if got := tt.line[start:end]; got != tt.expected || !closed {
+			t.Errorf("scalar at %d of %q = %q, want %q", tt.column, tt.line, got, tt.expected)
+		}
+	}
+
+	if _, closed := yamlScalarEnd(`text: "one`, 6, false); closed {
+		t.Error("yamlScalarEnd() should report a quoted scalar continuing on the next line")
+	}
+}
+
+func TestUpdateFileValuesYAMLNodes(t *testing.T) {
+	tests := []struct {
+		name     string
+		content  string
+		updates  map[string]any
+		expected string
+	}{
+		{
+			name:     "flow mapping",
+			content:  "database: {host: localhost, port: 5432} # primary\n",
+			updates:  map[string]any{"database.host": "db, internal", "database.port": 6432},
+			expected: "database: {host: \"db, internal\", port: 6432} # primary\n",
+		},
+		{
+			name:     "flow sequence",
+			content:  "hosts: [a.example.com, b.example.com]\n",
+			updates:  map[string]any{"hosts[1]": "c.example.com"},
+			expected: "hosts: [a.example.com, c.example.com]\n",
+		},
+		{
+			name:     "four space indents",
+			content:  "server:\n    tls:\n        port: 443\n    port: 80\nport: 1\n",
+			updates:  map[string]any{"server.tls.port": 8443, "server.port": 8080},
+			expected: "server:\n    tls:\n        port: 8443\n    port: 8080\nport: 1\n",
+		},
+		{
+			name:     "tabs",
+			content:  "name:\tapp\t# the app\nport:\t80\n",
+			updates:  map[string]any{"name": "web"},
+			expected: "name:\tweb\t# the app\nport:\t80\n",
+		},
+		{
+			name:     "lists of lists",
+			content:  "groups:\n  - - a\n    - b\n  - name: second\n    size: 2\n",
+			updates:  map[string]any{"groups[1].size": 3},
+			expected: "groups:\n  - - a\n    - b\n  - name: second\n    size: 3\n",
+		},
+		{
+			name:     "empty value",
+			content:  "host:\nport: # unset\n",
+			updates:  map[string]any{"host": "localhost", "port": 80},
+			expected: "host: localhost\nport: 80 # unset\n",
+		},
+		{
+			name:     "multi-line plain scalar",
+			content:  "description: a long\n  description\nversion: 1\n",
+			updates:  map[string]any{"description": "short"},
+			expected: "description: short\nversion: 1\n",
+		},
+		{
+			name:     "multi-line quoted scalar",
+			content:  "description: \"a long\n  description\"\nversion: 1\n",
+			updates:  map[string]any{"description": "short"},
+			expected: "description: short\nversion: 1\n",
+		},
+		{
+			name:     "unicode",
+			content:  "labels: {café: ouvert, état: ok}\n",
+			updates:  map[string]any{"labels.état": "ko"},
+			expected: "labels: {café: ouvert, état: ko}\n",
+		},
+	}
+
+	p := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(filePath, []byte(tt.content), 0644); err != nil {
+				t.Fatalf("Failed to create test file: %v", err)
+			}
+			if err := p.UpdateFileValues(filePath, tt.updates); err != nil {
+				t.Fatalf("UpdateFileValues() returned error: %v", err)
+			}
+
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				t.Fatalf("Failed to read file: %v", err)
+			}
+			if string(content) != tt.expected {
+				t.Errorf("UpdateFileValues() wrote:\n%s\nwant:\n%s", content, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUpdateFileValuesYAMLCollection(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(filePath, []byte("database:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create test file: %v", err)
+	}
+	err := New().UpdateFileValues(filePath, map[string]any{"database": "localhost"})
+	if err == nil || !strings.Contains(err.Error(), "mapping") {
+		t.Errorf("UpdateFileValues() returned %v, want an error for replacing a mapping", err)
+	}
+}
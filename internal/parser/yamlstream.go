@@ -0,0 +1,334 @@
+package parser
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExtractYAML reads a YAML document line by line, following the block
+// mappings that lead to the key paths wanted by their indentation. The value
+// at a key path, or a sequence or anything not a block mapping on the way to
+// one, is decoded on its own once its last line is read, and everything else
+// is skipped without being decoded. Documents it cannot follow this way, such
+// as flow mappings, tab indentation, complex keys or merge keys on the way to
+// a key path, are reported by errNotScannable, as are aliases to anchors
+// outside the values decoded.
+
+// errNotScannable reports a YAML document ExtractYAML cannot scan, which has
+// to be loaded whole instead
+var errNotScannable = errors.New("document cannot be scanned for keys")
+
+// yamlFrame is a block mapping on the way to the key paths wanted
+type yamlFrame struct {
+	tree   *keyTree
+	values map[string]any
+	indent int // Indentation of its keys, -1 until the first is read
+	before int // Key paths remaining when it was entered
+
+	// The key holding the mapping, its line and the mapping it is in
+	key       string
+	keyLine   string
+	keyIndent int
+	parent    map[string]any
+}
+
+// yamlValue is the value of a key being read whole, or skipped if tree is nil
+type yamlValue struct {
+	tree   *keyTree
+	lines  []string
+	indent int  // Indentation of the key
+	open   bool // Nothing follows the key on its line, so a sequence may be at its indentation
+	key    string
+	into   map[string]any
+}
+
+// yamlScanner reads the values a keyTree wants from the lines of a document
+type yamlScanner struct {
+	stack     []*yamlFrame
+	value     *yamlValue
+	started   bool
+	remaining int  // Key paths not found or ruled out yet
+	last      bool // The line read is the last, without a line break
+}
+
+// ExtractYAML reads the YAML mapping from r only as far as it has to to find
+// the values at keyPaths, and returns a mapping holding those values at the
+// same key paths, so that GetValue reads them as it would from the whole
+// document. Key paths the document does not have are missing from it too. A
+// value below the key paths on the way to one, such as a sequence holding the
+// element wanted, is kept whole. Where a key appears twice, the first is read.
+// Once every key path is found, the rest of r is not read, so a merge key
+// after the keys read is not looked at.
+func (p *Parser) ExtractYAML(r io.Reader, keyPaths []string) (map[string]any, error) {
+	tree, err := newKeyTree(keyPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &yamlFrame{tree: tree, values: make(map[string]any), indent: -1, keyIndent: -1}
+	scanner := &yamlScanner{stack: []*yamlFrame{root}, remaining: tree.paths}
+	reader := bufio.NewReader(r)
+	for first := true; scanner.remaining > 0; first = false {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line == "" && err == io.EOF {
+			break
+		}
+		// Only UTF-8 is scanned, not the UTF-16 a byte order mark announces
+		if first && (!utf8.ValidString(line) || strings.ContainsAny(line, "\x00\uFEFF")) {
+			return nil, errNotScannable
+		}
+
+		scanner.last = !strings.HasSuffix(line, "\n")
+		end, lineErr := scanner.line(strings.TrimRight(line, "\r\n"))
+		if lineErr != nil {
+			return nil, lineErr
+		}
+		if end || err == io.EOF {
+			break
+		}
+	}
+	if err := scanner.endValue(!scanner.last); err != nil {
+		return nil, err
+	}
+	for len(scanner.stack) > 1 {
+		scanner.pop()
+	}
+
+	NormalizeValue(root.values)
+	return root.values, nil
+}
+
+// line reads the next line of the document, returning true at its end
+func (s *yamlScanner) line(line string) (bool, error) {
+	trimmed := strings.TrimLeft(line, " ")
+	indent := len(line) - len(trimmed)
+	blank := trimmed == "" || trimmed[0] == '#'
+	if strings.Contains(line, "\r") {
+		// A carriage return alone breaks lines too
+		return false, errNotScannable
+	}
+
+	if !s.started {
+		// Directives and the marker starting the document come before it
+		switch {
+		case blank || strings.HasPrefix(line, "%"):
+			return false, nil
+		case yamlMarker(line, "---"):
+			if rest := strings.TrimSpace(line[3:]); rest != "" && rest[0] != '#' {
+				return false, errNotScannable
+			}
+			s.started = true
+			return false, nil
+		}
+		s.started = true
+	}
+	if yamlMarker(line, "---") || yamlMarker(line, "...") {
+		return true, s.endValue(true)
+	}
+
+	if s.value != nil {
+		if blank || indent > s.value.indent || s.value.open && indent == s.value.indent && yamlSequenceItem(trimmed) {
+			if s.value.tree != nil {
+				s.value.lines = append(s.value.lines, line)
+			}
+			return false, nil
+		}
+		// The line after a value starts the next key, or the value is not
+		// where it was looked for
+		if _, _, ok := yamlKeyLine(trimmed); !ok || trimmed[0] == '\t' {
+			return false, errNotScannable
+		}
+		if err := s.endValue(true); err != nil {
+			return false, err
+		}
+		if s.remaining == 0 {
+			return true, nil
+		}
+	}
+	if blank {
+		return false, nil
+	}
+	if trimmed[0] == '\t' {
+		return false, errNotScannable
+	}
+
+	// Leave the mappings the line is not in
+	for len(s.stack) > 1 && indent <= s.top().keyIndent && !(s.top().indent < 0 && indent == s.top().keyIndent && yamlSequenceItem(trimmed)) {
+		s.pop()
+	}
+	top := s.top()
+	if top.indent < 0 {
+		if yamlSequenceItem(trimmed) && len(s.stack) > 1 {
+			// The key holds a sequence rather than a mapping, so it is read whole
+			s.stack = s.stack[:len(s.stack)-1]
+			delete(top.parent, top.key)
+			s.value = &yamlValue{tree: top.tree, lines: []string{top.keyLine, line}, indent: top.keyIndent, open: true, key: top.key, into: top.parent}
+			return false, nil
+		}
+		top.indent = indent
+	} else if indent != top.indent {
+		return false, errNotScannable
+	}
+
+	key, rest, ok := yamlKeyLine(trimmed)
+	if !ok || key == "<<" {
+		return false, errNotScannable
+	}
+	if len(s.stack) > 1 && trimmed[0] != '"' && trimmed[0] != '\'' {
+		if key, ok = yamlNestedKey(key); !ok {
+			return false, errNotScannable
+		}
+	}
+	next, wanted := top.tree.keys[key]
+	if _, found := top.values[key]; found {
+		wanted = false
+	}
+	switch {
+	case !wanted:
+		s.value = &yamlValue{indent: indent, open: rest == ""}
+	case rest == "" && !next.whole && next.indexes == nil:
+		values := make(map[string]any)
+		top.values[key] = values
+		s.stack = append(s.stack, &yamlFrame{tree: next, values: values, indent: -1, before: s.remaining, key: key, keyLine: line, keyIndent: indent, parent: top.values})
+	default:
+		s.value = &yamlValue{tree: next, lines: []string{line}, indent: indent, open: rest == "", key: key, into: top.values}
+	}
+	return false, nil
+}
+
+// top returns the innermost mapping being read
+func (s *yamlScanner) top() *yamlFrame {
+	return s.stack[len(s.stack)-1]
+}
+
+// pop leaves the innermost mapping, in which no more key paths can be found
+func (s *yamlScanner) pop() {
+	frame := s.top()
+	s.stack = s.stack[:len(s.stack)-1]
+	if frame.indent < 0 {
+		// Nothing below the key, which holds null
+		frame.parent[frame.key] = nil
+	}
+	s.remaining = frame.before - frame.tree.paths
+}
+
+// endValue decodes the value being read whole, if any, as the value of the
+// only key of its lines. terminated reports whether a line break follows its
+// last line.
+func (s *yamlScanner) endValue(terminated bool) error {
+	value := s.value
+	s.value = nil
+	if value == nil || value.tree == nil {
+		return nil
+	}
+
+	var b strings.Builder
+	for i, line := range value.lines {
+		b.WriteString(line[min(value.indent, len(line)-len(strings.TrimLeft(line, " "))):])
+		// Block scalars keep the line break ending the document, if any
+		if i < len(value.lines)-1 || terminated {
+			b.WriteByte('\n')
+		}
+	}
+	var decoded map[string]any
+	if err := yaml.Unmarshal([]byte(b.String()), &decoded); err != nil {
+		return errNotScannable
+	}
+	if len(decoded) != 1 {
+		return errNotScannable
+	}
+	for _, v := range decoded {
+		value.into[value.key] = v
+	}
+	s.remaining -= value.tree.paths
+	return nil
+}
+
+// yamlKeyLine splits the trimmed line of a block mapping key into the key and
+// what follows it, without a comment. ok is false for any other line.
+func yamlKeyLine(trimmed string) (key, rest string, ok bool) {
+	switch trimmed[0] {
+	case '"', '\'':
+		end := 1
+		for ; end < len(trimmed); end++ {
+			if trimmed[end] == '\\' && trimmed[0] == '"' {
+				end++
+			} else if trimmed[end] == trimmed[0] {
+				if trimmed[0] == '\'' && end+1 < len(trimmed) && trimmed[end+1] == '\'' {
+					end++
+					continue
+				}
+				break
+			}
+		}
+		if end >= len(trimmed) || yaml.Unmarshal([]byte(trimmed[:end+1]), &key) != nil {
+			return "", "", false
+		}
+		rest, ok = strings.CutPrefix(strings.TrimLeft(trimmed[end+1:], " "), ":")
+		if !ok || rest != "" && rest[0] != ' ' && rest[0] != '\t' {
+			return "", "", false
+		}
+	case '-', '?', ':', ',', '[', ']', '{', '}', '#', '&', '*', '!', '|', '>', '%', '@', '`':
+		return "", "", false
+	default:
+		end := -1
+		for i := 0; i < len(trimmed); i++ {
+			if trimmed[i] == '#' && (trimmed[i-1] == ' ' || trimmed[i-1] == '\t') {
+				return "", "", false
+			}
+			if trimmed[i] == ':' && (i+1 == len(trimmed) || trimmed[i+1] == ' ' || trimmed[i+1] == '\t') {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return "", "", false
+		}
+		key, rest = strings.TrimRight(trimmed[:end], " \t"), trimmed[end+1:]
+	}
+
+	rest = strings.TrimSpace(rest)
+	if strings.HasPrefix(rest, "#") {
+		rest = ""
+	}
+	return key, rest, true
+}
+
+// yamlNestedKey returns a plain key of a nested mapping as it reads once the
+// whole document is decoded: below the top level, keys that read as numbers,
+// booleans or null are decoded as such and then written as text, so that 010
+// reads as 8
+func yamlNestedKey(key string) (string, bool) {
+	if !strings.ContainsAny(key[:1], "0123456789.+-~") && !slices.Contains([]string{"true", "false", "null"}, strings.ToLower(key)) {
+		return key, true
+	}
+	var decoded map[string]any
+	if yaml.Unmarshal([]byte("key:\n  "+key+":\n"), &decoded) != nil {
+		return "", false
+	}
+	NormalizeValue(decoded)
+	nested, _ := decoded["key"].(map[string]any)
+	for nestedKey := range nested {
+		return nestedKey, true
+	}
+	return "", false
+}
+
+// yamlSequenceItem reports whether a trimmed line starts a sequence element
+func yamlSequenceItem(trimmed string) bool {
+	return trimmed == "-" || strings.HasPrefix(trimmed, "- ") || strings.HasPrefix(trimmed, "-\t")
+}
+
+// yamlMarker reports whether line is the document marker, such as "---"
+func yamlMarker(line, marker string) bool {
+	return strings.HasPrefix(line, marker) && (len(line) == len(marker) || line[len(marker)] == ' ' || line[len(marker)] == '\t')
+}
@@ -0,0 +1,168 @@
+package parser
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractYAML(t *testing.T) {
+	p := New()
+	document := `%YAML 1.2
+---
+# Generated
+name: api # the service
+skipped:
+  deep:
+    - 1
+    - x: [2, 3]
+  text: |
+    a: b
+    name: not this
+database:
+  host: db
+
+  port: 5432   # default
+  ratio: 0.5
+  tls: true
+  password:
+servers:
+- host: a
+- host: b
+-   host: c
+"example.com":
+  port: 443
+'quoted ''key''': {a: 1}
+anchored: &shared
+  host: shared
+aliased: *shared
+name: duplicate
+`
+
+	tests := []struct {
+		keyPath string
+		want    any
+	}{
+		{"name", "api"},
+		{"database.port", int64(5432)},
+		{"database.ratio", 0.5},
+		{"database.tls", true},
+		{"database.password", nil},
+		{"database", map[string]any{"host": "db", "port": int64(5432), "ratio": 0.5, "tls": true, "password": nil}},
+		{"servers[1].host", "b"},
+		{"servers[2]", map[string]any{"host": "c"}},
+		{`"example.com".port`, int64(443)},
+		{`"quoted 'key'".a`, int64(1)},
+		{"anchored.host", "shared"},
+	}
+	for _, tt := range tests {
+		data, err := p.ExtractYAML(strings.NewReader(document), []string{tt.keyPath})
+		if err != nil {
+			t.Fatalf("ExtractYAML(%s) error = %v", tt.keyPath, err)
+		}
+		value, err := p.GetValue(data, tt.keyPath)
+		if err != nil || !reflect.DeepEqual(value, tt.want) {
+			t.Errorf("GetValue(%s) on extracted data = %#v, %v; want %#v", tt.keyPath, value, err, tt.want)
+		}
+		if _, ok := data["skipped"]; ok {
+			t.Errorf("ExtractYAML(%s) kept a key not wanted", tt.keyPath)
+		}
+	}
+
+	// Missing keys are reported as they are from the whole document
+	data, err := p.ExtractYAML(strings.NewReader(document), []string{"database.user", "servers[5].host", "name.first"})
+	if err != nil {
+		t.Fatalf("ExtractYAML() error = %v", err)
+	}
+	for _, keyPath := range []string{"database.user", "servers[5].host", "name.first"} {
+		if _, err := p.GetValue(data, keyPath); err == nil {
+			t.Errorf("GetValue(%s) on extracted data expected an error", keyPath)
+		}
+	}
+
+	// An alias to an anchor that is not read cannot be resolved
+	if _, err := p.ExtractYAML(strings.NewReader(document), []string{"aliased.host"}); err == nil {
+		t.Error("ExtractYAML() of an alias expected an error")
+	}
+	if _, err := p.ExtractYAML(strings.NewReader(document), []string{"servers[*].host"}); err == nil {
+		t.Error("ExtractYAML() with a wildcard expected an error")
+	}
+	for _, document := range []string{"- 1\n- 2\n", "{name: api}\n", "base:\n  <<: {a: 1}\n  b: 2\n", "base:\n\tname: api\n"} {
+		if _, err := p.ExtractYAML(strings.NewReader(document), []string{"base.name"}); err == nil {
+			t.Errorf("ExtractYAML() of %q expected an error", document)
+		}
+	}
+}
+
+func TestExtractYAMLStopsAtLastKey(t *testing.T) {
+	p := New()
+	// Everything after the keys wanted is invalid, so reading it would fail
+	document := "a:\n  b: 1\n  c: [0, x]\nrest: {{{\n"
+
+	data, err := p.ExtractYAML(strings.NewReader(document), []string{"a.c[1]", "a.b"})
+	if err != nil {
+		t.Fatalf("ExtractYAML() error = %v", err)
+	}
+	want := map[string]any{"a": map[string]any{"b": int64(1), "c": []any{int64(0), "x"}}}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("ExtractYAML() = %#v, want %#v", data, want)
+	}
+
+	// Only the first document is read
+	data, err = p.ExtractYAML(strings.NewReader("a: 1\n---\nb: 2\n"), []string{"a", "b"})
+	if err != nil || !reflect.DeepEqual(data, map[string]any{"a": int64(1)}) {
+		t.Errorf("ExtractYAML() of two documents = %#v, %v; want the first", data, err)
+	}
+}
+
+func TestLoadFileKeysYAML(t *testing.T) {
+	p := New()
+	dir := t.TempDir()
+
+	var b strings.Builder
+	b.WriteString("host: db\nitems:\n")
+	for i := 0; b.Len() < StreamMinSize; i++ {
+		fmt.Fprintf(&b, "  - id: %d\n    name: item %d\n", i, i)
+	}
+	b.WriteString("port: 5432\n")
+	large := filepath.Join(dir, "large.yaml")
+	if err := os.WriteFile(large, []byte(b.String()), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	data, partial, err := p.LoadFileKeys(context.Background(), large, []string{"host", "port"})
+	if err != nil || !partial {
+		t.Fatalf("LoadFileKeys() of a large file = %v, %v; want it read in part", partial, err)
+	}
+	if !reflect.DeepEqual(data, map[string]any{"host": "db", "port": int64(5432)}) {
+		t.Errorf("LoadFileKeys() = %v, want only the keys wanted", data)
+	}
+
+	// A document the scanner cannot follow is loaded whole
+	flow := filepath.Join(dir, "flow.yaml")
+	if err := os.WriteFile(flow, []byte("{host: db, pad: '"+strings.Repeat("x", StreamMinSize)+"'}\n"), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	data, partial, err = p.LoadFileKeys(context.Background(), flow, []string{"host"})
+	if err != nil || partial || data["host"] != "db" {
+		t.Errorf("LoadFileKeys() of a flow mapping = %v, %v; want the whole file", partial, err)
+	}
+
+	// The data of a Secret is decoded as it is when loaded whole
+	secret := filepath.Join(dir, "secret.yaml")
+	content := "apiVersion: v1\nkind: Secret\ndata:\n  password: aHVudGVyMg==\n# " + strings.Repeat("x", StreamMinSize) + "\n"
+	if err := os.WriteFile(secret, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	data, partial, err = p.LoadFileKeys(context.Background(), secret, []string{"data.password"})
+	if err != nil || !partial {
+		t.Fatalf("LoadFileKeys() of a Secret = %v, %v; want it read in part", partial, err)
+	}
+	if value, _ := p.GetValue(data, "data.password"); value != "hunter2" {
+		t.Errorf("GetValue(data.password) = %v, want the decoded value", value)
+	}
+}
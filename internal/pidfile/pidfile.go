@@ -0,0 +1,71 @@
+package pidfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// PidFile records which process is watching a config, so that a second
+// var-sync watching the same config refuses to start
+type PidFile struct {
+	path string
+	pid  int
+}
+
+// Acquire creates the pid file at path for this process. It fails if the
+// file names another process that is still running, unless force is set. A
+// file left behind by a process that has exited is replaced.
+func Acquire(path string, force bool) (*PidFile, error) {
+	p := &PidFile{path: path, pid: os.Getpid()}
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(file, "%d\n", p.pid)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, fmt.Errorf("failed to write pid file %s: %w", path, err)
+			}
+			return p, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("failed to create pid file %s: %w", path, err)
+		}
+
+		owner, err := read(path)
+		if err == nil && owner != p.pid && running(owner) && !force {
+			return nil, fmt.Errorf("var-sync is already watching this config (pid %d, see %s); stop it first or use -force", owner, path)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("failed to replace pid file %s: %w", path, err)
+		}
+	}
+	return nil, fmt.Errorf("failed to create pid file %s: another process keeps creating it", path)
+}
+
+// Release removes the pid file, unless another process has taken it over
+// since
+func (p *PidFile) Release() error {
+	owner, err := read(p.path)
+	if err != nil || owner != p.pid {
+		return nil
+	}
+	if err := os.Remove(p.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove pid file %s: %w", p.path, err)
+	}
+	return nil
+}
+
+// read returns the process ID stored in a pid file
+func read(path string) (int, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(content)))
+}
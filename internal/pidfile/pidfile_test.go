@@ -0,0 +1,94 @@
+package pidfile
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// helperProcess returns a command running this test binary as another
+// process, which sleeps or exits at once as action says, so that the tests
+// need no commands that only some systems have
+func helperProcess(action string) *exec.Cmd {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcess$")
+	cmd.Env = append(os.Environ(), "PIDFILE_HELPER="+action)
+	return cmd
+}
+
+// TestHelperProcess is the process helperProcess runs, and does nothing as a
+// test
+func TestHelperProcess(t *testing.T) {
+	switch os.Getenv("PIDFILE_HELPER") {
+	case "sleep":
+		time.Sleep(10 * time.Second)
+		os.Exit(0)
+	case "exit":
+		os.Exit(0)
+	}
+}
+
+func TestAcquireAndRelease(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "var-sync.json.pid")
+
+	p, err := Acquire(path, false)
+	if err != nil {
+		t.Fatalf("Acquire() error = %v", err)
+	}
+	if pid, err := read(path); err != nil || pid != os.Getpid() {
+		t.Errorf("Pid file holds %d (%v), want %d", pid, err, os.Getpid())
+	}
+
+	if err := p.Release(); err != nil {
+		t.Fatalf("Release() error = %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Release() left the pid file behind")
+	}
+}
+
+func TestAcquireRunningOwner(t *testing.T) {
+	cmd := helperProcess("sleep")
+	if err := cmd.Start(); err != nil {
+		t.Skipf("cannot start a process to own the pid file: %v", err)
+	}
+	defer cmd.Process.Kill()
+
+	path := filepath.Join(t.TempDir(), "var-sync.json.pid")
+	if err := os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Acquire(path, false); err == nil {
+		t.Fatal("Acquire() should fail while the owner is running")
+	}
+
+	p, err := Acquire(path, true)
+	if err != nil {
+		t.Fatalf("Acquire() with force error = %v", err)
+	}
+	if pid, _ := read(path); pid != os.Getpid() {
+		t.Errorf("Forced pid file holds %d, want %d", pid, os.Getpid())
+	}
+	p.Release()
+}
+
+func TestAcquireStale(t *testing.T) {
+	cmd := helperProcess("exit")
+	if err := cmd.Run(); err != nil {
+		t.Skipf("cannot run a process to leave a stale pid: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "var-sync.json.pid")
+	if err := os.WriteFile(path, []byte(strconv.Itoa(cmd.Process.Pid)+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Acquire(path, false)
+	if err != nil {
+		t.Fatalf("Acquire() should replace a stale pid file, got %v", err)
+	}
+	p.Release()
+}
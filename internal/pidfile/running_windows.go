@@ -0,0 +1,30 @@
+//go:build windows
+
+package pidfile
+
+import (
+	"errors"
+	"syscall"
+)
+
+// stillActive is the exit code Windows reports for a process that has not
+// exited
+const stillActive = 259
+
+// running reports whether a process with the given ID exists. A process that
+// has exited can still be opened while anything holds a handle to it, so its
+// exit code is checked too.
+func running(pid int) bool {
+	handle, err := syscall.OpenProcess(syscall.PROCESS_QUERY_INFORMATION, false, uint32(pid))
+	if err != nil {
+		// Processes of other users cannot be opened, but exist
+		return errors.Is(err, syscall.ERROR_ACCESS_DENIED)
+	}
+	defer syscall.CloseHandle(handle)
+
+	var code uint32
+	if err := syscall.GetExitCodeProcess(handle, &code); err != nil {
+		return true
+	}
+	return code == stillActive
+}
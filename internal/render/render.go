@@ -0,0 +1,85 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"var-sync/internal/parser"
+)
+
+// Load reads and parses the Go text/template at path. Referring to a key the
+// data does not have is an error rather than writing <no value>.
+func Load(path string) (*template.Template, error) {
+	text, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read template: %w", err)
+	}
+	tmpl, err := template.New(filepath.Base(path)).Option("missingkey=error").Funcs(funcs()).Parse(string(text))
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %w", path, err)
+	}
+	return tmpl, nil
+}
+
+// Execute renders the template at path with the document data, whose keys
+// the template reads as fields, such as {{ .database.host }}
+func Execute(path string, data map[string]any) ([]byte, error) {
+	tmpl, err := Load(path)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return nil, fmt.Errorf("failed to render template %s: %w", path, err)
+	}
+	return out.Bytes(), nil
+}
+
+// funcs returns the functions templates may call besides the built-in ones
+func funcs() template.FuncMap {
+	p := parser.New()
+	return template.FuncMap{
+		// get reads a key path of a document, for keys that are not valid
+		// field names, such as {{ get . "servers[0].host" }}. Unlike a field,
+		// a key the document does not have is empty rather than an error, so
+		// optional keys can be given a default.
+		"get": func(data map[string]any, keyPath string) (any, error) {
+			value, err := p.GetValue(data, keyPath)
+			if errors.Is(err, parser.ErrKeyNotFound) {
+				return nil, nil
+			}
+			return value, err
+		},
+		// default returns fallback when value is empty, as in
+		// {{ .port | default 8080 }}
+		"default": func(fallback, value any) any {
+			if value == nil || value == "" {
+				return fallback
+			}
+			return value
+		},
+		// required fails the render when value is empty
+		"required": func(message string, value any) (any, error) {
+			if value == nil || value == "" {
+				return nil, fmt.Errorf("%s", message)
+			}
+			return value, nil
+		},
+		"json": func(value any) (string, error) {
+			encoded, err := json.Marshal(value)
+			return string(encoded), err
+		},
+		"quote": func(value any) string {
+			return strconv.Quote(fmt.Sprint(value))
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+}
@@ -0,0 +1,54 @@
+package render
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeTemplate(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "app.conf.tmpl")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write template: %v", err)
+	}
+	return path
+}
+
+func TestExecute(t *testing.T) {
+	data := map[string]any{
+		"server":  map[string]any{"host": "example.com", "port": 8080},
+		"servers": []any{map[string]any{"host": "a.internal"}},
+		"tags":    []any{"web", "api"},
+	}
+
+	tests := []struct {
+		name     string
+		template string
+		expected string
+		wantErr  bool
+	}{
+		{"fields", "{{ .server.host }}:{{ .server.port }}", "example.com:8080", false},
+		{"get", `{{ get . "servers[0].host" }}`, "a.internal", false},
+		{"default for missing key", `{{ get . "server.root" | default "/var/www" }}`, "/var/www", false},
+		{"default for present key", `{{ .server.host | default "localhost" }}`, "example.com", false},
+		{"json", "{{ json .tags }}", `["web","api"]`, false},
+		{"quote", "{{ quote .server.host }}", `"example.com"`, false},
+		{"upper and lower", "{{ upper .server.host }} {{ lower \"API\" }}", "EXAMPLE.COM api", false},
+		{"missing field", "{{ .server.root }}", "", true},
+		{"required", `{{ get . "server.root" | required "server.root is required" }}`, "", true},
+		{"invalid template", "{{ .server.host ", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			output, err := Execute(writeTemplate(t, tt.template), data)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Execute() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && string(output) != tt.expected {
+				t.Errorf("Execute() = %q, want %q", output, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,298 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"var-sync/pkg/models"
+)
+
+// Schedule decides whether a rule may sync at a given time. It is open
+// during any include window or within Duration after a cron time, or always
+// when it has neither, and never during an exclude window.
+type Schedule struct {
+	include  []window
+	exclude  []window
+	cron     *cron
+	duration time.Duration
+	location *time.Location
+}
+
+// window is a daily span of time on some days of the week. A span whose end
+// is not after its start runs past midnight into the next day.
+type window struct {
+	days  [7]bool // Indexed by time.Weekday
+	start int     // Minutes after midnight
+	end   int
+}
+
+// cron is a standard five field cron expression
+type cron struct {
+	minute, hour, dom, month, dow []bool
+	domAny, dowAny                bool
+}
+
+// maxDuration bounds how far back a cron window is searched
+const maxDuration = 7 * 24 * time.Hour
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Parse checks a rule's schedule settings and prepares them for Open
+func Parse(cfg *models.Schedule) (*Schedule, error) {
+	s := &Schedule{location: time.Local}
+
+	if cfg.Timezone != "" {
+		location, err := time.LoadLocation(cfg.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid timezone %q: %w", cfg.Timezone, err)
+		}
+		s.location = location
+	}
+
+	for _, text := range cfg.Include {
+		w, err := parseWindow(text)
+		if err != nil {
+			return nil, err
+		}
+		s.include = append(s.include, w)
+	}
+	for _, text := range cfg.Exclude {
+		w, err := parseWindow(text)
+		if err != nil {
+			return nil, err
+		}
+		s.exclude = append(s.exclude, w)
+	}
+
+	if cfg.Cron != "" {
+		c, err := parseCron(cfg.Cron)
+		if err != nil {
+			return nil, err
+		}
+		s.cron = c
+		s.duration = time.Duration(cfg.Duration)
+		if s.duration < time.Minute || s.duration > maxDuration {
+			return nil, fmt.Errorf("invalid schedule duration %s: a cron schedule needs a duration between 1m and 168h", s.duration)
+		}
+	} else if cfg.Duration != 0 {
+		return nil, fmt.Errorf("invalid schedule: duration is only used with cron")
+	}
+
+	if !cfg.Outside.Valid() {
+		return nil, fmt.Errorf("invalid schedule outside policy %q: use queue or skip", cfg.Outside)
+	}
+	return s, nil
+}
+
+// Open reports whether the schedule allows syncing at t
+func (s *Schedule) Open(t time.Time) bool {
+	t = t.In(s.location)
+	for _, w := range s.exclude {
+		if w.contains(t) {
+			return false
+		}
+	}
+
+	if len(s.include) == 0 && s.cron == nil {
+		return true
+	}
+	for _, w := range s.include {
+		if w.contains(t) {
+			return true
+		}
+	}
+	if s.cron != nil {
+		// Open if the cron expression fired within the last duration
+		minute := t.Truncate(time.Minute)
+		for elapsed := time.Duration(0); elapsed < s.duration; elapsed += time.Minute {
+			if s.cron.matches(minute.Add(-elapsed)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// parseWindow parses "[days ]HH:MM-HH:MM", where days is a day, a range such
+// as Mon-Fri, or a comma separated list of either. Without days the window
+// applies every day.
+func parseWindow(text string) (window, error) {
+	var w window
+	fields := strings.Fields(text)
+	span := ""
+	switch len(fields) {
+	case 1:
+		span = fields[0]
+		for i := range w.days {
+			w.days[i] = true
+		}
+	case 2:
+		span = fields[1]
+		if err := parseDays(fields[0], &w.days); err != nil {
+			return w, fmt.Errorf("invalid schedule window %q: %w", text, err)
+		}
+	default:
+		return w, fmt.Errorf("invalid schedule window %q: use [days ]HH:MM-HH:MM", text)
+	}
+
+	start, end, ok := strings.Cut(span, "-")
+	if !ok {
+		return w, fmt.Errorf("invalid schedule window %q: use [days ]HH:MM-HH:MM", text)
+	}
+	var err error
+	if w.start, err = parseClock(start); err != nil {
+		return w, fmt.Errorf("invalid schedule window %q: %w", text, err)
+	}
+	if w.end, err = parseClock(end); err != nil {
+		return w, fmt.Errorf("invalid schedule window %q: %w", text, err)
+	}
+	return w, nil
+}
+
+// parseDays marks the days named in a list such as "Mon-Fri,Sun"
+func parseDays(text string, days *[7]bool) error {
+	for _, part := range strings.Split(text, ",") {
+		first, last, isRange := strings.Cut(part, "-")
+		from, ok := weekdays[strings.ToLower(first)]
+		if !ok {
+			return fmt.Errorf("unknown day %q", first)
+		}
+		to := from
+		if isRange {
+			if to, ok = weekdays[strings.ToLower(last)]; !ok {
+				return fmt.Errorf("unknown day %q", last)
+			}
+		}
+		for day := from; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == to {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parseClock parses HH:MM into minutes after midnight; 24:00 is midnight at
+// the end of the day
+func parseClock(text string) (int, error) {
+	t, err := time.Parse("15:04", text)
+	if err == nil {
+		return t.Hour()*60 + t.Minute(), nil
+	}
+	if text == "24:00" {
+		return 24 * 60, nil
+	}
+	return 0, fmt.Errorf("invalid time %q: use HH:MM", text)
+}
+
+// contains reports whether t, already in the schedule's location, falls in
+// the window
+func (w window) contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.start < w.end {
+		return w.days[t.Weekday()] && minute >= w.start && minute < w.end
+	}
+	// Past midnight: the late part of a listed day or the early part of the day after
+	yesterday := (t.Weekday() + 6) % 7
+	return (w.days[t.Weekday()] && minute >= w.start) || (w.days[yesterday] && minute < w.end)
+}
+
+// parseCron parses "minute hour day-of-month month day-of-week". Each field
+// is *, a number, a range a-b, any of those with a /step, or a comma
+// separated list; days of the week may also be names such as Mon.
+func parseCron(text string) (*cron, error) {
+	fields := strings.Fields(text)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("invalid cron expression %q: expected 5 fields", text)
+	}
+
+	c := &cron{domAny: fields[2] == "*", dowAny: fields[4] == "*"}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: minute: %w", text, err)
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: hour: %w", text, err)
+	}
+	if c.dom, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: day of month: %w", text, err)
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: month: %w", text, err)
+	}
+	dow := strings.ToLower(fields[4])
+	for name, day := range weekdays {
+		dow = strings.ReplaceAll(dow, name, strconv.Itoa(int(day)))
+	}
+	if c.dow, err = parseCronField(dow, 0, 7); err != nil {
+		return nil, fmt.Errorf("invalid cron expression %q: day of week: %w", text, err)
+	}
+	c.dow[0] = c.dow[0] || c.dow[7] // 7 is also Sunday
+	return c, nil
+}
+
+// parseCronField returns which values from min to max a field selects
+func parseCronField(field string, min, max int) ([]bool, error) {
+	selected := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		rangeText, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step %q", stepText)
+			}
+		}
+
+		from, to := min, max
+		if rangeText != "*" {
+			first, last, isRange := strings.Cut(rangeText, "-")
+			var err error
+			if from, err = strconv.Atoi(first); err != nil {
+				return nil, fmt.Errorf("invalid value %q", first)
+			}
+			to = from
+			if isRange {
+				if to, err = strconv.Atoi(last); err != nil {
+					return nil, fmt.Errorf("invalid value %q", last)
+				}
+			} else if hasStep {
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+
+		for value := from; value <= to; value += step {
+			selected[value] = true
+		}
+	}
+	return selected, nil
+}
+
+// matches reports whether the cron expression fires at the minute t
+func (c *cron) matches(t time.Time) bool {
+	if !c.minute[t.Minute()] || !c.hour[t.Hour()] || !c.month[int(t.Month())] {
+		return false
+	}
+	// As in cron, a restricted day of month or day of week is enough on its own
+	domMatch := c.dom[t.Day()]
+	dowMatch := c.dow[int(t.Weekday())]
+	switch {
+	case c.domAny && c.dowAny:
+		return true
+	case c.domAny:
+		return dowMatch
+	case c.dowAny:
+		return domMatch
+	default:
+		return domMatch || dowMatch
+	}
+}
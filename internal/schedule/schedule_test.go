@@ -0,0 +1,107 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+
+	"var-sync/pkg/models"
+)
+
+// at returns a UTC time on the week of Monday 2024-01-01
+func at(day time.Weekday, hour, minute int) time.Time {
+	return time.Date(2024, 1, 1+int(day+6)%7, hour, minute, 0, 0, time.UTC)
+}
+
+func TestScheduleWindows(t *testing.T) {
+	s, err := Parse(&models.Schedule{
+		Include:  []string{"Mon-Fri 22:00-06:00", "Sat,Sun 10:00-12:00"},
+		Exclude:  []string{"Wed 23:00-23:30"},
+		Timezone: "UTC",
+	})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	tests := []struct {
+		name string
+		time time.Time
+		open bool
+	}{
+		{"weeknight", at(time.Monday, 23, 0), true},
+		{"after midnight", at(time.Tuesday, 5, 59), true},
+		{"window closed", at(time.Tuesday, 6, 0), false},
+		{"weekday afternoon", at(time.Thursday, 14, 0), false},
+		{"after Friday night", at(time.Saturday, 2, 0), true},
+		{"after Sunday morning", at(time.Monday, 2, 0), false},
+		{"weekend morning", at(time.Sunday, 11, 0), true},
+		{"excluded", at(time.Wednesday, 23, 15), false},
+		{"after exclusion", at(time.Wednesday, 23, 30), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.Open(tt.time); got != tt.open {
+				t.Errorf("Open(%s) = %v, want %v", tt.time.Format("Mon 15:04"), got, tt.open)
+			}
+		})
+	}
+}
+
+func TestScheduleCron(t *testing.T) {
+	s, err := Parse(&models.Schedule{Cron: "30 2 * * sat,sun", Duration: models.Duration(time.Hour), Timezone: "UTC"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	if !s.Open(at(time.Saturday, 2, 30)) || !s.Open(at(time.Sunday, 3, 29)) {
+		t.Error("Schedule should be open for an hour after 02:30 at weekends")
+	}
+	if s.Open(at(time.Saturday, 3, 30)) || s.Open(at(time.Saturday, 2, 29)) || s.Open(at(time.Monday, 2, 45)) {
+		t.Error("Schedule should be closed outside the hour after 02:30 at weekends")
+	}
+
+	// A restricted day of month or day of week is enough on its own
+	s, err = Parse(&models.Schedule{Cron: "*/15 0-1 1 * 1", Duration: models.Duration(time.Minute), Timezone: "UTC"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !s.Open(at(time.Monday, 0, 45)) || !s.Open(at(time.Monday, 1, 15).AddDate(0, 0, 7)) {
+		t.Error("Schedule should open every 15 minutes on the 1st and on Mondays")
+	}
+	if s.Open(at(time.Monday, 0, 50)) || s.Open(at(time.Tuesday, 0, 45)) {
+		t.Error("Schedule should only open on the minute")
+	}
+}
+
+func TestScheduleWithoutWindows(t *testing.T) {
+	s, err := Parse(&models.Schedule{Exclude: []string{"12:00-13:00"}, Outside: models.ScheduleSkip, Timezone: "UTC"})
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	if !s.Open(at(time.Friday, 11, 0)) || s.Open(at(time.Friday, 12, 30)) {
+		t.Error("Schedule with only exclusions should be open outside them")
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule models.Schedule
+	}{
+		{"unknown day", models.Schedule{Include: []string{"Someday 02:00-04:00"}}},
+		{"bad time", models.Schedule{Include: []string{"25:00-04:00"}}},
+		{"missing end", models.Schedule{Exclude: []string{"Mon 02:00"}}},
+		{"short cron", models.Schedule{Cron: "0 2 * *", Duration: models.Duration(time.Hour)}},
+		{"cron out of range", models.Schedule{Cron: "0 24 * * *", Duration: models.Duration(time.Hour)}},
+		{"cron without duration", models.Schedule{Cron: "0 2 * * *"}},
+		{"duration without cron", models.Schedule{Duration: models.Duration(time.Hour)}},
+		{"unknown timezone", models.Schedule{Timezone: "Mars/Olympus"}},
+		{"unknown policy", models.Schedule{Outside: "drop"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(&tt.schedule); err == nil {
+				t.Error("Parse() should return error")
+			}
+		})
+	}
+}
@@ -0,0 +1,417 @@
+package schema
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"var-sync/internal/parser"
+)
+
+// Schema is a JSON Schema that target files are checked against after each
+// sync. It supports the keywords that describe configuration files: type,
+// enum, const, properties, required, additionalProperties, items, the
+// numeric, string and array bounds, pattern, allOf, anyOf, oneOf, not and
+// local $refs into definitions or $defs. Other keywords are ignored.
+type Schema struct {
+	root     map[string]any
+	patterns map[string]*regexp.Regexp
+}
+
+// maxErrors is how many violations Validate reports before giving up
+const maxErrors = 5
+
+// Load reads a JSON Schema from path, which may be written in any format the
+// parser reads, such as JSON or YAML
+func Load(path string) (*Schema, error) {
+	if strings.HasSuffix(path, ".cue") {
+		return nil, fmt.Errorf("schema %s: CUE schemas are not supported, use a JSON Schema", path)
+	}
+	root, err := parser.New().LoadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load schema %s: %w", path, err)
+	}
+	s := &Schema{root: root, patterns: make(map[string]*regexp.Regexp)}
+	if err := s.compile(root); err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// compile checks the patterns of schema and the schemas within it, so that
+// a schema that cannot be applied fails when it is loaded
+func (s *Schema) compile(schema any) error {
+	switch v := schema.(type) {
+	case map[string]any:
+		if pattern, ok := v["pattern"].(string); ok {
+			compiled, err := regexp.Compile(pattern)
+			if err != nil {
+				return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+			s.patterns[pattern] = compiled
+		}
+		if ref, ok := v["$ref"].(string); ok {
+			if _, err := s.resolve(ref); err != nil {
+				return err
+			}
+		}
+		for _, value := range v {
+			if err := s.compile(value); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, value := range v {
+			if err := s.compile(value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve returns the schema a local $ref such as #/$defs/port points to
+func (s *Schema) resolve(ref string) (any, error) {
+	if ref != "#" && !strings.HasPrefix(ref, "#/") {
+		return nil, fmt.Errorf("unsupported $ref %s: only references within the schema are supported", ref)
+	}
+	var current any = s.root
+	for _, token := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(ref, "#"), "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+		switch v := current.(type) {
+		case map[string]any:
+			current = v[token]
+		case []any:
+			index, err := strconv.Atoi(token)
+			if err != nil || index < 0 || index >= len(v) {
+				return nil, fmt.Errorf("$ref %s does not exist in the schema", ref)
+			}
+			current = v[index]
+		default:
+			current = nil
+		}
+		if current == nil {
+			return nil, fmt.Errorf("$ref %s does not exist in the schema", ref)
+		}
+	}
+	return current, nil
+}
+
+// Validate checks document against the schema, returning an error listing
+// the first violations found, or nil if it conforms
+func (s *Schema) Validate(document any) error {
+	var violations []string
+	s.validate(s.root, document, "", &violations, 0)
+	if len(violations) == 0 {
+		return nil
+	}
+	if len(violations) > maxErrors {
+		violations = append(violations[:maxErrors], fmt.Sprintf("and %d more", len(violations)-maxErrors))
+	}
+	return fmt.Errorf("%s", strings.Join(violations, "; "))
+}
+
+// validate appends to violations each way value at keyPath breaks schema
+func (s *Schema) validate(schema any, value any, keyPath string, violations *[]string, depth int) {
+	fail := func(format string, args ...any) {
+		at := keyPath
+		if at == "" {
+			at = "document"
+		}
+		*violations = append(*violations, at+": "+fmt.Sprintf(format, args...))
+	}
+
+	rules, ok := schema.(map[string]any)
+	if !ok {
+		if schema == false {
+			fail("is not allowed")
+		}
+		return
+	}
+	if depth > 64 {
+		fail("schema $refs nest too deeply")
+		return
+	}
+	if ref, ok := rules["$ref"].(string); ok {
+		if target, err := s.resolve(ref); err == nil {
+			s.validate(target, value, keyPath, violations, depth+1)
+		}
+	}
+
+	if types, ok := rules["type"]; ok && !matchesType(types, value) {
+		fail("must be %s, not %s", describeTypes(types), typeOf(value))
+		return
+	}
+	if allowed, ok := rules["enum"].([]any); ok {
+		found := false
+		for _, option := range allowed {
+			if equal(option, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("must be one of %s", formatValues(allowed))
+		}
+	}
+	if constant, ok := rules["const"]; ok && !equal(constant, value) {
+		fail("must be %v", constant)
+	}
+
+	switch v := value.(type) {
+	case map[string]any:
+		s.validateObject(rules, v, keyPath, violations, depth, fail)
+	case []any:
+		if min, ok := number(rules["minItems"]); ok && float64(len(v)) < min {
+			fail("must have at least %v items", min)
+		}
+		if max, ok := number(rules["maxItems"]); ok && float64(len(v)) > max {
+			fail("must have at most %v items", max)
+		}
+		if unique, _ := rules["uniqueItems"].(bool); unique {
+			for i := range v {
+				for j := 0; j < i; j++ {
+					if equal(v[i], v[j]) {
+						fail("items %d and %d must not be equal", j, i)
+					}
+				}
+			}
+		}
+		if items, ok := rules["items"]; ok {
+			for i, item := range v {
+				s.validate(items, item, fmt.Sprintf("%s[%d]", keyPath, i), violations, depth+1)
+			}
+		}
+	case string:
+		length := float64(len([]rune(v)))
+		if min, ok := number(rules["minLength"]); ok && length < min {
+			fail("must be at least %v characters long", min)
+		}
+		if max, ok := number(rules["maxLength"]); ok && length > max {
+			fail("must be at most %v characters long", max)
+		}
+		if pattern, ok := rules["pattern"].(string); ok && s.patterns[pattern] != nil && !s.patterns[pattern].MatchString(v) {
+			fail("must match %s", pattern)
+		}
+	default:
+		if n, ok := number(value); ok {
+			validateNumber(rules, n, fail)
+		}
+	}
+
+	if all, ok := rules["allOf"].([]any); ok {
+		for _, sub := range all {
+			s.validate(sub, value, keyPath, violations, depth+1)
+		}
+	}
+	if anyOf, ok := rules["anyOf"].([]any); ok && s.countMatches(anyOf, value, depth) == 0 {
+		fail("must match at least one schema of anyOf")
+	}
+	if oneOf, ok := rules["oneOf"].([]any); ok {
+		if matched := s.countMatches(oneOf, value, depth); matched != 1 {
+			fail("must match exactly one schema of oneOf, matches %d", matched)
+		}
+	}
+	if not, ok := rules["not"]; ok && s.countMatches([]any{not}, value, depth) == 1 {
+		fail("must not match the schema of not")
+	}
+}
+
+// validateObject checks the properties of an object
+func (s *Schema) validateObject(rules map[string]any, object map[string]any, keyPath string, violations *[]string, depth int, fail func(string, ...any)) {
+	child := func(key string) string {
+		if keyPath == "" {
+			return key
+		}
+		return keyPath + "." + key
+	}
+
+	if required, ok := rules["required"].([]any); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, exists := object[key]; !exists {
+					fail("is missing required key %s", key)
+				}
+			}
+		}
+	}
+	if min, ok := number(rules["minProperties"]); ok && float64(len(object)) < min {
+		fail("must have at least %v keys", min)
+	}
+	if max, ok := number(rules["maxProperties"]); ok && float64(len(object)) > max {
+		fail("must have at most %v keys", max)
+	}
+
+	properties, _ := rules["properties"].(map[string]any)
+	additional, hasAdditional := rules["additionalProperties"]
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if property, ok := properties[key]; ok {
+			s.validate(property, object[key], child(key), violations, depth+1)
+		} else if hasAdditional {
+			if additional == false {
+				fail("has key %s, which the schema does not allow", key)
+			} else {
+				s.validate(additional, object[key], child(key), violations, depth+1)
+			}
+		}
+	}
+}
+
+// countMatches returns how many of schemas value conforms to
+func (s *Schema) countMatches(schemas []any, value any, depth int) int {
+	matched := 0
+	for _, sub := range schemas {
+		var violations []string
+		s.validate(sub, value, "", &violations, depth+1)
+		if len(violations) == 0 {
+			matched++
+		}
+	}
+	return matched
+}
+
+// validateNumber checks the numeric bounds of a number
+func validateNumber(rules map[string]any, n float64, fail func(string, ...any)) {
+	if min, ok := number(rules["minimum"]); ok && n < min {
+		fail("must be at least %v", min)
+	}
+	if max, ok := number(rules["maximum"]); ok && n > max {
+		fail("must be at most %v", max)
+	}
+	if min, ok := number(rules["exclusiveMinimum"]); ok && n <= min {
+		fail("must be greater than %v", min)
+	}
+	if max, ok := number(rules["exclusiveMaximum"]); ok && n >= max {
+		fail("must be less than %v", max)
+	}
+	if step, ok := number(rules["multipleOf"]); ok && step > 0 {
+		if quotient := n / step; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			fail("must be a multiple of %v", step)
+		}
+	}
+}
+
+// matchesType reports whether value has the type, or one of the types, a
+// type keyword names
+func matchesType(types any, value any) bool {
+	names, ok := types.([]any)
+	if !ok {
+		names = []any{types}
+	}
+	actual := typeOf(value)
+	for _, name := range names {
+		switch name {
+		case actual:
+			return true
+		case "number":
+			if actual == "integer" {
+				return true
+			}
+		case "integer":
+			if n, ok := value.(float64); ok && n == math.Trunc(n) && !math.IsInf(n, 0) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// typeOf names the JSON Schema type of a parsed value
+func typeOf(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case int64:
+		return "integer"
+	case float64:
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// describeTypes writes the types a type keyword names, such as "string or null"
+func describeTypes(types any) string {
+	names, ok := types.([]any)
+	if !ok {
+		return fmt.Sprintf("%v", types)
+	}
+	parts := make([]string, len(names))
+	for i, name := range names {
+		parts[i] = fmt.Sprintf("%v", name)
+	}
+	return strings.Join(parts, " or ")
+}
+
+// formatValues lists the values of an enum
+func formatValues(values []any) string {
+	parts := make([]string, len(values))
+	for i, value := range values {
+		parts[i] = fmt.Sprintf("%v", value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// number returns a schema keyword or value as a float64, if it is a number
+func number(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	return 0, false
+}
+
+// equal compares two parsed values as JSON Schema does: numbers by value, so
+// that 1 equals 1.0, and arrays and objects item by item
+func equal(a, b any) bool {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		return ok && x == y
+	}
+	switch x := a.(type) {
+	case []any:
+		y, ok := b.([]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for i := range x {
+			if !equal(x[i], y[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		y, ok := b.(map[string]any)
+		if !ok || len(x) != len(y) {
+			return false
+		}
+		for key, value := range x {
+			other, exists := y[key]
+			if !exists || !equal(value, other) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
@@ -0,0 +1,123 @@
+package schema
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const serviceSchema = `{
+  "type": "object",
+  "required": ["server"],
+  "properties": {
+    "server": {
+      "type": "object",
+      "required": ["host", "port"],
+      "additionalProperties": false,
+      "properties": {
+        "host": {"type": "string", "minLength": 1, "pattern": "^[a-z0-9.-]+$"},
+        "port": {"$ref": "#/$defs/port"},
+        "mode": {"enum": ["dev", "prod"]},
+        "ratio": {"type": "number", "exclusiveMaximum": 1},
+        "tags": {"type": "array", "items": {"type": "string"}, "uniqueItems": true, "maxItems": 3},
+        "timeout": {"anyOf": [{"type": "integer"}, {"type": "string", "pattern": "^[0-9]+s$"}]}
+      }
+    }
+  },
+  "$defs": {
+    "port": {"type": "integer", "minimum": 1, "maximum": 65535}
+  }
+}`
+
+func writeSchema(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write schema: %v", err)
+	}
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	s, err := Load(writeSchema(t, "service.schema.json", serviceSchema))
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+
+	server := func(values map[string]any) map[string]any {
+		object := map[string]any{"host": "db.internal", "port": int64(5432)}
+		for key, value := range values {
+			if value == nil {
+				delete(object, key)
+			} else {
+				object[key] = value
+			}
+		}
+		return map[string]any{"server": object}
+	}
+
+	tests := []struct {
+		name     string
+		document map[string]any
+		expected string // A violation the error must mention, or "" if valid
+	}{
+		{"valid", server(map[string]any{"mode": "prod", "ratio": 0.5, "tags": []any{"a", "b"}, "timeout": "30s"}), ""},
+		{"integral float", server(map[string]any{"port": 8080.0, "timeout": int64(30)}), ""},
+		{"missing server", map[string]any{}, "document: is missing required key server"},
+		{"missing port", server(map[string]any{"port": nil}), "server: is missing required key port"},
+		{"wrong type", server(map[string]any{"port": "5432"}), "server.port: must be integer, not string"},
+		{"too large", server(map[string]any{"port": int64(70000)}), "server.port: must be at most 65535"},
+		{"empty host", server(map[string]any{"host": ""}), "server.host: must be at least 1 characters long"},
+		{"pattern", server(map[string]any{"host": "DB"}), "server.host: must match"},
+		{"enum", server(map[string]any{"mode": "test"}), "server.mode: must be one of dev, prod"},
+		{"exclusive", server(map[string]any{"ratio": int64(1)}), "server.ratio: must be less than 1"},
+		{"additional", server(map[string]any{"extra": true}), "has key extra, which the schema does not allow"},
+		{"items", server(map[string]any{"tags": []any{"a", int64(1)}}), "server.tags[1]: must be string"},
+		{"unique", server(map[string]any{"tags": []any{"a", "a"}}), "items 0 and 1 must not be equal"},
+		{"anyOf", server(map[string]any{"timeout": "soon"}), "must match at least one schema of anyOf"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.Validate(tt.document)
+			switch {
+			case tt.expected == "" && err != nil:
+				t.Errorf("Validate() returned error: %v", err)
+			case tt.expected != "" && err == nil:
+				t.Errorf("Validate() returned nil, want %q", tt.expected)
+			case tt.expected != "" && !strings.Contains(err.Error(), tt.expected):
+				t.Errorf("Validate() = %q, want it to mention %q", err, tt.expected)
+			}
+		})
+	}
+}
+
+func TestLoadYAMLSchema(t *testing.T) {
+	s, err := Load(writeSchema(t, "schema.yaml", "type: object\nproperties:\n  replicas:\n    type: integer\n    oneOf:\n      - minimum: 1\n      - const: 0\n"))
+	if err != nil {
+		t.Fatalf("Load() returned error: %v", err)
+	}
+	if err := s.Validate(map[string]any{"replicas": int64(3)}); err != nil {
+		t.Errorf("Validate() returned error: %v", err)
+	}
+	if err := s.Validate(map[string]any{"replicas": int64(-1)}); err == nil {
+		t.Error("Validate() should fail for a value matching no schema of oneOf")
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := map[string]string{
+		"bad.schema.json":  `{"properties": {"host": {"pattern": "("}}}`,
+		"ref.schema.json":  `{"$ref": "#/$defs/missing"}`,
+		"http.schema.json": `{"$ref": "https://example.com/schema.json"}`,
+		"service.cue":      `server: port: int`,
+	}
+	for name, content := range tests {
+		if _, err := Load(writeSchema(t, name, content)); err == nil {
+			t.Errorf("Load(%s) should fail", name)
+		}
+	}
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("Load() should fail for a schema that does not exist")
+	}
+}
@@ -0,0 +1,276 @@
+package state
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"var-sync/internal/backend"
+	"var-sync/internal/textfile"
+	"var-sync/pkg/models"
+)
+
+// Store remembers the value var-sync last wrote to each target key so that
+// hand edits made to a target since then can be detected. The state file is
+// shared with other var-sync processes, such as an undo run from the command
+// line while watching, and is reloaded whenever it changes on disk. It also
+// keeps the outcome of each rule's latest sync and what it last applied.
+type Store struct {
+	path    string
+	targets map[string]map[string]any
+	rules   map[string]RuleStatus
+	applied map[string]map[string]Applied
+	modTime time.Time
+	mutex   sync.Mutex
+}
+
+// RuleStatus is the outcome of a rule's latest sync
+type RuleStatus struct {
+	LastAttempt time.Time  `json:"last_attempt"`
+	LastSync    *time.Time `json:"last_sync,omitempty"` // Latest successful sync
+	Success     bool       `json:"success"`
+	Error       string     `json:"error,omitempty"`
+}
+
+// Applied is what a rule's latest successful sync applied to a target: the
+// checksums of the source and of the target just after, and the value written
+type Applied struct {
+	SourceHash string    `json:"source_hash,omitempty"`
+	TargetHash string    `json:"target_hash,omitempty"`
+	Value      any       `json:"value"`
+	At         time.Time `json:"at"`
+}
+
+// file is the on-disk layout of the state file
+type file struct {
+	Targets map[string]map[string]any     `json:"targets"`
+	Rules   map[string]RuleStatus         `json:"rules,omitempty"`
+	Applied map[string]map[string]Applied `json:"applied,omitempty"` // By rule ID and target
+}
+
+// Open loads the state file at path. A missing file starts an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		targets: make(map[string]map[string]any),
+		rules:   make(map[string]RuleStatus),
+		applied: make(map[string]map[string]Applied),
+	}
+	if err := s.reload(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// reload reads the state file again if it changed since it was last read
+func (s *Store) reload() error {
+	info, err := os.Stat(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+	if info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+
+	var contents file
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&contents); err != nil {
+		return fmt.Errorf("failed to parse state file: %w", err)
+	}
+
+	s.targets = make(map[string]map[string]any, len(contents.Targets))
+	for target, keys := range contents.Targets {
+		s.targets[target] = keys
+	}
+	s.rules = make(map[string]RuleStatus, len(contents.Rules))
+	for id, status := range contents.Rules {
+		s.rules[id] = status
+	}
+	s.applied = make(map[string]map[string]Applied, len(contents.Applied))
+	for id, targets := range contents.Applied {
+		s.applied[id] = targets
+	}
+	s.modTime = info.ModTime()
+	return nil
+}
+
+// LastWritten returns the value last recorded for key in targetFile
+func (s *Store) LastWritten(targetFile, key string) (any, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	// A state file that became unreadable keeps the last known values
+	s.reload()
+
+	value, ok := s.targets[targetPath(targetFile)][key]
+	return value, ok
+}
+
+// Record stores the values just written to targetFile and saves the state file
+func (s *Store) Record(targetFile string, values map[string]any) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	target := targetPath(targetFile)
+	if s.targets[target] == nil {
+		s.targets[target] = make(map[string]any)
+	}
+	for key, value := range values {
+		s.targets[target][key] = value
+	}
+
+	return s.save()
+}
+
+// Forget removes keys no longer in targetFile from its recorded values
+func (s *Store) Forget(targetFile string, keys []string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	target := targetPath(targetFile)
+	for _, key := range keys {
+		delete(s.targets[target], key)
+	}
+
+	return s.save()
+}
+
+// RecordResult stores the outcome of a sync event as its rule's latest
+func (s *Store) RecordResult(event models.SyncEvent) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	status := s.rules[event.RuleID]
+	status.LastAttempt = event.Timestamp
+	status.Success = event.Success
+	status.Error = event.Error
+	if event.Success {
+		at := event.Timestamp
+		status.LastSync = &at
+	}
+	s.rules[event.RuleID] = status
+
+	return s.save()
+}
+
+// RuleStatuses returns the outcome of the latest sync of every rule that has
+// synced, by rule ID
+func (s *Store) RuleStatuses() map[string]RuleStatus {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.reload()
+
+	statuses := make(map[string]RuleStatus, len(s.rules))
+	for id, status := range s.rules {
+		statuses[id] = status
+	}
+	return statuses
+}
+
+// RecordApplied stores what the rules by ID just applied to targetFile and
+// saves the state file
+func (s *Store) RecordApplied(targetFile string, applied map[string]Applied) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.reload(); err != nil {
+		return err
+	}
+
+	target := targetPath(targetFile)
+	for id, record := range applied {
+		if s.applied[id] == nil {
+			s.applied[id] = make(map[string]Applied)
+		}
+		s.applied[id][target] = record
+	}
+
+	return s.save()
+}
+
+// LastApplied returns what the rule with the given ID last applied to
+// targetFile
+func (s *Store) LastApplied(ruleID, targetFile string) (Applied, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.reload()
+
+	applied, ok := s.applied[ruleID][targetPath(targetFile)]
+	return applied, ok
+}
+
+// Checksum returns a checksum of parsed file content. It covers the values
+// alone, so reformatting a file or editing its comments does not change it.
+func Checksum(data map[string]any) string {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])
+}
+
+// save writes the state file atomically through a temporary file
+func (s *Store) save() error {
+	data, err := json.MarshalIndent(file{Targets: s.targets, Rules: s.rules, Applied: s.applied}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal state: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if err := textfile.Rename(tmp, s.path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
+
+// targetPath keys file targets by absolute path so relative and absolute rule
+// paths share state
+func targetPath(targetFile string) string {
+	if backend.IsRef(targetFile) {
+		return targetFile
+	}
+	if abs, err := filepath.Abs(targetFile); err == nil {
+		return abs
+	}
+	return targetFile
+}
@@ -0,0 +1,172 @@
+package state
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"var-sync/pkg/models"
+)
+
+func TestStoreRecordAndReopen(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "state.json")
+	target := filepath.Join(tempDir, "app.env")
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	if _, ok := store.LastWritten(target, "DB_PORT"); ok {
+		t.Error("LastWritten() found a value in an empty store")
+	}
+
+	if err := store.Record(target, map[string]any{"DB_PORT": 5432, "DB_HOST": "localhost"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if err := store.Record(target, map[string]any{"DB_HOST": "db.internal"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+
+	// Relative and absolute paths to the same target share state
+	wd, _ := os.Getwd()
+	relative, err := filepath.Rel(wd, target)
+	if err != nil {
+		t.Fatalf("Failed to make relative path: %v", err)
+	}
+	host, ok := reopened.LastWritten(relative, "DB_HOST")
+	if !ok || host != "db.internal" {
+		t.Errorf("LastWritten(DB_HOST) = %v, %v; expected db.internal", host, ok)
+	}
+	port, ok := reopened.LastWritten(target, "DB_PORT")
+	if !ok || port != json.Number("5432") {
+		t.Errorf("LastWritten(DB_PORT) = %#v, %v; expected 5432", port, ok)
+	}
+}
+
+func TestOpenCorruptState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	if err := os.WriteFile(path, []byte("{not json"), 0644); err != nil {
+		t.Fatalf("Failed to write test file: %v", err)
+	}
+	if _, err := Open(path); err == nil {
+		t.Error("Open() expected error for corrupt state file")
+	}
+}
+
+func TestStoreSeesOtherWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	first, _ := Open(path)
+	second, _ := Open(path)
+
+	if err := second.Record("app.env", map[string]any{"PORT": "9090"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if port, ok := first.LastWritten("app.env", "PORT"); !ok || port != "9090" {
+		t.Errorf("LastWritten() = %v, %v; expected value recorded by another store", port, ok)
+	}
+
+	// Recording through the first store keeps the other store's values
+	if err := first.Record("app.env", map[string]any{"HOST": "db"}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	reopened, _ := Open(path)
+	if _, ok := reopened.LastWritten("app.env", "PORT"); !ok {
+		t.Error("Record() discarded values written by another store")
+	}
+}
+
+func TestRecordResult(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	store, _ := Open(path)
+
+	synced := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := store.RecordResult(models.SyncEvent{RuleID: "rule-1", Timestamp: synced, Success: true}); err != nil {
+		t.Fatalf("RecordResult() error = %v", err)
+	}
+	failed := synced.Add(time.Hour)
+	if err := store.RecordResult(models.SyncEvent{RuleID: "rule-1", Timestamp: failed, Error: "source key not found"}); err != nil {
+		t.Fatalf("RecordResult() error = %v", err)
+	}
+
+	reopened, _ := Open(path)
+	status, ok := reopened.RuleStatuses()["rule-1"]
+	if !ok {
+		t.Fatal("RuleStatuses() lost the recorded rule")
+	}
+	if status.Success || status.Error != "source key not found" || !status.LastAttempt.Equal(failed) {
+		t.Errorf("Status should hold the latest failure, got %+v", status)
+	}
+	if status.LastSync == nil || !status.LastSync.Equal(synced) {
+		t.Errorf("LastSync = %v, want the earlier success %v", status.LastSync, synced)
+	}
+}
+
+func TestForget(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	store, _ := Open(path)
+
+	target := filepath.Join(dir, "app.env")
+	if err := store.Record(target, map[string]any{"DB_HOST": "db", "DB_PORT": 5432}); err != nil {
+		t.Fatalf("Record() error = %v", err)
+	}
+	if err := store.Forget(target, []string{"DB_PORT"}); err != nil {
+		t.Fatalf("Forget() error = %v", err)
+	}
+
+	reopened, _ := Open(path)
+	if _, ok := reopened.LastWritten(target, "DB_PORT"); ok {
+		t.Error("LastWritten() should not return a forgotten key")
+	}
+	if value, ok := reopened.LastWritten(target, "DB_HOST"); !ok || value != "db" {
+		t.Errorf("LastWritten(DB_HOST) = %v, %t, want db", value, ok)
+	}
+}
+
+func TestRecordApplied(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+	store, _ := Open(path)
+
+	target := filepath.Join(dir, "app.env")
+	applied := Applied{
+		SourceHash: Checksum(map[string]any{"database": map[string]any{"host": "db"}}),
+		TargetHash: Checksum(map[string]any{"DB_HOST": "db"}),
+		Value:      "db",
+		At:         time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	if err := store.RecordApplied(target, map[string]Applied{"rule-1": applied}); err != nil {
+		t.Fatalf("RecordApplied() error = %v", err)
+	}
+
+	reopened, _ := Open(path)
+	got, ok := reopened.LastApplied("rule-1", target)
+	if !ok {
+		t.Fatal("LastApplied() lost the recorded rule")
+	}
+	if got.SourceHash != applied.SourceHash || got.TargetHash != applied.TargetHash || got.Value != "db" || !got.At.Equal(applied.At) {
+		t.Errorf("LastApplied() = %+v, want %+v", got, applied)
+	}
+	if _, ok := reopened.LastApplied("rule-1", filepath.Join(dir, "other.env")); ok {
+		t.Error("LastApplied() should be kept per target")
+	}
+}
+
+func TestChecksum(t *testing.T) {
+	a := Checksum(map[string]any{"host": "db", "port": 5432})
+	b := Checksum(map[string]any{"port": 5432, "host": "db"})
+	if a == "" || a != b {
+		t.Errorf("Checksum() should not depend on key order, got %q and %q", a, b)
+	}
+	if a == Checksum(map[string]any{"host": "db", "port": 5433}) {
+		t.Error("Checksum() should change with the values")
+	}
+}
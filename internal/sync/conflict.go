@@ -0,0 +1,90 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"var-sync/pkg/models"
+)
+
+// PendingConflicts returns the conflict events in events that were held back
+// and have not been resolved since, newest first
+func PendingConflicts(events []models.SyncEvent) []models.SyncEvent {
+	resolved := make(map[string]bool)
+	for _, event := range events {
+		if event.Resolves != "" {
+			resolved[event.Resolves] = true
+		}
+	}
+
+	var pending []models.SyncEvent
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		if event.Conflict && !event.Success && !resolved[event.ID] {
+			pending = append(pending, event)
+		}
+	}
+	return pending
+}
+
+// ResolveConflict settles a held back conflict event. With overwrite the
+// synced value is written over the hand edit; otherwise the target is left
+// as it is. Either way the resolution is recorded in the history journal.
+func (s *Syncer) ResolveConflict(event models.SyncEvent, overwrite bool) (models.SyncEvent, error) {
+	if !event.Conflict || event.Success {
+		return models.SyncEvent{}, fmt.Errorf("event %s is not a pending conflict", event.ID)
+	}
+
+	var resolution models.SyncEvent
+	if overwrite {
+		value := event.NewValue
+		if event.Sensitive {
+			// The journal does not hold the synced value, so take it from the source again
+			sourceValue, err := s.sourceValue(event)
+			if err != nil {
+				return models.SyncEvent{}, err
+			}
+			value = sourceValue
+		}
+		written, err := s.writeValue(event, value)
+		if err != nil {
+			return models.SyncEvent{}, err
+		}
+		resolution = written
+	} else {
+		resolution = models.SyncEvent{
+			ID:         uuid.NewString(),
+			RuleID:     event.RuleID,
+			TargetFile: event.TargetFile,
+			TargetKey:  event.TargetKey,
+			Timestamp:  time.Now(),
+			OldValue:   event.OldValue,
+			NewValue:   event.OldValue,
+			Success:    true,
+			Sensitive:  event.Sensitive,
+		}
+	}
+	resolution.Resolves = event.ID
+
+	return resolution, s.record(resolution)
+}
+
+// sourceValue resolves the current source value of the rule that wrote an
+// event's target, or the value of every matched key for wildcard rules
+func (s *Syncer) sourceValue(event models.SyncEvent) (any, error) {
+	for _, rule := range models.ExpandRules(s.config.Rules) {
+		rule = s.backends.ResolveRule(rule)
+		if rule.ID != event.RuleID || rule.TargetFile != event.TargetFile {
+			continue
+		}
+		change := s.planRule(context.Background(), rule, make(map[string]map[string]any), make(map[string]error), make(map[string]any), make(map[string]bool), make(map[string]bool))
+		if change.Error != "" {
+			return nil, fmt.Errorf("rule %s: %s", event.RuleID, change.Error)
+		}
+		return change.NewValue, nil
+	}
+	return nil, fmt.Errorf("rule %s no longer exists", event.RuleID)
+}
@@ -0,0 +1,463 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"var-sync/internal/backend"
+	"var-sync/internal/diff"
+	"var-sync/internal/parser"
+	"var-sync/internal/render"
+	"var-sync/internal/textfile"
+	"var-sync/pkg/models"
+)
+
+// KeyChange describes the effect of a single rule on its target key
+type KeyChange struct {
+	RuleID    string
+	RuleName  string
+	TargetKey string
+	OldValue  any
+	NewValue  any
+	Error     string
+	Inactive  bool // The rule's when condition does not hold, so it does not sync
+	Sensitive bool // The rule keeps its values out of logs and history
+}
+
+// FileChange groups the key changes for one target file together with the
+// file content before and after applying them
+type FileChange struct {
+	TargetFile string
+	Keys       []KeyChange
+	Before     string
+	After      string
+
+	// The content before and after with the values of sensitive rules masked
+	RedactedBefore string
+	RedactedAfter  string
+}
+
+// Changed reports whether applying the plan would modify the target file
+func (c FileChange) Changed() bool {
+	return c.Before != c.After
+}
+
+// Diff returns a unified diff of the change to the target file, showing the
+// values of sensitive rules masked
+func (c FileChange) Diff() string {
+	return diff.UnifiedRedacted(c.TargetFile, c.TargetFile, c.Before, c.After, c.RedactedBefore, c.RedactedAfter)
+}
+
+// Failed reports whether any rule for the target file could not be resolved
+func (c FileChange) Failed() bool {
+	for _, key := range c.Keys {
+		if key.Error != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// Plan resolves every enabled rule against the current source files and
+// computes the resulting target file contents without writing anything.
+// Like the watcher, a target file is only modified when all of its rules
+// resolve successfully.
+func (s *Syncer) Plan() ([]FileChange, error) {
+	return s.PlanContext(context.Background())
+}
+
+// PlanContext is Plan, stopping with ctx's error once ctx is done
+func (s *Syncer) PlanContext(ctx context.Context) ([]FileChange, error) {
+	sources := make(map[string]map[string]any)
+	sourceErrors := make(map[string]error)
+
+	var changes []*FileChange
+	byTarget := make(map[string]*FileChange)
+	updatesByTarget := make(map[string]map[string]any)
+	createByTarget := make(map[string]map[string]bool)
+	secretByTarget := make(map[string]map[string]bool)
+	rendered := make(map[*FileChange]bool) // Changes planned by template rules
+
+	for _, rule := range models.ExpandRules(s.config.Rules) {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !rule.Enabled {
+			continue
+		}
+		rule = s.backends.ResolveRule(rule)
+		if rule.IsTemplate() {
+			change := s.planTemplate(ctx, rule, sources, sourceErrors)
+			rendered[change] = true
+			changes = append(changes, change)
+			continue
+		}
+
+		change, exists := byTarget[rule.TargetFile]
+		if !exists {
+			change = &FileChange{TargetFile: rule.TargetFile}
+			byTarget[rule.TargetFile] = change
+			updatesByTarget[rule.TargetFile] = make(map[string]any)
+			createByTarget[rule.TargetFile] = make(map[string]bool)
+			secretByTarget[rule.TargetFile] = make(map[string]bool)
+			changes = append(changes, change)
+		}
+
+		change.Keys = append(change.Keys, s.planRule(ctx, rule, sources, sourceErrors, updatesByTarget[rule.TargetFile], createByTarget[rule.TargetFile], secretByTarget[rule.TargetFile]))
+	}
+
+	result := make([]FileChange, 0, len(changes))
+	for _, change := range changes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if !rendered[change] {
+			s.planFile(ctx, change, updatesByTarget[change.TargetFile], createByTarget[change.TargetFile], secretByTarget[change.TargetFile])
+		}
+		result = append(result, *change)
+	}
+
+	return result, nil
+}
+
+// planRule resolves a single rule, recording its update in updates, the
+// target keys it may add in create and those of a sensitive rule in secret
+func (s *Syncer) planRule(ctx context.Context, rule models.SyncRule, sources map[string]map[string]any, sourceErrors map[string]error, updates map[string]any, create, secret map[string]bool) KeyChange {
+	change := KeyChange{
+		RuleID:    rule.ID,
+		RuleName:  rule.Name,
+		TargetKey: rule.TargetKey,
+		Sensitive: rule.IsSensitive(),
+	}
+
+	sourceData, err := s.loadSource(ctx, rule.SourceFile, sources, sourceErrors)
+	if err != nil {
+		change.Error = fmt.Sprintf("Failed to load source file: %v", err)
+		return change
+	}
+	if change.Inactive, err = s.inactive(sourceData, rule); err != nil || change.Inactive {
+		if err != nil {
+			change.Error = fmt.Sprintf("Failed to check when condition: %v", err)
+		}
+		return change
+	}
+
+	ruleUpdates, err := s.parser.ResolveRule(sourceData, rule)
+	if err != nil {
+		change.Error = fmt.Sprintf("Failed to get source value: %v", err)
+		return change
+	}
+
+	if targetData, err := s.backends.LoadContext(ctx, rule.TargetFile); err == nil {
+		change.OldValue, _ = s.parser.GetValue(targetData, rule.TargetKey)
+		if !rule.CreateMissing && !backend.IsRef(rule.TargetFile) && !parser.AddsMissingKeys(rule.TargetFile) {
+			var missing []string
+			for targetKey, value := range ruleUpdates {
+				arrayPath, _ := parser.AppendPath(targetKey)
+				if _, err := s.parser.GetValue(targetData, arrayPath); err != nil && value != parser.Deleted {
+					missing = append(missing, targetKey)
+				}
+			}
+			if len(missing) > 0 {
+				sort.Strings(missing)
+				change.Error = fmt.Sprintf("Target key %s does not exist; set create_missing on the rule to add it", missing[0])
+				return change
+			}
+		}
+	}
+	change.NewValue = ruleUpdates
+	for targetKey, value := range ruleUpdates {
+		updates[targetKey] = value
+		if targetKey == rule.TargetKey {
+			change.NewValue = value
+		}
+		if value == parser.Deleted {
+			change.NewValue = nil
+		}
+		if rule.CreateMissing {
+			create[targetKey] = true
+		}
+		if change.Sensitive {
+			secret[targetKey] = true
+		}
+	}
+
+	return change
+}
+
+// planTemplate renders the template of a template rule, which replaces its
+// whole target file
+func (s *Syncer) planTemplate(ctx context.Context, rule models.SyncRule, sources map[string]map[string]any, sourceErrors map[string]error) *FileChange {
+	change := &FileChange{TargetFile: rule.TargetFile}
+	key := KeyChange{RuleID: rule.ID, RuleName: rule.Name, Sensitive: rule.IsSensitive()}
+	defer func() {
+		change.Keys = append(change.Keys, key)
+		// The template writes the whole file, none of which is shown for a
+		// sensitive rule
+		if !key.Sensitive {
+			change.RedactedBefore, change.RedactedAfter = change.Before, change.After
+		}
+	}()
+
+	before, err := textfile.Read(rule.TargetFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		key.Error = fmt.Sprintf("Failed to read target file: %v", err)
+		return change
+	}
+	change.Before = string(before)
+	change.After = change.Before
+
+	sourceData, err := s.loadSource(ctx, rule.SourceFile, sources, sourceErrors)
+	if err != nil {
+		key.Error = fmt.Sprintf("Failed to load source file: %v", err)
+		return change
+	}
+	if key.Inactive, err = s.inactive(sourceData, rule); err != nil || key.Inactive {
+		if err != nil {
+			key.Error = fmt.Sprintf("Failed to check when condition: %v", err)
+		}
+		return change
+	}
+	rendered, err := render.Execute(rule.Template, sourceData)
+	if err != nil {
+		key.Error = fmt.Sprintf("Failed to sync template: %v", err)
+		return change
+	}
+	change.After = string(rendered)
+	return change
+}
+
+// inactive reports whether a rule's when condition does not hold for its
+// source, so that it would not sync
+func (s *Syncer) inactive(sourceData map[string]any, rule models.SyncRule) (bool, error) {
+	applies, err := s.parser.RuleApplies(sourceData, rule)
+	return err == nil && !applies, err
+}
+
+// loadSource loads a source once per plan, remembering its data in sources
+// or the error loading it in sourceErrors
+func (s *Syncer) loadSource(ctx context.Context, source string, sources map[string]map[string]any, sourceErrors map[string]error) (map[string]any, error) {
+	if data, exists := sources[source]; exists {
+		return data, nil
+	}
+	if err := sourceErrors[source]; err != nil {
+		return nil, err
+	}
+	data, err := s.backends.LoadContext(ctx, source)
+	if err != nil {
+		sourceErrors[source] = err
+		return nil, err
+	}
+	sources[source] = data
+	return data, nil
+}
+
+// planFile renders the target file content with all resolved updates applied,
+// adding the keys in create if missing. The keys in secret are masked in the
+// redacted content.
+func (s *Syncer) planFile(ctx context.Context, change *FileChange, updates map[string]any, create, secret map[string]bool) {
+	before, err := s.backends.ReadContext(ctx, change.TargetFile)
+	if errors.Is(err, os.ErrNotExist) {
+		// Left to Preview, which starts an env file that does not exist
+		// yet when its rules may create every key
+		before, err = "", nil
+	}
+	if err != nil {
+		s.failKeys(change, fmt.Sprintf("Failed to read target file: %v", err))
+		return
+	}
+	change.Before = before
+	change.After = change.Before
+	change.RedactedBefore, change.RedactedAfter = change.Before, change.After
+
+	if change.Failed() || len(updates) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(create))
+	for targetKey := range create {
+		keys = append(keys, targetKey)
+	}
+	after, err := s.backends.PreviewContext(ctx, change.TargetFile, updates, keys...)
+	if err != nil {
+		s.failKeys(change, fmt.Sprintf("Failed to update target file: %v", err))
+		return
+	}
+	change.After = after
+	change.RedactedAfter = after
+	if len(secret) > 0 {
+		s.redactFile(ctx, change, updates, keys, secret)
+	}
+}
+
+// redactFile renders the content of a target file before and after its
+// change with the values of the keys in secret masked. Content that cannot be
+// rendered is left empty, which hides the whole diff.
+func (s *Syncer) redactFile(ctx context.Context, change *FileChange, updates map[string]any, create []string, secret map[string]bool) {
+	change.RedactedBefore, change.RedactedAfter = "", ""
+
+	redacted := make(map[string]any, len(updates))
+	for targetKey, value := range updates {
+		redacted[targetKey] = value
+		if secret[targetKey] && value != parser.Deleted {
+			redacted[targetKey] = models.RedactedValue
+		}
+	}
+	after, err := s.backends.PreviewContext(ctx, change.TargetFile, redacted, create...)
+	if err != nil {
+		return
+	}
+
+	// Only the keys the target already has are masked before
+	before := change.Before
+	if targetData, err := s.backends.LoadContext(ctx, change.TargetFile); err == nil {
+		masked := make(map[string]any)
+		for targetKey := range secret {
+			if _, err := s.parser.GetValue(targetData, targetKey); err == nil {
+				masked[targetKey] = models.RedactedValue
+			}
+		}
+		if len(masked) > 0 {
+			if before, err = s.backends.PreviewContext(ctx, change.TargetFile, masked); err != nil {
+				return
+			}
+		}
+	}
+	change.RedactedBefore, change.RedactedAfter = before, after
+}
+
+// failKeys marks every key change for a target file as failed
+func (s *Syncer) failKeys(change *FileChange, message string) {
+	for i := range change.Keys {
+		if change.Keys[i].Error == "" {
+			change.Keys[i].Error = message
+		}
+	}
+}
+
+// DryRun prints a unified diff of every target file that a sync would modify,
+// along with any rules that could not be resolved, without touching disk
+func (s *Syncer) DryRun(w io.Writer) error {
+	return s.DryRunContext(context.Background(), w)
+}
+
+// DryRunContext is DryRun, stopping with ctx's error once ctx is done
+func (s *Syncer) DryRunContext(ctx context.Context, w io.Writer) error {
+	changes, err := s.PlanContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	modified := 0
+	for _, change := range changes {
+		for _, key := range change.Keys {
+			if key.Error != "" {
+				fmt.Fprintf(w, "# rule %s (%s): %s\n", key.RuleName, key.RuleID, key.Error)
+			} else if key.Inactive {
+				fmt.Fprintf(w, "# rule %s (%s): not synced, its when condition does not hold\n", key.RuleName, key.RuleID)
+			}
+		}
+
+		if !change.Changed() {
+			continue
+		}
+		modified++
+		fmt.Fprint(w, change.Diff())
+	}
+
+	if modified == 0 {
+		fmt.Fprintln(w, "No changes.")
+	}
+
+	return nil
+}
+
+// planReport is the JSON form of a dry run
+type planReport struct {
+	Changed int           `json:"changed"` // The number of target files a sync would modify
+	Failed  int           `json:"failed"`  // The number of rules that could not be resolved
+	Files   []plannedFile `json:"files"`
+}
+
+// plannedFile is the JSON form of a FileChange, with the change as a unified
+// diff rather than the whole file before and after
+type plannedFile struct {
+	TargetFile string       `json:"target_file"`
+	Changed    bool         `json:"changed"`
+	Diff       string       `json:"diff,omitempty"`
+	Rules      []plannedKey `json:"rules"`
+}
+
+// plannedKey is the JSON form of a KeyChange
+type plannedKey struct {
+	RuleID    string `json:"rule_id"`
+	RuleName  string `json:"rule_name"`
+	TargetKey string `json:"target_key,omitempty"`
+	OldValue  any    `json:"old_value"`
+	NewValue  any    `json:"new_value"`
+	Inactive  bool   `json:"inactive,omitempty"`
+	Sensitive bool   `json:"sensitive,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// DryRunJSON is DryRun, printing the plan as JSON for scripts: every target
+// file with whether a sync would modify it, its diff and the effect of each
+// of its rules
+func (s *Syncer) DryRunJSON(w io.Writer) error {
+	return s.DryRunJSONContext(context.Background(), w)
+}
+
+// DryRunJSONContext is DryRunJSON, stopping with ctx's error once ctx is done
+func (s *Syncer) DryRunJSONContext(ctx context.Context, w io.Writer) error {
+	changes, err := s.PlanContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	report := planReport{Files: make([]plannedFile, 0, len(changes))}
+	for _, change := range changes {
+		file := plannedFile{
+			TargetFile: change.TargetFile,
+			Changed:    change.Changed(),
+			Rules:      make([]plannedKey, 0, len(change.Keys)),
+		}
+		if file.Changed {
+			report.Changed++
+			file.Diff = change.Diff()
+		}
+		for _, key := range change.Keys {
+			if key.Error != "" {
+				report.Failed++
+			}
+			planned := plannedKey{
+				RuleID:    key.RuleID,
+				RuleName:  key.RuleName,
+				TargetKey: key.TargetKey,
+				OldValue:  key.OldValue,
+				NewValue:  key.NewValue,
+				Inactive:  key.Inactive,
+				Sensitive: key.Sensitive,
+				Error:     key.Error,
+			}
+			if key.Sensitive {
+				if planned.OldValue != nil {
+					planned.OldValue = models.RedactedValue
+				}
+				if planned.NewValue != nil {
+					planned.NewValue = models.RedactedValue
+				}
+			}
+			file.Rules = append(file.Rules, planned)
+		}
+		report.Files = append(report.Files, file)
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
@@ -0,0 +1,251 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"var-sync/internal/config"
+	"var-sync/pkg/models"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// configReloadDelay is how long the config file must be left alone before it
+// is reloaded, for editors that write in several steps
+const configReloadDelay = 500 * time.Millisecond
+
+// WatchConfig makes Run reload the rules whenever the config file at path, or
+// a file it includes, changes. Other settings still need a restart. It must
+// be called before Run.
+func (s *Syncer) WatchConfig(path string) {
+	s.configPath = path
+}
+
+// Reload asks Run to reload the rules from the config file, as when it
+// changes. It does nothing unless WatchConfig was called.
+func (s *Syncer) Reload() {
+	select {
+	case s.reloads <- struct{}{}:
+	default:
+	}
+}
+
+// watchConfig follows the config file and its includes until stop is closed,
+// calling apply with the rules of every valid new version that changes them
+func (s *Syncer) watchConfig(stop <-chan struct{}, apply func(rules []models.SyncRule) error) error {
+	fsw, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+
+	configFile, err := filepath.Abs(s.configPath)
+	if err != nil {
+		configFile = s.configPath
+	}
+	if err := fsw.Add(filepath.Dir(configFile)); err != nil {
+		fsw.Close()
+		return fmt.Errorf("failed to watch config file: %w", err)
+	}
+
+	// Included files are watched by their directories, so that new ones
+	// matching a pattern are picked up too
+	patterns := s.includePatterns(configFile)
+	for _, pattern := range patterns {
+		dir := filepath.Dir(pattern)
+		if strings.ContainsAny(dir, "*?[") || dir == filepath.Dir(configFile) {
+			continue
+		}
+		if err := fsw.Add(dir); err != nil {
+			s.logger.Warn("Failed to watch included directory %s: %v", dir, err)
+		}
+	}
+	relevant := func(name string) bool {
+		if name == configFile {
+			return true
+		}
+		for _, pattern := range patterns {
+			if matched, _ := filepath.Match(pattern, name); matched {
+				return true
+			}
+		}
+		return false
+	}
+
+	var timer *time.Timer
+	reload := func() {
+		s.rulesMutex.Lock()
+		defer s.rulesMutex.Unlock()
+		s.reloadConfig(apply)
+	}
+
+	go func() {
+		defer fsw.Close()
+		for {
+			select {
+			case <-stop:
+				if timer != nil {
+					timer.Stop()
+				}
+				return
+			case <-s.reloads:
+				s.logger.Info("Reloading config file")
+				go reload()
+			case event, ok := <-fsw.Events:
+				if !ok {
+					return
+				}
+				name, err := filepath.Abs(event.Name)
+				if err != nil {
+					name = event.Name
+				}
+				if !relevant(name) {
+					continue
+				}
+				if timer != nil {
+					timer.Stop()
+				}
+				timer = time.AfterFunc(configReloadDelay, reload)
+			case err, ok := <-fsw.Errors:
+				if !ok {
+					return
+				}
+				s.logger.Error("Config file watch error: %v", err)
+			}
+		}
+	}()
+
+	s.logger.Info("Watching %s for rule changes", s.configPath)
+	return nil
+}
+
+// includePatterns returns the config's include patterns as absolute paths
+func (s *Syncer) includePatterns(configFile string) []string {
+	patterns := make([]string, 0, len(s.config.Include))
+	for _, pattern := range s.config.Include {
+		pattern = models.ExpandPath(pattern)
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(filepath.Dir(configFile), pattern)
+		}
+		patterns = append(patterns, filepath.Clean(pattern))
+	}
+	return patterns
+}
+
+// reloadConfig loads the config file again and applies its rules if they
+// changed, logging each rule added, removed or changed. An invalid config is
+// logged and the current rules are kept.
+func (s *Syncer) reloadConfig(apply func(rules []models.SyncRule) error) {
+	// Editors may replace the file rather than write it, and loading a
+	// missing config would create an empty one
+	if _, err := os.Stat(s.configPath); err != nil {
+		s.logger.Debug("Config file is gone, keeping the current rules: %v", err)
+		return
+	}
+
+	cfg, err := config.Load(s.configPath)
+	if err == nil && s.config.Profile() != "" {
+		err = cfg.SelectProfile(s.config.Profile())
+	}
+	if err != nil {
+		s.logger.Error("Failed to reload config, keeping the current rules: %v", err)
+		return
+	}
+
+	added, changed, removed := diffRules(s.config.Rules, cfg.Rules)
+	if len(added) == 0 && len(changed) == 0 && len(removed) == 0 {
+		s.logger.Debug("Config file changed but its rules did not")
+		return
+	}
+
+	if err := apply(cfg.Rules); err != nil {
+		s.logger.Error("Failed to apply reloaded rules, keeping the current rules: %v", err)
+		return
+	}
+	s.config.Rules = cfg.Rules
+
+	s.logRuleChanges(added, changed, removed)
+	s.logger.Info("Reloaded config: %d rules added, %d changed, %d removed", len(added), len(changed), len(removed))
+}
+
+// editRules checks rules edited through the control API, applies them and
+// saves them to the config file, so that reloading it finds nothing changed.
+// Rules added with paths to expand are expanded as if loaded.
+func (s *Syncer) editRules(rules []models.SyncRule, apply func(rules []models.SyncRule) error) error {
+	s.rulesMutex.Lock()
+	defer s.rulesMutex.Unlock()
+
+	updated := *s.config
+	updated.Rules = append([]models.SyncRule(nil), rules...)
+	updated.ExpandPaths()
+	if err := config.Validate(&updated); err != nil {
+		return err
+	}
+
+	added, changed, removed := diffRules(s.config.Rules, updated.Rules)
+	if len(added) == 0 && len(changed) == 0 && len(removed) == 0 {
+		return nil
+	}
+	if err := apply(updated.Rules); err != nil {
+		return fmt.Errorf("failed to apply rules: %w", err)
+	}
+	if err := config.Save(&updated, s.configPath); err != nil {
+		if err := apply(s.config.Rules); err != nil {
+			s.logger.Error("Failed to restore the rules: %v", err)
+		}
+		return err
+	}
+	s.config.Rules = updated.Rules
+
+	s.logRuleChanges(added, changed, removed)
+	s.logger.Info("Edited rules: %d added, %d changed, %d removed", len(added), len(changed), len(removed))
+	return nil
+}
+
+// diffRules returns the rules of next that current does not have or has
+// differently, and the rules of current that next does not have
+func diffRules(current, next []models.SyncRule) (added, changed, removed []models.SyncRule) {
+	remaining := make(map[string]models.SyncRule, len(current))
+	for _, rule := range current {
+		remaining[rule.ID] = rule
+	}
+	for _, rule := range next {
+		old, exists := remaining[rule.ID]
+		delete(remaining, rule.ID)
+		switch {
+		case !exists:
+			added = append(added, rule)
+		case !sameRule(old, rule):
+			changed = append(changed, rule)
+		}
+	}
+	for _, rule := range current {
+		if _, ok := remaining[rule.ID]; ok {
+			removed = append(removed, rule)
+		}
+	}
+	return added, changed, removed
+}
+
+// logRuleChanges logs each rule added, changed or removed
+func (s *Syncer) logRuleChanges(added, changed, removed []models.SyncRule) {
+	for _, rule := range added {
+		s.logger.Info("Rule added: %s (%s)", rule.Name, rule.ID)
+	}
+	for _, rule := range changed {
+		s.logger.Info("Rule changed: %s (%s)", rule.Name, rule.ID)
+	}
+	for _, rule := range removed {
+		s.logger.Info("Rule removed: %s (%s)", rule.Name, rule.ID)
+	}
+}
+
+// sameRule reports whether two versions of a rule are the same
+func sameRule(a, b models.SyncRule) bool {
+	encodedA, errA := json.Marshal(a)
+	encodedB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(encodedA) == string(encodedB)
+}
@@ -1,39 +1,249 @@
 package sync
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
+	"var-sync/internal/backend"
+	"var-sync/internal/control"
+	"var-sync/internal/health"
+	"var-sync/internal/history"
+	"var-sync/internal/hooks"
 	"var-sync/internal/logger"
+	"var-sync/internal/metrics"
+	"var-sync/internal/notify"
+	"var-sync/internal/parser"
+	"var-sync/internal/state"
 	"var-sync/internal/watcher"
 	"var-sync/pkg/models"
 )
 
 type Syncer struct {
-	config  *models.Config
-	watcher *watcher.FileWatcher
-	logger  *logger.Logger
+	config      *models.Config
+	configPath  string        // Reloaded when it changes, if set
+	controlPath string        // Unix socket the control API is served on, if set
+	reloads     chan struct{} // Requests to reload the config file
+	rulesMutex  sync.Mutex    // Held while reloading or editing the rules
+	watcher     *watcher.FileWatcher
+	parser      *parser.Parser
+	backends    *backend.Registry
+	logger      *logger.Logger
 }
 
 func New(config *models.Config, logger *logger.Logger) *Syncer {
 	return &Syncer{
-		config: config,
-		logger: logger,
+		config:   config,
+		reloads:  make(chan struct{}, 1),
+		parser:   parser.New(),
+		backends: backend.FromConfig(config),
+		logger:   logger.Module("sync"),
 	}
 }
 
+// Start runs the sync service until SIGINT or SIGTERM, which stop it
+// gracefully: pending changes are synced and writes in progress finish. A
+// second SIGINT or SIGTERM exits straight away. SIGHUP rotates the log file
+// and reloads the rules from the config file.
 func (s *Syncer) Start() error {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigChan)
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		stopping := false
+		for {
+			select {
+			case sig := <-sigChan:
+				switch {
+				case sig != syscall.SIGHUP && stopping:
+					s.logger.Warn("Received %s again, exiting without waiting for pending syncs", sig)
+					os.Exit(1)
+				case sig != syscall.SIGHUP:
+					s.logger.Info("Received %s, finishing pending syncs; send it again to exit now", sig)
+					stopping = true
+					stop()
+				default:
+					if err := s.logger.Rotate(); err != nil {
+						s.logger.Error("Failed to rotate log file: %v", err)
+					} else {
+						s.logger.Info("Rotated log file")
+					}
+					s.Reload()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return s.RunContext(ctx)
+}
+
+// Run starts the watcher along with everything that follows its events and
+// keeps them going until stop is closed. The listeners receive every sync
+// event as well; like other watcher listeners they must not block.
+func (s *Syncer) Run(stop <-chan struct{}, listeners ...func(models.SyncEvent)) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return s.RunContext(ctx, listeners...)
+}
+
+// RunContext is Run, stopping gracefully once ctx is done. Remote backend
+// calls and retries still in progress when the shutdown timeout runs out are
+// cancelled.
+func (s *Syncer) RunContext(ctx context.Context, listeners ...func(models.SyncEvent)) error {
 	var err error
 	s.watcher, err = watcher.New(s.logger)
 	if err != nil {
 		return fmt.Errorf("failed to create watcher: %w", err)
 	}
 
+	s.watcher.SetBackupConfig(s.config.Backup)
+	s.watcher.SetSchemas(s.config.TargetSchemas())
+	s.watcher.SetBackends(s.backends)
+	s.watcher.SetPollInterval(s.config.PollInterval.Or(models.DefaultPollInterval))
+	s.watcher.SetWatchMode(s.config.WatchMode)
+	s.watcher.SetRetryPolicy(s.config.Retry)
+	s.watcher.SetDebounce(s.config.Debounce.Or(models.DefaultDebounce))
+	s.watcher.SetBatchDelay(s.config.BatchDelay.Or(models.DefaultBatchDelay))
+	s.watcher.SetBatchMaxDelay(time.Duration(s.config.BatchMaxDelay))
+	s.watcher.SetTargetMinInterval(time.Duration(s.config.TargetMinInterval))
+	s.watcher.SetSelfWriteWindow(s.config.SelfWriteWindow.Or(models.DefaultSelfWriteWindow))
+	s.watcher.SetShutdownTimeout(s.config.ShutdownTimeout.Or(models.DefaultShutdownTimeout))
+	if s.config.TargetWorkers > 0 {
+		s.watcher.SetTargetWorkers(s.config.TargetWorkers)
+	}
+	s.watcher.SetEventQueue(s.config.EventQueue)
+	s.watcher.SetReconcileInterval(time.Duration(s.config.ReconcileInterval))
+
+	store, err := state.Open(s.config.StatePath())
+	if err != nil {
+		return err
+	}
+	s.watcher.SetState(store)
+	s.watcher.OnEvent(func(event models.SyncEvent) {
+		if err := store.RecordResult(event); err != nil {
+			s.logger.Error("Failed to record result of rule %s: %v", event.RuleID, err)
+		}
+	})
+	s.watcher.SetConflictPolicy(s.config.Conflicts())
+	s.watcher.SetDrift(s.config.Drift)
+	s.watcher.SetStrictRules(s.config.StrictRules)
+
+	// Number events on from the last one recorded, so that they keep
+	// increasing across runs
+	if last, err := history.Read(s.config.HistoryPath(), history.Filter{Limit: 1}); err != nil {
+		s.logger.Warn("Failed to read the last sync event: %v", err)
+	} else if len(last) > 0 {
+		s.watcher.SetLastSequence(last[0].Sequence)
+	}
+
+	journal, err := history.Open(s.config.HistoryPath())
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+	s.watcher.OnEvent(func(event models.SyncEvent) {
+		if err := journal.Append(event.Redacted()); err != nil {
+			s.logger.Error("Failed to record sync event %s: %v", event.ID, err)
+		}
+	})
+
+	for _, listener := range listeners {
+		s.watcher.OnEvent(listener)
+	}
+
+	runner := hooks.New(s.config, s.logger)
+	if runner.Enabled() {
+		s.watcher.OnEvent(runner.Fire)
+		// Let running hooks finish, such as a service restart, before exiting
+		defer runner.Wait()
+	}
+
+	dispatcher := notify.New(s.config, s.logger)
+	if dispatcher.Enabled() {
+		s.watcher.OnEvent(dispatcher.Record)
+		defer dispatcher.Wait()
+	}
+
+	muxes := make(map[string]*http.ServeMux)
+	mux := func(addr string) *http.ServeMux {
+		if muxes[addr] == nil {
+			muxes[addr] = http.NewServeMux()
+		}
+		return muxes[addr]
+	}
+
+	if s.config.Metrics != nil && s.config.Metrics.Listen != "" {
+		collector := metrics.New()
+		collector.SetStats(s.watcher.Stats)
+		s.watcher.OnEvent(collector.Record)
+		mux(s.config.Metrics.Listen).Handle("/metrics", collector)
+		s.logger.Info("Serving metrics on %s/metrics", s.config.Metrics.Listen)
+	}
+
+	if s.config.Health != nil && s.config.Health.Listen != "" {
+		monitor := health.New(s.watcher)
+		s.watcher.OnEvent(monitor.Record)
+		mux(s.config.Health.Listen).HandleFunc("/healthz", monitor.Healthz)
+		mux(s.config.Health.Listen).HandleFunc("/status", monitor.Status)
+		s.logger.Info("Serving health checks on %s/healthz and %s/status", s.config.Health.Listen, s.config.Health.Listen)
+	}
+
+	for addr, handler := range muxes {
+		server, err := s.serve(addr, handler)
+		if err != nil {
+			return err
+		}
+		defer server.Close()
+	}
+
 	if err := s.watcher.SetRules(s.config.Rules); err != nil {
 		return fmt.Errorf("failed to set watcher rules: %w", err)
 	}
+	apply := func(rules []models.SyncRule) error {
+		if err := s.watcher.SetRules(rules); err != nil {
+			return err
+		}
+		runner.SetRules(rules)
+		dispatcher.SetRules(rules)
+		return nil
+	}
+
+	if s.controlPath != "" {
+		server := control.New(s.watcher, s.logger)
+		s.watcher.OnEvent(server.Record)
+		s.logger.OnEntry(server.RecordLog)
+		if s.configPath != "" {
+			server.SetRuleEditor(func(rules []models.SyncRule) error {
+				return s.editRules(rules, apply)
+			})
+		}
+		if err := server.Listen(s.controlPath); err != nil {
+			s.logger.Error("Control API not available: %v", err)
+		} else {
+			defer server.Close()
+			s.logger.Info("Serving the control API on %s", s.controlPath)
+		}
+	}
 
 	s.logger.Info("Starting sync service with %d rules", len(s.config.Rules))
 
@@ -41,17 +251,40 @@ func (s *Syncer) Start() error {
 		return fmt.Errorf("failed to start watcher: %w", err)
 	}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	s.logger.Info("Sync service started. Press Ctrl+C to stop.")
-	
-	// Keep the service running until signal received
-	select {
-	case <-sigChan:
-		// Received termination signal
+	if s.configPath != "" {
+		if err := s.watchConfig(ctx.Done(), apply); err != nil {
+			s.logger.Error("Rules will not be reloaded: %v", err)
+		}
 	}
 
+	s.logger.Info("Sync service started")
+	<-ctx.Done()
+
 	s.logger.Info("Shutting down sync service...")
 	return s.watcher.Stop()
-}
\ No newline at end of file
+}
+
+// ServeControl makes Run serve the control API on a unix socket at path, for
+// the TUI and scripts to list, sync, pause and resume rules and follow sync
+// events and logs. Rules can be edited through it too if WatchConfig was
+// called. It must be called before Run.
+func (s *Syncer) ServeControl(path string) {
+	s.controlPath = path
+}
+
+// serve starts an HTTP server for handler on addr, failing straight away if
+// the address cannot be listened on
+func (s *Syncer) serve(addr string, handler http.Handler) (*http.Server, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+
+	server := &http.Server{Handler: handler}
+	go func() {
+		if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+			s.logger.Error("HTTP server on %s stopped: %v", addr, err)
+		}
+	}()
+	return server, nil
+}
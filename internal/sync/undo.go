@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"var-sync/internal/backend"
+	"var-sync/internal/backup"
+	"var-sync/internal/history"
+	"var-sync/internal/parser"
+	"var-sync/internal/state"
+	"var-sync/pkg/models"
+)
+
+// Undo reverts a recorded sync event by writing its old value back to the
+// target key with the surgical updater. The revert is itself recorded in the
+// history journal as a new event marked as undoing the original.
+func (s *Syncer) Undo(event models.SyncEvent) (models.SyncEvent, error) {
+	if !event.Success {
+		return models.SyncEvent{}, fmt.Errorf("event %s did not succeed and has nothing to undo", event.ID)
+	}
+	if event.Sensitive {
+		return models.SyncEvent{}, fmt.Errorf("event %s belongs to a sensitive rule whose values are not recorded", event.ID)
+	}
+	if event.OldValue == nil {
+		return models.SyncEvent{}, fmt.Errorf("event %s has no previous value to restore", event.ID)
+	}
+
+	undo, err := s.writeValue(event, event.OldValue)
+	if err != nil {
+		return models.SyncEvent{}, err
+	}
+	undo.UndoOf = event.ID
+
+	return undo, s.record(undo)
+}
+
+// writeValue writes value to the target key of a recorded event, backing the
+// target up first if its rule asks for it, and returns the event describing
+// the write. For wildcard rules value holds one value per matched key.
+func (s *Syncer) writeValue(event models.SyncEvent, value any) (models.SyncEvent, error) {
+	if event.TargetFile == "" || event.TargetKey == "" {
+		return models.SyncEvent{}, fmt.Errorf("event %s does not record its target", event.ID)
+	}
+
+	updates := map[string]any{event.TargetKey: value}
+	if parser.HasWildcard(event.TargetKey) {
+		// Wildcard events record the value of every matched key
+		values, ok := value.(map[string]any)
+		if !ok {
+			return models.SyncEvent{}, fmt.Errorf("event %s has no per-key values to write", event.ID)
+		}
+		updates = values
+	}
+
+	written := models.SyncEvent{
+		ID:         uuid.NewString(),
+		RuleID:     event.RuleID,
+		TargetFile: event.TargetFile,
+		TargetKey:  event.TargetKey,
+		Timestamp:  time.Now(),
+		NewValue:   value,
+		Sensitive:  event.Sensitive || s.sensitive(event.RuleID),
+	}
+
+	targetData, err := s.backends.Load(event.TargetFile)
+	if err != nil {
+		return models.SyncEvent{}, fmt.Errorf("failed to load target file: %w", err)
+	}
+	written.OldValue, _ = s.parser.GetValue(targetData, event.TargetKey)
+
+	if !backend.IsRef(event.TargetFile) && s.backupEnabled(event.RuleID) {
+		if _, err := backup.New(s.config.Backup).Backup(event.TargetFile); err != nil {
+			return models.SyncEvent{}, fmt.Errorf("failed to back up target file: %w", err)
+		}
+	}
+
+	// A key removed with its source key is added back
+	var create []string
+	if event.Deleted {
+		for targetKey := range updates {
+			create = append(create, targetKey)
+		}
+	}
+	if err := s.backends.Update(event.TargetFile, updates, create...); err != nil {
+		return models.SyncEvent{}, fmt.Errorf("failed to write target value: %w", err)
+	}
+	written.Success = true
+
+	store, err := state.Open(s.config.StatePath())
+	if err != nil {
+		return written, err
+	}
+	if err := store.Record(event.TargetFile, updates); err != nil {
+		return written, err
+	}
+
+	return written, nil
+}
+
+// record appends an event to the history journal, masking sensitive values
+func (s *Syncer) record(event models.SyncEvent) error {
+	journal, err := history.Open(s.config.HistoryPath())
+	if err != nil {
+		return err
+	}
+	defer journal.Close()
+	return journal.Append(event.Redacted())
+}
+
+// sensitive reports whether the rule with the given ID keeps its values
+// out of logs and history
+func (s *Syncer) sensitive(ruleID string) bool {
+	for _, rule := range s.config.Rules {
+		if rule.ID == ruleID {
+			return s.backends.ResolveRule(rule).IsSensitive()
+		}
+	}
+	return false
+}
+
+// backupEnabled reports whether the rule with the given ID wants a backup,
+// falling back to the global setting for rules that no longer exist
+func (s *Syncer) backupEnabled(ruleID string) bool {
+	for _, rule := range s.config.Rules {
+		if rule.ID == ruleID {
+			return rule.BackupEnabled(s.config.Backup)
+		}
+	}
+	return s.config.Backup != nil && s.config.Backup.Enabled
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package textfile
+
+import "os"
+
+// restoreOwner does nothing where files have no Unix owner
+func restoreOwner(path string, info os.FileInfo) error {
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package textfile
+
+import (
+	"os"
+	"syscall"
+)
+
+// restoreOwner gives path back the owner and group recorded in info, if it
+// lost them and this process is privileged enough to change them
+func restoreOwner(path string, info os.FileInfo) error {
+	before, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || os.Geteuid() != 0 {
+		return nil
+	}
+	current, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if after, ok := current.Sys().(*syscall.Stat_t); ok && after.Uid == before.Uid && after.Gid == before.Gid {
+		return nil
+	}
+	return os.Chown(path, int(before.Uid), int(before.Gid))
+}
@@ -0,0 +1,8 @@
+//go:build !windows
+
+package textfile
+
+// retry runs op, a write to a file, once
+func retry(op func() error) error {
+	return op()
+}
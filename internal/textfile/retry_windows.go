@@ -0,0 +1,28 @@
+//go:build windows
+
+package textfile
+
+import (
+	"errors"
+	"syscall"
+	"time"
+)
+
+// errSharingViolation is the error Windows returns for a file another
+// process has open without sharing it
+const errSharingViolation = syscall.Errno(32)
+
+// retry runs op, a write to a file. Windows refuses to write or replace a
+// file another process has open, as an editor or virus scanner may for a
+// moment, so op is retried for up to a second while it is refused.
+func retry(op func() error) error {
+	var err error
+	for attempt := 0; attempt < 20; attempt++ {
+		err = op()
+		if err == nil || !errors.Is(err, syscall.ERROR_ACCESS_DENIED) && !errors.Is(err, errSharingViolation) {
+			return err
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return err
+}
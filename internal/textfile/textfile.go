@@ -0,0 +1,99 @@
+package textfile
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// bom is the UTF-8 byte order mark some editors write at the start of a file
+var bom = []byte{0xEF, 0xBB, 0xBF}
+
+// Style is how a text file is laid out on disk beyond its content: whether it
+// starts with a byte order mark and whether its lines end in CRLF
+type Style struct {
+	BOM  bool
+	CRLF bool
+}
+
+// Detect returns the style of content. A file whose first line ends in CRLF
+// is taken to use CRLF throughout.
+func Detect(content []byte) Style {
+	style := Style{BOM: bytes.HasPrefix(content, bom)}
+	if line := bytes.IndexByte(content, '\n'); line > 0 {
+		style.CRLF = content[line-1] == '\r'
+	}
+	return style
+}
+
+// Normalize returns content without a byte order mark and with LF line
+// endings, which is what the parsers and editors work with
+func Normalize(content []byte) []byte {
+	content = bytes.TrimPrefix(content, bom)
+	return bytes.ReplaceAll(content, []byte("\r\n"), []byte("\n"))
+}
+
+// Apply returns normalized content laid out in the style. Content already in
+// the style is returned unchanged.
+func (s Style) Apply(content []byte) []byte {
+	if s.CRLF {
+		content = bytes.ReplaceAll(Normalize(content), []byte("\n"), []byte("\r\n"))
+	}
+	if s.BOM && !bytes.HasPrefix(content, bom) {
+		content = append(append([]byte{}, bom...), content...)
+	}
+	return content
+}
+
+// Read reads the file at path and returns its normalized content
+func Read(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return Normalize(content), nil
+}
+
+// Write writes content to path in the style of the file already there, so a
+// file with a byte order mark or CRLF line endings keeps them, and keeps its
+// permissions and, when running with the privileges to, its owner. A new file
+// is created with permissions 0644. A path that is a symbolic link is written
+// through to the file it points to, leaving the link in place.
+func Write(path string, content []byte) error {
+	if existing, err := os.ReadFile(path); err == nil {
+		content = Detect(existing).Apply(content)
+	}
+	return Replace(path, content)
+}
+
+// Replace writes content to path exactly as given, keeping the permissions and
+// owner of the file already there. It is meant for putting back content read
+// from the file earlier, such as a backup.
+func Replace(path string, content []byte) error {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		path = resolved
+	}
+	info, statErr := os.Stat(path)
+	if err := retry(func() error { return os.WriteFile(path, content, 0644) }); err != nil {
+		return err
+	}
+	if statErr != nil {
+		return nil
+	}
+
+	if current, err := os.Stat(path); err == nil && current.Mode().Perm() != info.Mode().Perm() {
+		if err := os.Chmod(path, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to restore permissions of %s: %w", path, err)
+		}
+	}
+	if err := restoreOwner(path, info); err != nil {
+		return fmt.Errorf("failed to restore owner of %s: %w", path, err)
+	}
+	return nil
+}
+
+// Rename moves the file at from to to, replacing any file there
+func Rename(from, to string) error {
+	return retry(func() error { return os.Rename(from, to) })
+}
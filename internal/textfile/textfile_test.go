@@ -0,0 +1,102 @@
+package textfile
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestStyle(t *testing.T) {
+	tests := []struct {
+		name     string
+		original string
+		expected Style
+	}{
+		{"plain", "a=1\nb=2\n", Style{}},
+		{"crlf", "a=1\r\nb=2\r\n", Style{CRLF: true}},
+		{"bom", "\xEF\xBB\xBFa=1\n", Style{BOM: true}},
+		{"both", "\xEF\xBB\xBFa=1\r\n", Style{BOM: true, CRLF: true}},
+		{"one line", "a=1", Style{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			style := Detect([]byte(tt.original))
+			if style != tt.expected {
+				t.Fatalf("Detect() = %+v, want %+v", style, tt.expected)
+			}
+			normalized := Normalize([]byte(tt.original))
+			if got := string(style.Apply(normalized)); got != tt.original {
+				t.Errorf("Apply(Normalize()) = %q, want %q", got, tt.original)
+			}
+			if got := string(style.Apply([]byte(tt.original))); got != tt.original {
+				t.Errorf("Apply() changed content already in the style to %q", got)
+			}
+		})
+	}
+}
+
+func TestWriteKeepsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.env")
+	if err := os.WriteFile(path, []byte("\xEF\xBB\xBFA=1\r\nB=2\r\n"), 0600); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		t.Fatalf("Failed to set permissions: %v", err)
+	}
+
+	content, err := Read(path)
+	if err != nil {
+		t.Fatalf("Read() returned error: %v", err)
+	}
+	if string(content) != "A=1\nB=2\n" {
+		t.Errorf("Read() = %q, want normalized content", content)
+	}
+
+	if err := Write(path, []byte("A=3\nB=2\n")); err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+	written, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if string(written) != "\xEF\xBB\xBFA=3\r\nB=2\r\n" {
+		t.Errorf("Write() wrote %q, want the BOM and CRLF line endings kept", written)
+	}
+	if info, err := os.Stat(path); err != nil || runtime.GOOS != "windows" && info.Mode().Perm() != 0600 {
+		t.Errorf("Write() left permissions %v, want 0600", info.Mode().Perm())
+	}
+
+	newPath := filepath.Join(t.TempDir(), "new.env")
+	if err := Write(newPath, []byte("A=1\n")); err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+	if written, _ := os.ReadFile(newPath); string(written) != "A=1\n" {
+		t.Errorf("Write() wrote %q to a new file, want it as given", written)
+	}
+}
+
+func TestWriteThroughSymlink(t *testing.T) {
+	dir := t.TempDir()
+	real := filepath.Join(dir, "..2024_01_01", "app.env")
+	if err := os.MkdirAll(filepath.Dir(real), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+	if err := os.WriteFile(real, []byte("A=1\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	link := filepath.Join(dir, "app.env")
+	if err := os.Symlink(real, link); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+
+	if err := Write(link, []byte("A=2\n")); err != nil {
+		t.Fatalf("Write() returned error: %v", err)
+	}
+	if info, err := os.Lstat(link); err != nil || info.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("Write() replaced the symlink %s", link)
+	}
+	if content, _ := os.ReadFile(real); string(content) != "A=2\n" {
+		t.Errorf("Write() left %q in the linked file, want it written through", content)
+	}
+}
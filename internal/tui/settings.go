@@ -0,0 +1,351 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"var-sync/internal/config"
+	"var-sync/internal/logger"
+	"var-sync/pkg/models"
+
+	"github.com/charmbracelet/bubbles/key"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+// setting is a global config setting edited in the settings screen. Only the
+// first notifier can be edited here; any others are kept as they are.
+type setting struct {
+	label       string
+	placeholder string
+	get         func(cfg *models.Config) string
+	set         func(cfg *models.Config, value string) error
+}
+
+var settings = []setting{
+	{
+		label:       "Log file",
+		placeholder: "var-sync.log",
+		get:         func(cfg *models.Config) string { return cfg.LogFile },
+		set: func(cfg *models.Config, value string) error {
+			cfg.LogFile = value
+			return nil
+		},
+	},
+	{
+		label:       "Debug logging",
+		placeholder: "true or false",
+		get:         func(cfg *models.Config) string { return strconv.FormatBool(cfg.Debug) },
+		set: func(cfg *models.Config, value string) (err error) {
+			cfg.Debug, err = parseBool(value)
+			return err
+		},
+	},
+	{
+		label:       "Debounce",
+		placeholder: fmt.Sprintf("default %s", models.DefaultDebounce),
+		get:         func(cfg *models.Config) string { return formatDuration(cfg.Debounce) },
+		set: func(cfg *models.Config, value string) (err error) {
+			cfg.Debounce, err = parseDuration(value)
+			return err
+		},
+	},
+	{
+		label:       "Batch delay",
+		placeholder: fmt.Sprintf("default %s", models.DefaultBatchDelay),
+		get:         func(cfg *models.Config) string { return formatDuration(cfg.BatchDelay) },
+		set: func(cfg *models.Config, value string) (err error) {
+			cfg.BatchDelay, err = parseDuration(value)
+			return err
+		},
+	},
+	{
+		label:       "Batch max delay",
+		placeholder: "no limit",
+		get:         func(cfg *models.Config) string { return formatDuration(cfg.BatchMaxDelay) },
+		set: func(cfg *models.Config, value string) (err error) {
+			cfg.BatchMaxDelay, err = parseDuration(value)
+			return err
+		},
+	},
+	{
+		label:       "Target min interval",
+		placeholder: "no limit",
+		get:         func(cfg *models.Config) string { return formatDuration(cfg.TargetMinInterval) },
+		set: func(cfg *models.Config, value string) (err error) {
+			cfg.TargetMinInterval, err = parseDuration(value)
+			return err
+		},
+	},
+	{
+		label:       "Backups",
+		placeholder: "true or false",
+		get: func(cfg *models.Config) string {
+			return strconv.FormatBool(cfg.Backup != nil && cfg.Backup.Enabled)
+		},
+		set: func(cfg *models.Config, value string) (err error) {
+			cfg.Backup.Enabled, err = parseBool(value)
+			return err
+		},
+	},
+	{
+		label:       "Backup directory",
+		placeholder: "next to each target file",
+		get: func(cfg *models.Config) string {
+			if cfg.Backup == nil {
+				return ""
+			}
+			return cfg.Backup.Dir
+		},
+		set: func(cfg *models.Config, value string) error {
+			cfg.Backup.Dir = value
+			return nil
+		},
+	},
+	{
+		label:       "Backup versions",
+		placeholder: "versions kept per target, empty for no limit",
+		get: func(cfg *models.Config) string {
+			if cfg.Backup == nil || cfg.Backup.MaxVersions == 0 {
+				return ""
+			}
+			return strconv.Itoa(cfg.Backup.MaxVersions)
+		},
+		set: func(cfg *models.Config, value string) (err error) {
+			cfg.Backup.MaxVersions, err = parseInt(value)
+			return err
+		},
+	},
+	{
+		label:       "Notifier type",
+		placeholder: "slack, discord or webhook, empty for none",
+		get:         func(cfg *models.Config) string { return string(firstNotifier(cfg).Type) },
+		set: func(cfg *models.Config, value string) error {
+			cfg.Notifications[0].Type = models.NotifierType(value)
+			return nil
+		},
+	},
+	{
+		label:       "Notifier URL",
+		placeholder: "https://hooks.slack.com/services/...",
+		get:         func(cfg *models.Config) string { return firstNotifier(cfg).URL },
+		set: func(cfg *models.Config, value string) error {
+			cfg.Notifications[0].URL = value
+			return nil
+		},
+	},
+	{
+		label:       "Notifier channel",
+		placeholder: "optional",
+		get:         func(cfg *models.Config) string { return firstNotifier(cfg).Channel },
+		set: func(cfg *models.Config, value string) error {
+			cfg.Notifications[0].Channel = value
+			return nil
+		},
+	},
+	{
+		label:       "Min severity",
+		placeholder: "info, warning or error",
+		get:         func(cfg *models.Config) string { return string(firstNotifier(cfg).MinSeverity) },
+		set: func(cfg *models.Config, value string) error {
+			cfg.Notifications[0].MinSeverity = models.Severity(value)
+			return nil
+		},
+	},
+	{
+		label:       "Failure threshold",
+		placeholder: fmt.Sprintf("failures in a row before notifying, default %d", models.DefaultFailureThreshold),
+		get: func(cfg *models.Config) string {
+			if threshold := firstNotifier(cfg).FailureThreshold; threshold != 0 {
+				return strconv.Itoa(threshold)
+			}
+			return ""
+		},
+		set: func(cfg *models.Config, value string) (err error) {
+			cfg.Notifications[0].FailureThreshold, err = parseInt(value)
+			return err
+		},
+	},
+}
+
+// firstNotifier returns the notifier edited in the settings screen, empty if
+// there is none
+func firstNotifier(cfg *models.Config) models.Notifier {
+	if len(cfg.Notifications) == 0 {
+		return models.Notifier{}
+	}
+	return cfg.Notifications[0]
+}
+
+func parseBool(value string) (bool, error) {
+	if value == "" {
+		return false, nil
+	}
+	return strconv.ParseBool(value)
+}
+
+func parseInt(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+func parseDuration(value string) (models.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	return models.Duration(d), err
+}
+
+func formatDuration(d models.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return time.Duration(d).String()
+}
+
+// openSettings fills the settings screen from the current config
+func (a *App) openSettings() {
+	a.settingInputs = make([]textinput.Model, len(settings))
+	for i, s := range settings {
+		input := textinput.New()
+		input.Placeholder = s.placeholder
+		input.CharLimit = 200
+		input.Width = 50
+		input.SetValue(s.get(a.config))
+		a.settingInputs[i] = input
+	}
+	a.settingInputs[0].Focus()
+	a.screen = screenSettings
+	a.clearMessage()
+}
+
+// saveSettings applies the settings screen to the config once they are all
+// valid, and saves it
+func (a *App) saveSettings() error {
+	updated := *a.config
+	updated.Backup = &models.BackupConfig{}
+	if a.config.Backup != nil {
+		*updated.Backup = *a.config.Backup
+	}
+	updated.Notifications = append([]models.Notifier(nil), a.config.Notifications...)
+	if len(updated.Notifications) == 0 {
+		updated.Notifications = []models.Notifier{{}}
+	}
+
+	for i, s := range settings {
+		if err := s.set(&updated, strings.TrimSpace(a.settingInputs[i].Value())); err != nil {
+			return fmt.Errorf("invalid %s: %w", strings.ToLower(s.label), err)
+		}
+	}
+
+	// Leave out what was not set rather than saving empty sections
+	if a.config.Backup == nil && *updated.Backup == (models.BackupConfig{}) {
+		updated.Backup = nil
+	}
+	if updated.Notifications[0] == (models.Notifier{}) {
+		updated.Notifications = updated.Notifications[1:]
+	}
+	if len(updated.Notifications) == 0 {
+		updated.Notifications = nil
+	}
+
+	if err := config.Validate(&updated); err != nil {
+		return err
+	}
+
+	if updated.LogFile != a.config.LogFile && updated.LogFile != "" {
+		if err := a.logger.SetLogFile(updated.LogFile); err != nil {
+			return err
+		}
+	}
+	if updated.Debug {
+		a.logger.SetLevel(logger.DEBUG)
+	} else {
+		a.logger.SetLevel(logger.INFO)
+	}
+
+	*a.config = updated
+	a.saveConfig()
+	return nil
+}
+
+func (a *App) updateSettings(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	focused := 0
+	for i := range a.settingInputs {
+		if a.settingInputs[i].Focused() {
+			focused = i
+		}
+	}
+
+	switch {
+	case key.Matches(msg, key.NewBinding(key.WithKeys("ctrl+c"))):
+		return a, tea.Quit
+	case key.Matches(msg, key.NewBinding(key.WithKeys("esc"))):
+		a.screen = screenMain
+		a.clearMessage()
+		return a, nil
+	case key.Matches(msg, key.NewBinding(key.WithKeys("ctrl+s"))):
+		if err := a.saveSettings(); err != nil {
+			a.setMessage(err.Error(), "error")
+			return a, nil
+		}
+		a.screen = screenMain
+		message := "Settings saved"
+		if a.isWatching {
+			message += "; restart watch mode to apply them"
+		}
+		a.setMessage(message, "success")
+		return a, nil
+	case key.Matches(msg, key.NewBinding(key.WithKeys("tab", "down"))):
+		a.settingInputs[focused].Blur()
+		a.settingInputs[(focused+1)%len(a.settingInputs)].Focus()
+		return a, nil
+	case key.Matches(msg, key.NewBinding(key.WithKeys("shift+tab", "up"))):
+		a.settingInputs[focused].Blur()
+		a.settingInputs[(focused+len(a.settingInputs)-1)%len(a.settingInputs)].Focus()
+		return a, nil
+	}
+
+	var cmd tea.Cmd
+	a.settingInputs[focused], cmd = a.settingInputs[focused].Update(msg)
+	return a, cmd
+}
+
+func (a *App) viewSettings() string {
+	title := titleStyle.Width(a.width).Align(lipgloss.Center).Render("⚙️ Settings")
+	separator := separatorStyle.Width(a.width).Render(strings.Repeat("─", a.width))
+
+	var rows strings.Builder
+	for i, s := range settings {
+		label := labelStyle.Width(20).Render(s.label + ":")
+		if a.settingInputs[i].Focused() {
+			label = accentStyle.Width(20).Render("▸ " + s.label + ":")
+		}
+		rows.WriteString(label + " " + a.settingInputs[i].View() + "\n")
+	}
+	if len(a.config.Notifications) > 1 {
+		rows.WriteString(helpStyle.Render(fmt.Sprintf("\n%d more notifiers are configured in the config file", len(a.config.Notifications)-1)) + "\n")
+	}
+
+	var statusBar string
+	if a.message != "" && a.messageType == "error" {
+		statusBar = errorStyle.Width(a.width).Render("✗ "+a.message) + "\n"
+	}
+
+	helpBar := helpStyle.Width(a.width).Align(lipgloss.Center).Render(
+		"Navigation: tab/↓: next • shift+tab/↑: previous • ctrl+s: save • esc: cancel")
+
+	return fmt.Sprintf("%s\n%s\n\n%s\n%s%s",
+		title,
+		separator,
+		rows.String(),
+		statusBar,
+		helpBar,
+	)
+}
@@ -1,15 +1,23 @@
 package tui
 
 import (
+	"context"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
+	"var-sync/internal/backend"
 	"var-sync/internal/config"
+	"var-sync/internal/control"
+	"var-sync/internal/history"
 	"var-sync/internal/logger"
 	"var-sync/internal/parser"
+	"var-sync/internal/pidfile"
+	"var-sync/internal/state"
+	"var-sync/internal/sync"
 	"var-sync/pkg/models"
 
 	"github.com/charmbracelet/bubbles/filepicker"
@@ -31,6 +39,8 @@ const (
 	screenSelectKey
 	screenBrowseFile
 	screenLogs
+	screenHistory
+	screenSettings
 )
 
 type App struct {
@@ -38,23 +48,42 @@ type App struct {
 	logger     *logger.Logger
 	configPath string
 
-	screen screen
-	list   list.Model
-	inputs []textinput.Model
-	parser *parser.Parser
+	screen   screen
+	list     list.Model
+	inputs   []textinput.Model
+	parser   *parser.Parser
+	backends *backend.Registry
 
 	selectedRule *models.SyncRule
 	fileKeys     []string
+	formFiles    map[string]formFile // Files loaded to check the form's key paths, by path
 	keySelector  list.Model
 	filePicker   filepicker.Model
 
 	// Logs display
 	logsTable  table.Model
 	logEntries []LogEntry
+	logLines   chan logger.Entry // Lines logged by the rest of the process
+	logLevel   logger.LogLevel   // Lowest level shown, everything logged by default
+	autoScroll bool              // Keep the newest entry selected as lines arrive
+
+	// Sync history display
+	historyTable     table.Model
+	historyEvents    []models.SyncEvent
+	pendingConflicts map[string]bool // IDs of held back conflicts awaiting resolution
+
+	// Outcome of each rule's latest sync, from the state file
+	store        *state.Store
+	ruleStatuses map[string]state.RuleStatus
 
 	// Watch state
-	watchProcess *exec.Cmd
-	isWatching   bool
+	watch      *watchSession
+	isWatching bool
+
+	// The var-sync attached to, through which rules are changed, and which of
+	// its rules are paused
+	daemon *control.Client
+	paused map[string]bool
 
 	width  int
 	height int
@@ -63,6 +92,18 @@ type App struct {
 	message     string
 	messageType string // "success", "error", "info"
 	showHelp    bool
+
+	// Settings screen, one input per entry in settings
+	settingInputs []textinput.Model
+
+	// Rule list grouping
+	groupByTag    bool
+	collapsedTags map[string]bool
+
+	// Destructive actions waiting for confirmation, and rule list changes
+	// that can be undone, newest last
+	confirm  *confirmation
+	ruleUndo []ruleChange
 }
 
 type LogEntry struct {
@@ -73,42 +114,227 @@ type LogEntry struct {
 	RuleName  string
 }
 
+// formFile is a file loaded to check key paths entered in the form against
+type formFile struct {
+	data map[string]any
+	err  error
+}
+
+// confirmation is an action held back until the user confirms it
+type confirmation struct {
+	prompt string
+	action func()
+}
+
+// ruleChange is the rule list as it was before a change made in the TUI
+type ruleChange struct {
+	description string
+	rules       []models.SyncRule
+}
+
+// maxRuleUndo is the number of rule list changes that can be undone
+const maxRuleUndo = 10
+
+// statusTickMsg asks for the rule sync status to be reloaded, which another
+// var-sync process watching the config may have changed
+type statusTickMsg struct{}
+
+// statusInterval is how often the rule sync status is reloaded
+const statusInterval = 5 * time.Second
+
+// ruleDetailHeight is the number of lines below the rule list detailing the
+// selected rule
+const ruleDetailHeight = 3
+
+// logLineMsg carries a line logged by the rest of the process, or by the
+// attached var-sync, to the logs
+type logLineMsg logger.Entry
+
+// daemonRulesMsg carries the rules of the attached var-sync
+type daemonRulesMsg struct {
+	client *control.Client
+	rules  []control.Rule
+	err    error
+}
+
+// daemonTimeout is how long the attached var-sync has to answer a request
+const daemonTimeout = time.Second
+
+// watchSession is a watcher running inside the TUI process, or the control
+// socket of a var-sync already watching the config
+type watchSession struct {
+	stop   chan struct{}
+	events chan models.SyncEvent
+	done   chan error
+	remote bool // Attached to another process, which streams its log lines too
+}
+
+// watchEventMsg carries a sync event from a watch session to the TUI
+type watchEventMsg struct {
+	session *watchSession
+	event   models.SyncEvent
+}
+
+// watchStoppedMsg reports that a watch session has exited
+type watchStoppedMsg struct {
+	session *watchSession
+	err     error
+}
+
+// record passes a sync event on to the TUI, dropping it rather than holding
+// up the watcher if the TUI falls behind
+func (w *watchSession) record(event models.SyncEvent) {
+	select {
+	case w.events <- event:
+	default:
+	}
+}
+
+// wait returns a command delivering the next message from the session
+func (w *watchSession) wait() tea.Cmd {
+	return func() tea.Msg {
+		select {
+		case event := <-w.events:
+			return watchEventMsg{session: w, event: event}
+		case err := <-w.done:
+			return watchStoppedMsg{session: w, err: err}
+		}
+	}
+}
+
 type ruleItem struct {
 	models.SyncRule
+	status *state.RuleStatus // Outcome of the latest sync, nil if never synced
+	paused bool              // Paused in the attached var-sync
 }
 
 func (r ruleItem) Title() string {
 	status := "🟢"
-	if !r.Enabled {
+	switch {
+	case !r.Enabled:
 		status = "🔴"
+	case r.paused:
+		status = "🟡"
 	}
 	return fmt.Sprintf("%s %s", status, r.Name)
 }
 
 func (r ruleItem) Description() string {
-	desc := fmt.Sprintf("%s -> %s", r.SourceKey, r.TargetKey)
+	mappings := make([]string, 0, len(r.KeyMappings()))
+	for _, mapping := range r.KeyMappings() {
+		mappings = append(mappings, fmt.Sprintf("%s -> %s", mapping.SourceKey, mapping.TargetKey))
+	}
+	desc := strings.Join(mappings, ", ")
 	if r.SyncRule.Description != "" {
 		desc = fmt.Sprintf("%s | %s", r.SyncRule.Description, desc)
 	}
-	return desc
+	if len(r.Tags) > 0 {
+		desc = fmt.Sprintf("[%s] %s", strings.Join(r.Tags, ", "), desc)
+	}
+	if r.paused {
+		desc = "paused | " + desc
+	}
+	return fmt.Sprintf("%s | %s", r.syncSummary(), desc)
+}
+
+// syncSummary sums up the outcome of the rule's latest sync
+func (r ruleItem) syncSummary() string {
+	switch {
+	case r.status == nil:
+		return "· never synced"
+	case !r.status.Success:
+		return "✗ failed " + ago(r.status.LastAttempt)
+	default:
+		return "✓ synced " + ago(r.status.LastAttempt)
+	}
+}
+
+// ago describes how long ago t was, roughly
+func ago(t time.Time) string {
+	elapsed := time.Since(t)
+	switch {
+	case elapsed < time.Minute:
+		return "just now"
+	case elapsed < time.Hour:
+		return fmt.Sprintf("%dm ago", int(elapsed.Minutes()))
+	case elapsed < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(elapsed.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(elapsed.Hours()/24))
+	}
 }
 
 func (r ruleItem) FilterValue() string {
 	// Include multiple searchable fields for better filtering
-	return fmt.Sprintf("%s %s %s %s %s %s",
+	return fmt.Sprintf("%s %s %s %s %s %s %s",
 		r.Name,
 		r.SyncRule.Description,
 		r.SourceFile,
 		r.SourceKey,
 		r.TargetFile,
-		r.TargetKey)
+		r.TargetKey,
+		strings.Join(r.Tags, " "))
+}
+
+// tagItem heads the rules with a tag when the rule list is grouped by tag
+type tagItem struct {
+	tag       string // Empty for rules without tags
+	count     int
+	collapsed bool
+}
+
+func (t tagItem) Title() string {
+	arrow := "▾"
+	if t.collapsed {
+		arrow = "▸"
+	}
+	name := t.tag
+	if name == "" {
+		name = "untagged"
+	}
+	return fmt.Sprintf("%s %s (%d)", arrow, name, t.count)
+}
+
+func (t tagItem) Description() string { return "" }
+func (t tagItem) FilterValue() string { return t.tag }
+
+// keyItem is a key path in the key selector, along with its current value
+type keyItem struct {
+	path      string
+	value     any
+	sensitive bool
+}
+
+func (k keyItem) Title() string { return k.path }
+
+func (k keyItem) Description() string {
+	return fmt.Sprintf("%s · %s", parser.TypeName(k.value), k.shownValue())
 }
 
-type keyItem string
+// FilterValue lets the selector be searched by value as well as by path
+func (k keyItem) FilterValue() string {
+	if k.sensitive {
+		return k.path
+	}
+	return k.path + " " + fmt.Sprint(k.value)
+}
+
+// shownValue returns the value as shown in the selector, masked if sensitive
+// and cut short if long
+func (k keyItem) shownValue() string {
+	if k.sensitive {
+		return models.RedactedValue
+	}
+	shown := fmt.Sprintf("%v", k.value)
+	if _, ok := k.value.(string); ok {
+		shown = fmt.Sprintf("%q", k.value)
+	}
+	if runes := []rune(shown); len(runes) > 60 {
+		shown = string(runes[:59]) + "…"
+	}
+	return shown
+}
 
-func (k keyItem) Title() string       { return string(k) }
-func (k keyItem) Description() string { return "" }
-func (k keyItem) FilterValue() string { return string(k) }
 
 
 var (
@@ -182,11 +408,15 @@ var (
 			Bold(true)
 )
 
-func New(cfg *models.Config, logger *logger.Logger) *App {
+// New creates the TUI for the config loaded from configPath, which rule and
+// settings changes are saved back to
+func New(cfg *models.Config, configPath string, logger *logger.Logger) *App {
+	logger = logger.Module("tui")
+
 	// Standard input width for consistency
 	standardWidth := 60
 
-	inputs := make([]textinput.Model, 6)
+	inputs := make([]textinput.Model, 8)
 	inputs[0] = textinput.New()
 	inputs[0].Placeholder = "Rule name"
 	inputs[0].Focus()
@@ -218,12 +448,17 @@ func New(cfg *models.Config, logger *logger.Logger) *App {
 	inputs[5].CharLimit = 100
 	inputs[5].Width = standardWidth
 
-	items := make([]list.Item, len(cfg.Rules))
-	for i, rule := range cfg.Rules {
-		items[i] = ruleItem{rule}
-	}
+	inputs[6] = textinput.New()
+	inputs[6].Placeholder = "On conflict: source-wins, target-wins, newest-wins, manual (optional)"
+	inputs[6].CharLimit = 20
+	inputs[6].Width = standardWidth
+
+	inputs[7] = textinput.New()
+	inputs[7].Placeholder = "Tags, comma separated (e.g., env:prod, service:auth)"
+	inputs[7].CharLimit = 200
+	inputs[7].Width = standardWidth
 
-	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	l := list.New([]list.Item{}, list.NewDefaultDelegate(), 0, 0)
 	l.Title = "Sync Rules"
 	// Ensure filtering is enabled
 	l.SetShowHelp(false) // We provide our own help
@@ -237,7 +472,7 @@ func New(cfg *models.Config, logger *logger.Logger) *App {
 	// Initialize filepicker with proper height configuration
 	fp := filepicker.New()
 	// Limit to configuration file types only
-	fp.AllowedTypes = []string{".json", ".yaml", ".yml", ".toml", ".env"}
+	fp.AllowedTypes = []string{".json", ".yaml", ".yml", ".toml", ".env", ".ini", ".cfg", ".properties", ".tf", ".tfvars", ".hcl", ".xml", ".sh", "Dockerfile", "Containerfile", ".dockerfile"}
 	fp.CurrentDirectory, _ = os.Getwd()
 	fp.DirAllowed = true
 	fp.FileAllowed = true
@@ -276,27 +511,109 @@ func New(cfg *models.Config, logger *logger.Logger) *App {
 		Bold(false)
 	logsTable.SetStyles(s)
 
-	return &App{
-		config:      cfg,
-		logger:      logger,
-		configPath:  "var-sync.json",
-		screen:      screenMain,
-		list:        l,
-		inputs:      inputs,
-		parser:      parser.New(),
-		keySelector: keySelector,
-		filePicker:  fp,
-		logsTable:   logsTable,
-		logEntries:  []LogEntry{},
-		isWatching:  false,
+	historyTable := table.New(
+		table.WithColumns([]table.Column{
+			{Title: "Time", Width: 19},
+			{Title: "Rule", Width: 20},
+			{Title: "Target", Width: 30},
+			{Title: "Change", Width: 40},
+		}),
+		table.WithRows([]table.Row{}),
+		table.WithFocused(true),
+		table.WithHeight(10),
+	)
+	historyTable.SetStyles(s)
+
+	store, err := state.Open(cfg.StatePath())
+	if err != nil {
+		logger.Error("Failed to open state file, rule sync status is not shown: %v", err)
+	}
+
+	app := &App{
+		config:       cfg,
+		logger:       logger,
+		configPath:   configPath,
+		screen:       screenMain,
+		list:         l,
+		inputs:       inputs,
+		parser:       parser.New(),
+		backends:     backend.FromConfig(cfg),
+		keySelector:  keySelector,
+		filePicker:   fp,
+		logsTable:    logsTable,
+		logEntries:   []LogEntry{},
+		logLines:     streamLogs(logger),
+		autoScroll:   true,
+		historyTable: historyTable,
+		store:        store,
+		isWatching:   false,
 	}
+	app.updateList()
+	return app
+}
+
+// streamLogs passes the lines logged by the rest of the process on to the
+// logs screen. The TUI's own lines are left out, as some are logged while
+// rendering. Lines are dropped rather than holding up whoever logs them if
+// the TUI falls behind.
+func streamLogs(log *logger.Logger) chan logger.Entry {
+	lines := make(chan logger.Entry, 256)
+	log.OnEntry(func(entry logger.Entry) {
+		if entry.Module == "tui" {
+			return
+		}
+		select {
+		case lines <- entry:
+		default:
+		}
+	})
+	return lines
 }
 
 func (a *App) Init() tea.Cmd {
 	// Initialize filepicker and force refresh
 	cmd := a.filePicker.Init()
+	a.loadHistory()
 	a.logger.Info("DEBUG INIT: Filepicker initialized with cmd: %v", cmd != nil)
-	return cmd
+	cmds := []tea.Cmd{cmd, a.waitForLogLine(), statusTick()}
+	if a.watch != nil {
+		cmds = append(cmds, a.watch.wait())
+	}
+	return tea.Batch(cmds...)
+}
+
+// Attach connects the TUI to the var-sync already watching the config before
+// it runs, as if watch mode had been started: the rules shown are those of
+// the var-sync, with which are paused, its logs and sync events are followed
+// and rule changes are made through it rather than by writing the config
+// file. It fails if no var-sync is watching the config.
+func (a *App) Attach() error {
+	_, err := a.attachWatch()
+	return err
+}
+
+// statusTick returns a command asking for the rule sync status to be
+// reloaded after statusInterval
+func statusTick() tea.Cmd {
+	return tea.Tick(statusInterval, func(time.Time) tea.Msg {
+		return statusTickMsg{}
+	})
+}
+
+// refreshStatus reloads the rule sync status shown in the rule list, unless
+// the list is being filtered
+func (a *App) refreshStatus() {
+	if a.list.FilterState() == list.Unfiltered {
+		a.updateList()
+	}
+}
+
+// waitForLogLine returns a command delivering the next logged line
+func (a *App) waitForLogLine() tea.Cmd {
+	lines := a.logLines
+	return func() tea.Msg {
+		return logLineMsg(<-lines)
+	}
 }
 
 func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
@@ -304,7 +621,7 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	case tea.WindowSizeMsg:
 		a.width, a.height = msg.Width, msg.Height
 		// Use most of the screen for lists, leaving space for title and help
-		a.list.SetSize(msg.Width, msg.Height-6)
+		a.list.SetSize(msg.Width, msg.Height-6-ruleDetailHeight)
 		a.keySelector.SetSize(msg.Width, msg.Height-6)
 		
 		// Pass window size to FilePicker and log the action
@@ -315,6 +632,8 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		// Update logs table size
 		a.logsTable.SetWidth(msg.Width - 4)
 		a.logsTable.SetHeight(msg.Height - 8)
+		a.historyTable.SetWidth(msg.Width - 4)
+		a.historyTable.SetHeight(msg.Height - 8)
 
 		// Update input widths based on window size
 		inputWidth := msg.Width - 10 // Leave some margin
@@ -342,7 +661,52 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return a.updateFileBrowser(msg)
 		case screenLogs:
 			return a.updateLogs(msg)
+		case screenHistory:
+			return a.updateHistory(msg)
+		case screenSettings:
+			return a.updateSettings(msg)
+		}
+	case logLineMsg:
+		a.addLogLine(logger.Entry(msg))
+		return a, a.waitForLogLine()
+	case statusTickMsg:
+		a.refreshStatus()
+		if a.daemon != nil {
+			return a, tea.Batch(statusTick(), a.fetchDaemonRules())
+		}
+		return a, statusTick()
+	case daemonRulesMsg:
+		// The var-sync may have stopped, or been detached from since
+		if msg.client != a.daemon {
+			return a, nil
+		}
+		if msg.err != nil {
+			a.logger.Debug("Failed to fetch the rules of the attached var-sync: %v", msg.err)
+			return a, nil
+		}
+		a.setDaemonRules(msg.rules)
+		a.refreshStatus()
+		return a, nil
+	case watchEventMsg:
+		// Conflicts and drift show up in the history until they are resolved
+		if msg.event.Conflict || msg.event.Drift {
+			a.loadHistory()
 		}
+		a.refreshStatus()
+		return a, msg.session.wait()
+	case watchStoppedMsg:
+		// A session stopped from the TUI has already been logged
+		if msg.session == a.watch {
+			a.clearWatch()
+			a.setMessage(fmt.Sprintf("Watch mode stopped: %v", msg.err), "error")
+			a.addLogEntry(LogEntry{
+				Timestamp: time.Now(),
+				Level:     "ERROR",
+				Message:   fmt.Sprintf("Watch mode stopped: %v", msg.err),
+				RuleName:  "System",
+			})
+		}
+		return a, nil
 	default:
 		// Handle non-key messages for filepicker when it's active
 		if a.screen == screenBrowseFile {
@@ -356,6 +720,10 @@ func (a *App) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (a *App) updateMain(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if a.confirm != nil {
+		return a.updateConfirm(msg)
+	}
+
 	switch {
 	case key.Matches(msg, key.NewBinding(key.WithKeys("q", "ctrl+c"))):
 		return a, tea.Quit
@@ -369,26 +737,48 @@ func (a *App) updateMain(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		a.clearMessage()
 		return a, nil
 	case key.Matches(msg, key.NewBinding(key.WithKeys("d"))):
-		if selected := a.list.SelectedItem(); selected != nil {
-			rule := selected.(ruleItem).SyncRule
-			a.removeRule(rule.ID)
-			a.setMessage(fmt.Sprintf("Deleted rule: %s", rule.Name), "success")
+		if selected, ok := a.list.SelectedItem().(ruleItem); ok {
+			rule := selected.SyncRule
+			a.confirm = &confirmation{
+				prompt: fmt.Sprintf("Delete rule %s?", rule.Name),
+				action: func() {
+					if err := a.removeRule(rule.ID); err != nil {
+						a.setMessage(fmt.Sprintf("Failed to delete rule %s: %v", rule.Name, err), "error")
+						return
+					}
+					a.setMessage(fmt.Sprintf("Deleted rule: %s (u to undo)", rule.Name), "success")
+				},
+			}
 		}
 		return a, nil
+	case key.Matches(msg, key.NewBinding(key.WithKeys("u"))):
+		a.undoRuleChange()
+		return a, nil
 	case key.Matches(msg, key.NewBinding(key.WithKeys("t"))):
-		if selected := a.list.SelectedItem(); selected != nil {
-			rule := selected.(ruleItem).SyncRule
-			a.toggleRule(rule.ID)
+		if selected, ok := a.list.SelectedItem().(ruleItem); ok {
+			rule := selected.SyncRule
 			status := "enabled"
 			if !rule.Enabled {
 				status = "disabled"
 			}
+			if err := a.toggleRule(rule.ID); err != nil {
+				a.setMessage(fmt.Sprintf("Failed to toggle rule %s: %v", rule.Name, err), "error")
+				return a, nil
+			}
 			a.setMessage(fmt.Sprintf("Rule %s %s", rule.Name, status), "info")
 		}
 		return a, nil
+	case key.Matches(msg, key.NewBinding(key.WithKeys("p"))):
+		if selected, ok := a.list.SelectedItem().(ruleItem); ok {
+			a.togglePause(selected.SyncRule)
+		}
+		return a, nil
 	case key.Matches(msg, key.NewBinding(key.WithKeys("enter"))):
-		if selected := a.list.SelectedItem(); selected != nil {
-			rule := selected.(ruleItem).SyncRule
+		switch selected := a.list.SelectedItem().(type) {
+		case tagItem:
+			a.toggleTag(selected.tag)
+		case ruleItem:
+			rule := selected.SyncRule
 			a.selectedRule = &rule
 			a.screen = screenEditRule
 			a.populateInputs(rule)
@@ -400,8 +790,19 @@ func (a *App) updateMain(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		a.screen = screenLogs
 		a.clearMessage()
 		return a, nil
+	case key.Matches(msg, key.NewBinding(key.WithKeys("H"))):
+		a.screen = screenHistory
+		a.clearMessage()
+		a.loadHistory()
+		return a, nil
 	case key.Matches(msg, key.NewBinding(key.WithKeys("w"))):
-		a.toggleWatch()
+		return a, a.toggleWatch()
+	case key.Matches(msg, key.NewBinding(key.WithKeys("s"))):
+		a.openSettings()
+		return a, nil
+	case key.Matches(msg, key.NewBinding(key.WithKeys("g"))):
+		a.groupByTag = !a.groupByTag
+		a.updateList()
 		return a, nil
 	}
 
@@ -410,6 +811,23 @@ func (a *App) updateMain(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return a, cmd
 }
 
+// updateConfirm runs the action waiting for confirmation on y or enter, and
+// drops it on n or esc
+func (a *App) updateConfirm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, key.NewBinding(key.WithKeys("ctrl+c"))):
+		return a, tea.Quit
+	case key.Matches(msg, key.NewBinding(key.WithKeys("y", "Y", "enter"))):
+		action := a.confirm.action
+		a.confirm = nil
+		action()
+	case key.Matches(msg, key.NewBinding(key.WithKeys("n", "N", "esc"))):
+		a.confirm = nil
+		a.setMessage("Cancelled", "info")
+	}
+	return a, nil
+}
+
 func (a *App) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch {
 	case key.Matches(msg, key.NewBinding(key.WithKeys("ctrl+c"))):
@@ -493,7 +911,7 @@ func (a *App) updateKeySelector(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return a, nil
 	case key.Matches(msg, key.NewBinding(key.WithKeys("enter"))):
 		if selected := a.keySelector.SelectedItem(); selected != nil {
-			key := string(selected.(keyItem))
+			key := selected.(keyItem).path
 			focusedIdx := a.getFocusedInputIndex()
 			if focusedIdx >= 0 && focusedIdx < len(a.inputs) {
 				a.inputs[focusedIdx].SetValue(key)
@@ -581,6 +999,19 @@ func (a *App) updateLogs(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		a.refreshLogs()
 		a.setMessage("Logs refreshed", "info")
 		return a, nil
+	case key.Matches(msg, key.NewBinding(key.WithKeys("f"))):
+		a.cycleLogLevel()
+		a.setMessage(fmt.Sprintf("Showing %s and above", a.logLevel), "info")
+		return a, nil
+	case key.Matches(msg, key.NewBinding(key.WithKeys("a"))):
+		a.autoScroll = !a.autoScroll
+		if a.autoScroll {
+			a.logsTable.SetCursor(0)
+			a.setMessage("Auto-scroll on", "info")
+		} else {
+			a.setMessage("Auto-scroll off", "info")
+		}
+		return a, nil
 	}
 
 	var cmd tea.Cmd
@@ -602,6 +1033,10 @@ func (a *App) View() string {
 		return a.viewFileBrowser()
 	case screenLogs:
 		return a.viewLogs()
+	case screenHistory:
+		return a.viewHistory()
+	case screenSettings:
+		return a.viewSettings()
 	}
 	return ""
 }
@@ -609,10 +1044,20 @@ func (a *App) View() string {
 func (a *App) viewMain() string {
 	// Elegant title with separator and watch status
 	watchStatus := ""
-	if a.isWatching {
+	switch {
+	case a.daemon != nil:
+		watchStatus = " 🔗 ATTACHED"
+	case a.isWatching:
 		watchStatus = " 👁️ WATCHING"
 	}
-	titleText := fmt.Sprintf("🚀 Var-Sync Configuration — %d Rules%s", len(a.config.Rules), watchStatus)
+	if len(a.pendingConflicts) > 0 {
+		watchStatus += fmt.Sprintf(" ⚠ %d CONFLICTS (H to resolve)", len(a.pendingConflicts))
+	}
+	configName := a.configPath
+	if profile := a.config.Profile(); profile != "" {
+		configName += " (" + profile + ")"
+	}
+	titleText := fmt.Sprintf("🚀 Var-Sync Configuration — %s — %d Rules%s", configName, len(a.config.Rules), watchStatus)
 	title := titleStyle.Width(a.width).Align(lipgloss.Center).Render(titleText)
 	separator := separatorStyle.Width(a.width).Render(strings.Repeat("─", a.width))
 
@@ -620,18 +1065,20 @@ func (a *App) viewMain() string {
 	var helpText string
 	if a.showHelp {
 		helpText = helpStyle.Render(
-			"Navigation: ↑/↓ to select • enter: edit • a: add • d: delete • t: toggle enable/disable\n" +
-				"Filter: /: search/filter list (now searches all fields!) • esc: clear filter\n" +
-				"Views: l: logs • w: start/stop watch mode\n" +
+			"Navigation: ↑/↓ to select • enter: edit, or collapse/expand a tag • a: add • d: delete • t: toggle enable/disable • p: pause/resume while attached • u: undo\n" +
+				"Filter: /: search/filter list (now searches all fields!) • esc: clear filter • g: group by tag\n" +
+				"Views: l: logs • H: sync history • s: settings • w: start/stop watch mode, or attach/detach\n" +
 				"Help: h/?: toggle this help • q/ctrl+c: quit\n" +
 				"Shortcuts: ctrl+f: file browser • ctrl+k: key selector")
 	} else {
-		helpText = helpStyle.Render("Press h or ? for help • a: add • enter: edit • /: filter • l: logs • w: watch • d: delete • t: toggle • q: quit")
+		helpText = helpStyle.Render("Press h or ? for help • a: add • enter: edit • /: filter • l: logs • H: history • s: settings • w: watch • d: delete • t: toggle • u: undo • q: quit")
 	}
 
-	// Status bar with message
+	// Status bar with message, or the action waiting for confirmation
 	var statusBar string
-	if a.message != "" {
+	if a.confirm != nil {
+		statusBar = errorStyle.Width(a.width).Render("⚠ "+a.confirm.prompt+" y: yes • n: no") + "\n"
+	} else if a.message != "" {
 		switch a.messageType {
 		case "success":
 			statusBar = statusStyle.Width(a.width).Render("✓ " + a.message)
@@ -646,15 +1093,46 @@ func (a *App) viewMain() string {
 	// Full-width help bar
 	helpBar := helpStyle.Width(a.width).Align(lipgloss.Center).Render(helpText)
 
-	return fmt.Sprintf("%s\n%s\n%s%s\n%s",
+	return fmt.Sprintf("%s\n%s\n%s\n%s%s\n%s",
 		title,
 		separator,
 		a.list.View(),
+		a.viewRuleDetail(),
 		statusBar,
 		helpBar,
 	)
 }
 
+// viewRuleDetail shows where the selected rule syncs and how its latest sync
+// went, in ruleDetailHeight lines
+func (a *App) viewRuleDetail() string {
+	lines := make([]string, ruleDetailHeight)
+	item, ok := a.list.SelectedItem().(ruleItem)
+	if !ok {
+		return strings.Join(lines, "\n")
+	}
+
+	lines[0] = fmt.Sprintf("%s:%s → %s:%s", item.SourceFile, item.SourceKey, item.TargetFile, item.TargetKey)
+	if len(item.Mappings) > 0 {
+		lines[0] = fmt.Sprintf("%s → %s (%d keys)", item.SourceFile, item.TargetFile, len(item.Mappings))
+	}
+	switch {
+	case item.status == nil:
+		lines[1] = "Never synced"
+	case item.status.LastSync == nil:
+		lines[1] = "Never synced successfully"
+	default:
+		lines[1] = fmt.Sprintf("Last synced %s (%s)", item.status.LastSync.Local().Format("2006-01-02 15:04:05"), ago(*item.status.LastSync))
+	}
+	if item.status != nil && !item.status.Success {
+		lines[1] += fmt.Sprintf(" • last attempt failed %s", ago(item.status.LastAttempt))
+		lines[2] = errorStyle.Render("✗ " + item.status.Error)
+	}
+	lines[0] = helpStyle.Render(lines[0])
+	lines[1] = helpStyle.Render(lines[1])
+	return strings.Join(lines, "\n")
+}
+
 func (a *App) viewForm(title string) string {
 	// Elegant title with separator
 	titleText := titleStyle.Width(a.width).Align(lipgloss.Center).Render("✏️ " + title)
@@ -667,6 +1145,8 @@ func (a *App) viewForm(title string) string {
 		"Source Key:",
 		"Target File:",
 		"Target Key:",
+		"On Conflict:",
+		"Tags:",
 	}
 
 	icons := []string{
@@ -676,6 +1156,8 @@ func (a *App) viewForm(title string) string {
 		"🔑",
 		"📂",
 		"🎯",
+		"⚖️",
+		"🔖",
 	}
 
 	// Center the form on screen
@@ -694,7 +1176,15 @@ func (a *App) viewForm(title string) string {
 			inputView = blurredInputStyle.Width(formWidth).Render(input.View())
 		}
 
-		formContent.WriteString(fmt.Sprintf("%s\n%s\n\n", label, inputView))
+		formContent.WriteString(fmt.Sprintf("%s\n%s\n", label, inputView))
+		// Key paths are checked once their file has been entered, so that
+		// remote files are not fetched for every character typed
+		if (i == 3 || i == 5) && !a.inputs[i-1].Focused() {
+			if check := a.checkKeyPath(a.inputs[i-1].Value(), input.Value()); check != "" {
+				formContent.WriteString(check + "\n")
+			}
+		}
+		formContent.WriteString("\n")
 	}
 
 	// Center the form content
@@ -712,7 +1202,7 @@ func (a *App) viewForm(title string) string {
 	// Full-width help bar
 	helpBar := helpStyle.Width(a.width).Align(lipgloss.Center).Render(
 		"Navigation: tab/shift+tab: next/prev field • ctrl+s: save • esc: cancel\n" +
-			"Helpers: ctrl+f: file browser (json/yaml/toml/env) • ctrl+k: key selector")
+			"Helpers: ctrl+f: file browser (json/yaml/toml/env/ini/properties/hcl/xml) • ctrl+k: key selector")
 
 	return fmt.Sprintf("%s\n%s\n\n%s%s%s",
 		titleText,
@@ -723,6 +1213,52 @@ func (a *App) viewForm(title string) string {
 	)
 }
 
+// checkKeyPath renders whether a key path entered in the form exists in its
+// file, with the current value if it does and close matches if it does not
+func (a *App) checkKeyPath(file, keyPath string) string {
+	if file == "" || keyPath == "" {
+		return ""
+	}
+	// Glob sources and templated targets only resolve once matched
+	if strings.Contains(file, "{{") || (models.SyncRule{SourceFile: file}).IsGlob() {
+		return helpStyle.Render("ℹ key is checked once the file pattern matches")
+	}
+
+	loaded, ok := a.formFiles[file]
+	if !ok {
+		loaded.data, loaded.err = a.backends.Load(file)
+		if a.formFiles == nil {
+			a.formFiles = make(map[string]formFile)
+		}
+		a.formFiles[file] = loaded
+	}
+	if loaded.err != nil {
+		return errorStyle.Render(fmt.Sprintf("✗ cannot read %s: %v", file, loaded.err))
+	}
+
+	if parser.HasWildcard(keyPath) {
+		matches := a.parser.ExpandKeyPath(loaded.data, keyPath)
+		if len(matches) == 0 {
+			return errorStyle.Render("✗ pattern matches no keys")
+		}
+		return statusStyle.Render(fmt.Sprintf("✓ matches %d keys", len(matches)))
+	}
+
+	if err := a.parser.ValidateKeyPath(loaded.data, keyPath); err != nil {
+		message := fmt.Sprintf("✗ %v", err)
+		if suggestions := a.parser.SuggestKeyPaths(loaded.data, keyPath, 3); len(suggestions) > 0 {
+			message += "; did you mean " + strings.Join(suggestions, ", ") + "?"
+		}
+		return errorStyle.Render(message)
+	}
+
+	value, _ := a.parser.GetValue(loaded.data, keyPath)
+	if models.SensitiveKey(keyPath) || (a.selectedRule != nil && a.selectedRule.Sensitive) {
+		value = models.RedactedValue
+	}
+	return statusStyle.Render(fmt.Sprintf("✓ current value: %v", value))
+}
+
 func (a *App) viewKeySelector() string {
 	title := titleStyle.Width(a.width).Align(lipgloss.Center).Render("🔑 Select Key Path")
 	separator := separatorStyle.Width(a.width).Render(strings.Repeat("─", a.width))
@@ -833,13 +1369,19 @@ func (a *App) saveNewRule() {
 		SourceKey:   a.inputs[3].Value(),
 		TargetFile:  a.inputs[4].Value(),
 		TargetKey:   a.inputs[5].Value(),
+		OnConflict:  models.OnConflict(strings.TrimSpace(a.inputs[6].Value())),
+		Tags:        parseTags(a.inputs[7].Value()),
 		Enabled:     true,
 		Created:     time.Now(),
 	}
 
+	a.recordRuleChange(fmt.Sprintf("adding %s", rule.Name))
 	a.config.Rules = append(a.config.Rules, rule)
 	a.updateList()
-	a.saveConfig()
+	if err := a.saveRules(); err != nil {
+		a.setMessage(fmt.Sprintf("Failed to create rule: %v", err), "error")
+		return
+	}
 	a.setMessage(fmt.Sprintf("Created rule: %s", rule.Name), "success")
 }
 
@@ -855,42 +1397,107 @@ func (a *App) saveEditedRule() {
 
 	for i, rule := range a.config.Rules {
 		if rule.ID == a.selectedRule.ID {
+			a.recordRuleChange(fmt.Sprintf("editing %s", rule.Name))
 			a.config.Rules[i].Name = a.inputs[0].Value()
 			a.config.Rules[i].Description = a.inputs[1].Value()
 			a.config.Rules[i].SourceFile = a.inputs[2].Value()
 			a.config.Rules[i].SourceKey = a.inputs[3].Value()
 			a.config.Rules[i].TargetFile = a.inputs[4].Value()
 			a.config.Rules[i].TargetKey = a.inputs[5].Value()
+			a.config.Rules[i].OnConflict = models.OnConflict(strings.TrimSpace(a.inputs[6].Value()))
+			a.config.Rules[i].Tags = parseTags(a.inputs[7].Value())
 			break
 		}
 	}
 
 	a.updateList()
-	a.saveConfig()
+	if err := a.saveRules(); err != nil {
+		a.setMessage(fmt.Sprintf("Failed to update rule: %v", err), "error")
+		return
+	}
 	a.setMessage(fmt.Sprintf("Updated rule: %s", a.inputs[0].Value()), "success")
 	a.selectedRule = nil
 }
 
-func (a *App) removeRule(id string) {
+// recordRuleChange remembers the rule list before a change so that the
+// change can be undone
+func (a *App) recordRuleChange(description string) {
+	a.ruleUndo = append(a.ruleUndo, ruleChange{
+		description: description,
+		rules:       append([]models.SyncRule(nil), a.config.Rules...),
+	})
+	if len(a.ruleUndo) > maxRuleUndo {
+		a.ruleUndo = a.ruleUndo[len(a.ruleUndo)-maxRuleUndo:]
+	}
+}
+
+// undoRuleChange puts the rule list back as it was before the latest change
+func (a *App) undoRuleChange() {
+	if len(a.ruleUndo) == 0 {
+		a.setMessage("Nothing to undo", "info")
+		return
+	}
+
+	last := a.ruleUndo[len(a.ruleUndo)-1]
+	a.ruleUndo = a.ruleUndo[:len(a.ruleUndo)-1]
+	a.config.Rules = last.rules
+	a.updateList()
+	if err := a.saveRules(); err != nil {
+		a.setMessage(fmt.Sprintf("Failed to undo %s: %v", last.description, err), "error")
+		return
+	}
+	a.setMessage(fmt.Sprintf("Undid %s", last.description), "success")
+}
+
+func (a *App) removeRule(id string) error {
 	for i, rule := range a.config.Rules {
 		if rule.ID == id {
+			a.recordRuleChange(fmt.Sprintf("deleting %s", rule.Name))
 			a.config.Rules = append(a.config.Rules[:i], a.config.Rules[i+1:]...)
 			break
 		}
 	}
 	a.updateList()
-	a.saveConfig()
+	return a.saveRules()
 }
 
-func (a *App) toggleRule(id string) {
+func (a *App) toggleRule(id string) error {
 	for i, rule := range a.config.Rules {
 		if rule.ID == id {
+			a.recordRuleChange(fmt.Sprintf("toggling %s", rule.Name))
 			a.config.Rules[i].Enabled = !a.config.Rules[i].Enabled
 			break
 		}
 	}
 	a.updateList()
-	a.saveConfig()
+	return a.saveRules()
+}
+
+// togglePause pauses or resumes a rule of the attached var-sync
+func (a *App) togglePause(rule models.SyncRule) {
+	if a.daemon == nil {
+		a.setMessage("Rules can only be paused while attached to a running var-sync", "info")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), daemonTimeout)
+	defer cancel()
+	if a.paused[rule.ID] {
+		if err := a.daemon.Resume(ctx, rule.ID); err != nil {
+			a.setMessage(fmt.Sprintf("Failed to resume rule %s: %v", rule.Name, err), "error")
+			return
+		}
+		delete(a.paused, rule.ID)
+		a.setMessage(fmt.Sprintf("Rule %s resumed", rule.Name), "info")
+	} else {
+		if err := a.daemon.Pause(ctx, rule.ID); err != nil {
+			a.setMessage(fmt.Sprintf("Failed to pause rule %s: %v", rule.Name, err), "error")
+			return
+		}
+		a.paused[rule.ID] = true
+		a.setMessage(fmt.Sprintf("Rule %s paused", rule.Name), "info")
+	}
+	a.updateList()
 }
 
 func (a *App) setMessage(msg, msgType string) {
@@ -910,33 +1517,172 @@ func (a *App) validateForm() error {
 	if strings.TrimSpace(a.inputs[2].Value()) == "" {
 		return fmt.Errorf("Source file is required")
 	}
-	if strings.TrimSpace(a.inputs[3].Value()) == "" {
+	if strings.TrimSpace(a.inputs[3].Value()) == "" && !a.referenceNamesKey(a.inputs[2].Value()) {
 		return fmt.Errorf("Source key is required")
 	}
 	if strings.TrimSpace(a.inputs[4].Value()) == "" {
 		return fmt.Errorf("Target file is required")
 	}
-	if strings.TrimSpace(a.inputs[5].Value()) == "" {
+	if strings.TrimSpace(a.inputs[5].Value()) == "" && !a.referenceNamesKey(a.inputs[4].Value()) {
 		return fmt.Errorf("Target key is required")
 	}
+	if !models.OnConflict(strings.TrimSpace(a.inputs[6].Value())).Valid() {
+		return fmt.Errorf("On conflict must be source-wins, target-wins, newest-wins or manual")
+	}
 	return nil
 }
 
+// referenceNamesKey reports whether location is a backend reference that
+// names its own key, such as env://APP_DB_HOST
+func (a *App) referenceNamesKey(location string) bool {
+	_, key := a.backends.Resolve(strings.TrimSpace(location), "")
+	return key != ""
+}
+
 func (a *App) updateList() {
-	items := make([]list.Item, len(a.config.Rules))
-	for i, rule := range a.config.Rules {
-		items[i] = ruleItem{rule}
+	if a.store != nil {
+		a.ruleStatuses = a.store.RuleStatuses()
+	}
+
+	if !a.groupByTag {
+		items := make([]list.Item, len(a.config.Rules))
+		for i, rule := range a.config.Rules {
+			items[i] = a.ruleItem(rule)
+		}
+		a.list.SetItems(items)
+		return
+	}
+
+	// A rule is listed under each of its tags, with untagged rules last
+	groups := make(map[string][]models.SyncRule)
+	for _, rule := range a.config.Rules {
+		if len(rule.Tags) == 0 {
+			groups[""] = append(groups[""], rule)
+		}
+		for _, tag := range rule.Tags {
+			groups[tag] = append(groups[tag], rule)
+		}
+	}
+	tags := make([]string, 0, len(groups))
+	for tag := range groups {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	sort.Strings(tags)
+	if len(groups[""]) > 0 {
+		tags = append(tags, "")
+	}
+
+	var items []list.Item
+	for _, tag := range tags {
+		collapsed := a.collapsedTags[tag]
+		items = append(items, tagItem{tag: tag, count: len(groups[tag]), collapsed: collapsed})
+		if collapsed {
+			continue
+		}
+		for _, rule := range groups[tag] {
+			items = append(items, a.ruleItem(rule))
+		}
 	}
 	a.list.SetItems(items)
 }
 
+// ruleItem lists a rule with the outcome of its latest sync
+func (a *App) ruleItem(rule models.SyncRule) ruleItem {
+	item := ruleItem{SyncRule: rule, paused: a.paused[rule.ID]}
+	if status, ok := a.ruleStatuses[rule.ID]; ok {
+		item.status = &status
+	}
+	return item
+}
+
+// toggleTag collapses or expands the rules under a tag
+func (a *App) toggleTag(tag string) {
+	if a.collapsedTags == nil {
+		a.collapsedTags = make(map[string]bool)
+	}
+	a.collapsedTags[tag] = !a.collapsedTags[tag]
+	a.updateList()
+}
+
+// parseTags splits comma separated tags, dropping blanks and repeats
+func parseTags(value string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		tags = append(tags, tag)
+	}
+	return tags
+}
+
 func (a *App) saveConfig() {
 	if err := config.Save(a.config, a.configPath); err != nil {
 		a.logger.Error("Failed to save config: %v", err)
 	}
 }
 
+// saveRules saves a change to the rules through the attached var-sync, which
+// checks it, applies it and saves it to the config file, or else straight to
+// the config file. A change the attached var-sync rejects is dropped.
+func (a *App) saveRules() error {
+	if a.daemon == nil {
+		if err := config.Save(a.config, a.configPath); err != nil {
+			a.logger.Error("Failed to save config: %v", err)
+			return err
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), daemonTimeout)
+	defer cancel()
+	rules, err := a.daemon.SetRules(ctx, a.config.Rules)
+	if err != nil {
+		// Show the rules as the var-sync still has them
+		if rules, err := a.daemon.Rules(ctx); err == nil {
+			a.setDaemonRules(rules)
+		}
+		a.updateList()
+		return err
+	}
+	a.setDaemonRules(rules)
+	a.updateList()
+	return nil
+}
+
+// setDaemonRules takes the rules of the attached var-sync as the TUI's own,
+// remembering which are paused
+func (a *App) setDaemonRules(rules []control.Rule) {
+	a.config.Rules = make([]models.SyncRule, len(rules))
+	a.paused = make(map[string]bool)
+	for i, rule := range rules {
+		a.config.Rules[i] = rule.SyncRule
+		if rule.Paused {
+			a.paused[rule.ID] = true
+		}
+	}
+}
+
+// fetchDaemonRules returns a command fetching the rules of the attached
+// var-sync, which its config file being reloaded or another client may have
+// changed
+func (a *App) fetchDaemonRules() tea.Cmd {
+	client := a.daemon
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), daemonTimeout)
+		defer cancel()
+		rules, err := client.Rules(ctx)
+		return daemonRulesMsg{client: client, rules: rules, err: err}
+	}
+}
+
 func (a *App) clearInputs() {
+	a.formFiles = nil
 	for i := range a.inputs {
 		a.inputs[i].SetValue("")
 		a.inputs[i].Blur()
@@ -945,12 +1691,15 @@ func (a *App) clearInputs() {
 }
 
 func (a *App) populateInputs(rule models.SyncRule) {
+	a.formFiles = nil
 	a.inputs[0].SetValue(rule.Name)
 	a.inputs[1].SetValue(rule.Description)
 	a.inputs[2].SetValue(rule.SourceFile)
 	a.inputs[3].SetValue(rule.SourceKey)
 	a.inputs[4].SetValue(rule.TargetFile)
 	a.inputs[5].SetValue(rule.TargetKey)
+	a.inputs[6].SetValue(string(rule.OnConflict))
+	a.inputs[7].SetValue(strings.Join(rule.Tags, ", "))
 }
 
 func (a *App) nextInput() {
@@ -985,7 +1734,7 @@ func (a *App) getFocusedInputIndex() int {
 }
 
 func (a *App) loadFileKeys(filepath string, inputIdx int) {
-	data, err := a.parser.LoadFile(filepath)
+	data, err := a.backends.Load(filepath)
 	if err != nil {
 		return
 	}
@@ -993,7 +1742,8 @@ func (a *App) loadFileKeys(filepath string, inputIdx int) {
 	keys := a.parser.GetAllKeys(data, "")
 	items := make([]list.Item, len(keys))
 	for i, key := range keys {
-		items[i] = keyItem(key)
+		value, _ := a.parser.GetValue(data, key)
+		items[i] = keyItem{path: key, value: value, sensitive: models.SensitiveKey(key)}
 	}
 
 	a.keySelector.SetItems(items)
@@ -1006,6 +1756,11 @@ func (a *App) viewLogs() string {
 	if a.isWatching {
 		titleText += " — Live Mode"
 	}
+	titleText += fmt.Sprintf(" (%s+", a.logLevel)
+	if a.autoScroll {
+		titleText += ", auto-scroll"
+	}
+	titleText += ")"
 	title := titleStyle.Width(a.width).Align(lipgloss.Center).Render(titleText)
 	separator := separatorStyle.Width(a.width).Render(strings.Repeat("─", a.width))
 
@@ -1024,7 +1779,7 @@ func (a *App) viewLogs() string {
 	}
 
 	helpBar := helpStyle.Width(a.width).Align(lipgloss.Center).Render(
-		"Navigation: ↑/↓ to select • c: clear logs • r: refresh • esc: back to main")
+		"Navigation: ↑/↓ to select • f: filter level • a: auto-scroll • c: clear logs • r: refresh • esc: back to main")
 
 	return fmt.Sprintf("%s\n%s\n%s\n%s%s",
 		title,
@@ -1035,29 +1790,54 @@ func (a *App) viewLogs() string {
 	)
 }
 
-func (a *App) toggleWatch() {
+func (a *App) toggleWatch() tea.Cmd {
 	if a.isWatching {
 		a.stopWatch()
-	} else {
-		a.startWatch()
+		return nil
 	}
+	return a.startWatch()
 }
 
-func (a *App) startWatch() {
+// startWatch runs the watcher inside the TUI process, streaming its sync
+// events into the logs. Rule changes take effect when it is next started.
+// When another var-sync already watches the config, the TUI attaches to it
+// instead.
+func (a *App) startWatch() tea.Cmd {
 	if a.isWatching {
-		return
+		return nil
 	}
 
-	// Start watch process
-	a.watchProcess = exec.Command("./var-sync", "-watch")
-	a.watchProcess.Dir, _ = os.Getwd()
-
-	err := a.watchProcess.Start()
+	pid, err := pidfile.Acquire(a.config.PidPath(a.configPath), false)
 	if err != nil {
+		if cmd, attachErr := a.attachWatch(); attachErr == nil {
+			return cmd
+		}
 		a.setMessage(fmt.Sprintf("Failed to start watch mode: %v", err), "error")
-		return
+		return nil
 	}
 
+	// The watcher gets its own copy of the rules, which the TUI goes on
+	// editing, with the paths of rules added since loading expanded too
+	cfg := *a.config
+	cfg.Rules = append([]models.SyncRule(nil), a.config.Rules...)
+	cfg.ExpandPaths()
+
+	session := &watchSession{
+		stop:   make(chan struct{}),
+		events: make(chan models.SyncEvent, 100),
+		done:   make(chan error, 1),
+	}
+	syncer := sync.New(&cfg, a.logger)
+	syncer.WatchConfig(a.configPath)
+	syncer.ServeControl(a.config.ControlPath(a.configPath))
+	go func() {
+		err := syncer.Run(session.stop, session.record)
+		pid.Release()
+		session.done <- err
+		close(session.done)
+	}()
+
+	a.watch = session
 	a.isWatching = true
 	a.setMessage("Watch mode started", "success")
 
@@ -1069,33 +1849,121 @@ func (a *App) startWatch() {
 		RuleID:    "",
 		RuleName:  "System",
 	})
+	return session.wait()
 }
 
-func (a *App) stopWatch() {
-	if !a.isWatching || a.watchProcess == nil {
-		return
+// attachWatch attaches to the var-sync already watching the config through
+// its control socket, rather than watching in the TUI process too. Its rules,
+// logs and sync events are followed and rule changes are made through it
+// until it is detached from. It fails if there is no var-sync to attach to.
+func (a *App) attachWatch() (tea.Cmd, error) {
+	client := control.Dial(a.config.ControlPath(a.configPath))
+	probe, cancel := context.WithTimeout(context.Background(), daemonTimeout)
+	rules, err := client.Rules(probe)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("no var-sync to attach to: %w", err)
 	}
 
-	err := a.watchProcess.Process.Kill()
-	if err != nil {
-		a.setMessage(fmt.Sprintf("Failed to stop watch mode: %v", err), "error")
+	session := &watchSession{
+		stop:   make(chan struct{}),
+		events: make(chan models.SyncEvent, 100),
+		done:   make(chan error, 1),
+		remote: true,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-session.stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	go func() {
+		err := client.Events(ctx, session.record)
+		cancel()
+		session.done <- err
+		close(session.done)
+	}()
+	lines := a.logLines
+	go client.Logs(ctx, func(entry logger.Entry) {
+		select {
+		case lines <- entry:
+		default:
+		}
+	})
+
+	a.watch = session
+	a.isWatching = true
+	a.daemon = client
+	a.setDaemonRules(rules)
+	a.updateList()
+	a.setMessage("Attached to the var-sync already watching this config", "success")
+	a.addLogEntry(LogEntry{
+		Timestamp: time.Now(),
+		Level:     "INFO",
+		Message:   "Attached to the var-sync already watching this config",
+		RuleName:  "System",
+	})
+	return session.wait(), nil
+}
+
+func (a *App) stopWatch() {
+	if !a.isWatching || a.watch == nil {
 		return
 	}
 
-	a.isWatching = false
-	a.watchProcess = nil
-	a.setMessage("Watch mode stopped", "info")
+	// Detaching from another var-sync leaves it watching
+	message := "Watch mode stopped"
+	if a.watch.remote {
+		message = "Detached from the var-sync watching this config"
+	}
+	close(a.watch.stop)
+	a.clearWatch()
+	a.setMessage(message, "info")
 
 	// Add log entry
 	a.addLogEntry(LogEntry{
 		Timestamp: time.Now(),
 		Level:     "INFO",
-		Message:   "Watch mode stopped",
+		Message:   message,
 		RuleID:    "",
 		RuleName:  "System",
 	})
 }
 
+// clearWatch forgets the watch session, and the var-sync attached to if any,
+// whose rules the TUI goes on showing
+func (a *App) clearWatch() {
+	a.watch = nil
+	a.isWatching = false
+	if a.daemon != nil {
+		a.daemon = nil
+		a.paused = nil
+		a.updateList()
+	}
+}
+
+// addLogLine adds a line logged by the rest of the process to the logs
+func (a *App) addLogLine(line logger.Entry) {
+	entry := LogEntry{
+		Timestamp: line.Time,
+		Level:     line.Level.String(),
+		Message:   line.Message,
+		RuleID:    line.RuleID,
+	}
+	if line.Module != "" {
+		entry.Message = "[" + line.Module + "] " + line.Message
+	}
+	for _, rule := range a.config.Rules {
+		if rule.ID == line.RuleID {
+			entry.RuleName = rule.Name
+			break
+		}
+	}
+	a.addLogEntry(entry)
+}
+
 func (a *App) addLogEntry(entry LogEntry) {
 	// Add to beginning of slice for newest-first display
 	a.logEntries = append([]LogEntry{entry}, a.logEntries...)
@@ -1105,24 +1973,51 @@ func (a *App) addLogEntry(entry LogEntry) {
 		a.logEntries = a.logEntries[:1000]
 	}
 
+	// Keep the selected entry in place unless following the newest
+	cursor := a.logsTable.Cursor()
+	a.updateLogsTable()
+	if a.autoScroll {
+		a.logsTable.SetCursor(0)
+	} else if a.showsLevel(entry.Level) {
+		a.logsTable.SetCursor(cursor + 1)
+	}
+}
+
+// showsLevel reports whether entries of a level pass the logs level filter
+func (a *App) showsLevel(level string) bool {
+	parsed, err := logger.ParseLevel(level)
+	return err != nil || parsed >= a.logLevel
+}
+
+// cycleLogLevel raises the lowest level shown in the logs, wrapping back
+// round to everything after errors only
+func (a *App) cycleLogLevel() {
+	a.logLevel++
+	if a.logLevel > logger.ERROR {
+		a.logLevel = logger.DEBUG
+	}
 	a.updateLogsTable()
+	a.logsTable.SetCursor(0)
 }
 
 func (a *App) updateLogsTable() {
-	rows := make([]table.Row, len(a.logEntries))
-	for i, entry := range a.logEntries {
+	rows := make([]table.Row, 0, len(a.logEntries))
+	for _, entry := range a.logEntries {
+		if !a.showsLevel(entry.Level) {
+			continue
+		}
 		timeStr := entry.Timestamp.Format("15:04:05")
 		ruleName := entry.RuleName
 		if ruleName == "" {
 			ruleName = "N/A"
 		}
 
-		rows[i] = table.Row{
+		rows = append(rows, table.Row{
 			timeStr,
 			entry.Level,
 			ruleName,
 			entry.Message,
-		}
+		})
 	}
 	a.logsTable.SetRows(rows)
 }
@@ -1144,8 +2039,144 @@ func (a *App) refreshLogs() {
 	})
 }
 
+func (a *App) updateHistory(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch {
+	case key.Matches(msg, key.NewBinding(key.WithKeys("ctrl+c"))):
+		return a, tea.Quit
+	case key.Matches(msg, key.NewBinding(key.WithKeys("esc"))):
+		a.screen = screenMain
+		return a, nil
+	case key.Matches(msg, key.NewBinding(key.WithKeys("r"))):
+		a.loadHistory()
+		a.setMessage("History refreshed", "info")
+		return a, nil
+	case key.Matches(msg, key.NewBinding(key.WithKeys("o", "k"))):
+		a.resolveSelectedConflict(msg.String() == "o")
+		return a, nil
+	}
+
+	var cmd tea.Cmd
+	a.historyTable, cmd = a.historyTable.Update(msg)
+	return a, cmd
+}
+
+func (a *App) viewHistory() string {
+	titleText := fmt.Sprintf("🕘 Sync History — %d Events", len(a.historyEvents))
+	title := titleStyle.Width(a.width).Align(lipgloss.Center).Render(titleText)
+	separator := separatorStyle.Width(a.width).Render(strings.Repeat("─", a.width))
+
+	// Status bar with message
+	var statusBar string
+	if a.message != "" {
+		switch a.messageType {
+		case "success":
+			statusBar = statusStyle.Width(a.width).Render("✓ " + a.message)
+		case "error":
+			statusBar = errorStyle.Width(a.width).Render("✗ " + a.message)
+		case "info":
+			statusBar = helpStyle.Width(a.width).Render("ℹ " + a.message)
+		}
+		statusBar += "\n"
+	}
+
+	helpBar := helpStyle.Width(a.width).Align(lipgloss.Center).Render(
+		"Navigation: ↑/↓ to select • r: refresh • o: overwrite conflict • k: keep local edit • esc: back to main")
+
+	return fmt.Sprintf("%s\n%s\n%s\n%s%s",
+		title,
+		separator,
+		a.historyTable.View(),
+		statusBar,
+		helpBar,
+	)
+}
+
+// loadHistory reads the most recent sync events from the history journal, newest first
+func (a *App) loadHistory() {
+	events, err := history.Read(a.config.HistoryPath(), history.Filter{Limit: 1000})
+	if err != nil {
+		a.setMessage(fmt.Sprintf("Failed to read history: %v", err), "error")
+		return
+	}
+
+	ruleNames := make(map[string]string, len(a.config.Rules))
+	sensitive := make(map[string]bool, len(a.config.Rules))
+	for _, rule := range a.config.Rules {
+		ruleNames[rule.ID] = rule.Name
+		sensitive[rule.ID] = rule.IsSensitive()
+	}
+
+	a.pendingConflicts = make(map[string]bool)
+	for _, event := range sync.PendingConflicts(events) {
+		a.pendingConflicts[event.ID] = true
+	}
+
+	a.historyEvents = make([]models.SyncEvent, 0, len(events))
+	rows := make([]table.Row, 0, len(events))
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		a.historyEvents = append(a.historyEvents, event)
+
+		ruleName := ruleNames[event.RuleID]
+		if ruleName == "" {
+			ruleName = event.RuleID
+		}
+		shown := event
+		shown.Sensitive = event.Sensitive || sensitive[event.RuleID]
+		shown = shown.Redacted()
+		change := fmt.Sprintf("%v → %v", shown.OldValue, shown.NewValue)
+		if !event.Success {
+			change = "✗ " + event.Error
+		}
+		if a.pendingConflicts[event.ID] {
+			change = fmt.Sprintf("⚠ local %v, synced %v", shown.OldValue, shown.NewValue)
+		}
+
+		rows = append(rows, table.Row{
+			event.Timestamp.Local().Format("2006-01-02 15:04:05"),
+			ruleName,
+			fmt.Sprintf("%s:%s", filepath.Base(event.TargetFile), event.TargetKey),
+			change,
+		})
+	}
+	a.historyTable.SetRows(rows)
+}
+
+// resolveSelectedConflict settles the conflict selected in the history table,
+// either writing the synced value over the local edit or keeping the edit
+func (a *App) resolveSelectedConflict(overwrite bool) {
+	cursor := a.historyTable.Cursor()
+	if cursor < 0 || cursor >= len(a.historyEvents) || !a.pendingConflicts[a.historyEvents[cursor].ID] {
+		a.setMessage("Selected event is not a pending conflict", "error")
+		return
+	}
+	event := a.historyEvents[cursor]
+
+	if _, err := sync.New(a.config, a.logger).ResolveConflict(event, overwrite); err != nil {
+		a.setMessage(fmt.Sprintf("Failed to resolve conflict: %v", err), "error")
+		return
+	}
+
+	a.loadHistory()
+	if overwrite {
+		a.setMessage(fmt.Sprintf("Wrote %v to %s", event.Redacted().NewValue, event.TargetKey), "success")
+	} else {
+		a.setMessage(fmt.Sprintf("Kept local value of %s", event.TargetKey), "success")
+	}
+}
+
 func (a *App) Run() error {
+	// Warnings would otherwise be written over the screen
+	a.logger.SetConsole(io.Discard)
+	defer a.logger.SetConsole(os.Stdout)
+
 	p := tea.NewProgram(a, tea.WithAltScreen())
 	_, err := p.Run()
+
+	// Let the watcher finish what it is doing, such as running hooks
+	if watch := a.watch; watch != nil {
+		a.stopWatch()
+		<-watch.done
+	}
 	return err
 }
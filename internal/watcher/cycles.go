@@ -0,0 +1,135 @@
+package watcher
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"var-sync/internal/parser"
+	"var-sync/pkg/models"
+)
+
+// Rules are chained when one writes a key another reads. A chain that leads
+// back to where it started never settles if any rule on the way changes the
+// value, through a source expression or target type, and syncs back and
+// forth until a debounce happens to absorb a change. So rules that form a
+// cycle are refused. Keys are compared by the part before any wildcard or
+// array operation. A source expression reads the keys it names, and a
+// template or JSONPath key reads every key of its source.
+
+// RuleCycles describes a cycle of every group of enabled rules that feed
+// each other, such as "a -> b -> a" for a rule b syncing back the key a
+// wrote. Rules must be expanded and resolved, as SetRules does.
+func RuleCycles(rules []models.SyncRule) []string {
+	var enabled []models.SyncRule
+	for _, rule := range rules {
+		if rule.Enabled {
+			enabled = append(enabled, rule)
+		}
+	}
+	sources := make([]string, len(enabled))
+	targets := make([]string, len(enabled))
+	written := make([]string, len(enabled))
+	read := make([][]string, len(enabled))
+	for i, rule := range enabled {
+		sources[i] = resolvedPath(rule.SourceFile)
+		targets[i] = resolvedPath(rule.TargetFile)
+		written[i] = writtenKey(rule)
+		read[i] = readKeys(rule)
+	}
+	feeds := func(i, j int) bool {
+		if !samePath(targets[i], sources[j]) {
+			return false
+		}
+		return slices.ContainsFunc(read[j], func(key string) bool { return keysOverlap(written[i], key) })
+	}
+
+	// Every edge back to a rule still being visited closes a cycle of the
+	// rules on the stack from that one on
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	states := make([]int, len(enabled))
+	var stack []int
+	seen := make(map[string]bool)
+	var cycles []string
+	var visit func(i int)
+	visit = func(i int) {
+		states[i] = visiting
+		stack = append(stack, i)
+		for j := range enabled {
+			if !feeds(i, j) {
+				continue
+			}
+			switch states[j] {
+			case unvisited:
+				visit(j)
+			case visiting:
+				var ids []string
+				for _, k := range stack[slices.Index(stack, j):] {
+					ids = append(ids, enabled[k].ID)
+				}
+				members := slices.Clone(ids)
+				sort.Strings(members)
+				if key := strings.Join(members, " "); !seen[key] {
+					seen[key] = true
+					cycles = append(cycles, strings.Join(append(ids, enabled[j].ID), " -> "))
+				}
+			}
+		}
+		stack = stack[:len(stack)-1]
+		states[i] = visited
+	}
+	for i := range enabled {
+		if states[i] == unvisited {
+			visit(i)
+		}
+	}
+	return cycles
+}
+
+// writtenKey returns the key rule writes in its target, or "" if it writes
+// the whole target
+func writtenKey(rule models.SyncRule) string {
+	if rule.IsTemplate() {
+		return ""
+	}
+	key, _ := parser.AppendPath(rule.TargetKey)
+	return keyPrefix(key)
+}
+
+// readKeys returns the keys rule reads from its source, "" if it reads the
+// whole source
+func readKeys(rule models.SyncRule) []string {
+	if rule.SourceExpr != "" {
+		keys, ok := parser.ExpressionKeys(rule.SourceExpr)
+		if !ok {
+			return []string{""}
+		}
+		for i, key := range keys {
+			keys[i] = keyPrefix(key)
+		}
+		return keys
+	}
+	if rule.IsTemplate() || strings.HasPrefix(rule.SourceKey, "$") {
+		return []string{""}
+	}
+	return []string{keyPrefix(rule.SourceKey)}
+}
+
+// keyPrefix returns key up to its first wildcard or array operation, which
+// may select any key below that
+func keyPrefix(key string) string {
+	if i := strings.IndexAny(key, "*["); i >= 0 {
+		key = key[:i]
+	}
+	return strings.TrimSuffix(key, ".")
+}
+
+// keysOverlap reports whether two keys, "" for every key, are the same or
+// one lies below the other
+func keysOverlap(a, b string) bool {
+	return a == "" || b == "" || a == b || strings.HasPrefix(a, b+".") || strings.HasPrefix(b, a+".")
+}
@@ -0,0 +1,100 @@
+package watcher
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"var-sync/pkg/models"
+)
+
+// spill keeps sync events that did not fit in the event queue in a JSONL
+// file, oldest first, until the queue has room for them again
+type spill struct {
+	path    string
+	pending int // Events in the file not yet taken back
+	mutex   sync.Mutex
+}
+
+// newSpill opens the spill file at path, picking up any events left in it by
+// an earlier run
+func newSpill(path string) *spill {
+	s := &spill{path: path}
+	if file, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			s.pending++
+		}
+		file.Close()
+	}
+	return s
+}
+
+// Send puts an event on queue, or appends it to the file if the queue is
+// full or events are already waiting in the file, so that events keep their
+// order. It reports whether the event was spilled.
+func (s *spill) Send(queue chan<- models.SyncEvent, event models.SyncEvent) (bool, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.pending == 0 {
+		select {
+		case queue <- event:
+			return false, nil
+		default:
+		}
+	}
+
+	data, err := json.Marshal(event.Redacted())
+	if err != nil {
+		return true, fmt.Errorf("failed to marshal event: %w", err)
+	}
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return true, fmt.Errorf("failed to open spill file: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return true, fmt.Errorf("failed to write spill file: %w", err)
+	}
+	s.pending++
+	return true, nil
+}
+
+// Take returns the events in the file, oldest first, and empties it
+func (s *spill) Take() ([]models.SyncEvent, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.pending == 0 {
+		return nil, nil
+	}
+	file, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spill file: %w", err)
+	}
+	defer file.Close()
+
+	var events []models.SyncEvent
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var event models.SyncEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			continue
+		}
+		events = append(events, event)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read spill file: %w", err)
+	}
+
+	if err := os.Remove(s.path); err != nil {
+		return nil, fmt.Errorf("failed to empty spill file: %w", err)
+	}
+	s.pending = 0
+	return events, nil
+}
@@ -0,0 +1,18 @@
+//go:build !windows
+
+package watcher
+
+// watchPath returns the path to watch dir by, which is dir itself
+func watchPath(dir string) string {
+	return dir
+}
+
+// eventPath returns the path of a file fsnotify reported an event for
+func eventPath(name string) string {
+	return name
+}
+
+// samePath reports whether two absolute paths name the same file
+func samePath(a, b string) bool {
+	return a == b
+}
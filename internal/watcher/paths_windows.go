@@ -0,0 +1,46 @@
+//go:build windows
+
+package watcher
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// extendedPrefix marks an extended-length Windows path, which is not limited
+// to MAX_PATH
+const extendedPrefix = `\\?\`
+
+// maxDirPath is the longest directory path Windows opens without the
+// extended-length prefix: MAX_PATH less room for an 8.3 file name
+const maxDirPath = 248
+
+// watchPath returns the path to watch dir by. fsnotify opens directories
+// through the Windows API directly, which fails for long paths unless they
+// are given as extended-length paths.
+func watchPath(dir string) string {
+	abs, err := filepath.Abs(dir)
+	if err != nil || len(abs) < maxDirPath || strings.HasPrefix(abs, extendedPrefix) {
+		return dir
+	}
+	if share, ok := strings.CutPrefix(abs, `\\`); ok {
+		return extendedPrefix + `UNC\` + share
+	}
+	return extendedPrefix + abs
+}
+
+// eventPath returns the path of a file fsnotify reported an event for the
+// way rules name it, without the prefix watchPath may have added
+func eventPath(name string) string {
+	if share, ok := strings.CutPrefix(name, extendedPrefix+`UNC\`); ok {
+		return `\\` + share
+	}
+	return strings.TrimPrefix(name, extendedPrefix)
+}
+
+// samePath reports whether two absolute paths name the same file. Windows
+// file systems ignore case, and fsnotify reports a file name the way it is
+// written on disk rather than the way a rule names it.
+func samePath(a, b string) bool {
+	return strings.EqualFold(a, b)
+}
@@ -0,0 +1,153 @@
+package watcher
+
+import (
+	"errors"
+	"fmt"
+
+	"var-sync/pkg/models"
+)
+
+// A paused rule stays configured, but changes to its source are not synced
+// until it is resumed, which syncs it straight away to catch up. Unlike
+// disabling a rule, pausing it only lasts as long as the watcher runs.
+
+// ErrRuleNotFound is returned for a rule ID the watcher does not have
+var ErrRuleNotFound = errors.New("rule not found")
+
+// Rules returns the rules as configured, before glob sources and mappings
+// are expanded
+func (fw *FileWatcher) Rules() []models.SyncRule {
+	fw.eventsMutex.RLock()
+	defer fw.eventsMutex.RUnlock()
+	return append([]models.SyncRule(nil), fw.configured...)
+}
+
+// Pause stops syncing the rule with the given ID until Resume is called
+func (fw *FileWatcher) Pause(ruleID string) error {
+	if _, err := fw.rulesByID(ruleID); err != nil {
+		return err
+	}
+
+	fw.pausedMutex.Lock()
+	fw.paused[ruleID] = true
+	fw.pausedMutex.Unlock()
+
+	fw.logger.Rule(ruleID).Info("Paused rule %s", ruleID)
+	return nil
+}
+
+// Resume syncs the paused rule with the given ID again, starting with
+// whatever changed while it was paused
+func (fw *FileWatcher) Resume(ruleID string) error {
+	rules, err := fw.rulesByID(ruleID)
+	if err != nil {
+		return err
+	}
+
+	fw.pausedMutex.Lock()
+	wasPaused := fw.paused[ruleID]
+	delete(fw.paused, ruleID)
+	fw.pausedMutex.Unlock()
+	if !wasPaused {
+		return nil
+	}
+
+	fw.logger.Rule(ruleID).Info("Resumed rule %s", ruleID)
+	fw.batchBySource(rules)
+	return nil
+}
+
+// IsPaused reports whether the rule with the given ID is paused
+func (fw *FileWatcher) IsPaused(ruleID string) bool {
+	fw.pausedMutex.Lock()
+	defer fw.pausedMutex.Unlock()
+	return fw.paused[ruleID]
+}
+
+// Sync syncs the rules with the given IDs, or every enabled rule that is not
+// paused if none are given, as if their sources had just changed. It returns
+// how many rules were batched.
+func (fw *FileWatcher) Sync(ruleIDs ...string) (int, error) {
+	var rules []models.SyncRule
+	if len(ruleIDs) == 0 {
+		fw.eventsMutex.RLock()
+		for _, rule := range fw.rules {
+			if rule.Enabled && !fw.IsPaused(rule.ID) {
+				rules = append(rules, rule)
+			}
+		}
+		fw.eventsMutex.RUnlock()
+	}
+	for _, ruleID := range ruleIDs {
+		matches, err := fw.rulesByID(ruleID)
+		if err != nil {
+			return 0, err
+		}
+		if fw.IsPaused(ruleID) {
+			return 0, fmt.Errorf("rule %s is paused", ruleID)
+		}
+		for _, rule := range matches {
+			if !rule.Enabled {
+				return 0, fmt.Errorf("rule %s is disabled", ruleID)
+			}
+		}
+		rules = append(rules, matches...)
+	}
+
+	fw.batchBySource(rules)
+	return len(rules), nil
+}
+
+// rulesByID returns the rules with the given ID: one per matching file for
+// a glob rule, which may match none
+func (fw *FileWatcher) rulesByID(ruleID string) ([]models.SyncRule, error) {
+	fw.eventsMutex.RLock()
+	defer fw.eventsMutex.RUnlock()
+
+	var rules []models.SyncRule
+	for _, rule := range fw.rules {
+		if rule.ID == ruleID {
+			rules = append(rules, rule)
+		}
+	}
+	if len(rules) > 0 {
+		return rules, nil
+	}
+	for _, rule := range fw.configured {
+		if rule.ID == ruleID {
+			return nil, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", ErrRuleNotFound, ruleID)
+}
+
+// batchBySource batches rules with the others of their source
+func (fw *FileWatcher) batchBySource(rules []models.SyncRule) {
+	sources := make(map[string][]models.SyncRule)
+	for _, rule := range rules {
+		source := locationKey(rule.SourceFile)
+		sources[source] = append(sources[source], rule)
+	}
+	for source, rules := range sources {
+		fw.batchRules(source, rules)
+	}
+}
+
+// unpaused returns the rules that are not paused
+func (fw *FileWatcher) unpaused(rules []models.SyncRule) []models.SyncRule {
+	fw.pausedMutex.Lock()
+	defer fw.pausedMutex.Unlock()
+	if len(fw.paused) == 0 {
+		return rules
+	}
+
+	result := make([]models.SyncRule, 0, len(rules))
+	for _, rule := range rules {
+		if fw.paused[rule.ID] {
+			fw.logger.Rule(rule.ID).Debug("Rule %s not synced: it is paused", rule.ID)
+			continue
+		}
+		result = append(result, rule)
+	}
+	return result
+}
@@ -0,0 +1,98 @@
+package watcher
+
+import (
+	"time"
+
+	"var-sync/pkg/models"
+)
+
+// A rule with a min_interval syncs at most once per interval, and with a
+// target min interval every target file is written at most once per
+// interval, so that a source rewritten continuously does not hammer targets
+// and their hooks. A change that comes too soon is held back and synced once
+// the interval is up, with whatever value the source has by then.
+
+// SetTargetMinInterval sets how long after a target file is written it must
+// be left alone, zero for no limit
+func (fw *FileWatcher) SetTargetMinInterval(interval time.Duration) {
+	fw.targetMinInterval = interval
+}
+
+// rateLimited returns the rules whose intervals allow syncing now, holding
+// back the others until they do. While stopping nothing is held back.
+func (fw *FileWatcher) rateLimited(rules []models.SyncRule) []models.SyncRule {
+	select {
+	case <-fw.stopChan:
+		return rules
+	default:
+	}
+
+	now := time.Now()
+	fw.rateMutex.Lock()
+	defer fw.rateMutex.Unlock()
+
+	allowed := make([]models.SyncRule, 0, len(rules))
+	for _, rule := range rules {
+		key := queueKey(rule)
+		next := fw.lastRuleSync[key].Add(time.Duration(rule.MinInterval))
+		if fw.targetMinInterval > 0 {
+			if target := fw.lastTargetWrite[locationKey(rule.TargetFile)].Add(fw.targetMinInterval); target.After(next) {
+				next = target
+			}
+		}
+		if !now.Before(next) {
+			allowed = append(allowed, rule)
+			continue
+		}
+
+		if _, held := fw.limited[key]; !held {
+			fw.limited[key] = time.AfterFunc(next.Sub(now), func() { fw.releaseLimited(key) })
+			fw.logger.Rule(rule.ID).Info("Holding back change to %s for rule %s for %v to respect its minimum interval", rule.SourceFile, rule.ID, next.Sub(now).Round(time.Millisecond))
+		}
+	}
+
+	// Rules writing the same target in this batch share one write
+	for _, rule := range allowed {
+		fw.lastRuleSync[queueKey(rule)] = now
+		fw.lastTargetWrite[locationKey(rule.TargetFile)] = now
+	}
+	return allowed
+}
+
+// releaseLimited batches the rule held back under key, as it is configured
+// now, once its interval is up
+func (fw *FileWatcher) releaseLimited(key string) {
+	fw.rateMutex.Lock()
+	_, held := fw.limited[key]
+	delete(fw.limited, key)
+	fw.rateMutex.Unlock()
+	if !held {
+		return
+	}
+
+	var rules []models.SyncRule
+	fw.eventsMutex.RLock()
+	for _, rule := range fw.rules {
+		if queueKey(rule) == key && rule.Enabled {
+			rules = append(rules, rule)
+		}
+	}
+	fw.eventsMutex.RUnlock()
+	fw.batchBySource(rules)
+}
+
+// releaseAllLimited batches every rule held back, such as before stopping
+func (fw *FileWatcher) releaseAllLimited() {
+	fw.rateMutex.Lock()
+	keys := make([]string, 0, len(fw.limited))
+	for key, timer := range fw.limited {
+		if timer.Stop() {
+			keys = append(keys, key)
+		}
+	}
+	fw.rateMutex.Unlock()
+
+	for _, key := range keys {
+		fw.releaseLimited(key)
+	}
+}
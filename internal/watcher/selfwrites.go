@@ -0,0 +1,131 @@
+package watcher
+
+import (
+	"crypto/sha256"
+	"os"
+	"path/filepath"
+	"time"
+
+	"var-sync/internal/backend"
+	"var-sync/pkg/models"
+)
+
+// Writing a target raises watch events for it like any other edit. When the
+// target is also the source of other rules, those events would resync them
+// through the debounce meant for editors, and an edit made just after the
+// write would be debounced away. So the content of every target var-sync
+// writes is remembered for the self write window, and events for the target
+// while it still holds that content are ignored; the rules reading the
+// target are batched directly instead. An edit within the window changes the
+// content, so it is seen as usual. Events that arrive while a write is in
+// progress wait for it to finish before they are checked.
+
+// ownWrite is the content var-sync last wrote to a target, and when
+type ownWrite struct {
+	hash [sha256.Size]byte
+	at   time.Time
+}
+
+// SetSelfWriteWindow sets how long after var-sync writes a target events for
+// it are ignored while it holds what was written, zero to handle them all
+func (fw *FileWatcher) SetSelfWriteWindow(window time.Duration) {
+	fw.selfWriteWindow = window
+}
+
+// writeTarget runs write, which writes targetFile, and remembers what it
+// wrote. Rules whose source is targetFile are batched once it has been
+// written. Backends raise no watch events, so their writes are just run.
+func (fw *FileWatcher) writeTarget(targetFile string, write func() error) error {
+	if fw.selfWriteWindow <= 0 || backend.IsRef(targetFile) {
+		return write()
+	}
+
+	path := resolvedPath(targetFile)
+	done := make(chan struct{})
+	fw.ownWritesMutex.Lock()
+	fw.writingTargets[path] = done
+	fw.ownWritesMutex.Unlock()
+
+	err := write()
+
+	content, readErr := os.ReadFile(path)
+	fw.ownWritesMutex.Lock()
+	delete(fw.writingTargets, path)
+	now := time.Now()
+	for written, own := range fw.ownWrites {
+		if now.Sub(own.at) >= fw.selfWriteWindow {
+			delete(fw.ownWrites, written)
+		}
+	}
+	if readErr == nil {
+		fw.ownWrites[path] = ownWrite{hash: sha256.Sum256(content), at: now}
+	} else {
+		delete(fw.ownWrites, path)
+	}
+	fw.ownWritesMutex.Unlock()
+	close(done)
+
+	if err == nil {
+		fw.batchChained(path)
+	}
+	return err
+}
+
+// selfWritten reports whether an event for path was caused by var-sync
+// writing it: path is being written, in which case the returned channel is
+// closed once it has been, or it still holds what var-sync wrote within the
+// self write window
+func (fw *FileWatcher) selfWritten(path string) (bool, <-chan struct{}) {
+	if fw.selfWriteWindow <= 0 {
+		return false, nil
+	}
+	path = resolvedPath(path)
+
+	fw.ownWritesMutex.Lock()
+	defer fw.ownWritesMutex.Unlock()
+	for writing, done := range fw.writingTargets {
+		if samePath(writing, path) {
+			return true, done
+		}
+	}
+	for written, own := range fw.ownWrites {
+		if !samePath(written, path) {
+			continue
+		}
+		if time.Since(own.at) < fw.selfWriteWindow {
+			if content, err := os.ReadFile(path); err == nil && sha256.Sum256(content) == own.hash {
+				return true, nil
+			}
+		}
+		delete(fw.ownWrites, written)
+	}
+	return false, nil
+}
+
+// batchChained batches the watched rules whose source is the target file at
+// path, since the events of the write that changed it are ignored
+func (fw *FileWatcher) batchChained(path string) {
+	fw.eventsMutex.RLock()
+	var chained []models.SyncRule
+	for _, rule := range fw.rules {
+		if rule.Enabled && !rule.Polled(fw.watchMode) && !backend.IsRef(rule.SourceFile) && samePath(resolvedPath(rule.SourceFile), path) {
+			chained = append(chained, rule)
+		}
+	}
+	fw.eventsMutex.RUnlock()
+
+	if len(chained) > 0 {
+		fw.logger.Debug("Target file %s is the source of %d rules, batching them", path, len(chained))
+		fw.batchBySource(chained)
+	}
+}
+
+// resolvedPath returns the absolute path of a file with symbolic links
+// resolved, so that a source linking to a target is known as that target
+func resolvedPath(path string) string {
+	path = locationKey(path)
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return path
+}
@@ -0,0 +1,61 @@
+package watcher
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// A source that is a symbolic link changes without an event for its own path
+// when the file it points to is edited, or when a link on the way is swapped
+// for one pointing elsewhere, as Kubernetes does with the ..data link of a
+// mounted ConfigMap. Such sources are followed to the file they resolve to,
+// whose directory is watched too, and events there or in the directory of
+// the link are mapped back to the source.
+
+// followLink records where source resolves to and watches that directory,
+// if source is a symbolic link or lies under one
+func (fw *FileWatcher) followLink(watchedDirs map[string]bool, source string) {
+	link := locationKey(source)
+	resolved, err := filepath.EvalSymlinks(link)
+	if err != nil || resolved == link {
+		return
+	}
+
+	fw.linksMutex.Lock()
+	fw.links[link] = resolved
+	fw.linksMutex.Unlock()
+	fw.watchDir(watchedDirs, resolved)
+}
+
+// linkedSources returns the sources that are symbolic links affected by an
+// event for path: an edit of the file one resolves to, or a change in the
+// directory of one that makes it resolve elsewhere
+func (fw *FileWatcher) linkedSources(path string) []string {
+	absPath := locationKey(path)
+
+	fw.linksMutex.Lock()
+	defer fw.linksMutex.Unlock()
+
+	var affected []string
+	for link, resolved := range fw.links {
+		if samePath(absPath, resolved) {
+			affected = append(affected, link)
+			continue
+		}
+		if !samePath(filepath.Dir(absPath), filepath.Dir(link)) || samePath(absPath, link) {
+			continue
+		}
+
+		current, err := filepath.EvalSymlinks(link)
+		if err != nil || current == resolved {
+			continue
+		}
+		fw.logger.Info("Source %s now resolves to %s", link, current)
+		fw.links[link] = current
+		if err := fw.watcher.Add(watchPath(filepath.Dir(current))); err != nil && !os.IsNotExist(err) {
+			fw.logger.Error("Failed to watch directory: %s, error: %v", filepath.Dir(current), err)
+		}
+		affected = append(affected, link)
+	}
+	return affected
+}
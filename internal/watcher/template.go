@@ -0,0 +1,96 @@
+package watcher
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"time"
+
+	"var-sync/internal/render"
+	"var-sync/internal/textfile"
+	"var-sync/pkg/models"
+)
+
+// A template rule renders its template with the whole source document into
+// its target file, replacing the file rather than updating keys in it. The
+// target is only written when the rendered output differs from it.
+
+// renderTemplate renders the template of rule into its target file for the
+// source change changeID
+func (fw *FileWatcher) renderTemplate(changeID string, sourceData map[string]any, rule models.SyncRule) models.SyncEvent {
+	fw.writing.RLock()
+	defer fw.writing.RUnlock()
+
+	targetFile := locationKey(rule.TargetFile)
+	targetMutex := fw.getTargetFileMutex(targetFile)
+	targetMutex.Lock()
+	defer targetMutex.Unlock()
+
+	event := models.SyncEvent{
+		ChangeID:   changeID,
+		RuleID:     rule.ID,
+		TargetFile: rule.TargetFile,
+		Timestamp:  time.Now(),
+		Sensitive:  rule.IsSensitive(),
+	}
+	if err := fw.writeTemplate(targetFile, sourceData, rule); err != nil {
+		fw.logger.Rule(rule.ID).Error("Failed to render template %s into %s: %v", rule.Template, targetFile, err)
+		event.Error = fmt.Sprintf("Failed to sync template: %v", err)
+	} else {
+		event.Success = true
+	}
+	return event
+}
+
+// writeTemplate renders rule's template and writes it to targetFile if it
+// changed, backing the target up first if the rule wants backups
+func (fw *FileWatcher) writeTemplate(targetFile string, sourceData map[string]any, rule models.SyncRule) error {
+	rendered, err := render.Execute(rule.Template, sourceData)
+	if err != nil {
+		return err
+	}
+
+	// Keep the content before the sync to roll back to if the written target
+	// does not check out; nil if the template creates the target
+	original, err := os.ReadFile(targetFile)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read target file: %w", err)
+	}
+	if original != nil {
+		if bytes.Equal(textfile.Normalize(original), rendered) {
+			fw.logger.Debug("Target file %s already holds the rendered template, not writing it", targetFile)
+			return nil
+		}
+		if rule.BackupEnabled(fw.backupConfig) {
+			if _, err := fw.backups.Backup(targetFile); err != nil {
+				return fmt.Errorf("failed to back up target file: %w", err)
+			}
+		}
+	}
+
+	if err := fw.writeTarget(targetFile, func() error {
+		return fw.withRetry("Writing target "+targetFile, func() error {
+			return textfile.Write(targetFile, rendered)
+		})
+	}); err != nil {
+		return fmt.Errorf("failed to update target file: %w", err)
+	}
+	if err := fw.checkTarget(targetFile, nil, original); err != nil {
+		return fmt.Errorf("target file %w", err)
+	}
+
+	fw.logger.Info("Rendered template %s into target file %s", rule.Template, targetFile)
+	return nil
+}
+
+// templateOutOfSync reports whether the target of a template rule differs
+// from what its template renders for sourceData
+func (fw *FileWatcher) templateOutOfSync(sourceData map[string]any, rule models.SyncRule) bool {
+	rendered, err := render.Execute(rule.Template, sourceData)
+	if err != nil {
+		fw.logger.Rule(rule.ID).Debug("Rule %s not reconciled: %v", rule.ID, err)
+		return false
+	}
+	current, err := textfile.Read(rule.TargetFile)
+	return err != nil || !bytes.Equal(current, rendered)
+}
@@ -1,15 +1,31 @@
 package watcher
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"sort"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
 
+	"var-sync/internal/backend"
+	"var-sync/internal/backup"
 	"var-sync/internal/logger"
 	"var-sync/internal/parser"
+	"var-sync/internal/schedule"
+	"var-sync/internal/schema"
+	"var-sync/internal/state"
+	"var-sync/internal/textfile"
 	"var-sync/pkg/models"
 )
 
@@ -20,18 +36,150 @@ type FileWatcher struct {
 	parser      *parser.Parser
 	logger      *logger.Logger
 	rules       []models.SyncRule
+	configured  []models.SyncRule // Rules as configured, before glob sources and mappings are expanded
 	debounce    time.Duration
 	lastEvents  map[string]time.Time
 	eventsMutex sync.RWMutex
 	eventChan   chan models.SyncEvent
 	stopChan    chan struct{}
 
+	// Events held back while var-sync was writing the file, handed back to
+	// handleEvents once the write is done
+	deferredEvents chan string
+
+	// Where each source that is a symbolic link resolves to, by locationKey
+	links      map[string]string
+	linksMutex sync.Mutex
+
 	// Target file synchronization - prevents concurrent writes to same file
 	targetFileMutexes map[string]*sync.Mutex
 	targetMutex       sync.RWMutex
 
+	// How many target files of a source change are written at once
+	targetWorkers int
+
+	// Held while target files are written, so Stop can wait for writes in
+	// progress, for at most shutdownTimeout
+	writing         sync.RWMutex
+	shutdownTimeout time.Duration
+
+	// Cancelled once the watcher has stopped, or gives up waiting for writes
+	// in progress, so that remote backend calls and retries end with it
+	ctx    context.Context
+	cancel context.CancelFunc
+
 	// Batch processing for same-source-file changes
 	batchProcessor *BatchProcessor
+
+	// Backups taken before target files are modified
+	backupConfig *models.BackupConfig
+	backups      *backup.Manager
+
+	// JSON Schema each target file must match after a sync, by locationKey
+	schemas map[string]string
+
+	// Sources and targets that are not local files
+	backends     *backend.Registry
+	pollInterval time.Duration
+
+	// Whether local sources are watched with fsnotify or polled, unless a
+	// rule says otherwise
+	watchMode models.WatchMode
+
+	// How failed source loads and target updates are retried
+	retry *models.RetryPolicy
+
+	// How often every rule is checked for drift regardless of watch events;
+	// zero disables reconciling
+	reconcileInterval time.Duration
+
+	// Values last written to each target, used to detect hand edits
+	state          *state.Store
+	conflictPolicy models.ConflictPolicy
+
+	// Whether target files are watched for keys edited outside var-sync
+	drift *models.DriftConfig
+
+	// Whether SetRules refuses rules that write the same target key from
+	// different sources, rather than warning about them
+	strictRules bool
+
+	// Listeners notified of every sync event
+	listeners      []func(models.SyncEvent)
+	listenersMutex sync.RWMutex
+
+	// Sequence number of the last event sent. Events are numbered and
+	// delivered one at a time, so every consumer sees them in order.
+	sequence  uint64
+	sendMutex sync.Mutex
+
+	// Changes and events that were dropped rather than processed, and events
+	// written to the spill file because the event queue was full
+	debounceDrops atomic.Uint64
+	droppedEvents atomic.Uint64
+	spilledEvents atomic.Uint64
+
+	// What happens to events sent while the event queue is full
+	queue *models.EventQueue
+	spill *spill
+
+	// Whether the watcher is running, how many sources it follows, and
+	// ongoing errors by the directory or source they affect
+	running      atomic.Bool
+	watchedFiles int
+	errors       map[string]WatchError
+	errorsMutex  sync.Mutex
+
+	// Schedules of rules that only sync at certain times by rule ID, and
+	// rules with changes waiting for their schedule to open by queueKey and
+	// target key, which tells the mappings of a rule apart
+	schedules        map[string]*schedule.Schedule
+	queued           map[string]models.SyncRule
+	scheduleMutex    sync.Mutex
+	scheduleInterval time.Duration
+
+	// Rules paused by rule ID, whose changes are not synced until resumed
+	paused      map[string]bool
+	pausedMutex sync.Mutex
+
+	// When each rule last synced by queueKey and each target file was last
+	// written by locationKey, and the timers releasing rules held back until
+	// their minimum interval is up by queueKey
+	lastRuleSync      map[string]time.Time
+	lastTargetWrite   map[string]time.Time
+	limited           map[string]*time.Timer
+	targetMinInterval time.Duration
+	rateMutex         sync.Mutex
+
+	// Targets being written and what var-sync last wrote to each, by
+	// resolvedPath, whose events are ignored for selfWriteWindow
+	writingTargets  map[string]chan struct{}
+	ownWrites       map[string]ownWrite
+	ownWritesMutex  sync.Mutex
+	selfWriteWindow time.Duration
+}
+
+// Stats counts work the watcher dropped and how full its event queue is
+type Stats struct {
+	DebounceDrops uint64 // File changes ignored because they followed another too closely
+	DroppedEvents uint64 // Sync events discarded because the event queue was full
+	SpilledEvents uint64 // Sync events written to the spill file because the event queue was full
+	QueueLength   int
+	QueueCapacity int
+}
+
+// Status describes the watcher for health checks
+type Status struct {
+	Running      bool
+	WatchedFiles int
+	Errors       map[string]WatchError
+}
+
+// WatchError is an error that keeps the watcher from following a directory
+// or source, and when it first occurred
+type WatchError struct {
+	Message string    `json:"message"`
+	Since   time.Time `json:"since"`
 }
 
 // BatchProcessor handles batching multiple rule changes from the same source file
@@ -39,13 +187,15 @@ type BatchProcessor struct {
 	batches     map[string]*RuleBatch
 	batchMutex  sync.Mutex
 	batchDelay  time.Duration
-	processChan chan string // Source file paths to process
+	maxDelay    time.Duration // Longest a batch may wait however often its source changes, zero for no limit
+	processChan chan string   // Source file paths to process
 }
 
 // RuleBatch represents a batch of rules that need to be processed together
 type RuleBatch struct {
 	sourceFile string
 	rules      []models.SyncRule
+	started    time.Time // When the first change of the batch arrived
 	timer      *time.Timer
 	mutex      sync.Mutex
 }
@@ -57,18 +207,40 @@ func New(logger *logger.Logger) (*FileWatcher, error) {
 		return nil, fmt.Errorf("failed to create file watcher: %w", err)
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	fw := &FileWatcher{
+		ctx:               ctx,
+		cancel:            cancel,
 		watcher:           watcher,
 		parser:            parser.New(),
-		logger:            logger,
-		debounce:          500 * time.Millisecond,
+		logger:            logger.Module("watcher"),
+		debounce:          models.DefaultDebounce,
 		lastEvents:        make(map[string]time.Time),
+		links:             make(map[string]string),
 		eventChan:         make(chan models.SyncEvent, 100),
+		deferredEvents:    make(chan string, 100),
 		stopChan:          make(chan struct{}),
 		targetFileMutexes: make(map[string]*sync.Mutex),
+		errors:            make(map[string]WatchError),
+		schedules:         make(map[string]*schedule.Schedule),
+		queued:            make(map[string]models.SyncRule),
+		paused:            make(map[string]bool),
+		lastRuleSync:      make(map[string]time.Time),
+		lastTargetWrite:   make(map[string]time.Time),
+		limited:           make(map[string]*time.Timer),
+		writingTargets:    make(map[string]chan struct{}),
+		ownWrites:         make(map[string]ownWrite),
+		selfWriteWindow:   models.DefaultSelfWriteWindow,
+		scheduleInterval:  30 * time.Second,
+		backups:           backup.New(nil),
+		backends:          backend.NewRegistry(),
+		pollInterval:      models.DefaultPollInterval,
+		conflictPolicy:    models.ConflictOverwrite,
+		shutdownTimeout:   models.DefaultShutdownTimeout,
+		targetWorkers:     models.DefaultTargetWorkers,
 		batchProcessor: &BatchProcessor{
 			batches:     make(map[string]*RuleBatch),
-			batchDelay:  200 * time.Millisecond, // Batch rules for 200ms
+			batchDelay:  models.DefaultBatchDelay,
 			processChan: make(chan string, 100),
 		},
 	}
@@ -78,10 +250,7 @@ func New(logger *logger.Logger) (*FileWatcher, error) {
 
 // getTargetFileMutex returns a mutex for the given target file, creating it if necessary
 func (fw *FileWatcher) getTargetFileMutex(targetFile string) *sync.Mutex {
-	absPath, err := filepath.Abs(targetFile)
-	if err != nil {
-		absPath = targetFile
-	}
+	absPath := locationKey(targetFile)
 
 	fw.targetMutex.RLock()
 	if mutex, exists := fw.targetFileMutexes[absPath]; exists {
@@ -103,46 +272,267 @@ func (fw *FileWatcher) getTargetFileMutex(targetFile string) *sync.Mutex {
 	return mutex
 }
 
+// SetBackupConfig sets the global backup settings used for rules that do not
+// override them
+func (fw *FileWatcher) SetBackupConfig(cfg *models.BackupConfig) {
+	fw.backupConfig = cfg
+	fw.backups = backup.New(cfg)
+}
+
+// SetSchemas sets the JSON Schema each target file must still match after a
+// sync, by target file. A target that no longer matches is rolled back.
+func (fw *FileWatcher) SetSchemas(schemas map[string]string) {
+	fw.schemas = make(map[string]string, len(schemas))
+	for target, schemaPath := range schemas {
+		fw.schemas[locationKey(target)] = schemaPath
+	}
+}
+
+// SetBackends sets the registry used to read and write sources and targets
+// that are backend references rather than local files. It must be called
+// before SetRules.
+func (fw *FileWatcher) SetBackends(backends *backend.Registry) {
+	fw.backends = backends
+}
+
+// SetPollInterval sets how often polled source files, and backend sources
+// that cannot report their own changes, are polled
+func (fw *FileWatcher) SetPollInterval(interval time.Duration) {
+	fw.pollInterval = interval
+}
+
+// SetDebounce sets how long after a change to a file further changes are
+// ignored, for rules without their own debounce
+func (fw *FileWatcher) SetDebounce(debounce time.Duration) {
+	fw.debounce = debounce
+}
+
+// SetBatchDelay sets how long a source must be left alone before its rules
+// sync, for rules without their own batch delay
+func (fw *FileWatcher) SetBatchDelay(delay time.Duration) {
+	fw.batchProcessor.batchDelay = delay
+}
+
+// SetBatchMaxDelay sets the longest a change may wait to sync while its
+// source keeps changing, for rules without their own, zero for no limit
+func (fw *FileWatcher) SetBatchMaxDelay(delay time.Duration) {
+	fw.batchProcessor.maxDelay = delay
+}
+
+// SetShutdownTimeout sets how long Stop waits for pending changes to sync and
+// writes in progress to finish
+func (fw *FileWatcher) SetShutdownTimeout(timeout time.Duration) {
+	fw.shutdownTimeout = timeout
+}
+
+// SetTargetWorkers sets how many target files of a source change are written
+// at once; 1 writes them one after another
+func (fw *FileWatcher) SetTargetWorkers(workers int) {
+	fw.targetWorkers = workers
+}
+
+// SetEventQueue sizes the event queue and sets what happens to events sent
+// while it is full; nil uses the defaults. It must be called before Start.
+func (fw *FileWatcher) SetEventQueue(queue *models.EventQueue) {
+	fw.queue = queue
+	fw.eventChan = make(chan models.SyncEvent, queue.Capacity())
+	fw.spill = nil
+	if queue.Policy() == models.OverflowSpill {
+		fw.spill = newSpill(queue.SpillPath())
+	}
+}
+
+// SetRetryPolicy sets how failed source loads and target updates are
+// retried; nil uses the defaults
+func (fw *FileWatcher) SetRetryPolicy(policy *models.RetryPolicy) {
+	fw.retry = policy
+}
+
+// SetWatchMode sets how local source files are followed by rules without
+// their own watch mode. It must be called before SetRules.
+func (fw *FileWatcher) SetWatchMode(mode models.WatchMode) {
+	fw.watchMode = mode
+}
+
+// SetReconcileInterval sets how often every rule is checked against its
+// target, to catch changes whose watch events were lost. Zero disables it.
+func (fw *FileWatcher) SetReconcileInterval(interval time.Duration) {
+	fw.reconcileInterval = interval
+}
+
+// SetState sets the store of previously written values. Without one, target
+// keys are always overwritten.
+func (fw *FileWatcher) SetState(store *state.Store) {
+	fw.state = store
+}
+
+// SetConflictPolicy sets how target keys edited since the last sync are handled
+func (fw *FileWatcher) SetConflictPolicy(policy models.ConflictPolicy) {
+	fw.conflictPolicy = policy
+}
+
+// SetDrift sets whether target files are watched for synced keys edited
+// outside var-sync. It must be called before SetRules, and drift is only
+// detected with a state store.
+func (fw *FileWatcher) SetDrift(cfg *models.DriftConfig) {
+	fw.drift = cfg
+}
+
+// SetStrictRules sets whether SetRules fails for enabled rules that write the
+// same target key from different sources, where otherwise the last rule to
+// sync would win. It must be called before SetRules.
+func (fw *FileWatcher) SetStrictRules(strict bool) {
+	fw.strictRules = strict
+}
+
+// OnEvent registers a function called synchronously with every sync event,
+// before it is delivered on the Events channel
+func (fw *FileWatcher) OnEvent(listener func(models.SyncEvent)) {
+	fw.listenersMutex.Lock()
+	defer fw.listenersMutex.Unlock()
+	fw.listeners = append(fw.listeners, listener)
+}
+
+// SetRules sets the rules to sync and starts following their sources. Rules
+// that write the same target key from different sources are logged, or
+// refused in strict mode.
 func (fw *FileWatcher) SetRules(rules []models.SyncRule) error {
 	fw.eventsMutex.Lock()
 	defer fw.eventsMutex.Unlock()
 
-	fw.rules = rules
+	// Glob rules become a rule per matching file, and keys named in backend
+	// references become ordinary key paths
+	expanded := models.ExpandRules(rules)
+	resolved := make([]models.SyncRule, len(expanded))
+	for i, rule := range expanded {
+		resolved[i] = fw.backends.ResolveRule(rule)
+	}
+
+	if conflicts := ruleConflicts(resolved); len(conflicts) > 0 {
+		if fw.strictRules {
+			return fmt.Errorf("%d conflicting rules: %s", len(conflicts), strings.Join(conflicts, "; "))
+		}
+		for _, conflict := range conflicts {
+			fw.logger.Warn("Conflicting rules: %s; the last to sync wins", conflict)
+		}
+	}
+	if cycles := RuleCycles(resolved); len(cycles) > 0 {
+		return fmt.Errorf("%d rule cycles, each rule syncing into the next: %s", len(cycles), strings.Join(cycles, "; "))
+	}
+
+	fw.configured = rules
+	fw.rules = resolved
 
 	watchedDirs := make(map[string]bool)
-	for _, rule := range rules {
+	sources := make(map[string]bool)
+	fw.linksMutex.Lock()
+	fw.links = make(map[string]string)
+	fw.linksMutex.Unlock()
+	for _, rule := range fw.rules {
 		if !rule.Enabled {
 			continue
 		}
-
-		dir := filepath.Dir(rule.SourceFile)
-		if !watchedDirs[dir] {
-			if err := fw.watcher.Add(dir); err != nil {
-				fw.logger.Error("Failed to watch directory: %s, error: %v", dir, err)
-				continue
-			}
-			watchedDirs[dir] = true
-			fw.logger.Info("Watching directory: %s for file: %s", dir, rule.SourceFile)
+		sources[locationKey(rule.SourceFile)] = true
+		if fw.driftEnabled() && !backend.IsRef(rule.TargetFile) {
+			fw.watchDir(watchedDirs, rule.TargetFile)
 		}
+		if backend.IsRef(rule.SourceFile) || rule.Polled(fw.watchMode) {
+			continue
+		}
+		fw.watchDir(watchedDirs, rule.SourceFile)
+		fw.followLink(watchedDirs, rule.SourceFile)
 	}
+	fw.watchedFiles = len(sources)
+	fw.setSchedules()
 
 	return nil
 }
 
+// ruleConflicts describes every pair of enabled rules that write the same
+// target key from a different source key or file
+func ruleConflicts(rules []models.SyncRule) []string {
+	type targetKey struct{ file, key string }
+	writers := make(map[targetKey]models.SyncRule)
+
+	var conflicts []string
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		if _, ok := parser.AppendPath(rule.TargetKey); ok {
+			continue // Rules appending to a list each add their own element
+		}
+		target := targetKey{locationKey(rule.TargetFile), rule.TargetKey}
+		other, exists := writers[target]
+		if !exists {
+			writers[target] = rule
+			continue
+		}
+		if other.ID != rule.ID && (locationKey(other.SourceFile) != locationKey(rule.SourceFile) || other.SourceKey != rule.SourceKey || other.SourceExpr != rule.SourceExpr || other.Template != rule.Template) {
+			conflicts = append(conflicts, fmt.Sprintf("rules %s and %s both write %s:%s", other.ID, rule.ID, rule.TargetFile, rule.TargetKey))
+		}
+	}
+	return conflicts
+}
+
+// watchDir adds the directory of file to fsnotify unless it is already in
+// watchedDirs
+func (fw *FileWatcher) watchDir(watchedDirs map[string]bool, file string) {
+	dir := filepath.Dir(file)
+	if watchedDirs[dir] {
+		return
+	}
+	if err := fw.watcher.Add(watchPath(dir)); err != nil {
+		fw.logger.Error("Failed to watch directory: %s, error: %v", dir, err)
+		fw.setError(dir, err)
+		return
+	}
+	fw.clearError(dir)
+	watchedDirs[dir] = true
+	fw.logger.Info("Watching directory: %s for file: %s", dir, file)
+}
+
 func (fw *FileWatcher) Start() error {
 	go fw.handleEvents()
 	go fw.processEvents()
 	go fw.processBatches()
+	go fw.pollBackends()
+	go fw.pollFiles()
+	go fw.releaseQueued()
+	if fw.reconcileInterval > 0 {
+		go fw.reconcileLoop()
+	}
+	fw.running.Store(true)
 
 	fw.logger.Info("Safe file watcher started")
 	return nil
 }
 
+// Stop stops following sources. Changes still waiting out their batch delay
+// are synced first and writes in progress finish, so no target file is left
+// half written or a change behind, unless that takes longer than the
+// shutdown timeout.
 func (fw *FileWatcher) Stop() error {
+	fw.running.Store(false)
 	close(fw.stopChan)
+
+	drained := make(chan struct{})
+	go func() {
+		fw.drainBatches()
+		fw.writing.Lock()
+		fw.writing.Unlock()
+		close(drained)
+	}()
+	select {
+	case <-drained:
+	case <-time.After(fw.shutdownTimeout):
+		fw.logger.Warn("Stopping with changes still syncing after waiting %v", fw.shutdownTimeout)
+	}
+	fw.cancel()
+
 	// Don't close eventChan as goroutines may still be writing to it
-	// The consumer should drain the channel after stopping
-	close(fw.batchProcessor.processChan)
+	// The consumer should drain the channel after stopping. processChan stays
+	// open too, as batch timers may still fire; they give up once stopped.
 	return fw.watcher.Close()
 }
 
@@ -156,6 +546,7 @@ func (fw *FileWatcher) handleEvents() {
 		select {
 		case event, ok := <-fw.watcher.Events:
 			if !ok {
+				fw.running.Store(false)
 				return
 			}
 
@@ -163,14 +554,30 @@ func (fw *FileWatcher) handleEvents() {
 			if event.Op&fsnotify.Write == fsnotify.Write || 
 			   event.Op&fsnotify.Create == fsnotify.Create || 
 			   event.Op&fsnotify.Rename == fsnotify.Rename {
-				fw.handleFileChange(event.Name)
+				name := eventPath(event.Name)
+				fw.handleFileChange(name)
+				for _, link := range fw.linkedSources(name) {
+					fw.handleFileChange(link)
+				}
 			}
 
+		case name := <-fw.deferredEvents:
+			fw.handleFileChange(name)
+
 		case err, ok := <-fw.watcher.Errors:
 			if !ok {
+				fw.running.Store(false)
 				return
 			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				// Changes were lost, as happens on Windows when many files
+				// change at once, so every rule is checked against its source
+				fw.logger.Warn("File watcher dropped events, reconciling every rule")
+				go fw.Reconcile()
+				continue
+			}
 			fw.logger.Error("File watcher error: %v", err)
+			fw.setError("fsnotify", err)
 
 		case <-fw.stopChan:
 			return
@@ -182,24 +589,36 @@ func (fw *FileWatcher) handleFileChange(filename string) {
 	fw.eventsMutex.RLock()
 	defer fw.eventsMutex.RUnlock()
 
-	now := time.Now()
-	if lastEvent, exists := fw.lastEvents[filename]; exists {
-		if now.Sub(lastEvent) < fw.debounce {
-			return
-		}
-	}
-	fw.lastEvents[filename] = now
-
 	absPath, err := filepath.Abs(filename)
 	if err != nil {
 		fw.logger.Error("Failed to get absolute path for %s: %v", filename, err)
 		return
 	}
 
+	// Changes var-sync made itself are not handled as edits
+	if own, writing := fw.selfWritten(absPath); own {
+		if writing != nil {
+			go func() {
+				select {
+				case <-writing:
+				case <-fw.stopChan:
+					return
+				}
+				select {
+				case fw.deferredEvents <- filename:
+				case <-fw.stopChan:
+				}
+			}()
+			return
+		}
+		fw.logger.Debug("Ignoring event for %s: it holds what var-sync wrote", filename)
+		return
+	}
+
 	// Find all rules that match this source file
 	matchingRules := make([]models.SyncRule, 0)
 	for _, rule := range fw.rules {
-		if !rule.Enabled {
+		if !rule.Enabled || rule.Polled(fw.watchMode) {
 			continue
 		}
 
@@ -208,15 +627,181 @@ func (fw *FileWatcher) handleFileChange(filename string) {
 			continue
 		}
 
-		if ruleAbsPath == absPath {
+		if samePath(ruleAbsPath, absPath) {
 			matchingRules = append(matchingRules, rule)
 		}
 	}
 
+	now := time.Now()
+	if lastEvent, exists := fw.lastEvents[filename]; exists {
+		if now.Sub(lastEvent) < fw.debounceFor(matchingRules) {
+			fw.debounceDrops.Add(1)
+			return
+		}
+	}
+	fw.lastEvents[filename] = now
+
 	if len(matchingRules) > 0 {
 		fw.logger.Debug("Found %d matching rules for file %s", len(matchingRules), filename)
 		fw.batchRules(absPath, matchingRules)
+	} else if fw.matchesGlob(absPath) {
+		// A new file for a glob rule; SetRules needs the lock held here
+		go fw.refreshGlobs()
+	}
+
+	if fw.driftEnabled() {
+		targetRules := make([]models.SyncRule, 0)
+		for _, rule := range fw.rules {
+			if rule.Enabled && !backend.IsRef(rule.TargetFile) && samePath(locationKey(rule.TargetFile), absPath) {
+				targetRules = append(targetRules, rule)
+			}
+		}
+		if len(targetRules) > 0 {
+			// Wait like a batch does, for editors that write in several steps
+			time.AfterFunc(fw.batchDelayFor(targetRules), func() {
+				if rules := fw.unpaused(targetRules); len(rules) > 0 {
+					fw.checkDrift(absPath, rules)
+				}
+			})
+		}
+	}
+}
+
+// driftEnabled reports whether target files are watched for drift
+func (fw *FileWatcher) driftEnabled() bool {
+	return fw.drift != nil && fw.drift.Enabled && fw.state != nil
+}
+
+// checkDrift compares the keys rules write in targetFile with the values
+// var-sync last wrote there, and sends a drift event for every key that was
+// changed since. With reapply enabled the written values are restored.
+func (fw *FileWatcher) checkDrift(targetFile string, rules []models.SyncRule) {
+	select {
+	case <-fw.stopChan:
+		return
+	default:
+	}
+
+	// Wait for any sync writing this target to finish recording its state
+	targetMutex := fw.getTargetFileMutex(targetFile)
+	targetMutex.Lock()
+	defer targetMutex.Unlock()
+
+	targetData, err := fw.backends.LoadContext(fw.ctx, targetFile)
+	if err != nil {
+		fw.logger.Debug("Failed to load target file %s to check for drift: %v", targetFile, err)
+		return
+	}
+	if fw.unchangedSinceSync(targetFile, targetData, rules) {
+		return
+	}
+
+	reapply := make(map[string]any)
+	var create []string // Drifted keys removed by hand that rules may add back
+	events := make([]models.SyncEvent, 0)
+	changeID := uuid.NewString()
+	for _, rule := range rules {
+		if rule.IsTemplate() {
+			continue // Rendered targets are not tracked by key
+		}
+		for _, targetKey := range fw.targetKeys(rule) {
+			written, ok := fw.state.LastWritten(targetFile, targetKey)
+			if !ok {
+				continue
+			}
+			if fw.parser.Holds(targetData, targetKey, written) {
+				continue
+			}
+			current, _ := fw.parser.GetValue(targetData, targetKey)
+
+			fw.logger.Rule(rule.ID).Warn("Target key %s in %s was changed outside var-sync", targetKey, targetFile)
+			event := models.SyncEvent{
+				ChangeID:   changeID,
+				RuleID:     rule.ID,
+				TargetFile: rule.TargetFile,
+				TargetKey:  targetKey,
+				Timestamp:  time.Now(),
+				OldValue:   written,
+				NewValue:   current,
+				Success:    false,
+				Error:      "Drift: target key was changed outside var-sync",
+				Drift:      true,
+				Sensitive:  rule.IsSensitive(),
+			}
+			if fw.drift.Reapply {
+				reapply[targetKey] = written
+				if rule.CreateMissing {
+					create = append(create, targetKey)
+				}
+				event.OldValue, event.NewValue = current, written
+				event.Success, event.Error = true, ""
+			}
+			events = append(events, event)
+		}
+	}
+
+	if len(reapply) > 0 {
+		err := fw.backupBeforeReapply(targetFile, rules)
+		if err == nil {
+			err = fw.updateWithRetry(targetFile, reapply, create...)
+		}
+		if err != nil {
+			fw.logger.Error("Failed to reapply %d drifted keys to %s: %v", len(reapply), targetFile, err)
+			for i := range events {
+				events[i].Success = false
+				events[i].Error = fmt.Sprintf("Failed to reapply drifted key: %v", err)
+			}
+		} else {
+			fw.logger.Info("Reapplied %d drifted keys to target file %s", len(reapply), targetFile)
+		}
+	}
+
+	for _, event := range events {
+		fw.sendEvent(event)
+	}
+}
+
+// unchangedSinceSync reports whether the target still has the checksum it had
+// after each of rules last synced it, so none of its keys can have drifted
+func (fw *FileWatcher) unchangedSinceSync(targetFile string, targetData map[string]any, rules []models.SyncRule) bool {
+	checksum := state.Checksum(targetData)
+	for _, rule := range rules {
+		applied, ok := fw.state.LastApplied(rule.ID, targetFile)
+		if !ok || applied.TargetHash != checksum {
+			return false
+		}
+	}
+	return len(rules) > 0
+}
+
+// backupBeforeReapply backs up a target before drifted keys are restored, if
+// any of its rules want backups
+func (fw *FileWatcher) backupBeforeReapply(targetFile string, rules []models.SyncRule) error {
+	if !fw.backupEnabled(rules) {
+		return nil
+	}
+	if _, err := fw.backups.Backup(targetFile); err != nil {
+		return fmt.Errorf("failed to back up target file: %w", err)
+	}
+	return nil
+}
+
+// targetKeys returns the keys rule writes: its target key, or for a wildcard
+// rule every key its source currently resolves to
+func (fw *FileWatcher) targetKeys(rule models.SyncRule) []string {
+	sourceData, err := fw.backends.LoadContext(fw.ctx, rule.SourceFile)
+	if err != nil {
+		return []string{rule.TargetKey}
 	}
+	updates, err := fw.parser.ResolveRule(sourceData, rule)
+	if err != nil {
+		return []string{rule.TargetKey}
+	}
+	keys := make([]string, 0, len(updates))
+	for targetKey := range updates {
+		keys = append(keys, targetKey)
+	}
+	return keys
 }
 
 // batchRules groups rules by source file for batch processing
@@ -229,27 +814,115 @@ func (fw *FileWatcher) batchRules(sourceFile string, rules []models.SyncRule) {
 		batch = &RuleBatch{
 			sourceFile: sourceFile,
 			rules:      make([]models.SyncRule, 0),
+			started:    time.Now(),
 		}
 		fw.batchProcessor.batches[sourceFile] = batch
 	}
 
-	// Update rules in batch
+	// Update rules in batch, keeping any waiting rules not among them
 	batch.mutex.Lock()
+	incoming := make(map[string]bool)
+	for _, rule := range rules {
+		incoming[rule.ID] = true
+	}
+	waiting := batch.rules
 	batch.rules = rules
+	for _, rule := range waiting {
+		if !incoming[rule.ID] {
+			batch.rules = append(batch.rules, rule)
+		}
+	}
 	
 	// Reset or create timer
 	if batch.timer != nil {
 		batch.timer.Stop()
 	}
 	
-	batch.timer = time.AfterFunc(fw.batchProcessor.batchDelay, func() {
-		fw.batchProcessor.processChan <- sourceFile
+	// Each change restarts the batch delay, up to the max delay after the
+	// first change
+	delay := fw.batchDelayFor(batch.rules)
+	if maxDelay := fw.batchMaxDelayFor(batch.rules); maxDelay > 0 {
+		delay = max(min(delay, time.Until(batch.started.Add(maxDelay))), 0)
+	}
+	batch.timer = time.AfterFunc(delay, func() {
+		select {
+		case fw.batchProcessor.processChan <- sourceFile:
+		case <-fw.stopChan:
+		}
 	})
 	batch.mutex.Unlock()
 
 	fw.logger.Debug("Batched %d rules for source file %s", len(rules), sourceFile)
 }
 
+// debounceFor returns how long after a change to a file further changes are
+// ignored: the longest debounce of its rules, or the global one
+func (fw *FileWatcher) debounceFor(rules []models.SyncRule) time.Duration {
+	if len(rules) == 0 {
+		return fw.debounce
+	}
+	var debounce time.Duration
+	for _, rule := range rules {
+		debounce = max(debounce, rule.Debounce.Or(fw.debounce))
+	}
+	return debounce
+}
+
+// batchDelayFor returns how long a source must be left alone before its
+// batched rules are processed: the longest batch delay of the rules, or the
+// global one
+func (fw *FileWatcher) batchDelayFor(rules []models.SyncRule) time.Duration {
+	if len(rules) == 0 {
+		return fw.batchProcessor.batchDelay
+	}
+	var delay time.Duration
+	for _, rule := range rules {
+		delay = max(delay, rule.BatchDelay.Or(fw.batchProcessor.batchDelay))
+	}
+	return delay
+}
+
+// batchMaxDelayFor returns the longest the batched rules may wait while their
+// source keeps changing: the shortest max delay of the rules, or the global
+// one, and zero if none is set
+func (fw *FileWatcher) batchMaxDelayFor(rules []models.SyncRule) time.Duration {
+	if len(rules) == 0 {
+		return fw.batchProcessor.maxDelay
+	}
+	var delay time.Duration
+	for _, rule := range rules {
+		if ruleDelay := rule.BatchMaxDelay.Or(fw.batchProcessor.maxDelay); ruleDelay > 0 && (delay == 0 || ruleDelay < delay) {
+			delay = ruleDelay
+		}
+	}
+	return delay
+}
+
+// drainBatches processes every batch whose timer has not fired yet, along
+// with the rules held back by their minimum interval
+func (fw *FileWatcher) drainBatches() {
+	fw.releaseAllLimited()
+
+	fw.batchProcessor.batchMutex.Lock()
+	sources := make([]string, 0, len(fw.batchProcessor.batches))
+	for sourceFile, batch := range fw.batchProcessor.batches {
+		batch.mutex.Lock()
+		if batch.timer != nil {
+			batch.timer.Stop()
+		}
+		batch.mutex.Unlock()
+		sources = append(sources, sourceFile)
+	}
+	fw.batchProcessor.batchMutex.Unlock()
+
+	if len(sources) > 0 {
+		fw.logger.Info("Syncing changes to %d sources before stopping", len(sources))
+	}
+	for _, sourceFile := range sources {
+		fw.processBatch(sourceFile)
+	}
+}
+
 // processBatches handles batched rule processing
 func (fw *FileWatcher) processBatches() {
 	fw.logger.Debug("Starting batch processor goroutine")
@@ -279,41 +952,136 @@ func (fw *FileWatcher) processBatch(sourceFile string) {
 	copy(rules, batch.rules)
 	batch.mutex.Unlock()
 
+	rules = fw.rateLimited(fw.inSchedule(fw.unpaused(rules)))
+	if len(rules) == 0 {
+		return
+	}
+
 	fw.logger.Debug("Processing batch of %d rules for source file %s", len(rules), sourceFile)
+	changeID := uuid.NewString()
 
 	// Load source file once
-	sourceData, err := fw.loadSourceFileWithRetry(sourceFile)
+	sourceData, partial, err := fw.loadSourceFileWithRetry(sourceFile, rules)
 	if err != nil {
 		fw.logger.Error("Failed to load source file %s: %v", sourceFile, err)
 		for _, rule := range rules {
 			fw.sendEvent(models.SyncEvent{
-				RuleID:    rule.ID,
-				Timestamp: time.Now(),
-				Success:   false,
-				Error:     fmt.Sprintf("Failed to load source file: %v", err),
+				ChangeID:   changeID,
+				RuleID:     rule.ID,
+				TargetFile: rule.TargetFile,
+				TargetKey:  rule.TargetKey,
+				Timestamp:  time.Now(),
+				Success:    false,
+				Error:      fmt.Sprintf("Failed to load source file: %v", err),
 			})
 		}
 		return
 	}
 
-	// Group rules by target file for synchronized writing
+	rules = fw.applicable(changeID, sourceData, rules)
+
+	// A source read in part has no checksum to compare the whole file with
+	var sourceHash string
+	if fw.state != nil && !partial {
+		sourceHash = state.Checksum(sourceData)
+	}
+
+	// Group rules by target file for synchronized writing. Template rules
+	// write their whole target, so they are rendered on their own.
+	var jobs []func() []models.SyncEvent
 	targetGroups := make(map[string][]models.SyncRule)
 	for _, rule := range rules {
-		absTargetPath, err := filepath.Abs(rule.TargetFile)
-		if err != nil {
-			absTargetPath = rule.TargetFile
+		if rule.IsTemplate() {
+			jobs = append(jobs, func() []models.SyncEvent {
+				return []models.SyncEvent{fw.renderTemplate(changeID, sourceData, rule)}
+			})
+			continue
+		}
+		targetPath := locationKey(rule.TargetFile)
+		targetGroups[targetPath] = append(targetGroups[targetPath], rule)
+	}
+
+	// Process each target file group in a fixed order, so that their events
+	// are too
+	targetFiles := make([]string, 0, len(targetGroups))
+	for targetFile := range targetGroups {
+		targetFiles = append(targetFiles, targetFile)
+	}
+	sort.Strings(targetFiles)
+	for _, targetFile := range targetFiles {
+		jobs = append(jobs, func() []models.SyncEvent {
+			return fw.processTargetGroup(changeID, sourceData, sourceHash, targetFile, targetGroups[targetFile])
+		})
+	}
+	fw.runTargetJobs(jobs)
+}
+
+// runTargetJobs runs jobs that each write their own target file, up to
+// targetWorkers at once, and sends their events in the order of the jobs as
+// they finish
+func (fw *FileWatcher) runTargetJobs(jobs []func() []models.SyncEvent) {
+	if len(jobs) == 1 {
+		for _, event := range jobs[0]() {
+			fw.sendEvent(event)
+		}
+		return
+	}
+
+	results := make([]chan []models.SyncEvent, len(jobs))
+	for i := range results {
+		results[i] = make(chan []models.SyncEvent, 1)
+	}
+	go func() {
+		workers := make(chan struct{}, max(fw.targetWorkers, 1))
+		for i, job := range jobs {
+			workers <- struct{}{}
+			go func() {
+				defer func() { <-workers }()
+				results[i] <- job()
+			}()
+		}
+	}()
+	for _, result := range results {
+		for _, event := range <-result {
+			fw.sendEvent(event)
 		}
-		targetGroups[absTargetPath] = append(targetGroups[absTargetPath], rule)
 	}
+}
 
-	// Process each target file group with proper synchronization
-	for targetFile, targetRules := range targetGroups {
-		fw.processTargetGroup(sourceData, targetFile, targetRules)
+// applicable returns the rules whose when condition holds for sourceData. A
+// rule whose condition cannot be evaluated fails with an event.
+func (fw *FileWatcher) applicable(changeID string, sourceData map[string]any, rules []models.SyncRule) []models.SyncRule {
+	result := make([]models.SyncRule, 0, len(rules))
+	for _, rule := range rules {
+		applies, err := fw.parser.RuleApplies(sourceData, rule)
+		if err != nil {
+			fw.sendEvent(models.SyncEvent{
+				ChangeID:   changeID,
+				RuleID:     rule.ID,
+				TargetFile: rule.TargetFile,
+				TargetKey:  rule.TargetKey,
+				Timestamp:  time.Now(),
+				Success:    false,
+				Error:      fmt.Sprintf("Failed to check when condition: %v", err),
+			})
+			continue
+		}
+		if !applies {
+			fw.logger.Rule(rule.ID).Debug("Rule %s not synced: its when condition %s does not hold", rule.ID, rule.When)
+			continue
+		}
+		result = append(result, rule)
 	}
+	return result
 }
 
 // processTargetGroup processes all rules that write to the same target file
-func (fw *FileWatcher) processTargetGroup(sourceData map[string]any, targetFile string, rules []models.SyncRule) {
+// for the source change changeID, returning their events to send. sourceHash
+// is the checksum of the source recorded with the synced values, if any.
+func (fw *FileWatcher) processTargetGroup(changeID string, sourceData map[string]any, sourceHash string, targetFile string, rules []models.SyncRule) []models.SyncEvent {
+	fw.writing.RLock()
+	defer fw.writing.RUnlock()
+
 	// Get mutex for this target file to ensure atomic operations
 	targetMutex := fw.getTargetFileMutex(targetFile)
 	targetMutex.Lock()
@@ -323,47 +1091,322 @@ func (fw *FileWatcher) processTargetGroup(sourceData map[string]any, targetFile
 
 	// Collect all updates for batch surgical processing
 	updates := make(map[string]any)
+	var create []string // Target keys that rules may add to the target
 	allSuccessful := true
 	events := make([]models.SyncEvent, 0, len(rules))
 
+	// Current target content, used to detect keys edited by hand
+	targetData, _ := fw.backends.LoadContext(fw.ctx, targetFile)
+
+	// Updates of the rules that resolved, with the index of their event, and
+	// the rules with a mapping held back
+	type resolvedRule struct {
+		rule    models.SyncRule
+		updates map[string]any
+		event   int
+	}
+	var resolved []resolvedRule
+	heldBack := make(map[string]bool)
+
 	for _, rule := range rules {
-		event := fw.processRuleForBatch(sourceData, rule, updates)
-		events = append(events, event)
-		if !event.Success {
-			allSuccessful = false
+		ruleUpdates := make(map[string]any)
+		event := fw.processRuleForBatch(sourceData, rule, ruleUpdates)
+		event.ChangeID = changeID
+		event.Sensitive = rule.IsSensitive()
+
+		if event.Success && !rule.CreateMissing {
+			if missing := fw.missingKey(targetFile, targetData, ruleUpdates); missing != "" {
+				event.Success = false
+				event.Error = fmt.Sprintf("Target key %s does not exist; set create_missing on the rule to add it", missing)
+				events = append(events, event)
+				heldBack[rule.ID] = true
+				continue
+			}
 		}
-	}
 
-	// Apply all changes surgically to preserve formatting
-	if allSuccessful && len(updates) > 0 {
-		if err := fw.parser.UpdateFileValues(targetFile, updates); err != nil {
-			fw.logger.Error("Failed to update target file %s: %v", targetFile, err)
+		if event.Success && fw.conflicted(targetFile, targetData, ruleUpdates) {
+			event.Conflict = true
+			switch fw.conflictPolicyFor(rule) {
+			case models.ConflictSkip:
+				event.Success = false
+				event.Error = "Skipped: target key was modified since the last sync"
+			case models.ConflictPrompt:
+				event.Success = false
+				event.Error = "Conflict: target key was modified since the last sync, resolve it in the TUI"
+			default:
+				fw.logger.Rule(rule.ID).Warn("Target key %s in %s was modified since the last sync, overwriting", rule.TargetKey, targetFile)
+			}
+			if !event.Success {
+				// A held back conflict does not stop the other rules for this target
+				events = append(events, event)
+				heldBack[rule.ID] = true
+				continue
+			}
+		}
+
+		events = append(events, event)
+		if !event.Success {
+			allSuccessful = false
+			continue
+		}
+		resolved = append(resolved, resolvedRule{rule, ruleUpdates, len(events) - 1})
+	}
+
+	// The mappings of a multi-key rule, which share its ID, sync together or
+	// not at all
+	for _, r := range resolved {
+		if heldBack[r.rule.ID] {
+			events[r.event].Success = false
+			events[r.event].Error = "Held back: another mapping of the rule was held back"
+			continue
+		}
+		fw.replaceListValues(targetFile, r.rule, r.updates)
+		for targetKey, value := range r.updates {
+			updates[targetKey] = value
+			if r.rule.CreateMissing {
+				create = append(create, targetKey)
+			}
+		}
+	}
+
+	// Values the target already holds are not written again, so that a sync
+	// changing nothing leaves the target alone
+	changed := make(map[string]any, len(updates))
+	for targetKey, value := range updates {
+		if targetData != nil && fw.parser.Holds(targetData, targetKey, value) {
+			continue
+		}
+		changed[targetKey] = value
+	}
+
+	// Back up the target before it is modified
+	if allSuccessful && len(changed) > 0 && !backend.IsRef(targetFile) && fw.backupEnabled(rules) {
+		if backupPath, err := fw.backups.Backup(targetFile); err != nil {
+			fw.logger.Error("Failed to back up target file %s: %v", targetFile, err)
+			allSuccessful = false
+			for i := range events {
+				if events[i].Conflict && !events[i].Success {
+					continue
+				}
+				events[i].Success = false
+				events[i].Error = fmt.Sprintf("Failed to back up target file: %v", err)
+			}
+		} else if backupPath != "" {
+			fw.logger.Debug("Backed up target file %s to %s", targetFile, backupPath)
+		}
+	}
+
+	// Apply all changes surgically to preserve formatting
+	if allSuccessful && len(changed) > 0 {
+		// Keep the content before the sync to roll back to if the written
+		// target does not check out; nil if the sync creates the target
+		var original []byte
+		if !backend.IsRef(targetFile) {
+			original, _ = os.ReadFile(targetFile)
+		}
+
+		if err := fw.updateWithRetry(targetFile, changed, create...); err != nil {
+			fw.logger.Error("Failed to update target file %s: %v", targetFile, err)
 			// Mark all events as failed
 			for i := range events {
+				if events[i].Conflict && !events[i].Success {
+					continue
+				}
 				events[i].Success = false
 				events[i].Error = fmt.Sprintf("Failed to update target file: %v", err)
 			}
+		} else if err := fw.checkTarget(targetFile, changed, original); err != nil {
+			fw.logger.Error("Target file %s %v", targetFile, err)
+			for i := range events {
+				if events[i].Conflict && !events[i].Success {
+					continue
+				}
+				events[i].Success = false
+				events[i].Error = fmt.Sprintf("Target file %v", err)
+			}
+		} else {
+			fw.logger.Info("Successfully applied %d surgical updates to target file %s", len(changed), targetFile)
+			fw.recordState(targetFile, sourceHash, nil, updates, events)
+		}
+	} else if allSuccessful && len(updates) > 0 {
+		fw.logger.Debug("Target file %s already holds all %d values, not writing it", targetFile, len(updates))
+		fw.recordState(targetFile, sourceHash, targetData, updates, events)
+	}
+	return events
+}
+
+// checkTarget reads targetFile back after updates were written to it and
+// checks that it holds every value written, catching an update that went to
+// the wrong line, and that it matches the schema set for it, if any. When a
+// check fails, original is written back over the target, or the target is
+// removed if original is nil, and the error says why. Backends are not
+// checked.
+func (fw *FileWatcher) checkTarget(targetFile string, updates map[string]any, original []byte) error {
+	if backend.IsRef(targetFile) {
+		return nil
+	}
+
+	// A rendered template need not be in a format the parser reads, so it is
+	// only loaded to check it against a schema
+	schemaPath, hasSchema := fw.schemas[targetFile]
+	var document map[string]any
+	var err error
+	if len(updates) > 0 || hasSchema {
+		document, err = fw.parser.LoadFile(targetFile)
+	}
+	if err == nil {
+		keys := make([]string, 0, len(updates))
+		for targetKey := range updates {
+			keys = append(keys, targetKey)
+		}
+		sort.Strings(keys)
+		for _, targetKey := range keys {
+			if !fw.parser.Holds(document, targetKey, updates[targetKey]) {
+				err = fmt.Errorf("key %s does not hold the value written to it", targetKey)
+				break
+			}
+		}
+	}
+	if hasSchema && err == nil {
+		var s *schema.Schema
+		if s, err = schema.Load(schemaPath); err == nil {
+			if err = s.Validate(document); err != nil {
+				err = fmt.Errorf("does not match schema %s: %w", schemaPath, err)
+			}
+		}
+	}
+	if err == nil {
+		return nil
+	}
+
+	rollback := func() error { return textfile.Replace(targetFile, original) }
+	if original == nil {
+		rollback = func() error { return os.Remove(targetFile) }
+	}
+	if writeErr := fw.writeTarget(targetFile, rollback); writeErr != nil {
+		return fmt.Errorf("failed verification (%v) and could not be rolled back: %w", err, writeErr)
+	}
+	return fmt.Errorf("failed verification and was rolled back: %w", err)
+}
+
+// recordState records the values just synced to targetFile, and what each
+// rule that synced applied to it. targetData is the target's content after
+// the sync, or nil to load it.
+func (fw *FileWatcher) recordState(targetFile, sourceHash string, targetData map[string]any, updates map[string]any, events []models.SyncEvent) {
+	if fw.state == nil {
+		return
+	}
+	written := make(map[string]any, len(updates))
+	var deleted []string
+	for targetKey, value := range updates {
+		if value == parser.Deleted {
+			deleted = append(deleted, targetKey)
 		} else {
-			fw.logger.Info("Successfully applied %d surgical updates to target file %s", len(updates), targetFile)
+			written[targetKey] = value
 		}
 	}
+	if err := fw.state.Record(targetFile, written); err != nil {
+		fw.logger.Error("Failed to record sync state for %s: %v", targetFile, err)
+	}
+	if err := fw.state.Forget(targetFile, deleted); err != nil {
+		fw.logger.Error("Failed to record sync state for %s: %v", targetFile, err)
+	}
 
-	// Send all events
+	if targetData == nil {
+		var err error
+		if targetData, err = fw.backends.LoadContext(fw.ctx, targetFile); err != nil {
+			fw.logger.Debug("Failed to load target file %s to record its checksum: %v", targetFile, err)
+		}
+	}
+	var targetHash string
+	if targetData != nil {
+		targetHash = state.Checksum(targetData)
+	}
+
+	applied := make(map[string]state.Applied)
 	for _, event := range events {
-		fw.sendEvent(event)
+		if event.Success {
+			applied[event.RuleID] = state.Applied{
+				SourceHash: sourceHash,
+				TargetHash: targetHash,
+				Value:      event.NewValue,
+				At:         event.Timestamp,
+			}
+		}
+	}
+	if err := fw.state.RecordApplied(targetFile, applied); err != nil {
+		fw.logger.Error("Failed to record applied values for %s: %v", targetFile, err)
 	}
 }
 
+// conflicted reports whether any key about to be written was changed in the
+// target since var-sync last wrote it. Keys never written before and keys that
+// already hold the new value are not conflicts.
+func (fw *FileWatcher) conflicted(targetFile string, targetData map[string]any, updates map[string]any) bool {
+	if fw.state == nil || targetData == nil {
+		return false
+	}
+
+	for targetKey, value := range updates {
+		written, ok := fw.state.LastWritten(targetFile, targetKey)
+		if !ok {
+			continue
+		}
+		current, err := fw.parser.GetValue(targetData, targetKey)
+		if err != nil {
+			continue
+		}
+		if !fw.parser.ValuesEqual(current, written) && !fw.parser.ValuesEqual(current, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// conflictPolicyFor returns how a conflict on rule's target is handled: the
+// rule's own strategy if it has one, otherwise the global policy
+func (fw *FileWatcher) conflictPolicyFor(rule models.SyncRule) models.ConflictPolicy {
+	switch rule.OnConflict {
+	case models.SourceWins:
+		return models.ConflictOverwrite
+	case models.TargetWins:
+		return models.ConflictSkip
+	case models.Manual:
+		return models.ConflictPrompt
+	case models.NewestWins:
+		sourceInfo, sourceErr := os.Stat(rule.SourceFile)
+		targetInfo, targetErr := os.Stat(rule.TargetFile)
+		if sourceErr != nil || targetErr != nil || sourceInfo.ModTime().After(targetInfo.ModTime()) {
+			return models.ConflictOverwrite
+		}
+		return models.ConflictSkip
+	default:
+		return fw.conflictPolicy
+	}
+}
+
+// backupEnabled reports whether any of the rules writing a target wants a backup
+func (fw *FileWatcher) backupEnabled(rules []models.SyncRule) bool {
+	for _, rule := range rules {
+		if rule.BackupEnabled(fw.backupConfig) {
+			return true
+		}
+	}
+	return false
+}
+
 // processRuleInBatch processes a single rule within a batch (without file I/O)
 func (fw *FileWatcher) processRuleInBatch(sourceData, targetData map[string]any, rule models.SyncRule) models.SyncEvent {
 	// Get source value
 	newValue, err := fw.parser.GetValue(sourceData, rule.SourceKey)
 	if err != nil {
 		return models.SyncEvent{
-			RuleID:    rule.ID,
-			Timestamp: time.Now(),
-			Success:   false,
-			Error:     fmt.Sprintf("Failed to get source value: %v", err),
+			RuleID:     rule.ID,
+			TargetFile: rule.TargetFile,
+			TargetKey:  rule.TargetKey,
+			Timestamp:  time.Now(),
+			Success:    false,
+			Error:      fmt.Sprintf("Failed to get source value: %v", err),
 		}
 	}
 
@@ -373,71 +1416,191 @@ func (fw *FileWatcher) processRuleInBatch(sourceData, targetData map[string]any,
 	// Set new value
 	if err := fw.parser.SetValue(targetData, rule.TargetKey, newValue); err != nil {
 		return models.SyncEvent{
-			RuleID:    rule.ID,
-			Timestamp: time.Now(),
-			Success:   false,
-			Error:     fmt.Sprintf("Failed to set target value: %v", err),
+			RuleID:     rule.ID,
+			TargetFile: rule.TargetFile,
+			TargetKey:  rule.TargetKey,
+			Timestamp:  time.Now(),
+			Success:    false,
+			Error:      fmt.Sprintf("Failed to set target value: %v", err),
 		}
 	}
 
 	return models.SyncEvent{
-		RuleID:    rule.ID,
-		Timestamp: time.Now(),
-		OldValue:  oldValue,
-		NewValue:  newValue,
-		Success:   true,
+		RuleID:     rule.ID,
+		TargetFile: rule.TargetFile,
+		TargetKey:  rule.TargetKey,
+		Timestamp:  time.Now(),
+		OldValue:   oldValue,
+		NewValue:   newValue,
+		Success:    true,
 	}
 }
 
 // processRuleForBatch processes a single rule and collects updates for surgical batch processing
 func (fw *FileWatcher) processRuleForBatch(sourceData map[string]any, rule models.SyncRule, updates map[string]any) models.SyncEvent {
-	// Get source value
-	newValue, err := fw.parser.GetValue(sourceData, rule.SourceKey)
+	// Resolve the source value, expanding wildcard rules into one update per matched key
+	ruleUpdates, err := fw.parser.ResolveRule(sourceData, rule)
 	if err != nil {
 		return models.SyncEvent{
-			RuleID:    rule.ID,
-			Timestamp: time.Now(),
-			Success:   false,
-			Error:     fmt.Sprintf("Failed to get source value: %v", err),
+			RuleID:     rule.ID,
+			TargetFile: rule.TargetFile,
+			TargetKey:  rule.TargetKey,
+			Timestamp:  time.Now(),
+			Success:    false,
+			Error:      fmt.Sprintf("Failed to get source value: %v", err),
 		}
 	}
 
+	fw.logger.Rule(rule.ID).Debug("Rule %s resolved %d target keys from %s in %s", rule.ID, len(ruleUpdates), rule.SourceKey, rule.SourceFile)
+
 	// Get old value from the target file for the event
 	var oldValue any
-	if targetData, err := fw.parser.LoadFile(rule.TargetFile); err == nil {
+	if targetData, err := fw.backends.LoadContext(fw.ctx, rule.TargetFile); err == nil {
 		oldValue, _ = fw.parser.GetValue(targetData, rule.TargetKey)
 	}
 
 	// Add to updates map for surgical processing
-	updates[rule.TargetKey] = newValue
+	var newValue any = ruleUpdates
+	for targetKey, value := range ruleUpdates {
+		updates[targetKey] = value
+		if targetKey == rule.TargetKey {
+			newValue = value
+		}
+	}
+	deleted := newValue == parser.Deleted
+	if deleted {
+		newValue = nil
+	}
 
 	return models.SyncEvent{
-		RuleID:    rule.ID,
-		Timestamp: time.Now(),
-		OldValue:  oldValue,
-		NewValue:  newValue,
-		Success:   true,
+		RuleID:     rule.ID,
+		TargetFile: rule.TargetFile,
+		TargetKey:  rule.TargetKey,
+		Timestamp:  time.Now(),
+		OldValue:   oldValue,
+		NewValue:   newValue,
+		Success:    true,
+		Deleted:    deleted,
 	}
 }
 
-// loadSourceFileWithRetry loads source file with retry logic
-func (fw *FileWatcher) loadSourceFileWithRetry(sourceFile string) (map[string]any, error) {
-	var sourceData map[string]any
-	var err error
-	
-	for i := 0; i < 3; i++ {
-		sourceData, err = fw.parser.LoadFile(sourceFile)
-		if err == nil {
-			return sourceData, nil
+
+// loadSourceFileWithRetry loads source file with retry logic. When rules only
+// read plain source keys, a large source may be read for just those, which
+// partial reports.
+func (fw *FileWatcher) loadSourceFileWithRetry(sourceFile string, rules []models.SyncRule) (sourceData map[string]any, partial bool, err error) {
+	keyPaths := sourceKeys(rules)
+	err = fw.withRetry("Loading source "+sourceFile, func() error {
+		var err error
+		if keyPaths == nil {
+			sourceData, err = fw.backends.LoadContext(fw.ctx, sourceFile)
+		} else {
+			sourceData, partial, err = fw.backends.LoadKeys(fw.ctx, sourceFile, keyPaths)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return sourceData, partial, nil
+}
+
+// sourceKeys returns the source key paths rules read, or nil if any of them
+// needs more of the source, such as for a condition, expression or template
+func sourceKeys(rules []models.SyncRule) []string {
+	keyPaths := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		if rule.When != "" || rule.SourceExpr != "" || rule.IsTemplate() || !parser.CanExtract(rule.SourceKey) {
+			return nil
+		}
+		keyPaths = append(keyPaths, rule.SourceKey)
+	}
+	return keyPaths
+}
+
+// updateWithRetry applies updates to a target, adding the keys in create if
+// missing, retrying as the retry policy allows
+func (fw *FileWatcher) updateWithRetry(targetFile string, updates map[string]any, create ...string) error {
+	return fw.writeTarget(targetFile, func() error {
+		return fw.withRetry("Updating target "+targetFile, func() error {
+			return fw.backends.UpdateContext(fw.ctx, targetFile, updates, create...)
+		})
+	})
+}
+
+// replaceListValues adds to updates the removal of the element rule last
+// appended with [+], where the value appended now replaces it or the source
+// key it came from was removed, so that the rule keeps one element in the
+// list rather than every value its source has had
+func (fw *FileWatcher) replaceListValues(targetFile string, rule models.SyncRule, updates map[string]any) {
+	arrayPath, ok := parser.AppendPath(rule.TargetKey)
+	if fw.state == nil || !ok {
+		return
+	}
+	value, ok := updates[rule.TargetKey]
+	if !ok {
+		return
+	}
+	applied, ok := fw.state.LastApplied(rule.ID, targetFile)
+	if !ok || applied.Value == nil || fw.parser.ValuesEqual(applied.Value, value) {
+		return
+	}
+	if elementPath, ok := parser.ElementPath(arrayPath, applied.Value); ok {
+		updates[elementPath] = parser.Deleted
+	}
+}
+
+// missingKey returns a key of updates that the target file does not have, or
+// "" if it has them all. Backends and JSON files are not checked, as writing
+// to them adds any key.
+func (fw *FileWatcher) missingKey(targetFile string, targetData map[string]any, updates map[string]any) string {
+	if targetData == nil || backend.IsRef(targetFile) || parser.AddsMissingKeys(targetFile) {
+		return ""
+	}
+	keys := make([]string, 0, len(updates))
+	for targetKey := range updates {
+		keys = append(keys, targetKey)
+	}
+	sort.Strings(keys)
+	for _, targetKey := range keys {
+		if updates[targetKey] == parser.Deleted {
+			continue
+		}
+		// Appending needs the array, not the element
+		arrayPath, _ := parser.AppendPath(targetKey)
+		if _, err := fw.parser.GetValue(targetData, arrayPath); err != nil {
+			return targetKey
+		}
+	}
+	return ""
+}
+
+// withRetry runs fn until it succeeds or the retry policy runs out of
+// attempts, and returns the last error. Retrying stops early when the
+// watcher stops.
+func (fw *FileWatcher) withRetry(operation string, fn func() error) error {
+	attempts := fw.retry.Attempts()
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts {
+			return err
+		}
+
+		delay := fw.retry.Backoff(attempt)
+		fw.logger.Debug("%s failed on attempt %d of %d, retrying in %s: %v", operation, attempt, attempts, delay, err)
+		select {
+		case <-time.After(delay):
+		case <-fw.stopChan:
+			return err
+		case <-fw.ctx.Done():
+			return err
 		}
-		time.Sleep(50 * time.Millisecond)
 	}
-	
-	return nil, err
 }
 
 func (fw *FileWatcher) processEvents() {
 	fw.logger.Debug("Starting safe event processor goroutine")
+	fw.unspill()
 	for {
 		select {
 		case event, ok := <-fw.eventChan:
@@ -445,10 +1608,9 @@ func (fw *FileWatcher) processEvents() {
 				return
 			}
 			
-			if event.Success {
-				fw.logger.Info("Safe sync successful for rule %s: %v -> %v", event.RuleID, event.OldValue, event.NewValue)
-			} else {
-				fw.logger.Error("Safe sync failed for rule %s: %s", event.RuleID, event.Error)
+			fw.logEvent(event)
+			if len(fw.eventChan) == 0 {
+				fw.unspill()
 			}
 		case <-fw.stopChan:
 			return
@@ -456,10 +1618,607 @@ func (fw *FileWatcher) processEvents() {
 	}
 }
 
+// logEvent logs the outcome of a sync
+func (fw *FileWatcher) logEvent(event models.SyncEvent) {
+	event = event.Redacted()
+	if event.Success {
+		fw.logger.Rule(event.RuleID).Info("Safe sync successful for rule %s: %v -> %v", event.RuleID, event.OldValue, event.NewValue)
+	} else {
+		fw.logger.Rule(event.RuleID).Error("Safe sync failed for rule %s: %s", event.RuleID, event.Error)
+	}
+}
+
+// unspill processes the events waiting in the spill file, including any left
+// by an earlier run, once the queue has caught up
+func (fw *FileWatcher) unspill() {
+	if fw.spill == nil {
+		return
+	}
+	events, err := fw.spill.Take()
+	if err != nil {
+		fw.logger.Error("Failed to read spilled events: %v", err)
+		return
+	}
+	for _, event := range events {
+		fw.logEvent(event)
+	}
+}
+
+// SetLastSequence continues numbering events after sequence, the number of
+// the last event of an earlier run
+func (fw *FileWatcher) SetLastSequence(sequence uint64) {
+	fw.sendMutex.Lock()
+	defer fw.sendMutex.Unlock()
+	fw.sequence = sequence
+}
+
+// sendEvent numbers an event and delivers it to the listeners and the event
+// channel
 func (fw *FileWatcher) sendEvent(event models.SyncEvent) {
-	select {
-	case fw.eventChan <- event:
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+
+	fw.sendMutex.Lock()
+	defer fw.sendMutex.Unlock()
+	fw.sequence++
+	event.Sequence = fw.sequence
+
+	fw.listenersMutex.RLock()
+	for _, listener := range fw.listeners {
+		listener(event)
+	}
+	fw.listenersMutex.RUnlock()
+
+	fw.enqueue(event)
+}
+
+// enqueue puts an event on the event queue, handling a full queue as the
+// overflow policy says
+func (fw *FileWatcher) enqueue(event models.SyncEvent) {
+	switch fw.queue.Policy() {
+	case models.OverflowSpill:
+		spilled, err := fw.spill.Send(fw.eventChan, event)
+		if err != nil {
+			fw.droppedEvents.Add(1)
+			fw.logger.Warn("Event queue full and spilling failed, dropping event for rule %s: %v", event.RuleID, err)
+		} else if spilled {
+			fw.spilledEvents.Add(1)
+		}
+		return
+	case models.OverflowBlock:
+		select {
+		case fw.eventChan <- event:
+			return
+		default:
+		}
+		timer := time.NewTimer(fw.queue.Timeout())
+		defer timer.Stop()
+		select {
+		case fw.eventChan <- event:
+			return
+		case <-timer.C:
+		case <-fw.stopChan:
+		}
 	default:
-		fw.logger.Warn("Event channel full, dropping event for rule: %s", event.RuleID)
+		select {
+		case fw.eventChan <- event:
+			return
+		default:
+		}
+	}
+
+	fw.droppedEvents.Add(1)
+	fw.logger.Warn("Event channel full, dropping event for rule: %s", event.RuleID)
+}
+
+// Stats returns the watcher's current counters
+func (fw *FileWatcher) Stats() Stats {
+	return Stats{
+		DebounceDrops: fw.debounceDrops.Load(),
+		DroppedEvents: fw.droppedEvents.Load(),
+		SpilledEvents: fw.spilledEvents.Load(),
+		QueueLength:   len(fw.eventChan),
+		QueueCapacity: cap(fw.eventChan),
+	}
+}
+
+// Status returns whether the watcher is running, how many sources it
+// follows, and its ongoing errors
+func (fw *FileWatcher) Status() Status {
+	fw.eventsMutex.RLock()
+	watchedFiles := fw.watchedFiles
+	fw.eventsMutex.RUnlock()
+
+	fw.errorsMutex.Lock()
+	defer fw.errorsMutex.Unlock()
+	errors := make(map[string]WatchError, len(fw.errors))
+	for key, watchErr := range fw.errors {
+		errors[key] = watchErr
+	}
+
+	return Status{
+		Running:      fw.running.Load(),
+		WatchedFiles: watchedFiles,
+		Errors:       errors,
+	}
+}
+
+// setError records an ongoing error for a directory or source, keeping the
+// time it first occurred
+func (fw *FileWatcher) setError(key string, err error) {
+	fw.errorsMutex.Lock()
+	defer fw.errorsMutex.Unlock()
+
+	since := time.Now()
+	if previous, ok := fw.errors[key]; ok {
+		since = previous.Since
+	}
+	fw.errors[key] = WatchError{Message: err.Error(), Since: since}
+}
+
+// clearError forgets the error of a directory or source that recovered
+func (fw *FileWatcher) clearError(key string) {
+	fw.errorsMutex.Lock()
+	defer fw.errorsMutex.Unlock()
+	delete(fw.errors, key)
+}
+
+// setSchedules parses the schedules of the current rules and forgets queued
+// changes of rules that no longer have one. Config validation has already
+// checked them, so a schedule that fails to parse is logged and ignored.
+func (fw *FileWatcher) setSchedules() {
+	fw.scheduleMutex.Lock()
+	defer fw.scheduleMutex.Unlock()
+
+	fw.schedules = make(map[string]*schedule.Schedule)
+	for _, rule := range fw.rules {
+		if rule.Schedule == nil {
+			continue
+		}
+		sched, err := schedule.Parse(rule.Schedule)
+		if err != nil {
+			fw.logger.Rule(rule.ID).Error("Ignoring schedule of rule %s: %v", rule.ID, err)
+			continue
+		}
+		fw.schedules[rule.ID] = sched
+	}
+	for key, rule := range fw.queued {
+		if fw.schedules[rule.ID] == nil {
+			delete(fw.queued, key)
+		}
+	}
+}
+
+// inSchedule returns the rules whose schedule allows syncing now. Changes to
+// the others are queued until their schedule opens, or skipped if their
+// schedule says so.
+func (fw *FileWatcher) inSchedule(rules []models.SyncRule) []models.SyncRule {
+	now := time.Now()
+	fw.scheduleMutex.Lock()
+	defer fw.scheduleMutex.Unlock()
+
+	open := make([]models.SyncRule, 0, len(rules))
+	for _, rule := range rules {
+		sched := fw.schedules[rule.ID]
+		if sched == nil || sched.Open(now) {
+			delete(fw.queued, queueKey(rule)+" "+rule.TargetKey)
+			open = append(open, rule)
+			continue
+		}
+
+		if rule.Schedule.Outside == models.ScheduleSkip {
+			fw.logger.Rule(rule.ID).Info("Skipping change to %s for rule %s outside its schedule", rule.SourceFile, rule.ID)
+			continue
+		}
+		fw.queued[queueKey(rule)+" "+rule.TargetKey] = rule
+		fw.logger.Rule(rule.ID).Info("Queued change to %s for rule %s until its schedule opens", rule.SourceFile, rule.ID)
+	}
+	return open
+}
+
+// queueKey identifies a queued rule; the rules a glob rule expands to share
+// its ID
+func queueKey(rule models.SyncRule) string {
+	return rule.ID + " " + locationKey(rule.SourceFile)
+}
+
+// releaseQueued periodically batches the queued rules whose schedule has
+// opened, syncing the current value of their source
+func (fw *FileWatcher) releaseQueued() {
+	ticker := time.NewTicker(fw.scheduleInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fw.checkQueued(time.Now())
+		case <-fw.stopChan:
+			return
+		}
+	}
+}
+
+// checkQueued batches the queued rules whose schedule is open at now
+func (fw *FileWatcher) checkQueued(now time.Time) {
+	sources := make(map[string][]models.SyncRule)
+	fw.scheduleMutex.Lock()
+	for key, rule := range fw.queued {
+		if sched := fw.schedules[rule.ID]; sched == nil || sched.Open(now) {
+			source := locationKey(rule.SourceFile)
+			sources[source] = append(sources[source], rule)
+			delete(fw.queued, key)
+		}
+	}
+	fw.scheduleMutex.Unlock()
+
+	for source, rules := range sources {
+		fw.logger.Info("Schedule opened, syncing %d queued rules for source %s", len(rules), source)
+		fw.batchRules(source, rules)
+	}
+}
+
+// reconcileLoop reconciles every rule on start, catching up with changes
+// made while var-sync was not running, and then periodically until the
+// watcher stops
+func (fw *FileWatcher) reconcileLoop() {
+	fw.Reconcile()
+
+	ticker := time.NewTicker(fw.reconcileInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			fw.Reconcile()
+		case <-fw.stopChan:
+			return
+		}
+	}
+}
+
+// Reconcile compares the target of every enabled rule with its source and
+// batches the rules whose target no longer holds the source's value, such as
+// after a change whose watch event was lost. It returns how many rules were
+// out of sync.
+func (fw *FileWatcher) Reconcile() int {
+	return fw.ReconcileContext(fw.ctx)
+}
+
+// ReconcileContext is Reconcile, ending the pass early once ctx is done
+func (fw *FileWatcher) ReconcileContext(ctx context.Context) int {
+	fw.eventsMutex.RLock()
+	sources := make(map[string][]models.SyncRule)
+	for _, rule := range fw.rules {
+		if rule.Enabled && !fw.IsPaused(rule.ID) {
+			source := locationKey(rule.SourceFile)
+			sources[source] = append(sources[source], rule)
+		}
 	}
-}
\ No newline at end of file
+	fw.eventsMutex.RUnlock()
+
+	drifted := 0
+	for source, rules := range sources {
+		if ctx.Err() != nil {
+			fw.logger.Debug("Reconcile cancelled: %v", ctx.Err())
+			break
+		}
+		sourceData, err := fw.backends.LoadContext(ctx, source)
+		if err != nil {
+			fw.logger.Error("Failed to load source %s while reconciling: %v", source, err)
+			continue
+		}
+
+		var stale []models.SyncRule
+		for _, rule := range rules {
+			if fw.outOfSync(ctx, sourceData, rule) {
+				stale = append(stale, rule)
+			}
+		}
+		if len(stale) > 0 {
+			fw.logger.Info("Reconcile found %d rules out of sync for source %s", len(stale), source)
+			fw.batchRules(source, stale)
+			drifted += len(stale)
+		}
+	}
+	return drifted
+}
+
+// outOfSync reports whether any key rule writes is missing from its target or
+// holds a different value than the source. Rules whose source value cannot be
+// resolved are left alone; their watch events report the error.
+func (fw *FileWatcher) outOfSync(ctx context.Context, sourceData map[string]any, rule models.SyncRule) bool {
+	if applies, err := fw.parser.RuleApplies(sourceData, rule); err != nil || !applies {
+		return false
+	}
+	if rule.IsTemplate() {
+		return fw.templateOutOfSync(sourceData, rule)
+	}
+	updates, err := fw.parser.ResolveRule(sourceData, rule)
+	if err != nil {
+		fw.logger.Rule(rule.ID).Debug("Rule %s not reconciled: %v", rule.ID, err)
+		return false
+	}
+
+	targetData, err := fw.backends.LoadContext(ctx, rule.TargetFile)
+	if err != nil {
+		return true
+	}
+	for targetKey, value := range updates {
+		current, err := fw.parser.GetValue(targetData, targetKey)
+		if value == parser.Deleted {
+			if err == nil {
+				return true
+			}
+		} else if err != nil || !fw.parser.ValuesEqual(current, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// pollBackends follows backend sources, which fsnotify cannot watch. Sources
+// whose backend can report its own changes are watched; the rest are
+// reloaded periodically, and the rules of any source whose content changed
+// are processed.
+func (fw *FileWatcher) pollBackends() {
+	ticker := time.NewTicker(fw.pollInterval)
+	defer ticker.Stop()
+
+	fingerprints := make(map[string]string)
+	watching := make(map[string]bool)
+	fw.checkBackendSources(fingerprints, watching)
+	for {
+		select {
+		case <-ticker.C:
+			fw.checkBackendSources(fingerprints, watching)
+		case <-fw.stopChan:
+			return
+		}
+	}
+}
+
+// matchesGlob reports whether path matches the source pattern of a glob rule.
+// The caller must hold eventsMutex.
+func (fw *FileWatcher) matchesGlob(path string) bool {
+	for _, rule := range fw.configured {
+		if !rule.Enabled || !rule.IsGlob() {
+			continue
+		}
+		pattern, err := filepath.Abs(rule.SourceFile)
+		if err != nil {
+			continue
+		}
+		if matched, _ := filepath.Match(pattern, path); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// refreshGlobs expands glob rules again and, when the files they match have
+// changed, updates the rules and syncs the files that newly match
+func (fw *FileWatcher) refreshGlobs() {
+	fw.eventsMutex.RLock()
+	configured := fw.configured
+	current := make(map[string]bool)
+	for _, rule := range fw.rules {
+		current[locationKey(rule.SourceFile)] = true
+	}
+	fw.eventsMutex.RUnlock()
+
+	globs := false
+	for _, rule := range configured {
+		globs = globs || rule.IsGlob()
+	}
+	if !globs {
+		return
+	}
+
+	expanded := models.ExpandRules(configured)
+	added := make(map[string]bool)
+	for _, rule := range expanded {
+		source := locationKey(rule.SourceFile)
+		if !current[source] {
+			added[source] = true
+		}
+		delete(current, source)
+	}
+	if len(added) == 0 && len(current) == 0 {
+		return
+	}
+
+	fw.logger.Info("Glob rules now match %d new and %d fewer source files", len(added), len(current))
+	if err := fw.SetRules(configured); err != nil {
+		fw.logger.Error("Failed to update glob rules: %v", err)
+		return
+	}
+
+	sources := make(map[string][]models.SyncRule)
+	fw.eventsMutex.RLock()
+	for _, rule := range fw.rules {
+		if source := locationKey(rule.SourceFile); rule.Enabled && added[source] {
+			sources[source] = append(sources[source], rule)
+		}
+	}
+	fw.eventsMutex.RUnlock()
+	for source, rules := range sources {
+		fw.batchRules(source, rules)
+	}
+}
+
+// fileStamp is what a polled source file looked like when last checked
+type fileStamp struct {
+	modTime  time.Time
+	size     int64
+	checksum string
+	checked  time.Time
+}
+
+// mtimeResolution covers filesystems such as SMB and FAT that store
+// modification times in steps of up to two seconds
+const mtimeResolution = 2 * time.Second
+
+// pollFiles checks the source files of polled rules, and which files glob
+// rules match, every poll interval
+func (fw *FileWatcher) pollFiles() {
+	ticker := time.NewTicker(fw.pollInterval)
+	defer ticker.Stop()
+
+	stamps := make(map[string]fileStamp)
+	fw.checkPolledFiles(stamps)
+	for {
+		select {
+		case <-ticker.C:
+			fw.refreshGlobs()
+			fw.checkPolledFiles(stamps)
+		case <-fw.stopChan:
+			return
+		}
+	}
+}
+
+// polledFiles returns the enabled rules of every polled source file by its
+// absolute path
+func (fw *FileWatcher) polledFiles() map[string][]models.SyncRule {
+	fw.eventsMutex.RLock()
+	defer fw.eventsMutex.RUnlock()
+
+	files := make(map[string][]models.SyncRule)
+	for _, rule := range fw.rules {
+		if rule.Enabled && !backend.IsRef(rule.SourceFile) && rule.Polled(fw.watchMode) {
+			path := locationKey(rule.SourceFile)
+			files[path] = append(files[path], rule)
+		}
+	}
+	return files
+}
+
+// checkPolledFiles batches the rules of every polled file whose content
+// changed since its stamp. The checksum is only computed when the file's
+// modification time or size changed, or the modification time is too recent
+// to tell, and touching a file does not sync it. The first check of a file
+// only records its stamp.
+func (fw *FileWatcher) checkPolledFiles(stamps map[string]fileStamp) {
+	for path, rules := range fw.polledFiles() {
+		info, err := os.Stat(path)
+		if err != nil {
+			fw.logger.Error("Failed to poll source file %s: %v", path, err)
+			fw.setError(path, err)
+			continue
+		}
+		fw.clearError(path)
+
+		now := time.Now()
+		previous, seen := stamps[path]
+		if seen && previous.modTime.Equal(info.ModTime()) && previous.size == info.Size() &&
+			info.ModTime().Before(previous.checked.Add(-mtimeResolution)) {
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			fw.logger.Error("Failed to poll source file %s: %v", path, err)
+			fw.setError(path, err)
+			continue
+		}
+		sum := sha256.Sum256(content)
+		stamps[path] = fileStamp{modTime: info.ModTime(), size: info.Size(), checksum: hex.EncodeToString(sum[:]), checked: now}
+
+		if seen && previous.checksum != stamps[path].checksum {
+			fw.logger.Debug("Source file %s changed, syncing %d rules", path, len(rules))
+			fw.batchRules(path, rules)
+		}
+	}
+}
+
+// backendSources returns the enabled rules of every backend source
+func (fw *FileWatcher) backendSources() map[string][]models.SyncRule {
+	fw.eventsMutex.RLock()
+	defer fw.eventsMutex.RUnlock()
+
+	sources := make(map[string][]models.SyncRule)
+	for _, rule := range fw.rules {
+		if rule.Enabled && backend.IsRef(rule.SourceFile) {
+			sources[rule.SourceFile] = append(sources[rule.SourceFile], rule)
+		}
+	}
+	return sources
+}
+
+// checkBackendSources starts watching newly added watchable sources and
+// batches the rules of every polled source whose content differs from its
+// fingerprint. The first check of a source only records its fingerprint.
+func (fw *FileWatcher) checkBackendSources(fingerprints map[string]string, watching map[string]bool) {
+	for source, rules := range fw.backendSources() {
+		if watching[source] {
+			continue
+		}
+		if fw.backends.CanWatch(source) {
+			watching[source] = true
+			go fw.watchBackend(source)
+			continue
+		}
+
+		data, err := fw.backends.LoadContext(fw.ctx, source)
+		if err != nil {
+			fw.logger.Error("Failed to poll source %s: %v", source, err)
+			fw.setError(source, err)
+			continue
+		}
+		fw.clearError(source)
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			continue
+		}
+
+		previous, seen := fingerprints[source]
+		fingerprints[source] = string(encoded)
+		if seen && previous != string(encoded) {
+			fw.logger.Debug("Source %s changed, syncing %d rules", source, len(rules))
+			fw.batchRules(source, rules)
+		}
+	}
+}
+
+// watchBackend follows a watchable backend source until the watcher stops,
+// retrying after the poll interval when the backend cannot be reached
+func (fw *FileWatcher) watchBackend(source string) {
+	fw.logger.Info("Watching source: %s", source)
+	changed := func() {
+		fw.clearError(source)
+		if rules := fw.backendSources()[source]; len(rules) > 0 {
+			fw.logger.Debug("Source %s changed, syncing %d rules", source, len(rules))
+			fw.batchRules(source, rules)
+		}
+	}
+
+	for {
+		err := fw.backends.Watch(source, fw.stopChan, changed)
+		select {
+		case <-fw.stopChan:
+			return
+		default:
+		}
+
+		fw.logger.Error("Failed to watch source %s: %v", source, err)
+		fw.setError(source, err)
+		select {
+		case <-time.After(fw.pollInterval):
+		case <-fw.stopChan:
+			return
+		}
+	}
+}
+
+// locationKey identifies a source or target: the absolute path of a file, or
+// a backend reference as written
+func locationKey(location string) string {
+	if backend.IsRef(location) {
+		return location
+	}
+	if absPath, err := filepath.Abs(location); err == nil {
+		return absPath
+	}
+	return location
+}
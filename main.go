@@ -1,14 +1,22 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"var-sync/internal/cli"
 	"var-sync/internal/config"
 	"var-sync/internal/logger"
+	"var-sync/internal/pidfile"
 	"var-sync/internal/sync"
 	"var-sync/internal/tui"
+	"var-sync/pkg/models"
 )
 
 const version = "1.0.0"
@@ -16,49 +24,150 @@ const version = "1.0.0"
 func main() {
 	var (
 		configFile = flag.String("config", "var-sync.json", "Configuration file path")
+		profile = flag.String("profile", os.Getenv("VAR_SYNC_PROFILE"), "Profile whose variables fill {{profile.name}} in rules, or $VAR_SYNC_PROFILE")
 		interactive = flag.Bool("tui", false, "Start interactive TUI mode")
+		attach = flag.Bool("attach", false, "Start the TUI attached to the var-sync already watching the config")
 		watch = flag.Bool("watch", false, "Start file watching mode")
+		dryRun = flag.Bool("dry-run", false, "Print a diff of what a sync would change without writing files")
+		force = flag.Bool("force", false, "Start watching even if another var-sync is watching the same config")
 		showVersion = flag.Bool("version", false, "Show version")
+		output = flag.String("output", cli.OutputText, "Output format of commands, -dry-run and -version: text or json")
 	)
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: var-sync [options] [command]\n\nOptions:\n")
+		flag.PrintDefaults()
+		fmt.Fprintln(flag.CommandLine.Output())
+		cli.Usage(flag.CommandLine.Output())
+	}
 	flag.Parse()
 
+	if !cli.ValidOutput(*output) {
+		log.Fatalf("invalid -output %q: use text or json", *output)
+	}
+
 	if *showVersion {
+		if *output == cli.OutputJSON {
+			fmt.Printf("{\"version\": %q}\n", version)
+			return
+		}
 		fmt.Printf("var-sync version %s\n", version)
 		return
 	}
 
 	logger := logger.New()
+	if *output == cli.OutputJSON {
+		// Leave stdout to the JSON, for the scripts reading it
+		logger.SetConsole(os.Stderr)
+	}
 	cfg, err := config.Load(*configFile)
 	if err != nil {
 		log.Printf("Failed to load config: %v", err)
 		cfg = config.New()
 	}
 
+	if *profile != "" {
+		if err := cfg.SelectProfile(*profile); err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	if cfg.LogFile != "" {
 		if err := logger.SetLogFile(cfg.LogFile); err != nil {
 			log.Printf("Failed to set log file: %v", err)
 		}
 	}
 
+	if cfg.LogRotation != nil {
+		logger.SetRotation(logRotation(cfg.LogRotation))
+	}
+
 	if cfg.Debug {
 		logger.SetLevel(0) // DEBUG level
 	}
 
-	if *interactive {
-		app := tui.New(cfg, logger)
+	if len(cfg.LogLevels) > 0 {
+		logger.SetLevels(logLevels(cfg.LogLevels))
+	}
+
+	if flag.NArg() > 0 {
+		ctx := &cli.Context{
+			Config:     cfg,
+			ConfigPath: *configFile,
+			Logger:     logger,
+			Stdout:     os.Stdout,
+			Output:     *output,
+		}
+		if err := cli.Run(ctx, flag.Args()); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if *interactive || *attach {
+		app := tui.New(cfg, *configFile, logger)
+		if *attach {
+			if err := app.Attach(); err != nil {
+				log.Fatal(err)
+			}
+		}
 		if err := app.Run(); err != nil {
 			log.Fatal(err)
 		}
 		return
 	}
 
+	if *dryRun {
+		// Interrupting the dry run cancels remote backend reads in progress
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		syncer := sync.New(cfg, logger)
+		var err error
+		if *output == cli.OutputJSON {
+			err = syncer.DryRunJSONContext(ctx, os.Stdout)
+		} else {
+			err = syncer.DryRunContext(ctx, os.Stdout)
+		}
+		stop()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
 	if *watch {
+		pid, err := pidfile.Acquire(cfg.PidPath(*configFile), *force)
+		if err != nil {
+			log.Fatal(err)
+		}
 		syncer := sync.New(cfg, logger)
-		if err := syncer.Start(); err != nil {
+		syncer.WatchConfig(*configFile)
+		syncer.ServeControl(cfg.ControlPath(*configFile))
+		err = syncer.Start()
+		pid.Release()
+		if err != nil {
 			log.Fatal(err)
 		}
 		return
 	}
 
 	flag.Usage()
-}
\ No newline at end of file
+}
+
+// logRotation converts the configured log rotation limits for the logger
+func logRotation(r *models.LogRotation) logger.Rotation {
+	return logger.Rotation{
+		MaxSize:    int64(r.MaxSizeMB) * 1024 * 1024,
+		MaxBackups: r.MaxBackups,
+		MaxAge:     time.Duration(r.MaxAge),
+		Compress:   r.Compress,
+	}
+}
+
+// logLevels parses the configured module and rule log levels, which were
+// validated when the config was loaded
+func logLevels(names map[string]string) map[string]logger.LogLevel {
+	levels := make(map[string]logger.LogLevel, len(names))
+	for scope, name := range names {
+		levels[scope], _ = logger.ParseLevel(name)
+	}
+	return levels
+}
@@ -1,42 +1,986 @@
 package models
 
-import "time"
+import (
+	"fmt"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
 
 type FileFormat string
 
 const (
-	FormatJSON FileFormat = "json"
-	FormatYAML FileFormat = "yaml"
-	FormatTOML FileFormat = "toml"
-	FormatENV  FileFormat = "env"
+	FormatJSON       FileFormat = "json"
+	FormatYAML       FileFormat = "yaml"
+	FormatTOML       FileFormat = "toml"
+	FormatENV        FileFormat = "env"
+	FormatINI        FileFormat = "ini"
+	FormatProperties FileFormat = "properties"
+	FormatHCL        FileFormat = "hcl"
+	FormatXML        FileFormat = "xml"
+	FormatDockerfile FileFormat = "dockerfile"
 )
 
 type SyncRule struct {
-	ID          string     `json:"id"`
-	Name        string     `json:"name"`
-	Description string     `json:"description,omitempty"`
-	SourceFile  string     `json:"source_file"`
-	SourceKey   string     `json:"source_key"`
-	TargetFile  string     `json:"target_file"`
-	TargetKey   string     `json:"target_key"`
-	Enabled     bool       `json:"enabled"`
-	Created     time.Time  `json:"created"`
-	LastSync    *time.Time `json:"last_sync,omitempty"`
+	ID            string       `json:"id"`
+	Name          string       `json:"name"`
+	Description   string       `json:"description,omitempty"`
+	Tags          []string     `json:"tags,omitempty"` // Such as env:prod, for grouping rules in the TUI
+	SourceFile    string       `json:"source_file"`
+	SourceKey     string       `json:"source_key"`
+	SourceExpr    string       `json:"source_expr,omitempty"` // Computes the synced value from the source instead of reading source_key
+	When          string       `json:"when,omitempty"`        // Only syncs the rule while this condition holds for the source
+	TargetFile    string       `json:"target_file"`
+	TargetKey     string       `json:"target_key"`
+	Mappings      []KeyMapping `json:"mappings,omitempty"`       // Source keys synced to target keys of the same files at once, instead of source_key and target_key
+	Template      string       `json:"template,omitempty"`       // A text/template rendered with the source document as the whole target file
+	TargetType    ValueType    `json:"target_type,omitempty"`    // Converts synced values to this type
+	CreateMissing bool         `json:"create_missing,omitempty"` // Adds the target key if the target does not have it
+	DeleteMissing bool         `json:"delete_missing,omitempty"` // Removes the target key when the source key is removed
+	Enabled       bool         `json:"enabled"`
+	Backup        *bool        `json:"backup,omitempty"`
+	OnConflict    OnConflict   `json:"on_conflict,omitempty"`
+	OnSuccess     []Hook       `json:"on_success,omitempty"`
+	OnFailure     []Hook       `json:"on_failure,omitempty"`
+	Priority      Priority     `json:"priority,omitempty"`
+	Sensitive     bool         `json:"sensitive,omitempty"`
+	Schedule      *Schedule    `json:"schedule,omitempty"`
+	WatchMode     WatchMode    `json:"watch_mode,omitempty"`
+	Debounce      Duration     `json:"debounce,omitempty"`
+	BatchDelay    Duration     `json:"batch_delay,omitempty"`
+	BatchMaxDelay Duration     `json:"batch_max_delay,omitempty"` // Syncs a change within this long even while the source keeps changing
+	MinInterval   Duration     `json:"min_interval,omitempty"`    // Syncs the rule at most once per this interval
+	Created       time.Time    `json:"created"`
+	LastSync      *time.Time   `json:"last_sync,omitempty"`
+}
+
+// KeyMapping is one source key a multi-key rule syncs to a target key
+type KeyMapping struct {
+	SourceKey string `json:"source_key"`
+	TargetKey string `json:"target_key"`
+}
+
+// KeyMappings returns the keys the rule syncs: its mappings, or its source
+// key and target key
+func (r SyncRule) KeyMappings() []KeyMapping {
+	if len(r.Mappings) > 0 {
+		return r.Mappings
+	}
+	return []KeyMapping{{SourceKey: r.SourceKey, TargetKey: r.TargetKey}}
+}
+
+// BackupEnabled reports whether target files should be backed up before this
+// rule writes to them. The rule's own setting overrides the global one.
+func (r SyncRule) BackupEnabled(global *BackupConfig) bool {
+	if r.Backup != nil {
+		return *r.Backup
+	}
+	return global != nil && global.Enabled
+}
+
+// IsTemplate reports whether the rule renders a template into its target
+// file rather than syncing a key
+func (r SyncRule) IsTemplate() bool {
+	return r.Template != ""
+}
+
+// IsGlob reports whether the rule's source file is a glob pattern, such as
+// services/*/config.yaml, rather than a single file or backend reference
+func (r SyncRule) IsGlob() bool {
+	return !strings.Contains(r.SourceFile, "://") && strings.ContainsAny(r.SourceFile, "*?[")
+}
+
+// Expand returns a copy of a glob rule for every file its source matches,
+// sorted by path, with {{dir}}, {{parent}}, {{base}} and {{name}} in its
+// target file and keys replaced for that file: its directory, the name of its
+// directory, its name, and its name without extension. A multi-key rule is
+// returned as a copy for each of its mappings, syncing that source key to
+// that target key. The copies keep the rule's ID, and are sensitive if any of
+// its keys are. Other rules are returned as they are.
+func (r SyncRule) Expand() ([]SyncRule, error) {
+	if !r.IsGlob() {
+		return r.expandMappings(), nil
+	}
+
+	matches, err := filepath.Glob(r.SourceFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid source_file pattern %q for rule %s: %w", r.SourceFile, r.ID, err)
+	}
+
+	rules := make([]SyncRule, 0, len(matches))
+	for _, match := range matches {
+		dir := filepath.Dir(match)
+		base := filepath.Base(match)
+		replacer := strings.NewReplacer(
+			"{{dir}}", dir,
+			"{{parent}}", filepath.Base(dir),
+			"{{base}}", base,
+			"{{name}}", strings.TrimSuffix(base, filepath.Ext(base)),
+		)
+
+		rule := r
+		rule.SourceFile = match
+		rule.TargetFile = replacer.Replace(r.TargetFile)
+		rule.TargetKey = replacer.Replace(r.TargetKey)
+		rule.Mappings = nil
+		for _, mapping := range r.Mappings {
+			mapping.TargetKey = replacer.Replace(mapping.TargetKey)
+			rule.Mappings = append(rule.Mappings, mapping)
+		}
+		rules = append(rules, rule.expandMappings()...)
+	}
+	return rules, nil
+}
+
+// expandMappings returns a copy of a multi-key rule for each of its
+// mappings, or the rule itself
+func (r SyncRule) expandMappings() []SyncRule {
+	if len(r.Mappings) == 0 {
+		return []SyncRule{r}
+	}
+	sensitive := r.IsSensitive()
+	rules := make([]SyncRule, 0, len(r.Mappings))
+	for _, mapping := range r.Mappings {
+		rule := r
+		rule.SourceKey = mapping.SourceKey
+		rule.TargetKey = mapping.TargetKey
+		rule.Mappings = nil
+		rule.Sensitive = sensitive
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ExpandRules expands every glob rule in rules, leaving out rules whose
+// pattern is invalid
+func ExpandRules(rules []SyncRule) []SyncRule {
+	expanded := make([]SyncRule, 0, len(rules))
+	for _, rule := range rules {
+		matches, err := rule.Expand()
+		if err != nil {
+			continue
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded
+}
+
+// sensitiveWords mark key paths whose values are secrets
+var sensitiveWords = []string{"password", "token", "secret"}
+
+// IsSensitive reports whether the rule's values must be kept out of logs and
+// history: rules marked sensitive and rules whose source or target key names
+// a password, token or secret
+func (r SyncRule) IsSensitive() bool {
+	if r.Sensitive || SensitiveKey(r.SourceExpr) {
+		return true
+	}
+	for _, mapping := range r.KeyMappings() {
+		if SensitiveKey(mapping.SourceKey) || SensitiveKey(mapping.TargetKey) {
+			return true
+		}
+	}
+	return false
+}
+
+// SensitiveKey reports whether a key path looks like it holds a secret
+func SensitiveKey(keyPath string) bool {
+	lower := strings.ToLower(keyPath)
+	for _, word := range sensitiveWords {
+		if strings.Contains(lower, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Hook is run after a sync: a shell Command, a webhook URL the event is
+// POSTed to as JSON, or both
+type Hook struct {
+	Command string   `json:"command,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	Timeout Duration `json:"timeout,omitempty"`
+}
+
+// DefaultHookTimeout bounds a hook without its own timeout
+const DefaultHookTimeout = 30 * time.Second
+
+// Priority marks rules whose every sync is worth a notification
+type Priority string
+
+const (
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+)
+
+// Valid reports whether p is a known priority; empty means normal
+func (p Priority) Valid() bool {
+	switch p {
+	case "", PriorityNormal, PriorityHigh:
+		return true
+	}
+	return false
+}
+
+// ValueType is a type a rule's values are converted to before they are
+// written, whatever type they have in the source
+type ValueType string
+
+const (
+	TypeString ValueType = "string"
+	TypeInt    ValueType = "int"
+	TypeFloat  ValueType = "float"
+	TypeBool   ValueType = "bool"
+	TypeJSON   ValueType = "json" // A string parsed as JSON
+)
+
+// Valid reports whether t is a known type; empty keeps the source's type
+func (t ValueType) Valid() bool {
+	switch t {
+	case "", TypeString, TypeInt, TypeFloat, TypeBool, TypeJSON:
+		return true
+	}
+	return false
+}
+
+// WatchMode is how changes to a local source file are noticed
+type WatchMode string
+
+const (
+	WatchNotify WatchMode = "fsnotify" // Filesystem events
+	WatchPoll   WatchMode = "poll"     // Checking the file every poll_interval, for filesystems without events such as SMB mounts
+)
+
+// Valid reports whether m is a known mode; empty means fsnotify
+func (m WatchMode) Valid() bool {
+	switch m {
+	case "", WatchNotify, WatchPoll:
+		return true
+	}
+	return false
+}
+
+// Polled reports whether the rule's source file is polled rather than
+// watched. The rule's own mode overrides the global one.
+func (r SyncRule) Polled(global WatchMode) bool {
+	if r.WatchMode != "" {
+		return r.WatchMode == WatchPoll
+	}
+	return global == WatchPoll
+}
+
+// Schedule limits when a rule syncs, such as to a maintenance window. It is
+// open during any Include window, or for Duration after each time the Cron
+// expression fires, and never during an Exclude window. Windows look like
+// "Mon-Fri 22:00-06:00" or "02:00-04:00".
+type Schedule struct {
+	Include  []string       `json:"include,omitempty"`
+	Exclude  []string       `json:"exclude,omitempty"`
+	Cron     string         `json:"cron,omitempty"`
+	Duration Duration       `json:"duration,omitempty"`
+	Timezone string         `json:"timezone,omitempty"`
+	Outside  SchedulePolicy `json:"outside,omitempty"`
+}
+
+// SchedulePolicy decides what happens to changes made outside a rule's schedule
+type SchedulePolicy string
+
+const (
+	ScheduleQueue SchedulePolicy = "queue" // Sync once the schedule opens
+	ScheduleSkip  SchedulePolicy = "skip"  // Drop the change
+)
+
+// Valid reports whether p is a known policy; empty means queue
+func (p SchedulePolicy) Valid() bool {
+	switch p {
+	case "", ScheduleQueue, ScheduleSkip:
+		return true
+	}
+	return false
 }
 
 type SyncEvent struct {
-	RuleID    string    `json:"rule_id"`
-	Timestamp time.Time `json:"timestamp"`
-	OldValue  any       `json:"old_value"`
-	NewValue  any       `json:"new_value"`
-	Success   bool      `json:"success"`
-	Error     string    `json:"error,omitempty"`
+	ID         string    `json:"id,omitempty"`
+	Sequence   uint64    `json:"sequence,omitempty"`  // Order in which events were sent, increasing across runs
+	ChangeID   string    `json:"change_id,omitempty"` // Shared by the events of the file change that caused them
+	RuleID     string    `json:"rule_id"`
+	TargetFile string    `json:"target_file,omitempty"`
+	TargetKey  string    `json:"target_key,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+	OldValue   any       `json:"old_value"`
+	NewValue   any       `json:"new_value"`
+	Success    bool      `json:"success"`
+	Error      string    `json:"error,omitempty"`
+	UndoOf     string    `json:"undo_of,omitempty"`
+	Conflict   bool      `json:"conflict,omitempty"`
+	Drift      bool      `json:"drift,omitempty"`   // A target key was edited outside var-sync
+	Deleted    bool      `json:"deleted,omitempty"` // The target key was removed along with its source key
+	Resolves   string    `json:"resolves,omitempty"`
+	Sensitive  bool      `json:"sensitive,omitempty"`
+}
+
+// RedactedValue replaces the values of sensitive events
+const RedactedValue = "********"
+
+// Redacted returns the event with its values masked if it is sensitive
+func (e SyncEvent) Redacted() SyncEvent {
+	if !e.Sensitive {
+		return e
+	}
+	if e.OldValue != nil {
+		e.OldValue = RedactedValue
+	}
+	if e.NewValue != nil {
+		e.NewValue = RedactedValue
+	}
+	return e
+}
+
+// ConflictPolicy decides what happens when a target key was edited by hand
+// since var-sync last wrote it
+type ConflictPolicy string
+
+const (
+	ConflictOverwrite ConflictPolicy = "overwrite"
+	ConflictSkip      ConflictPolicy = "skip"
+	ConflictPrompt    ConflictPolicy = "prompt-in-tui"
+)
+
+// Valid reports whether p is a known policy; empty means the default
+func (p ConflictPolicy) Valid() bool {
+	switch p {
+	case "", ConflictOverwrite, ConflictSkip, ConflictPrompt:
+		return true
+	}
+	return false
+}
+
+// OnConflict is a rule's own conflict resolution strategy, overriding the
+// global conflict policy
+type OnConflict string
+
+const (
+	SourceWins OnConflict = "source-wins"
+	TargetWins OnConflict = "target-wins"
+	NewestWins OnConflict = "newest-wins" // Whichever of source and target file was modified last
+	Manual     OnConflict = "manual"
+)
+
+// Valid reports whether o is a known strategy; empty uses the global policy
+func (o OnConflict) Valid() bool {
+	switch o {
+	case "", SourceWins, TargetWins, NewestWins, Manual:
+		return true
+	}
+	return false
 }
 
+const (
+	// DefaultHistoryFile is the sync history journal used when none is configured
+	DefaultHistoryFile = "var-sync-history.jsonl"
+	// DefaultStateFile records the values var-sync last wrote to each target
+	DefaultStateFile = "var-sync-state.json"
+)
+
 type Config struct {
-	Rules   []SyncRule `json:"rules"`
-	LogFile string     `json:"log_file"`
-	Debug   bool       `json:"debug"`
+	Rules             []SyncRule        `json:"rules"`
+	LogFile           string            `json:"log_file"`
+	LogRotation       *LogRotation      `json:"log_rotation,omitempty"`
+	LogLevels         map[string]string `json:"log_levels,omitempty"`
+	HistoryFile       string            `json:"history_file,omitempty"`
+	StateFile         string            `json:"state_file,omitempty"`
+	PidFile           string            `json:"pid_file,omitempty"`
+	ControlSocket     string            `json:"control_socket,omitempty"`
+	ConflictPolicy    ConflictPolicy    `json:"conflict_policy,omitempty"`
+	StrictRules       bool              `json:"strict_rules,omitempty"`
+	Debug             bool              `json:"debug"`
+	Backup            *BackupConfig     `json:"backup,omitempty"`
+	PollInterval      Duration          `json:"poll_interval,omitempty"`
+	WatchMode         WatchMode         `json:"watch_mode,omitempty"`
+	Debounce          Duration          `json:"debounce,omitempty"`
+	BatchDelay        Duration          `json:"batch_delay,omitempty"`
+	BatchMaxDelay     Duration          `json:"batch_max_delay,omitempty"`
+	TargetWorkers     int               `json:"target_workers,omitempty"`      // How many target files of a source change are written at once
+	TargetMinInterval Duration          `json:"target_min_interval,omitempty"` // Writes each target file at most once per this interval
+	SelfWriteWindow   Duration          `json:"self_write_window,omitempty"`   // Ignores events for a target this long after var-sync writes it, while it holds what was written
+	Retry             *RetryPolicy      `json:"retry,omitempty"`
+	Drift             *DriftConfig      `json:"drift,omitempty"`
+	ReconcileInterval Duration          `json:"reconcile_interval,omitempty"`
+	ShutdownTimeout   Duration          `json:"shutdown_timeout,omitempty"`
+	EventQueue        *EventQueue       `json:"event_queue,omitempty"`
+	Vault             *VaultConfig      `json:"vault,omitempty"`
+	Consul            *ConsulConfig     `json:"consul,omitempty"`
+	Etcd              *EtcdConfig       `json:"etcd,omitempty"`
+	AWS               *AWSConfig        `json:"aws,omitempty"`
+	HTTP              *HTTPConfig       `json:"http,omitempty"`
+	Metrics           *MetricsConfig    `json:"metrics,omitempty"`
+	Health            *HealthConfig     `json:"health,omitempty"`
+	OnSuccess         []Hook            `json:"on_success,omitempty"`
+	OnFailure         []Hook            `json:"on_failure,omitempty"`
+	Notifications     []Notifier        `json:"notifications,omitempty"`
+	Profiles          Profiles          `json:"profiles,omitempty"`
+	Include           []string          `json:"include,omitempty"`
+	Schemas           map[string]string `json:"schemas,omitempty"` // JSON Schema each target file must match, by target file
+
+	// The config as written, before ExpandPaths, and the profile selected
+	written *Config
+	profile string
+
+	// The included file each rule was read from by rule ID
+	included map[string]string
+}
+
+// Profiles holds the variables of each profile by profile name, such as dev
+// or prod, substituted for {{profile.name}} in rules
+type Profiles map[string]map[string]string
+
+// LogRotation limits the log file: it is rotated once it grows past
+// MaxSizeMB, keeping at most MaxBackups rotated files and none older than
+// MaxAge. Zero means no limit.
+type LogRotation struct {
+	MaxSizeMB  int      `json:"max_size_mb,omitempty"`
+	MaxBackups int      `json:"max_backups,omitempty"`
+	MaxAge     Duration `json:"max_age,omitempty"`
+	Compress   bool     `json:"compress,omitempty"`
+}
+
+// DriftConfig watches target files for synced keys edited outside var-sync.
+// With Reapply the value var-sync last wrote is restored.
+type DriftConfig struct {
+	Enabled bool `json:"enabled"`
+	Reapply bool `json:"reapply,omitempty"`
+}
+
+// Defaults for how file changes are grouped when debounce and batch_delay
+// are not configured
+const (
+	DefaultDebounce   = 500 * time.Millisecond // Changes to a file this soon after the last one are ignored
+	DefaultBatchDelay = 200 * time.Millisecond // How long a source must be left alone before its rules sync
+)
+
+// DefaultSelfWriteWindow is how long events for a target var-sync wrote are
+// ignored while it holds what was written, when self_write_window is not
+// configured
+const DefaultSelfWriteWindow = 2 * time.Second
+
+// DefaultShutdownTimeout is how long stopping waits for pending changes to
+// sync when shutdown_timeout is not configured
+const DefaultShutdownTimeout = 30 * time.Second
+
+// DefaultTargetWorkers is how many target files of a source change are
+// written at once when target_workers is not configured
+const DefaultTargetWorkers = 8
+
+// RetryPolicy retries failed source loads and target updates before a sync
+// is reported as failed. The first retry waits InitialBackoff, and each
+// further one twice as long up to MaxBackoff; Jitter varies every wait by up
+// to that fraction of it, so that retries of many rules spread out.
+type RetryPolicy struct {
+	MaxAttempts    int      `json:"max_attempts,omitempty"`
+	InitialBackoff Duration `json:"initial_backoff,omitempty"`
+	MaxBackoff     Duration `json:"max_backoff,omitempty"`
+	Jitter         float64  `json:"jitter,omitempty"`
+}
+
+// Defaults for a retry policy's unset fields
+const (
+	DefaultRetryAttempts   = 3
+	DefaultInitialBackoff  = 50 * time.Millisecond
+	DefaultMaxRetryBackoff = 5 * time.Second
+)
+
+// Attempts returns how many times an operation is tried in all; a nil policy
+// uses the defaults
+func (p *RetryPolicy) Attempts() int {
+	if p == nil || p.MaxAttempts <= 0 {
+		return DefaultRetryAttempts
+	}
+	return p.MaxAttempts
+}
+
+// Backoff returns how long to wait after the given failed attempt, counting
+// from 1
+func (p *RetryPolicy) Backoff(attempt int) time.Duration {
+	var policy RetryPolicy
+	if p != nil {
+		policy = *p
+	}
+	maxBackoff := policy.MaxBackoff.Or(DefaultMaxRetryBackoff)
+
+	delay := policy.InitialBackoff.Or(DefaultInitialBackoff)
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxBackoff)
+
+	if policy.Jitter > 0 {
+		delay += time.Duration(float64(delay) * policy.Jitter * (rand.Float64()*2 - 1))
+	}
+	return delay
+}
+
+// EventQueue sizes the queue of sync events waiting to be logged and sets
+// what happens to events that arrive while it is full
+type EventQueue struct {
+	Size         int           `json:"size,omitempty"`
+	Overflow     QueueOverflow `json:"overflow,omitempty"`
+	BlockTimeout Duration      `json:"block_timeout,omitempty"`
+	SpillFile    string        `json:"spill_file,omitempty"`
+}
+
+// QueueOverflow is what happens to a sync event when the event queue is full
+type QueueOverflow string
+
+const (
+	OverflowDrop  QueueOverflow = "drop"  // Discard the event
+	OverflowBlock QueueOverflow = "block" // Hold up syncs for up to block_timeout until there is room, then discard it
+	OverflowSpill QueueOverflow = "spill" // Write it to spill_file until there is room
+)
+
+// Valid reports whether o is a known overflow policy; empty means drop
+func (o QueueOverflow) Valid() bool {
+	switch o {
+	case "", OverflowDrop, OverflowBlock, OverflowSpill:
+		return true
+	}
+	return false
+}
+
+// Defaults for an event queue's unset fields
+const (
+	DefaultEventQueueSize = 100
+	DefaultBlockTimeout   = time.Second
+	DefaultSpillFile      = "var-sync-events-overflow.jsonl"
+)
+
+// Capacity returns how many events the queue holds; a nil queue uses the
+// defaults
+func (q *EventQueue) Capacity() int {
+	if q == nil || q.Size <= 0 {
+		return DefaultEventQueueSize
+	}
+	return q.Size
+}
+
+// Policy returns what happens to events that arrive while the queue is full
+func (q *EventQueue) Policy() QueueOverflow {
+	if q == nil || q.Overflow == "" {
+		return OverflowDrop
+	}
+	return q.Overflow
+}
+
+// Timeout returns how long the block policy waits for room
+func (q *EventQueue) Timeout() time.Duration {
+	if q == nil {
+		return DefaultBlockTimeout
+	}
+	return q.BlockTimeout.Or(DefaultBlockTimeout)
+}
+
+// SpillPath returns the file the spill policy writes events to
+func (q *EventQueue) SpillPath() string {
+	if q == nil || q.SpillFile == "" {
+		return DefaultSpillFile
+	}
+	return q.SpillFile
+}
+
+// DefaultPollInterval is how often backend sources are polled when no
+// poll_interval is configured
+const DefaultPollInterval = 30 * time.Second
+
+// VaultConfig locates a HashiCorp Vault server and how to authenticate to
+// it, either with a token or with an AppRole role and secret ID. Address and
+// Token default to the VAULT_ADDR and VAULT_TOKEN environment variables.
+type VaultConfig struct {
+	Address   string `json:"address,omitempty"`
+	Token     string `json:"token,omitempty"`
+	RoleID    string `json:"role_id,omitempty"`
+	SecretID  string `json:"secret_id,omitempty"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// ConsulConfig locates a Consul agent. Address and Token default to the
+// CONSUL_HTTP_ADDR and CONSUL_HTTP_TOKEN environment variables, and the
+// address to the local agent.
+type ConsulConfig struct {
+	Address    string `json:"address,omitempty"`
+	Token      string `json:"token,omitempty"`
+	Datacenter string `json:"datacenter,omitempty"`
+}
+
+// EtcdConfig locates an etcd cluster's v3 HTTP gateway. Endpoints default to
+// the ETCDCTL_ENDPOINTS environment variable, then the local member. Username
+// and Password are only needed when etcd auth is enabled.
+type EtcdConfig struct {
+	Endpoints []string `json:"endpoints,omitempty"`
+	Username  string   `json:"username,omitempty"`
+	Password  string   `json:"password,omitempty"`
+}
+
+// AWSConfig selects the AWS region and credentials used for SSM Parameter
+// Store and Secrets Manager. Anything left empty is found the way the AWS CLI
+// finds it: environment variables, the shared config and credentials files,
+// then the ECS or EC2 instance role. Endpoint overrides the service endpoints,
+// such as for LocalStack.
+type AWSConfig struct {
+	Region   string `json:"region,omitempty"`
+	Profile  string `json:"profile,omitempty"`
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// HTTPConfig holds headers, such as credentials, for http:// and https://
+// sources and webhook targets. Each endpoint's settings only apply to URLs
+// starting with its URL.
+type HTTPConfig struct {
+	Endpoints []HTTPEndpoint `json:"endpoints,omitempty"`
+}
+
+// HTTPEndpoint is a URL prefix and the headers to send to it. With
+// SendDocument set, webhook payloads also carry the target's whole document,
+// fetched from the URL and updated with the changed values.
+type HTTPEndpoint struct {
+	URL          string            `json:"url"`
+	Headers      map[string]string `json:"headers,omitempty"`
+	SendDocument bool              `json:"send_document,omitempty"`
+}
+
+// Headers returns the configured headers for address, with those of longer
+// matching endpoint URLs taking precedence
+func (c HTTPConfig) Headers(address string) map[string]string {
+	headers := make(map[string]string)
+	matched := make(map[string]int)
+	for _, endpoint := range c.Endpoints {
+		if endpoint.URL == "" || !strings.HasPrefix(address, endpoint.URL) {
+			continue
+		}
+		for name, value := range endpoint.Headers {
+			if len(endpoint.URL) >= matched[name] {
+				headers[name] = value
+				matched[name] = len(endpoint.URL)
+			}
+		}
+	}
+	return headers
+}
+
+// MetricsConfig exposes Prometheus metrics at /metrics on the Listen
+// address, such as ":9464", while watching
+type MetricsConfig struct {
+	Listen string `json:"listen"`
+}
+
+// HealthConfig serves /healthz and /status on the Listen address while
+// watching. It may be the same address as the metrics.
+type HealthConfig struct {
+	Listen string `json:"listen"`
+}
+
+// Notifier posts messages about syncs to a chat webhook. Type is slack,
+// discord or webhook, the last posting a generic JSON message. Only messages
+// at MinSeverity or above are sent, and a rule's failures are reported once
+// FailureThreshold of them happen in a row.
+type Notifier struct {
+	Type             NotifierType `json:"type"`
+	URL              string       `json:"url"`
+	Channel          string       `json:"channel,omitempty"`
+	MinSeverity      Severity     `json:"min_severity,omitempty"`
+	FailureThreshold int          `json:"failure_threshold,omitempty"`
+}
+
+// DefaultFailureThreshold is how many syncs of a rule must fail in a row
+// before notifiers report it
+const DefaultFailureThreshold = 3
+
+// NotifierType selects the message format a notifier posts
+type NotifierType string
+
+const (
+	NotifySlack   NotifierType = "slack"
+	NotifyDiscord NotifierType = "discord"
+	NotifyWebhook NotifierType = "webhook"
+)
+
+// Valid reports whether t is a known notifier type
+func (t NotifierType) Valid() bool {
+	switch t {
+	case NotifySlack, NotifyDiscord, NotifyWebhook:
+		return true
+	}
+	return false
+}
+
+// Severity ranks notifications
+type Severity string
+
+const (
+	SeverityInfo    Severity = "info"
+	SeverityWarning Severity = "warning"
+	SeverityError   Severity = "error"
+)
+
+// Rank orders severities from info up; empty ranks as info and unknown
+// severities rank as -1
+func (s Severity) Rank() int {
+	switch s {
+	case "", SeverityInfo:
+		return 0
+	case SeverityWarning:
+		return 1
+	case SeverityError:
+		return 2
+	}
+	return -1
+}
+
+// Threshold returns the notifier's failure threshold, or the default
+func (n Notifier) Threshold() int {
+	if n.FailureThreshold > 0 {
+		return n.FailureThreshold
+	}
+	return DefaultFailureThreshold
+}
+
+// HistoryPath returns the configured history journal, or the default
+func (c *Config) HistoryPath() string {
+	if c.HistoryFile != "" {
+		return c.HistoryFile
+	}
+	return DefaultHistoryFile
+}
+
+// StatePath returns the configured state file, or the default
+func (c *Config) StatePath() string {
+	if c.StateFile != "" {
+		return c.StateFile
+	}
+	return DefaultStateFile
+}
+
+// PidPath returns the configured pid file, or by default the path of the
+// config file with .pid appended, so that each config can be watched once
+func (c *Config) PidPath(configPath string) string {
+	if c.PidFile != "" {
+		return c.PidFile
+	}
+	return configPath + ".pid"
+}
+
+// ControlPath returns the configured control socket, or by default the path
+// of the config file with .sock appended, next to its pid file
+func (c *Config) ControlPath(configPath string) string {
+	if c.ControlSocket != "" {
+		return c.ControlSocket
+	}
+	return configPath + ".sock"
+}
+
+// ExpandPath replaces ${VAR} and $VAR with environment variables and a
+// leading ~ with the home directory, so that the same config works on every
+// machine
+func ExpandPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = home + path[1:]
+		}
+	}
+	return os.ExpandEnv(path)
+}
+
+// profileVariable matches {{profile.name}} in rule files and keys
+var profileVariable = regexp.MustCompile(`\{\{profile\.([A-Za-z0-9_-]+)\}\}`)
+
+// ProfileVariables returns the names of the profile variables used by the
+// rule's source and target files and keys
+func (r SyncRule) ProfileVariables() []string {
+	var names []string
+	for _, value := range []string{r.SourceFile, r.SourceKey, r.SourceExpr, r.When, r.TargetFile, r.TargetKey} {
+		for _, match := range profileVariable.FindAllStringSubmatch(value, -1) {
+			if !slices.Contains(names, match[1]) {
+				names = append(names, match[1])
+			}
+		}
+	}
+	return names
+}
+
+// ProfileNames returns the names of the configured profiles, sorted
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SelectProfile replaces {{profile.name}} in every rule's files and keys
+// with the variables of a profile, like ExpandPaths
+func (c *Config) SelectProfile(name string) error {
+	if _, ok := c.Profiles[name]; !ok {
+		return fmt.Errorf("unknown profile %q: use one of %s", name, strings.Join(c.ProfileNames(), ", "))
+	}
+	c.profile = name
+	c.ExpandPaths()
+	return nil
+}
+
+// Profile returns the name of the selected profile, empty if there is none
+func (c *Config) Profile() string {
+	return c.profile
+}
+
+// expand replaces the variables of the selected profile in value, and for a
+// path environment variables and ~ as well
+func (c *Config) expand(value string, path bool) string {
+	if c.profile != "" {
+		value = profileVariable.ReplaceAllStringFunc(value, func(match string) string {
+			if replacement, ok := c.Profiles[c.profile][profileVariable.FindStringSubmatch(match)[1]]; ok {
+				return replacement
+			}
+			return match
+		})
+	}
+	if path {
+		value = ExpandPath(value)
+	}
+	return value
+}
+
+// ExpandPaths expands the log file and every rule's source and target file
+// and template with ExpandPath and the selected profile, and every rule's
+// keys with the selected profile, remembering them as first written for
+// WrittenPaths
+func (c *Config) ExpandPaths() {
+	if c.written == nil {
+		written := *c
+		written.Rules = append([]SyncRule(nil), c.Rules...)
+		c.written = &written
+	}
+
+	c.LogFile = c.expand(c.LogFile, true)
+	for i := range c.Rules {
+		rule := &c.Rules[i]
+		rule.SourceFile = c.expand(rule.SourceFile, true)
+		rule.SourceKey = c.expand(rule.SourceKey, false)
+		rule.SourceExpr = c.expand(rule.SourceExpr, false)
+		rule.When = c.expand(rule.When, false)
+		rule.TargetFile = c.expand(rule.TargetFile, true)
+		rule.TargetKey = c.expand(rule.TargetKey, false)
+		rule.Template = c.expand(rule.Template, true)
+	}
+}
+
+// TargetSchemas returns the schema each target file must match by target
+// file, with both paths expanded as ExpandPaths expands rule paths
+func (c *Config) TargetSchemas() map[string]string {
+	schemas := make(map[string]string, len(c.Schemas))
+	for target, schema := range c.Schemas {
+		schemas[c.expand(target, true)] = c.expand(schema, true)
+	}
+	return schemas
+}
+
+// WrittenPaths returns the config to save: a copy with the paths and keys
+// expanded by ExpandPaths put back as they were written, unless they have
+// been changed since
+func (c *Config) WrittenPaths() *Config {
+	if c.written == nil {
+		return c
+	}
+
+	unexpand := func(written, current string, path bool) string {
+		if c.expand(written, path) == current {
+			return written
+		}
+		return current
+	}
+
+	result := *c
+	result.written = nil
+	result.LogFile = unexpand(c.written.LogFile, c.LogFile, true)
+
+	writtenRules := make(map[string]SyncRule, len(c.written.Rules))
+	for _, rule := range c.written.Rules {
+		writtenRules[rule.ID] = rule
+	}
+	result.Rules = make([]SyncRule, len(c.Rules))
+	for i, rule := range c.Rules {
+		if written, ok := writtenRules[rule.ID]; ok {
+			rule.SourceFile = unexpand(written.SourceFile, rule.SourceFile, true)
+			rule.SourceKey = unexpand(written.SourceKey, rule.SourceKey, false)
+			rule.SourceExpr = unexpand(written.SourceExpr, rule.SourceExpr, false)
+			rule.When = unexpand(written.When, rule.When, false)
+			rule.TargetFile = unexpand(written.TargetFile, rule.TargetFile, true)
+			rule.TargetKey = unexpand(written.TargetKey, rule.TargetKey, false)
+			rule.Template = unexpand(written.Template, rule.Template, true)
+		}
+		result.Rules[i] = rule
+	}
+	return &result
+}
+
+// AddIncluded adds the rules read from an included file, failing if one has
+// the ID of a rule already in the config
+func (c *Config) AddIncluded(file string, rules []SyncRule) error {
+	for _, rule := range rules {
+		for _, existing := range c.Rules {
+			if existing.ID != rule.ID {
+				continue
+			}
+			if from := c.IncludedFrom(rule.ID); from != "" {
+				return fmt.Errorf("duplicate rule ID %s in %s, also in %s", rule.ID, file, from)
+			}
+			return fmt.Errorf("duplicate rule ID %s in %s, also in the config file", rule.ID, file)
+		}
+		if c.included == nil {
+			c.included = make(map[string]string)
+		}
+		c.included[rule.ID] = file
+		c.Rules = append(c.Rules, rule)
+	}
+	return nil
+}
+
+// IncludedFiles returns the included files that rules were read from, sorted
+func (c *Config) IncludedFiles() []string {
+	var files []string
+	for _, file := range c.included {
+		if !slices.Contains(files, file) {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+	return files
+}
+
+// IncludedFrom returns the included file a rule was read from, empty for
+// rules of the config file itself
+func (c *Config) IncludedFrom(ruleID string) string {
+	return c.included[ruleID]
+}
+
+// Conflicts returns the configured conflict policy, overwriting by default
+func (c *Config) Conflicts() ConflictPolicy {
+	if c.ConflictPolicy == "" {
+		return ConflictOverwrite
+	}
+	return c.ConflictPolicy
+}
+
+// BackupConfig controls copies of target files taken before each write. With
+// no Dir set, a single <name>.bak file is kept next to the target; otherwise
+// timestamped versions are kept in Dir, up to MaxVersions per file (0 keeps all).
+type BackupConfig struct {
+	Enabled     bool   `json:"enabled"`
+	Dir         string `json:"dir,omitempty"`
+	MaxVersions int    `json:"max_versions,omitempty"`
 }
 
 func (f FileFormat) String() string {
@@ -55,7 +999,46 @@ func DetectFormat(filepath string) FileFormat {
 		return FormatJSON
 	case len(filepath) >= 4 && filepath[len(filepath)-4:] == ".env":
 		return FormatENV
+	case len(filepath) >= 3 && filepath[len(filepath)-3:] == ".sh":
+		return FormatENV
+	case len(filepath) >= 4 && filepath[len(filepath)-4:] == ".ini":
+		return FormatINI
+	case len(filepath) >= 4 && filepath[len(filepath)-4:] == ".cfg":
+		return FormatINI
+	case len(filepath) >= 11 && filepath[len(filepath)-11:] == ".properties":
+		return FormatProperties
+	case len(filepath) >= 3 && filepath[len(filepath)-3:] == ".tf":
+		return FormatHCL
+	case len(filepath) >= 7 && filepath[len(filepath)-7:] == ".tfvars":
+		return FormatHCL
+	case len(filepath) >= 4 && filepath[len(filepath)-4:] == ".hcl":
+		return FormatHCL
+	case len(filepath) >= 4 && filepath[len(filepath)-4:] == ".xml":
+		return FormatXML
+	case isEnvFileName(filepath):
+		return FormatENV
+	case isDockerfileName(filepath):
+		return FormatDockerfile
 	default:
 		return FormatJSON
 	}
-}
\ No newline at end of file
+}
+
+// isDockerfileName reports whether path names a Dockerfile, such as
+// Dockerfile, Dockerfile.prod, api.Dockerfile or Containerfile
+func isDockerfileName(path string) bool {
+	base := path[strings.LastIndexAny(path, `/\`)+1:]
+	for _, name := range []string{"Dockerfile", "Containerfile"} {
+		if base == name || strings.HasPrefix(base, name+".") || strings.HasSuffix(base, "."+name) {
+			return true
+		}
+	}
+	return strings.HasSuffix(base, ".dockerfile")
+}
+
+// isEnvFileName reports whether path names an env file for one environment,
+// such as .env.local or .env.production
+func isEnvFileName(path string) bool {
+	base := path[strings.LastIndexAny(path, `/\`)+1:]
+	return strings.HasPrefix(base, ".env.")
+}
@@ -1,6 +1,10 @@
 package models
 
 import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -13,6 +17,7 @@ func TestFileFormatString(t *testing.T) {
 		{FormatJSON, "json"},
 		{FormatYAML, "yaml"},
 		{FormatTOML, "toml"},
+		{FormatINI, "ini"},
 	}
 	
 	for _, test := range tests {
@@ -31,6 +36,25 @@ func TestDetectFormat(t *testing.T) {
 		{"config.yaml", FormatYAML},
 		{"config.yml", FormatYAML},
 		{"config.toml", FormatTOML},
+		{"legacy.ini", FormatINI},
+		{"setup.cfg", FormatINI},
+		{"application.properties", FormatProperties},
+		{"variables.tf", FormatHCL},
+		{"prod.tfvars", FormatHCL},
+		{"config.hcl", FormatHCL},
+		{"pom.xml", FormatXML},
+		{"exports.sh", FormatENV},
+		{"app.env", FormatENV},
+		{"/srv/app/.env", FormatENV},
+		{".env.local", FormatENV},
+		{"/srv/app/.env.production", FormatENV},
+		{".env.example.yaml", FormatYAML},
+		{"Dockerfile", FormatDockerfile},
+		{"/srv/app/Dockerfile.prod", FormatDockerfile},
+		{"api.Dockerfile", FormatDockerfile},
+		{"build/api.dockerfile", FormatDockerfile},
+		{"Containerfile", FormatDockerfile},
+		{"docker-compose.yaml", FormatYAML},
 		{"config.txt", FormatJSON}, // default
 		{"config", FormatJSON},     // default
 		{"/path/to/config.yaml", FormatYAML},
@@ -306,4 +330,268 @@ func TestSyncEventWithComplexValues(t *testing.T) {
 	} else {
 		t.Error("Expected NewValue to be a map")
 	}
-}
\ No newline at end of file
+}
+
+func TestConflictSettingsValid(t *testing.T) {
+	for _, policy := range []ConflictPolicy{"", ConflictOverwrite, ConflictSkip, ConflictPrompt} {
+		if !policy.Valid() {
+			t.Errorf("ConflictPolicy(%q).Valid() = false, expected true", policy)
+		}
+	}
+	if ConflictPolicy("sometimes").Valid() {
+		t.Error("Unknown conflict policy reported as valid")
+	}
+
+	for _, strategy := range []OnConflict{"", SourceWins, TargetWins, NewestWins, Manual} {
+		if !strategy.Valid() {
+			t.Errorf("OnConflict(%q).Valid() = false, expected true", strategy)
+		}
+	}
+	if OnConflict("loudest-wins").Valid() {
+		t.Error("Unknown conflict strategy reported as valid")
+	}
+
+	if (&Config{}).Conflicts() != ConflictOverwrite {
+		t.Error("Expected overwrite to be the default conflict policy")
+	}
+}
+
+func TestSensitiveRules(t *testing.T) {
+	tests := []struct {
+		rule     SyncRule
+		expected bool
+	}{
+		{SyncRule{SourceKey: "database.host", TargetKey: "DB_HOST"}, false},
+		{SyncRule{SourceKey: "database.host", TargetKey: "DB_HOST", Sensitive: true}, true},
+		{SyncRule{SourceKey: "database.password", TargetKey: "DB_PASS"}, true},
+		{SyncRule{SourceKey: "api", TargetKey: "API_TOKEN"}, true},
+		{SyncRule{SourceKey: "clientSecret", TargetKey: "client"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.rule.IsSensitive(); got != tt.expected {
+			t.Errorf("IsSensitive(%s -> %s) = %v, expected %v", tt.rule.SourceKey, tt.rule.TargetKey, got, tt.expected)
+		}
+	}
+
+	event := SyncEvent{RuleID: "db", OldValue: nil, NewValue: "hunter2", Sensitive: true}
+	redacted := event.Redacted()
+	if redacted.OldValue != nil || redacted.NewValue != RedactedValue {
+		t.Errorf("Redacted() = %+v, expected only the new value masked", redacted)
+	}
+	if event.NewValue != "hunter2" {
+		t.Error("Redacted() modified the original event")
+	}
+
+	plain := SyncEvent{RuleID: "db", NewValue: "localhost"}
+	if plain.Redacted().NewValue != "localhost" {
+		t.Error("Redacted() masked an event that is not sensitive")
+	}
+}
+
+func TestExpandGlobRule(t *testing.T) {
+	dir := t.TempDir()
+	for _, service := range []string{"billing", "auth"} {
+		if err := os.MkdirAll(filepath.Join(dir, service), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, service, "config.yaml"), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rule := SyncRule{
+		ID:         "hosts",
+		SourceFile: filepath.Join(dir, "*", "config.yaml"),
+		SourceKey:  "host",
+		TargetFile: "{{dir}}/generated.env",
+		TargetKey:  "{{parent}}_{{name}}_HOST",
+	}
+	if !rule.IsGlob() {
+		t.Fatal("IsGlob() = false for a pattern")
+	}
+
+	rules, err := rule.Expand()
+	if err != nil {
+		t.Fatalf("Expand() error = %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Expand() returned %d rules, want 2", len(rules))
+	}
+	if rules[0].ID != "hosts" || rules[0].SourceFile != filepath.Join(dir, "auth", "config.yaml") {
+		t.Errorf("First rule = %+v", rules[0])
+	}
+	if rules[0].TargetFile != filepath.Join(dir, "auth")+"/generated.env" || rules[0].TargetKey != "auth_config_HOST" {
+		t.Errorf("Target of first rule = %s %s", rules[0].TargetFile, rules[0].TargetKey)
+	}
+
+	plain := SyncRule{ID: "one", SourceFile: "config.yaml"}
+	if plain.IsGlob() || (SyncRule{SourceFile: "http://example.com/app.json?v=*"}).IsGlob() {
+		t.Error("IsGlob() = true for a file or backend reference")
+	}
+	if rules := ExpandRules([]SyncRule{plain}); len(rules) != 1 || rules[0].SourceFile != "config.yaml" {
+		t.Errorf("ExpandRules() changed a plain rule: %+v", rules)
+	}
+}
+
+func TestExpandMultiKeyRule(t *testing.T) {
+	rule := SyncRule{
+		ID:         "database",
+		SourceFile: "config.yaml",
+		TargetFile: "app.env",
+		Mappings: []KeyMapping{
+			{SourceKey: "database.host", TargetKey: "DB_HOST"},
+			{SourceKey: "database.password", TargetKey: "DB_PASS"},
+		},
+	}
+	if !rule.IsSensitive() {
+		t.Error("IsSensitive() = false for a rule with a mapping of a password")
+	}
+
+	rules, err := rule.Expand()
+	if err != nil {
+		t.Fatalf("Expand() error = %v", err)
+	}
+	if len(rules) != 2 {
+		t.Fatalf("Expand() returned %d rules, want 2", len(rules))
+	}
+	for i, mapping := range rule.Mappings {
+		got := rules[i]
+		if got.ID != "database" || got.SourceKey != mapping.SourceKey || got.TargetKey != mapping.TargetKey || got.Mappings != nil {
+			t.Errorf("Rule for mapping %d = %+v", i, got)
+		}
+		if !got.IsSensitive() {
+			t.Errorf("Rule for mapping %d is not sensitive like the rule", i)
+		}
+	}
+
+	dir := t.TempDir()
+	for _, name := range []string{"auth.yaml", "billing.yaml"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rule.SourceFile = filepath.Join(dir, "*.yaml")
+	rule.Mappings = []KeyMapping{{SourceKey: "host", TargetKey: "{{name}}_HOST"}, {SourceKey: "port", TargetKey: "{{name}}_PORT"}}
+	rules = ExpandRules([]SyncRule{rule})
+	var targetKeys []string
+	for _, r := range rules {
+		targetKeys = append(targetKeys, r.TargetKey)
+	}
+	if want := []string{"auth_HOST", "auth_PORT", "billing_HOST", "billing_PORT"}; !reflect.DeepEqual(targetKeys, want) {
+		t.Errorf("ExpandRules() target keys = %v, want %v", targetKeys, want)
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	var defaults *RetryPolicy
+	if defaults.Attempts() != DefaultRetryAttempts || defaults.Backoff(1) != DefaultInitialBackoff {
+		t.Errorf("nil policy = %d attempts, %s backoff; want the defaults", defaults.Attempts(), defaults.Backoff(1))
+	}
+
+	policy := &RetryPolicy{MaxAttempts: 5, InitialBackoff: Duration(100 * time.Millisecond), MaxBackoff: Duration(time.Second)}
+	expected := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	for i, want := range expected {
+		if got := policy.Backoff(i + 1); got != want {
+			t.Errorf("Backoff(%d) = %s, want %s", i+1, got, want)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 20; i++ {
+		if got := policy.Backoff(2); got < 100*time.Millisecond || got > 300*time.Millisecond {
+			t.Fatalf("Backoff(2) with jitter 0.5 = %s, want within 100ms-300ms", got)
+		}
+	}
+}
+
+func TestDurationJSON(t *testing.T) {
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{"rules": [], "poll_interval": "45s"}`), &cfg); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if cfg.PollInterval.Or(DefaultPollInterval) != 45*time.Second {
+		t.Errorf("PollInterval = %v, expected 45s", time.Duration(cfg.PollInterval))
+	}
+	if (Duration(0)).Or(DefaultPollInterval) != DefaultPollInterval {
+		t.Error("Unset duration should fall back to the default")
+	}
+
+	encoded, _ := json.Marshal(Duration(5 * time.Minute))
+	if string(encoded) != `"5m0s"` {
+		t.Errorf("Marshal() = %s, expected \"5m0s\"", encoded)
+	}
+	if err := json.Unmarshal([]byte(`{"poll_interval": 30}`), &cfg); err == nil {
+		t.Error("Unmarshal() expected error for a numeric duration")
+	}
+}
+
+func TestExpandPaths(t *testing.T) {
+	t.Setenv("HOME", "/home/dev")
+	t.Setenv("VAR_SYNC_ENV", "staging")
+
+	cfg := &Config{
+		LogFile: "~/logs/var-sync.log",
+		Rules: []SyncRule{
+			{ID: "r1", SourceFile: "${HOME}/config/$VAR_SYNC_ENV.yaml", TargetFile: "~/app/{{name}}.env"},
+			{ID: "r2", SourceFile: "vault://secret/${VAR_SYNC_ENV}/db", TargetFile: "/etc/app.env"},
+		},
+	}
+	cfg.ExpandPaths()
+
+	if cfg.LogFile != "/home/dev/logs/var-sync.log" {
+		t.Errorf("LogFile = %s", cfg.LogFile)
+	}
+	if cfg.Rules[0].SourceFile != "/home/dev/config/staging.yaml" || cfg.Rules[0].TargetFile != "/home/dev/app/{{name}}.env" {
+		t.Errorf("Rule r1 paths = %s, %s", cfg.Rules[0].SourceFile, cfg.Rules[0].TargetFile)
+	}
+	if cfg.Rules[1].SourceFile != "vault://secret/staging/db" {
+		t.Errorf("Rule r2 source = %s", cfg.Rules[1].SourceFile)
+	}
+
+	// Unchanged paths are saved as written, changed ones as they are now
+	cfg.Rules[1].TargetFile = "/etc/other.env"
+	cfg.Rules = append(cfg.Rules, SyncRule{ID: "r3", SourceFile: "$HOME/new.yaml"})
+	written := cfg.WrittenPaths()
+	if written.LogFile != "~/logs/var-sync.log" || written.Rules[0].SourceFile != "${HOME}/config/$VAR_SYNC_ENV.yaml" || written.Rules[0].TargetFile != "~/app/{{name}}.env" {
+		t.Errorf("WrittenPaths() = %s, %+v", written.LogFile, written.Rules[0])
+	}
+	if written.Rules[1].SourceFile != "vault://secret/${VAR_SYNC_ENV}/db" || written.Rules[1].TargetFile != "/etc/other.env" {
+		t.Errorf("WrittenPaths() rule r2 = %+v", written.Rules[1])
+	}
+	if written.Rules[2].SourceFile != "$HOME/new.yaml" {
+		t.Errorf("WrittenPaths() rule r3 = %+v", written.Rules[2])
+	}
+	if cfg.Rules[0].SourceFile != "/home/dev/config/staging.yaml" {
+		t.Error("WrittenPaths() should not change the config")
+	}
+}
+
+func TestSelectProfile(t *testing.T) {
+	cfg := &Config{
+		Profiles: Profiles{
+			"dev":  {"env": "dev", "db_key": "database.host"},
+			"prod": {"env": "prod", "db_key": "primary.host"},
+		},
+		Rules: []SyncRule{
+			{ID: "r1", SourceFile: "config/{{profile.env}}.yaml", SourceKey: "{{profile.db_key}}", TargetFile: "app.env", TargetKey: "DB_HOST"},
+		},
+	}
+
+	if names := cfg.Rules[0].ProfileVariables(); len(names) != 2 || names[0] != "env" || names[1] != "db_key" {
+		t.Errorf("ProfileVariables() = %v", names)
+	}
+	if err := cfg.SelectProfile("staging"); err == nil {
+		t.Error("SelectProfile() should fail for an unknown profile")
+	}
+	if err := cfg.SelectProfile("prod"); err != nil {
+		t.Fatalf("SelectProfile() returned error: %v", err)
+	}
+
+	if cfg.Profile() != "prod" || cfg.Rules[0].SourceFile != "config/prod.yaml" || cfg.Rules[0].SourceKey != "primary.host" {
+		t.Errorf("Rule after selecting prod = %+v", cfg.Rules[0])
+	}
+	written := cfg.WrittenPaths()
+	if written.Rules[0].SourceFile != "config/{{profile.env}}.yaml" || written.Rules[0].SourceKey != "{{profile.db_key}}" {
+		t.Errorf("WrittenPaths() rule = %+v", written.Rules[0])
+	}
+}
@@ -1,14 +1,26 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"var-sync/internal/cli"
 	"var-sync/internal/config"
+	"var-sync/internal/control"
+	"var-sync/internal/history"
 	"var-sync/internal/logger"
 	"var-sync/internal/parser"
+	"var-sync/internal/state"
+	"var-sync/internal/sync"
+	"var-sync/internal/watcher"
 	"var-sync/pkg/models"
 )
 
@@ -521,7 +533,7 @@ enabled = false`
 	}{
 		{serviceConfigFile, "database.host", "production-db.example.com"},
 		{serviceConfigFile, "database.ssl", true},
-		{serviceConfigFile, "api.timeout", float64(30)}, // JSON loads numbers as float64
+		{serviceConfigFile, "api.timeout", int64(30)},
 		{dockerConfigFile, "monitoring.enabled", true},
 	}
 	
@@ -543,4 +555,3608 @@ enabled = false`
 	}
 	
 	log.Info("All verifications passed - real-world scenario test completed")
-}
\ No newline at end of file
+}
+
+// TestIntegrationDryRun tests that a dry run reports changes without writing them
+func TestIntegrationDryRun(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	targetContent := "# app settings\nDB_HOST=localhost\nDB_PORT=5432\n"
+	if err := os.WriteFile(targetFile, []byte(targetContent), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", Name: "Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "port", Name: "Port", SourceFile: sourceFile, SourceKey: "database.port", TargetFile: targetFile, TargetKey: "DB_PORT", Enabled: true},
+			{ID: "missing", Name: "Missing", SourceFile: sourceFile, SourceKey: "database.user", TargetFile: filepath.Join(tempDir, "other.env"), TargetKey: "DB_USER", Enabled: true},
+		},
+	}
+
+	syncer := sync.New(cfg, logger.New())
+
+	changes, err := syncer.Plan()
+	if err != nil {
+		t.Fatalf("Plan() returned error: %v", err)
+	}
+	if len(changes) != 2 {
+		t.Fatalf("Expected 2 target files in plan, got %d", len(changes))
+	}
+	if !changes[0].Changed() {
+		t.Error("Expected target file to be reported as changed")
+	}
+	if !changes[1].Failed() {
+		t.Error("Expected rule with missing source key to be reported as failed")
+	}
+
+	var out strings.Builder
+	if err := syncer.DryRun(&out); err != nil {
+		t.Fatalf("DryRun() returned error: %v", err)
+	}
+
+	output := out.String()
+	if !strings.Contains(output, "-DB_HOST=localhost") || !strings.Contains(output, "+DB_HOST=db.internal") {
+		t.Errorf("Dry run output missing expected diff lines:\n%s", output)
+	}
+	if strings.Contains(output, "DB_PORT=5432\n+") {
+		t.Errorf("Dry run output should not report unchanged keys:\n%s", output)
+	}
+	if !strings.Contains(output, "# rule Missing (missing)") {
+		t.Errorf("Dry run output missing rule error:\n%s", output)
+	}
+
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if string(content) != targetContent {
+		t.Errorf("Dry run modified the target file:\n%s", content)
+	}
+}
+
+// TestIntegrationDryRunSensitive tests that a dry run masks the values of
+// sensitive rules, in text and as JSON, and shows the others
+func TestIntegrationDryRunSensitive(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n  password: hunter2\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\nDB_PASSWORD=old-secret\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", Name: "Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "password", Name: "Password", SourceFile: sourceFile, SourceKey: "database.password", TargetFile: targetFile, TargetKey: "DB_PASSWORD", Enabled: true, Sensitive: true},
+		},
+	}
+	syncer := sync.New(cfg, logger.New())
+
+	var out strings.Builder
+	if err := syncer.DryRun(&out); err != nil {
+		t.Fatalf("DryRun() returned error: %v", err)
+	}
+	output := out.String()
+	for _, want := range []string{"-DB_HOST=localhost", "+DB_HOST=db.internal", "-DB_PASSWORD=********", "+DB_PASSWORD=********"} {
+		if !strings.Contains(output, want) {
+			t.Errorf("Dry run output missing %s:\n%s", want, output)
+		}
+	}
+
+	out.Reset()
+	if err := syncer.DryRunJSON(&out); err != nil {
+		t.Fatalf("DryRunJSON() returned error: %v", err)
+	}
+	var report struct {
+		Files []struct {
+			Diff  string `json:"diff"`
+			Rules []struct {
+				RuleID    string `json:"rule_id"`
+				OldValue  any    `json:"old_value"`
+				NewValue  any    `json:"new_value"`
+				Sensitive bool   `json:"sensitive"`
+			} `json:"rules"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(out.String()), &report); err != nil {
+		t.Fatalf("DryRunJSON() printed invalid JSON: %v\n%s", err, out.String())
+	}
+	if len(report.Files) != 1 || len(report.Files[0].Rules) != 2 {
+		t.Fatalf("DryRunJSON() = %s, want one file with two rules", out.String())
+	}
+	for _, rule := range report.Files[0].Rules {
+		if rule.RuleID == "password" && (!rule.Sensitive || rule.OldValue != "********" || rule.NewValue != "********") {
+			t.Errorf("Sensitive rule planned as %+v, want its values masked", rule)
+		}
+		if rule.RuleID == "host" && rule.NewValue != "db.internal" {
+			t.Errorf("Rule host planned as %+v, want its value shown", rule)
+		}
+	}
+	if !strings.Contains(report.Files[0].Diff, "+DB_HOST=db.internal") {
+		t.Errorf("DryRunJSON() diff should show the other keys:\n%s", report.Files[0].Diff)
+	}
+
+	for _, secret := range []string{"hunter2", "old-secret"} {
+		if strings.Contains(output, secret) || strings.Contains(out.String(), secret) {
+			t.Errorf("Dry run output shows the sensitive value %s:\n%s\n%s", secret, output, out.String())
+		}
+	}
+}
+
+// TestIntegrationBackupAndRestore tests that the watcher backs up targets before writing and restore rolls them back
+func TestIntegrationBackupAndRestore(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	backupDir := filepath.Join(tempDir, "backups")
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	targetContent := "# app settings\nDB_HOST=localhost\n"
+	if err := os.WriteFile(targetFile, []byte(targetContent), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", Name: "Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+		},
+		Backup: &models.BackupConfig{Enabled: true, Dir: backupDir},
+	}
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	fw.SetBackupConfig(cfg.Backup)
+	if err := fw.SetRules(cfg.Rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+
+	waitForFileContent(t, targetFile, "DB_HOST=db.internal")
+
+	var out strings.Builder
+	ctx := &cli.Context{Config: cfg, Logger: logger.New(), Stdout: &out}
+	if err := cli.Run(ctx, []string{"restore"}); err != nil {
+		t.Fatalf("restore returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "Restored "+targetFile) {
+		t.Errorf("Unexpected restore output: %s", out.String())
+	}
+
+	content, _ := os.ReadFile(targetFile)
+	if string(content) != targetContent {
+		t.Errorf("Restore did not roll back the target:\n%s", content)
+	}
+}
+
+// TestIntegrationHistory tests that sync events are journaled and shown by the history command
+func TestIntegrationHistory(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", Name: "Database Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+	}
+
+	journal, err := history.Open(cfg.HistoryPath())
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+	defer journal.Close()
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	recorded := make(chan models.SyncEvent, 10)
+	fw.OnEvent(func(event models.SyncEvent) {
+		journal.Append(event)
+		recorded <- event
+	})
+	if err := fw.SetRules(cfg.Rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+
+	var event models.SyncEvent
+	select {
+	case event = <-recorded:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for sync event")
+	}
+	if event.ID == "" || event.TargetFile != targetFile || event.TargetKey != "DB_HOST" {
+		t.Errorf("Event missing identifying fields: %+v", event)
+	}
+
+	var out strings.Builder
+	ctx := &cli.Context{Config: cfg, Logger: logger.New(), Stdout: &out}
+	if err := cli.Run(ctx, []string{"history", "-rule", "host", "-since", "1h"}); err != nil {
+		t.Fatalf("history returned error: %v", err)
+	}
+	output := out.String()
+	if !strings.Contains(output, "Database Host") || !strings.Contains(output, "localhost -> db.internal") {
+		t.Errorf("History output missing event:\n%s", output)
+	}
+	if !strings.Contains(output, event.ID[:8]) {
+		t.Errorf("History output missing event ID %s:\n%s", event.ID[:8], output)
+	}
+}
+
+// TestIntegrationUndo tests that undo restores a journaled old value and records the revert
+func TestIntegrationUndo(t *testing.T) {
+	tempDir := t.TempDir()
+	targetFile := filepath.Join(tempDir, "target.yaml")
+
+	if err := os.WriteFile(targetFile, []byte("# server settings\nserver:\n  port: 9090 # public\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "port", Name: "Port", TargetFile: targetFile, TargetKey: "server.port", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	journal, err := history.Open(cfg.HistoryPath())
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+	journal.Append(models.SyncEvent{ID: "11111111-aaaa", RuleID: "port", TargetFile: targetFile, TargetKey: "server.port", Timestamp: time.Now(), OldValue: 8080, NewValue: 9090, Success: true})
+	journal.Append(models.SyncEvent{ID: "22222222-bbbb", RuleID: "port", TargetFile: targetFile, TargetKey: "server.port", Timestamp: time.Now(), Success: false, Error: "boom"})
+	journal.Close()
+
+	var out strings.Builder
+	ctx := &cli.Context{Config: cfg, Logger: logger.New(), Stdout: &out}
+	if err := cli.Run(ctx, []string{"undo", "-last"}); err != nil {
+		t.Fatalf("undo returned error: %v", err)
+	}
+
+	content, _ := os.ReadFile(targetFile)
+	if string(content) != "# server settings\nserver:\n  port: 8080 # public\n" {
+		t.Errorf("Undo did not restore old value surgically:\n%s", content)
+	}
+
+	events, err := history.Read(cfg.HistoryPath(), history.Filter{})
+	if err != nil {
+		t.Fatalf("Failed to read history: %v", err)
+	}
+	if len(events) != 3 || events[2].UndoOf != "11111111-aaaa" || !events[2].Success {
+		t.Fatalf("Undo not recorded in history: %+v", events)
+	}
+
+	if err := cli.Run(ctx, []string{"undo", "-last"}); err == nil {
+		t.Error("Expected error when every event has been undone")
+	}
+	if err := cli.Run(ctx, []string{"undo", "2222"}); err == nil {
+		t.Error("Expected error when undoing a failed event")
+	}
+
+	// Undoing the undo re-applies the synced value
+	if err := cli.Run(ctx, []string{"undo", events[2].ID[:8]}); err != nil {
+		t.Fatalf("undo of undo returned error: %v", err)
+	}
+	content, _ = os.ReadFile(targetFile)
+	if !strings.Contains(string(content), "port: 9090 # public") {
+		t.Errorf("Undo of undo did not re-apply value:\n%s", content)
+	}
+}
+
+// TestIntegrationSensitiveRule tests that values of sensitive rules are synced but masked in the history
+func TestIntegrationSensitiveRule(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  password: old-secret\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_PASS=old-secret\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "pass", Name: "Database Password", SourceFile: sourceFile, SourceKey: "database.password", TargetFile: targetFile, TargetKey: "DB_PASS", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	journal, err := history.Open(cfg.HistoryPath())
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+	defer journal.Close()
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	recorded := make(chan models.SyncEvent, 10)
+	fw.OnEvent(func(event models.SyncEvent) {
+		journal.Append(event.Redacted())
+		recorded <- event
+	})
+	if err := fw.SetRules(cfg.Rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  password: new-secret\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+
+	select {
+	case event := <-recorded:
+		if !event.Sensitive || event.NewValue != "new-secret" {
+			t.Errorf("Expected a sensitive event carrying the real value, got %+v", event)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for sync event")
+	}
+	waitForFileContent(t, targetFile, "DB_PASS=new-secret")
+
+	content, _ := os.ReadFile(cfg.HistoryPath())
+	if strings.Contains(string(content), "secret") {
+		t.Errorf("History journal contains a sensitive value:\n%s", content)
+	}
+
+	var out strings.Builder
+	ctx := &cli.Context{Config: cfg, Logger: logger.New(), Stdout: &out}
+	if err := cli.Run(ctx, []string{"history"}); err != nil {
+		t.Fatalf("history returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "******** -> ********") {
+		t.Errorf("History output does not mask the values:\n%s", out.String())
+	}
+
+	if err := cli.Run(ctx, []string{"undo", "-last"}); err == nil {
+		t.Error("Expected error when undoing a sensitive sync whose old value was not recorded")
+	}
+}
+
+// TestIntegrationConflict tests that a hand-edited target key is held back and can be resolved
+func TestIntegrationConflict(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+
+	if err := os.WriteFile(sourceFile, []byte("server:\n  port: 8080\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("PORT=80\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "port", Name: "Port", SourceFile: sourceFile, SourceKey: "server.port", TargetFile: targetFile, TargetKey: "PORT", Enabled: true},
+		},
+		HistoryFile:    filepath.Join(tempDir, "history.jsonl"),
+		StateFile:      filepath.Join(tempDir, "state.json"),
+		ConflictPolicy: models.ConflictPrompt,
+	}
+
+	store, err := state.Open(cfg.StatePath())
+	if err != nil {
+		t.Fatalf("Failed to open state: %v", err)
+	}
+	journal, err := history.Open(cfg.HistoryPath())
+	if err != nil {
+		t.Fatalf("Failed to open history: %v", err)
+	}
+	defer journal.Close()
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	recorded := make(chan models.SyncEvent, 10)
+	fw.SetState(store)
+	fw.SetConflictPolicy(cfg.Conflicts())
+	fw.OnEvent(func(event models.SyncEvent) {
+		journal.Append(event)
+		recorded <- event
+	})
+	if err := fw.SetRules(cfg.Rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	waitForEvent := func() models.SyncEvent {
+		t.Helper()
+		select {
+		case event := <-recorded:
+			return event
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timed out waiting for sync event")
+		}
+		return models.SyncEvent{}
+	}
+
+	// The first sync has no recorded state, so it is never a conflict
+	if err := os.WriteFile(sourceFile, []byte("server:\n  port: 8081\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	if event := waitForEvent(); !event.Success || event.Conflict {
+		t.Fatalf("First sync should succeed without conflict: %+v", event)
+	}
+
+	// A hand edit followed by a source change is held back
+	if err := os.WriteFile(targetFile, []byte("PORT=1234\n"), 0644); err != nil {
+		t.Fatalf("Failed to edit target file: %v", err)
+	}
+	time.Sleep(600 * time.Millisecond)
+	if err := os.WriteFile(sourceFile, []byte("server:\n  port: 9090\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	conflict := waitForEvent()
+	if conflict.Success || !conflict.Conflict {
+		t.Fatalf("Expected held back conflict event: %+v", conflict)
+	}
+	if content, _ := os.ReadFile(targetFile); string(content) != "PORT=1234\n" {
+		t.Errorf("Conflicting sync overwrote hand edit:\n%s", content)
+	}
+
+	events, _ := history.Read(cfg.HistoryPath(), history.Filter{})
+	pending := sync.PendingConflicts(events)
+	if len(pending) != 1 || pending[0].ID != conflict.ID {
+		t.Fatalf("PendingConflicts() = %+v, expected the held back event", pending)
+	}
+
+	if _, err := sync.New(cfg, logger.New()).ResolveConflict(pending[0], true); err != nil {
+		t.Fatalf("ResolveConflict() error = %v", err)
+	}
+	if content, _ := os.ReadFile(targetFile); string(content) != "PORT=9090\n" {
+		t.Errorf("Resolving with overwrite did not write synced value:\n%s", content)
+	}
+	events, _ = history.Read(cfg.HistoryPath(), history.Filter{})
+	if pending := sync.PendingConflicts(events); len(pending) != 0 {
+		t.Errorf("Conflict still pending after resolution: %+v", pending)
+	}
+}
+
+// TestIntegrationConflictStrategies tests that each rule's on_conflict strategy overrides the global policy
+func TestIntegrationConflictStrategies(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+
+	if err := os.WriteFile(sourceFile, []byte("host: a\nport: 1\nname: app\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("HOST=edited\nPORT=edited\nNAME=edited\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", SourceFile: sourceFile, SourceKey: "host", TargetFile: targetFile, TargetKey: "HOST", OnConflict: models.TargetWins, Enabled: true},
+			{ID: "port", SourceFile: sourceFile, SourceKey: "port", TargetFile: targetFile, TargetKey: "PORT", OnConflict: models.SourceWins, Enabled: true},
+			{ID: "name", SourceFile: sourceFile, SourceKey: "name", TargetFile: targetFile, TargetKey: "NAME", OnConflict: models.NewestWins, Enabled: true},
+		},
+		StateFile:      filepath.Join(tempDir, "state.json"),
+		ConflictPolicy: models.ConflictPrompt,
+	}
+
+	// Pretend var-sync wrote different values than the target now holds
+	store, err := state.Open(cfg.StatePath())
+	if err != nil {
+		t.Fatalf("Failed to open state: %v", err)
+	}
+	if err := store.Record(targetFile, map[string]any{"HOST": "a", "PORT": "1", "NAME": "app"}); err != nil {
+		t.Fatalf("Failed to record state: %v", err)
+	}
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	recorded := make(chan models.SyncEvent, 10)
+	fw.SetState(store)
+	fw.SetConflictPolicy(cfg.Conflicts())
+	fw.OnEvent(func(event models.SyncEvent) {
+		recorded <- event
+	})
+	if err := fw.SetRules(cfg.Rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("host: b\nport: 2\nname: api\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+
+	events := make(map[string]models.SyncEvent)
+	for len(events) < 3 {
+		select {
+		case event := <-recorded:
+			events[event.RuleID] = event
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Timed out waiting for sync events, got %d", len(events))
+		}
+	}
+
+	for ruleID, event := range events {
+		if !event.Conflict {
+			t.Errorf("Rule %s event not marked as a conflict: %+v", ruleID, event)
+		}
+	}
+	if events["host"].Success || !events["port"].Success || !events["name"].Success {
+		t.Errorf("Unexpected conflict outcomes: %+v", events)
+	}
+
+	content, _ := os.ReadFile(targetFile)
+	if string(content) != "HOST=edited\nPORT=2\nNAME=api\n" {
+		t.Errorf("Unexpected target content:\n%s", content)
+	}
+}
+
+// TestIntegrationEnvBackend tests syncing between files and the process environment
+func TestIntegrationEnvBackend(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	exportsFile := filepath.Join(tempDir, "exports.sh")
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(exportsFile, []byte("#!/bin/sh\nexport API_TOKEN=old\n"), 0644); err != nil {
+		t.Fatalf("Failed to create exports file: %v", err)
+	}
+	t.Setenv("VARSYNC_IT_DB_HOST", "")
+	t.Setenv("VARSYNC_IT_API_TOKEN", "initial")
+
+	rules := []models.SyncRule{
+		{ID: "to-env", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: "env://VARSYNC_IT_DB_HOST", Enabled: true},
+		{ID: "from-env", SourceFile: "env://VARSYNC_IT_API_TOKEN", TargetFile: exportsFile, TargetKey: "API_TOKEN", Enabled: true},
+	}
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	fw.SetPollInterval(50 * time.Millisecond)
+	if err := fw.SetRules(rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// File to environment
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	deadline := time.Now().Add(3 * time.Second)
+	for os.Getenv("VARSYNC_IT_DB_HOST") != "db.internal" && time.Now().Before(deadline) {
+		time.Sleep(20 * time.Millisecond)
+	}
+	if got := os.Getenv("VARSYNC_IT_DB_HOST"); got != "db.internal" {
+		t.Errorf("Environment variable = %q, expected db.internal", got)
+	}
+
+	// Environment to export script, picked up by polling
+	os.Setenv("VARSYNC_IT_API_TOKEN", "rotated")
+	waitForFileContent(t, exportsFile, "export API_TOKEN=rotated")
+}
+
+// waitForFileContent waits for a file to contain substr, failing the test on timeout
+func waitForFileContent(t *testing.T, path, substr string) {
+	t.Helper()
+	deadline := time.Now().Add(3 * time.Second)
+	for time.Now().Before(deadline) {
+		content, _ := os.ReadFile(path)
+		if strings.Contains(string(content), substr) {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	content, _ := os.ReadFile(path)
+	t.Fatalf("Timed out waiting for %s to contain %q:\n%s", path, substr, content)
+}
+
+func TestIntegrationScheduleSkip(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	openTarget := filepath.Join(tempDir, "open.env")
+	closedTarget := filepath.Join(tempDir, "closed.env")
+
+	if err := os.WriteFile(sourceFile, []byte("host: old\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	for _, target := range []string{openTarget, closedTarget} {
+		if err := os.WriteFile(target, []byte("HOST=old\n"), 0644); err != nil {
+			t.Fatalf("Failed to create target file: %v", err)
+		}
+	}
+
+	rules := []models.SyncRule{
+		{ID: "open", SourceFile: sourceFile, SourceKey: "host", TargetFile: openTarget, TargetKey: "HOST", Enabled: true},
+		{ID: "closed", SourceFile: sourceFile, SourceKey: "host", TargetFile: closedTarget, TargetKey: "HOST", Enabled: true,
+			Schedule: &models.Schedule{Exclude: []string{"00:00-24:00"}, Outside: models.ScheduleSkip}},
+	}
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	recorded := make(chan models.SyncEvent, 10)
+	fw.OnEvent(func(event models.SyncEvent) {
+		recorded <- event
+	})
+	if err := fw.SetRules(rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("host: new\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	waitForFileContent(t, openTarget, "HOST=new")
+	time.Sleep(500 * time.Millisecond)
+
+	for len(recorded) > 0 {
+		if event := <-recorded; event.RuleID == "closed" {
+			t.Errorf("Rule outside its schedule synced: %+v", event)
+		}
+	}
+	content, _ := os.ReadFile(closedTarget)
+	if !strings.Contains(string(content), "HOST=old") {
+		t.Errorf("Target of the rule outside its schedule changed:\n%s", content)
+	}
+}
+
+func TestIntegrationReconcile(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+
+	if err := os.WriteFile(sourceFile, []byte("host: db\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("HOST=db\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	rules := []models.SyncRule{
+		{ID: "host", SourceFile: sourceFile, SourceKey: "host", TargetFile: targetFile, TargetKey: "HOST", Enabled: true},
+	}
+	if err := fw.SetRules(rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if drifted := fw.Reconcile(); drifted != 0 {
+		t.Errorf("Reconcile() = %d for a target in sync, want 0", drifted)
+	}
+
+	// A change no watch event reported is fixed by the next reconcile
+	if err := os.WriteFile(targetFile, []byte("HOST=stale\n"), 0644); err != nil {
+		t.Fatalf("Failed to update target file: %v", err)
+	}
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if drifted := fw.ReconcileContext(cancelled); drifted != 0 {
+		t.Errorf("ReconcileContext() = %d for a cancelled context, want 0", drifted)
+	}
+	fw.SetReconcileInterval(200 * time.Millisecond)
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	waitForFileContent(t, targetFile, "HOST=db")
+}
+
+func TestIntegrationPollWatchMode(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+
+	if err := os.WriteFile(sourceFile, []byte("host: old\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("HOST=old\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	fw.SetPollInterval(100 * time.Millisecond)
+	fw.SetWatchMode(models.WatchPoll)
+	rules := []models.SyncRule{
+		{ID: "host", SourceFile: sourceFile, SourceKey: "host", TargetFile: targetFile, TargetKey: "HOST", Enabled: true},
+	}
+	if err := fw.SetRules(rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if status := fw.Status(); status.WatchedFiles != 1 {
+		t.Errorf("WatchedFiles = %d, want the polled source counted", status.WatchedFiles)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("host: new\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	waitForFileContent(t, targetFile, "HOST=new")
+}
+
+func TestIntegrationDriftReapply(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceDir := filepath.Join(tempDir, "source")
+	targetDir := filepath.Join(tempDir, "target")
+	for _, dir := range []string{sourceDir, targetDir} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+	}
+	sourceFile := filepath.Join(sourceDir, "source.yaml")
+	targetFile := filepath.Join(targetDir, "target.env")
+
+	if err := os.WriteFile(sourceFile, []byte("host: old\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("HOST=old\nPORT=5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	store, err := state.Open(filepath.Join(tempDir, "state.json"))
+	if err != nil {
+		t.Fatalf("Failed to open state: %v", err)
+	}
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	recorded := make(chan models.SyncEvent, 10)
+	fw.OnEvent(func(event models.SyncEvent) {
+		recorded <- event
+	})
+	fw.SetState(store)
+	fw.SetDrift(&models.DriftConfig{Enabled: true, Reapply: true})
+	rules := []models.SyncRule{
+		{ID: "host", SourceFile: sourceFile, SourceKey: "host", TargetFile: targetFile, TargetKey: "HOST", Enabled: true},
+	}
+	if err := fw.SetRules(rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("host: new\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	waitForFileContent(t, targetFile, "HOST=new")
+	<-recorded
+	time.Sleep(600 * time.Millisecond) // Past the debounce of var-sync's own write
+
+	// An edit to a key var-sync does not write is not drift
+	if err := os.WriteFile(targetFile, []byte("HOST=new\nPORT=6543\n"), 0644); err != nil {
+		t.Fatalf("Failed to edit target file: %v", err)
+	}
+	time.Sleep(600 * time.Millisecond)
+	if err := os.WriteFile(targetFile, []byte("HOST=hand-edited\nPORT=6543\n"), 0644); err != nil {
+		t.Fatalf("Failed to edit target file: %v", err)
+	}
+
+	select {
+	case event := <-recorded:
+		if !event.Drift || !event.Success || event.OldValue != "hand-edited" || event.NewValue != "new" {
+			t.Errorf("Expected a reapplied drift event, got %+v", event)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for drift event")
+	}
+	waitForFileContent(t, targetFile, "HOST=new\nPORT=6543")
+}
+
+func TestIntegrationGlobSources(t *testing.T) {
+	tempDir := t.TempDir()
+	writeService := func(name, host string) string {
+		dir := filepath.Join(tempDir, "services", name)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create service directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "generated.env"), []byte("DB_HOST=\n"), 0644); err != nil {
+			t.Fatalf("Failed to write target file: %v", err)
+		}
+		source := filepath.Join(dir, "config.yaml")
+		if err := os.WriteFile(source, []byte("host: "+host+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to write source file: %v", err)
+		}
+		return source
+	}
+	billing := writeService("billing", "billing-db")
+	writeService("auth", "auth-db")
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	fw.SetPollInterval(100 * time.Millisecond)
+	rules := []models.SyncRule{{
+		ID:         "hosts",
+		SourceFile: filepath.Join(tempDir, "services", "*", "config.yaml"),
+		SourceKey:  "host",
+		TargetFile: "{{dir}}/generated.env",
+		TargetKey:  "DB_HOST",
+		Enabled:    true,
+	}}
+	if err := fw.SetRules(rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if status := fw.Status(); status.WatchedFiles != 2 {
+		t.Errorf("WatchedFiles = %d, want both matching files", status.WatchedFiles)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// A change to one match writes its own target
+	writeService("billing", "billing-db-2")
+	waitForFileContent(t, filepath.Join(filepath.Dir(billing), "generated.env"), "DB_HOST=billing-db-2")
+	if content, _ := os.ReadFile(filepath.Join(tempDir, "services", "auth", "generated.env")); string(content) != "DB_HOST=\n" {
+		t.Errorf("Target of an unchanged match was written:\n%s", content)
+	}
+
+	// A file that starts matching later is picked up and synced
+	search := writeService("search", "search-db")
+	waitForFileContent(t, filepath.Join(filepath.Dir(search), "generated.env"), "DB_HOST=search-db")
+}
+
+func TestIntegrationBurstWrites(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+
+	if err := os.WriteFile(sourceFile, []byte("host: old\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("HOST=old\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	recorded := make(chan models.SyncEvent, 10)
+	fw.OnEvent(func(event models.SyncEvent) {
+		recorded <- event
+	})
+	rules := []models.SyncRule{{
+		ID: "host", SourceFile: sourceFile, SourceKey: "host", TargetFile: targetFile, TargetKey: "HOST", Enabled: true,
+		Debounce: models.Duration(10 * time.Millisecond), BatchDelay: models.Duration(800 * time.Millisecond),
+	}}
+	if err := fw.SetRules(rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// A source written in several steps syncs once, after the last one
+	for _, host := range []string{"partial", "still-partial", "final"} {
+		if err := os.WriteFile(sourceFile, []byte("host: "+host+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to update source file: %v", err)
+		}
+		time.Sleep(300 * time.Millisecond)
+	}
+
+	select {
+	case event := <-recorded:
+		if event.NewValue != "final" {
+			t.Errorf("Synced %v, want only the final value", event.NewValue)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for sync event")
+	}
+	time.Sleep(200 * time.Millisecond)
+	if len(recorded) != 0 {
+		t.Errorf("Expected a single sync, got %d more", len(recorded))
+	}
+}
+
+func TestIntegrationRetrySourceLoad(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+
+	if err := os.WriteFile(sourceFile, []byte("host: old\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("HOST=old\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	recorded := make(chan models.SyncEvent, 10)
+	fw.OnEvent(func(event models.SyncEvent) {
+		recorded <- event
+	})
+	fw.SetRetryPolicy(&models.RetryPolicy{MaxAttempts: 10, InitialBackoff: models.Duration(100 * time.Millisecond), MaxBackoff: models.Duration(100 * time.Millisecond)})
+	rules := []models.SyncRule{
+		{ID: "host", SourceFile: sourceFile, SourceKey: "host", TargetFile: targetFile, TargetKey: "HOST", Enabled: true},
+	}
+	if err := fw.SetRules(rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	// The source is briefly missing when its rules sync, and back before
+	// retries run out; its reappearance falls within the debounce
+	if err := os.WriteFile(sourceFile, []byte("host: new\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	if err := os.Remove(sourceFile); err != nil {
+		t.Fatalf("Failed to remove source file: %v", err)
+	}
+	time.Sleep(400 * time.Millisecond)
+	if err := os.WriteFile(sourceFile, []byte("host: new\n"), 0644); err != nil {
+		t.Fatalf("Failed to restore source file: %v", err)
+	}
+
+	select {
+	case event := <-recorded:
+		if !event.Success {
+			t.Errorf("Expected the sync to succeed after retrying, got %+v", event)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for sync event")
+	}
+	waitForFileContent(t, targetFile, "HOST=new")
+}
+
+// TestIntegrationRuleStatus tests that the sync service records the outcome
+// of each rule's latest sync in the state file
+func TestIntegrationRuleStatus(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", Name: "Database Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "port", Name: "Database Port", SourceFile: sourceFile, SourceKey: "database.port", TargetFile: targetFile, TargetKey: "DB_PORT", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	recorded := make(chan models.SyncEvent, 10)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) {
+			recorded <- event
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case <-recorded:
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timed out waiting for sync events")
+		}
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	store, err := state.Open(cfg.StatePath())
+	if err != nil {
+		t.Fatalf("Failed to open state: %v", err)
+	}
+	statuses := store.RuleStatuses()
+	if host := statuses["host"]; !host.Success || host.LastSync == nil {
+		t.Errorf("Host rule should have synced, got %+v", host)
+	}
+	if port := statuses["port"]; port.Success || port.Error == "" || port.LastSync != nil {
+		t.Errorf("Port rule should have failed on its missing key, got %+v", port)
+	}
+}
+
+// TestIntegrationRuleCommands tests managing rules from the command line
+func TestIntegrationRuleCommands(t *testing.T) {
+	tempDir := t.TempDir()
+	configPath := filepath.Join(tempDir, "var-sync.json")
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	run := func(args ...string) (string, error) {
+		var out strings.Builder
+		ctx := &cli.Context{Config: cfg, ConfigPath: configPath, Logger: logger.New(), Stdout: &out}
+		err := cli.Run(ctx, args)
+		return out.String(), err
+	}
+
+	if _, err := run("rule", "add", "-id", "db-host", "-name", "Database Host",
+		"-source-file", "app.yaml", "-source-key", "database.host",
+		"-target-file", "app.env", "-target-key", "DB_HOST", "-tags", "env:prod, service:db"); err != nil {
+		t.Fatalf("rule add returned error: %v", err)
+	}
+	if _, err := run("rule", "add", "-id", "db-host", "-name", "Again", "-source-file", "a.yaml", "-source-key", "k", "-target-file", "b.env", "-target-key", "K"); err == nil {
+		t.Error("rule add should refuse a duplicate ID")
+	}
+	if _, err := run("rule", "add", "-name", "No target", "-source-file", "a.yaml", "-source-key", "k"); err == nil {
+		t.Error("rule add should require a target")
+	}
+	if _, err := run("rule", "add", "-name", "Bad", "-source-file", "a.yaml", "-source-key", "k", "-target-file", "b.env", "-target-key", "K", "-priority", "urgent"); err == nil {
+		t.Error("rule add should reject an unknown priority")
+	}
+
+	if _, err := run("rule", "disable", "db-host"); err != nil {
+		t.Fatalf("rule disable returned error: %v", err)
+	}
+
+	saved, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to reload config: %v", err)
+	}
+	if len(saved.Rules) != 1 || saved.Rules[0].Enabled || len(saved.Rules[0].Tags) != 2 {
+		t.Fatalf("Config should hold the disabled, tagged rule, got %+v", saved.Rules)
+	}
+
+	output, err := run("rule", "list", "-tag", "env:prod", "--json")
+	if err != nil {
+		t.Fatalf("rule list returned error: %v", err)
+	}
+	var listed []models.SyncRule
+	if err := json.Unmarshal([]byte(output), &listed); err != nil || len(listed) != 1 || listed[0].ID != "db-host" {
+		t.Errorf("rule list -json = %s (%v)", output, err)
+	}
+
+	output, err = run("rule", "show", "db-host")
+	if err != nil || !strings.Contains(output, "app.yaml:database.host") || !strings.Contains(output, "Enabled:     false") {
+		t.Errorf("rule show = %s (%v)", output, err)
+	}
+
+	if _, err := run("rule", "rm", "db-host"); err != nil {
+		t.Fatalf("rule rm returned error: %v", err)
+	}
+	if _, err := run("rule", "rm", "db-host"); err == nil {
+		t.Error("rule rm should fail for a missing rule")
+	}
+	if saved, _ := config.Load(configPath); len(saved.Rules) != 0 {
+		t.Errorf("Config should have no rules left, got %+v", saved.Rules)
+	}
+}
+
+// TestIntegrationGetSet tests reading and surgically writing single keys from
+// the command line
+func TestIntegrationGetSet(t *testing.T) {
+	tempDir := t.TempDir()
+	file := filepath.Join(tempDir, "app.yaml")
+	if err := os.WriteFile(file, []byte("# App settings\ndatabase:\n  host: localhost # primary\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	run := func(args ...string) (string, error) {
+		var out strings.Builder
+		ctx := &cli.Context{Config: config.New(), Logger: logger.New(), Stdout: &out}
+		err := cli.Run(ctx, args)
+		return out.String(), err
+	}
+
+	if output, err := run("get", file, "database.host"); err != nil || output != "localhost\n" {
+		t.Errorf("get database.host = %q (%v)", output, err)
+	}
+	if output, err := run("get", file, "database"); err != nil || output != `{"host":"localhost","port":5432}`+"\n" {
+		t.Errorf("get database = %q (%v)", output, err)
+	}
+	if _, err := run("get", file, "database.user"); err == nil {
+		t.Error("get should fail for a missing key")
+	}
+
+	if _, err := run("set", file, "database.port", "6543", "-type", "int"); err != nil {
+		t.Fatalf("set returned error: %v", err)
+	}
+	if _, err := run("set", "-type", "string", file, "database.host", "db.internal"); err != nil {
+		t.Fatalf("set returned error: %v", err)
+	}
+	if _, err := run("set", file, "database.port", "many", "-type", "int"); err == nil {
+		t.Error("set should reject a value that is not of its type")
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	expected := "# App settings\ndatabase:\n  host: db.internal # primary\n  port: 6543\n"
+	if string(content) != expected {
+		t.Errorf("File after set:\n%s\nwant:\n%s", content, expected)
+	}
+}
+
+// TestIntegrationKeys tests listing the key paths in a file
+func TestIntegrationKeys(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "app.yaml")
+	if err := os.WriteFile(file, []byte("database:\n  host: localhost\n  port: 5432\n  password: hunter2\ndatabase_url: postgres://localhost\nfeatures:\n  - search\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	run := func(args ...string) (string, error) {
+		var out strings.Builder
+		ctx := &cli.Context{Config: config.New(), Logger: logger.New(), Stdout: &out}
+		err := cli.Run(ctx, args)
+		return out.String(), err
+	}
+
+	output, err := run("keys", file, "-prefix", "database", "-json")
+	if err != nil {
+		t.Fatalf("keys returned error: %v", err)
+	}
+	var keys []struct {
+		Key   string `json:"key"`
+		Type  string `json:"type"`
+		Value any    `json:"value"`
+	}
+	if err := json.Unmarshal([]byte(output), &keys); err != nil {
+		t.Fatalf("Failed to parse keys output %q: %v", output, err)
+	}
+
+	expected := []struct {
+		key, typ string
+		value    any
+	}{
+		{"database.host", "string", "localhost"},
+		{"database.password", "string", models.RedactedValue},
+		{"database.port", "int", float64(5432)},
+	}
+	if len(keys) != len(expected) {
+		t.Fatalf("Expected %d keys under database, got %+v", len(expected), keys)
+	}
+	for i, key := range keys {
+		if key.Key != expected[i].key || key.Type != expected[i].typ || key.Value != expected[i].value {
+			t.Errorf("Key %d = %+v, want %+v", i, key, expected[i])
+		}
+	}
+
+	output, err = run("keys", file)
+	if err != nil {
+		t.Fatalf("keys returned error: %v", err)
+	}
+	if !strings.Contains(output, "features[0]") || !strings.Contains(output, "database_url") {
+		t.Errorf("keys should list every key, got:\n%s", output)
+	}
+}
+
+// TestIntegrationValidate tests the validate command's checks and report
+func TestIntegrationValidate(t *testing.T) {
+	tempDir := t.TempDir()
+	source := filepath.Join(tempDir, "app.yaml")
+	target := filepath.Join(tempDir, "app.json")
+	configPath := filepath.Join(tempDir, "var-sync.json")
+	if err := os.WriteFile(source, []byte("database:\n  host: localhost\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	if err := os.WriteFile(target, []byte(`{"db": {}}`), 0644); err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+
+	validate := func(rules ...models.SyncRule) (string, error) {
+		cfg := config.New()
+		cfg.Rules = rules
+		if err := config.Save(cfg, configPath); err != nil {
+			t.Fatalf("Failed to save config: %v", err)
+		}
+		var out strings.Builder
+		ctx := &cli.Context{Config: cfg, ConfigPath: configPath, Logger: logger.New(), Stdout: &out}
+		err := cli.Run(ctx, []string{"validate", "-json"})
+		return out.String(), err
+	}
+
+	host := models.SyncRule{ID: "host", Name: "Host", SourceFile: source, SourceKey: "database.host", TargetFile: target, TargetKey: "db.host", Enabled: true}
+	if output, err := validate(host); err != nil {
+		t.Fatalf("validate returned error for a valid config: %v\n%s", err, output)
+	}
+
+	port := host
+	port.ID, port.SourceKey = "port", "database.port"
+	missing := host
+	missing.ID, missing.SourceKey, missing.TargetKey = "user", "database.user", "db.user"
+	noTarget := host
+	noTarget.ID, noTarget.TargetFile = "no-target", filepath.Join(tempDir, "missing.json")
+
+	output, err := validate(host, host, port, missing, noTarget)
+	if err == nil {
+		t.Fatal("validate should fail for an invalid config")
+	}
+	var report struct {
+		Valid    bool `json:"valid"`
+		Problems []struct {
+			RuleID  string `json:"rule_id"`
+			Message string `json:"message"`
+		} `json:"problems"`
+	}
+	if err := json.Unmarshal([]byte(output), &report); err != nil {
+		t.Fatalf("Failed to parse report %q: %v", output, err)
+	}
+	if report.Valid {
+		t.Error("Report should not be valid")
+	}
+
+	found := make(map[string]string)
+	for _, problem := range report.Problems {
+		found[problem.RuleID] = problem.Message
+	}
+	for ruleID, message := range map[string]string{
+		"host":      "Duplicate rule ID",
+		"port":      "also written by rule host",
+		"user":      "does not resolve",
+		"no-target": "Failed to load target file",
+	} {
+		if !strings.Contains(found[ruleID], message) {
+			t.Errorf("Expected a problem for rule %s containing %q, got %+v", ruleID, message, report.Problems)
+		}
+	}
+}
+
+// TestIntegrationStrictRules tests that strict mode refuses to start with
+// rules that write the same target key from different sources
+func TestIntegrationStrictRules(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	if err := os.WriteFile(sourceFile, []byte("primary:\n  host: a\nreplica:\n  host: b\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=a\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "primary", Name: "Primary", SourceFile: sourceFile, SourceKey: "primary.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "replica", Name: "Replica", SourceFile: sourceFile, SourceKey: "replica.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+		StrictRules: true,
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	err := sync.New(cfg, logger.New()).Run(stop)
+	if err == nil || !strings.Contains(err.Error(), "rules primary and replica both write") {
+		t.Fatalf("Run() error = %v, want a conflicting rules error", err)
+	}
+
+	// Without strict mode the conflict is only logged
+	cfg.StrictRules = false
+	if err := sync.New(cfg, logger.New()).Run(stop); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	// A disabled rule does not conflict
+	cfg.StrictRules = true
+	cfg.Rules[1].Enabled = false
+	if err := sync.New(cfg, logger.New()).Run(stop); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+// TestIntegrationRuleCycles tests that rules syncing into each other in a
+// cycle are refused when watching and reported by validate, while rules
+// syncing different keys both ways between two files are not
+func TestIntegrationRuleCycles(t *testing.T) {
+	tempDir := t.TempDir()
+	appFile := filepath.Join(tempDir, "app.yaml")
+	envFile := filepath.Join(tempDir, "app.env")
+	configPath := filepath.Join(tempDir, "var-sync.json")
+	if err := os.WriteFile(appFile, []byte("database:\n  host: localhost\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.WriteFile(envFile, []byte("DB_HOST=localhost\nDB_PORT=5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", Name: "Host", SourceFile: appFile, SourceKey: "database.host", TargetFile: envFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "port", Name: "Port", SourceFile: envFile, SourceKey: "DB_PORT", TargetFile: appFile, TargetKey: "database.port", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	close(stop)
+	if err := sync.New(cfg, logger.New()).Run(stop); err != nil {
+		t.Fatalf("Run() error = %v for rules syncing different keys both ways", err)
+	}
+
+	// Syncing the host back, transitively through another env key, closes
+	// a cycle
+	cfg.Rules = append(cfg.Rules,
+		models.SyncRule{ID: "url", Name: "URL", SourceFile: envFile, SourceExpr: `"postgres://" + DB_HOST`, TargetFile: envFile, TargetKey: "DB_URL", Enabled: true},
+		models.SyncRule{ID: "back", Name: "Back", SourceFile: envFile, SourceKey: "DB_URL", TargetFile: appFile, TargetKey: "database", Enabled: true},
+	)
+	err := sync.New(cfg, logger.New()).Run(stop)
+	if err == nil || !strings.Contains(err.Error(), "host -> url -> back -> host") {
+		t.Fatalf("Run() error = %v, want a rule cycle error", err)
+	}
+
+	if err := config.Save(cfg, configPath); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	var out strings.Builder
+	err = cli.Run(&cli.Context{Config: cfg, ConfigPath: configPath, Logger: logger.New(), Stdout: &out}, []string{"validate"})
+	if err == nil || !strings.Contains(out.String(), "Rules sync into each other in a cycle: host -> url -> back -> host") {
+		t.Errorf("validate error = %v, want the cycle reported:\n%s", err, out.String())
+	}
+
+	// A disabled rule breaks the cycle
+	cfg.Rules[3].Enabled = false
+	if err := sync.New(cfg, logger.New()).Run(stop); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+// TestIntegrationDiff tests comparing the keys of files in different formats
+func TestIntegrationDiff(t *testing.T) {
+	tempDir := t.TempDir()
+	fileA := filepath.Join(tempDir, "staging.yaml")
+	fileB := filepath.Join(tempDir, "production.toml")
+	if err := os.WriteFile(fileA, []byte("database:\n  host: staging.db\n  port: 5432\ndebug: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if err := os.WriteFile(fileB, []byte("[database]\nhost = \"prod.db\"\nport = 5432\npool = 20\n"), 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+
+	run := func(args ...string) (string, error) {
+		var out strings.Builder
+		ctx := &cli.Context{Config: config.New(), Logger: logger.New(), Stdout: &out}
+		err := cli.Run(ctx, args)
+		return out.String(), err
+	}
+
+	output, err := run("diff", fileA, fileB, "-format", "json")
+	if err != nil {
+		t.Fatalf("diff returned error: %v", err)
+	}
+	var diffs []struct {
+		Key    string `json:"key"`
+		Change string `json:"change"`
+		Old    any    `json:"old"`
+		New    any    `json:"new"`
+	}
+	if err := json.Unmarshal([]byte(output), &diffs); err != nil {
+		t.Fatalf("Failed to parse diff output %q: %v", output, err)
+	}
+
+	expected := []string{"database.host changed", "database.pool added", "debug removed"}
+	if len(diffs) != len(expected) {
+		t.Fatalf("Expected %d differences, got %+v", len(expected), diffs)
+	}
+	for i, diff := range diffs {
+		if got := diff.Key + " " + diff.Change; got != expected[i] {
+			t.Errorf("Difference %d = %q, want %q", i, got, expected[i])
+		}
+	}
+	if diffs[0].Old != "staging.db" || diffs[0].New != "prod.db" {
+		t.Errorf("database.host = %v -> %v, want staging.db -> prod.db", diffs[0].Old, diffs[0].New)
+	}
+
+	if output, err := run("diff", fileA, fileA); err != nil || output != "No differences.\n" {
+		t.Errorf("diff of a file with itself = %q (%v)", output, err)
+	}
+	if _, err := run("diff", fileA, fileB, "-format", "xml"); err == nil {
+		t.Error("diff should reject an unknown format")
+	}
+}
+
+// TestIntegrationRuleGenerate tests suggesting rules for a pair of files
+func TestIntegrationRuleGenerate(t *testing.T) {
+	tempDir := t.TempDir()
+	source := filepath.Join(tempDir, "config.yaml")
+	target := filepath.Join(tempDir, "app.env")
+	configPath := filepath.Join(tempDir, "var-sync.json")
+	if err := os.WriteFile(source, []byte("database:\n  host: db.example.com\n  port: 5432\napi_key: k3y-abcdef\ndebug: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source: %v", err)
+	}
+	if err := os.WriteFile(target, []byte("DATABASE_HOST=db.example.com\nPORT=5432\nSERVICE_KEY=k3y-abcdef\nVERBOSE=true\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target: %v", err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	run := func(args ...string) (string, error) {
+		var out strings.Builder
+		ctx := &cli.Context{Config: cfg, ConfigPath: configPath, Logger: logger.New(), Stdout: &out}
+		err := cli.Run(ctx, args)
+		return out.String(), err
+	}
+
+	output, err := run("rule", "generate", "-source", source, "-target", target)
+	if err != nil {
+		t.Fatalf("rule generate returned error: %v", err)
+	}
+	var rules []models.SyncRule
+	if err := json.Unmarshal([]byte(output), &rules); err != nil {
+		t.Fatalf("Failed to parse rules %q: %v", output, err)
+	}
+
+	// debug and VERBOSE share only a boolean, too common a value to pair them
+	expected := []string{"api_key SERVICE_KEY", "database.host DATABASE_HOST", "database.port PORT"}
+	if len(rules) != len(expected) {
+		t.Fatalf("Expected %d rules, got %+v", len(expected), rules)
+	}
+	for i, rule := range rules {
+		if got := rule.SourceKey + " " + rule.TargetKey; got != expected[i] {
+			t.Errorf("Rule %d maps %q, want %q", i, got, expected[i])
+		}
+		if rule.SourceFile != source || rule.TargetFile != target || !rule.Enabled {
+			t.Errorf("Rule %d = %+v, want an enabled rule from %s to %s", i, rule, source, target)
+		}
+	}
+	if len(cfg.Rules) != 0 {
+		t.Error("rule generate should not change the config without -add")
+	}
+
+	// rules is an alias of rule, and flags may start with --
+	if _, err := run("rules", "generate", "--source", source, "--target", target, "-add"); err != nil {
+		t.Fatalf("rule generate -add returned error: %v", err)
+	}
+	loaded, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(loaded.Rules) != len(expected) {
+		t.Errorf("Expected %d rules saved, got %d", len(expected), len(loaded.Rules))
+	}
+}
+
+// TestIntegrationConfigExportImport tests moving the config between JSON,
+// YAML and TOML
+func TestIntegrationConfigExportImport(t *testing.T) {
+	tempDir := t.TempDir()
+	jsonPath := filepath.Join(tempDir, "var-sync.json")
+	yamlPath := filepath.Join(tempDir, "rules.yaml")
+	tomlPath := filepath.Join(tempDir, "var-sync.toml")
+
+	cfg := config.New()
+	cfg.Rules = []models.SyncRule{
+		{ID: "db-host", Name: "Database Host", SourceFile: "config.yaml", SourceKey: "database.host", TargetFile: "app.env", TargetKey: "DB_HOST", Enabled: true, Debounce: models.Duration(2 * time.Second)},
+	}
+	if err := config.Save(cfg, jsonPath); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	run := func(cfg *models.Config, configPath string, args ...string) (string, error) {
+		var out strings.Builder
+		ctx := &cli.Context{Config: cfg, ConfigPath: configPath, Logger: logger.New(), Stdout: &out}
+		err := cli.Run(ctx, args)
+		return out.String(), err
+	}
+
+	output, err := run(cfg, jsonPath, "config", "export")
+	if err != nil {
+		t.Fatalf("config export returned error: %v", err)
+	}
+	if !strings.Contains(output, "target_key: DB_HOST") || !strings.Contains(output, "debounce: 2s") {
+		t.Errorf("config export should print YAML, got:\n%s", output)
+	}
+	if _, err := run(cfg, jsonPath, "config", "export", "-format", "yaml", "-o", yamlPath); err != nil {
+		t.Fatalf("config export -o returned error: %v", err)
+	}
+
+	// Import the YAML rules into a TOML config, which is saved as TOML
+	tomlConfig, err := config.Load(tomlPath)
+	if err != nil {
+		t.Fatalf("Failed to create TOML config: %v", err)
+	}
+	tomlConfig.LogFile = "custom.log"
+	if err := config.Save(tomlConfig, tomlPath); err != nil {
+		t.Fatalf("Failed to save TOML config: %v", err)
+	}
+	if _, err := run(tomlConfig, tomlPath, "config", "import", "-rules", yamlPath); err != nil {
+		t.Fatalf("config import returned error: %v", err)
+	}
+
+	content, err := os.ReadFile(tomlPath)
+	if err != nil {
+		t.Fatalf("Failed to read TOML config: %v", err)
+	}
+	if !strings.Contains(string(content), "[[rules]]") {
+		t.Errorf("Config should be saved as TOML, got:\n%s", content)
+	}
+	loaded, err := config.Load(tomlPath)
+	if err != nil {
+		t.Fatalf("Failed to load TOML config: %v", err)
+	}
+	if len(loaded.Rules) != 1 || loaded.Rules[0].ID != "db-host" || time.Duration(loaded.Rules[0].Debounce) != 2*time.Second {
+		t.Errorf("Imported rules = %+v", loaded.Rules)
+	}
+	if loaded.LogFile != "custom.log" {
+		t.Errorf("config import -rules should keep other settings, log_file = %q", loaded.LogFile)
+	}
+
+	invalid := filepath.Join(tempDir, "invalid.yaml")
+	if err := os.WriteFile(invalid, []byte("rules:\n  - id: r1\n    priority: urgent\n"), 0644); err != nil {
+		t.Fatalf("Failed to write invalid config: %v", err)
+	}
+	if _, err := run(loaded, tomlPath, "config", "import", invalid); err == nil {
+		t.Error("config import should reject an invalid config")
+	}
+}
+
+// TestIntegrationConfigReload tests that rules added to the config file take
+// effect in a running watcher
+func TestIntegrationConfigReload(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	configPath := filepath.Join(tempDir, "var-sync.json")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\nDB_PORT=5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := config.New()
+	cfg.HistoryFile = filepath.Join(tempDir, "history.jsonl")
+	cfg.StateFile = filepath.Join(tempDir, "state.json")
+	cfg.Rules = []models.SyncRule{
+		{ID: "host", Name: "Database Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+	}
+	if err := config.Save(cfg, configPath); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	recorded := make(chan models.SyncEvent, 10)
+	syncer := sync.New(cfg, logger.New())
+	syncer.WatchConfig(configPath)
+	go func() {
+		done <- syncer.Run(stop, func(event models.SyncEvent) {
+			recorded <- event
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	updated := *cfg
+	updated.Rules = append(append([]models.SyncRule(nil), cfg.Rules...),
+		models.SyncRule{ID: "port", Name: "Database Port", SourceFile: sourceFile, SourceKey: "database.port", TargetFile: targetFile, TargetKey: "DB_PORT", Enabled: true})
+	if err := config.Save(&updated, configPath); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+	time.Sleep(time.Second)
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n  port: 6543\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	deadline := time.After(3 * time.Second)
+	for synced := false; !synced; {
+		select {
+		case event := <-recorded:
+			synced = event.RuleID == "port" && event.Success
+		case <-deadline:
+			t.Fatal("Timed out waiting for the added rule to sync")
+		}
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if !strings.Contains(string(content), "DB_PORT=6543") {
+		t.Errorf("Target file should have the new port:\n%s", content)
+	}
+}
+
+// TestIntegrationControlEditRules tests that rules edited through the control
+// API are applied straight away and saved to the config file
+func TestIntegrationControlEditRules(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	configPath := filepath.Join(tempDir, "var-sync.json")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\nDB_PORT=5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := config.New()
+	cfg.HistoryFile = filepath.Join(tempDir, "history.jsonl")
+	cfg.StateFile = filepath.Join(tempDir, "state.json")
+	cfg.Rules = []models.SyncRule{
+		{ID: "host", Name: "Database Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+	}
+	if err := config.Save(cfg, configPath); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	recorded := make(chan models.SyncEvent, 10)
+	syncer := sync.New(cfg, logger.New())
+	syncer.WatchConfig(configPath)
+	syncer.ServeControl(cfg.ControlPath(configPath))
+	go func() {
+		done <- syncer.Run(stop, func(event models.SyncEvent) {
+			recorded <- event
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	client := control.Dial(cfg.ControlPath(configPath))
+	ctx := t.Context()
+	rules := append(append([]models.SyncRule(nil), cfg.Rules...),
+		models.SyncRule{ID: "port", Name: "Database Port", SourceFile: sourceFile, SourceKey: "database.port", TargetFile: targetFile, TargetKey: "DB_PORT", Enabled: true})
+	invalid := append([]models.SyncRule(nil), rules...)
+	invalid[1].OnConflict = "never"
+	if _, err := client.SetRules(ctx, invalid); err == nil {
+		t.Error("SetRules() with an invalid rule expected an error")
+	}
+	updated, err := client.SetRules(ctx, rules)
+	if err != nil {
+		t.Fatalf("SetRules() error = %v", err)
+	}
+	if len(updated) != 2 {
+		t.Errorf("SetRules() = %+v, want both rules", updated)
+	}
+
+	saved, err := config.Load(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+	if len(saved.Rules) != 2 || saved.Rules[1].ID != "port" || saved.Rules[1].OnConflict != "" {
+		t.Errorf("Saved rules = %+v, want the port rule added", saved.Rules)
+	}
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n  port: 6543\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	deadline := time.After(3 * time.Second)
+	for synced := false; !synced; {
+		select {
+		case event := <-recorded:
+			synced = event.RuleID == "port" && event.Success
+		case <-deadline:
+			t.Fatal("Timed out waiting for the added rule to sync")
+		}
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if !strings.Contains(string(content), "DB_PORT=6543") {
+		t.Errorf("Target file should have the new port:\n%s", content)
+	}
+}
+
+// TestIntegrationGracefulStop tests that stopping the watcher syncs changes
+// still waiting out their batch delay rather than dropping them
+func TestIntegrationGracefulStop(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", Name: "Database Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+		},
+		BatchDelay:  models.Duration(time.Minute),
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if string(content) != "DB_HOST=db.internal\n" {
+		t.Errorf("Pending change should be synced on stop, target file:\n%s", content)
+	}
+}
+
+// TestIntegrationEventSequence tests that sync events are numbered in order
+// across runs and that the events of one source change share a change ID
+func TestIntegrationEventSequence(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	apiFile := filepath.Join(tempDir, "api.env")
+	workerFile := filepath.Join(tempDir, "worker.env")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	for _, file := range []string{apiFile, workerFile} {
+		if err := os.WriteFile(file, []byte("DB_HOST=localhost\n"), 0644); err != nil {
+			t.Fatalf("Failed to create target file: %v", err)
+		}
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "api", Name: "API Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: apiFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "worker", Name: "Worker Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: workerFile, TargetKey: "DB_HOST", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	// run starts the sync service, changes the source and returns the events
+	run := func(host string) []models.SyncEvent {
+		stop := make(chan struct{})
+		done := make(chan error, 1)
+		recorded := make(chan models.SyncEvent, 10)
+		go func() {
+			done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) {
+				recorded <- event
+			})
+		}()
+		time.Sleep(100 * time.Millisecond)
+
+		if err := os.WriteFile(sourceFile, []byte("database:\n  host: "+host+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to update source file: %v", err)
+		}
+		var events []models.SyncEvent
+		for len(events) < 2 {
+			select {
+			case event := <-recorded:
+				events = append(events, event)
+			case <-time.After(3 * time.Second):
+				t.Fatal("Timed out waiting for sync events")
+			}
+		}
+		close(stop)
+		if err := <-done; err != nil {
+			t.Fatalf("Run() error = %v", err)
+		}
+		return events
+	}
+
+	first := run("db.internal")
+	if first[0].Sequence != 1 || first[1].Sequence != 2 {
+		t.Errorf("First run should number its events 1 and 2, got %d and %d", first[0].Sequence, first[1].Sequence)
+	}
+	if first[0].RuleID != "api" || first[1].RuleID != "worker" {
+		t.Errorf("Events should follow the order of their target files, got %s then %s", first[0].RuleID, first[1].RuleID)
+	}
+	if first[0].ChangeID == "" || first[0].ChangeID != first[1].ChangeID {
+		t.Errorf("Events of one source change should share a change ID, got %q and %q", first[0].ChangeID, first[1].ChangeID)
+	}
+
+	second := run("db.example.com")
+	if second[0].Sequence != 3 || second[1].Sequence != 4 {
+		t.Errorf("Second run should continue numbering at 3, got %d and %d", second[0].Sequence, second[1].Sequence)
+	}
+	if second[0].ChangeID == first[0].ChangeID {
+		t.Error("Separate source changes should have separate change IDs")
+	}
+}
+
+// TestIntegrationEventQueueSpill tests that events spilled to disk when the
+// event queue was full are taken back, even after a restart
+func TestIntegrationEventQueueSpill(t *testing.T) {
+	tempDir := t.TempDir()
+	spillFile := filepath.Join(tempDir, "overflow.jsonl")
+	leftover := `{"id":"e1","rule_id":"host","timestamp":"2024-03-01T12:00:00Z","old_value":"a","new_value":"b","success":true}` + "\n"
+	if err := os.WriteFile(spillFile, []byte(leftover), 0644); err != nil {
+		t.Fatalf("Failed to create spill file: %v", err)
+	}
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	fw.SetEventQueue(&models.EventQueue{Size: 5, Overflow: models.OverflowSpill, SpillFile: spillFile})
+	if stats := fw.Stats(); stats.QueueCapacity != 5 {
+		t.Errorf("Queue capacity = %d, want 5", stats.QueueCapacity)
+	}
+	if err := fw.SetRules(nil); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+
+	deadline := time.Now().Add(3 * time.Second)
+	for {
+		if _, err := os.Stat(spillFile); os.IsNotExist(err) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Spilled events were not taken back")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// TestIntegrationStatus tests that the status command tells rules in sync
+// from rules whose source or target changed since they last synced
+func TestIntegrationStatus(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\nDB_PORT=5433\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", Name: "Database Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "port", Name: "Database Port", SourceFile: sourceFile, SourceKey: "database.port", TargetFile: targetFile, TargetKey: "DB_PORT", Enabled: true},
+			{ID: "off", Name: "Disabled", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "OTHER_HOST"},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	// Sync the host rule only, leaving the port rule out of sync
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	synced := make(chan models.SyncEvent, 10)
+	hostOnly := *cfg
+	hostOnly.Rules = cfg.Rules[:1]
+	go func() {
+		done <- sync.New(&hostOnly, logger.New()).Run(stop, func(event models.SyncEvent) {
+			synced <- event
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	select {
+	case <-synced:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for sync event")
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	status := func() map[string]string {
+		var out strings.Builder
+		ctx := &cli.Context{Config: cfg, Logger: logger.New(), Stdout: &out}
+		if err := cli.Run(ctx, []string{"status", "-json"}); err != nil {
+			t.Fatalf("status returned error: %v", err)
+		}
+		var states []struct {
+			RuleID string `json:"rule_id"`
+			Status string `json:"status"`
+			Reason string `json:"reason"`
+		}
+		if err := json.Unmarshal([]byte(out.String()), &states); err != nil {
+			t.Fatalf("Failed to parse status output: %v\n%s", err, out.String())
+		}
+		result := make(map[string]string)
+		for _, state := range states {
+			result[state.RuleID] = state.Status
+			if state.Reason != "" {
+				result[state.RuleID] += ": " + state.Reason
+			}
+		}
+		return result
+	}
+
+	got := status()
+	for id, want := range map[string]string{"host": "in sync", "port": "never synced", "off": "disabled"} {
+		if got[id] != want {
+			t.Errorf("Status of rule %s = %q, want %q", id, got[id], want)
+		}
+	}
+
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=edited\nDB_PORT=5433\n"), 0644); err != nil {
+		t.Fatalf("Failed to edit target file: %v", err)
+	}
+	if got := status()["host"]; got != "out of sync: target changed since the last sync" {
+		t.Errorf("Edited target status = %q", got)
+	}
+
+	var out strings.Builder
+	ctx := &cli.Context{Config: cfg, Logger: logger.New(), Stdout: &out}
+	if err := cli.Run(ctx, []string{"status", "-check"}); err == nil || !strings.Contains(err.Error(), "2 rules") {
+		t.Errorf("status -check should fail for the 2 rules out of sync, got %v", err)
+	}
+	for _, line := range []string{"    DB_HOST: source db.internal, target edited\n", "    DB_PORT: source 5432, target 5433\n", "0 in sync, 2 out of sync, 0 failing\n"} {
+		if !strings.Contains(out.String(), line) {
+			t.Errorf("Missing %q in status output:\n%s", line, out.String())
+		}
+	}
+}
+
+func TestIntegrationValueTypes(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.json")
+	if err := os.WriteFile(sourceFile, []byte("port: 5432\nratio: 0.5\nenabled: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("{\n  \"port\": 1,\n  \"ratio\": 1.0,\n  \"port_name\": \"\",\n  \"enabled\": false\n}\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "port", SourceFile: sourceFile, SourceKey: "port", TargetFile: targetFile, TargetKey: "port", Enabled: true},
+			{ID: "ratio", SourceFile: sourceFile, SourceKey: "ratio", TargetFile: targetFile, TargetKey: "ratio", Enabled: true},
+			{ID: "port-name", SourceFile: sourceFile, SourceKey: "port", TargetFile: targetFile, TargetKey: "port_name", TargetType: models.TypeString, Enabled: true},
+			{ID: "enabled", SourceFile: sourceFile, SourceKey: "enabled", TargetFile: targetFile, TargetKey: "enabled", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	synced := make(chan models.SyncEvent, 10)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) {
+			synced <- event
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(sourceFile, []byte("port: 5432\nratio: 2.0\nenabled: true\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	for i := 0; i < len(cfg.Rules); i++ {
+		select {
+		case event := <-synced:
+			if !event.Success {
+				t.Errorf("Sync of rule %s failed: %s", event.RuleID, event.Error)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timed out waiting for sync events")
+		}
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	for _, want := range []string{`"port": 5432`, `"ratio": 2.0`, `"port_name": "5432"`, `"enabled": true`} {
+		if !strings.Contains(string(content), want) {
+			t.Errorf("Target file is missing %s:\n%s", want, content)
+		}
+	}
+}
+
+func TestIntegrationCreateMissing(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.env")
+	targetFile := filepath.Join(tempDir, "target.yaml")
+	jsonTarget := filepath.Join(tempDir, "target.json")
+	if err := os.WriteFile(sourceFile, []byte("DB_HOST=localhost\nDB_PORT=5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("database:\n  name: app\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+	if err := os.WriteFile(jsonTarget, []byte(`{"database": {"name": "app"}}`), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", SourceFile: sourceFile, SourceKey: "DB_HOST", TargetFile: targetFile, TargetKey: "database.host", CreateMissing: true, Enabled: true},
+			{ID: "port", SourceFile: sourceFile, SourceKey: "DB_PORT", TargetFile: targetFile, TargetKey: "database.port", Enabled: true},
+			// JSON targets have missing keys added without create_missing
+			{ID: "json", SourceFile: sourceFile, SourceKey: "DB_HOST", TargetFile: jsonTarget, TargetKey: "database.host", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	synced := make(chan models.SyncEvent, 10)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) {
+			synced <- event
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(sourceFile, []byte("DB_HOST=db.internal\nDB_PORT=5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	events := make(map[string]models.SyncEvent)
+	for len(events) < len(cfg.Rules) {
+		select {
+		case event := <-synced:
+			events[event.RuleID] = event
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timed out waiting for sync events")
+		}
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if !events["host"].Success {
+		t.Errorf("Rule host with create_missing failed: %s", events["host"].Error)
+	}
+	if events["port"].Success || !strings.Contains(events["port"].Error, "does not exist") {
+		t.Errorf("Rule port without create_missing should fail for the missing key, got %+v", events["port"])
+	}
+	if !events["json"].Success {
+		t.Errorf("Rule json writing to a JSON target failed: %s", events["json"].Error)
+	}
+
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if want := "database:\n  name: app\n  host: db.internal\n"; string(content) != want {
+		t.Errorf("Target file = %q, want %q", content, want)
+	}
+	p := parser.New()
+	data, err := p.LoadFile(jsonTarget)
+	if err != nil {
+		t.Fatalf("Failed to load JSON target: %v", err)
+	}
+	if value, _ := p.GetValue(data, "database.host"); value != "db.internal" {
+		t.Errorf("JSON target database.host = %v, want db.internal", value)
+	}
+}
+
+func TestIntegrationDeleteMissing(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("# Database\nDB_HOST=localhost\nDB_PORT=5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "port", SourceFile: sourceFile, SourceKey: "database.port", TargetFile: targetFile, TargetKey: "DB_PORT", DeleteMissing: true, Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	synced := make(chan models.SyncEvent, 10)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) {
+			synced <- event
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	events := make(map[string]models.SyncEvent)
+	for len(events) < len(cfg.Rules) {
+		select {
+		case event := <-synced:
+			events[event.RuleID] = event
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timed out waiting for sync events")
+		}
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	if port := events["port"]; !port.Success || !port.Deleted || port.NewValue != nil {
+		t.Errorf("Rule port should delete its target key, got %+v", port)
+	}
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if want := "# Database\nDB_HOST=db.internal\n"; string(content) != want {
+		t.Errorf("Target file = %q, want %q", content, want)
+	}
+}
+
+func TestIntegrationArrayAppend(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.yaml")
+	if err := os.WriteFile(sourceFile, []byte("app:\n  host: a.example.com\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("allowed_hosts:\n  - localhost # always\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", SourceFile: sourceFile, SourceKey: "app.host", TargetFile: targetFile, TargetKey: "allowed_hosts[+]", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	synced := make(chan models.SyncEvent, 10)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) {
+			synced <- event
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// The appended host is replaced when the source host changes, leaving
+	// the hosts it did not add alone
+	expected := []string{
+		"allowed_hosts:\n  - localhost # always\n  - b.example.com\n",
+		"allowed_hosts:\n  - localhost # always\n  - c.example.com\n",
+	}
+	for i, host := range []string{"b.example.com", "c.example.com"} {
+		if i > 0 {
+			time.Sleep(600 * time.Millisecond) // Past the debounce
+		}
+		if err := os.WriteFile(sourceFile, []byte("app:\n  host: "+host+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to update source file: %v", err)
+		}
+		select {
+		case event := <-synced:
+			if !event.Success {
+				t.Fatalf("Sync of %s failed: %s", host, event.Error)
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timed out waiting for sync event")
+		}
+		content, err := os.ReadFile(targetFile)
+		if err != nil {
+			t.Fatalf("Failed to read target file: %v", err)
+		}
+		if string(content) != expected[i] {
+			t.Errorf("Target file = %q, want %q", content, expected[i])
+		}
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+func TestIntegrationTargetSchema(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.json")
+	schemaFile := filepath.Join(tempDir, "target.schema.json")
+	if err := os.WriteFile(sourceFile, []byte("port: 8080\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	targetContent := "{\n  \"server\": {\"port\": 80}\n}"
+	if err := os.WriteFile(targetFile, []byte(targetContent), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+	schemaContent := `{"properties": {"server": {"properties": {"port": {"type": "integer", "maximum": 65535}}}}}`
+	if err := os.WriteFile(schemaFile, []byte(schemaContent), 0644); err != nil {
+		t.Fatalf("Failed to create schema file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "port", SourceFile: sourceFile, SourceKey: "port", TargetFile: targetFile, TargetKey: "server.port", Enabled: true},
+		},
+		Schemas:     map[string]string{targetFile: schemaFile},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	synced := make(chan models.SyncEvent, 10)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) {
+			synced <- event
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// A port the schema allows is synced, one it does not is rolled back
+	for i, port := range []string{"9090", "70000"} {
+		if i > 0 {
+			time.Sleep(600 * time.Millisecond) // Past the debounce
+		}
+		if err := os.WriteFile(sourceFile, []byte("port: "+port+"\n"), 0644); err != nil {
+			t.Fatalf("Failed to update source file: %v", err)
+		}
+		var event models.SyncEvent
+		select {
+		case event = <-synced:
+		case <-time.After(3 * time.Second):
+			t.Fatal("Timed out waiting for sync event")
+		}
+
+		content, err := os.ReadFile(targetFile)
+		if err != nil {
+			t.Fatalf("Failed to read target file: %v", err)
+		}
+		if port == "9090" {
+			if !event.Success {
+				t.Fatalf("Sync of a valid port failed: %s", event.Error)
+			}
+			targetContent = string(content)
+			if !strings.Contains(targetContent, "9090") {
+				t.Errorf("Target file = %q, want port 9090", content)
+			}
+			continue
+		}
+		if event.Success || !strings.Contains(event.Error, "server.port: must be at most 65535") {
+			t.Errorf("Sync of an invalid port = %v %q, want a schema failure", event.Success, event.Error)
+		}
+		if string(content) != targetContent {
+			t.Errorf("Target file = %q, want it rolled back to %q", content, targetContent)
+		}
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+func TestIntegrationTargetVerification(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.json")
+	targetFile := filepath.Join(tempDir, "target.env")
+	if err := os.WriteFile(sourceFile, []byte(`{"motd": "hello"}`), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	targetContent := "MOTD=hello\nPORT=80\n"
+	if err := os.WriteFile(targetFile, []byte(targetContent), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "motd", SourceFile: sourceFile, SourceKey: "motd", TargetFile: targetFile, TargetKey: "MOTD", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	synced := make(chan models.SyncEvent, 10)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) {
+			synced <- event
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// An object written into an env file is written as text, so reading the
+	// target back does not give the value written
+	if err := os.WriteFile(sourceFile, []byte(`{"motd": {"line": "one"}}`), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	var event models.SyncEvent
+	select {
+	case event = <-synced:
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for sync event")
+	}
+
+	if event.Success || !strings.Contains(event.Error, "key MOTD does not hold the value written to it") {
+		t.Errorf("Sync = %v %q, want a verification failure", event.Success, event.Error)
+	}
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if string(content) != targetContent {
+		t.Errorf("Target file = %q, want it rolled back to %q", content, targetContent)
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+func TestIntegrationSymlinkSource(t *testing.T) {
+	tempDir := t.TempDir()
+	mountDir := filepath.Join(tempDir, "config")
+	targetFile := filepath.Join(tempDir, "target.env")
+
+	// Lay the source out as Kubernetes mounts a ConfigMap: app.yaml links to
+	// ..data/app.yaml, and ..data links to a directory holding this version
+	writeVersion := func(version, content string) {
+		t.Helper()
+		dir := filepath.Join(mountDir, version)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "app.yaml"), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write source file: %v", err)
+		}
+		if err := os.Symlink(version, filepath.Join(mountDir, "..data_tmp")); err != nil {
+			t.Skipf("Symlinks not supported: %v", err)
+		}
+		if err := os.Rename(filepath.Join(mountDir, "..data_tmp"), filepath.Join(mountDir, "..data")); err != nil {
+			t.Fatalf("Failed to swap ..data: %v", err)
+		}
+	}
+	writeVersion("..2024_01_01", "port: 8080\n")
+	sourceFile := filepath.Join(mountDir, "app.yaml")
+	if err := os.Symlink(filepath.Join("..data", "app.yaml"), sourceFile); err != nil {
+		t.Skipf("Symlinks not supported: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("PORT=8080\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "port", SourceFile: sourceFile, SourceKey: "port", TargetFile: targetFile, TargetKey: "PORT", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	synced := make(chan models.SyncEvent, 10)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) {
+			synced <- event
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	writeVersion("..2024_01_02", "port: 9090\n")
+	select {
+	case event := <-synced:
+		if !event.Success {
+			t.Fatalf("Sync failed: %s", event.Error)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the ..data swap to sync")
+	}
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if string(content) != "PORT=9090\n" {
+		t.Errorf("Target file = %q, want PORT=9090", content)
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+func TestIntegrationCreateEnvTarget(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, ".env.local")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true, CreateMissing: true},
+			{ID: "port", SourceFile: sourceFile, SourceKey: "database.port", TargetFile: targetFile, TargetKey: "DB_PORT", Enabled: true, CreateMissing: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(models.SyncEvent) {})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// The target does not exist until the first sync writes it
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	waitForFileContent(t, targetFile, "DB_PORT=5432")
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if string(content) != "DB_HOST=db.internal\nDB_PORT=5432\n" {
+		t.Errorf("Target file = %q, want both keys", content)
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+func TestIntegrationRenderEnv(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	outputFile := filepath.Join(tempDir, "app.env")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n  port: 5432\nmotd: hello world\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	var out strings.Builder
+	ctx := &cli.Context{Config: &models.Config{}, Logger: logger.New(), Stdout: &out}
+	if err := cli.Run(ctx, []string{"render-env", sourceFile, "-prefix", "APP_"}); err != nil {
+		t.Fatalf("render-env returned error: %v", err)
+	}
+	expected := "APP_DATABASE_HOST=db.internal\nAPP_DATABASE_PORT=5432\nAPP_MOTD=\"hello world\"\n"
+	if out.String() != expected {
+		t.Errorf("render-env printed %q, want %q", out.String(), expected)
+	}
+
+	out.Reset()
+	if err := cli.Run(ctx, []string{"render-env", sourceFile, "DB=database.host", "database.port", "-output", outputFile}); err != nil {
+		t.Fatalf("render-env returned error: %v", err)
+	}
+	content, err := os.ReadFile(outputFile)
+	if err != nil {
+		t.Fatalf("Failed to read env file: %v", err)
+	}
+	if string(content) != "DB=db.internal\nDATABASE_PORT=5432\n" {
+		t.Errorf("render-env wrote %q", content)
+	}
+	data, err := parser.New().LoadFile(outputFile)
+	if err != nil || data["DB"] != "db.internal" || data["DATABASE_PORT"] != int64(5432) {
+		t.Errorf("Env file reads back as %v, %v", data, err)
+	}
+
+	if err := cli.Run(ctx, []string{"render-env", sourceFile, "database.host", "DATABASE_HOST=motd"}); err == nil {
+		t.Error("render-env should fail for two keys with the same name")
+	}
+}
+
+func TestIntegrationTemplateTarget(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	templateFile := filepath.Join(tempDir, "nginx.conf.tmpl")
+	targetFile := filepath.Join(tempDir, "nginx.conf")
+	if err := os.WriteFile(sourceFile, []byte("server:\n  name: example.com\n  port: 8080\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	tmpl := "server {\n  listen {{ .server.port }};\n  server_name {{ .server.name | upper }};\n  root {{ get . \"server.root\" | default \"/var/www\" }};\n}\n"
+	if err := os.WriteFile(templateFile, []byte(tmpl), 0644); err != nil {
+		t.Fatalf("Failed to create template file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "nginx", SourceFile: sourceFile, TargetFile: targetFile, Template: templateFile, Enabled: true},
+		},
+		Debounce:    models.Duration(10 * time.Millisecond),
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	// A dry run shows the file the template would create
+	var out strings.Builder
+	if err := sync.New(cfg, logger.New()).DryRun(&out); err != nil {
+		t.Fatalf("DryRun() returned error: %v", err)
+	}
+	if !strings.Contains(out.String(), "+  listen 8080;") {
+		t.Errorf("DryRun() output should show the rendered template, got:\n%s", out.String())
+	}
+	if _, err := os.Stat(targetFile); !os.IsNotExist(err) {
+		t.Fatalf("DryRun() should not write the target, stat error = %v", err)
+	}
+
+	events := make(chan models.SyncEvent, 10)
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) { events <- event })
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("server:\n  name: example.org\n  port: 9090\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	select {
+	case event := <-events:
+		if !event.Success {
+			t.Fatalf("Template rule failed: %s", event.Error)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the template to render")
+	}
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	expected := "server {\n  listen 9090;\n  server_name EXAMPLE.ORG;\n  root /var/www;\n}\n"
+	if string(content) != expected {
+		t.Errorf("Target file = %q, want %q", content, expected)
+	}
+
+	// A template referring to a key the source lacks fails without writing
+	if err := os.WriteFile(sourceFile, []byte("server:\n  port: 9090\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	select {
+	case event := <-events:
+		if event.Success {
+			t.Error("Template rule should fail for a missing key")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Timed out waiting for the template to fail")
+	}
+	if content, _ := os.ReadFile(targetFile); string(content) != expected {
+		t.Errorf("Target file = %q, should be left as last rendered", content)
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+func TestIntegrationSourceExpression(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "app.env")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n  port: 5432\napi:\n  timeout: 30\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_ADDR=localhost:5432\nTIMEOUT_MS=30000\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "addr", SourceFile: sourceFile, SourceExpr: "{{ .database.host }}:{{ .database.port }}", TargetFile: targetFile, TargetKey: "DB_ADDR", Enabled: true},
+			{ID: "timeout", SourceFile: sourceFile, SourceExpr: "api.timeout * 1000", TargetFile: targetFile, TargetKey: "TIMEOUT_MS", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(models.SyncEvent) {})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n  port: 6432\napi:\n  timeout: 45\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	waitForFileContent(t, targetFile, "TIMEOUT_MS=45000")
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if string(content) != "DB_ADDR=db.internal:6432\nTIMEOUT_MS=45000\n" {
+		t.Errorf("Target file = %q, want both computed values", content)
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+func TestIntegrationWhenCondition(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "app.env")
+	if err := os.WriteFile(sourceFile, []byte("env: staging\ndatabase:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\nPROD_DB_HOST=localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "prod-host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "PROD_DB_HOST", Enabled: true, When: `source.env == "production"`},
+		},
+		Debounce:    models.Duration(10 * time.Millisecond),
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(models.SyncEvent) {})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Only the rule without a condition syncs while env is staging
+	if err := os.WriteFile(sourceFile, []byte("env: staging\ndatabase:\n  host: staging.internal\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	waitForFileContent(t, targetFile, "DB_HOST=staging.internal")
+	if content, _ := os.ReadFile(targetFile); string(content) != "DB_HOST=staging.internal\nPROD_DB_HOST=localhost\n" {
+		t.Errorf("Target file = %q, want PROD_DB_HOST left alone", content)
+	}
+
+	if err := os.WriteFile(sourceFile, []byte("env: production\ndatabase:\n  host: prod.internal\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	waitForFileContent(t, targetFile, "PROD_DB_HOST=prod.internal")
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+func TestIntegrationRunContext(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "app.env")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+	syncer := sync.New(cfg, logger.New())
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := syncer.PlanContext(cancelled); !errors.Is(err, context.Canceled) {
+		t.Errorf("PlanContext() error = %v for a cancelled context", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- syncer.RunContext(ctx)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	waitForFileContent(t, targetFile, "DB_HOST=db.internal")
+
+	cancel()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("RunContext() error = %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("RunContext() did not return after its context was cancelled")
+	}
+}
+
+// TestIntegrationMinInterval tests that a rule with a min_interval holds back
+// changes that come too soon and syncs the latest of them once it is up
+func TestIntegrationMinInterval(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	if err := os.WriteFile(sourceFile, []byte("counter: 0\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("COUNTER=0\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "counter", SourceFile: sourceFile, SourceKey: "counter", TargetFile: targetFile, TargetKey: "COUNTER", Enabled: true, MinInterval: models.Duration(time.Second)},
+		},
+		Debounce:    models.Duration(10 * time.Millisecond),
+		BatchDelay:  models.Duration(10 * time.Millisecond),
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	var synced atomic.Int32
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) {
+			if event.Success {
+				synced.Add(1)
+			}
+		})
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	for i := 1; i <= 3; i++ {
+		if err := os.WriteFile(sourceFile, []byte(fmt.Sprintf("counter: %d\n", i)), 0644); err != nil {
+			t.Fatalf("Failed to update source file: %v", err)
+		}
+		if i == 1 {
+			waitForFileContent(t, targetFile, "COUNTER=1")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if content, _ := os.ReadFile(targetFile); string(content) != "COUNTER=1\n" {
+		t.Errorf("Changes within min_interval should be held back, target file:\n%s", content)
+	}
+
+	waitForFileContent(t, targetFile, "COUNTER=3")
+	time.Sleep(200 * time.Millisecond)
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if count := synced.Load(); count != 2 {
+		t.Errorf("Rule synced %d times, want 2", count)
+	}
+}
+
+// TestIntegrationTargetMinInterval tests that target_min_interval holds back
+// writes to a target from any rule, and that stopping syncs them
+func TestIntegrationTargetMinInterval(t *testing.T) {
+	tempDir := t.TempDir()
+	hostSource := filepath.Join(tempDir, "host.yaml")
+	portSource := filepath.Join(tempDir, "port.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	if err := os.WriteFile(hostSource, []byte("host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(portSource, []byte("port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\nDB_PORT=5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", SourceFile: hostSource, SourceKey: "host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "port", SourceFile: portSource, SourceKey: "port", TargetFile: targetFile, TargetKey: "DB_PORT", Enabled: true},
+		},
+		TargetMinInterval: models.Duration(time.Minute),
+		HistoryFile:       filepath.Join(tempDir, "history.jsonl"),
+		StateFile:         filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(hostSource, []byte("host: db.internal\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	waitForFileContent(t, targetFile, "DB_HOST=db.internal")
+	if err := os.WriteFile(portSource, []byte("port: 6543\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	time.Sleep(time.Second)
+	if content, _ := os.ReadFile(targetFile); strings.Contains(string(content), "DB_PORT=6543") {
+		t.Errorf("Write within target_min_interval should be held back, target file:\n%s", content)
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	content, err := os.ReadFile(targetFile)
+	if err != nil {
+		t.Fatalf("Failed to read target file: %v", err)
+	}
+	if string(content) != "DB_HOST=db.internal\nDB_PORT=6543\n" {
+		t.Errorf("Held back write should be synced on stop, target file:\n%s", content)
+	}
+}
+
+// TestIntegrationBatchMaxDelay tests that a source changing faster than its
+// batch delay still syncs within the batch max delay
+func TestIntegrationBatchMaxDelay(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	if err := os.WriteFile(sourceFile, []byte("counter: 0\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("COUNTER=0\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "counter", SourceFile: sourceFile, SourceKey: "counter", TargetFile: targetFile, TargetKey: "COUNTER", Enabled: true},
+		},
+		Debounce:      models.Duration(10 * time.Millisecond),
+		BatchDelay:    models.Duration(300 * time.Millisecond),
+		BatchMaxDelay: models.Duration(500 * time.Millisecond),
+		HistoryFile:   filepath.Join(tempDir, "history.jsonl"),
+		StateFile:     filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// Keep changing the source for longer than the max delay, never leaving
+	// it alone for the batch delay
+	var synced bool
+	for i := 1; i <= 30; i++ {
+		if err := os.WriteFile(sourceFile, []byte(fmt.Sprintf("counter: %d\n", i)), 0644); err != nil {
+			t.Fatalf("Failed to update source file: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if content, _ := os.ReadFile(targetFile); string(content) != "COUNTER=0\n" {
+			synced = true
+		}
+	}
+	if !synced {
+		t.Error("Target file should be synced within batch_max_delay while the source keeps changing")
+	}
+
+	waitForFileContent(t, targetFile, "COUNTER=30")
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+// TestIntegrationFanOut tests that a source syncing to many target files
+// updates every one of them, with the events in target file order
+func TestIntegrationFanOut(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Debounce:      models.Duration(10 * time.Millisecond),
+		TargetWorkers: 4,
+		HistoryFile:   filepath.Join(tempDir, "history.jsonl"),
+		StateFile:     filepath.Join(tempDir, "state.json"),
+	}
+	var targets []string
+	for i := range 32 {
+		targetFile := filepath.Join(tempDir, fmt.Sprintf("service-%02d.env", i))
+		if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\n"), 0644); err != nil {
+			t.Fatalf("Failed to create target file: %v", err)
+		}
+		targets = append(targets, targetFile)
+		cfg.Rules = append(cfg.Rules, models.SyncRule{
+			ID: fmt.Sprintf("host-%02d", i), SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true,
+		})
+	}
+
+	events := make(chan models.SyncEvent, len(targets))
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) { events <- event })
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	for i := range targets {
+		select {
+		case event := <-events:
+			if !event.Success {
+				t.Errorf("Sync to %s failed: %s", event.TargetFile, event.Error)
+			}
+			if event.TargetFile != targets[i] {
+				t.Errorf("Event %d is for %s, want %s", i, event.TargetFile, targets[i])
+			}
+		case <-time.After(3 * time.Second):
+			t.Fatalf("Timed out waiting for event %d", i)
+		}
+	}
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	for _, targetFile := range targets {
+		if content, _ := os.ReadFile(targetFile); string(content) != "DB_HOST=db.internal\n" {
+			t.Errorf("Target file %s = %q", targetFile, content)
+		}
+	}
+}
+
+func TestIntegrationLargeJSONSource(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "generated.json")
+	targetFile := filepath.Join(tempDir, "target.env")
+	writeSource := func(version string) {
+		var b strings.Builder
+		fmt.Fprintf(&b, `{"version": %q, "items": [`, version)
+		for i := 0; b.Len() < parser.StreamMinSize; i++ {
+			fmt.Fprintf(&b, `{"id": %d, "name": "item %d"}, `, i, i)
+		}
+		b.WriteString(`{"id": -1}], "build": {"id": 42}}`)
+		if err := os.WriteFile(sourceFile, []byte(b.String()), 0644); err != nil {
+			t.Fatalf("Failed to write source file: %v", err)
+		}
+	}
+	writeSource("1.0.0")
+	if err := os.WriteFile(targetFile, []byte("VERSION=\nBUILD=\nITEM=\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "version", SourceFile: sourceFile, SourceKey: "version", TargetFile: targetFile, TargetKey: "VERSION", Enabled: true},
+			{ID: "build", SourceFile: sourceFile, SourceKey: "build.id", TargetFile: targetFile, TargetKey: "BUILD", Enabled: true},
+			{ID: "item", SourceFile: sourceFile, SourceKey: "items[2].name", TargetFile: targetFile, TargetKey: "ITEM", Enabled: true},
+		},
+		Debounce:    models.Duration(10 * time.Millisecond),
+		BatchDelay:  models.Duration(10 * time.Millisecond),
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	writeSource("1.1.0")
+	waitForFileContent(t, targetFile, "VERSION=1.1.0")
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	content, _ := os.ReadFile(targetFile)
+	if string(content) != "VERSION=1.1.0\nBUILD=42\nITEM=\"item 2\"\n" {
+		t.Errorf("Target file = %q, want every key read from the large source", content)
+	}
+}
+
+func TestIntegrationLargeYAMLSource(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "generated.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	writeSource := func(version string) {
+		var b strings.Builder
+		fmt.Fprintf(&b, "version: %q\nbuild:\n  id: 42\ntags: [stable, lts, signed]\nitems:\n", version)
+		for i := 0; b.Len() < parser.StreamMinSize; i++ {
+			fmt.Fprintf(&b, "  - id: %d\n    name: item %d\n", i, i)
+		}
+		if err := os.WriteFile(sourceFile, []byte(b.String()), 0644); err != nil {
+			t.Fatalf("Failed to write source file: %v", err)
+		}
+	}
+	writeSource("1.0.0")
+	if err := os.WriteFile(targetFile, []byte("VERSION=\nBUILD=\nITEM=\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "version", SourceFile: sourceFile, SourceKey: "version", TargetFile: targetFile, TargetKey: "VERSION", Enabled: true},
+			{ID: "build", SourceFile: sourceFile, SourceKey: "build.id", TargetFile: targetFile, TargetKey: "BUILD", Enabled: true},
+			{ID: "item", SourceFile: sourceFile, SourceKey: "tags[2]", TargetFile: targetFile, TargetKey: "ITEM", Enabled: true},
+		},
+		Debounce:    models.Duration(10 * time.Millisecond),
+		BatchDelay:  models.Duration(10 * time.Millisecond),
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	writeSource("1.1.0")
+	waitForFileContent(t, targetFile, "VERSION=1.1.0")
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	content, _ := os.ReadFile(targetFile)
+	if string(content) != "VERSION=1.1.0\nBUILD=42\nITEM=signed\n" {
+		t.Errorf("Target file = %q, want every key read from the large source", content)
+	}
+}
+
+// TestIntegrationOutputJSON tests that every command prints JSON with its
+// documented fields when asked to, before the command or with its -output
+// flag, and nothing else on stdout
+func TestIntegrationOutputJSON(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	configFile := filepath.Join(tempDir, "var-sync.json")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n  port: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\nDB_PORT=5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", Name: "Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "port", Name: "Port", SourceFile: sourceFile, SourceKey: "database.port", TargetFile: targetFile, TargetKey: "DB_PORT", Enabled: true},
+		},
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+	if err := config.Save(cfg, configFile); err != nil {
+		t.Fatalf("Failed to save config: %v", err)
+	}
+
+	run := func(output string, args ...string) (string, error) {
+		var out strings.Builder
+		ctx := &cli.Context{Config: cfg, ConfigPath: configFile, Logger: logger.New(), Stdout: &out, Output: output}
+		err := cli.Run(ctx, args)
+		return out.String(), err
+	}
+
+	tests := []struct {
+		args   []string
+		global bool     // Ask for JSON before the command rather than with -output
+		array  bool     // The command prints an array of objects
+		fields []string // Fields every object printed has
+	}{
+		{[]string{"status"}, true, true, []string{"rule_id", "name", "source_file", "target_file", "status"}},
+		{[]string{"status"}, false, true, []string{"rule_id", "status"}},
+		{[]string{"validate"}, false, false, []string{"valid", "rules", "problems"}},
+		{[]string{"keys", sourceFile}, false, true, []string{"key", "type", "value"}},
+		{[]string{"get", sourceFile, "database.host"}, true, false, []string{"file", "key", "type", "value"}},
+		{[]string{"set", targetFile, "DB_PORT", "5433"}, false, false, []string{"file", "key", "type", "value"}},
+		{[]string{"history"}, true, true, nil},
+		{[]string{"diff", sourceFile, sourceFile}, false, true, nil},
+		{[]string{"render-env", sourceFile, "DB_HOST=database.host"}, true, false, []string{"content", "variables"}},
+		{[]string{"rule", "list"}, false, true, []string{"id", "name", "source_file", "target_file"}},
+		{[]string{"rule", "show", "host"}, true, false, []string{"id", "name"}},
+		{[]string{"rule", "disable", "port"}, false, false, []string{"id", "enabled"}},
+		{[]string{"rule", "enable", "port"}, true, false, []string{"id", "enabled"}},
+		{[]string{"config", "export"}, true, false, []string{"rules"}},
+	}
+	for _, tt := range tests {
+		args, output := tt.args, cli.OutputJSON
+		if !tt.global {
+			args, output = append(append([]string(nil), args...), "-output", "json"), ""
+		}
+		printed, err := run(output, args...)
+		if err != nil {
+			t.Errorf("%v returned error: %v", args, err)
+			continue
+		}
+
+		var objects []map[string]any
+		if tt.array {
+			err = json.Unmarshal([]byte(printed), &objects)
+		} else {
+			var object map[string]any
+			err = json.Unmarshal([]byte(printed), &object)
+			objects = append(objects, object)
+		}
+		if err != nil {
+			t.Errorf("%v printed %q, not JSON: %v", args, printed, err)
+			continue
+		}
+		for _, object := range objects {
+			for _, field := range tt.fields {
+				if _, ok := object[field]; !ok {
+					t.Errorf("%v printed %v, missing %s", args, object, field)
+				}
+			}
+		}
+	}
+
+	// Empty results are printed as empty arrays rather than as text
+	if printed, err := run(cli.OutputJSON, "history"); err != nil || strings.TrimSpace(printed) != "[]" {
+		t.Errorf("history with no events printed %q, %v; want []", printed, err)
+	}
+
+	// Asking for text after JSON before the command prints text
+	if printed, err := run(cli.OutputJSON, "get", sourceFile, "database.host", "-output", "text"); err != nil || printed != "db.internal\n" {
+		t.Errorf("get -output text printed %q, %v; want the value", printed, err)
+	}
+
+	for _, output := range []string{"xml", ""} {
+		args := []string{"status", "-output", "xml"}
+		if output != "" {
+			args = []string{"status"}
+		}
+		if _, err := run(output, args...); err == nil {
+			t.Errorf("%v with output %q should fail", args, output)
+		}
+	}
+
+	var out strings.Builder
+	if err := sync.New(cfg, logger.New()).DryRunJSON(&out); err != nil {
+		t.Fatalf("DryRunJSON() returned error: %v", err)
+	}
+	var plan struct {
+		Changed int `json:"changed"`
+		Failed  int `json:"failed"`
+		Files   []struct {
+			TargetFile string `json:"target_file"`
+			Changed    bool   `json:"changed"`
+			Diff       string `json:"diff"`
+			Rules      []struct {
+				RuleID   string `json:"rule_id"`
+				NewValue any    `json:"new_value"`
+			} `json:"rules"`
+		} `json:"files"`
+	}
+	if err := json.Unmarshal([]byte(out.String()), &plan); err != nil {
+		t.Fatalf("DryRunJSON() printed %q, not JSON: %v", out.String(), err)
+	}
+	if plan.Changed != 1 || plan.Failed != 0 || len(plan.Files) != 1 || len(plan.Files[0].Rules) != 2 {
+		t.Fatalf("DryRunJSON() plan = %+v, want one changed file with two rules", plan)
+	}
+	if file := plan.Files[0]; file.TargetFile != targetFile || !file.Changed || !strings.Contains(file.Diff, "+DB_HOST=db.internal") {
+		t.Errorf("DryRunJSON() file = %+v, want the diff of the target", file)
+	}
+}
+
+// TestIntegrationSyncCheck tests that sync -check passes when every target
+// holds its sources' values and otherwise fails, listing the keys that differ
+func TestIntegrationSyncCheck(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n  port: 5432\n  password: hunter2\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\nDB_PORT=5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", Name: "Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "port", Name: "Port", SourceFile: sourceFile, SourceKey: "database.port", TargetFile: targetFile, TargetKey: "DB_PORT", Enabled: true},
+		},
+	}
+	run := func(args ...string) (string, error) {
+		var out strings.Builder
+		ctx := &cli.Context{Config: cfg, Logger: logger.New(), Stdout: &out}
+		err := cli.Run(ctx, args)
+		return out.String(), err
+	}
+
+	if output, err := run("sync", "-check"); err != nil || output != "Every target is in sync.\n" {
+		t.Errorf("sync -check of synced targets = %q, %v; want it to pass", output, err)
+	}
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n  port: 5432\n  password: hunter2\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	cfg.Rules = append(cfg.Rules,
+		models.SyncRule{ID: "password", Name: "Password", SourceFile: sourceFile, SourceKey: "database.password", TargetFile: filepath.Join(tempDir, "secret.env"), TargetKey: "PASS", CreateMissing: true, Sensitive: true, Enabled: true},
+		models.SyncRule{ID: "user", Name: "User", SourceFile: sourceFile, SourceKey: "database.user", TargetFile: filepath.Join(tempDir, "other.env"), TargetKey: "DB_USER", Enabled: true},
+	)
+
+	output, err := run("sync", "-check")
+	if err == nil {
+		t.Fatalf("sync -check of stale targets should fail, printed:\n%s", output)
+	}
+	for _, want := range []string{
+		"~ DB_HOST: localhost -> db.internal",
+		"secret.env is out of sync",
+		"+ PASS: " + models.RedactedValue,
+		"rule User (user):",
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("sync -check output is missing %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "hunter2") {
+		t.Errorf("sync -check printed the value of a sensitive rule:\n%s", output)
+	}
+
+	cfg.Rules = cfg.Rules[:3]
+	output, err = run("sync", "-check", "-output", "json")
+	if err == nil {
+		t.Fatalf("sync -check -output json of stale targets should fail, printed:\n%s", output)
+	}
+	var result struct {
+		InSync  bool `json:"in_sync"`
+		Targets []struct {
+			TargetFile string `json:"target_file"`
+			Keys       []struct {
+				Key    string `json:"key"`
+				Change string `json:"change"`
+				Old    any    `json:"old"`
+				New    any    `json:"new"`
+			} `json:"keys"`
+		} `json:"targets"`
+		Failed []any `json:"failed"`
+	}
+	if err := json.Unmarshal([]byte(output), &result); err != nil {
+		t.Fatalf("sync -check -output json printed %q, not JSON: %v", output, err)
+	}
+	if result.InSync || len(result.Targets) != 2 || len(result.Failed) != 0 {
+		t.Fatalf("sync -check -output json = %+v, want two stale targets", result)
+	}
+	if keys := result.Targets[0].Keys; result.Targets[0].TargetFile != targetFile || len(keys) != 1 || keys[0].Key != "DB_HOST" || keys[0].Change != "changed" || keys[0].New != "db.internal" {
+		t.Errorf("sync -check -output json target = %+v, want DB_HOST changed", result.Targets[0])
+	}
+
+	if _, err := run("sync"); err == nil {
+		t.Error("sync without -check or -dry-run should fail")
+	}
+	output, err = run("sync", "-dry-run")
+	if err != nil || !strings.Contains(output, "+DB_HOST=db.internal") {
+		t.Errorf("sync -dry-run = %q, %v; want the diff", output, err)
+	}
+	if content, _ := os.ReadFile(targetFile); string(content) != "DB_HOST=localhost\nDB_PORT=5432\n" {
+		t.Errorf("sync -check and -dry-run should not write targets, target = %q", content)
+	}
+}
+
+// TestIntegrationSyncCheckSensitiveKeys tests that sync -check masks only the
+// keys sensitive rules write in a target shared with other rules
+func TestIntegrationSyncCheckSensitiveKeys(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	targetFile := filepath.Join(tempDir, "target.env")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n  port: 6543\n  password: hunter2\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\nDB_PORT=5432\nDB_PASSWORD=old-secret\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "host", Name: "Host", SourceFile: sourceFile, SourceKey: "database.host", TargetFile: targetFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "port", Name: "Port", SourceFile: sourceFile, SourceKey: "database.port", TargetFile: targetFile, TargetKey: "DB_PORT", Enabled: true},
+			{ID: "password", Name: "Password", SourceFile: sourceFile, SourceKey: "database.password", TargetFile: targetFile, TargetKey: "DB_PASSWORD", Sensitive: true, Enabled: true},
+		},
+	}
+	var out strings.Builder
+	ctx := &cli.Context{Config: cfg, Logger: logger.New(), Stdout: &out}
+	if err := cli.Run(ctx, []string{"sync", "-check"}); err == nil {
+		t.Fatalf("sync -check of a stale target should fail, printed:\n%s", out.String())
+	}
+
+	output := out.String()
+	for _, want := range []string{
+		"~ DB_HOST: localhost -> db.internal",
+		"~ DB_PORT: 5432 -> 6543",
+		"~ DB_PASSWORD: " + models.RedactedValue + " -> " + models.RedactedValue,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("sync -check output is missing %q:\n%s", want, output)
+		}
+	}
+	if strings.Contains(output, "hunter2") || strings.Contains(output, "old-secret") {
+		t.Errorf("sync -check printed the value of a sensitive rule:\n%s", output)
+	}
+}
+
+// TestIntegrationChainedRules tests that a target that is the source of
+// another rule syncs on through it, and that an edit made to it just after
+// var-sync wrote it is synced rather than debounced as part of that write
+func TestIntegrationChainedRules(t *testing.T) {
+	tempDir := t.TempDir()
+	baseFile := filepath.Join(tempDir, "base.yaml")
+	appFile := filepath.Join(tempDir, "app.yaml")
+	envFile := filepath.Join(tempDir, "app.env")
+	if err := os.WriteFile(baseFile, []byte("host: localhost\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(appFile, []byte("host: localhost\nport: 5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(envFile, []byte("DB_HOST=localhost\nDB_PORT=5432\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{
+			{ID: "base", SourceFile: baseFile, SourceKey: "host", TargetFile: appFile, TargetKey: "host", Enabled: true},
+			{ID: "host", SourceFile: appFile, SourceKey: "host", TargetFile: envFile, TargetKey: "DB_HOST", Enabled: true},
+			{ID: "port", SourceFile: appFile, SourceKey: "port", TargetFile: envFile, TargetKey: "DB_PORT", Enabled: true},
+		},
+		Debounce:    models.Duration(5 * time.Second),
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(baseFile, []byte("host: db.internal\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	waitForFileContent(t, envFile, "DB_HOST=db.internal")
+
+	// Well within the debounce of var-sync's own write to app.yaml
+	if err := os.WriteFile(appFile, []byte("host: db.internal\nport: 6543\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	waitForFileContent(t, envFile, "DB_PORT=6543")
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
+
+// TestIntegrationMultiKeyRule tests that the mappings of a multi-key rule are
+// written together, with an event each, and that a mapping held back holds
+// back the others
+func TestIntegrationMultiKeyRule(t *testing.T) {
+	tempDir := t.TempDir()
+	sourceFile := filepath.Join(tempDir, "app.yaml")
+	targetFile := filepath.Join(tempDir, "app.env")
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: localhost\n  port: 5432\n  name: app\n"), 0644); err != nil {
+		t.Fatalf("Failed to create source file: %v", err)
+	}
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=localhost\nDB_PORT=5432\nDB_NAME=app\n"), 0644); err != nil {
+		t.Fatalf("Failed to create target file: %v", err)
+	}
+
+	cfg := &models.Config{
+		Rules: []models.SyncRule{{
+			ID: "database", Name: "Database", SourceFile: sourceFile, TargetFile: targetFile, Enabled: true,
+			Mappings: []models.KeyMapping{
+				{SourceKey: "database.host", TargetKey: "DB_HOST"},
+				{SourceKey: "database.port", TargetKey: "DB_PORT"},
+				{SourceKey: "database.name", TargetKey: "DB_NAME"},
+			},
+		}},
+		Debounce:    models.Duration(10 * time.Millisecond),
+		HistoryFile: filepath.Join(tempDir, "history.jsonl"),
+		StateFile:   filepath.Join(tempDir, "state.json"),
+	}
+
+	events := make(chan models.SyncEvent, 10)
+	stop := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- sync.New(cfg, logger.New()).Run(stop, func(event models.SyncEvent) { events <- event })
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// receive returns the events of one sync by target key
+	receive := func() map[string]models.SyncEvent {
+		t.Helper()
+		received := make(map[string]models.SyncEvent)
+		for len(received) < len(cfg.Rules[0].Mappings) {
+			select {
+			case event := <-events:
+				if event.RuleID != "database" {
+					t.Errorf("Event for rule %s, want database", event.RuleID)
+				}
+				received[event.TargetKey] = event
+			case <-time.After(3 * time.Second):
+				t.Fatalf("Timed out waiting for events, got %v", received)
+			}
+		}
+		return received
+	}
+
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.internal\n  port: 6543\n  name: app\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	received := receive()
+	for key, event := range received {
+		if !event.Success {
+			t.Errorf("Mapping to %s failed: %s", key, event.Error)
+		}
+		if event.ChangeID != received["DB_HOST"].ChangeID {
+			t.Errorf("Mapping to %s has change ID %s, want the change ID shared by the others", key, event.ChangeID)
+		}
+	}
+	if fmt.Sprint(received["DB_PORT"].NewValue) != "6543" {
+		t.Errorf("Mapping to DB_PORT new value = %v, want 6543", received["DB_PORT"].NewValue)
+	}
+	if content, _ := os.ReadFile(targetFile); string(content) != "DB_HOST=db.internal\nDB_PORT=6543\nDB_NAME=app\n" {
+		t.Errorf("Target file = %q", content)
+	}
+
+	// Without DB_NAME in the target, the other mappings are held back too
+	if err := os.WriteFile(targetFile, []byte("DB_HOST=db.internal\nDB_PORT=6543\n"), 0644); err != nil {
+		t.Fatalf("Failed to update target file: %v", err)
+	}
+	if err := os.WriteFile(sourceFile, []byte("database:\n  host: db.example.com\n  port: 6543\n  name: shop\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+	received = receive()
+	if event := received["DB_NAME"]; event.Success || !strings.Contains(event.Error, "does not exist") {
+		t.Errorf("Mapping to the missing DB_NAME = %+v, want it to fail", event)
+	}
+	if event := received["DB_HOST"]; event.Success || !strings.Contains(event.Error, "another mapping") {
+		t.Errorf("Mapping to DB_HOST = %+v, want it held back with DB_NAME", event)
+	}
+	if content, _ := os.ReadFile(targetFile); string(content) != "DB_HOST=db.internal\nDB_PORT=6543\n" {
+		t.Errorf("Target file should be left alone, got %q", content)
+	}
+
+	close(stop)
+	if err := <-done; err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+}
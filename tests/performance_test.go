@@ -133,6 +133,7 @@ func BenchmarkParserGetValue(b *testing.B) {
 	
 	for _, tc := range testCases {
 		b.Run(tc.name, func(b *testing.B) {
+			b.ReportAllocs()
 			b.ResetTimer()
 			for i := 0; i < b.N; i++ {
 				_, err := parser.GetValue(data, tc.keyPath)
@@ -158,6 +159,36 @@ func BenchmarkParserSetValue(b *testing.B) {
 	}
 }
 
+// BenchmarkParserSetExistingValue benchmarks replacing a value in place,
+// without the cost of building the data each time
+func BenchmarkParserSetExistingValue(b *testing.B) {
+	data := createLargeTestData()
+	parser := parser.New()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := parser.SetValue(data, "level1.level2.level3.level4.deep_value", "updated")
+		if err != nil {
+			b.Fatalf("SetValue failed: %v", err)
+		}
+	}
+}
+
+// BenchmarkParserGetAllKeys benchmarks listing every key path
+func BenchmarkParserGetAllKeys(b *testing.B) {
+	data := createLargeTestData()
+	parser := parser.New()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if keys := parser.GetAllKeys(data, ""); len(keys) == 0 {
+			b.Fatal("GetAllKeys returned no keys")
+		}
+	}
+}
+
 // BenchmarkParserSaveFile benchmarks file saving performance
 func BenchmarkParserSaveFile(b *testing.B) {
 	tempDir := b.TempDir()
@@ -416,6 +447,38 @@ func TestPerformanceMemoryUsage(t *testing.T) {
 	}
 }
 
+// TestPerformanceAllocations checks that reading and writing values does not
+// allocate: key paths are parsed once and kept, and objects are walked as
+// they are rather than converted
+func TestPerformanceAllocations(t *testing.T) {
+	data := createLargeTestData()
+	parser := parser.New()
+
+	getAllocs := testing.AllocsPerRun(100, func() {
+		parser.GetValue(data, "level1.level2.level3.level4.deep_value")
+		parser.GetValue(data, "api.endpoints[1].method")
+	})
+	if getAllocs > 0 {
+		t.Errorf("GetValue allocated %.0f times per run (expected 0)", getAllocs)
+	}
+
+	setAllocs := testing.AllocsPerRun(100, func() {
+		parser.SetValue(data, "database.config.ssl", false)
+	})
+	if setAllocs > 0 {
+		t.Errorf("SetValue of an existing key allocated %.0f times per run (expected 0)", setAllocs)
+	}
+
+	// Each key path is a string of its own, plus the growing slice of them
+	keyCount := len(parser.GetAllKeys(data, ""))
+	keysAllocs := testing.AllocsPerRun(20, func() {
+		parser.GetAllKeys(data, "")
+	})
+	if maxAllocs := float64(keyCount + 20); keysAllocs > maxAllocs {
+		t.Errorf("GetAllKeys allocated %.0f times for %d keys (expected < %.0f)", keysAllocs, keyCount, maxAllocs)
+	}
+}
+
 // TestPerformanceConcurrency tests performance under concurrent load
 func TestPerformanceConcurrency(t *testing.T) {
 	if testing.Short() {
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -158,9 +159,9 @@ api:
 	// Check that all expected values are present
 	expectedValues := map[string]any{
 		"config.db_host":      "production-db.example.com",
-		"config.db_port":      float64(5433), // JSON loads numbers as float64
+		"config.db_port":      int64(5433), // JSON loads integers as int64
 		"config.api_endpoint": "https://api.production.com", 
-		"config.api_timeout":  float64(60),
+		"config.api_timeout":  int64(60),
 	}
 	
 	mu.Lock()
@@ -393,4 +394,92 @@ func TestFileCorruptionDetection(t *testing.T) {
 			t.Logf("Successfully wrote %d values to target file", len(dataMap))
 		}
 	}
-}
\ No newline at end of file
+}
+
+// TestRaceEventsDuringSelfWrite changes a target while var-sync writes it, so
+// that its events are held back until the write is done, while events for
+// another source keep arriving
+func TestRaceEventsDuringSelfWrite(t *testing.T) {
+	tempDir := t.TempDir()
+
+	sourceFile := filepath.Join(tempDir, "source.yaml")
+	middleFile := filepath.Join(tempDir, "middle.json")
+	finalFile := filepath.Join(tempDir, "final.json")
+	otherFile := filepath.Join(tempDir, "other.yaml")
+	otherTarget := filepath.Join(tempDir, "other.json")
+
+	// A large target takes long enough to update for changes to be made to
+	// it while it is written
+	middle := fmt.Sprintf(`{"value": 0, "padding": %q}`, strings.Repeat("x", 4<<20))
+	for file, content := range map[string]string{
+		sourceFile:  "value: 0\n",
+		middleFile:  middle,
+		finalFile:   `{"value": 0}`,
+		otherFile:   "value: 0\n",
+		otherTarget: `{"value": 0}`,
+	} {
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create %s: %v", file, err)
+		}
+	}
+
+	rules := []models.SyncRule{
+		{ID: "source-to-middle", SourceFile: sourceFile, SourceKey: "value", TargetFile: middleFile, TargetKey: "value", Enabled: true},
+		{ID: "middle-to-final", SourceFile: middleFile, SourceKey: "value", TargetFile: finalFile, TargetKey: "value", Enabled: true},
+		{ID: "other", SourceFile: otherFile, SourceKey: "value", TargetFile: otherTarget, TargetKey: "value", Enabled: true},
+	}
+
+	fw, err := watcher.New(logger.New())
+	if err != nil {
+		t.Fatalf("Failed to create watcher: %v", err)
+	}
+	defer fw.Stop()
+
+	fw.SetDebounce(time.Millisecond)
+	fw.SetBatchDelay(time.Millisecond)
+	if err := fw.SetRules(rules); err != nil {
+		t.Fatalf("Failed to set rules: %v", err)
+	}
+	if err := fw.Start(); err != nil {
+		t.Fatalf("Failed to start watcher: %v", err)
+	}
+	go func() {
+		for range fw.Events() {
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	if err := os.WriteFile(sourceFile, []byte("value: 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to update source file: %v", err)
+	}
+
+	// Until the change reaches the end of the chain, the middle target is
+	// appended to, which leaves it valid JSON, and the other source edited
+	p := parser.New()
+	deadline := time.Now().Add(10 * time.Second)
+	for i := 1; ; i++ {
+		data, err := p.LoadFile(finalFile)
+		if err == nil {
+			if value, _ := p.GetValue(data, "value"); value == int64(1) {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never held the change: %v, %v", finalFile, data, err)
+		}
+
+		file, err := os.OpenFile(middleFile, os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatalf("Failed to open middle target: %v", err)
+		}
+		_, err = file.WriteString("\n")
+		file.Close()
+		if err != nil {
+			t.Fatalf("Failed to append to middle target: %v", err)
+		}
+		if err := os.WriteFile(otherFile, []byte(fmt.Sprintf("value: %d\n", i)), 0644); err != nil {
+			t.Fatalf("Failed to update other source file: %v", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -228,14 +228,14 @@ cache:
 	// Expected values (after sync)
 	expectedValues := map[string]any{
 		"config.db_host":      "production-db.example.com",
-		"config.db_port":      float64(5433), // JSON loads numbers as float64
+		"config.db_port":      int64(5433), // JSON loads integers as int64
 		"config.db_user":      "prod_user",
 		"config.api_endpoint": "https://api.production.com",
-		"config.api_timeout":  float64(60),
-		"config.api_retries":  float64(5),
+		"config.api_timeout":  int64(60),
+		"config.api_retries":  int64(5),
 		"config.cache_host":   "redis.production.com",
-		"config.cache_port":   float64(6379),
-		"config.cache_ttl":    float64(7200),
+		"config.cache_port":   int64(6379),
+		"config.cache_ttl":    int64(7200),
 	}
 	
 	// Verify all values were synced correctly
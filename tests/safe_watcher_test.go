@@ -171,10 +171,10 @@ api:
 	// Check that all expected values are present (should be from the last update)
 	expectedValues := map[string]any{
 		"config.db_host":      "safe-host-2",
-		"config.db_port":      float64(5434), // JSON loads numbers as float64
+		"config.db_port":      int64(5434), // JSON loads integers as int64
 		"config.db_username":  "user-2",
 		"config.api_endpoint": "https://safe-api-2.com",
-		"config.api_timeout":  float64(50),
+		"config.api_timeout":  int64(50),
 	}
 	
 	mu.Lock()